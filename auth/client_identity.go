@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"strings"
+)
+
+// ClientIdentity describes a caller authenticated by a verified client
+// certificate (mutual TLS).
+type ClientIdentity struct {
+	CommonName string   `json:"common_name,omitempty"`
+	DNSNames   []string `json:"dns_names,omitempty"`
+	URIs       []string `json:"uris,omitempty"`
+	// SPIFFEID is the first spiffe:// URI SAN, as issued by SPIRE and
+	// most service meshes.
+	SPIFFEID string `json:"spiffe_id,omitempty"`
+}
+
+// String returns the most specific name: the SPIFFE ID, the common name,
+// or the first DNS name.
+func (id *ClientIdentity) String() string {
+	switch {
+	case id.SPIFFEID != "":
+		return id.SPIFFEID
+	case id.CommonName != "":
+		return id.CommonName
+	case len(id.DNSNames) > 0:
+		return id.DNSNames[0]
+	}
+	return ""
+}
+
+// ClientIdentityFromTLS extracts the identity of a verified client
+// certificate. It returns nil for plain connections and for certificates
+// that were presented but not verified against the client CA.
+func ClientIdentityFromTLS(state *tls.ConnectionState) *ClientIdentity {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	leaf := state.VerifiedChains[0][0]
+	id := &ClientIdentity{
+		CommonName: leaf.Subject.CommonName,
+		DNSNames:   leaf.DNSNames,
+	}
+	for _, u := range leaf.URIs {
+		s := u.String()
+		id.URIs = append(id.URIs, s)
+		if id.SPIFFEID == "" && strings.EqualFold(u.Scheme, "spiffe") {
+			id.SPIFFEID = s
+		}
+	}
+	return id
+}
+
+type clientIdentityKey struct{}
+
+// WithClientIdentity stores the caller's certificate identity in the context.
+func WithClientIdentity(ctx context.Context, id *ClientIdentity) context.Context {
+	return context.WithValue(ctx, clientIdentityKey{}, id)
+}
+
+// ClientIdentityFromContext returns the caller's certificate identity, or
+// nil when the request did not present a verified client certificate.
+func ClientIdentityFromContext(ctx context.Context) *ClientIdentity {
+	id, _ := ctx.Value(clientIdentityKey{}).(*ClientIdentity)
+	return id
+}
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/url"
+	"testing"
+)
+
+func TestClientIdentityFromTLS(t *testing.T) {
+	spiffe, _ := url.Parse("spiffe://example.org/ns/prod/sa/billing")
+	other, _ := url.Parse("https://billing.example.org")
+	leaf := &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "billing"},
+		DNSNames: []string{"billing.prod.svc"},
+		URIs:     []*url.URL{other, spiffe},
+	}
+
+	id := ClientIdentityFromTLS(&tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{leaf}}})
+	if id == nil {
+		t.Fatal("Expected identity from verified chain")
+	}
+	if id.CommonName != "billing" || id.SPIFFEID != spiffe.String() || len(id.URIs) != 2 {
+		t.Errorf("Unexpected identity %+v", id)
+	}
+	if id.String() != spiffe.String() {
+		t.Errorf("Expected SPIFFE ID to be preferred, got %q", id.String())
+	}
+
+	// Presented but unverified certificates carry no identity
+	if ClientIdentityFromTLS(&tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf}}) != nil {
+		t.Error("Unverified certificate must not produce an identity")
+	}
+	if ClientIdentityFromTLS(nil) != nil {
+		t.Error("Plain connection must not produce an identity")
+	}
+}
+
+func TestClientIdentityString(t *testing.T) {
+	if got := (&ClientIdentity{CommonName: "cn", DNSNames: []string{"dns"}}).String(); got != "cn" {
+		t.Errorf("Expected CN, got %q", got)
+	}
+	if got := (&ClientIdentity{DNSNames: []string{"dns"}}).String(); got != "dns" {
+		t.Errorf("Expected DNS name, got %q", got)
+	}
+}
+
+func TestClientIdentityContext(t *testing.T) {
+	if ClientIdentityFromContext(context.Background()) != nil {
+		t.Error("Expected nil identity on empty context")
+	}
+	ctx := WithClientIdentity(context.Background(), &ClientIdentity{CommonName: "billing"})
+	if got := ClientIdentityFromContext(ctx); got == nil || got.CommonName != "billing" {
+		t.Errorf("Unexpected identity %+v", got)
+	}
+}
@@ -0,0 +1,227 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// JWKSConfig configures a remote JSON Web Key Set.
+type JWKSConfig struct {
+	// URL is the JWKS endpoint, e.g. https://issuer/.well-known/jwks.json.
+	URL string
+	// Client fetches the key set. Nil uses a client with a 5s timeout.
+	Client *http.Client
+	// RefreshInterval is how long fetched keys are trusted before the set
+	// is fetched again. Defaults to one hour.
+	RefreshInterval time.Duration
+	// MinRefreshInterval limits refetches triggered by unknown key IDs,
+	// so tokens with made-up kids cannot hammer the issuer. Defaults to
+	// one minute.
+	MinRefreshInterval time.Duration
+}
+
+// jwksFetchTimeout bounds a key set fetch, which does not end with the
+// request that triggered it.
+const jwksFetchTimeout = 10 * time.Second
+
+// JWKS is a KeySource backed by a remote key set. Keys are cached and
+// refreshed when stale or when a token names a key not seen yet, which
+// picks up issuer key rotation without a restart.
+type JWKS struct {
+	cfg JWKSConfig
+	now func() time.Time
+
+	// fetchMu serialises fetches; mu guards the cached state
+	fetchMu     sync.Mutex
+	mu          sync.RWMutex
+	keys        map[string]crypto.PublicKey
+	fetchedAt   time.Time
+	attemptedAt time.Time
+}
+
+// NewJWKS returns a JWKS for cfg. Nothing is fetched until the first Key call.
+func NewJWKS(cfg JWKSConfig) *JWKS {
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 5 * time.Second}
+	}
+	if cfg.RefreshInterval <= 0 {
+		cfg.RefreshInterval = time.Hour
+	}
+	if cfg.MinRefreshInterval <= 0 {
+		cfg.MinRefreshInterval = time.Minute
+	}
+	return &JWKS{cfg: cfg, now: time.Now}
+}
+
+// Key returns the public key for kid, fetching the key set if needed. A
+// failed refresh keeps serving previously fetched keys. Until a fetch has
+// succeeded every call retries it, so one failed first fetch does not
+// lock out all tokens for MinRefreshInterval.
+func (j *JWKS) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	key, fresh := j.cached(kid)
+	if key != nil && fresh {
+		return key, nil
+	}
+
+	j.fetchMu.Lock()
+	defer j.fetchMu.Unlock()
+
+	// Another caller may have refreshed while we waited
+	if key, fresh = j.cached(kid); key != nil && fresh {
+		return key, nil
+	}
+	j.mu.RLock()
+	throttled := !j.fetchedAt.IsZero() && j.now().Sub(j.attemptedAt) < j.cfg.MinRefreshInterval
+	j.mu.RUnlock()
+
+	if !throttled {
+		if err := j.refresh(ctx); err != nil && key == nil {
+			return nil, err
+		}
+		key, _ = j.cached(kid)
+	}
+	if key == nil {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+	}
+	return key, nil
+}
+
+// cached looks kid up and reports whether the set is within RefreshInterval.
+func (j *JWKS) cached(kid string) (crypto.PublicKey, bool) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	fresh := !j.fetchedAt.IsZero() && j.now().Sub(j.fetchedAt) < j.cfg.RefreshInterval
+	return StaticKeys(j.keys).lookup(kid), fresh
+}
+
+func (s StaticKeys) lookup(kid string) crypto.PublicKey {
+	key, err := s.Key(context.Background(), kid)
+	if err != nil {
+		return nil
+	}
+	return key
+}
+
+// refresh fetches the key set. It outlives ctx, keeping only its values:
+// the keys serve every request, so a caller that disconnects must not
+// abort the fetch for the others.
+func (j *JWKS) refresh(ctx context.Context) error {
+	j.mu.Lock()
+	j.attemptedAt = j.now()
+	j.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), jwksFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.cfg.URL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := j.cfg.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("fetch jwks: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetch jwks: unexpected status %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("decode jwks: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			// One odd key should not take down the others
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+	if len(keys) == 0 {
+		return errors.New("jwks contains no usable signing keys")
+	}
+
+	j.mu.Lock()
+	j.keys = keys
+	j.fetchedAt = j.now()
+	j.mu.Unlock()
+	return nil
+}
+
+// jsonWebKey is the subset of RFC 7517 needed for RSA and EC public keys.
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("ec point not on curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, fmt.Errorf("invalid key parameter %q", s)
+	}
+	return new(big.Int).SetBytes(b), nil
+}
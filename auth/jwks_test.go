@@ -0,0 +1,174 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func rsaJWK(kid string, pub *rsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA",
+		"kid": kid,
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}
+}
+
+// jwksServer serves the keys returned by current and counts fetches.
+func jwksServer(t *testing.T, current func() []map[string]string) (*httptest.Server, *int32) {
+	t.Helper()
+	var fetches int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": current()})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &fetches
+}
+
+func TestJWKSFetchesAndCaches(t *testing.T) {
+	srv, fetches := jwksServer(t, func() []map[string]string {
+		return []map[string]string{rsaJWK("k1", &testRSAKey.PublicKey)}
+	})
+	jwks := NewJWKS(JWKSConfig{URL: srv.URL})
+
+	for i := 0; i < 3; i++ {
+		key, err := jwks.Key(context.Background(), "k1")
+		if err != nil {
+			t.Fatalf("Key returned error: %v", err)
+		}
+		if key.(*rsa.PublicKey).N.Cmp(testRSAKey.N) != 0 {
+			t.Fatal("Fetched key does not match")
+		}
+	}
+	if *fetches != 1 {
+		t.Errorf("Expected 1 fetch, got %d", *fetches)
+	}
+}
+
+func TestJWKSRotation(t *testing.T) {
+	rotated, _ := rsa.GenerateKey(rand.Reader, 2048)
+	var keys atomic.Value
+	keys.Store([]map[string]string{rsaJWK("k1", &testRSAKey.PublicKey)})
+	srv, fetches := jwksServer(t, func() []map[string]string { return keys.Load().([]map[string]string) })
+
+	now := time.Unix(1700000000, 0)
+	jwks := NewJWKS(JWKSConfig{URL: srv.URL, MinRefreshInterval: time.Minute})
+	jwks.now = func() time.Time { return now }
+
+	if _, err := jwks.Key(context.Background(), "k1"); err != nil {
+		t.Fatalf("Key returned error: %v", err)
+	}
+
+	keys.Store([]map[string]string{rsaJWK("k2", &rotated.PublicKey)})
+	// Unknown kids inside the throttle window do not refetch
+	if _, err := jwks.Key(context.Background(), "k2"); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Expected ErrUnknownKey while throttled, got %v", err)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, err := jwks.Key(context.Background(), "k2"); err != nil {
+		t.Errorf("Expected rotated key after refetch, got %v", err)
+	}
+	if *fetches != 2 {
+		t.Errorf("Expected 2 fetches, got %d", *fetches)
+	}
+}
+
+func TestJWKSKeepsKeysWhenRefreshFails(t *testing.T) {
+	fail := int32(0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&fail) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{rsaJWK("k1", &testRSAKey.PublicKey)}})
+	}))
+	defer srv.Close()
+
+	now := time.Unix(1700000000, 0)
+	jwks := NewJWKS(JWKSConfig{URL: srv.URL, RefreshInterval: time.Hour})
+	jwks.now = func() time.Time { return now }
+	if _, err := jwks.Key(context.Background(), "k1"); err != nil {
+		t.Fatalf("Key returned error: %v", err)
+	}
+
+	atomic.StoreInt32(&fail, 1)
+	now = now.Add(2 * time.Hour)
+	if _, err := jwks.Key(context.Background(), "k1"); err != nil {
+		t.Errorf("Stale key should be served when the issuer is down, got %v", err)
+	}
+}
+
+func TestJWKSRetriesFailedFirstFetch(t *testing.T) {
+	fail := int32(1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&fail) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{rsaJWK("k1", &testRSAKey.PublicKey)}})
+	}))
+	defer srv.Close()
+
+	now := time.Unix(1700000000, 0)
+	jwks := NewJWKS(JWKSConfig{URL: srv.URL, MinRefreshInterval: time.Minute})
+	jwks.now = func() time.Time { return now }
+	if _, err := jwks.Key(context.Background(), "k1"); err == nil {
+		t.Fatal("Expected an error while the issuer is down")
+	}
+
+	// No key set has loaded yet, so the throttle does not apply
+	atomic.StoreInt32(&fail, 0)
+	if _, err := jwks.Key(context.Background(), "k1"); err != nil {
+		t.Errorf("Expected the key once the issuer recovered, got %v", err)
+	}
+}
+
+func TestJWKSFetchOutlivesCanceledRequest(t *testing.T) {
+	srv, _ := jwksServer(t, func() []map[string]string {
+		return []map[string]string{rsaJWK("k1", &testRSAKey.PublicKey)}
+	})
+	jwks := NewJWKS(JWKSConfig{URL: srv.URL})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := jwks.Key(ctx, "k1"); err != nil {
+		t.Errorf("Expected the fetch to ignore the canceled request, got %v", err)
+	}
+}
+
+func TestJWKParsesECKeys(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	jwk := jsonWebKey{
+		Kty: "EC",
+		Crv: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(ecKey.X.Bytes()),
+		Y:   base64.RawURLEncoding.EncodeToString(ecKey.Y.Bytes()),
+	}
+	pub, err := jwk.publicKey()
+	if err != nil {
+		t.Fatalf("publicKey returned error: %v", err)
+	}
+	if !pub.(*ecdsa.PublicKey).Equal(&ecKey.PublicKey) {
+		t.Error("Parsed EC key does not match")
+	}
+
+	jwk.Crv = "P-999"
+	if _, err := jwk.publicKey(); err == nil {
+		t.Error("Expected error for unsupported curve")
+	}
+}
@@ -0,0 +1,285 @@
+// Package auth verifies bearer credentials presented to the service.
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Token validation errors. Verify wraps them, so use errors.Is.
+var (
+	ErrMalformedToken       = errors.New("malformed token")
+	ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+	ErrInvalidSignature     = errors.New("invalid signature")
+	ErrUnknownKey           = errors.New("unknown signing key")
+	ErrWeakKey              = errors.New("signing key too weak")
+	ErrTokenExpired         = errors.New("token expired")
+	ErrMissingExpiry        = errors.New("token has no expiry")
+	ErrTokenNotYetValid     = errors.New("token not yet valid")
+	ErrInvalidIssuer        = errors.New("invalid issuer")
+	ErrInvalidAudience      = errors.New("invalid audience")
+)
+
+// NumericDate is a JWT timestamp, encoded as seconds since the epoch.
+type NumericDate struct {
+	time.Time
+}
+
+// UnmarshalJSON accepts integer and fractional second values.
+func (d *NumericDate) UnmarshalJSON(b []byte) error {
+	var secs float64
+	if err := json.Unmarshal(b, &secs); err != nil {
+		return err
+	}
+	whole := int64(secs)
+	d.Time = time.Unix(whole, int64((secs-float64(whole))*1e9))
+	return nil
+}
+
+// Audience is the "aud" claim, which may be a single string or a list.
+type Audience []string
+
+// UnmarshalJSON accepts both encodings of the audience claim.
+func (a *Audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+// Contains reports whether aud is one of the audiences.
+func (a Audience) Contains(aud string) bool {
+	for _, v := range a {
+		if v == aud {
+			return true
+		}
+	}
+	return false
+}
+
+// Claims are the verified contents of a token.
+type Claims struct {
+	Issuer    string       `json:"iss"`
+	Subject   string       `json:"sub"`
+	Audience  Audience     `json:"aud"`
+	ExpiresAt *NumericDate `json:"exp"`
+	NotBefore *NumericDate `json:"nbf"`
+	IssuedAt  *NumericDate `json:"iat"`
+	// Raw holds every claim, including application-specific ones.
+	Raw map[string]interface{} `json:"-"`
+}
+
+type claimsKey struct{}
+
+// WithClaims stores verified claims in the context.
+func WithClaims(ctx context.Context, c *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, c)
+}
+
+// ClaimsFromContext returns the claims of the authenticated caller, or nil
+// when the request was not authenticated with a token.
+func ClaimsFromContext(ctx context.Context) *Claims {
+	c, _ := ctx.Value(claimsKey{}).(*Claims)
+	return c
+}
+
+// KeySource resolves the public key a token was signed with.
+type KeySource interface {
+	Key(ctx context.Context, kid string) (crypto.PublicKey, error)
+}
+
+// StaticKeys is a fixed set of public keys indexed by key ID.
+type StaticKeys map[string]crypto.PublicKey
+
+// Key returns the key for kid. Tokens without a kid match a lone key.
+func (s StaticKeys) Key(_ context.Context, kid string) (crypto.PublicKey, error) {
+	if key, ok := s[kid]; ok {
+		return key, nil
+	}
+	if kid == "" && len(s) == 1 {
+		for _, key := range s {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+}
+
+// VerifierConfig configures token validation.
+type VerifierConfig struct {
+	// Keys resolves signing keys, typically a *JWKS.
+	Keys KeySource
+	// Issuer, when set, must equal the "iss" claim.
+	Issuer string
+	// Audience, when set, must be listed in the "aud" claim.
+	Audience string
+	// Leeway tolerates clock skew when checking exp and nbf.
+	Leeway time.Duration
+}
+
+// Verifier validates signed JWTs. Only asymmetric algorithms are accepted,
+// so a leaked verification key cannot be used to mint tokens.
+type Verifier struct {
+	cfg VerifierConfig
+	now func() time.Time
+}
+
+// NewVerifier returns a Verifier for cfg.
+func NewVerifier(cfg VerifierConfig) *Verifier {
+	return &Verifier{cfg: cfg, now: time.Now}
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verify checks the token's signature, expiry, issuer and audience and
+// returns its claims. Tokens without an exp claim are rejected.
+func (v *Verifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformedToken
+	}
+
+	var hdr header
+	if err := decodeSegment(parts[0], &hdr); err != nil {
+		return nil, err
+	}
+	hash, ok := algorithmHashes[hdr.Alg]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedAlgorithm, hdr.Alg)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+
+	key, err := v.cfg.Keys.Key(ctx, hdr.Kid)
+	if err != nil {
+		return nil, err
+	}
+	h := hash.New()
+	h.Write([]byte(parts[0] + "." + parts[1]))
+	if err := verifySignature(hdr.Alg, key, hash, h.Sum(nil), sig); err != nil {
+		return nil, err
+	}
+
+	claims := &Claims{}
+	if err := decodeSegment(parts[1], claims); err != nil {
+		return nil, err
+	}
+	if err := decodeSegment(parts[1], &claims.Raw); err != nil {
+		return nil, err
+	}
+	if err := v.validate(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (v *Verifier) validate(c *Claims) error {
+	now := v.now()
+	// A token without exp would be valid forever
+	if c.ExpiresAt == nil {
+		return ErrMissingExpiry
+	}
+	if now.After(c.ExpiresAt.Add(v.cfg.Leeway)) {
+		return ErrTokenExpired
+	}
+	if c.NotBefore != nil && now.Before(c.NotBefore.Add(-v.cfg.Leeway)) {
+		return ErrTokenNotYetValid
+	}
+	if v.cfg.Issuer != "" && c.Issuer != v.cfg.Issuer {
+		return fmt.Errorf("%w: %q", ErrInvalidIssuer, c.Issuer)
+	}
+	if v.cfg.Audience != "" && !c.Audience.Contains(v.cfg.Audience) {
+		return ErrInvalidAudience
+	}
+	return nil
+}
+
+var algorithmHashes = map[string]crypto.Hash{
+	"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512,
+	"PS256": crypto.SHA256, "PS384": crypto.SHA384, "PS512": crypto.SHA512,
+	"ES256": crypto.SHA256, "ES384": crypto.SHA384, "ES512": crypto.SHA512,
+}
+
+// algorithmCurves binds each ECDSA algorithm to its curve (RFC 7518 3.4).
+var algorithmCurves = map[string]elliptic.Curve{
+	"ES256": elliptic.P256(), "ES384": elliptic.P384(), "ES512": elliptic.P521(),
+}
+
+// minRSABits is the smallest RSA modulus accepted (RFC 7518 3.3).
+const minRSABits = 2048
+
+func verifySignature(alg string, key crypto.PublicKey, hash crypto.Hash, digest, sig []byte) error {
+	switch alg[:2] {
+	case "RS", "PS":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("%w: %s needs an RSA key", ErrUnsupportedAlgorithm, alg)
+		}
+		if pub.N.BitLen() < minRSABits {
+			return fmt.Errorf("%w: %d-bit RSA key, need %d", ErrWeakKey, pub.N.BitLen(), minRSABits)
+		}
+		var err error
+		if alg[0] == 'R' {
+			err = rsa.VerifyPKCS1v15(pub, hash, digest, sig)
+		} else {
+			err = rsa.VerifyPSS(pub, hash, digest, sig, nil)
+		}
+		if err != nil {
+			return ErrInvalidSignature
+		}
+	case "ES":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("%w: %s needs an EC key", ErrUnsupportedAlgorithm, alg)
+		}
+		if want := algorithmCurves[alg]; pub.Curve.Params().Name != want.Params().Name {
+			return fmt.Errorf("%w: %s needs a %s key", ErrUnsupportedAlgorithm, alg, want.Params().Name)
+		}
+		// JWS encodes ECDSA signatures as fixed-width r || s
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return ErrInvalidSignature
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return ErrInvalidSignature
+		}
+	}
+	return nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return ErrMalformedToken
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformedToken, err)
+	}
+	return nil
+}
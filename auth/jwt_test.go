@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testRSAKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+
+// signToken builds a compact JWS for claims using the given key.
+func signToken(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]interface{}) string {
+	t.Helper()
+	hdr, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	body, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(hdr) + "." + base64.RawURLEncoding.EncodeToString(body)
+
+	hash := algorithmHashes[alg]
+	h := hash.New()
+	h.Write([]byte(signingInput))
+	digest := h.Sum(nil)
+
+	var sig []byte
+	var err error
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		if strings.HasPrefix(alg, "PS") {
+			sig, err = rsa.SignPSS(rand.Reader, k, hash, digest, nil)
+		} else {
+			sig, err = rsa.SignPKCS1v15(rand.Reader, k, hash, digest)
+		}
+	case *ecdsa.PrivateKey:
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, k, digest)
+		size := (k.Curve.Params().BitSize + 7) / 8
+		sig = make([]byte, 2*size)
+		r.FillBytes(sig[:size])
+		s.FillBytes(sig[size:])
+	}
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func testVerifier(now time.Time) *Verifier {
+	v := NewVerifier(VerifierConfig{
+		Keys:     StaticKeys{"rsa": &testRSAKey.PublicKey},
+		Issuer:   "https://issuer.test",
+		Audience: "ping",
+		Leeway:   time.Minute,
+	})
+	v.now = func() time.Time { return now }
+	return v
+}
+
+func validClaims(now time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"iss":   "https://issuer.test",
+		"sub":   "alice",
+		"aud":   []string{"ping", "other"},
+		"exp":   now.Add(time.Hour).Unix(),
+		"nbf":   now.Add(-time.Minute).Unix(),
+		"scope": "read",
+	}
+}
+
+func TestVerifyValidToken(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	for _, alg := range []string{"RS256", "RS512", "PS256"} {
+		t.Run(alg, func(t *testing.T) {
+			token := signToken(t, alg, "rsa", testRSAKey, validClaims(now))
+			claims, err := testVerifier(now).Verify(context.Background(), token)
+			if err != nil {
+				t.Fatalf("Verify returned error: %v", err)
+			}
+			if claims.Subject != "alice" || !claims.Audience.Contains("ping") {
+				t.Errorf("Unexpected claims %+v", claims)
+			}
+			if claims.Raw["scope"] != "read" {
+				t.Errorf("Expected custom claim in Raw, got %v", claims.Raw["scope"])
+			}
+			if !claims.ExpiresAt.Equal(now.Add(time.Hour)) {
+				t.Errorf("Unexpected expiry %s", claims.ExpiresAt)
+			}
+		})
+	}
+}
+
+func TestVerifyECDSA(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	v := NewVerifier(VerifierConfig{Keys: StaticKeys{"ec": &ecKey.PublicKey}})
+	v.now = func() time.Time { return now }
+
+	if _, err := v.Verify(context.Background(), signToken(t, "ES256", "ec", ecKey, validClaims(now))); err != nil {
+		t.Errorf("Verify returned error: %v", err)
+	}
+}
+
+func TestVerifyRejectsMismatchedCurve(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	v := NewVerifier(VerifierConfig{Keys: StaticKeys{"ec": &ecKey.PublicKey}})
+	v.now = func() time.Time { return now }
+
+	if _, err := v.Verify(context.Background(), signToken(t, "ES256", "ec", ecKey, validClaims(now))); !errors.Is(err, ErrUnsupportedAlgorithm) {
+		t.Errorf("Expected a P-384 key to be refused for ES256, got %v", err)
+	}
+}
+
+func TestVerifyRejectsWeakRSAKey(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	weakKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Skipf("cannot generate a 1024-bit key: %v", err)
+	}
+	v := NewVerifier(VerifierConfig{Keys: StaticKeys{"rsa": &weakKey.PublicKey}})
+	v.now = func() time.Time { return now }
+
+	if _, err := v.Verify(context.Background(), signToken(t, "RS256", "rsa", weakKey, validClaims(now))); !errors.Is(err, ErrWeakKey) {
+		t.Errorf("Expected a 1024-bit key to be refused, got %v", err)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	with := func(key, value string) map[string]interface{} {
+		c := validClaims(now)
+		c[key] = value
+		return c
+	}
+	expired := validClaims(now)
+	expired["exp"] = now.Add(-2 * time.Minute).Unix()
+	future := validClaims(now)
+	future["nbf"] = now.Add(2 * time.Minute).Unix()
+	noExpiry := validClaims(now)
+	delete(noExpiry, "exp")
+
+	tests := map[string]struct {
+		token string
+		want  error
+	}{
+		"expired":       {signToken(t, "RS256", "rsa", testRSAKey, expired), ErrTokenExpired},
+		"not yet valid": {signToken(t, "RS256", "rsa", testRSAKey, future), ErrTokenNotYetValid},
+		"no expiry":     {signToken(t, "RS256", "rsa", testRSAKey, noExpiry), ErrMissingExpiry},
+		"issuer":        {signToken(t, "RS256", "rsa", testRSAKey, with("iss", "https://evil.test")), ErrInvalidIssuer},
+		"audience":      {signToken(t, "RS256", "rsa", testRSAKey, with("aud", "someone-else")), ErrInvalidAudience},
+		"wrong key":     {signToken(t, "RS256", "rsa", otherKey, validClaims(now)), ErrInvalidSignature},
+		"unknown kid":   {signToken(t, "RS256", "nope", testRSAKey, validClaims(now)), ErrUnknownKey},
+		"malformed":     {"not.a-token", ErrMalformedToken},
+		"alg none":      {"eyJhbGciOiJub25lIn0.e30.", ErrUnsupportedAlgorithm},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			claims, err := testVerifier(now).Verify(context.Background(), tt.token)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+			if claims != nil {
+				t.Errorf("Expected no claims with an error, got %+v", claims)
+			}
+		})
+	}
+}
+
+func TestVerifyLeeway(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	claims := validClaims(now)
+	claims["exp"] = now.Add(-30 * time.Second).Unix()
+
+	if _, err := testVerifier(now).Verify(context.Background(), signToken(t, "RS256", "rsa", testRSAKey, claims)); err != nil {
+		t.Errorf("Expiry within leeway should pass, got %v", err)
+	}
+}
+
+func TestClaimsContext(t *testing.T) {
+	if ClaimsFromContext(context.Background()) != nil {
+		t.Error("Expected nil claims on empty context")
+	}
+	ctx := WithClaims(context.Background(), &Claims{Subject: "alice"})
+	if got := ClaimsFromContext(ctx); got == nil || got.Subject != "alice" {
+		t.Errorf("Unexpected claims %+v", got)
+	}
+}
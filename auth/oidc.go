@@ -0,0 +1,369 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cookie names used by the OIDC flow.
+const (
+	SessionCookieName = "ping_session"
+	stateCookieName   = "ping_oidc_state"
+)
+
+// OIDCConfig configures the authorization-code login flow.
+type OIDCConfig struct {
+	// IssuerURL is the provider's issuer; discovery is read from
+	// IssuerURL/.well-known/openid-configuration.
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is this service's callback, registered with the provider.
+	RedirectURL string
+	// Scopes requested at login. Defaults to openid, profile, email.
+	Scopes []string
+	// GroupsClaim names the ID token claim listing the user's groups.
+	// Defaults to "groups".
+	GroupsClaim string
+	// CookieSecret signs session and state cookies; at least 32 bytes.
+	CookieSecret []byte
+	// SessionTTL is how long a login lasts. Defaults to 8 hours.
+	SessionTTL time.Duration
+	// Client talks to the provider. Nil uses a client with a 10s timeout.
+	Client *http.Client
+}
+
+// OIDC runs the OpenID Connect authorization-code flow and issues signed
+// session cookies. Provider metadata is discovered on first use, so the
+// service starts even while the provider is unreachable.
+type OIDC struct {
+	cfg     OIDCConfig
+	state   signer
+	session signer
+	secure  bool
+	now     func() time.Time
+
+	mu       sync.Mutex
+	provider *providerMetadata
+	verifier *Verifier
+}
+
+type providerMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+	EndSessionEndpoint    string `json:"end_session_endpoint"`
+}
+
+// loginState travels through the provider in a signed cookie to tie the
+// callback to the browser that started the login.
+type loginState struct {
+	State    string    `json:"state"`
+	Nonce    string    `json:"nonce"`
+	ReturnTo string    `json:"return_to"`
+	Expires  time.Time `json:"exp"`
+}
+
+// NewOIDC returns an OIDC flow for cfg.
+func NewOIDC(cfg OIDCConfig) (*OIDC, error) {
+	if cfg.IssuerURL == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return nil, errors.New("oidc: issuer URL, client ID and redirect URL are required")
+	}
+	if len(cfg.CookieSecret) < 32 {
+		return nil, errors.New("oidc: cookie secret must be at least 32 bytes")
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "profile", "email"}
+	}
+	if cfg.GroupsClaim == "" {
+		cfg.GroupsClaim = "groups"
+	}
+	if cfg.SessionTTL <= 0 {
+		cfg.SessionTTL = 8 * time.Hour
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &OIDC{
+		cfg:     cfg,
+		state:   newSigner(cfg.CookieSecret, "login state"),
+		session: newSigner(cfg.CookieSecret, "session"),
+		secure:  strings.HasPrefix(cfg.RedirectURL, "https://"),
+		now:     time.Now,
+	}, nil
+}
+
+// discover fetches provider metadata once and caches it; failures are
+// retried on the next call.
+func (o *OIDC) discover(ctx context.Context) (*providerMetadata, *Verifier, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.provider != nil {
+		return o.provider, o.verifier, nil
+	}
+
+	wellKnown := strings.TrimSuffix(o.cfg.IssuerURL, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wellKnown, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := o.cfg.Client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("oidc discovery: unexpected status %d", resp.StatusCode)
+	}
+	var meta providerMetadata
+	if err := json.NewDecoder(resp.Body).Decode(&meta); err != nil {
+		return nil, nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, nil, errors.New("oidc discovery: incomplete provider metadata")
+	}
+
+	o.provider = &meta
+	o.verifier = NewVerifier(VerifierConfig{
+		Keys:     NewJWKS(JWKSConfig{URL: meta.JWKSURI, Client: o.cfg.Client}),
+		Issuer:   meta.Issuer,
+		Audience: o.cfg.ClientID,
+		Leeway:   time.Minute,
+	})
+	return o.provider, o.verifier, nil
+}
+
+// LoginHandler redirects the browser to the provider. The optional
+// return_to query parameter (a local path) is restored after login.
+func (o *OIDC) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	provider, _, err := o.discover(r.Context())
+	if err != nil {
+		http.Error(w, "identity provider unavailable", http.StatusBadGateway)
+		return
+	}
+
+	st := loginState{
+		State:    randomString(),
+		Nonce:    randomString(),
+		ReturnTo: localPath(r.URL.Query().Get("return_to")),
+		Expires:  o.now().Add(10 * time.Minute),
+	}
+	value, err := o.state.encode(st)
+	if err != nil {
+		http.Error(w, "login failed", http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, o.cookie(stateCookieName, value, 10*time.Minute))
+
+	q := url.Values{
+		"response_type": {"code"},
+		"client_id":     {o.cfg.ClientID},
+		"redirect_uri":  {o.cfg.RedirectURL},
+		"scope":         {strings.Join(o.cfg.Scopes, " ")},
+		"state":         {st.State},
+		"nonce":         {st.Nonce},
+	}
+	sep := "?"
+	if strings.Contains(provider.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	http.Redirect(w, r, provider.AuthorizationEndpoint+sep+q.Encode(), http.StatusFound)
+}
+
+// CallbackHandler completes the login: it checks the state, exchanges the
+// code, verifies the ID token and sets the session cookie.
+func (o *OIDC) CallbackHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var st loginState
+	c, err := r.Cookie(stateCookieName)
+	if err != nil || o.state.decode(c.Value, &st) != nil || o.now().After(st.Expires) ||
+		r.URL.Query().Get("state") != st.State {
+		http.Error(w, "invalid login state", http.StatusBadRequest)
+		return
+	}
+	// The state is single use
+	http.SetCookie(w, o.cookie(stateCookieName, "", -1))
+
+	if msg := r.URL.Query().Get("error"); msg != "" {
+		http.Error(w, "login failed: "+msg, http.StatusUnauthorized)
+		return
+	}
+
+	provider, verifier, err := o.discover(ctx)
+	if err != nil {
+		http.Error(w, "identity provider unavailable", http.StatusBadGateway)
+		return
+	}
+	rawIDToken, err := o.exchange(ctx, provider.TokenEndpoint, r.URL.Query().Get("code"))
+	if err != nil {
+		http.Error(w, "code exchange failed", http.StatusBadGateway)
+		return
+	}
+	claims, err := verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		http.Error(w, "invalid id token", http.StatusUnauthorized)
+		return
+	}
+	if nonce, _ := claims.Raw["nonce"].(string); nonce != st.Nonce || claims.Subject == "" {
+		http.Error(w, "invalid id token", http.StatusUnauthorized)
+		return
+	}
+
+	session := &Session{
+		Subject:   claims.Subject,
+		Groups:    stringList(claims.Raw[o.cfg.GroupsClaim]),
+		ExpiresAt: o.now().Add(o.cfg.SessionTTL),
+	}
+	session.Email, _ = claims.Raw["email"].(string)
+	session.Name, _ = claims.Raw["name"].(string)
+	cookie, err := o.SessionCookie(session)
+	if err != nil {
+		http.Error(w, "login failed", http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, cookie)
+
+	returnTo := st.ReturnTo
+	if returnTo == "" {
+		returnTo = "/"
+	}
+	http.Redirect(w, r, returnTo, http.StatusFound)
+}
+
+// LogoutHandler clears the session and, when the provider supports it,
+// ends the provider session too.
+func (o *OIDC) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, o.cookie(SessionCookieName, "", -1))
+	if provider, _, err := o.discover(r.Context()); err == nil && provider.EndSessionEndpoint != "" {
+		http.Redirect(w, r, provider.EndSessionEndpoint, http.StatusFound)
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// Session returns the signed-in user for r, or ErrInvalidSession. Sessions
+// without a subject are rejected.
+func (o *OIDC) Session(r *http.Request) (*Session, error) {
+	c, err := r.Cookie(SessionCookieName)
+	if err != nil {
+		return nil, ErrInvalidSession
+	}
+	var s Session
+	if err := o.session.decode(c.Value, &s); err != nil {
+		return nil, err
+	}
+	if s.Subject == "" || o.now().After(s.ExpiresAt) {
+		return nil, ErrInvalidSession
+	}
+	return &s, nil
+}
+
+// SessionCookie returns the signed cookie carrying s.
+func (o *OIDC) SessionCookie(s *Session) (*http.Cookie, error) {
+	value, err := o.session.encode(s)
+	if err != nil {
+		return nil, err
+	}
+	return o.cookie(SessionCookieName, value, s.ExpiresAt.Sub(o.now())), nil
+}
+
+// LoginURL is where to send a browser that needs to sign in before
+// visiting returnTo.
+func (o *OIDC) LoginURL(loginPath, returnTo string) string {
+	return loginPath + "?" + url.Values{"return_to": {returnTo}}.Encode()
+}
+
+func (o *OIDC) exchange(ctx context.Context, tokenEndpoint, code string) (string, error) {
+	if code == "" {
+		return "", errors.New("missing authorization code")
+	}
+	form := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {o.cfg.RedirectURL},
+		"client_id":    {o.cfg.ClientID},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(o.cfg.ClientID), url.QueryEscape(o.cfg.ClientSecret))
+
+	resp, err := o.cfg.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint returned %d", resp.StatusCode)
+	}
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return "", err
+	}
+	if tokens.IDToken == "" {
+		return "", errors.New("token response has no id_token")
+	}
+	return tokens.IDToken, nil
+}
+
+func (o *OIDC) cookie(name, value string, maxAge time.Duration) *http.Cookie {
+	c := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   o.secure,
+		// Lax lets the provider's top-level redirect carry the state cookie
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   int(maxAge.Seconds()),
+	}
+	if maxAge < 0 {
+		c.MaxAge = -1
+	}
+	return c
+}
+
+// localPath only allows same-site paths, preventing open redirects.
+func localPath(p string) string {
+	if !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") || strings.HasPrefix(p, "/\\") {
+		return ""
+	}
+	return p
+}
+
+// stringList reads a claim that may be a string or a list of strings.
+func stringList(v interface{}) []string {
+	switch val := v.(type) {
+	case string:
+		return []string{val}
+	case []interface{}:
+		out := make([]string, 0, len(val))
+		for _, item := range val {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func randomString() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
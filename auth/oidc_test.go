@@ -0,0 +1,225 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testCookieSecret = []byte("0123456789abcdef0123456789abcdef")
+
+// fakeProvider is a minimal OpenID provider issuing ID tokens signed with
+// testRSAKey. The nonce for the next token is taken from the last
+// authorization request.
+type fakeProvider struct {
+	t      *testing.T
+	srv    *httptest.Server
+	nonce  string
+	groups []string
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	p := &fakeProvider{t: t, groups: []string{"ops"}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.srv.URL,
+			"authorization_endpoint": p.srv.URL + "/authorize",
+			"token_endpoint":         p.srv.URL + "/token",
+			"jwks_uri":               p.srv.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{rsaJWK("k1", &testRSAKey.PublicKey)}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "ping" || pass != "secret" || r.FormValue("code") != "good-code" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		idToken := signToken(t, "RS256", "k1", testRSAKey, map[string]interface{}{
+			"iss":    p.srv.URL,
+			"aud":    "ping",
+			"sub":    "alice",
+			"email":  "alice@example.com",
+			"groups": p.groups,
+			"nonce":  p.nonce,
+			"exp":    time.Now().Add(time.Hour).Unix(),
+		})
+		json.NewEncoder(w).Encode(map[string]string{"id_token": idToken, "token_type": "Bearer"})
+	})
+	p.srv = httptest.NewServer(mux)
+	t.Cleanup(p.srv.Close)
+	return p
+}
+
+func newTestOIDC(t *testing.T, issuer string) *OIDC {
+	t.Helper()
+	o, err := NewOIDC(OIDCConfig{
+		IssuerURL:    issuer,
+		ClientID:     "ping",
+		ClientSecret: "secret",
+		RedirectURL:  "https://ping.example.com/auth/callback",
+		CookieSecret: testCookieSecret,
+	})
+	if err != nil {
+		t.Fatalf("NewOIDC: %v", err)
+	}
+	return o
+}
+
+// login runs the browser side of the flow and returns the callback response.
+func login(t *testing.T, o *OIDC, p *fakeProvider, code string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	o.LoginHandler(w, httptest.NewRequest("GET", "/auth/login?return_to=/debug/requests", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("Expected redirect to provider, got %d", w.Code)
+	}
+	authURL, _ := url.Parse(w.Header().Get("Location"))
+	if !strings.HasPrefix(authURL.String(), p.srv.URL+"/authorize") {
+		t.Fatalf("Unexpected authorization URL %s", authURL)
+	}
+	q := authURL.Query()
+	if q.Get("client_id") != "ping" || q.Get("response_type") != "code" || !strings.Contains(q.Get("scope"), "openid") {
+		t.Errorf("Unexpected authorization parameters %v", q)
+	}
+	p.nonce = q.Get("nonce")
+
+	callback := httptest.NewRequest("GET", "/auth/callback?code="+code+"&state="+q.Get("state"), nil)
+	for _, c := range w.Result().Cookies() {
+		callback.AddCookie(c)
+	}
+	w = httptest.NewRecorder()
+	o.CallbackHandler(w, callback)
+	return w
+}
+
+func TestOIDCLoginFlow(t *testing.T) {
+	p := newFakeProvider(t)
+	o := newTestOIDC(t, p.srv.URL)
+
+	w := login(t, o, p, "good-code")
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/debug/requests" {
+		t.Fatalf("Expected redirect back to /debug/requests, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+
+	req := httptest.NewRequest("GET", "/debug/requests", nil)
+	for _, c := range w.Result().Cookies() {
+		if c.Name == SessionCookieName && c.Value != "" {
+			if !c.HttpOnly || !c.Secure {
+				t.Error("Session cookie must be HttpOnly and Secure for https redirects")
+			}
+			req.AddCookie(c)
+		}
+	}
+	session, err := o.Session(req)
+	if err != nil {
+		t.Fatalf("Session returned error: %v", err)
+	}
+	if session.Subject != "alice" || session.Email != "alice@example.com" || !session.InGroup([]string{"ops"}) {
+		t.Errorf("Unexpected session %+v", session)
+	}
+}
+
+func TestOIDCCallbackRejectsBadCode(t *testing.T) {
+	p := newFakeProvider(t)
+	o := newTestOIDC(t, p.srv.URL)
+
+	if w := login(t, o, p, "stolen-code"); w.Code != http.StatusBadGateway {
+		t.Errorf("Expected 502 for failed code exchange, got %d", w.Code)
+	}
+}
+
+func TestOIDCCallbackRequiresState(t *testing.T) {
+	p := newFakeProvider(t)
+	o := newTestOIDC(t, p.srv.URL)
+
+	w := httptest.NewRecorder()
+	o.CallbackHandler(w, httptest.NewRequest("GET", "/auth/callback?code=good-code&state=forged", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without a state cookie, got %d", w.Code)
+	}
+}
+
+func TestOIDCSessionExpiry(t *testing.T) {
+	o := newTestOIDC(t, "https://issuer.test")
+	now := time.Unix(1700000000, 0)
+	o.now = func() time.Time { return now }
+
+	cookie, err := o.SessionCookie(&Session{Subject: "alice", ExpiresAt: now.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(cookie)
+	if _, err := o.Session(req); err != nil {
+		t.Fatalf("Expected valid session, got %v", err)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if _, err := o.Session(req); err != ErrInvalidSession {
+		t.Errorf("Expected expired session to be rejected, got %v", err)
+	}
+}
+
+func TestOIDCSessionRejectsReplayedStateCookie(t *testing.T) {
+	p := newFakeProvider(t)
+	o := newTestOIDC(t, p.srv.URL)
+	w := httptest.NewRecorder()
+	o.LoginHandler(w, httptest.NewRequest("GET", "/auth/login", nil))
+
+	req := httptest.NewRequest("GET", "/debug/requests", nil)
+	for _, c := range w.Result().Cookies() {
+		if c.Name == stateCookieName {
+			req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: c.Value})
+		}
+	}
+	if len(req.Cookies()) != 1 {
+		t.Fatal("Expected a login state cookie")
+	}
+	if _, err := o.Session(req); err != ErrInvalidSession {
+		t.Errorf("Expected the state cookie to be rejected as a session, got %v", err)
+	}
+}
+
+func TestOIDCSessionRequiresSubject(t *testing.T) {
+	o := newTestOIDC(t, "https://issuer.test")
+	cookie, err := o.SessionCookie(&Session{ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(cookie)
+	if _, err := o.Session(req); err != ErrInvalidSession {
+		t.Errorf("Expected a session without subject to be rejected, got %v", err)
+	}
+}
+
+func TestLocalPath(t *testing.T) {
+	tests := map[string]string{
+		"/debug/requests":   "/debug/requests",
+		"https://evil.test": "",
+		"//evil.test/path":  "",
+		"/\\evil.test":      "",
+		"relative/path":     "",
+	}
+	for in, want := range tests {
+		if got := localPath(in); got != want {
+			t.Errorf("localPath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestNewOIDCValidatesConfig(t *testing.T) {
+	if _, err := NewOIDC(OIDCConfig{IssuerURL: "https://i", ClientID: "c", RedirectURL: "https://r", CookieSecret: []byte("short")}); err == nil {
+		t.Error("Expected error for short cookie secret")
+	}
+	if _, err := NewOIDC(OIDCConfig{CookieSecret: testCookieSecret}); err == nil {
+		t.Error("Expected error for missing issuer")
+	}
+}
@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignerRoundTrip(t *testing.T) {
+	s := signer{key: []byte("0123456789abcdef0123456789abcdef")}
+	in := Session{Subject: "alice", Groups: []string{"ops"}, ExpiresAt: time.Unix(1700000000, 0).UTC()}
+
+	value, err := s.encode(in)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	var out Session
+	if err := s.decode(value, &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if out.Subject != "alice" || len(out.Groups) != 1 || !out.ExpiresAt.Equal(in.ExpiresAt) {
+		t.Errorf("Round trip mismatch: %+v", out)
+	}
+}
+
+func TestSignerRejectsTampering(t *testing.T) {
+	s := signer{key: []byte("0123456789abcdef0123456789abcdef")}
+	value, _ := s.encode(Session{Subject: "alice"})
+	forged, _ := signer{key: []byte("another key of thirty-two bytes!")}.encode(Session{Subject: "root"})
+
+	body, sig, _ := strings.Cut(value, ".")
+	tests := map[string]string{
+		"no signature":  body,
+		"bad signature": body + "." + sig[:len(sig)-2] + "AA",
+		"other key":     forged,
+		"garbage":       "!!!.???",
+	}
+	for name, v := range tests {
+		var out Session
+		if err := s.decode(v, &out); err != ErrInvalidSession {
+			t.Errorf("%s: expected ErrInvalidSession, got %v", name, err)
+		}
+	}
+}
+
+func TestSessionInGroup(t *testing.T) {
+	s := &Session{Groups: []string{"dev", "ops"}}
+	if !s.InGroup(nil) {
+		t.Error("Empty allow list should admit everyone")
+	}
+	if !s.InGroup([]string{"admins", "ops"}) {
+		t.Error("Expected membership via ops")
+	}
+	if s.InGroup([]string{"admins"}) {
+		t.Error("Unexpected membership")
+	}
+}
+
+func TestSignerPurposesDoNotVerifyEachOther(t *testing.T) {
+	state := newSigner(testCookieSecret, "login state")
+	session := newSigner(testCookieSecret, "session")
+	value, _ := state.encode(Session{Subject: "alice"})
+	var out Session
+	if err := session.decode(value, &out); err != ErrInvalidSession {
+		t.Errorf("Expected a state cookie to fail as a session, got %v", err)
+	}
+	if err := newSigner(testCookieSecret, "login state").decode(value, &out); err != nil {
+		t.Errorf("Expected the same purpose to verify, got %v", err)
+	}
+}
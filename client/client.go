@@ -0,0 +1,138 @@
+// Package client builds the *http.Client the service's outbound
+// integrations share: metric and trace exports, health probes, token key
+// fetches and file uploads. Its transport propagates the correlation ID,
+// trace context and baggage of the request context and records every
+// call in the api_call metrics, and every phase of a call is bounded.
+//
+// Requests are sent once unless a RetryPolicy or HedgePolicy says
+// otherwise: only the caller knows whether a destination is safe to call
+// twice.
+package client
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"ping/observability"
+)
+
+// Config tunes New. Zero fields take the defaults in brackets.
+type Config struct {
+	// Timeout bounds a whole call, reading the response body included
+	// [10s].
+	Timeout time.Duration
+	// DialTimeout bounds opening a connection [5s].
+	DialTimeout time.Duration
+	// TLSHandshakeTimeout bounds the TLS handshake [5s].
+	TLSHandshakeTimeout time.Duration
+	// ResponseHeaderTimeout bounds the wait for the response headers once
+	// the request is sent [Timeout].
+	ResponseHeaderTimeout time.Duration
+	// IdleConnTimeout closes pooled connections left idle this long [90s].
+	IdleConnTimeout time.Duration
+	// MaxIdleConnsPerHost is how many idle connections are kept per host
+	// [16].
+	MaxIdleConnsPerHost int
+	// Retry applies to every destination without a policy in
+	// HostRetries; the zero policy sends each request once.
+	Retry       RetryPolicy
+	HostRetries map[string]RetryPolicy
+	// RetryBudget, when set, caps the retries; share one across clients
+	// to cap them for the whole service.
+	RetryBudget *RetryBudget
+	// Hedge sends copies of calls that are slow to answer; the zero
+	// policy sends one at a time.
+	Hedge HedgePolicy
+	// LogLevel logs every call through Logger, see
+	// observability.TransportOptions; empty logs nothing.
+	LogLevel string
+	Logger   observability.Logger
+	// Clock times the calls for their metrics and logs; nil uses
+	// observability.DefaultClock.
+	Clock observability.Clock
+	// Metrics records the calls, retries and hedges; nil uses
+	// observability.GetMetrics().
+	Metrics *observability.Metrics
+	// Base replaces the network transport, e.g. in tests. The timeouts
+	// other than Timeout do not apply to it.
+	Base http.RoundTripper
+}
+
+func (c Config) withDefaults() Config {
+	if c.Timeout <= 0 {
+		c.Timeout = 10 * time.Second
+	}
+	if c.DialTimeout <= 0 {
+		c.DialTimeout = 5 * time.Second
+	}
+	if c.TLSHandshakeTimeout <= 0 {
+		c.TLSHandshakeTimeout = 5 * time.Second
+	}
+	if c.ResponseHeaderTimeout <= 0 {
+		c.ResponseHeaderTimeout = c.Timeout
+	}
+	if c.IdleConnTimeout <= 0 {
+		c.IdleConnTimeout = 90 * time.Second
+	}
+	if c.MaxIdleConnsPerHost <= 0 {
+		c.MaxIdleConnsPerHost = 16
+	}
+	if c.Metrics == nil {
+		c.Metrics = observability.GetMetrics()
+	}
+	return c
+}
+
+// New returns a client for cfg. Build its requests with
+// http.NewRequestWithContext so the context of the incoming request
+// reaches the transport. Timeout bounds all attempts of a call together.
+func New(cfg Config) *http.Client {
+	cfg = cfg.withDefaults()
+	return &http.Client{
+		Transport: NewTransport(cfg),
+		Timeout:   cfg.Timeout,
+	}
+}
+
+// NewTransport returns the instrumented transport of New, for callers that
+// build their own http.Client.
+func NewTransport(cfg Config) http.RoundTripper {
+	cfg = cfg.withDefaults()
+	base := cfg.Base
+	if base == nil {
+		dialer := &net.Dialer{Timeout: cfg.DialTimeout, KeepAlive: 30 * time.Second}
+		base = &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           dialer.DialContext,
+			ForceAttemptHTTP2:     true,
+			TLSHandshakeTimeout:   cfg.TLSHandshakeTimeout,
+			ResponseHeaderTimeout: cfg.ResponseHeaderTimeout,
+			IdleConnTimeout:       cfg.IdleConnTimeout,
+			MaxIdleConns:          100,
+			MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+			ExpectContinueTimeout: time.Second,
+		}
+	}
+	// Every copy and attempt is propagated and recorded on its own
+	var transport http.RoundTripper = observability.NewTransportWithOptions(base, observability.TransportOptions{
+		LogLevel: cfg.LogLevel,
+		Logger:   cfg.Logger,
+		Clock:    cfg.Clock,
+		Metrics:  cfg.Metrics,
+	})
+	if cfg.Hedge.Delay > 0 {
+		transport = &hedgeTransport{base: transport, policy: cfg.Hedge, metrics: cfg.Metrics}
+	}
+	if cfg.Retry.MaxAttempts <= 1 && len(cfg.HostRetries) == 0 {
+		return transport
+	}
+	return &retryTransport{
+		base:     transport,
+		policy:   cfg.Retry,
+		hosts:    cfg.HostRetries,
+		budget:   cfg.RetryBudget,
+		metrics:  cfg.Metrics,
+		sleepFor: sleep,
+	}
+}
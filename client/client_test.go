@@ -0,0 +1,94 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"ping/observability"
+)
+
+func TestClientPropagatesAndRecords(t *testing.T) {
+	metrics := observability.NewMetrics(observability.MetricsOptions{})
+
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get(observability.RequestIDHeader)
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+
+	c := New(Config{Metrics: metrics})
+	ctx := observability.WithCorrelationID(context.Background(), "outbound-id")
+	for _, path := range []string{"/ok", "/fail"} {
+		req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL+path, nil)
+		resp, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if got != "outbound-id" {
+		t.Errorf("Expected the correlation ID to be sent, got %q", got)
+	}
+	host := strings.TrimPrefix(srv.URL, "http://")
+	if n := testutil.ToFloat64(metrics.APICallCounter.WithLabelValues(host, "2xx")); n != 1 {
+		t.Errorf("Expected 1 successful API call recorded, got %v", n)
+	}
+	if n := testutil.ToFloat64(metrics.APICallErrorCounter.WithLabelValues(host)); n != 1 {
+		t.Errorf("Expected the 502 recorded as a failure, got %v", n)
+	}
+}
+
+func TestClientDoesNotRetry(t *testing.T) {
+	observability.InitMetrics()
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	resp, err := New(Config{}).Post(srv.URL, "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if hits.Load() != 1 {
+		t.Errorf("Expected one attempt, got %d", hits.Load())
+	}
+}
+
+func TestClientTimesOut(t *testing.T) {
+	observability.InitMetrics()
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	start := time.Now()
+	_, err := New(Config{Timeout: 50 * time.Millisecond}).Get(srv.URL)
+	if err == nil {
+		t.Fatal("Expected a timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Timeout took %s", elapsed)
+	}
+}
+
+func TestConfigDefaults(t *testing.T) {
+	cfg := Config{Timeout: 30 * time.Second}.withDefaults()
+	if cfg.ResponseHeaderTimeout != 30*time.Second || cfg.DialTimeout != 5*time.Second || cfg.MaxIdleConnsPerHost != 16 {
+		t.Errorf("Unexpected defaults %+v", cfg)
+	}
+}
@@ -0,0 +1,154 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"ping/observability"
+)
+
+// Outcomes of a hedge, used as the outcome label of api_call_hedges_total.
+const (
+	HedgeOutcomeSent = "sent"
+	HedgeOutcomeWon  = "won"
+)
+
+// HedgePolicy sends a copy of a call that has not answered within Delay
+// and uses whichever answer arrives first, trading a little extra load
+// for a shorter tail on destinations that stall now and then. The zero
+// policy never hedges.
+type HedgePolicy struct {
+	// Delay is how long an attempt runs before the next copy is sent.
+	// Zero disables hedging.
+	Delay time.Duration
+	// MaxHedges is how many copies may be sent besides the first attempt.
+	// Defaults to 1.
+	MaxHedges int
+	// Methods may be hedged. Nil means GET, HEAD and OPTIONS. Requests
+	// with a body are never hedged.
+	Methods []string
+}
+
+var hedgeableMethods = []string{http.MethodGet, http.MethodHead, http.MethodOptions}
+
+func (p HedgePolicy) allows(req *http.Request) bool {
+	if p.Delay <= 0 || (req.Body != nil && req.Body != http.NoBody) {
+		return false
+	}
+	methods := p.Methods
+	if methods == nil {
+		methods = hedgeableMethods
+	}
+	return slices.Contains(methods, req.Method)
+}
+
+func (p HedgePolicy) maxHedges() int {
+	if p.MaxHedges <= 0 {
+		return 1
+	}
+	return p.MaxHedges
+}
+
+// hedgeTransport races copies of slow calls.
+type hedgeTransport struct {
+	base    http.RoundTripper
+	policy  HedgePolicy
+	metrics *observability.Metrics
+}
+
+// hedgeResult is the outcome of one copy of a call, the first being 0.
+type hedgeResult struct {
+	index int
+	resp  *http.Response
+	err   error
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *hedgeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.policy.allows(req) {
+		return t.base.RoundTrip(req)
+	}
+	maxHedges := t.policy.maxHedges()
+	results := make(chan hedgeResult, maxHedges+1)
+	cancels := make([]context.CancelFunc, 0, maxHedges+1)
+	send := func() {
+		// Each copy gets its own context so the losers can be stopped
+		// without the winner
+		ctx, cancel := context.WithCancel(req.Context())
+		index := len(cancels)
+		cancels = append(cancels, cancel)
+		attempt := req.Clone(ctx)
+		go func() {
+			resp, err := t.base.RoundTrip(attempt)
+			results <- hedgeResult{index: index, resp: resp, err: err}
+		}()
+	}
+
+	metrics := t.metrics
+	send()
+	pending := 1
+	timer := time.NewTimer(t.policy.Delay)
+	defer timer.Stop()
+	for {
+		select {
+		case r := <-results:
+			pending--
+			if r.err != nil {
+				cancels[r.index]()
+				// An error only ends the call once no copy is left to answer
+				if pending == 0 {
+					return nil, r.err
+				}
+				continue
+			}
+			if r.index > 0 {
+				metrics.APICallHedges.WithLabelValues(HedgeOutcomeWon).Inc()
+			}
+			for i, cancel := range cancels {
+				if i != r.index {
+					cancel()
+				}
+			}
+			go discard(results, pending)
+			r.resp.Body = &cancelBody{ReadCloser: r.resp.Body, cancel: cancels[r.index]}
+			return r.resp, nil
+		case <-timer.C:
+			if len(cancels) <= maxHedges {
+				send()
+				pending++
+				metrics.APICallHedges.WithLabelValues(HedgeOutcomeSent).Inc()
+				timer.Reset(t.policy.Delay)
+			}
+		}
+	}
+}
+
+// Unwrap returns the wrapped RoundTripper.
+func (t *hedgeTransport) Unwrap() http.RoundTripper {
+	return t.base
+}
+
+// discard closes the answers of the pending copies that lost.
+func discard(results <-chan hedgeResult, pending int) {
+	for ; pending > 0; pending-- {
+		if r := <-results; r.err == nil {
+			r.resp.Body.Close()
+		}
+	}
+}
+
+// cancelBody releases the context of the winning copy once its body is
+// closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
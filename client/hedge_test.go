@@ -0,0 +1,107 @@
+package client
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"ping/observability"
+)
+
+// stallingServer leaves its first stalls requests hanging until the client
+// gives up on them, answers the others with their number, and counts the
+// requests it was sent.
+func stallingServer(t *testing.T, stalls int32) (*httptest.Server, *atomic.Int32) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := hits.Add(1)
+		if n <= stalls {
+			<-r.Context().Done()
+			return
+		}
+		io.WriteString(w, strings.Repeat("x", int(n)))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &hits
+}
+
+func TestHedgeAnswersFromTheFasterCopy(t *testing.T) {
+	m := observability.NewMetrics(observability.MetricsOptions{})
+
+	srv, hits := stallingServer(t, 1)
+	c := New(Config{Timeout: 5 * time.Second, Hedge: HedgePolicy{Delay: 20 * time.Millisecond}, Metrics: m})
+	resp, err := c.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "xx" || hits.Load() != 2 {
+		t.Errorf("Expected the hedge's answer, got %q after %d requests", body, hits.Load())
+	}
+	if got := testutil.ToFloat64(m.APICallHedges.WithLabelValues(HedgeOutcomeSent)); got != 1 {
+		t.Errorf("Expected 1 hedge sent, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.APICallHedges.WithLabelValues(HedgeOutcomeWon)); got != 1 {
+		t.Errorf("Expected 1 hedge won, got %v", got)
+	}
+}
+
+func TestHedgeNotSentForFastAnswers(t *testing.T) {
+	m := observability.NewMetrics(observability.MetricsOptions{})
+
+	srv, hits := stallingServer(t, 0)
+	c := New(Config{Hedge: HedgePolicy{Delay: time.Second}, Metrics: m})
+	resp, err := c.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if hits.Load() != 1 || testutil.ToFloat64(m.APICallHedges.WithLabelValues(HedgeOutcomeSent)) != 0 {
+		t.Errorf("Expected a single request, got %d", hits.Load())
+	}
+}
+
+func TestHedgeSendsUpToMaxHedges(t *testing.T) {
+	observability.InitMetrics()
+	srv, hits := stallingServer(t, 2)
+	c := New(Config{Timeout: 5 * time.Second, Hedge: HedgePolicy{Delay: 10 * time.Millisecond, MaxHedges: 2}})
+	resp, err := c.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "xxx" || hits.Load() != 3 {
+		t.Errorf("Expected the second hedge's answer, got %q after %d requests", body, hits.Load())
+	}
+}
+
+func TestHedgeLeavesPostsAlone(t *testing.T) {
+	observability.InitMetrics()
+	srv, hits := stallingServer(t, 0)
+	c := New(Config{Hedge: HedgePolicy{Delay: time.Nanosecond}})
+	resp, err := c.Post(srv.URL, "text/plain", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if hits.Load() != 1 {
+		t.Errorf("Expected one POST, got %d", hits.Load())
+	}
+}
+
+func TestHedgeReturnsTheLastError(t *testing.T) {
+	observability.InitMetrics()
+	c := New(Config{Timeout: 5 * time.Second, Hedge: HedgePolicy{Delay: time.Millisecond}})
+	// Nothing listens on port 1
+	if _, err := c.Get("http://127.0.0.1:1/"); err == nil {
+		t.Error("Expected the copies' error")
+	}
+}
@@ -0,0 +1,250 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ping/observability"
+)
+
+// Outcomes of a failed call, used as the outcome label of
+// api_call_retries_total.
+const (
+	RetryOutcomeRetried         = "retried"
+	RetryOutcomeBudgetExhausted = "budget_exhausted"
+)
+
+// RetryPolicy decides which failed calls are sent again and when. The zero
+// policy never retries.
+type RetryPolicy struct {
+	// MaxAttempts is how many times a call is sent at most. Zero or one
+	// disables retries.
+	MaxAttempts int
+	// Backoff is the delay before the second attempt; it doubles after
+	// every further failure. Defaults to 100ms.
+	Backoff time.Duration
+	// MaxBackoff caps the delay, a Retry-After answer included. Defaults
+	// to 5s.
+	MaxBackoff time.Duration
+	// Jitter is the fraction of each delay, from 0 to 1, taken off at
+	// random so calls that failed together do not retry together.
+	Jitter float64
+	// Methods may be retried. Nil means the idempotent ones: GET, HEAD,
+	// OPTIONS, TRACE, PUT and DELETE.
+	Methods []string
+	// Statuses are the answers worth another attempt, besides transport
+	// errors. Nil means 429, 502, 503 and 504.
+	Statuses []int
+}
+
+var (
+	idempotentMethods = []string{http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete}
+	retryableStatuses = []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+)
+
+// Delay returns how long to wait before the attempt after the given one,
+// counting attempts from one.
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	delay, maxBackoff := p.backoffs()
+	for i := 1; i < attempt && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	if p.Jitter > 0 {
+		delay -= time.Duration(rand.Float64() * p.Jitter * float64(delay))
+	}
+	return delay
+}
+
+func (p RetryPolicy) backoffs() (time.Duration, time.Duration) {
+	backoff, maxBackoff := p.Backoff, p.MaxBackoff
+	if backoff <= 0 {
+		backoff = 100 * time.Millisecond
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = 5 * time.Second
+	}
+	return backoff, maxBackoff
+}
+
+func (p RetryPolicy) allows(method string) bool {
+	methods := p.Methods
+	if methods == nil {
+		methods = idempotentMethods
+	}
+	return slices.Contains(methods, method)
+}
+
+// retryable reports whether the outcome of an attempt is worth another.
+func (p RetryPolicy) retryable(ctx context.Context, resp *http.Response, err error) bool {
+	if err != nil {
+		// The caller gave up; a new attempt would fail the same way
+		return ctx.Err() == nil
+	}
+	statuses := p.Statuses
+	if statuses == nil {
+		statuses = retryableStatuses
+	}
+	return slices.Contains(statuses, resp.StatusCode)
+}
+
+// RetryBudget caps retries to a share of the calls made, across every
+// client it is given to, so retries cannot multiply the load on a
+// dependency that is already failing. Every first attempt adds Ratio of
+// a token, every retry takes a whole one, and the balance is capped at
+// Burst, which is also where it starts so that quiet periods still allow
+// a few retries.
+type RetryBudget struct {
+	ratio float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+}
+
+// NewRetryBudget returns a budget allowing about ratio retries per call,
+// e.g. 0.2, with up to burst retries saved up.
+func NewRetryBudget(ratio float64, burst int) *RetryBudget {
+	return &RetryBudget{ratio: ratio, burst: float64(burst), tokens: float64(burst)}
+}
+
+func (b *RetryBudget) deposit() {
+	b.mu.Lock()
+	b.tokens = min(b.tokens+b.ratio, b.burst)
+	b.mu.Unlock()
+}
+
+func (b *RetryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// retryTransport sends failed calls again as the policy of their host says.
+type retryTransport struct {
+	base     http.RoundTripper
+	policy   RetryPolicy
+	hosts    map[string]RetryPolicy
+	budget   *RetryBudget
+	metrics  *observability.Metrics
+	sleepFor func(ctx context.Context, d time.Duration) bool
+}
+
+// policyFor returns the policy of a request's host, matched with its port
+// first and then without.
+func (t *retryTransport) policyFor(req *http.Request) RetryPolicy {
+	if p, ok := t.hosts[req.URL.Host]; ok {
+		return p
+	}
+	if p, ok := t.hosts[req.URL.Hostname()]; ok {
+		return p
+	}
+	return t.policy
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.budget != nil {
+		t.budget.deposit()
+	}
+	policy := t.policyFor(req)
+	// A body can only be sent again if it can be read again
+	if policy.MaxAttempts <= 1 || !policy.allows(req.Method) || (req.Body != nil && req.Body != http.NoBody && req.GetBody == nil) {
+		return t.base.RoundTrip(req)
+	}
+
+	ctx := req.Context()
+	metrics := t.metrics
+	for attempt := 1; ; attempt++ {
+		resp, err := t.base.RoundTrip(req)
+		if attempt >= policy.MaxAttempts || !policy.retryable(ctx, resp, err) {
+			return resp, err
+		}
+		if t.budget != nil && !t.budget.withdraw() {
+			metrics.APICallRetries.WithLabelValues(RetryOutcomeBudgetExhausted).Inc()
+			return resp, err
+		}
+		delay := policy.Delay(attempt)
+		if after := retryAfter(resp); after > delay {
+			_, maxBackoff := policy.backoffs()
+			delay = min(after, maxBackoff)
+		}
+		if !t.sleepFor(ctx, delay) {
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+		}
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(ctx)
+			req.Body = body
+		}
+		metrics.APICallRetries.WithLabelValues(RetryOutcomeRetried).Inc()
+	}
+}
+
+// Unwrap returns the wrapped RoundTripper.
+func (t *retryTransport) Unwrap() http.RoundTripper {
+	return t.base
+}
+
+// retryAfter reads a Retry-After answer given in seconds.
+func retryAfter(resp *http.Response) time.Duration {
+	if resp == nil {
+		return 0
+	}
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// sleep waits for d, returning false if ctx ends first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// ParseHostRetries builds per-destination policies from "host=attempts"
+// entries, e.g. "collector.internal:4318=5", each a copy of base with its
+// own MaxAttempts. A host without a port matches every port.
+func ParseHostRetries(entries []string, base RetryPolicy) (map[string]RetryPolicy, error) {
+	hosts := make(map[string]RetryPolicy, len(entries))
+	for _, entry := range entries {
+		host, value, ok := strings.Cut(entry, "=")
+		attempts, err := strconv.Atoi(value)
+		if !ok || host == "" || err != nil || attempts < 1 {
+			return nil, fmt.Errorf("retry policy must look like host=attempts with attempts of at least 1, got %q", entry)
+		}
+		policy := base
+		policy.MaxAttempts = attempts
+		hosts[host] = policy
+	}
+	return hosts, nil
+}
@@ -0,0 +1,191 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"ping/observability"
+)
+
+// flakyServer answers status to the first failures requests and 200 after,
+// recording the bodies it was sent.
+func flakyServer(t *testing.T, failures int32, status int) (*httptest.Server, *atomic.Int32, *[]string) {
+	var hits atomic.Int32
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if hits.Add(1) <= failures {
+			w.Header().Set("Retry-After", "2")
+			w.WriteHeader(status)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &hits, &bodies
+}
+
+// noSleep records the delays of a retryTransport instead of waiting.
+func noSleep(delays *[]time.Duration) func(context.Context, time.Duration) bool {
+	return func(ctx context.Context, d time.Duration) bool {
+		*delays = append(*delays, d)
+		return true
+	}
+}
+
+func TestRetryTransportRetriesIdempotentCalls(t *testing.T) {
+	m := observability.NewMetrics(observability.MetricsOptions{})
+
+	srv, hits, _ := flakyServer(t, 2, http.StatusServiceUnavailable)
+	var delays []time.Duration
+	c := &http.Client{Transport: &retryTransport{
+		base:     NewTransport(Config{Metrics: m}),
+		policy:   RetryPolicy{MaxAttempts: 3, Backoff: time.Second, MaxBackoff: 10 * time.Second},
+		metrics:  m,
+		sleepFor: noSleep(&delays),
+	}}
+	resp, err := c.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || hits.Load() != 3 {
+		t.Errorf("Expected success on the third attempt, got %d after %d", resp.StatusCode, hits.Load())
+	}
+	// Retry-After: 2 outweighs the shorter first backoff
+	if len(delays) != 2 || delays[0] != 2*time.Second || delays[1] != 2*time.Second {
+		t.Errorf("Unexpected delays %v", delays)
+	}
+	if got := testutil.ToFloat64(m.APICallRetries.WithLabelValues(RetryOutcomeRetried)); got != 2 {
+		t.Errorf("Expected 2 retries recorded, got %v", got)
+	}
+	host := strings.TrimPrefix(srv.URL, "http://")
+	if got := testutil.ToFloat64(m.APICallCounter.WithLabelValues(host, "5xx")) + testutil.ToFloat64(m.APICallCounter.WithLabelValues(host, "2xx")); got != 3 {
+		t.Errorf("Expected every attempt recorded as a call, got %v", got)
+	}
+}
+
+func TestRetryTransportLeavesPostsAloneByDefault(t *testing.T) {
+	observability.InitMetrics()
+	srv, hits, bodies := flakyServer(t, 1, http.StatusBadGateway)
+	var delays []time.Duration
+	transport := &retryTransport{
+		base:     NewTransport(Config{}),
+		policy:   RetryPolicy{MaxAttempts: 3},
+		metrics:  observability.GetMetrics(),
+		sleepFor: noSleep(&delays),
+	}
+	resp, err := (&http.Client{Transport: transport}).Post(srv.URL, "text/plain", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway || hits.Load() != 1 {
+		t.Errorf("Expected one attempt at a POST, got %d", hits.Load())
+	}
+
+	transport.policy.Methods = []string{http.MethodPost}
+	resp, err = (&http.Client{Transport: transport}).Post(srv.URL, "text/plain", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if hits.Load() != 2 || strings.Join(*bodies, ",") != "payload,payload" {
+		t.Errorf("Expected the body on the allowed POST, got %q", *bodies)
+	}
+}
+
+func TestRetryTransportHostPolicies(t *testing.T) {
+	observability.InitMetrics()
+	srv, hits, _ := flakyServer(t, 1, http.StatusServiceUnavailable)
+	u, _ := url.Parse(srv.URL)
+	hosts, err := ParseHostRetries([]string{u.Hostname() + "=2"}, RetryPolicy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := New(Config{HostRetries: hosts})
+	c.Transport.(*retryTransport).sleepFor = noSleep(new([]time.Duration))
+	resp, err := c.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || hits.Load() != 2 {
+		t.Errorf("Expected the host's two attempts, got %d", hits.Load())
+	}
+}
+
+func TestRetryBudgetCapsRetries(t *testing.T) {
+	m := observability.NewMetrics(observability.MetricsOptions{})
+
+	srv, hits, _ := flakyServer(t, 100, http.StatusServiceUnavailable)
+	c := &http.Client{Transport: &retryTransport{
+		base:     NewTransport(Config{Metrics: m}),
+		policy:   RetryPolicy{MaxAttempts: 5},
+		budget:   NewRetryBudget(0.1, 2),
+		metrics:  m,
+		sleepFor: noSleep(new([]time.Duration)),
+	}}
+	for i := 0; i < 3; i++ {
+		resp, err := c.Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	// The first call spends the two saved-up retries; the 0.2 tokens earned
+	// since do not pay for another, so each call ends with a refusal
+	if hits.Load() != 5 {
+		t.Errorf("Expected 3 calls and 2 retries, got %d attempts", hits.Load())
+	}
+	if got := testutil.ToFloat64(m.APICallRetries.WithLabelValues(RetryOutcomeBudgetExhausted)); got != 3 {
+		t.Errorf("Expected 3 retries refused, got %v", got)
+	}
+}
+
+func TestRetryTransportStopsWithContext(t *testing.T) {
+	observability.InitMetrics()
+	srv, hits, _ := flakyServer(t, 100, http.StatusServiceUnavailable)
+	c := New(Config{Retry: RetryPolicy{MaxAttempts: 5, Backoff: time.Hour}})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL, nil)
+	resp, err := c.Do(req)
+	if err == nil {
+		resp.Body.Close()
+	}
+	if hits.Load() != 1 {
+		t.Errorf("Expected no attempt after the context ended, got %d", hits.Load())
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for attempt, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 4: 800 * time.Millisecond, 5: time.Second} {
+		if got := p.Delay(attempt); got != want {
+			t.Errorf("Delay(%d) = %s, want %s", attempt, got, want)
+		}
+	}
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d := p.Delay(1); d < 50*time.Millisecond || d > 100*time.Millisecond {
+			t.Fatalf("Jittered delay %s out of range", d)
+		}
+	}
+}
+
+func TestParseHostRetriesRejectsBadEntries(t *testing.T) {
+	for _, entry := range []string{"collector", "=3", "collector=0", "collector=many"} {
+		if _, err := ParseHostRetries([]string{entry}, RetryPolicy{}); err == nil {
+			t.Errorf("Expected an error for %q", entry)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Units of the benchmark measurements compared.
+const (
+	unitTime   = "ns/op"
+	unitBytes  = "B/op"
+	unitAllocs = "allocs/op"
+)
+
+var units = []string{unitTime, unitBytes, unitAllocs}
+
+// results maps "package.BenchmarkName" to the median of each unit over
+// the runs of the benchmark.
+type results map[string]map[string]float64
+
+// parse reads the output of go test -bench, with -benchmem for the
+// memory units. Names are qualified by the package of the preceding
+// "pkg:" line and lose their -GOMAXPROCS suffix, so results from machines
+// with different CPU counts compare. Repeated runs (-count) are reduced to
+// their median.
+func parse(r io.Reader) (results, error) {
+	samples := make(map[string]map[string][]float64)
+	pkg := ""
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if p, ok := strings.CutPrefix(line, "pkg: "); ok {
+			pkg = p
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 4 || !strings.HasPrefix(fields[0], "Benchmark") {
+			continue
+		}
+		// fields: name, iterations, then value/unit pairs
+		if _, err := strconv.Atoi(fields[1]); err != nil {
+			continue
+		}
+		name := trimProcs(fields[0])
+		if pkg != "" {
+			name = pkg + "." + name
+		}
+		for i := 2; i+1 < len(fields); i += 2 {
+			value, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid %s value %q", name, fields[i+1], fields[i])
+			}
+			if samples[name] == nil {
+				samples[name] = make(map[string][]float64)
+			}
+			samples[name][fields[i+1]] = append(samples[name][fields[i+1]], value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	res := make(results, len(samples))
+	for name, byUnit := range samples {
+		res[name] = make(map[string]float64, len(byUnit))
+		for unit, values := range byUnit {
+			res[name][unit] = median(values)
+		}
+	}
+	return res, nil
+}
+
+// trimProcs drops the -N suffix go test adds to names when GOMAXPROCS is
+// not 1.
+func trimProcs(name string) string {
+	i := strings.LastIndexByte(name, '-')
+	if i < 0 {
+		return name
+	}
+	if _, err := strconv.Atoi(name[i+1:]); err != nil {
+		return name
+	}
+	return name[:i]
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// change is the difference in one unit of one benchmark.
+type change struct {
+	Name      string
+	Unit      string
+	Old, New  float64
+	Delta     float64 // relative, +0.1 is 10% worse
+	Regressed bool
+}
+
+// compare lists the changes from base to cur of the benchmarks in both.
+// Time and bytes regress when they grow by more than threshold, a
+// fraction; allocations regress when they grow by one or more, since
+// their count does not vary between runs.
+func compare(base, cur results, threshold float64) []change {
+	var changes []change
+	for name, now := range cur {
+		before, ok := base[name]
+		if !ok {
+			continue
+		}
+		for _, unit := range units {
+			o, okOld := before[unit]
+			n, okNew := now[unit]
+			if !okOld || !okNew {
+				continue
+			}
+			c := change{Name: name, Unit: unit, Old: o, New: n, Delta: relative(o, n)}
+			if unit == unitAllocs {
+				c.Regressed = n-o >= 1
+			} else {
+				c.Regressed = c.Delta > threshold
+			}
+			changes = append(changes, c)
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Name != changes[j].Name {
+			return changes[i].Name < changes[j].Name
+		}
+		return unitOrder(changes[i].Unit) < unitOrder(changes[j].Unit)
+	})
+	return changes
+}
+
+func relative(old, cur float64) float64 {
+	if old == 0 {
+		if cur == 0 {
+			return 0
+		}
+		return 1
+	}
+	return (cur - old) / old
+}
+
+func unitOrder(unit string) int {
+	for i, u := range units {
+		if u == unit {
+			return i
+		}
+	}
+	return len(units)
+}
+
+// missing returns the benchmarks of a that b lacks, sorted.
+func missing(a, b results) []string {
+	var names []string
+	for name := range a {
+		if _, ok := b[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// write prints changes as a table, flagging regressions, and the
+// benchmarks only one side has.
+func write(w io.Writer, changes []change, added, removed []string) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "benchmark\tunit\tbaseline\tcurrent\tdelta\t")
+	for _, c := range changes {
+		flag := ""
+		if c.Regressed {
+			flag = "REGRESSION"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%+.1f%%\t%s\n", c.Name, c.Unit, formatValue(c.Old), formatValue(c.New), c.Delta*100, flag)
+	}
+	tw.Flush()
+	for _, name := range added {
+		fmt.Fprintf(w, "new, not in baseline: %s\n", name)
+	}
+	for _, name := range removed {
+		fmt.Fprintf(w, "in baseline, not run: %s\n", name)
+	}
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
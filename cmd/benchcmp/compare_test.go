@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const baselineOutput = `goos: linux
+goarch: amd64
+pkg: ping/handlers
+cpu: Example CPU
+BenchmarkPongHandler-8   	 4000000	       300 ns/op	      72 B/op	       4 allocs/op
+BenchmarkPongHandler-8   	 4000000	       310 ns/op	      72 B/op	       4 allocs/op
+BenchmarkPongHandler-8   	 4000000	       900 ns/op	      72 B/op	       4 allocs/op
+BenchmarkRetired-8       	 1000000	      1000 ns/op
+PASS
+ok  	ping/handlers	3.2s
+pkg: ping/observability
+BenchmarkRecordRequest-8 	50000000	        30 ns/op	       0 B/op	       0 allocs/op
+`
+
+func TestParseTakesMedians(t *testing.T) {
+	res, err := parse(strings.NewReader(baselineOutput))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pong := res["ping/handlers.BenchmarkPongHandler"]
+	if pong[unitTime] != 310 || pong[unitBytes] != 72 || pong[unitAllocs] != 4 {
+		t.Errorf("Expected the median run, got %v", pong)
+	}
+	if _, ok := res["ping/observability.BenchmarkRecordRequest"]; !ok {
+		t.Errorf("Expected names qualified by package, got %v", res)
+	}
+	if len(res) != 3 {
+		t.Errorf("Expected 3 benchmarks, got %d", len(res))
+	}
+}
+
+func TestTrimProcs(t *testing.T) {
+	for name, want := range map[string]string{
+		"BenchmarkPong-8":        "BenchmarkPong",
+		"BenchmarkPong":          "BenchmarkPong",
+		"BenchmarkSizes/size-1k": "BenchmarkSizes/size-1k",
+	} {
+		if got := trimProcs(name); got != want {
+			t.Errorf("trimProcs(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestCompareFlagsRegressions(t *testing.T) {
+	base, _ := parse(strings.NewReader(baselineOutput))
+	cur, _ := parse(strings.NewReader(`pkg: ping/handlers
+BenchmarkPongHandler-4   	 4000000	       330 ns/op	      96 B/op	       5 allocs/op
+BenchmarkAdded-4         	 4000000	       100 ns/op
+pkg: ping/observability
+BenchmarkRecordRequest-4 	50000000	        40 ns/op	       0 B/op	       0 allocs/op
+`))
+
+	regressed := make(map[string]bool)
+	for _, c := range compare(base, cur, 0.10) {
+		regressed[c.Name[strings.LastIndexByte(c.Name, '.')+1:]+" "+c.Unit] = c.Regressed
+	}
+	want := map[string]bool{
+		// +6.5% is within the threshold
+		"BenchmarkPongHandler ns/op":       false,
+		"BenchmarkPongHandler B/op":        true,
+		"BenchmarkPongHandler allocs/op":   true,
+		"BenchmarkRecordRequest ns/op":     true,
+		"BenchmarkRecordRequest B/op":      false,
+		"BenchmarkRecordRequest allocs/op": false,
+	}
+	for key, w := range want {
+		if got, ok := regressed[key]; !ok || got != w {
+			t.Errorf("%s: expected regressed=%v, got %v (present %v)", key, w, got, ok)
+		}
+	}
+	if len(regressed) != len(want) {
+		t.Errorf("Expected only benchmarks on both sides compared, got %v", regressed)
+	}
+
+	var out bytes.Buffer
+	write(&out, compare(base, cur, 0.10), missing(cur, base), missing(base, cur))
+	for _, s := range []string{"REGRESSION", "new, not in baseline: ping/handlers.BenchmarkAdded", "in baseline, not run: ping/handlers.BenchmarkRetired"} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("Expected %q in the report, got:\n%s", s, out.String())
+		}
+	}
+}
+
+func TestCompareToleratesFasterResults(t *testing.T) {
+	base := results{"p.BenchmarkX": {unitTime: 100, unitAllocs: 3}}
+	cur := results{"p.BenchmarkX": {unitTime: 50, unitAllocs: 2}}
+	for _, c := range compare(base, cur, 0) {
+		if c.Regressed {
+			t.Errorf("Improvement flagged as regression: %+v", c)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// Command benchcmp compares go test -bench results against a stored
+// baseline and exits with status 1 when a benchmark regressed:
+//
+//	go test -run '^$' -bench . -benchmem -count 5 ./... > bench/current.txt
+//	benchcmp -baseline bench/baseline.txt -threshold 25 bench/current.txt
+//
+// ns/op and B/op regress when their median grows by more than -threshold
+// percent; allocs/op regress when it grows by one or more. Benchmarks only
+// one side has are listed but do not fail the comparison. make bench-check
+// runs both steps.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+func main() {
+	baseline := flag.String("baseline", "bench/baseline.txt", "go test -bench output to compare against")
+	threshold := flag.Float64("threshold", 25, "percent ns/op and B/op may grow before it counts as a regression")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: benchcmp [-baseline file] [-threshold percent] [current file, default stdin]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() > 1 || *threshold < 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	base, err := parseFile(*baseline)
+	if err != nil {
+		log.Fatalf("baseline: %v", err)
+	}
+	var cur results
+	if flag.NArg() == 1 {
+		cur, err = parseFile(flag.Arg(0))
+	} else {
+		cur, err = parse(os.Stdin)
+	}
+	if err != nil {
+		log.Fatalf("current results: %v", err)
+	}
+	if len(cur) == 0 {
+		log.Fatal("no benchmark results to compare; was -bench set?")
+	}
+
+	changes := compare(base, cur, *threshold/100)
+	write(os.Stdout, changes, missing(cur, base), missing(base, cur))
+	regressions := 0
+	for _, c := range changes {
+		if c.Regressed {
+			regressions++
+		}
+	}
+	if regressions > 0 {
+		fmt.Fprintf(os.Stderr, "%d regressions beyond %.0f%%\n", regressions, *threshold)
+		os.Exit(1)
+	}
+}
+
+func parseFile(path string) (results, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parse(f)
+}
@@ -0,0 +1,147 @@
+// Command pingctl pings the ping service from the terminal, like the
+// classic ping: it prints the round trip of every request and a summary
+// when it stops, after -c requests or on Ctrl-C.
+//
+//	pingctl                          # GET http://localhost:8080/ping every second
+//	pingctl -c 5 -i 200ms /health    # a path is resolved against -server
+//	pingctl -id deploy-check https://ping.example.com/readyz
+//	pingctl -tui /ping https://api.example.com/health
+//
+// With -tui it instead watches one or more targets on a live screen: a
+// sparkline of the recent round trips, their loss and a latency
+// histogram per target.
+//
+// Every request carries an X-Request-ID, generated per request unless -id
+// is given, and each line shows the correlation ID the server answered
+// with, so requests can be found in the server's logs.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// headerFlags collects repeated -H flags.
+type headerFlags []string
+
+func (h *headerFlags) String() string { return strings.Join(*h, ", ") }
+
+func (h *headerFlags) Set(v string) error {
+	*h = append(*h, v)
+	return nil
+}
+
+func main() {
+	var (
+		count    int
+		interval time.Duration
+		timeout  time.Duration
+		server   string
+		headers  headerFlags
+		id       string
+		tui      bool
+		output   string
+	)
+	flag.IntVar(&count, "c", 0, "stop after this many requests; 0 pings until interrupted")
+	flag.DurationVar(&interval, "i", time.Second, "wait between requests")
+	flag.DurationVar(&timeout, "timeout", 5*time.Second, "timeout of each request")
+	flag.StringVar(&server, "server", "http://localhost:8080", "server that paths are resolved against")
+	flag.StringVar(&id, "id", "", "correlation ID of every request; empty generates one per request")
+	flag.Var(&headers, "H", "request header as 'Name: value'; repeatable")
+	flag.BoolVar(&tui, "tui", false, "watch the targets on a live-updating screen")
+	flag.StringVar(&output, "output", outputTable, "output format: table, json (a line per attempt and summary) or csv (a row per attempt)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: pingctl [flags] [url | path]  (default /ping)\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "       pingctl -tui [flags] [url | path]...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if count < 0 || interval <= 0 || timeout <= 0 || (!tui && flag.NArg() > 1) || (tui && output != outputTable) {
+		flag.Usage()
+		os.Exit(2)
+	}
+	out, err := newPrinter(output, os.Stdout, os.Stderr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	header := make(http.Header)
+	for _, h := range headers {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			log.Fatalf("header must look like Name: value, got %q", h)
+		}
+		header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	args := flag.Args()
+	if len(args) == 0 {
+		args = []string{""}
+	}
+	client := &http.Client{Timeout: timeout}
+	pingers := make([]*pinger, len(args))
+	for i, arg := range args {
+		target, err := resolveTarget(server, arg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		pingers[i] = &pinger{client: client, url: target.String(), header: header, id: id}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if tui {
+		targets := monitor(ctx, os.Stdout, pingers, count, interval)
+		ok := 0
+		fmt.Println()
+		for _, s := range targets {
+			s.stats.write(os.Stdout, s.url)
+			ok += s.stats.ok
+		}
+		if ok == 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	p := pingers[0]
+	target, _ := url.Parse(p.url)
+	if output == outputTable {
+		fmt.Printf("PING %s\n", p.url)
+	}
+	var s stats
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for seq := 1; count == 0 || seq <= count; seq++ {
+		a := p.ping(ctx, seq)
+		if ctx.Err() != nil {
+			break
+		}
+		out.attempt(p.url, target.Host, a)
+		s.add(a)
+		if seq == count {
+			break
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	out.summary(p.url, &s)
+	out.flush()
+	if s.ok == 0 {
+		os.Exit(1)
+	}
+}
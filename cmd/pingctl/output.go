@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Output formats of -output.
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputCSV   = "csv"
+)
+
+// printer writes the attempts and summaries of a run in one format.
+type printer interface {
+	attempt(url, host string, a attempt)
+	summary(url string, s *stats)
+	flush()
+}
+
+// newPrinter returns the printer of format, writing results to w and, for
+// csv, the summaries to summaries.
+func newPrinter(format string, w, summaries io.Writer) (printer, error) {
+	switch format {
+	case outputTable:
+		return tablePrinter{w: w}, nil
+	case outputJSON:
+		return jsonPrinter{enc: json.NewEncoder(w)}, nil
+	case outputCSV:
+		return &csvPrinter{w: csv.NewWriter(w), summaries: summaries}, nil
+	}
+	return nil, fmt.Errorf("output must be table, json or csv, got %q", format)
+}
+
+// tablePrinter writes lines like ping for people.
+type tablePrinter struct {
+	w io.Writer
+}
+
+func (p tablePrinter) attempt(_, host string, a attempt) { a.write(p.w, host) }
+
+func (p tablePrinter) summary(url string, s *stats) {
+	fmt.Fprintln(p.w)
+	s.write(p.w, url)
+}
+
+func (p tablePrinter) flush() {}
+
+// jsonPrinter writes a JSON object per line: one per attempt, with type
+// "attempt", and one per summary, with type "summary".
+type jsonPrinter struct {
+	enc *json.Encoder
+}
+
+type attemptJSON struct {
+	Type   string  `json:"type"`
+	URL    string  `json:"url"`
+	Seq    int     `json:"seq"`
+	Status int     `json:"status,omitempty"`
+	RTTMs  float64 `json:"rtt_ms"`
+	ID     string  `json:"id"`
+	OK     bool    `json:"ok"`
+	Error  string  `json:"error,omitempty"`
+}
+
+type summaryJSON struct {
+	Type        string   `json:"type"`
+	URL         string   `json:"url"`
+	Sent        int      `json:"sent"`
+	OK          int      `json:"ok"`
+	FailedRatio float64  `json:"failed_ratio"`
+	MinMs       *float64 `json:"rtt_min_ms,omitempty"`
+	AvgMs       *float64 `json:"rtt_avg_ms,omitempty"`
+	MaxMs       *float64 `json:"rtt_max_ms,omitempty"`
+	MdevMs      *float64 `json:"rtt_mdev_ms,omitempty"`
+}
+
+func (p jsonPrinter) attempt(url, _ string, a attempt) {
+	out := attemptJSON{Type: "attempt", URL: url, Seq: a.seq, Status: a.status, RTTMs: millis(a.rtt.Microseconds()), ID: a.id, OK: a.ok()}
+	if a.err != nil {
+		out.Error = a.err.Error()
+	}
+	p.enc.Encode(out)
+}
+
+func (p jsonPrinter) summary(url string, s *stats) {
+	out := summaryJSON{Type: "summary", URL: url, Sent: s.sent, OK: s.ok, FailedRatio: s.failedRatio()}
+	if s.answered > 0 {
+		low, avg, high, mdev := s.rtts()
+		out.MinMs, out.AvgMs, out.MaxMs, out.MdevMs = &low, &avg, &high, &mdev
+	}
+	p.enc.Encode(out)
+}
+
+func (p jsonPrinter) flush() {}
+
+// csvPrinter writes a row per attempt under a header row. Summaries do not
+// fit the columns; they go to summaries as table lines.
+type csvPrinter struct {
+	w         *csv.Writer
+	summaries io.Writer
+	started   bool
+}
+
+func (p *csvPrinter) attempt(url, _ string, a attempt) {
+	if !p.started {
+		p.w.Write([]string{"url", "seq", "status", "rtt_ms", "id", "ok", "error"})
+		p.started = true
+	}
+	var errText string
+	if a.err != nil {
+		errText = a.err.Error()
+	}
+	p.w.Write([]string{
+		url, strconv.Itoa(a.seq), strconv.Itoa(a.status),
+		strconv.FormatFloat(millis(a.rtt.Microseconds()), 'f', 3, 64),
+		a.id, strconv.FormatBool(a.ok()), errText,
+	})
+	// Rows show up as they happen when piped
+	p.w.Flush()
+}
+
+func (p *csvPrinter) summary(url string, s *stats) { s.write(p.summaries, url) }
+
+func (p *csvPrinter) flush() { p.w.Flush() }
+
+func millis(micros int64) float64 {
+	return float64(micros) / 1000
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testRun(t *testing.T, format string) (string, string) {
+	t.Helper()
+	var out, summaries bytes.Buffer
+	p, err := newPrinter(format, &out, &summaries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s stats
+	for _, a := range []attempt{
+		{seq: 1, status: 200, rtt: 2 * time.Millisecond, id: "a"},
+		{seq: 2, rtt: time.Second, id: "b", err: context.DeadlineExceeded},
+	} {
+		p.attempt("http://localhost:8080/ping", "localhost:8080", a)
+		s.add(a)
+	}
+	p.summary("http://localhost:8080/ping", &s)
+	p.flush()
+	return out.String(), summaries.String()
+}
+
+func TestJSONOutput(t *testing.T) {
+	out, _ := testRun(t, outputJSON)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected 2 attempts and a summary, got %q", out)
+	}
+	var first attemptJSON
+	json.Unmarshal([]byte(lines[0]), &first)
+	if first.Type != "attempt" || first.Status != 200 || first.RTTMs != 2 || !first.OK || first.ID != "a" {
+		t.Errorf("Unexpected attempt %+v", first)
+	}
+	var failed attemptJSON
+	json.Unmarshal([]byte(lines[1]), &failed)
+	if failed.OK || failed.Error != context.DeadlineExceeded.Error() {
+		t.Errorf("Unexpected failed attempt %+v", failed)
+	}
+	var summary summaryJSON
+	json.Unmarshal([]byte(lines[2]), &summary)
+	if summary.Type != "summary" || summary.Sent != 2 || summary.OK != 1 || summary.FailedRatio != 0.5 || *summary.AvgMs != 2 {
+		t.Errorf("Unexpected summary %+v", summary)
+	}
+}
+
+func TestCSVOutput(t *testing.T) {
+	out, summaries := testRun(t, outputCSV)
+	rows, err := csv.NewReader(strings.NewReader(out)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[0][0] != "url" || rows[1][3] != "2.000" || rows[2][5] != "false" {
+		t.Errorf("Unexpected rows %q", rows)
+	}
+	if !strings.Contains(summaries, "2 requests sent, 1 ok") {
+		t.Errorf("Expected the summary aside, got %q", summaries)
+	}
+}
+
+func TestTableOutput(t *testing.T) {
+	out, _ := testRun(t, outputTable)
+	if !strings.HasPrefix(out, "200 from localhost:8080: seq=1") || !strings.Contains(out, "--- http://localhost:8080/ping ping statistics ---") {
+		t.Errorf("Unexpected output %q", out)
+	}
+}
+
+func TestNewPrinterRejectsUnknownFormat(t *testing.T) {
+	if _, err := newPrinter("yaml", nil, nil); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"ping/observability"
+)
+
+// pinger sends the requests of a pingctl run.
+type pinger struct {
+	client *http.Client
+	url    string
+	header http.Header
+	// id is the correlation ID of every request; empty generates one per
+	// request.
+	id string
+}
+
+// attempt is the outcome of one request.
+type attempt struct {
+	seq    int
+	status int
+	rtt    time.Duration
+	// id is the correlation ID the server answered with, or the one sent
+	id  string
+	err error
+}
+
+// ok reports whether the server answered with a 2xx.
+func (a attempt) ok() bool {
+	return a.err == nil && a.status >= 200 && a.status < 300
+}
+
+// ping sends request number seq.
+func (p *pinger) ping(ctx context.Context, seq int) attempt {
+	id := p.id
+	if id == "" {
+		id = observability.GenerateCorrelationID()
+	}
+	a := attempt{seq: seq, id: id}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url, nil)
+	if err != nil {
+		a.err = err
+		return a
+	}
+	for name, values := range p.header {
+		req.Header[name] = values
+	}
+	req.Header.Set(observability.RequestIDHeader, id)
+
+	start := time.Now()
+	resp, err := p.client.Do(req)
+	if err != nil {
+		a.rtt, a.err = time.Since(start), err
+		return a
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	a.rtt, a.status = time.Since(start), resp.StatusCode
+	if echoed := resp.Header.Get(observability.ResponseCorrelationIDHeader); echoed != "" {
+		a.id = echoed
+	}
+	return a
+}
+
+// write prints a for people, like a line of ping.
+func (a attempt) write(w io.Writer, host string) {
+	rtt := millis(a.rtt.Microseconds())
+	if a.err != nil {
+		fmt.Fprintf(w, "error from %s: seq=%d time=%.3f ms id=%s: %v\n", host, a.seq, rtt, a.id, a.err)
+		return
+	}
+	fmt.Fprintf(w, "%d from %s: seq=%d time=%.3f ms id=%s\n", a.status, host, a.seq, rtt, a.id)
+}
+
+// stats summarizes the attempts of a run.
+type stats struct {
+	sent, ok int
+	min, max time.Duration
+	// sum and sumSquares are of the round trips of answered requests, in
+	// milliseconds
+	answered        int
+	sum, sumSquares float64
+}
+
+func (s *stats) add(a attempt) {
+	s.sent++
+	if a.ok() {
+		s.ok++
+	}
+	if a.err != nil {
+		return
+	}
+	if s.answered == 0 || a.rtt < s.min {
+		s.min = a.rtt
+	}
+	if a.rtt > s.max {
+		s.max = a.rtt
+	}
+	ms := float64(a.rtt.Microseconds()) / 1000
+	s.answered++
+	s.sum += ms
+	s.sumSquares += ms * ms
+}
+
+// failedRatio returns the share of the requests sent that were not ok.
+func (s *stats) failedRatio() float64 {
+	if s.sent == 0 {
+		return 0
+	}
+	return float64(s.sent-s.ok) / float64(s.sent)
+}
+
+// rtts returns the minimum, average, maximum and standard deviation of the
+// round trips of answered requests, in milliseconds.
+func (s *stats) rtts() (low, avg, high, mdev float64) {
+	avg = s.sum / float64(s.answered)
+	mdev = math.Sqrt(max(s.sumSquares/float64(s.answered)-avg*avg, 0))
+	return millis(s.min.Microseconds()), avg, millis(s.max.Microseconds()), mdev
+}
+
+// write prints the summary for people, like the last lines of ping.
+func (s *stats) write(w io.Writer, url string) {
+	fmt.Fprintf(w, "--- %s ping statistics ---\n", url)
+	fmt.Fprintf(w, "%d requests sent, %d ok, %.1f%% failed\n", s.sent, s.ok, s.failedRatio()*100)
+	if s.answered == 0 {
+		return
+	}
+	low, avg, high, mdev := s.rtts()
+	fmt.Fprintf(w, "rtt min/avg/max/mdev = %.3f/%.3f/%.3f/%.3f ms\n", low, avg, high, mdev)
+}
+
+// resolveTarget returns arg as a URL, resolving a path against server.
+// An empty arg pings /ping.
+func resolveTarget(server, arg string) (*url.URL, error) {
+	if arg == "" {
+		arg = "/ping"
+	}
+	if strings.HasPrefix(arg, "/") {
+		arg = strings.TrimSuffix(server, "/") + arg
+	}
+	u, err := url.Parse(arg)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("target must be an http(s) URL or a path, got %q", arg)
+	}
+	return u, nil
+}
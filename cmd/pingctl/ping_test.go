@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ping/handlers"
+	"ping/observability"
+)
+
+func TestPingSendsAndReadsCorrelationIDs(t *testing.T) {
+	var sent []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent = append(sent, r.Header.Get(observability.RequestIDHeader))
+		if r.Header.Get("X-Tenant") != "acme" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		w.Header().Set(observability.ResponseCorrelationIDHeader, "server-"+r.Header.Get(observability.RequestIDHeader))
+	}))
+	defer srv.Close()
+
+	p := &pinger{client: srv.Client(), url: srv.URL + "/ping", header: http.Header{"X-Tenant": {"acme"}}}
+	first, second := p.ping(context.Background(), 1), p.ping(context.Background(), 2)
+	if !first.ok() || !second.ok() {
+		t.Fatalf("Expected both pings to succeed, got %+v and %+v", first, second)
+	}
+	if sent[0] == "" || sent[0] == sent[1] {
+		t.Errorf("Expected a fresh correlation ID per request, got %q", sent)
+	}
+	if first.id != "server-"+sent[0] {
+		t.Errorf("Expected the server's correlation ID, got %q", first.id)
+	}
+
+	p.id = "fixed"
+	if a := p.ping(context.Background(), 3); sent[2] != "fixed" || a.id != "server-fixed" {
+		t.Errorf("Expected the fixed ID to be sent, got %q", sent[2])
+	}
+}
+
+func TestPingDefaultsToTheServiceRoutes(t *testing.T) {
+	// The server's own mux: "/" answers pong only on its exact path
+	mux := http.NewServeMux()
+	mux.Handle("/", http.HandlerFunc(handlers.PongHandler))
+	handlers.RegisterPing(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	for _, arg := range append([]string{""}, handlers.PingPaths...) {
+		target, err := resolveTarget(srv.URL, arg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := &pinger{client: srv.Client(), url: target.String()}
+		if a := p.ping(context.Background(), 1); !a.ok() {
+			t.Errorf("Expected %s to answer ok, got %+v", target, a)
+		}
+	}
+	target, _ := resolveTarget(srv.URL, "/pong")
+	p := &pinger{client: srv.Client(), url: target.String()}
+	if a := p.ping(context.Background(), 1); a.ok() || a.status != http.StatusNotFound {
+		t.Errorf("Expected 404 from an unknown path, got %+v", a)
+	}
+}
+
+func TestPingRecordsFailures(t *testing.T) {
+	p := &pinger{client: &http.Client{Timeout: time.Second}, url: "http://127.0.0.1:1/ping"}
+	a := p.ping(context.Background(), 1)
+	if a.ok() || a.err == nil {
+		t.Fatalf("Expected an error, got %+v", a)
+	}
+	var buf bytes.Buffer
+	a.write(&buf, "127.0.0.1:1")
+	if !strings.HasPrefix(buf.String(), "error from 127.0.0.1:1: seq=1") {
+		t.Errorf("Unexpected line %q", buf.String())
+	}
+}
+
+func TestStatsSummary(t *testing.T) {
+	var s stats
+	s.add(attempt{status: 200, rtt: 10 * time.Millisecond})
+	s.add(attempt{status: 200, rtt: 30 * time.Millisecond})
+	s.add(attempt{status: 503, rtt: 20 * time.Millisecond})
+	s.add(attempt{err: context.DeadlineExceeded, rtt: time.Second})
+
+	var buf bytes.Buffer
+	s.write(&buf, "http://localhost:8080/ping")
+	want := "--- http://localhost:8080/ping ping statistics ---\n" +
+		"4 requests sent, 2 ok, 50.0% failed\n" +
+		"rtt min/avg/max/mdev = 10.000/20.000/30.000/8.165 ms\n"
+	if buf.String() != want {
+		t.Errorf("Summary = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestResolveTarget(t *testing.T) {
+	for arg, want := range map[string]string{
+		"":                            "http://localhost:8080/ping",
+		"/health":                     "http://localhost:8080/health",
+		"https://ping.example/readyz": "https://ping.example/readyz",
+	} {
+		u, err := resolveTarget("http://localhost:8080/", arg)
+		if err != nil || u.String() != want {
+			t.Errorf("resolveTarget(%q) = %v, %v; want %s", arg, u, err, want)
+		}
+	}
+	if _, err := resolveTarget("http://localhost:8080", "ftp://example.com"); err == nil {
+		t.Error("Expected an error for a non-HTTP URL")
+	}
+}
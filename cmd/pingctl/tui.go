@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sparkWidth is how many recent attempts the sparkline of a target shows.
+const sparkWidth = 60
+
+// sparkBlocks draw round trips from the fastest to the slowest of the
+// window; lost requests are drawn as sparkLost.
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+const sparkLost = '×'
+
+// histogramBounds are the upper bounds of the latency histogram rows; the
+// last row holds everything slower.
+var histogramBounds = []time.Duration{
+	time.Millisecond, 2500 * time.Microsecond, 5 * time.Millisecond, 10 * time.Millisecond,
+	25 * time.Millisecond, 50 * time.Millisecond, 100 * time.Millisecond, 250 * time.Millisecond,
+	500 * time.Millisecond, time.Second,
+}
+
+// series is what the monitor keeps of one target: the recent attempts,
+// the run's summary and its latency histogram.
+type series struct {
+	url    string
+	recent []attempt
+	stats  stats
+	counts []int
+}
+
+func newSeries(url string) *series {
+	return &series{url: url, counts: make([]int, len(histogramBounds)+1)}
+}
+
+func (s *series) add(a attempt) {
+	s.stats.add(a)
+	s.recent = append(s.recent, a)
+	if len(s.recent) > sparkWidth {
+		s.recent = s.recent[len(s.recent)-sparkWidth:]
+	}
+	if a.ok() {
+		i := 0
+		for i < len(histogramBounds) && a.rtt > histogramBounds[i] {
+			i++
+		}
+		s.counts[i]++
+	}
+}
+
+// sparkline draws the recent attempts, scaled between the fastest and the
+// slowest of them.
+func (s *series) sparkline() string {
+	var low, high time.Duration
+	for _, a := range s.recent {
+		if !a.ok() {
+			continue
+		}
+		if low == 0 || a.rtt < low {
+			low = a.rtt
+		}
+		if a.rtt > high {
+			high = a.rtt
+		}
+	}
+	var b strings.Builder
+	for _, a := range s.recent {
+		if !a.ok() {
+			b.WriteRune(sparkLost)
+			continue
+		}
+		i := 0
+		if high > low {
+			i = int(float64(a.rtt-low) / float64(high-low) * float64(len(sparkBlocks)-1))
+		}
+		b.WriteRune(sparkBlocks[i])
+	}
+	return b.String()
+}
+
+// loss returns the share of the recent attempts that failed, in percent.
+func (s *series) loss() float64 {
+	if len(s.recent) == 0 {
+		return 0
+	}
+	var failed int
+	for _, a := range s.recent {
+		if !a.ok() {
+			failed++
+		}
+	}
+	return float64(failed) / float64(len(s.recent)) * 100
+}
+
+// render draws a frame of the monitor for targets, replacing the previous
+// one on an ANSI terminal.
+func render(w io.Writer, targets []*series, elapsed time.Duration) {
+	var b strings.Builder
+	// Home the cursor and clear the screen
+	b.WriteString("\x1b[H\x1b[2J")
+	fmt.Fprintf(&b, "pingctl  %s  (Ctrl-C to quit)\n", elapsed.Round(time.Second))
+	for _, s := range targets {
+		fmt.Fprintf(&b, "\n%s\n", s.url)
+		var last string
+		if n := len(s.recent); n > 0 {
+			a := s.recent[n-1]
+			if a.err != nil {
+				last = "error"
+			} else {
+				last = fmt.Sprintf("%d %.1f ms", a.status, millis(a.rtt.Microseconds()))
+			}
+		}
+		fmt.Fprintf(&b, "  last %-14s loss %5.1f%% of %d recent, %d/%d ok overall\n",
+			last, s.loss(), len(s.recent), s.stats.ok, s.stats.sent)
+		fmt.Fprintf(&b, "  %s\n", s.sparkline())
+		writeHistogram(&b, s.counts)
+	}
+	io.WriteString(w, b.String())
+}
+
+// histogramWidth is the length of the longest histogram bar.
+const histogramWidth = 40
+
+// writeHistogram draws the rows of counts that have samples.
+func writeHistogram(w io.Writer, counts []int) {
+	most := 0
+	for _, n := range counts {
+		most = max(most, n)
+	}
+	if most == 0 {
+		return
+	}
+	for i, n := range counts {
+		if n == 0 {
+			continue
+		}
+		label := "> " + histogramBounds[len(histogramBounds)-1].String()
+		if i < len(histogramBounds) {
+			label = "≤ " + histogramBounds[i].String()
+		}
+		bar := strings.Repeat("█", max(1, n*histogramWidth/most))
+		fmt.Fprintf(w, "  %9s %s %d\n", label, bar, n)
+	}
+}
+
+// monitor pings every target once per interval, redrawing the screen
+// after each round, until count rounds are done or ctx ends, and returns
+// what it saw of each target.
+func monitor(ctx context.Context, w io.Writer, pingers []*pinger, count int, interval time.Duration) []*series {
+	targets := make([]*series, len(pingers))
+	for i, p := range pingers {
+		targets[i] = newSeries(p.url)
+	}
+	start := time.Now()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for seq := 1; count == 0 || seq <= count; seq++ {
+		// Targets are pinged together so a slow one does not delay the others
+		round := make([]attempt, len(pingers))
+		var wg sync.WaitGroup
+		for i, p := range pingers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				round[i] = p.ping(ctx, seq)
+			}()
+		}
+		wg.Wait()
+		if ctx.Err() != nil {
+			break
+		}
+		for i, a := range round {
+			targets[i].add(a)
+		}
+		render(w, targets, time.Since(start))
+		if seq == count {
+			break
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return targets
+}
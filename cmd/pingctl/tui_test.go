@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSeriesSparklineAndLoss(t *testing.T) {
+	s := newSeries("http://localhost:8080/ping")
+	for _, rtt := range []time.Duration{time.Millisecond, 8 * time.Millisecond, 15 * time.Millisecond} {
+		s.add(attempt{status: 200, rtt: rtt})
+	}
+	s.add(attempt{err: context.DeadlineExceeded})
+	if got := s.sparkline(); got != "▁▄█×" {
+		t.Errorf("sparkline = %q", got)
+	}
+	if got := s.loss(); got != 25 {
+		t.Errorf("loss = %v, want 25", got)
+	}
+
+	for i := 0; i < sparkWidth; i++ {
+		s.add(attempt{status: 200, rtt: time.Millisecond})
+	}
+	if len(s.recent) != sparkWidth || s.loss() != 0 || s.stats.sent != sparkWidth+4 {
+		t.Errorf("Expected only the last %d attempts in the window, got %d", sparkWidth, len(s.recent))
+	}
+}
+
+func TestWriteHistogram(t *testing.T) {
+	s := newSeries("u")
+	s.add(attempt{status: 200, rtt: 500 * time.Microsecond})
+	s.add(attempt{status: 200, rtt: 3 * time.Millisecond})
+	s.add(attempt{status: 200, rtt: 4 * time.Millisecond})
+	s.add(attempt{status: 200, rtt: 2 * time.Second})
+	// Errors and non-2xx answers are loss, not latency
+	s.add(attempt{status: 503, rtt: time.Millisecond})
+
+	var buf bytes.Buffer
+	writeHistogram(&buf, s.counts)
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	want := []string{"≤ 1ms", "≤ 5ms", "> 1s"}
+	if len(lines) != len(want) {
+		t.Fatalf("Expected %d rows, got %q", len(want), buf.String())
+	}
+	for i, label := range want {
+		if !strings.HasPrefix(strings.TrimSpace(lines[i]), label) {
+			t.Errorf("Row %d = %q, want %s", i, lines[i], label)
+		}
+	}
+	if !strings.HasSuffix(lines[1], strings.Repeat("█", histogramWidth)+" 2") {
+		t.Errorf("Expected the fullest row at full width, got %q", lines[1])
+	}
+}
+
+func TestMonitorRendersEveryTarget(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	pingers := []*pinger{
+		{client: srv.Client(), url: srv.URL + "/ping"},
+		{client: srv.Client(), url: srv.URL + "/down"},
+	}
+	var buf bytes.Buffer
+	targets := monitor(context.Background(), &buf, pingers, 3, time.Millisecond)
+	if targets[0].stats.ok != 3 || targets[1].stats.ok != 0 || targets[1].loss() != 100 {
+		t.Errorf("Unexpected stats %+v and %+v", targets[0].stats, targets[1].stats)
+	}
+	frames := strings.Split(buf.String(), "\x1b[H\x1b[2J")
+	if len(frames) != 4 {
+		t.Fatalf("Expected 3 frames, got %d", len(frames)-1)
+	}
+	last := frames[3]
+	if !strings.Contains(last, srv.URL+"/ping") || !strings.Contains(last, "last 503") || !strings.Contains(last, "×××") {
+		t.Errorf("Unexpected frame %q", last)
+	}
+}
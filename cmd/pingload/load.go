@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// loadConfig describes a load run.
+type loadConfig struct {
+	URL         string
+	Method      string
+	Body        string
+	Header      http.Header
+	Concurrency int
+	// Rate caps the requests per second across all workers; zero sends
+	// as fast as the workers can.
+	Rate     float64
+	Duration time.Duration
+	Client   *http.Client
+}
+
+// result is the outcome of one request: its status, zero when it got no
+// response.
+type result struct {
+	status  int
+	latency time.Duration
+	err     error
+}
+
+// failed reports whether the request counts as an error: no response or
+// a 5xx.
+func (r result) failed() bool {
+	return r.err != nil || r.status >= 500
+}
+
+// loadMetrics are the collectors pingload exposes while it runs.
+type loadMetrics struct {
+	requests *prometheus.CounterVec
+	duration prometheus.Histogram
+}
+
+func newLoadMetrics(reg prometheus.Registerer) *loadMetrics {
+	m := &loadMetrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "pingload_requests_total",
+			Help: "Total number of requests sent, by status code (error when no response arrived)",
+		}, []string{"code"}),
+		duration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "pingload_request_duration_seconds",
+			Help:    "Latency of the requests sent in seconds",
+			Buckets: prometheus.DefBuckets,
+		}),
+	}
+	reg.MustRegister(m.requests, m.duration)
+	return m
+}
+
+func (m *loadMetrics) record(r result) {
+	if m == nil {
+		return
+	}
+	code := "error"
+	if r.err == nil {
+		code = fmt.Sprint(r.status)
+	}
+	m.requests.WithLabelValues(code).Inc()
+	m.duration.Observe(r.latency.Seconds())
+}
+
+// run sends requests as cfg says until its duration is over or ctx ends,
+// and returns the results of the requests that completed.
+func run(ctx context.Context, cfg loadConfig, metrics *loadMetrics) []result {
+	ctx, cancel := context.WithTimeout(ctx, cfg.Duration)
+	defer cancel()
+
+	// With a rate, each request waits for a token from the pacer
+	var tokens chan struct{}
+	if cfg.Rate > 0 {
+		tokens = make(chan struct{})
+		go pace(ctx, cfg.Rate, tokens)
+	}
+
+	var (
+		mu      sync.Mutex
+		results []result
+		wg      sync.WaitGroup
+	)
+	for i := 0; i < cfg.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var own []result
+			for {
+				if tokens != nil {
+					select {
+					case <-tokens:
+					case <-ctx.Done():
+					}
+				}
+				if ctx.Err() != nil {
+					break
+				}
+				r := send(ctx, cfg)
+				// Requests cut short by the end of the run are not results
+				if r.err != nil && ctx.Err() != nil {
+					break
+				}
+				metrics.record(r)
+				own = append(own, r)
+			}
+			mu.Lock()
+			results = append(results, own...)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// pace sends a token every 1/rate seconds until ctx ends.
+func pace(ctx context.Context, rate float64, tokens chan<- struct{}) {
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / rate))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			select {
+			case tokens <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// send makes one request, reading the whole response body.
+func send(ctx context.Context, cfg loadConfig) result {
+	var body io.Reader
+	if cfg.Body != "" {
+		body = strings.NewReader(cfg.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, cfg.Method, cfg.URL, body)
+	if err != nil {
+		return result{err: err}
+	}
+	for name, values := range cfg.Header {
+		req.Header[name] = values
+	}
+	if host := cfg.Header.Get("Host"); host != "" {
+		req.Host = host
+	}
+
+	start := time.Now()
+	resp, err := cfg.Client.Do(req)
+	if err != nil {
+		return result{latency: time.Since(start), err: err}
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return result{status: resp.StatusCode, latency: time.Since(start)}
+}
+
+// report summarizes the results of a run that lasted elapsed.
+type report struct {
+	Requests  int
+	Errors    int
+	ErrorRate float64
+	RPS       float64
+	Codes     map[string]int
+	Mean      time.Duration
+	P50       time.Duration
+	P90       time.Duration
+	P99       time.Duration
+	Max       time.Duration
+}
+
+func summarize(results []result, elapsed time.Duration) report {
+	rep := report{Requests: len(results), Codes: make(map[string]int)}
+	if len(results) == 0 {
+		return rep
+	}
+	latencies := make([]time.Duration, len(results))
+	var total time.Duration
+	for i, r := range results {
+		latencies[i] = r.latency
+		total += r.latency
+		if r.failed() {
+			rep.Errors++
+		}
+		if r.err != nil {
+			rep.Codes["error"]++
+		} else {
+			rep.Codes[fmt.Sprint(r.status)]++
+		}
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	rep.ErrorRate = float64(rep.Errors) / float64(rep.Requests)
+	if elapsed > 0 {
+		rep.RPS = float64(rep.Requests) / elapsed.Seconds()
+	}
+	rep.Mean = total / time.Duration(len(results))
+	rep.P50 = percentile(latencies, 0.5)
+	rep.P90 = percentile(latencies, 0.9)
+	rep.P99 = percentile(latencies, 0.99)
+	rep.Max = latencies[len(latencies)-1]
+	return rep
+}
+
+// percentile returns the nearest-rank q-quantile of sorted latencies.
+func percentile(sorted []time.Duration, q float64) time.Duration {
+	rank := int(q*float64(len(sorted)) + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
+
+// write prints rep for people.
+func (rep report) write(w io.Writer) {
+	fmt.Fprintf(w, "requests:    %d (%.1f/s)\n", rep.Requests, rep.RPS)
+	fmt.Fprintf(w, "errors:      %d (%.2f%%)\n", rep.Errors, rep.ErrorRate*100)
+	codes := make([]string, 0, len(rep.Codes))
+	for code := range rep.Codes {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		fmt.Fprintf(w, "  %-10s %d\n", code, rep.Codes[code])
+	}
+	fmt.Fprintf(w, "latency:     mean %s, p50 %s, p90 %s, p99 %s, max %s\n",
+		rep.Mean.Round(time.Microsecond), rep.P50.Round(time.Microsecond), rep.P90.Round(time.Microsecond),
+		rep.P99.Round(time.Microsecond), rep.Max.Round(time.Microsecond))
+}
+
+// parseHeaders turns "Name: value" flags into a header.
+func parseHeaders(values []string) (http.Header, error) {
+	header := make(http.Header)
+	for _, v := range values {
+		name, value, ok := strings.Cut(v, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("header must look like Name: value, got %q", v)
+		}
+		header.Add(name, strings.TrimSpace(value))
+	}
+	return header, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRunSendsHeadersAndRecords(t *testing.T) {
+	var hits atomic.Int32
+	var token atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token.Store(r.Header.Get("Authorization"))
+		if hits.Add(1)%4 == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	header, err := parseHeaders([]string{"Authorization: Bearer t"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := newLoadMetrics(prometheus.NewRegistry())
+	results := run(context.Background(), loadConfig{
+		URL:         srv.URL,
+		Method:      http.MethodGet,
+		Header:      header,
+		Concurrency: 2,
+		Duration:    100 * time.Millisecond,
+		Client:      srv.Client(),
+	}, metrics)
+
+	// Requests the end of the run cut short, one per worker at most, are
+	// left out
+	if n := int(hits.Load()); len(results) == 0 || len(results) > n || len(results) < n-2 {
+		t.Fatalf("Expected a result per completed request, got %d for %d", len(results), n)
+	}
+	if token.Load() != "Bearer t" {
+		t.Errorf("Expected the header to be sent, got %v", token.Load())
+	}
+	rep := summarize(results, 100*time.Millisecond)
+	if rep.Errors < len(results)/4-2 || rep.Errors > len(results)/4+2 || rep.Codes["503"] != rep.Errors {
+		t.Errorf("Expected every fourth request to fail, got %+v", rep)
+	}
+	if got := testutil.ToFloat64(metrics.requests.WithLabelValues("200")); int(got) != rep.Codes["200"] {
+		t.Errorf("Expected %d 200s recorded, got %v", rep.Codes["200"], got)
+	}
+}
+
+func TestRunHoldsTheRate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	results := run(context.Background(), loadConfig{
+		URL:         srv.URL,
+		Method:      http.MethodGet,
+		Concurrency: 4,
+		Rate:        50,
+		Duration:    200 * time.Millisecond,
+		Client:      srv.Client(),
+	}, nil)
+	// 10 ticks at 50/s, give or take scheduling
+	if len(results) < 5 || len(results) > 11 {
+		t.Errorf("Expected about 10 requests at 50/s for 200ms, got %d", len(results))
+	}
+}
+
+func TestSummarizePercentiles(t *testing.T) {
+	var results []result
+	for i := 1; i <= 100; i++ {
+		results = append(results, result{status: 200, latency: time.Duration(i) * time.Millisecond})
+	}
+	results = append(results, result{err: context.DeadlineExceeded, latency: time.Second})
+	rep := summarize(results, time.Second)
+	if rep.P50 != 51*time.Millisecond || rep.P99 != 100*time.Millisecond || rep.Max != time.Second {
+		t.Errorf("Unexpected percentiles %+v", rep)
+	}
+	if rep.Errors != 1 || rep.Codes["error"] != 1 || rep.RPS != 101 {
+		t.Errorf("Unexpected counts %+v", rep)
+	}
+
+	var buf bytes.Buffer
+	rep.write(&buf)
+	if !strings.Contains(buf.String(), "errors:      1 (0.99%)") {
+		t.Errorf("Unexpected report %q", buf.String())
+	}
+}
+
+func TestParseHeadersRejectsBadValues(t *testing.T) {
+	if _, err := parseHeaders([]string{"no-colon"}); err == nil {
+		t.Error("Expected an error for a header without a colon")
+	}
+}
@@ -0,0 +1,106 @@
+// Command pingload generates HTTP load against the ping service, or any
+// URL, and reports latency percentiles and error rates:
+//
+//	pingload -url http://localhost:8080/ -c 20 -rate 500 -d 30s -H 'Authorization: Bearer t'
+//
+// With -metrics-addr it also serves its own request counter and latency
+// histogram on /metrics while it runs, so the load can be graphed next to
+// the service's view of it.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// headerFlags collects repeated -H flags.
+type headerFlags []string
+
+func (h *headerFlags) String() string { return strings.Join(*h, ", ") }
+
+func (h *headerFlags) Set(v string) error {
+	*h = append(*h, v)
+	return nil
+}
+
+func main() {
+	var (
+		cfg         loadConfig
+		headers     headerFlags
+		timeout     time.Duration
+		metricsAddr string
+		output      string
+	)
+	flag.StringVar(&cfg.URL, "url", "http://localhost:8080/", "URL to send requests to")
+	flag.StringVar(&cfg.Method, "method", http.MethodGet, "request method")
+	flag.StringVar(&cfg.Body, "body", "", "request body")
+	flag.Var(&headers, "H", "request header as 'Name: value'; repeatable")
+	flag.IntVar(&cfg.Concurrency, "c", 10, "concurrent workers")
+	flag.Float64Var(&cfg.Rate, "rate", 0, "requests per second across all workers; 0 sends as fast as possible")
+	flag.DurationVar(&cfg.Duration, "d", 10*time.Second, "how long to send requests")
+	flag.DurationVar(&timeout, "timeout", 10*time.Second, "timeout of each request")
+	flag.StringVar(&metricsAddr, "metrics-addr", "", "serve pingload's own /metrics on this address, e.g. :9091")
+	flag.StringVar(&output, "output", outputTable, "report format: table, json or csv")
+	flag.Parse()
+
+	if cfg.Concurrency < 1 || cfg.Duration <= 0 || cfg.Rate < 0 || timeout <= 0 {
+		log.Fatal("-c must be at least 1, -d and -timeout positive and -rate not negative")
+	}
+	if output != outputTable && output != outputJSON && output != outputCSV {
+		log.Fatalf("-output must be table, json or csv, got %q", output)
+	}
+	header, err := parseHeaders(headers)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cfg.Header = header
+	cfg.Client = &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			MaxIdleConnsPerHost: cfg.Concurrency,
+		},
+	}
+
+	var metrics *loadMetrics
+	if metricsAddr != "" {
+		reg := prometheus.NewRegistry()
+		metrics = newLoadMetrics(reg)
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+		srv := &http.Server{Addr: metricsAddr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+		go func() {
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatalf("metrics server: %v", err)
+			}
+		}()
+		defer srv.Close()
+	}
+
+	// Ctrl-C ends the run early and still reports
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Fprintf(os.Stderr, "%s %s for %s with %d workers\n", cfg.Method, cfg.URL, cfg.Duration, cfg.Concurrency)
+	start := time.Now()
+	results := run(ctx, cfg, metrics)
+	rep := summarize(results, time.Since(start))
+	if err := rep.writeFormat(os.Stdout, output); err != nil {
+		log.Fatal(err)
+	}
+	if rep.Requests == 0 || rep.Errors == rep.Requests {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Output formats of -output.
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputCSV   = "csv"
+)
+
+// reportJSON is the json output of a report, with latencies in
+// milliseconds.
+type reportJSON struct {
+	Requests  int            `json:"requests"`
+	Errors    int            `json:"errors"`
+	ErrorRate float64        `json:"error_rate"`
+	RPS       float64        `json:"requests_per_second"`
+	Codes     map[string]int `json:"codes"`
+	MeanMs    float64        `json:"latency_mean_ms"`
+	P50Ms     float64        `json:"latency_p50_ms"`
+	P90Ms     float64        `json:"latency_p90_ms"`
+	P99Ms     float64        `json:"latency_p99_ms"`
+	MaxMs     float64        `json:"latency_max_ms"`
+}
+
+// csvColumns head the csv output; codes are "code=count" pairs separated
+// by semicolons.
+var csvColumns = []string{
+	"requests", "errors", "error_rate", "requests_per_second", "codes",
+	"latency_mean_ms", "latency_p50_ms", "latency_p90_ms", "latency_p99_ms", "latency_max_ms",
+}
+
+// writeFormat writes rep in format.
+func (rep report) writeFormat(w io.Writer, format string) error {
+	switch format {
+	case outputTable:
+		rep.write(w)
+		return nil
+	case outputJSON:
+		return json.NewEncoder(w).Encode(reportJSON{
+			Requests: rep.Requests, Errors: rep.Errors, ErrorRate: rep.ErrorRate, RPS: rep.RPS, Codes: rep.Codes,
+			MeanMs: ms(rep.Mean), P50Ms: ms(rep.P50), P90Ms: ms(rep.P90), P99Ms: ms(rep.P99), MaxMs: ms(rep.Max),
+		})
+	case outputCSV:
+		codes := make([]string, 0, len(rep.Codes))
+		for code, n := range rep.Codes {
+			codes = append(codes, code+"="+strconv.Itoa(n))
+		}
+		sort.Strings(codes)
+		cw := csv.NewWriter(w)
+		cw.Write(csvColumns)
+		cw.Write([]string{
+			strconv.Itoa(rep.Requests), strconv.Itoa(rep.Errors),
+			strconv.FormatFloat(rep.ErrorRate, 'f', 4, 64), strconv.FormatFloat(rep.RPS, 'f', 1, 64),
+			strings.Join(codes, ";"),
+			formatMs(rep.Mean), formatMs(rep.P50), formatMs(rep.P90), formatMs(rep.P99), formatMs(rep.Max),
+		})
+		cw.Flush()
+		return cw.Error()
+	}
+	return fmt.Errorf("output must be table, json or csv, got %q", format)
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func formatMs(d time.Duration) string {
+	return strconv.FormatFloat(ms(d), 'f', 3, 64)
+}
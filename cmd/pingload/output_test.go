@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func testReport() report {
+	return report{
+		Requests: 4, Errors: 1, ErrorRate: 0.25, RPS: 2, Codes: map[string]int{"200": 3, "503": 1},
+		Mean: 1500 * time.Microsecond, P50: time.Millisecond, P90: 2 * time.Millisecond,
+		P99: 3 * time.Millisecond, Max: 3 * time.Millisecond,
+	}
+}
+
+func TestReportJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testReport().writeFormat(&buf, outputJSON); err != nil {
+		t.Fatal(err)
+	}
+	var got reportJSON
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("Invalid JSON %q: %v", buf.String(), err)
+	}
+	if got.Requests != 4 || got.ErrorRate != 0.25 || got.Codes["503"] != 1 || got.MeanMs != 1.5 || got.P99Ms != 3 {
+		t.Errorf("Unexpected report %+v", got)
+	}
+}
+
+func TestReportCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testReport().writeFormat(&buf, outputCSV); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || len(rows[1]) != len(csvColumns) {
+		t.Fatalf("Expected a header and a row, got %q", rows)
+	}
+	if rows[1][0] != "4" || rows[1][4] != "200=3;503=1" || rows[1][5] != "1.500" {
+		t.Errorf("Unexpected row %q", rows[1])
+	}
+}
+
+func TestReportRejectsUnknownFormat(t *testing.T) {
+	if err := testReport().writeFormat(&bytes.Buffer{}, "yaml"); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
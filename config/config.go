@@ -0,0 +1,1332 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the runtime settings of the service.
+// Every field can be set through an environment variable.
+type Config struct {
+	// Port is the TCP port the HTTP server listens on (PORT)
+	Port string
+	// AdminPort, when set, moves debug endpoints to a separate listener (ADMIN_PORT)
+	AdminPort string
+	// ShutdownDrainDelay is how long /readyz fails before the listeners
+	// close on shutdown, so load balancers stop routing first
+	// (SHUTDOWN_DRAIN_DELAY)
+	ShutdownDrainDelay time.Duration
+
+	// ServiceName identifies this service in exported traces (SERVICE_NAME)
+	ServiceName string
+	// Version is reported at startup and in structured logs (SERVICE_VERSION)
+	Version string
+	// Environment names the deployment, e.g. prod or staging (ENVIRONMENT)
+	Environment string
+	// PodName is the Kubernetes pod name, usually set via the downward API (POD_NAME)
+	PodName string
+	// InstanceID distinguishes replicas that share a hostname (INSTANCE_ID)
+	InstanceID string
+	// RequestIDScheme formats generated correlation IDs: uuid4, uuid7,
+	// ulid, ksuid or short (REQUEST_ID_SCHEME)
+	RequestIDScheme string
+	// RequestIDPrefix namespaces short IDs; defaults to the service name
+	// (REQUEST_ID_PREFIX)
+	RequestIDPrefix string
+
+	// LogFormat selects "text" lines or structured "json" logs (LOG_FORMAT)
+	LogFormat string
+	// LogAsync hands log lines to a background writer instead of writing
+	// them on the request goroutine (LOG_ASYNC)
+	LogAsync bool
+	// LogBufferSize is the number of lines the async writer queues before
+	// dropping (LOG_BUFFER_SIZE)
+	LogBufferSize int
+	// LogTail only logs completions of failed or slow requests (LOG_TAIL)
+	LogTail bool
+	// LogTailThreshold is the duration above which tail mode logs a
+	// successful request (LOG_TAIL_THRESHOLD)
+	LogTailThreshold time.Duration
+	// LogRedactQueryParams overrides the query parameters masked in logs
+	// (LOG_REDACT_QUERY_PARAMS, comma-separated, "*" for all)
+	LogRedactQueryParams []string
+	// LogRedactHeaders overrides the headers masked in logs
+	// (LOG_REDACT_HEADERS, comma-separated)
+	LogRedactHeaders []string
+	// LogMaxUserAgent truncates logged user agents; zero disables
+	// truncation (LOG_MAX_USER_AGENT)
+	LogMaxUserAgent int
+
+	// SlowRequestThreshold marks requests slower than this as slow; zero
+	// disables detection (SLOW_REQUEST_THRESHOLD)
+	SlowRequestThreshold time.Duration
+
+	// DebugCaptureRoutes lists path prefixes whose request and response
+	// bodies are always logged (DEBUG_CAPTURE_ROUTES, comma-separated)
+	DebugCaptureRoutes []string
+	// DebugCaptureHeader is the header that opts a request into body
+	// capture (DEBUG_CAPTURE_HEADER)
+	DebugCaptureHeader string
+	// DebugCaptureToken is the secret the capture header must carry;
+	// empty disables the header trigger (DEBUG_CAPTURE_TOKEN or
+	// DEBUG_CAPTURE_TOKEN_FILE)
+	DebugCaptureToken string
+	// DebugCaptureMaxBytes caps each captured body (DEBUG_CAPTURE_MAX_BYTES)
+	DebugCaptureMaxBytes int
+	// RecentRequests is how many request summaries /debug/requests keeps;
+	// zero disables the endpoint (DEBUG_RECENT_REQUESTS)
+	RecentRequests int
+	// StatsWindow is the rolling window /stats summarizes; zero disables
+	// the endpoint (STATS_WINDOW)
+	StatsWindow time.Duration
+
+	// HealthChecks are dependency checks as kind:name=target, e.g.
+	// http:api=https://api/health, tcp:db=db:5432, dns:resolver=example.com
+	// or disk:data=/var/lib/ping (HEALTH_CHECKS)
+	HealthChecks []string
+	// HealthChecksNonCritical names checks that only degrade the health
+	// status (HEALTH_CHECKS_NON_CRITICAL)
+	HealthChecksNonCritical []string
+	// HealthDiskMinFreeMB is the free space disk checks require
+	// (HEALTH_DISK_MIN_FREE_MB)
+	HealthDiskMinFreeMB int
+	// HealthCheckTimeout bounds each health check run
+	// (HEALTH_CHECK_TIMEOUT)
+	HealthCheckTimeout time.Duration
+	// HealthCheckHedgeDelay sends a second request when an http check has
+	// not answered this long, using whichever answers first; zero
+	// disables hedging (HEALTH_CHECK_HEDGE_DELAY)
+	HealthCheckHedgeDelay time.Duration
+	// HealthCacheTTL reuses check results for this long; zero runs the
+	// checks on every probe (HEALTH_CACHE_TTL)
+	HealthCacheTTL time.Duration
+
+	// MaxInFlight caps concurrently handled requests; zero disables the
+	// limit (MAX_IN_FLIGHT)
+	MaxInFlight int
+	// ConcurrencyQueueTimeout is how long a request waits for a free slot
+	// before a 503 (CONCURRENCY_QUEUE_TIMEOUT)
+	ConcurrencyQueueTimeout time.Duration
+	// RetryAfter is advertised on 503 responses from the limiter (RETRY_AFTER)
+	RetryAfter time.Duration
+	// ShedQueueWaitTarget enables adaptive load shedding once the smoothed
+	// queue wait exceeds it; zero disables (SHED_QUEUE_WAIT_TARGET)
+	ShedQueueWaitTarget time.Duration
+	// ShedLowPriorityPaths are path prefixes shed first (SHED_LOW_PRIORITY_PATHS)
+	ShedLowPriorityPaths []string
+	// ShedCriticalPaths are path prefixes never shed (SHED_CRITICAL_PATHS)
+	ShedCriticalPaths []string
+
+	// RateLimitRPS is the per-client-IP request rate; zero disables rate
+	// limiting (RATE_LIMIT_RPS)
+	RateLimitRPS float64
+	// RateLimitBurst is how many requests a client may make at once
+	// (RATE_LIMIT_BURST)
+	RateLimitBurst int
+	// RateLimitMaxClients bounds the number of client buckets kept in
+	// memory (RATE_LIMIT_MAX_CLIENTS)
+	RateLimitMaxClients int
+	// RateLimitBackend is "local" for per-instance buckets or "redis" for
+	// buckets shared by every replica (RATE_LIMIT_BACKEND)
+	RateLimitBackend string
+	// RateLimitHeaders adds X-RateLimit-* and RateLimit-* headers to
+	// responses (RATE_LIMIT_HEADERS)
+	RateLimitHeaders bool
+
+	// CORSAllowedOrigins enables CORS for matching origins; "*" and
+	// "https://*.example.com" style wildcards are accepted
+	// (CORS_ALLOWED_ORIGINS)
+	CORSAllowedOrigins []string
+	// CORSAllowedMethods are accepted in preflight requests
+	// (CORS_ALLOWED_METHODS)
+	CORSAllowedMethods []string
+	// CORSAllowedHeaders are accepted in preflight requests
+	// (CORS_ALLOWED_HEADERS)
+	CORSAllowedHeaders []string
+	// CORSExposedHeaders are readable by browser scripts
+	// (CORS_EXPOSED_HEADERS)
+	CORSExposedHeaders []string
+	// CORSAllowCredentials allows cookies and auth headers on cross-origin
+	// requests; it cannot be combined with a "*" origin
+	// (CORS_ALLOW_CREDENTIALS)
+	CORSAllowCredentials bool
+	// CORSMaxAge is how long browsers cache preflight results
+	// (CORS_MAX_AGE)
+	CORSMaxAge time.Duration
+
+	// SecurityHeaders enables HSTS, nosniff, frame, referrer and CSP
+	// headers (SECURITY_HEADERS)
+	SecurityHeaders bool
+	// HSTSMaxAge is the Strict-Transport-Security max-age; zero omits the
+	// header (HSTS_MAX_AGE)
+	HSTSMaxAge time.Duration
+	// FrameOptions is the X-Frame-Options value (FRAME_OPTIONS)
+	FrameOptions string
+	// ReferrerPolicy is the Referrer-Policy value (REFERRER_POLICY)
+	ReferrerPolicy string
+	// ContentSecurityPolicy is the Content-Security-Policy value
+	// (CONTENT_SECURITY_POLICY)
+	ContentSecurityPolicy string
+	// SecurityHeadersExemptPaths are served without security headers
+	// (SECURITY_HEADERS_EXEMPT_PATHS)
+	SecurityHeadersExemptPaths []string
+
+	// Compression enables gzip/brotli response compression (COMPRESSION)
+	Compression bool
+	// CompressionMinSize is the smallest response compressed, in bytes
+	// (COMPRESSION_MIN_SIZE)
+	CompressionMinSize int
+	// MaxDecompressedBodyBytes caps gzip/zstd request bodies after
+	// decoding (MAX_DECOMPRESSED_BODY_BYTES)
+	MaxDecompressedBodyBytes int
+
+	// JWTJWKSURL enables bearer token authentication against the keys
+	// published at this URL (JWT_JWKS_URL)
+	JWTJWKSURL string
+	// JWTIssuer is the required "iss" claim (JWT_ISSUER)
+	JWTIssuer string
+	// JWTAudience must appear in the "aud" claim (JWT_AUDIENCE)
+	JWTAudience string
+	// JWTLeeway tolerates clock skew on exp and nbf (JWT_LEEWAY)
+	JWTLeeway time.Duration
+	// JWKSRefreshInterval is how long fetched keys are cached
+	// (JWT_JWKS_REFRESH_INTERVAL)
+	JWKSRefreshInterval time.Duration
+	// JWTExemptPaths are served without a token (JWT_EXEMPT_PATHS)
+	JWTExemptPaths []string
+
+	// AdminUsername and AdminPassword, when both set, protect /metrics and
+	// /debug/* with HTTP Basic auth (ADMIN_USERNAME, ADMIN_PASSWORD)
+	AdminUsername string
+	AdminPassword string
+
+	// OIDCIssuerURL enables OIDC login for the admin endpoints
+	// (OIDC_ISSUER_URL)
+	OIDCIssuerURL string
+	// OIDCClientID identifies the service to the provider (OIDC_CLIENT_ID)
+	OIDCClientID string
+	// OIDCClientSecret authenticates the code exchange (OIDC_CLIENT_SECRET
+	// or OIDC_CLIENT_SECRET_FILE)
+	OIDCClientSecret string
+	// OIDCRedirectURL is the registered callback, ending in /auth/callback
+	// (OIDC_REDIRECT_URL)
+	OIDCRedirectURL string
+	// OIDCScopes are requested at login (OIDC_SCOPES)
+	OIDCScopes []string
+	// OIDCGroupsClaim names the ID token claim with group memberships
+	// (OIDC_GROUPS_CLAIM)
+	OIDCGroupsClaim string
+	// OIDCAllowedGroups restricts access to these groups; empty admits any
+	// signed-in user (OIDC_ALLOWED_GROUPS)
+	OIDCAllowedGroups []string
+	// OIDCCookieSecret signs session cookies, at least 32 bytes
+	// (OIDC_COOKIE_SECRET or OIDC_COOKIE_SECRET_FILE)
+	OIDCCookieSecret string
+	// OIDCSessionTTL is how long a login lasts (OIDC_SESSION_TTL)
+	OIDCSessionTTL time.Duration
+
+	// TLSCertFile and TLSKeyFile enable HTTPS on the main listener
+	// (TLS_CERT_FILE, TLS_KEY_FILE)
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSClientCAFile verifies client certificates against these CAs
+	// (TLS_CLIENT_CA_FILE)
+	TLSClientCAFile string
+	// TLSClientAuth is "none", "verify_if_given" or "require"; defaults to
+	// verify_if_given when a client CA is set (TLS_CLIENT_AUTH)
+	TLSClientAuth string
+	// ClientIdentityMetric counts requests per client certificate identity
+	// (CLIENT_IDENTITY_METRIC)
+	ClientIdentityMetric bool
+
+	// TrustedProxies lists proxy CIDRs or IPs whose Forwarded,
+	// X-Forwarded-For and X-Real-IP headers are believed (TRUSTED_PROXIES)
+	TrustedProxies []string
+
+	// OutboundTimeout bounds each call of the client shared by metric and
+	// trace exports, health probes and token key fetches
+	// (OUTBOUND_TIMEOUT)
+	OutboundTimeout time.Duration
+	// OutboundLogLevel logs every outbound call at "debug" or "info", or
+	// none with "off" (OUTBOUND_LOG_LEVEL)
+	OutboundLogLevel string
+	// OutboundRetryMaxAttempts is how many times a failed outbound call
+	// is sent at most; 1 disables retries (OUTBOUND_RETRY_MAX_ATTEMPTS)
+	OutboundRetryMaxAttempts int
+	// OutboundRetryBackoff and OutboundRetryMaxBackoff are the first and
+	// the longest delay between attempts (OUTBOUND_RETRY_BACKOFF,
+	// OUTBOUND_RETRY_MAX_BACKOFF)
+	OutboundRetryBackoff    time.Duration
+	OutboundRetryMaxBackoff time.Duration
+	// OutboundRetryMethods are the methods that may be retried
+	// (OUTBOUND_RETRY_METHODS)
+	OutboundRetryMethods []string
+	// OutboundRetryHosts sets the attempts per destination, as
+	// host[:port]=attempts entries (OUTBOUND_RETRY_HOSTS)
+	OutboundRetryHosts []string
+	// OutboundRetryBudget is the share of outbound calls that may be
+	// retried across the service, with OutboundRetryBudgetBurst retries
+	// saved up for quiet periods (OUTBOUND_RETRY_BUDGET,
+	// OUTBOUND_RETRY_BUDGET_BURST)
+	OutboundRetryBudget      float64
+	OutboundRetryBudgetBurst int
+
+	// MirrorURL enables shadowing a sample of requests to this upstream
+	// (MIRROR_URL)
+	MirrorURL string
+	// MirrorPercent is the share of requests mirrored, 0-100
+	// (MIRROR_PERCENT)
+	MirrorPercent float64
+	// MirrorTimeout bounds each mirrored request (MIRROR_TIMEOUT)
+	MirrorTimeout time.Duration
+	// MirrorMaxBodyBytes is the largest body copied to the mirror
+	// (MIRROR_MAX_BODY_BYTES)
+	MirrorMaxBodyBytes int
+	// MirrorForwardCredentials copies Authorization and Cookie headers to
+	// the mirror (MIRROR_FORWARD_CREDENTIALS)
+	MirrorForwardCredentials bool
+
+	// ProxyUpstreamURL reverse-proxies every request not served by a
+	// built-in endpoint to this upstream (PROXY_UPSTREAM_URL)
+	ProxyUpstreamURL string
+	// ProxyTimeout bounds the wait for the upstream's response headers
+	// (PROXY_TIMEOUT)
+	ProxyTimeout time.Duration
+
+	// CacheRoutes lists GET routes whose responses are cached in memory
+	// (CACHE_ROUTES)
+	CacheRoutes []string
+	// CacheTTL is how long a cached response is served (CACHE_TTL)
+	CacheTTL time.Duration
+	// CacheMaxEntries bounds the response cache (CACHE_MAX_ENTRIES)
+	CacheMaxEntries int
+	// CacheVaryHeaders are request headers that key distinct cache
+	// entries (CACHE_VARY_HEADERS)
+	CacheVaryHeaders []string
+	// CachePurgeSchedule is when the background job drops expired cache
+	// entries, as a cron expression or @every interval
+	// (CACHE_PURGE_SCHEDULE)
+	CachePurgeSchedule string
+
+	// JobWorkers is how many queued background jobs run at once
+	// (JOB_WORKERS)
+	JobWorkers int
+	// JobQueueSize is how many background jobs may wait for a worker
+	// before new ones are rejected (JOB_QUEUE_SIZE)
+	JobQueueSize int
+	// JobStoreDir persists queued jobs so they survive restarts; empty
+	// keeps them in memory (JOB_STORE_DIR)
+	JobStoreDir string
+	// JobRetention is how long finished jobs are kept (JOB_RETENTION)
+	JobRetention time.Duration
+	// JobMaxAttempts is how many runs a failed job gets before it is
+	// dead-lettered (JOB_MAX_ATTEMPTS)
+	JobMaxAttempts int
+	// JobRetryBackoff is the delay before a job's second attempt, doubling
+	// after each further failure (JOB_RETRY_BACKOFF)
+	JobRetryBackoff time.Duration
+	// JobRetryMaxBackoff caps the delay between attempts
+	// (JOB_RETRY_MAX_BACKOFF)
+	JobRetryMaxBackoff time.Duration
+	// JobRetryJitter is the fraction of each delay taken off at random,
+	// 0-1 (JOB_RETRY_JITTER)
+	JobRetryJitter float64
+	// JobStuckAfter flags running jobs without a heartbeat for this long
+	// as stuck; zero disables the check (JOB_STUCK_AFTER)
+	JobStuckAfter time.Duration
+	// JobLockBackend coordinates exclusive scheduled jobs across
+	// replicas: none or redis (JOB_LOCK_BACKEND)
+	JobLockBackend string
+	// JobLockTTL is how long an exclusive job's lock outlives its last
+	// renewal (JOB_LOCK_TTL)
+	JobLockTTL time.Duration
+	// JobsAPI serves the job management endpoints under /jobs on the
+	// admin listener (JOBS_API)
+	JobsAPI bool
+	// FilesMaxUploadBytes caps the size of a file uploaded to /files/csv
+	// (FILES_MAX_UPLOAD_BYTES)
+	FilesMaxUploadBytes int
+	// FilesTimeout replaces the server's read and write deadlines for
+	// /files/csv and /files/convert, so large uploads are not cut off
+	// (FILES_TIMEOUT)
+	FilesTimeout time.Duration
+	// FilesWorkers is how many goroutines validate and handle the rows of
+	// each processed file (FILES_WORKERS)
+	FilesWorkers int
+	// FilesChunkRows is how many rows are handed to a worker at once;
+	// memory per file stays around (2*FILES_WORKERS+1) chunks
+	// (FILES_CHUNK_ROWS)
+	FilesChunkRows int
+	// FilesSchemaDir holds the column schemas uploads can be checked
+	// against, one <name>.json each (FILES_SCHEMA_DIR)
+	FilesSchemaDir string
+	// FilesRejectsDir keeps the invalid rows of schema-checked uploads
+	// (FILES_REJECTS_DIR)
+	FilesRejectsDir string
+	// FileWatchDir is a directory whose new CSV and TSV files are
+	// ingested in the background; empty disables (FILE_WATCH_DIR)
+	FileWatchDir string
+	// FileWatchInterval is how often the directory is scanned
+	// (FILE_WATCH_INTERVAL)
+	FileWatchInterval time.Duration
+	// FileWatchSchema names the schema of FilesSchemaDir that ingested
+	// files are checked against (FILE_WATCH_SCHEMA)
+	FileWatchSchema string
+	// FileWatchCompress compresses the plain files moved to done/:
+	// none, gzip or zstd (FILE_WATCH_COMPRESS)
+	FileWatchCompress string
+	// FileUploadBucket receives a copy of every file the watcher moves to
+	// done/ or error/; empty disables (FILE_UPLOAD_BUCKET)
+	FileUploadBucket string
+	// FileUploadEndpoint is the S3 API the bucket is reached through,
+	// e.g. https://storage.googleapis.com for GCS (FILE_UPLOAD_ENDPOINT)
+	FileUploadEndpoint string
+	// FileUploadRegion signs the uploads (FILE_UPLOAD_REGION)
+	FileUploadRegion string
+	// FileUploadPrefix is prepended to the uploaded keys
+	// (FILE_UPLOAD_PREFIX)
+	FileUploadPrefix string
+	// FileUploadPartSize splits larger files into a multipart upload,
+	// at least 5 MiB (FILE_UPLOAD_PART_SIZE)
+	FileUploadPartSize int
+	// FileUploadAccessKeyID, FileUploadSecretAccessKey and
+	// FileUploadSessionToken are the bucket's credentials, falling back
+	// to the AWS_* variables (FILE_UPLOAD_ACCESS_KEY_ID,
+	// FILE_UPLOAD_SECRET_ACCESS_KEY, FILE_UPLOAD_SESSION_TOKEN or their
+	// _FILE variants)
+	FileUploadAccessKeyID     string
+	FileUploadSecretAccessKey string
+	FileUploadSessionToken    string
+
+	// TraceExporter sends sampled spans to a collector: otlp, zipkin or
+	// jaeger (TRACE_EXPORTER)
+	TraceExporter string
+	// TraceEndpoint is the collector URL; each exporter has a local
+	// default (TRACE_ENDPOINT)
+	TraceEndpoint string
+	// TraceSampler picks the traces to record, e.g. parent:ratio:0.1
+	// (TRACE_SAMPLER)
+	TraceSampler string
+	// TraceSampleRoutes overrides the sampler per route, e.g.
+	// /ping=ratio:0.01,/debug/=always (TRACE_SAMPLE_ROUTES)
+	TraceSampleRoutes []string
+
+	// MetricsMode selects how metrics leave the process: "prometheus"
+	// serves /metrics, "otlp" pushes to an OTLP collector, "both" does
+	// both (METRICS_MODE)
+	MetricsMode string
+	// OTLPMetricsEndpoint is the OTLP/HTTP metrics URL
+	// (OTLP_METRICS_ENDPOINT)
+	OTLPMetricsEndpoint string
+	// OTLPMetricsHeaders are name=value headers sent with every OTLP
+	// metrics export, e.g. an API key (OTLP_METRICS_HEADERS or
+	// OTLP_METRICS_HEADERS_FILE, comma-separated)
+	OTLPMetricsHeaders []string
+	// MetricsPushgatewayURL, when set, pushes metrics to a Prometheus
+	// Pushgateway (METRICS_PUSHGATEWAY_URL)
+	MetricsPushgatewayURL string
+	// MetricsRemoteWriteURL, when set, sends metrics to a Prometheus
+	// remote-write endpoint (METRICS_REMOTE_WRITE_URL)
+	MetricsRemoteWriteURL string
+	// MetricsStatsDAddr, when set, sends metrics to a StatsD agent at this
+	// UDP host:port (METRICS_STATSD_ADDR)
+	MetricsStatsDAddr string
+	// MetricsStatsDFlavor is "dogstatsd", sending labels as tags, or
+	// "statsd", appending label values to names (METRICS_STATSD_FLAVOR)
+	MetricsStatsDFlavor string
+	// MetricsStatsDPrefix is prepended to StatsD metric names
+	// (METRICS_STATSD_PREFIX)
+	MetricsStatsDPrefix string
+	// MetricsStatsDTags are name:value DogStatsD tags added to every metric
+	// (METRICS_STATSD_TAGS)
+	MetricsStatsDTags []string
+	// MetricsGraphiteAddr, when set, sends metrics to a Carbon plaintext
+	// receiver at this TCP host:port (METRICS_GRAPHITE_ADDR)
+	MetricsGraphiteAddr string
+	// MetricsGraphitePrefix is prepended to Graphite metric paths, e.g.
+	// services.ping. (METRICS_GRAPHITE_PREFIX)
+	MetricsGraphitePrefix string
+	// MetricsGraphiteTagged sends labels as Graphite tags instead of path
+	// segments (METRICS_GRAPHITE_TAGGED)
+	MetricsGraphiteTagged bool
+	// MetricsEMFNamespace, when set, writes metrics to stdout as CloudWatch
+	// Embedded Metric Format lines in this namespace (METRICS_EMF_NAMESPACE)
+	MetricsEMFNamespace string
+	// MetricsEMFMetrics lists the metric families written as EMF; defaults
+	// to the request rate, latency, error and concurrency metrics
+	// (METRICS_EMF_METRICS)
+	MetricsEMFMetrics []string
+	// MetricsPushInterval is how often pushed metrics are exported
+	// (METRICS_PUSH_INTERVAL)
+	MetricsPushInterval time.Duration
+	// MetricsRouteTemplates are route labels for paths under subtree
+	// handlers, e.g. /targets/{id} (METRICS_ROUTE_TEMPLATES)
+	MetricsRouteTemplates []string
+	// MetricsMaxRoutes bounds the route labels derived from raw paths;
+	// further paths are labeled "other" (METRICS_MAX_ROUTES)
+	MetricsMaxRoutes int
+	// MetricsMaxSeries caps the label combinations of each request metric;
+	// further samples go to an overflow series labeled "other", and 0
+	// disables the cap (METRICS_MAX_SERIES)
+	MetricsMaxSeries int
+	// MetricsNamespace prefixes every metric name, e.g. pingsvc gives
+	// pingsvc_http_requests_total (METRICS_NAMESPACE)
+	MetricsNamespace string
+	// MetricsSubsystem is added after the namespace (METRICS_SUBSYSTEM)
+	MetricsSubsystem string
+	// MetricsConstLabels are name=value labels added to every metric, e.g.
+	// service=ping,environment=prod,region=eu (METRICS_CONST_LABELS)
+	MetricsConstLabels []string
+	// MetricsSummaries lists duration metrics exposed as summaries, each
+	// optionally with quantile objectives, e.g.
+	// http_request_duration_seconds=0.5:0.05|0.99:0.001 (METRICS_SUMMARIES)
+	MetricsSummaries []string
+	// MetricsRuntimeCollectors exports the go_* and process_* runtime
+	// metrics (METRICS_RUNTIME_COLLECTORS)
+	MetricsRuntimeCollectors bool
+	// MetricsCreatedTimestamps adds _created samples to counters,
+	// histograms and summaries in the OpenMetrics exposition
+	// (METRICS_CREATED_TIMESTAMPS)
+	MetricsCreatedTimestamps bool
+
+	// RedisAddr is the host:port of the Redis server used by shared
+	// features (REDIS_ADDR)
+	RedisAddr string
+	// RedisPassword authenticates to Redis (REDIS_PASSWORD or
+	// REDIS_PASSWORD_FILE)
+	RedisPassword string
+	// RedisDB selects the Redis database (REDIS_DB)
+	RedisDB int
+
+	// RuntimeAutoMaxProcs sets GOMAXPROCS from the container's CPU quota
+	// unless GOMAXPROCS is set (RUNTIME_AUTO_MAXPROCS)
+	RuntimeAutoMaxProcs bool
+	// RuntimeMemoryLimitRatio sets the Go soft memory limit to this
+	// fraction of the container's memory limit unless GOMEMLIMIT is set;
+	// 0 sets none (RUNTIME_MEMORY_LIMIT_RATIO)
+	RuntimeMemoryLimitRatio float64
+	// RuntimeMemoryLimitMB sets the Go soft memory limit in MiB, over
+	// GOMEMLIMIT and the ratio; 0 leaves them to decide
+	// (RUNTIME_MEMORY_LIMIT_MB)
+	RuntimeMemoryLimitMB int
+	// RuntimeGCPercent sets GOGC over the environment; 0 keeps GOGC or the
+	// default of 100, -1 collects only at the memory limit
+	// (RUNTIME_GC_PERCENT)
+	RuntimeGCPercent int
+	// RuntimeMemoryBallastMB allocates a heap ballast of this many MiB at
+	// startup so small heaps collect less often (RUNTIME_MEMORY_BALLAST_MB)
+	RuntimeMemoryBallastMB int
+}
+
+// defaultTraceEndpoints are the collectors' standard local HTTP endpoints.
+var defaultTraceEndpoints = map[string]string{
+	"otlp":   "http://localhost:4318/v1/traces",
+	"zipkin": "http://localhost:9411/api/v2/spans",
+	"jaeger": "http://localhost:14268/api/traces",
+}
+
+// metricNamePart matches a valid Prometheus namespace or subsystem.
+var metricNamePart = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Load reads the configuration from the environment, applying defaults for
+// unset variables. It returns an error naming the first malformed variable.
+func Load() (*Config, error) {
+	cfg := &Config{
+		Port:                    getString("PORT", "8080"),
+		AdminPort:               os.Getenv("ADMIN_PORT"),
+		ServiceName:             getString("SERVICE_NAME", "ping"),
+		Version:                 getString("SERVICE_VERSION", "1.0.0"),
+		Environment:             os.Getenv("ENVIRONMENT"),
+		PodName:                 os.Getenv("POD_NAME"),
+		InstanceID:              os.Getenv("INSTANCE_ID"),
+		RequestIDScheme:         getString("REQUEST_ID_SCHEME", "uuid4"),
+		RequestIDPrefix:         os.Getenv("REQUEST_ID_PREFIX"),
+		LogFormat:               getString("LOG_FORMAT", "text"),
+		LogBufferSize:           1024,
+		LogTailThreshold:        500 * time.Millisecond,
+		LogMaxUserAgent:         256,
+		SlowRequestThreshold:    time.Second,
+		DebugCaptureHeader:      getString("DEBUG_CAPTURE_HEADER", "X-Debug-Capture"),
+		DebugCaptureMaxBytes:    4096,
+		RecentRequests:          100,
+		HealthChecks:            getList("HEALTH_CHECKS"),
+		HealthChecksNonCritical: getList("HEALTH_CHECKS_NON_CRITICAL"),
+
+		ConcurrencyQueueTimeout: 100 * time.Millisecond,
+		RetryAfter:              time.Second,
+
+		RateLimitBurst:      20,
+		RateLimitMaxClients: 10000,
+		RateLimitBackend:    getString("RATE_LIMIT_BACKEND", "local"),
+
+		CORSAllowedOrigins: getList("CORS_ALLOWED_ORIGINS"),
+		CORSAllowedMethods: getListDefault("CORS_ALLOWED_METHODS", []string{"GET", "HEAD", "POST"}),
+		CORSAllowedHeaders: getListDefault("CORS_ALLOWED_HEADERS", []string{"Content-Type", "Authorization", "X-Request-ID", "X-Correlation-ID"}),
+		CORSExposedHeaders: getListDefault("CORS_EXPOSED_HEADERS", []string{"X-Correlation-ID", "X-Hop-ID"}),
+		CORSMaxAge:         10 * time.Minute,
+
+		HSTSMaxAge:                 365 * 24 * time.Hour,
+		FrameOptions:               getString("FRAME_OPTIONS", "DENY"),
+		ReferrerPolicy:             getString("REFERRER_POLICY", "strict-origin-when-cross-origin"),
+		ContentSecurityPolicy:      getString("CONTENT_SECURITY_POLICY", "default-src 'self'; frame-ancestors 'none'"),
+		SecurityHeadersExemptPaths: getList("SECURITY_HEADERS_EXEMPT_PATHS"),
+
+		CompressionMinSize:       1024,
+		MaxDecompressedBodyBytes: 10 << 20,
+
+		JWTJWKSURL:          os.Getenv("JWT_JWKS_URL"),
+		JWTIssuer:           os.Getenv("JWT_ISSUER"),
+		JWTAudience:         os.Getenv("JWT_AUDIENCE"),
+		JWTLeeway:           30 * time.Second,
+		JWKSRefreshInterval: time.Hour,
+		JWTExemptPaths:      getListDefault("JWT_EXEMPT_PATHS", []string{"/health", "/livez", "/readyz", "/startupz", "/metrics", "/auth/login", "/auth/callback", "/auth/logout"}),
+
+		OIDCIssuerURL:     os.Getenv("OIDC_ISSUER_URL"),
+		OIDCClientID:      os.Getenv("OIDC_CLIENT_ID"),
+		OIDCRedirectURL:   os.Getenv("OIDC_REDIRECT_URL"),
+		OIDCScopes:        getListDefault("OIDC_SCOPES", []string{"openid", "profile", "email"}),
+		OIDCGroupsClaim:   getString("OIDC_GROUPS_CLAIM", "groups"),
+		OIDCAllowedGroups: getList("OIDC_ALLOWED_GROUPS"),
+		OIDCSessionTTL:    8 * time.Hour,
+
+		TLSCertFile:     os.Getenv("TLS_CERT_FILE"),
+		TLSKeyFile:      os.Getenv("TLS_KEY_FILE"),
+		TLSClientCAFile: os.Getenv("TLS_CLIENT_CA_FILE"),
+		TLSClientAuth:   os.Getenv("TLS_CLIENT_AUTH"),
+
+		TrustedProxies: getList("TRUSTED_PROXIES"),
+
+		MirrorURL:          os.Getenv("MIRROR_URL"),
+		MirrorTimeout:      2 * time.Second,
+		MirrorMaxBodyBytes: 64 << 10,
+
+		CacheRoutes:        getList("CACHE_ROUTES"),
+		CacheTTL:           10 * time.Second,
+		CacheMaxEntries:    1000,
+		CacheVaryHeaders:   getList("CACHE_VARY_HEADERS"),
+		CachePurgeSchedule: getString("CACHE_PURGE_SCHEDULE", "@every 1m"),
+		JobStoreDir:        os.Getenv("JOB_STORE_DIR"),
+		JobLockBackend:     getString("JOB_LOCK_BACKEND", "none"),
+
+		TraceExporter:     os.Getenv("TRACE_EXPORTER"),
+		TraceEndpoint:     os.Getenv("TRACE_ENDPOINT"),
+		TraceSampler:      getString("TRACE_SAMPLER", "parent:always"),
+		TraceSampleRoutes: getList("TRACE_SAMPLE_ROUTES"),
+
+		MetricsMode:           getString("METRICS_MODE", "prometheus"),
+		OTLPMetricsEndpoint:   getString("OTLP_METRICS_ENDPOINT", "http://localhost:4318/v1/metrics"),
+		MetricsPushgatewayURL: os.Getenv("METRICS_PUSHGATEWAY_URL"),
+		MetricsRemoteWriteURL: os.Getenv("METRICS_REMOTE_WRITE_URL"),
+		MetricsStatsDAddr:     os.Getenv("METRICS_STATSD_ADDR"),
+		MetricsStatsDFlavor:   getString("METRICS_STATSD_FLAVOR", "dogstatsd"),
+		MetricsStatsDPrefix:   os.Getenv("METRICS_STATSD_PREFIX"),
+		MetricsStatsDTags:     getList("METRICS_STATSD_TAGS"),
+		MetricsGraphiteAddr:   os.Getenv("METRICS_GRAPHITE_ADDR"),
+		MetricsGraphitePrefix: os.Getenv("METRICS_GRAPHITE_PREFIX"),
+		MetricsEMFNamespace:   os.Getenv("METRICS_EMF_NAMESPACE"),
+		MetricsEMFMetrics:     getList("METRICS_EMF_METRICS"),
+		MetricsPushInterval:   15 * time.Second,
+		MetricsRouteTemplates: getList("METRICS_ROUTE_TEMPLATES"),
+		MetricsMaxRoutes:      100,
+		MetricsMaxSeries:      1000,
+		MetricsSummaries:      getList("METRICS_SUMMARIES"),
+		MetricsNamespace:      os.Getenv("METRICS_NAMESPACE"),
+		MetricsSubsystem:      os.Getenv("METRICS_SUBSYSTEM"),
+		MetricsConstLabels:    getList("METRICS_CONST_LABELS"),
+
+		RedisAddr: os.Getenv("REDIS_ADDR"),
+	}
+
+	switch cfg.RequestIDScheme {
+	case "uuid4", "uuid7", "ulid", "ksuid", "short":
+	default:
+		return nil, fmt.Errorf("REQUEST_ID_SCHEME must be uuid4, uuid7, ulid, ksuid or short, got %q", cfg.RequestIDScheme)
+	}
+	if cfg.RequestIDPrefix == "" {
+		cfg.RequestIDPrefix = cfg.ServiceName
+	}
+	if cfg.LogFormat != "text" && cfg.LogFormat != "json" {
+		return nil, fmt.Errorf("LOG_FORMAT must be text or json, got %q", cfg.LogFormat)
+	}
+
+	var err error
+	if cfg.LogAsync, err = getBool("LOG_ASYNC", false); err != nil {
+		return nil, err
+	}
+	if cfg.LogBufferSize, err = getInt("LOG_BUFFER_SIZE", cfg.LogBufferSize); err != nil {
+		return nil, err
+	}
+	if cfg.LogBufferSize <= 0 {
+		return nil, fmt.Errorf("LOG_BUFFER_SIZE must be positive, got %d", cfg.LogBufferSize)
+	}
+	if cfg.LogTail, err = getBool("LOG_TAIL", false); err != nil {
+		return nil, err
+	}
+	if cfg.LogTailThreshold, err = getDuration("LOG_TAIL_THRESHOLD", cfg.LogTailThreshold); err != nil {
+		return nil, err
+	}
+	cfg.LogRedactQueryParams = getList("LOG_REDACT_QUERY_PARAMS")
+	cfg.LogRedactHeaders = getList("LOG_REDACT_HEADERS")
+	if cfg.LogMaxUserAgent, err = getInt("LOG_MAX_USER_AGENT", cfg.LogMaxUserAgent); err != nil {
+		return nil, err
+	}
+	if cfg.LogMaxUserAgent < 0 {
+		return nil, fmt.Errorf("LOG_MAX_USER_AGENT must not be negative, got %d", cfg.LogMaxUserAgent)
+	}
+	if cfg.SlowRequestThreshold, err = getDuration("SLOW_REQUEST_THRESHOLD", cfg.SlowRequestThreshold); err != nil {
+		return nil, err
+	}
+	cfg.DebugCaptureRoutes = getList("DEBUG_CAPTURE_ROUTES")
+	if cfg.DebugCaptureMaxBytes, err = getInt("DEBUG_CAPTURE_MAX_BYTES", cfg.DebugCaptureMaxBytes); err != nil {
+		return nil, err
+	}
+	if cfg.DebugCaptureMaxBytes <= 0 {
+		return nil, fmt.Errorf("DEBUG_CAPTURE_MAX_BYTES must be positive, got %d", cfg.DebugCaptureMaxBytes)
+	}
+	if cfg.RecentRequests, err = getInt("DEBUG_RECENT_REQUESTS", cfg.RecentRequests); err != nil {
+		return nil, err
+	}
+	if cfg.RecentRequests < 0 {
+		return nil, fmt.Errorf("DEBUG_RECENT_REQUESTS must not be negative, got %d", cfg.RecentRequests)
+	}
+	if cfg.ShutdownDrainDelay, err = getDuration("SHUTDOWN_DRAIN_DELAY", 0); err != nil {
+		return nil, err
+	}
+	if cfg.ShutdownDrainDelay < 0 {
+		return nil, fmt.Errorf("SHUTDOWN_DRAIN_DELAY must not be negative, got %s", cfg.ShutdownDrainDelay)
+	}
+	if cfg.HealthDiskMinFreeMB, err = getInt("HEALTH_DISK_MIN_FREE_MB", 100); err != nil {
+		return nil, err
+	}
+	if cfg.HealthDiskMinFreeMB < 0 {
+		return nil, fmt.Errorf("HEALTH_DISK_MIN_FREE_MB must not be negative, got %d", cfg.HealthDiskMinFreeMB)
+	}
+	if cfg.HealthCheckTimeout, err = getDuration("HEALTH_CHECK_TIMEOUT", 5*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.HealthCheckTimeout <= 0 {
+		return nil, fmt.Errorf("HEALTH_CHECK_TIMEOUT must be positive, got %s", cfg.HealthCheckTimeout)
+	}
+	if cfg.HealthCheckHedgeDelay, err = getDuration("HEALTH_CHECK_HEDGE_DELAY", 0); err != nil {
+		return nil, err
+	}
+	if cfg.HealthCheckHedgeDelay < 0 || (cfg.HealthCheckHedgeDelay > 0 && cfg.HealthCheckHedgeDelay >= cfg.HealthCheckTimeout) {
+		return nil, fmt.Errorf("HEALTH_CHECK_HEDGE_DELAY must be between 0 and HEALTH_CHECK_TIMEOUT, got %s", cfg.HealthCheckHedgeDelay)
+	}
+	if cfg.HealthCacheTTL, err = getDuration("HEALTH_CACHE_TTL", time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.HealthCacheTTL < 0 {
+		return nil, fmt.Errorf("HEALTH_CACHE_TTL must not be negative, got %s", cfg.HealthCacheTTL)
+	}
+	if cfg.StatsWindow, err = getDuration("STATS_WINDOW", time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.StatsWindow < 0 {
+		return nil, fmt.Errorf("STATS_WINDOW must not be negative, got %s", cfg.StatsWindow)
+	}
+	if cfg.JobWorkers, err = getInt("JOB_WORKERS", 4); err != nil {
+		return nil, err
+	}
+	if cfg.JobWorkers <= 0 {
+		return nil, fmt.Errorf("JOB_WORKERS must be positive, got %d", cfg.JobWorkers)
+	}
+	if cfg.JobQueueSize, err = getInt("JOB_QUEUE_SIZE", 100); err != nil {
+		return nil, err
+	}
+	if cfg.JobQueueSize <= 0 {
+		return nil, fmt.Errorf("JOB_QUEUE_SIZE must be positive, got %d", cfg.JobQueueSize)
+	}
+	if cfg.JobRetention, err = getDuration("JOB_RETENTION", 24*time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.JobRetention <= 0 {
+		return nil, fmt.Errorf("JOB_RETENTION must be positive, got %s", cfg.JobRetention)
+	}
+	if cfg.JobMaxAttempts, err = getInt("JOB_MAX_ATTEMPTS", 3); err != nil {
+		return nil, err
+	}
+	if cfg.JobMaxAttempts <= 0 {
+		return nil, fmt.Errorf("JOB_MAX_ATTEMPTS must be positive, got %d", cfg.JobMaxAttempts)
+	}
+	if cfg.JobRetryBackoff, err = getDuration("JOB_RETRY_BACKOFF", time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.JobRetryBackoff < 0 {
+		return nil, fmt.Errorf("JOB_RETRY_BACKOFF must not be negative, got %s", cfg.JobRetryBackoff)
+	}
+	if cfg.JobRetryMaxBackoff, err = getDuration("JOB_RETRY_MAX_BACKOFF", time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.JobRetryMaxBackoff < cfg.JobRetryBackoff {
+		return nil, fmt.Errorf("JOB_RETRY_MAX_BACKOFF must be at least JOB_RETRY_BACKOFF, got %s", cfg.JobRetryMaxBackoff)
+	}
+	if cfg.JobRetryJitter, err = getFloat("JOB_RETRY_JITTER", 0.2); err != nil {
+		return nil, err
+	}
+	if cfg.JobRetryJitter < 0 || cfg.JobRetryJitter > 1 {
+		return nil, fmt.Errorf("JOB_RETRY_JITTER must be between 0 and 1, got %g", cfg.JobRetryJitter)
+	}
+	if cfg.JobStuckAfter, err = getDuration("JOB_STUCK_AFTER", 5*time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.JobStuckAfter < 0 {
+		return nil, fmt.Errorf("JOB_STUCK_AFTER must not be negative, got %s", cfg.JobStuckAfter)
+	}
+	switch cfg.JobLockBackend {
+	case "none":
+	case "redis":
+		if cfg.RedisAddr == "" {
+			return nil, fmt.Errorf("JOB_LOCK_BACKEND=redis requires REDIS_ADDR")
+		}
+	default:
+		return nil, fmt.Errorf("JOB_LOCK_BACKEND must be none or redis, got %q", cfg.JobLockBackend)
+	}
+	if cfg.JobLockTTL, err = getDuration("JOB_LOCK_TTL", 30*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.JobLockTTL <= 0 {
+		return nil, fmt.Errorf("JOB_LOCK_TTL must be positive, got %s", cfg.JobLockTTL)
+	}
+	if cfg.JobsAPI, err = getBool("JOBS_API", false); err != nil {
+		return nil, err
+	}
+	if cfg.FilesMaxUploadBytes, err = getInt("FILES_MAX_UPLOAD_BYTES", 100<<20); err != nil {
+		return nil, err
+	}
+	if cfg.FilesMaxUploadBytes <= 0 {
+		return nil, fmt.Errorf("FILES_MAX_UPLOAD_BYTES must be positive, got %d", cfg.FilesMaxUploadBytes)
+	}
+	if cfg.FilesTimeout, err = getDuration("FILES_TIMEOUT", time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.FilesTimeout <= 0 {
+		return nil, fmt.Errorf("FILES_TIMEOUT must be positive, got %s", cfg.FilesTimeout)
+	}
+	if cfg.FilesWorkers, err = getInt("FILES_WORKERS", 4); err != nil {
+		return nil, err
+	}
+	if cfg.FilesWorkers <= 0 {
+		return nil, fmt.Errorf("FILES_WORKERS must be positive, got %d", cfg.FilesWorkers)
+	}
+	if cfg.FilesChunkRows, err = getInt("FILES_CHUNK_ROWS", 1000); err != nil {
+		return nil, err
+	}
+	if cfg.FilesChunkRows <= 0 {
+		return nil, fmt.Errorf("FILES_CHUNK_ROWS must be positive, got %d", cfg.FilesChunkRows)
+	}
+	cfg.FilesSchemaDir = getString("FILES_SCHEMA_DIR", "")
+	cfg.FilesRejectsDir = getString("FILES_REJECTS_DIR", "")
+	cfg.FileWatchDir = getString("FILE_WATCH_DIR", "")
+	cfg.FileWatchSchema = getString("FILE_WATCH_SCHEMA", "")
+	if cfg.FileWatchSchema != "" && cfg.FilesSchemaDir == "" {
+		return nil, fmt.Errorf("FILE_WATCH_SCHEMA requires FILES_SCHEMA_DIR")
+	}
+	if cfg.FileWatchInterval, err = getDuration("FILE_WATCH_INTERVAL", 5*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.FileWatchInterval <= 0 {
+		return nil, fmt.Errorf("FILE_WATCH_INTERVAL must be positive, got %s", cfg.FileWatchInterval)
+	}
+	cfg.FileWatchCompress = strings.ToLower(getString("FILE_WATCH_COMPRESS", "none"))
+	switch cfg.FileWatchCompress {
+	case "none", "gzip", "zstd":
+	default:
+		return nil, fmt.Errorf("FILE_WATCH_COMPRESS must be none, gzip or zstd, got %q", cfg.FileWatchCompress)
+	}
+	cfg.FileUploadBucket = getString("FILE_UPLOAD_BUCKET", "")
+	cfg.FileUploadEndpoint = getString("FILE_UPLOAD_ENDPOINT", "https://s3.amazonaws.com")
+	cfg.FileUploadRegion = getString("FILE_UPLOAD_REGION", getString("AWS_REGION", "us-east-1"))
+	cfg.FileUploadPrefix = getString("FILE_UPLOAD_PREFIX", "")
+	if cfg.FileUploadPartSize, err = getInt("FILE_UPLOAD_PART_SIZE", 16<<20); err != nil {
+		return nil, err
+	}
+	if cfg.FileUploadPartSize < 5<<20 {
+		return nil, fmt.Errorf("FILE_UPLOAD_PART_SIZE must be at least 5 MiB, got %d", cfg.FileUploadPartSize)
+	}
+	for _, secret := range []struct {
+		key, fallback string
+		value         *string
+	}{
+		{"FILE_UPLOAD_ACCESS_KEY_ID", "AWS_ACCESS_KEY_ID", &cfg.FileUploadAccessKeyID},
+		{"FILE_UPLOAD_SECRET_ACCESS_KEY", "AWS_SECRET_ACCESS_KEY", &cfg.FileUploadSecretAccessKey},
+		{"FILE_UPLOAD_SESSION_TOKEN", "AWS_SESSION_TOKEN", &cfg.FileUploadSessionToken},
+	} {
+		if *secret.value, err = getSecret(secret.key); err != nil {
+			return nil, err
+		}
+		if *secret.value == "" {
+			*secret.value = os.Getenv(secret.fallback)
+		}
+	}
+	if cfg.FileUploadBucket != "" {
+		if cfg.FileWatchDir == "" {
+			return nil, fmt.Errorf("FILE_UPLOAD_BUCKET requires FILE_WATCH_DIR")
+		}
+		if cfg.FileUploadAccessKeyID == "" || cfg.FileUploadSecretAccessKey == "" {
+			return nil, fmt.Errorf("FILE_UPLOAD_BUCKET requires FILE_UPLOAD_ACCESS_KEY_ID and FILE_UPLOAD_SECRET_ACCESS_KEY")
+		}
+	}
+	if cfg.MaxInFlight, err = getInt("MAX_IN_FLIGHT", 0); err != nil {
+		return nil, err
+	}
+	if cfg.MaxInFlight < 0 {
+		return nil, fmt.Errorf("MAX_IN_FLIGHT must not be negative, got %d", cfg.MaxInFlight)
+	}
+	if cfg.ConcurrencyQueueTimeout, err = getDuration("CONCURRENCY_QUEUE_TIMEOUT", cfg.ConcurrencyQueueTimeout); err != nil {
+		return nil, err
+	}
+	if cfg.RetryAfter, err = getDuration("RETRY_AFTER", cfg.RetryAfter); err != nil {
+		return nil, err
+	}
+	if cfg.ShedQueueWaitTarget, err = getDuration("SHED_QUEUE_WAIT_TARGET", 0); err != nil {
+		return nil, err
+	}
+	cfg.ShedLowPriorityPaths = getList("SHED_LOW_PRIORITY_PATHS")
+	cfg.ShedCriticalPaths = getList("SHED_CRITICAL_PATHS")
+	if cfg.RateLimitRPS, err = getFloat("RATE_LIMIT_RPS", 0); err != nil {
+		return nil, err
+	}
+	if cfg.RateLimitRPS < 0 {
+		return nil, fmt.Errorf("RATE_LIMIT_RPS must not be negative, got %g", cfg.RateLimitRPS)
+	}
+	if cfg.RateLimitBurst, err = getInt("RATE_LIMIT_BURST", cfg.RateLimitBurst); err != nil {
+		return nil, err
+	}
+	if cfg.RateLimitBurst <= 0 {
+		return nil, fmt.Errorf("RATE_LIMIT_BURST must be positive, got %d", cfg.RateLimitBurst)
+	}
+	if cfg.RateLimitMaxClients, err = getInt("RATE_LIMIT_MAX_CLIENTS", cfg.RateLimitMaxClients); err != nil {
+		return nil, err
+	}
+	if cfg.RateLimitMaxClients <= 0 {
+		return nil, fmt.Errorf("RATE_LIMIT_MAX_CLIENTS must be positive, got %d", cfg.RateLimitMaxClients)
+	}
+	switch cfg.RateLimitBackend {
+	case "local":
+	case "redis":
+		if cfg.RedisAddr == "" {
+			return nil, fmt.Errorf("RATE_LIMIT_BACKEND=redis requires REDIS_ADDR")
+		}
+	default:
+		return nil, fmt.Errorf("RATE_LIMIT_BACKEND must be local or redis, got %q", cfg.RateLimitBackend)
+	}
+	if cfg.RateLimitHeaders, err = getBool("RATE_LIMIT_HEADERS", true); err != nil {
+		return nil, err
+	}
+	if cfg.CORSAllowCredentials, err = getBool("CORS_ALLOW_CREDENTIALS", false); err != nil {
+		return nil, err
+	}
+	if cfg.CORSAllowCredentials {
+		for _, origin := range cfg.CORSAllowedOrigins {
+			if origin == "*" {
+				return nil, fmt.Errorf("CORS_ALLOWED_ORIGINS=* cannot be combined with CORS_ALLOW_CREDENTIALS=true; list the trusted origins instead")
+			}
+		}
+	}
+	if cfg.CORSMaxAge, err = getDuration("CORS_MAX_AGE", cfg.CORSMaxAge); err != nil {
+		return nil, err
+	}
+	if cfg.SecurityHeaders, err = getBool("SECURITY_HEADERS", true); err != nil {
+		return nil, err
+	}
+	if cfg.HSTSMaxAge, err = getDuration("HSTS_MAX_AGE", cfg.HSTSMaxAge); err != nil {
+		return nil, err
+	}
+	if cfg.Compression, err = getBool("COMPRESSION", true); err != nil {
+		return nil, err
+	}
+	if cfg.CompressionMinSize, err = getInt("COMPRESSION_MIN_SIZE", cfg.CompressionMinSize); err != nil {
+		return nil, err
+	}
+	if cfg.CompressionMinSize < 0 {
+		return nil, fmt.Errorf("COMPRESSION_MIN_SIZE must not be negative, got %d", cfg.CompressionMinSize)
+	}
+	if cfg.MaxDecompressedBodyBytes, err = getInt("MAX_DECOMPRESSED_BODY_BYTES", cfg.MaxDecompressedBodyBytes); err != nil {
+		return nil, err
+	}
+	if cfg.MaxDecompressedBodyBytes <= 0 {
+		return nil, fmt.Errorf("MAX_DECOMPRESSED_BODY_BYTES must be positive, got %d", cfg.MaxDecompressedBodyBytes)
+	}
+	if cfg.JWTLeeway, err = getDuration("JWT_LEEWAY", cfg.JWTLeeway); err != nil {
+		return nil, err
+	}
+	if cfg.JWKSRefreshInterval, err = getDuration("JWT_JWKS_REFRESH_INTERVAL", cfg.JWKSRefreshInterval); err != nil {
+		return nil, err
+	}
+	// Secrets may come from mounted files instead of the environment
+	if cfg.DebugCaptureToken, err = getSecret("DEBUG_CAPTURE_TOKEN"); err != nil {
+		return nil, err
+	}
+	if cfg.AdminUsername, err = getSecret("ADMIN_USERNAME"); err != nil {
+		return nil, err
+	}
+	if cfg.AdminPassword, err = getSecret("ADMIN_PASSWORD"); err != nil {
+		return nil, err
+	}
+	if (cfg.AdminUsername == "") != (cfg.AdminPassword == "") {
+		return nil, fmt.Errorf("ADMIN_USERNAME and ADMIN_PASSWORD must be set together")
+	}
+	if cfg.OIDCClientSecret, err = getSecret("OIDC_CLIENT_SECRET"); err != nil {
+		return nil, err
+	}
+	if cfg.OIDCCookieSecret, err = getSecret("OIDC_COOKIE_SECRET"); err != nil {
+		return nil, err
+	}
+	if cfg.OIDCSessionTTL, err = getDuration("OIDC_SESSION_TTL", cfg.OIDCSessionTTL); err != nil {
+		return nil, err
+	}
+	if cfg.OIDCIssuerURL != "" {
+		if cfg.OIDCClientID == "" || cfg.OIDCRedirectURL == "" {
+			return nil, fmt.Errorf("OIDC_ISSUER_URL requires OIDC_CLIENT_ID and OIDC_REDIRECT_URL")
+		}
+		if len(cfg.OIDCCookieSecret) < 32 {
+			return nil, fmt.Errorf("OIDC_COOKIE_SECRET must be at least 32 bytes")
+		}
+	}
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return nil, fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if cfg.TLSClientCAFile != "" && cfg.TLSCertFile == "" {
+		return nil, fmt.Errorf("TLS_CLIENT_CA_FILE requires TLS_CERT_FILE and TLS_KEY_FILE")
+	}
+	if cfg.TLSClientAuth == "" {
+		cfg.TLSClientAuth = "none"
+		if cfg.TLSClientCAFile != "" {
+			cfg.TLSClientAuth = "verify_if_given"
+		}
+	}
+	switch cfg.TLSClientAuth {
+	case "none":
+	case "verify_if_given", "require":
+		if cfg.TLSClientCAFile == "" {
+			return nil, fmt.Errorf("TLS_CLIENT_AUTH=%s requires TLS_CLIENT_CA_FILE", cfg.TLSClientAuth)
+		}
+	default:
+		return nil, fmt.Errorf("TLS_CLIENT_AUTH must be none, verify_if_given or require, got %q", cfg.TLSClientAuth)
+	}
+	if cfg.ClientIdentityMetric, err = getBool("CLIENT_IDENTITY_METRIC", false); err != nil {
+		return nil, err
+	}
+	cfg.ProxyUpstreamURL = os.Getenv("PROXY_UPSTREAM_URL")
+	if cfg.ProxyUpstreamURL != "" {
+		if u, err := url.Parse(cfg.ProxyUpstreamURL); err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("PROXY_UPSTREAM_URL must be an absolute URL, got %q", cfg.ProxyUpstreamURL)
+		}
+	}
+	if cfg.ProxyTimeout, err = getDuration("PROXY_TIMEOUT", 30*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.ProxyTimeout <= 0 {
+		return nil, fmt.Errorf("PROXY_TIMEOUT must be positive, got %s", cfg.ProxyTimeout)
+	}
+	if cfg.MirrorURL != "" {
+		if u, err := url.Parse(cfg.MirrorURL); err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("MIRROR_URL must be an absolute URL, got %q", cfg.MirrorURL)
+		}
+	}
+	if cfg.OutboundTimeout, err = getDuration("OUTBOUND_TIMEOUT", 10*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.OutboundTimeout <= 0 {
+		return nil, fmt.Errorf("OUTBOUND_TIMEOUT must be positive, got %s", cfg.OutboundTimeout)
+	}
+	cfg.OutboundLogLevel = strings.ToLower(getString("OUTBOUND_LOG_LEVEL", "off"))
+	if cfg.OutboundLogLevel != "off" && cfg.OutboundLogLevel != "debug" && cfg.OutboundLogLevel != "info" {
+		return nil, fmt.Errorf("OUTBOUND_LOG_LEVEL must be off, debug or info, got %q", cfg.OutboundLogLevel)
+	}
+	if cfg.OutboundRetryMaxAttempts, err = getInt("OUTBOUND_RETRY_MAX_ATTEMPTS", 1); err != nil {
+		return nil, err
+	}
+	if cfg.OutboundRetryMaxAttempts < 1 {
+		return nil, fmt.Errorf("OUTBOUND_RETRY_MAX_ATTEMPTS must be at least 1, got %d", cfg.OutboundRetryMaxAttempts)
+	}
+	if cfg.OutboundRetryBackoff, err = getDuration("OUTBOUND_RETRY_BACKOFF", 100*time.Millisecond); err != nil {
+		return nil, err
+	}
+	if cfg.OutboundRetryMaxBackoff, err = getDuration("OUTBOUND_RETRY_MAX_BACKOFF", 5*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.OutboundRetryBackoff <= 0 || cfg.OutboundRetryMaxBackoff < cfg.OutboundRetryBackoff {
+		return nil, fmt.Errorf("OUTBOUND_RETRY_BACKOFF must be positive and at most OUTBOUND_RETRY_MAX_BACKOFF, got %s and %s", cfg.OutboundRetryBackoff, cfg.OutboundRetryMaxBackoff)
+	}
+	cfg.OutboundRetryMethods = getListDefault("OUTBOUND_RETRY_METHODS", []string{"GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE"})
+	for i, method := range cfg.OutboundRetryMethods {
+		cfg.OutboundRetryMethods[i] = strings.ToUpper(method)
+	}
+	cfg.OutboundRetryHosts = getList("OUTBOUND_RETRY_HOSTS")
+	if cfg.OutboundRetryBudget, err = getFloat("OUTBOUND_RETRY_BUDGET", 0.2); err != nil {
+		return nil, err
+	}
+	if cfg.OutboundRetryBudget < 0 || cfg.OutboundRetryBudget > 1 {
+		return nil, fmt.Errorf("OUTBOUND_RETRY_BUDGET must be between 0 and 1, got %g", cfg.OutboundRetryBudget)
+	}
+	if cfg.OutboundRetryBudgetBurst, err = getInt("OUTBOUND_RETRY_BUDGET_BURST", 10); err != nil {
+		return nil, err
+	}
+	if cfg.OutboundRetryBudgetBurst < 0 {
+		return nil, fmt.Errorf("OUTBOUND_RETRY_BUDGET_BURST must not be negative, got %d", cfg.OutboundRetryBudgetBurst)
+	}
+	if cfg.MirrorPercent, err = getFloat("MIRROR_PERCENT", 100); err != nil {
+		return nil, err
+	}
+	if cfg.MirrorPercent < 0 || cfg.MirrorPercent > 100 {
+		return nil, fmt.Errorf("MIRROR_PERCENT must be between 0 and 100, got %g", cfg.MirrorPercent)
+	}
+	if cfg.MirrorTimeout, err = getDuration("MIRROR_TIMEOUT", cfg.MirrorTimeout); err != nil {
+		return nil, err
+	}
+	if cfg.MirrorMaxBodyBytes, err = getInt("MIRROR_MAX_BODY_BYTES", cfg.MirrorMaxBodyBytes); err != nil {
+		return nil, err
+	}
+	if cfg.MirrorMaxBodyBytes <= 0 {
+		return nil, fmt.Errorf("MIRROR_MAX_BODY_BYTES must be positive, got %d", cfg.MirrorMaxBodyBytes)
+	}
+	if cfg.MirrorForwardCredentials, err = getBool("MIRROR_FORWARD_CREDENTIALS", false); err != nil {
+		return nil, err
+	}
+	if cfg.CacheTTL, err = getDuration("CACHE_TTL", cfg.CacheTTL); err != nil {
+		return nil, err
+	}
+	if cfg.CacheTTL == 0 {
+		return nil, fmt.Errorf("CACHE_TTL must be positive, got %s", cfg.CacheTTL)
+	}
+	if cfg.CacheMaxEntries, err = getInt("CACHE_MAX_ENTRIES", cfg.CacheMaxEntries); err != nil {
+		return nil, err
+	}
+	if cfg.CacheMaxEntries <= 0 {
+		return nil, fmt.Errorf("CACHE_MAX_ENTRIES must be positive, got %d", cfg.CacheMaxEntries)
+	}
+	switch cfg.TraceExporter {
+	case "":
+	case "otlp", "zipkin", "jaeger":
+		if cfg.TraceEndpoint == "" {
+			cfg.TraceEndpoint = defaultTraceEndpoints[cfg.TraceExporter]
+		}
+		if u, err := url.Parse(cfg.TraceEndpoint); err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("TRACE_ENDPOINT must be an absolute URL, got %q", cfg.TraceEndpoint)
+		}
+	default:
+		return nil, fmt.Errorf("TRACE_EXPORTER must be otlp, zipkin or jaeger, got %q", cfg.TraceExporter)
+	}
+	if cfg.MetricsMode != "prometheus" && cfg.MetricsMode != "otlp" && cfg.MetricsMode != "both" {
+		return nil, fmt.Errorf("METRICS_MODE must be prometheus, otlp or both, got %q", cfg.MetricsMode)
+	}
+	if u, err := url.Parse(cfg.OTLPMetricsEndpoint); err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("OTLP_METRICS_ENDPOINT must be an absolute URL, got %q", cfg.OTLPMetricsEndpoint)
+	}
+	for key, v := range map[string]string{"METRICS_PUSHGATEWAY_URL": cfg.MetricsPushgatewayURL, "METRICS_REMOTE_WRITE_URL": cfg.MetricsRemoteWriteURL} {
+		if v == "" {
+			continue
+		}
+		if u, err := url.Parse(v); err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("%s must be an absolute URL, got %q", key, v)
+		}
+	}
+	for key, v := range map[string]string{"METRICS_STATSD_ADDR": cfg.MetricsStatsDAddr, "METRICS_GRAPHITE_ADDR": cfg.MetricsGraphiteAddr} {
+		if v == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(v); err != nil {
+			return nil, fmt.Errorf("%s must be host:port, got %q", key, v)
+		}
+	}
+	if cfg.MetricsGraphiteTagged, err = getBool("METRICS_GRAPHITE_TAGGED", false); err != nil {
+		return nil, err
+	}
+	if cfg.MetricsStatsDFlavor != "statsd" && cfg.MetricsStatsDFlavor != "dogstatsd" {
+		return nil, fmt.Errorf("METRICS_STATSD_FLAVOR must be statsd or dogstatsd, got %q", cfg.MetricsStatsDFlavor)
+	}
+	for _, tag := range cfg.MetricsStatsDTags {
+		if name, _, ok := strings.Cut(tag, ":"); !ok || name == "" {
+			return nil, fmt.Errorf("METRICS_STATSD_TAGS entries must be name:value, got %q", tag)
+		}
+	}
+	if cfg.MetricsPushInterval, err = getDuration("METRICS_PUSH_INTERVAL", cfg.MetricsPushInterval); err != nil {
+		return nil, err
+	}
+	if cfg.MetricsPushInterval == 0 {
+		return nil, fmt.Errorf("METRICS_PUSH_INTERVAL must be positive, got %s", cfg.MetricsPushInterval)
+	}
+	if cfg.MetricsRuntimeCollectors, err = getBool("METRICS_RUNTIME_COLLECTORS", true); err != nil {
+		return nil, err
+	}
+	if cfg.MetricsCreatedTimestamps, err = getBool("METRICS_CREATED_TIMESTAMPS", false); err != nil {
+		return nil, err
+	}
+	if cfg.MetricsMaxRoutes, err = getInt("METRICS_MAX_ROUTES", cfg.MetricsMaxRoutes); err != nil {
+		return nil, err
+	}
+	if cfg.MetricsMaxRoutes <= 0 {
+		return nil, fmt.Errorf("METRICS_MAX_ROUTES must be positive, got %d", cfg.MetricsMaxRoutes)
+	}
+	if cfg.MetricsMaxSeries, err = getInt("METRICS_MAX_SERIES", cfg.MetricsMaxSeries); err != nil {
+		return nil, err
+	}
+	if cfg.MetricsMaxSeries < 0 {
+		return nil, fmt.Errorf("METRICS_MAX_SERIES must not be negative, got %d", cfg.MetricsMaxSeries)
+	}
+	for key, v := range map[string]string{"METRICS_NAMESPACE": cfg.MetricsNamespace, "METRICS_SUBSYSTEM": cfg.MetricsSubsystem} {
+		if v != "" && !metricNamePart.MatchString(v) {
+			return nil, fmt.Errorf("%s must contain only letters, digits and underscores and not start with a digit, got %q", key, v)
+		}
+	}
+	for _, t := range cfg.MetricsRouteTemplates {
+		if !strings.HasPrefix(t, "/") {
+			return nil, fmt.Errorf("METRICS_ROUTE_TEMPLATES entries must start with /, got %q", t)
+		}
+	}
+	otlpHeaders, err := getSecret("OTLP_METRICS_HEADERS")
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range strings.Split(otlpHeaders, ",") {
+		if h = strings.TrimSpace(h); h == "" {
+			continue
+		}
+		if name, _, ok := strings.Cut(h, "="); !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("OTLP_METRICS_HEADERS entries must be name=value")
+		}
+		cfg.OTLPMetricsHeaders = append(cfg.OTLPMetricsHeaders, h)
+	}
+	if cfg.RedisPassword, err = getSecret("REDIS_PASSWORD"); err != nil {
+		return nil, err
+	}
+	if cfg.RedisDB, err = getInt("REDIS_DB", 0); err != nil {
+		return nil, err
+	}
+	if cfg.RuntimeAutoMaxProcs, err = getBool("RUNTIME_AUTO_MAXPROCS", true); err != nil {
+		return nil, err
+	}
+	if cfg.RuntimeMemoryLimitRatio, err = getFloat("RUNTIME_MEMORY_LIMIT_RATIO", 0.9); err != nil {
+		return nil, err
+	}
+	if cfg.RuntimeMemoryLimitRatio < 0 || cfg.RuntimeMemoryLimitRatio > 1 {
+		return nil, fmt.Errorf("RUNTIME_MEMORY_LIMIT_RATIO must be between 0 and 1, got %v", cfg.RuntimeMemoryLimitRatio)
+	}
+	if cfg.RuntimeMemoryLimitMB, err = getInt("RUNTIME_MEMORY_LIMIT_MB", 0); err != nil {
+		return nil, err
+	}
+	if cfg.RuntimeMemoryLimitMB < 0 {
+		return nil, fmt.Errorf("RUNTIME_MEMORY_LIMIT_MB must not be negative, got %d", cfg.RuntimeMemoryLimitMB)
+	}
+	if cfg.RuntimeGCPercent, err = getInt("RUNTIME_GC_PERCENT", 0); err != nil {
+		return nil, err
+	}
+	if cfg.RuntimeGCPercent < -1 {
+		return nil, fmt.Errorf("RUNTIME_GC_PERCENT must be -1 (off), 0 (keep GOGC) or positive, got %d", cfg.RuntimeGCPercent)
+	}
+	if cfg.RuntimeMemoryBallastMB, err = getInt("RUNTIME_MEMORY_BALLAST_MB", 0); err != nil {
+		return nil, err
+	}
+	if cfg.RuntimeMemoryBallastMB < 0 {
+		return nil, fmt.Errorf("RUNTIME_MEMORY_BALLAST_MB must not be negative, got %d", cfg.RuntimeMemoryBallastMB)
+	}
+
+	return cfg, nil
+}
+
+func getString(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// getSecret reads key from the environment or, when unset, from the file
+// named by key_FILE, as mounted by Docker and Kubernetes secrets. Trailing
+// newlines in the file are ignored.
+func getSecret(key string) (string, error) {
+	if v := os.Getenv(key); v != "" {
+		return v, nil
+	}
+	path := os.Getenv(key + "_FILE")
+	if path == "" {
+		return "", nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read %s_FILE: %w", key, err)
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// getList splits a comma-separated variable, returning nil when it is unset.
+func getList(key string) []string {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil
+	}
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// getListDefault is getList with a fallback for unset variables.
+func getListDefault(key string, def []string) []string {
+	if items := getList(key); items != nil {
+		return items
+	}
+	return def
+}
+
+func getBool(key string, def bool) (bool, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s %q: %w", key, v, err)
+	}
+	return b, nil
+}
+
+func getInt(key string, def int) (int, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, v, err)
+	}
+	return n, nil
+}
+
+func getFloat(key string, def float64) (float64, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, v, err)
+	}
+	return f, nil
+}
+
+func getDuration(key string, def time.Duration) (time.Duration, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, v, err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("%s must not be negative, got %s", key, v)
+	}
+	return d, nil
+}
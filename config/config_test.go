@@ -0,0 +1,408 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadDefaults(t *testing.T) {
+	t.Setenv("PORT", "")
+	t.Setenv("LOG_ASYNC", "")
+	t.Setenv("LOG_BUFFER_SIZE", "")
+	t.Setenv("LOG_TAIL", "")
+	t.Setenv("LOG_TAIL_THRESHOLD", "")
+	t.Setenv("SLOW_REQUEST_THRESHOLD", "")
+	t.Setenv("LOG_REDACT_QUERY_PARAMS", "")
+	t.Setenv("LOG_MAX_USER_AGENT", "")
+	t.Setenv("JWT_EXEMPT_PATHS", "")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.Port != "8080" {
+		t.Errorf("Expected default port 8080, got %s", cfg.Port)
+	}
+	if cfg.LogAsync {
+		t.Error("Async logging should be disabled by default")
+	}
+	if cfg.LogBufferSize != 1024 {
+		t.Errorf("Expected default buffer size 1024, got %d", cfg.LogBufferSize)
+	}
+	if cfg.LogTail {
+		t.Error("Tail logging should be disabled by default")
+	}
+	if cfg.LogTailThreshold != 500*time.Millisecond {
+		t.Errorf("Expected default tail threshold 500ms, got %s", cfg.LogTailThreshold)
+	}
+	if cfg.SlowRequestThreshold != time.Second {
+		t.Errorf("Expected default slow threshold 1s, got %s", cfg.SlowRequestThreshold)
+	}
+	if cfg.LogRedactQueryParams != nil {
+		t.Errorf("Expected nil redaction override, got %v", cfg.LogRedactQueryParams)
+	}
+	if cfg.LogMaxUserAgent != 256 {
+		t.Errorf("Expected default user agent limit 256, got %d", cfg.LogMaxUserAgent)
+	}
+	exempt := strings.Join(cfg.JWTExemptPaths, ",")
+	if !strings.Contains(exempt, "/health") || !strings.Contains(exempt, "/auth/login,/auth/callback,/auth/logout") {
+		t.Errorf("Expected probes and the OIDC login routes exempt from JWT, got %q", cfg.JWTExemptPaths)
+	}
+}
+
+func TestLoadFromEnv(t *testing.T) {
+	t.Setenv("PORT", "9090")
+	t.Setenv("LOG_ASYNC", "true")
+	t.Setenv("LOG_BUFFER_SIZE", "16")
+	t.Setenv("LOG_TAIL", "1")
+	t.Setenv("LOG_TAIL_THRESHOLD", "2s")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.Port != "9090" || !cfg.LogAsync || cfg.LogBufferSize != 16 ||
+		!cfg.LogTail || cfg.LogTailThreshold != 2*time.Second {
+		t.Errorf("Unexpected config: %+v", cfg)
+	}
+}
+
+func TestLoadRejectsInvalidValues(t *testing.T) {
+	cases := map[string]string{
+		"LOG_ASYNC":                   "maybe",
+		"LOG_BUFFER_SIZE":             "-1",
+		"LOG_TAIL_THRESHOLD":          "soon",
+		"SLOW_REQUEST_THRESHOLD":      "-1s",
+		"LOG_MAX_USER_AGENT":          "-5",
+		"CORS_ALLOW_CREDENTIALS":      "sometimes",
+		"CORS_MAX_AGE":                "-1m",
+		"SECURITY_HEADERS":            "strict",
+		"HSTS_MAX_AGE":                "forever",
+		"COMPRESSION":                 "fast",
+		"COMPRESSION_MIN_SIZE":        "-1",
+		"MAX_DECOMPRESSED_BODY_BYTES": "0",
+		"MIRROR_URL":                  "/relative",
+		"MIRROR_PERCENT":              "150",
+		"MIRROR_TIMEOUT":              "later",
+		"OUTBOUND_TIMEOUT":            "0s",
+		"RUNTIME_AUTO_MAXPROCS":       "sometimes",
+		"RUNTIME_MEMORY_LIMIT_RATIO":  "1.5",
+		"RUNTIME_MEMORY_LIMIT_MB":     "-1",
+		"RUNTIME_GC_PERCENT":          "-2",
+		"RUNTIME_MEMORY_BALLAST_MB":   "lots",
+		"PROXY_UPSTREAM_URL":          "upstream:8080",
+		"PROXY_TIMEOUT":               "0s",
+		"OUTBOUND_LOG_LEVEL":          "trace",
+		"HEALTH_CHECK_HEDGE_DELAY":    "1m",
+		"OUTBOUND_RETRY_MAX_ATTEMPTS": "0",
+		"OUTBOUND_RETRY_BACKOFF":      "10s",
+		"OUTBOUND_RETRY_BUDGET":       "1.5",
+		"OUTBOUND_RETRY_BUDGET_BURST": "-1",
+		"MIRROR_MAX_BODY_BYTES":       "0",
+		"CACHE_TTL":                   "0s",
+		"CACHE_MAX_ENTRIES":           "0",
+		"TRACE_EXPORTER":              "datadog",
+		"REQUEST_ID_SCHEME":           "snowflake",
+		"METRICS_MODE":                "statsd",
+		"OTLP_METRICS_ENDPOINT":       "collector",
+		"OTLP_METRICS_HEADERS":        "Authorization",
+		"METRICS_PUSHGATEWAY_URL":     "pushgateway:9091",
+		"METRICS_REMOTE_WRITE_URL":    "/api/v1/write",
+		"METRICS_STATSD_ADDR":         "localhost",
+		"METRICS_STATSD_FLAVOR":       "graphite",
+		"METRICS_STATSD_TAGS":         "env",
+		"METRICS_GRAPHITE_ADDR":       "carbon",
+		"METRICS_GRAPHITE_TAGGED":     "tags",
+		"METRICS_PUSH_INTERVAL":       "0s",
+		"METRICS_MAX_ROUTES":          "0",
+		"METRICS_MAX_SERIES":          "-1",
+		"METRICS_RUNTIME_COLLECTORS":  "sometimes",
+		"METRICS_CREATED_TIMESTAMPS":  "maybe",
+		"METRICS_NAMESPACE":           "ping-svc",
+		"METRICS_SUBSYSTEM":           "9http",
+		"METRICS_ROUTE_TEMPLATES":     "targets/{id}",
+		"JWT_LEEWAY":                  "-5s",
+		"JWT_JWKS_REFRESH_INTERVAL":   "hourly",
+		"DEBUG_CAPTURE_MAX_BYTES":     "0",
+		"DEBUG_RECENT_REQUESTS":       "-1",
+		"STATS_WINDOW":                "-1s",
+		"JOB_WORKERS":                 "0",
+		"JOB_QUEUE_SIZE":              "-1",
+		"JOB_RETENTION":               "0s",
+		"JOB_MAX_ATTEMPTS":            "0",
+		"JOB_RETRY_BACKOFF":           "-1s",
+		"JOB_RETRY_MAX_BACKOFF":       "1ms",
+		"JOB_RETRY_JITTER":            "1.5",
+		"JOB_STUCK_AFTER":             "-1m",
+		"JOB_LOCK_BACKEND":            "etcd",
+		"JOB_LOCK_TTL":                "0s",
+		"JOBS_API":                    "maybe",
+		"FILES_MAX_UPLOAD_BYTES":      "0",
+		"FILES_WORKERS":               "0",
+		"FILES_CHUNK_ROWS":            "-1",
+		"FILE_WATCH_INTERVAL":         "0s",
+		"FILE_WATCH_COMPRESS":         "bzip2",
+		"FILE_UPLOAD_PART_SIZE":       "1024",
+		"HEALTH_DISK_MIN_FREE_MB":     "-1",
+		"HEALTH_CHECK_TIMEOUT":        "0s",
+		"HEALTH_CACHE_TTL":            "-1s",
+		"SHUTDOWN_DRAIN_DELAY":        "-5s",
+		"MAX_IN_FLIGHT":               "-1",
+		"RATE_LIMIT_RPS":              "fast",
+		"RATE_LIMIT_BURST":            "0",
+		"RATE_LIMIT_BACKEND":          "memcached",
+	}
+	for key, value := range cases {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv(key, value)
+			if _, err := Load(); err == nil {
+				t.Errorf("Expected error for %s=%s", key, value)
+			}
+		})
+	}
+}
+
+func TestLoadList(t *testing.T) {
+	t.Setenv("LOG_REDACT_HEADERS", " Authorization, ,X-Secret ")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if len(cfg.LogRedactHeaders) != 2 || cfg.LogRedactHeaders[0] != "Authorization" || cfg.LogRedactHeaders[1] != "X-Secret" {
+		t.Errorf("Unexpected header list: %q", cfg.LogRedactHeaders)
+	}
+}
+
+func TestLoadListDefault(t *testing.T) {
+	t.Setenv("CORS_ALLOWED_METHODS", "")
+	t.Setenv("CORS_EXPOSED_HEADERS", "X-Correlation-ID, RateLimit-Remaining")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if len(cfg.CORSAllowedMethods) != 3 || cfg.CORSAllowedMethods[0] != "GET" {
+		t.Errorf("Expected default CORS methods, got %q", cfg.CORSAllowedMethods)
+	}
+	if len(cfg.CORSExposedHeaders) != 2 || cfg.CORSExposedHeaders[1] != "RateLimit-Remaining" {
+		t.Errorf("Unexpected exposed headers: %q", cfg.CORSExposedHeaders)
+	}
+}
+
+func TestLoadCORSCredentialsRejectAnyOrigin(t *testing.T) {
+	t.Setenv("CORS_ALLOW_CREDENTIALS", "true")
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://app.example.com,*")
+	if _, err := Load(); err == nil {
+		t.Error("Expected error for a \"*\" origin with credentials")
+	}
+
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://app.example.com,https://*.example.com")
+	if _, err := Load(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestLoadRedisBackendRequiresAddr(t *testing.T) {
+	for _, key := range []string{"RATE_LIMIT_BACKEND", "JOB_LOCK_BACKEND"} {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv(key, "redis")
+			t.Setenv("REDIS_ADDR", "")
+			if _, err := Load(); err == nil {
+				t.Error("Expected error when the redis backend has no address")
+			}
+
+			t.Setenv("REDIS_ADDR", "localhost:6379")
+			if _, err := Load(); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadFileWatchSchemaRequiresSchemaDir(t *testing.T) {
+	t.Setenv("FILE_WATCH_SCHEMA", "orders")
+	t.Setenv("FILES_SCHEMA_DIR", "")
+	if _, err := Load(); err == nil {
+		t.Error("Expected error when FILE_WATCH_SCHEMA has no FILES_SCHEMA_DIR")
+	}
+
+	t.Setenv("FILES_SCHEMA_DIR", "/etc/ping/schemas")
+	if _, err := Load(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestLoadFileUploadRequirements(t *testing.T) {
+	t.Setenv("FILE_UPLOAD_BUCKET", "results")
+	t.Setenv("FILE_WATCH_DIR", "")
+	if _, err := Load(); err == nil {
+		t.Error("Expected error when FILE_UPLOAD_BUCKET has no FILE_WATCH_DIR")
+	}
+
+	t.Setenv("FILE_WATCH_DIR", "/var/spool/ping")
+	t.Setenv("FILE_UPLOAD_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	if _, err := Load(); err == nil {
+		t.Error("Expected error when FILE_UPLOAD_BUCKET has no credentials")
+	}
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.FileUploadAccessKeyID != "AKID" || cfg.FileUploadSecretAccessKey != "secret" {
+		t.Errorf("Expected the AWS credentials, got %q/%q", cfg.FileUploadAccessKeyID, cfg.FileUploadSecretAccessKey)
+	}
+}
+
+func TestLoadSecretFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "admin-password")
+	if err := os.WriteFile(path, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ADMIN_USERNAME", "ops")
+	t.Setenv("ADMIN_PASSWORD", "")
+	t.Setenv("ADMIN_PASSWORD_FILE", path)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.AdminPassword != "s3cret" {
+		t.Errorf("Expected password from file without newline, got %q", cfg.AdminPassword)
+	}
+
+	t.Setenv("ADMIN_PASSWORD_FILE", filepath.Join(t.TempDir(), "missing"))
+	if _, err := Load(); err == nil {
+		t.Error("Expected error for unreadable secret file")
+	}
+}
+
+func TestLoadAdminCredentialsRequirePair(t *testing.T) {
+	t.Setenv("ADMIN_USERNAME", "ops")
+	t.Setenv("ADMIN_PASSWORD", "")
+	t.Setenv("ADMIN_PASSWORD_FILE", "")
+	if _, err := Load(); err == nil {
+		t.Error("Expected error when only a username is set")
+	}
+}
+
+func TestLoadOIDCRequiresClientSettings(t *testing.T) {
+	t.Setenv("OIDC_ISSUER_URL", "https://accounts.example.com")
+	t.Setenv("OIDC_CLIENT_ID", "ping")
+	t.Setenv("OIDC_REDIRECT_URL", "https://ping.example.com/auth/callback")
+	t.Setenv("OIDC_COOKIE_SECRET", "too-short")
+	if _, err := Load(); err == nil {
+		t.Error("Expected error for short cookie secret")
+	}
+
+	t.Setenv("OIDC_COOKIE_SECRET", "0123456789abcdef0123456789abcdef")
+	t.Setenv("OIDC_CLIENT_ID", "")
+	if _, err := Load(); err == nil {
+		t.Error("Expected error without a client ID")
+	}
+
+	t.Setenv("OIDC_CLIENT_ID", "ping")
+	if _, err := Load(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestLoadTLSClientAuth(t *testing.T) {
+	t.Setenv("TLS_CERT_FILE", "server.crt")
+	t.Setenv("TLS_KEY_FILE", "server.key")
+	t.Setenv("TLS_CLIENT_CA_FILE", "clients.pem")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.TLSClientAuth != "verify_if_given" {
+		t.Errorf("Expected verify_if_given default with a client CA, got %q", cfg.TLSClientAuth)
+	}
+
+	t.Setenv("TLS_CLIENT_AUTH", "sometimes")
+	if _, err := Load(); err == nil {
+		t.Error("Expected error for unknown client auth mode")
+	}
+
+	t.Setenv("TLS_CLIENT_AUTH", "require")
+	t.Setenv("TLS_CLIENT_CA_FILE", "")
+	if _, err := Load(); err == nil {
+		t.Error("Expected error when require has no client CA")
+	}
+
+	t.Setenv("TLS_CLIENT_AUTH", "")
+	t.Setenv("TLS_KEY_FILE", "")
+	if _, err := Load(); err == nil {
+		t.Error("Expected error for a certificate without a key")
+	}
+}
+
+func TestLoadTraceExporterDefaults(t *testing.T) {
+	t.Setenv("TRACE_EXPORTER", "zipkin")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.TraceEndpoint != "http://localhost:9411/api/v2/spans" || cfg.ServiceName != "ping" {
+		t.Errorf("Unexpected trace defaults: endpoint %q, service %q", cfg.TraceEndpoint, cfg.ServiceName)
+	}
+
+	t.Setenv("TRACE_ENDPOINT", "collector:4318")
+	if _, err := Load(); err == nil {
+		t.Error("Expected relative TRACE_ENDPOINT to be rejected")
+	}
+}
+
+func TestLoadRequestIDPrefixDefaultsToServiceName(t *testing.T) {
+	t.Setenv("SERVICE_NAME", "edge")
+	t.Setenv("REQUEST_ID_SCHEME", "short")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.RequestIDPrefix != "edge" {
+		t.Errorf("Expected prefix edge, got %q", cfg.RequestIDPrefix)
+	}
+}
+
+func TestLoadOTLPMetricsHeaders(t *testing.T) {
+	t.Setenv("OTLP_METRICS_HEADERS", "Authorization=Bearer abc, X-Scope-OrgID=ping")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if len(cfg.OTLPMetricsHeaders) != 2 || cfg.OTLPMetricsHeaders[0] != "Authorization=Bearer abc" || cfg.OTLPMetricsHeaders[1] != "X-Scope-OrgID=ping" {
+		t.Errorf("Unexpected headers %q", cfg.OTLPMetricsHeaders)
+	}
+}
+
+func TestLoadRuntimeTuning(t *testing.T) {
+	t.Setenv("RUNTIME_MEMORY_LIMIT_MB", "")
+	t.Setenv("RUNTIME_GC_PERCENT", "")
+	t.Setenv("RUNTIME_MEMORY_BALLAST_MB", "")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.RuntimeMemoryLimitMB != 0 || cfg.RuntimeGCPercent != 0 || cfg.RuntimeMemoryBallastMB != 0 {
+		t.Errorf("Expected no GC tuning by default, got %+v", cfg)
+	}
+
+	t.Setenv("RUNTIME_MEMORY_LIMIT_MB", "900")
+	t.Setenv("RUNTIME_GC_PERCENT", "-1")
+	t.Setenv("RUNTIME_MEMORY_BALLAST_MB", "256")
+	if cfg, err = Load(); err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if cfg.RuntimeMemoryLimitMB != 900 || cfg.RuntimeGCPercent != -1 || cfg.RuntimeMemoryBallastMB != 256 {
+		t.Errorf("Unexpected GC tuning: %+v", cfg)
+	}
+}
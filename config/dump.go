@@ -0,0 +1,170 @@
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Masked replaces secret values in Dump.
+const Masked = "********"
+
+// secretFields are the Config fields read with getSecret, and the headers
+// that carry OTLP credentials.
+var secretFields = map[string]bool{
+	"DebugCaptureToken":         true,
+	"AdminUsername":             true,
+	"AdminPassword":             true,
+	"OIDCClientSecret":          true,
+	"OIDCCookieSecret":          true,
+	"FileUploadAccessKeyID":     true,
+	"FileUploadSecretAccessKey": true,
+	"FileUploadSessionToken":    true,
+	"OTLPMetricsHeaders":        true,
+	"RedisPassword":             true,
+}
+
+// Setting is a field of the effective configuration as Dump shows it.
+type Setting struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Dump returns every field of cfg in declaration order, formatted for
+// people: durations as "1m30s", lists comma-separated. Secrets that are set
+// are masked, and so are passwords in URLs.
+func Dump(cfg *Config) []Setting {
+	v := reflect.ValueOf(cfg).Elem()
+	t := v.Type()
+	settings := make([]Setting, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		value := formatValue(v.Field(i))
+		switch {
+		case secretFields[field.Name] && value != "":
+			value = Masked
+		case strings.Contains(value, "://"):
+			value = redactURLs(value)
+		}
+		settings = append(settings, Setting{Name: field.Name, Value: value})
+	}
+	return settings
+}
+
+func formatValue(v reflect.Value) string {
+	if d, ok := v.Interface().(time.Duration); ok {
+		return d.String()
+	}
+	switch v.Kind() {
+	case reflect.Slice:
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = formatValue(v.Index(i))
+		}
+		return strings.Join(items, ",")
+	case reflect.Map:
+		keys := v.MapKeys()
+		items := make([]string, 0, len(keys))
+		for _, k := range keys {
+			items = append(items, fmt.Sprintf("%v=%v", k, v.MapIndex(k)))
+		}
+		// Map order is random; keep dumps comparable
+		sort.Strings(items)
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// redactURLs masks the passwords of the URLs in a comma-separated value.
+func redactURLs(value string) string {
+	items := strings.Split(value, ",")
+	for i, item := range items {
+		if u, err := url.Parse(item); err == nil && u.User != nil {
+			if _, ok := u.User.Password(); ok {
+				u.User = url.UserPassword(u.User.Username(), Masked)
+				items[i] = u.String()
+			}
+		}
+	}
+	return strings.Join(items, ",")
+}
+
+// Command runs the "config" subcommand of the server with args, the
+// arguments after "config", and returns its exit status:
+//
+//	config validate [-file path] [-set KEY=value]...
+//	config dump [-file path] [-set KEY=value]... [-output table|json]
+//
+// Both load the configuration as the server would: the file (CONFIG_FILE
+// by default), overridden by the environment, overridden by -set. validate
+// reports the first error, with the offending line of the file when a
+// value from it caused the error; dump prints the effective configuration
+// with secrets masked.
+func Command(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || (args[0] != "validate" && args[0] != "dump") {
+		fmt.Fprintln(stderr, "usage: config validate|dump [-file path] [-set KEY=value]... [-output table|json]")
+		return 2
+	}
+	fs := flag.NewFlagSet("config "+args[0], flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	path := fs.String("file", os.Getenv("CONFIG_FILE"), "config file of KEY=value lines")
+	output := fs.String("output", "table", "dump format: table or json")
+	var sets []string
+	fs.Func("set", "override a variable as KEY=value; repeatable", func(v string) error {
+		if key, _, ok := strings.Cut(v, "="); !ok || !envKey.MatchString(key) {
+			return fmt.Errorf("expected KEY=value, got %q", v)
+		}
+		sets = append(sets, v)
+		return nil
+	})
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if *output != "table" && *output != "json" {
+		fmt.Fprintf(stderr, "-output must be table or json, got %q\n", *output)
+		return 2
+	}
+
+	// Flags override the environment, which overrides the file
+	for _, v := range sets {
+		key, value, _ := strings.Cut(v, "=")
+		os.Setenv(key, value)
+	}
+	cfg, err := LoadFrom(*path)
+	if err != nil {
+		fmt.Fprintf(stderr, "invalid configuration: %v\n", err)
+		if le, ok := err.(*LineError); ok {
+			fmt.Fprintf(stderr, "%6d | %s\n", le.Line, le.Text)
+		}
+		return 1
+	}
+
+	if args[0] == "validate" {
+		fmt.Fprintln(stdout, "configuration is valid")
+		return 0
+	}
+	settings := Dump(cfg)
+	if *output == "json" {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(settings)
+		return 0
+	}
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	for _, s := range settings {
+		fmt.Fprintf(tw, "%s\t%s\n", s.Name, s.Value)
+	}
+	tw.Flush()
+	return 0
+}
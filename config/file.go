@@ -0,0 +1,171 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// EnvFile holds the variables of a config file in the dotenv format: one
+// KEY=value per line, optionally prefixed with "export", with # comments
+// and blank lines ignored and values optionally quoted.
+type EnvFile struct {
+	Path    string
+	Entries []EnvEntry
+}
+
+// EnvEntry is a variable of an EnvFile and the line that set it.
+type EnvEntry struct {
+	Key, Value string
+	Line       int
+	Text       string
+}
+
+// LineError is an error caused by a line of a config file.
+type LineError struct {
+	Path string
+	Line int
+	// Text is the line as written in the file.
+	Text string
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("%s:%d: %v", e.Path, e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// envKey matches a variable name.
+var envKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ReadEnvFile parses the config file at path. Malformed lines are reported
+// as a *LineError.
+func ReadEnvFile(path string) (*EnvFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	file := &EnvFile{Path: path}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		text := scanner.Text()
+		line := strings.TrimSpace(text)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || !envKey.MatchString(key) {
+			return nil, &LineError{Path: path, Line: n, Text: text, Err: errors.New("expected KEY=value")}
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') {
+			if value[len(value)-1] != value[0] {
+				return nil, &LineError{Path: path, Line: n, Text: text, Err: errors.New("unterminated quoted value")}
+			}
+			if value[0] == '"' {
+				if value, err = strconv.Unquote(value); err != nil {
+					return nil, &LineError{Path: path, Line: n, Text: text, Err: fmt.Errorf("invalid quoted value: %w", err)}
+				}
+			} else {
+				value = value[1 : len(value)-1]
+			}
+		}
+		file.Entries = append(file.Entries, EnvEntry{Key: key, Value: value, Line: n, Text: text})
+	}
+	return file, scanner.Err()
+}
+
+// Apply sets the file's variables in the environment, except those the
+// environment already sets, which take precedence. A variable set twice
+// in the file takes its last value.
+func (f *EnvFile) Apply() error {
+	for _, e := range f.effective() {
+		if _, set := os.LookupEnv(e.Key); set {
+			continue
+		}
+		if err := os.Setenv(e.Key, e.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// effective returns the last entry of each key, in file order.
+func (f *EnvFile) effective() []EnvEntry {
+	last := make(map[string]int, len(f.Entries))
+	for i, e := range f.Entries {
+		last[e.Key] = i
+	}
+	entries := make([]EnvEntry, 0, len(last))
+	for i, e := range f.Entries {
+		if last[e.Key] == i {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// Locate wraps err, an error of Load, in a *LineError pointing at the line
+// that set the variable it names, if the file set it and the value in
+// effect is the file's. Other errors are returned as is.
+func (f *EnvFile) Locate(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	for _, e := range f.effective() {
+		if os.Getenv(e.Key) != e.Value || !mentions(msg, e.Key) {
+			continue
+		}
+		return &LineError{Path: f.Path, Line: e.Line, Text: e.Text, Err: err}
+	}
+	return err
+}
+
+// mentions reports whether msg names the variable key as a whole word.
+func mentions(msg, key string) bool {
+	for i := 0; ; {
+		j := strings.Index(msg[i:], key)
+		if j < 0 {
+			return false
+		}
+		start, end := i+j, i+j+len(key)
+		if (start == 0 || !isKeyByte(msg[start-1])) && (end == len(msg) || !isKeyByte(msg[end])) {
+			return true
+		}
+		i = end
+	}
+}
+
+func isKeyByte(b byte) bool {
+	return b == '_' || ('A' <= b && b <= 'Z') || ('a' <= b && b <= 'z') || ('0' <= b && b <= '9')
+}
+
+// LoadFrom applies the config file at path, when not empty, and then
+// loads the configuration like Load, so that the environment overrides
+// the file. Errors caused by a value from the file are a *LineError.
+func LoadFrom(path string) (*Config, error) {
+	if path == "" {
+		return Load()
+	}
+	file, err := ReadEnvFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Apply(); err != nil {
+		return nil, err
+	}
+	cfg, err := Load()
+	return cfg, file.Locate(err)
+}
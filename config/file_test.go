@@ -0,0 +1,98 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// unsetenv unsets keys for the duration of the test.
+func unsetenv(t *testing.T, keys ...string) {
+	t.Helper()
+	for _, key := range keys {
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+}
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ping.env")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadEnvFile(t *testing.T) {
+	path := writeFile(t, "# service settings\n\nPORT=9090\nexport SERVICE_NAME = \"ping \\\"edge\\\"\"\nLOG_LEVEL='debug # verbose'\n")
+	file, err := ReadEnvFile(path)
+	if err != nil {
+		t.Fatalf("ReadEnvFile returned error: %v", err)
+	}
+	want := []EnvEntry{
+		{Key: "PORT", Value: "9090", Line: 3},
+		{Key: "SERVICE_NAME", Value: `ping "edge"`, Line: 4},
+		{Key: "LOG_LEVEL", Value: "debug # verbose", Line: 5},
+	}
+	if len(file.Entries) != len(want) {
+		t.Fatalf("Expected %d entries, got %+v", len(want), file.Entries)
+	}
+	for i, w := range want {
+		got := file.Entries[i]
+		if got.Key != w.Key || got.Value != w.Value || got.Line != w.Line {
+			t.Errorf("Entry %d: expected %+v, got %+v", i, w, got)
+		}
+	}
+}
+
+func TestReadEnvFileRejectsMalformedLines(t *testing.T) {
+	for _, content := range []string{"PORT=1\nnot a setting\n", "PORT=1\nNAME=\"open\n", "PORT=1\n1ST=x\n"} {
+		_, err := ReadEnvFile(writeFile(t, content))
+		var le *LineError
+		if !errors.As(err, &le) || le.Line != 2 {
+			t.Errorf("Expected an error on line 2 for %q, got %v", content, err)
+		}
+	}
+}
+
+func TestLoadFromEnvironmentOverridesFile(t *testing.T) {
+	unsetenv(t, "PORT", "SERVICE_NAME")
+	t.Setenv("LOG_BUFFER_SIZE", "64")
+	path := writeFile(t, "PORT=9090\nPORT=9191\nSERVICE_NAME=edge\nLOG_BUFFER_SIZE=4096\n")
+
+	cfg, err := LoadFrom(path)
+	if err != nil {
+		t.Fatalf("LoadFrom returned error: %v", err)
+	}
+	if cfg.Port != "9191" || cfg.ServiceName != "edge" {
+		t.Errorf("Expected the last file values, got port %s and service %s", cfg.Port, cfg.ServiceName)
+	}
+	if cfg.LogBufferSize != 64 {
+		t.Errorf("Expected the environment to win, got buffer size %d", cfg.LogBufferSize)
+	}
+}
+
+func TestLoadFromLocatesErrors(t *testing.T) {
+	unsetenv(t, "LOG_BUFFER_SIZE", "LOG_BUFFER")
+	path := writeFile(t, "LOG_BUFFER=1\nLOG_BUFFER_SIZE=lots\n")
+
+	_, err := LoadFrom(path)
+	var le *LineError
+	if !errors.As(err, &le) {
+		t.Fatalf("Expected a *LineError, got %v", err)
+	}
+	if le.Line != 2 || le.Text != "LOG_BUFFER_SIZE=lots" {
+		t.Errorf("Expected line 2, got %d %q", le.Line, le.Text)
+	}
+}
+
+func TestLoadFromLeavesEnvironmentErrorsUnlocated(t *testing.T) {
+	t.Setenv("LOG_BUFFER_SIZE", "lots")
+	_, err := LoadFrom(writeFile(t, "LOG_BUFFER_SIZE=64\n"))
+	var le *LineError
+	if err == nil || errors.As(err, &le) {
+		t.Errorf("Expected an error without a line, got %v", err)
+	}
+}
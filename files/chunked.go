@@ -0,0 +1,128 @@
+package files
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"ping/observability"
+)
+
+// DefaultChunkRows is how many rows a chunk holds when Options does not
+// say.
+const DefaultChunkRows = 1000
+
+// rowOverhead approximates the memory of a row beyond its field bytes:
+// the slice and string headers.
+const rowOverhead = 64
+
+// chunkRow is a row read for a worker, or the parse error that replaced it.
+type chunkRow struct {
+	line   int
+	record []string
+	err    error
+}
+
+// chunk is a batch of rows handed to a worker, with its approximate size.
+type chunk struct {
+	rows  []chunkRow
+	bytes int64
+}
+
+// processChunks checks the rows after the header on opts.Workers
+// goroutines. The reader fills chunks of opts.ChunkRows rows into a
+// channel holding opts.Workers of them, so it stops reading, and an upload
+// stops being received, while the workers are behind: at most
+// 2*Workers+1 chunks are in memory at once, whatever the file size.
+func processChunks(ctx context.Context, reader *csv.Reader, checker *rowChecker, t *tally, opts Options) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	metrics := opts.Metrics
+	start := time.Now()
+
+	chunks := make(chan chunk, opts.Workers)
+	results := make(chan tally, opts.Workers)
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range chunks {
+				var result tally
+				for _, row := range c.rows {
+					checker.process(ctx, &result, row.line, row.record, row.err)
+				}
+				results <- result
+				metrics.AddFileProcessMemory(-float64(c.bytes))
+			}
+		}()
+	}
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(chunks)
+		readErr <- readChunks(ctx, reader, chunks, opts.ChunkRows, metrics)
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	for result := range results {
+		// Chunks finish out of order; merge keeps the errors of the first lines
+		t.merge(result, opts.MaxErrors)
+		metrics.SetFileRowsPerSecond(float64(t.rows) / time.Since(start).Seconds())
+	}
+	return <-readErr
+}
+
+// readChunks reads the rows of reader into chunks of size rows and sends
+// them, blocking while the channel is full, and counts the memory they
+// hold in metrics. It returns nil at the end of the file.
+func readChunks(ctx context.Context, reader *csv.Reader, chunks chan<- chunk, size int, metrics observability.MetricsRecorder) error {
+	send := func(c chunk) error {
+		metrics.AddFileProcessMemory(float64(c.bytes))
+		select {
+		case chunks <- c:
+			return nil
+		case <-ctx.Done():
+			metrics.AddFileProcessMemory(-float64(c.bytes))
+			return ctx.Err()
+		}
+	}
+
+	current := chunk{rows: make([]chunkRow, 0, size)}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			if len(current.rows) == 0 {
+				return nil
+			}
+			return send(current)
+		}
+		var parseErr *csv.ParseError
+		switch {
+		case errors.As(err, &parseErr):
+			current.rows = append(current.rows, chunkRow{line: parseErr.StartLine, err: parseErr.Err})
+			current.bytes += rowOverhead
+		case err != nil:
+			return err
+		default:
+			line, _ := reader.FieldPos(0)
+			row := chunkRow{line: line, record: append([]string(nil), record...)}
+			current.bytes += rowOverhead
+			for _, field := range record {
+				current.bytes += int64(len(field))
+			}
+			current.rows = append(current.rows, row)
+		}
+		if len(current.rows) == size {
+			if err := send(current); err != nil {
+				return err
+			}
+			current = chunk{rows: make([]chunkRow, 0, size)}
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package files
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"ping/observability"
+)
+
+// rows returns a CSV file of n numbered rows, every tenth one short.
+func rows(n int) string {
+	var b strings.Builder
+	b.WriteString("id,name\n")
+	for i := 1; i <= n; i++ {
+		if i%10 == 0 {
+			fmt.Fprintf(&b, "%d\n", i)
+			continue
+		}
+		fmt.Fprintf(&b, "%d,row %d\n", i, i)
+	}
+	return b.String()
+}
+
+func TestProcessCSVChunkedMatchesSerial(t *testing.T) {
+	observability.InitMetrics()
+	input := rows(2500) + "x,\"bro\"ken\"\n"
+	serial, err := ProcessCSV(context.Background(), strings.NewReader(input), Options{MaxErrors: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var handled atomic.Int64
+	chunked, err := ProcessCSV(context.Background(), strings.NewReader(input), Options{
+		MaxErrors: 5,
+		Workers:   4,
+		ChunkRows: 100,
+		Handle: func(ctx context.Context, line int, header, record []string) error {
+			handled.Add(1)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chunked.Rows != serial.Rows || chunked.ValidRows != serial.ValidRows || chunked.Invalid != serial.Invalid {
+		t.Errorf("chunked = %+v, serial = %+v", chunked, serial)
+	}
+	if handled.Load() != chunked.ValidRows {
+		t.Errorf("handled %d rows, want %d", handled.Load(), chunked.ValidRows)
+	}
+	// The listed errors are those of the first lines, as in order
+	if fmt.Sprint(chunked.Errors) != fmt.Sprint(serial.Errors) {
+		t.Errorf("chunked errors = %v, serial = %v", chunked.Errors, serial.Errors)
+	}
+}
+
+// countedReader serves a file in small reads, counting the bytes read.
+type countedReader struct {
+	r io.Reader
+	n atomic.Int64
+}
+
+func (g *countedReader) Read(p []byte) (int, error) {
+	n, err := g.r.Read(p[:min(len(p), 64)])
+	g.n.Add(int64(n))
+	return n, err
+}
+
+func TestProcessCSVChunkedAppliesBackpressure(t *testing.T) {
+	observability.InitMetrics()
+	input := rows(100000)
+	reader := &countedReader{r: strings.NewReader(input)}
+	release := make(chan struct{})
+	var once sync.Once
+	blocked := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		_, err := ProcessCSV(context.Background(), reader, Options{
+			Workers:   2,
+			ChunkRows: 10,
+			Handle: func(ctx context.Context, line int, header, record []string) error {
+				once.Do(func() { close(blocked) })
+				<-release
+				return nil
+			},
+		})
+		done <- err
+	}()
+
+	<-blocked
+	// With both workers stuck, reading stops after a few chunks and the
+	// read buffer instead of pulling the whole file into memory
+	time.Sleep(50 * time.Millisecond)
+	if read := reader.n.Load(); read > 64<<10 {
+		t.Errorf("read %d of %d bytes while the workers were blocked", read, len(input))
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProcessCSVChunkedTracksMemoryAndThroughput(t *testing.T) {
+	m := observability.NewMetrics(observability.MetricsOptions{})
+
+	if _, err := ProcessCSV(context.Background(), strings.NewReader(rows(1000)), Options{Workers: 3, ChunkRows: 50, Metrics: m}); err != nil {
+		t.Fatal(err)
+	}
+	if got := testutil.ToFloat64(m.FileProcessMemoryBytes); got != 0 {
+		t.Errorf("file_process_memory_bytes = %v after the file, want 0", got)
+	}
+	if got := testutil.ToFloat64(m.FileProcessRowsPerSecond); got <= 0 {
+		t.Errorf("file_process_rows_per_second = %v, want a rate", got)
+	}
+}
+
+func TestProcessCSVChunkedStopsWhenCanceled(t *testing.T) {
+	observability.InitMetrics()
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err := ProcessCSV(ctx, strings.NewReader(rows(10000)), Options{
+		Workers:   2,
+		ChunkRows: 10,
+		Handle: func(ctx context.Context, line int, header, record []string) error {
+			cancel()
+			return nil
+		},
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
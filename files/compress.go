@@ -0,0 +1,122 @@
+package files
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression names a file compression.
+type Compression string
+
+// Supported compressions.
+const (
+	CompressionNone Compression = ""
+	CompressionGzip Compression = "gzip"
+	CompressionZstd Compression = "zstd"
+)
+
+// ErrUnknownCompression is returned for a compression name
+// ParseCompression does not know.
+var ErrUnknownCompression = errors.New("files: unknown compression")
+
+// Magic numbers opening compressed streams. Neither can start UTF-8 text,
+// so sniffing them never mistakes a plain file for a compressed one.
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// ParseCompression returns the compression named s: none (or empty),
+// gzip (or gz) or zstd (or zst).
+func ParseCompression(s string) (Compression, error) {
+	switch strings.ToLower(s) {
+	case "", "none":
+		return CompressionNone, nil
+	case "gzip", "gz":
+		return CompressionGzip, nil
+	case "zstd", "zst":
+		return CompressionZstd, nil
+	}
+	return CompressionNone, fmt.Errorf("%w: %q", ErrUnknownCompression, s)
+}
+
+// Ext returns the file extension of c, e.g. ".gz".
+func (c Compression) Ext() string {
+	switch c {
+	case CompressionGzip:
+		return ".gz"
+	case CompressionZstd:
+		return ".zst"
+	}
+	return ""
+}
+
+// trimCompressionExt returns name without a .gz or .zst extension.
+func trimCompressionExt(name string) string {
+	lower := strings.ToLower(name)
+	for _, c := range []Compression{CompressionGzip, CompressionZstd} {
+		if strings.HasSuffix(lower, c.Ext()) {
+			return name[:len(name)-len(c.Ext())]
+		}
+	}
+	return name
+}
+
+// nopCloser adds a no-op Close to a reader.
+type nopCloser struct{ io.Reader }
+
+func (nopCloser) Close() error { return nil }
+
+// Decompress returns a reader of the plain bytes of r, which may be gzip
+// or zstd compressed, and the compression it found by sniffing the first
+// bytes. Close releases the decoder, not r.
+func Decompress(r io.Reader) (io.ReadCloser, Compression, error) {
+	buffered := bufio.NewReader(r)
+	head, err := buffered.Peek(len(zstdMagic))
+	if err != nil && !errors.Is(err, io.EOF) && len(head) == 0 {
+		return nil, CompressionNone, err
+	}
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		zr, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, CompressionGzip, fmt.Errorf("reading gzip file: %w", err)
+		}
+		return zr, CompressionGzip, nil
+	case bytes.HasPrefix(head, zstdMagic):
+		zr, err := zstd.NewReader(buffered,
+			zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderLowmem(true))
+		if err != nil {
+			return nil, CompressionZstd, fmt.Errorf("reading zstd file: %w", err)
+		}
+		return zr.IOReadCloser(), CompressionZstd, nil
+	}
+	return nopCloser{buffered}, CompressionNone, nil
+}
+
+// nopWriteCloser adds a no-op Close to a writer.
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// Compress returns a writer compressing into w with c. Close flushes the
+// compressed stream but does not close w.
+func Compress(w io.Writer, c Compression) (io.WriteCloser, error) {
+	switch c {
+	case CompressionNone:
+		return nopWriteCloser{w}, nil
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case CompressionZstd:
+		return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownCompression, c)
+}
@@ -0,0 +1,80 @@
+package files
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// compressed returns data compressed with c.
+func compressed(t *testing.T, c Compression, data string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := Compress(&buf, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(w, data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecompressSniffsCompression(t *testing.T) {
+	const data = "id,name\n1,jo\n"
+	for _, c := range []Compression{CompressionNone, CompressionGzip, CompressionZstd} {
+		r, got, err := Decompress(bytes.NewReader(compressed(t, c, data)))
+		if err != nil {
+			t.Fatalf("%q: Decompress: %v", c, err)
+		}
+		plain, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatalf("%q: read: %v", c, err)
+		}
+		if got != c || string(plain) != data {
+			t.Errorf("Decompress(%q) = %q, %q", c, got, plain)
+		}
+	}
+}
+
+func TestDecompressShortInputs(t *testing.T) {
+	for _, input := range []string{"", "a", "ab\n"} {
+		r, c, err := Decompress(bytes.NewReader([]byte(input)))
+		if err != nil || c != CompressionNone {
+			t.Fatalf("Decompress(%q) = %q, %v", input, c, err)
+		}
+		if plain, _ := io.ReadAll(r); string(plain) != input {
+			t.Errorf("Decompress(%q) read %q", input, plain)
+		}
+	}
+}
+
+func TestDecompressRejectsTruncatedGzip(t *testing.T) {
+	if _, _, err := Decompress(bytes.NewReader([]byte{0x1f, 0x8b, 0x08})); err == nil {
+		t.Error("expected an error for a truncated gzip header")
+	}
+}
+
+func TestParseCompression(t *testing.T) {
+	for input, want := range map[string]Compression{"": CompressionNone, "none": CompressionNone, "gz": CompressionGzip, "GZIP": CompressionGzip, "zst": CompressionZstd, "zstd": CompressionZstd} {
+		if got, err := ParseCompression(input); err != nil || got != want {
+			t.Errorf("ParseCompression(%q) = %q, %v, want %q", input, got, err, want)
+		}
+	}
+	if _, err := ParseCompression("bzip2"); !errors.Is(err, ErrUnknownCompression) {
+		t.Errorf("ParseCompression(bzip2) err = %v, want ErrUnknownCompression", err)
+	}
+}
+
+func TestTrimCompressionExt(t *testing.T) {
+	for name, want := range map[string]string{"rows.csv.gz": "rows.csv", "rows.TSV.ZST": "rows.TSV", "rows.csv": "rows.csv"} {
+		if got := trimCompressionExt(name); got != want {
+			t.Errorf("trimCompressionExt(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,476 @@
+package files
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"ping/observability"
+)
+
+// Format names a tabular file format.
+type Format string
+
+// Supported formats.
+const (
+	FormatCSV   Format = "csv"
+	FormatTSV   Format = "tsv"
+	FormatJSONL Format = "jsonl"
+	// FormatParquet can only be written.
+	FormatParquet Format = "parquet"
+)
+
+var (
+	// ErrUnknownFormat is returned for a format name ParseFormat does not
+	// know.
+	ErrUnknownFormat = errors.New("files: unknown format")
+	// ErrMalformedRow is returned when a row cannot be converted; the
+	// error names its line.
+	ErrMalformedRow = errors.New("files: malformed row")
+)
+
+// ParseFormat returns the format named s, accepting ndjson for JSON Lines.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case FormatCSV, FormatTSV, FormatJSONL, FormatParquet:
+		return f, nil
+	case "ndjson":
+		return FormatJSONL, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrUnknownFormat, s)
+}
+
+// delimiter is the default field delimiter of a delimited format.
+func (f Format) delimiter() rune {
+	if f == FormatTSV {
+		return '\t'
+	}
+	return ','
+}
+
+// ConvertOptions tunes Convert.
+type ConvertOptions struct {
+	// From and To are the input and output formats.
+	From, To Format
+	// Delimiter overrides the field delimiter of CSV or TSV input.
+	Delimiter rune
+	// OutDelimiter overrides the field delimiter of CSV or TSV output.
+	OutDelimiter rune
+	// LazyQuotes accepts quotes inside unquoted fields of the input.
+	LazyQuotes bool
+	// QuoteAll quotes every field of the output rather than only those
+	// that need it.
+	QuoteAll bool
+	// Compress compresses the output. Parquet output cannot be compressed
+	// as a whole; ParquetCodec compresses its pages instead.
+	Compress Compression
+	// ParquetCodec is the page compression of Parquet output, snappy when
+	// empty.
+	ParquetCodec ParquetCodec
+	// Metrics records the run. Nil uses observability.GetMetrics().
+	Metrics observability.MetricsRecorder
+}
+
+// ConvertResult describes a finished conversion. The byte counts are of
+// the plain data; the compressed ones are set for a compressed input or
+// output.
+type ConvertResult struct {
+	Rows               int64 `json:"rows"`
+	BytesIn            int64 `json:"bytes_in"`
+	BytesOut           int64 `json:"bytes_out"`
+	CompressedBytesIn  int64 `json:"compressed_bytes_in,omitempty"`
+	CompressedBytesOut int64 `json:"compressed_bytes_out,omitempty"`
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Convert reads a file in opts.From from r and writes it in opts.To to w,
+// one row at a time; Parquet output is held back one row group at a time.
+// The first CSV or TSV row, or the keys of the first JSON object, name
+// the columns. Unlike ProcessCSV it stops at the first
+// malformed row, since the output would be incomplete anyway. A gzip or
+// zstd compressed r is decompressed on the fly. The run is recorded in
+// the file_process_*, file_convert_bytes_total and
+// file_compressed_bytes_total metrics.
+func Convert(ctx context.Context, r io.Reader, w io.Writer, opts ConvertOptions) (ConvertResult, error) {
+	start := time.Now()
+	rawIn := &countingReader{r: r}
+	rawOut := &countingWriter{w: w}
+	in := &countingReader{}
+	out := &countingWriter{}
+	var rows int64
+	plain, compression, err := Decompress(rawIn)
+	if err == nil {
+		rows, err = convertCompressed(ctx, plain, rawOut, in, out, opts)
+		plain.Close()
+	}
+	result := ConvertResult{Rows: rows, BytesIn: in.n, BytesOut: out.n}
+
+	metrics := observability.RecorderOrDefault(opts.Metrics)
+	metrics.RecordFileProcess(time.Since(start).Seconds(), float64(in.n), err)
+	metrics.RecordFileConvert(string(opts.From), string(opts.To), float64(in.n), float64(out.n))
+	if compression != CompressionNone {
+		result.CompressedBytesIn = rawIn.n
+		metrics.RecordFileCompressed("in", string(compression), float64(rawIn.n))
+	}
+	if opts.Compress != CompressionNone {
+		result.CompressedBytesOut = rawOut.n
+		metrics.RecordFileCompressed("out", string(opts.Compress), float64(rawOut.n))
+	}
+	return result, err
+}
+
+// convertCompressed runs convert from plain to w through the counters in
+// and out, compressing the output as opts says.
+func convertCompressed(ctx context.Context, plain io.Reader, w io.Writer, in *countingReader, out *countingWriter, opts ConvertOptions) (int64, error) {
+	compressed, err := Compress(w, opts.Compress)
+	if err != nil {
+		return 0, err
+	}
+	in.r = plain
+	out.w = compressed
+	rows, err := convert(ctx, in, out, opts)
+	if err != nil {
+		// Closing would still write the stream's header and footer, which
+		// is wrong for a failed conversion
+		if resetter, ok := compressed.(interface{ Reset(io.Writer) }); ok {
+			resetter.Reset(io.Discard)
+		}
+		compressed.Close()
+		return rows, err
+	}
+	return rows, compressed.Close()
+}
+
+func convert(ctx context.Context, r io.Reader, w io.Writer, opts ConvertOptions) (int64, error) {
+	var read rowReader
+	switch opts.From {
+	case FormatCSV, FormatTSV:
+		read = newDelimitedReader(r, opts)
+	case FormatJSONL:
+		read = newJSONLReader(r)
+	case FormatParquet:
+		return 0, fmt.Errorf("%w: parquet can only be written", ErrUnknownFormat)
+	default:
+		return 0, fmt.Errorf("%w: %q", ErrUnknownFormat, opts.From)
+	}
+	buffered := bufio.NewWriter(w)
+	var write rowWriter
+	switch opts.To {
+	case FormatCSV, FormatTSV:
+		write = newDelimitedWriter(buffered, opts)
+	case FormatJSONL:
+		write = &jsonlWriter{w: buffered}
+	case FormatParquet:
+		if opts.Compress != CompressionNone {
+			return 0, fmt.Errorf("%w: parquet output takes a codec rather than %s compression", ErrUnknownCompression, opts.Compress)
+		}
+		codec := opts.ParquetCodec
+		if codec == "" {
+			codec = ParquetSnappy
+		}
+		write = &parquetRowWriter{w: buffered, codec: codec}
+	default:
+		return 0, fmt.Errorf("%w: %q", ErrUnknownFormat, opts.To)
+	}
+
+	header, err := read.header()
+	if err != nil {
+		return 0, err
+	}
+	if err := write.header(header); err != nil {
+		return 0, err
+	}
+	var rows int64
+	for {
+		if rows%1024 == 0 {
+			if err := ctx.Err(); err != nil {
+				return rows, err
+			}
+		}
+		record, err := read.next()
+		if errors.Is(err, io.EOF) {
+			if err := write.close(); err != nil {
+				return rows, err
+			}
+			return rows, buffered.Flush()
+		}
+		if err != nil {
+			return rows, err
+		}
+		if err := write.row(record); err != nil {
+			return rows, err
+		}
+		rows++
+	}
+}
+
+// rowReader yields the column names and then the rows of an input.
+type rowReader interface {
+	header() ([]string, error)
+	// next returns io.EOF after the last row.
+	next() ([]string, error)
+}
+
+// rowWriter writes the column names and then the rows of an output.
+type rowWriter interface {
+	header(columns []string) error
+	row(record []string) error
+	// close finishes the output after the last row.
+	close() error
+}
+
+// delimitedReader reads CSV or TSV.
+type delimitedReader struct {
+	r *csv.Reader
+}
+
+func newDelimitedReader(r io.Reader, opts ConvertOptions) *delimitedReader {
+	reader := csv.NewReader(r)
+	reader.Comma = opts.From.delimiter()
+	if opts.Delimiter != 0 {
+		reader.Comma = opts.Delimiter
+	}
+	reader.LazyQuotes = opts.LazyQuotes
+	reader.ReuseRecord = true
+	return &delimitedReader{r: reader}
+}
+
+func (d *delimitedReader) header() ([]string, error) {
+	header, err := d.r.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w: empty file", ErrInvalidHeader)
+	}
+	if err != nil {
+		return nil, headerError(err)
+	}
+	if err := validateHeader(header); err != nil {
+		return nil, err
+	}
+	return append([]string(nil), header...), nil
+}
+
+func (d *delimitedReader) next() ([]string, error) {
+	record, err := d.r.Read()
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return nil, fmt.Errorf("%w: line %d: %v", ErrMalformedRow, parseErr.StartLine, parseErr.Err)
+	}
+	return record, err
+}
+
+// jsonlReader reads JSON Lines, one object per row. Strings become the
+// field as is, null and missing keys an empty field, and any other value
+// its JSON text.
+type jsonlReader struct {
+	dec     *json.Decoder
+	columns map[string]int
+	record  []string
+	line    int
+	first   json.RawMessage
+}
+
+func newJSONLReader(r io.Reader) *jsonlReader {
+	return &jsonlReader{dec: json.NewDecoder(r)}
+}
+
+func (j *jsonlReader) header() ([]string, error) {
+	err := j.dec.Decode(&j.first)
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w: empty file", ErrInvalidHeader)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidHeader, err)
+	}
+	header, err := objectKeys(j.first)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidHeader, err)
+	}
+	if err := validateHeader(header); err != nil {
+		return nil, err
+	}
+	j.columns = make(map[string]int, len(header))
+	for i, name := range header {
+		j.columns[name] = i
+	}
+	j.record = make([]string, len(header))
+	return header, nil
+}
+
+func (j *jsonlReader) next() ([]string, error) {
+	j.line++
+	raw := j.first
+	j.first = nil
+	if raw == nil {
+		if err := j.dec.Decode(&raw); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("%w: line %d: %v", ErrMalformedRow, j.line, err)
+		}
+	}
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &object); err != nil || object == nil {
+		return nil, fmt.Errorf("%w: line %d: not a JSON object", ErrMalformedRow, j.line)
+	}
+	clear(j.record)
+	for key, value := range object {
+		i, ok := j.columns[key]
+		if !ok {
+			return nil, fmt.Errorf("%w: line %d: key %q is not a column of the first line", ErrMalformedRow, j.line, key)
+		}
+		j.record[i] = jsonField(value)
+	}
+	return j.record, nil
+}
+
+// objectKeys returns the keys of the JSON object raw in their order.
+func objectKeys(raw json.RawMessage) ([]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, errors.New("first line is not a JSON object")
+	}
+	var keys []string
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, tok.(string))
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// jsonField returns the field text of a JSON value.
+func jsonField(value json.RawMessage) string {
+	var s string
+	switch {
+	case string(value) == "null":
+		return ""
+	case json.Unmarshal(value, &s) == nil:
+		return s
+	}
+	return string(value)
+}
+
+// delimitedWriter writes CSV or TSV.
+type delimitedWriter struct {
+	w        *bufio.Writer
+	csv      *csv.Writer
+	comma    rune
+	quoteAll bool
+}
+
+func newDelimitedWriter(w *bufio.Writer, opts ConvertOptions) *delimitedWriter {
+	d := &delimitedWriter{w: w, comma: opts.To.delimiter(), quoteAll: opts.QuoteAll}
+	if opts.OutDelimiter != 0 {
+		d.comma = opts.OutDelimiter
+	}
+	d.csv = csv.NewWriter(w)
+	d.csv.Comma = d.comma
+	return d
+}
+
+func (d *delimitedWriter) header(columns []string) error {
+	return d.row(columns)
+}
+
+func (d *delimitedWriter) close() error { return nil }
+
+func (d *delimitedWriter) row(record []string) error {
+	if !d.quoteAll {
+		// csv.Writer buffers into w, which Convert flushes at the end
+		if err := d.csv.Write(record); err != nil {
+			return err
+		}
+		d.csv.Flush()
+		return d.csv.Error()
+	}
+	for i, field := range record {
+		if i > 0 {
+			d.w.WriteRune(d.comma)
+		}
+		d.w.WriteByte('"')
+		d.w.WriteString(strings.ReplaceAll(field, `"`, `""`))
+		d.w.WriteByte('"')
+	}
+	return d.w.WriteByte('\n')
+}
+
+// jsonlWriter writes JSON Lines with every field as a string, keeping the
+// column order.
+type jsonlWriter struct {
+	w    *bufio.Writer
+	keys [][]byte
+}
+
+func (j *jsonlWriter) header(columns []string) error {
+	j.keys = make([][]byte, len(columns))
+	for i, name := range columns {
+		key, err := json.Marshal(name)
+		if err != nil {
+			return err
+		}
+		j.keys[i] = key
+	}
+	return nil
+}
+
+func (j *jsonlWriter) row(record []string) error {
+	j.w.WriteByte('{')
+	for i, field := range record {
+		if i > 0 {
+			j.w.WriteByte(',')
+		}
+		j.w.Write(j.keys[i])
+		j.w.WriteByte(':')
+		value, err := json.Marshal(field)
+		if err != nil {
+			return err
+		}
+		j.w.Write(value)
+	}
+	_, err := j.w.WriteString("}\n")
+	return err
+}
+
+func (j *jsonlWriter) close() error { return nil }
+
+// parquetRowWriter writes Parquet through a ParquetWriter, which needs
+// the columns to start.
+type parquetRowWriter struct {
+	w     io.Writer
+	codec ParquetCodec
+	p     *ParquetWriter
+}
+
+func (p *parquetRowWriter) header(columns []string) error {
+	var err error
+	p.p, err = NewParquetWriter(p.w, columns, p.codec)
+	return err
+}
+
+func (p *parquetRowWriter) row(record []string) error { return p.p.Write(record) }
+
+func (p *parquetRowWriter) close() error { return p.p.Close() }
@@ -0,0 +1,179 @@
+package files
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"ping/observability"
+)
+
+func convertString(t *testing.T, input string, opts ConvertOptions) (string, ConvertResult, error) {
+	t.Helper()
+	var out strings.Builder
+	result, err := Convert(context.Background(), strings.NewReader(input), &out, opts)
+	return out.String(), result, err
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		opts  ConvertOptions
+		want  string
+	}{
+		{
+			name:  "csv to tsv",
+			input: "id,name\n1,\"smith, jo\"\n",
+			opts:  ConvertOptions{From: FormatCSV, To: FormatTSV},
+			want:  "id\tname\n1\tsmith, jo\n",
+		},
+		{
+			name:  "tsv to csv",
+			input: "id\tname\n1\tsmith, jo\n",
+			opts:  ConvertOptions{From: FormatTSV, To: FormatCSV},
+			want:  "id,name\n1,\"smith, jo\"\n",
+		},
+		{
+			name:  "csv to jsonl keeps column order",
+			input: "name,id\njo,1\n",
+			opts:  ConvertOptions{From: FormatCSV, To: FormatJSONL},
+			want:  "{\"name\":\"jo\",\"id\":\"1\"}\n",
+		},
+		{
+			name:  "jsonl to csv",
+			input: "{\"id\":1,\"name\":\"jo\",\"tags\":[\"a\"]}\n{\"name\":\"al\",\"id\":null}\n",
+			opts:  ConvertOptions{From: FormatJSONL, To: FormatCSV},
+			want:  "id,name,tags\n1,jo,\"[\"\"a\"\"]\"\n,al,\n",
+		},
+		{
+			name:  "custom delimiters",
+			input: "id;name\n1;jo\n",
+			opts:  ConvertOptions{From: FormatCSV, To: FormatCSV, Delimiter: ';', OutDelimiter: '|'},
+			want:  "id|name\n1|jo\n",
+		},
+		{
+			name:  "quote all",
+			input: "id,name\n1,\"say \"\"hi\"\"\"\n",
+			opts:  ConvertOptions{From: FormatCSV, To: FormatCSV, QuoteAll: true},
+			want:  "\"id\",\"name\"\n\"1\",\"say \"\"hi\"\"\"\n",
+		},
+		{
+			name:  "lazy quotes",
+			input: "id,name\n1,jo \"the\" dev\n",
+			opts:  ConvertOptions{From: FormatCSV, To: FormatTSV, LazyQuotes: true},
+			want:  "id\tname\n1\t\"jo \"\"the\"\" dev\"\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, result, err := convertString(t, tt.input, tt.opts)
+			if err != nil {
+				t.Fatalf("Convert: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+			if result.BytesIn != int64(len(tt.input)) || result.BytesOut != int64(len(got)) {
+				t.Errorf("result = %+v, want %d bytes in and %d out", result, len(tt.input), len(got))
+			}
+		})
+	}
+}
+
+func TestConvertRejectsMalformedInput(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		from  Format
+		want  error
+	}{
+		{"empty csv", "", FormatCSV, ErrInvalidHeader},
+		{"empty jsonl", "", FormatJSONL, ErrInvalidHeader},
+		{"jsonl header not an object", "[1]\n", FormatJSONL, ErrInvalidHeader},
+		{"short csv row", "a,b\n1\n", FormatCSV, ErrMalformedRow},
+		{"bare quote", "a\nx\"y\n", FormatCSV, ErrMalformedRow},
+		{"unknown jsonl key", "{\"a\":1}\n{\"b\":2}\n", FormatJSONL, ErrMalformedRow},
+		{"broken jsonl", "{\"a\":1}\n{\"a\":\n", FormatJSONL, ErrMalformedRow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := convertString(t, tt.input, ConvertOptions{From: tt.from, To: FormatCSV})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for input, want := range map[string]Format{"csv": FormatCSV, "TSV": FormatTSV, "jsonl": FormatJSONL, "ndjson": FormatJSONL} {
+		if got, err := ParseFormat(input); err != nil || got != want {
+			t.Errorf("ParseFormat(%q) = %q, %v, want %q", input, got, err, want)
+		}
+	}
+	if _, err := ParseFormat("xlsx"); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("ParseFormat(xlsx) err = %v, want ErrUnknownFormat", err)
+	}
+}
+
+func TestConvertRecordsMetrics(t *testing.T) {
+	m := observability.NewMetrics(observability.MetricsOptions{})
+
+	input := "id\n1\n"
+	out, _, err := convertString(t, input, ConvertOptions{From: FormatCSV, To: FormatJSONL, Metrics: m})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := testutil.ToFloat64(m.FileConvertBytes.WithLabelValues("in", "csv")); got != float64(len(input)) {
+		t.Errorf("bytes in = %v, want %d", got, len(input))
+	}
+	if got := testutil.ToFloat64(m.FileConvertBytes.WithLabelValues("out", "jsonl")); got != float64(len(out)) {
+		t.Errorf("bytes out = %v, want %d", got, len(out))
+	}
+	if got := testutil.ToFloat64(m.FileProcessCounter); got != 1 {
+		t.Errorf("file_processes_total = %v, want 1", got)
+	}
+}
+
+func TestConvertCompressed(t *testing.T) {
+	observability.InitMetrics()
+	input := "id,name\n1,jo\n"
+	data := compressed(t, CompressionGzip, input)
+	var out bytes.Buffer
+	result, err := Convert(context.Background(), bytes.NewReader(data), &out, ConvertOptions{From: FormatCSV, To: FormatTSV, Compress: CompressionZstd})
+	if err != nil {
+		t.Fatalf("Convert: %v", err)
+	}
+	r, c, err := Decompress(&out)
+	if err != nil || c != CompressionZstd {
+		t.Fatalf("output compression = %q, %v", c, err)
+	}
+	plain, _ := io.ReadAll(r)
+	if string(plain) != "id\tname\n1\tjo\n" {
+		t.Errorf("output = %q", plain)
+	}
+	if result.BytesIn != int64(len(input)) || result.CompressedBytesIn != int64(len(data)) {
+		t.Errorf("result = %+v, want %d bytes in, %d compressed", result, len(input), len(data))
+	}
+	if result.BytesOut != int64(len(plain)) || result.CompressedBytesOut == 0 {
+		t.Errorf("result = %+v, want %d bytes out and a compressed count", result, len(plain))
+	}
+}
+
+func TestConvertFailureWritesNoCompressedOutput(t *testing.T) {
+	observability.InitMetrics()
+	var out bytes.Buffer
+	_, err := Convert(context.Background(), strings.NewReader(""), &out, ConvertOptions{From: FormatCSV, To: FormatTSV, Compress: CompressionGzip})
+	if !errors.Is(err, ErrInvalidHeader) {
+		t.Fatalf("err = %v, want ErrInvalidHeader", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("wrote %d bytes for a failed conversion", out.Len())
+	}
+}
@@ -0,0 +1,382 @@
+// Package files processes uploaded and ingested tabular files as streams,
+// row by row, so memory use does not grow with the size of a file.
+package files
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"ping/observability"
+)
+
+// DefaultMaxErrors is how many row errors a Summary lists when Options
+// does not say.
+const DefaultMaxErrors = 100
+
+// ErrInvalidHeader is returned when the first row cannot name the columns:
+// the file is empty or a column name is blank or repeated.
+var ErrInvalidHeader = errors.New("files: invalid header row")
+
+// RowHandler receives every row that passed validation along with the
+// header. record is reused for the next row, so copy what must outlive
+// the call. An error marks the row invalid; processing goes on.
+type RowHandler func(ctx context.Context, line int, header, record []string) error
+
+// Options tunes ProcessCSV.
+type Options struct {
+	// Comma is the field delimiter. Defaults to ','.
+	Comma rune
+	// MaxErrors caps the row errors listed in the Summary; all invalid
+	// rows are still counted. Defaults to DefaultMaxErrors.
+	MaxErrors int
+	// Handle, when set, receives the valid rows.
+	Handle RowHandler
+	// Workers validates and handles rows on that many goroutines, a chunk
+	// of rows at a time; Handle must then be safe for concurrent use and
+	// sees rows out of order. Defaults to one, handling rows in order as
+	// they are read.
+	Workers int
+	// ChunkRows is how many rows make a chunk when Workers is above one.
+	// Defaults to DefaultChunkRows.
+	ChunkRows int
+	// Schema, when set, checks the values of the columns it lists.
+	Schema *Schema
+	// Rejects, when set, receives the invalid rows as CSV: the line, the
+	// error and the row's fields. With several Workers they come out of
+	// order.
+	Rejects io.Writer
+	// Metrics records the run. Nil uses observability.GetMetrics().
+	Metrics observability.MetricsRecorder
+}
+
+// RowError explains why a row is invalid.
+type RowError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// Summary describes a processed file.
+type Summary struct {
+	Columns   []string `json:"columns"`
+	Rows      int64    `json:"rows"`
+	ValidRows int64    `json:"valid_rows"`
+	Invalid   int64    `json:"invalid_rows"`
+	// Bytes counts the file decompressed; CompressedBytes counts it as
+	// read when it was gzip or zstd compressed.
+	Bytes           int64       `json:"bytes"`
+	Compression     Compression `json:"compression,omitempty"`
+	CompressedBytes int64       `json:"compressed_bytes,omitempty"`
+	DurationMs      float64     `json:"duration_ms"`
+	// Errors lists the first row errors, up to Options.MaxErrors.
+	Errors []RowError `json:"errors,omitempty"`
+	// ColumnErrors counts the values of each schema column that did not
+	// fit it.
+	ColumnErrors map[string]int64 `json:"column_errors,omitempty"`
+	// RejectsFile names the file the invalid rows were written to, when
+	// the caller kept them.
+	RejectsFile string `json:"rejects_file,omitempty"`
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// ProcessCSV reads delimited rows from r one at a time: the first row
+// names the columns, and every further row must have one field per
+// column and be valid UTF-8. Invalid rows are counted and listed in the
+// summary rather than stopping the file; only an invalid header, a read
+// error or ctx ending does. A gzip or zstd compressed r is decompressed
+// on the fly. The run is recorded in the file_process_* metrics.
+func ProcessCSV(ctx context.Context, r io.Reader, opts Options) (Summary, error) {
+	opts.Metrics = observability.RecorderOrDefault(opts.Metrics)
+	start := time.Now()
+	raw := &countingReader{r: r}
+	var summary Summary
+	plain, compression, err := Decompress(raw)
+	if err == nil {
+		counter := &countingReader{r: plain}
+		summary, err = processCSV(ctx, counter, opts)
+		summary.Bytes = counter.n
+		plain.Close()
+	}
+	summary.DurationMs = float64(time.Since(start)) / float64(time.Millisecond)
+
+	metrics := opts.Metrics
+	metrics.RecordFileProcess(time.Since(start).Seconds(), float64(summary.Bytes), err)
+	if compression != CompressionNone {
+		summary.Compression = compression
+		summary.CompressedBytes = raw.n
+		metrics.RecordFileCompressed("in", string(compression), float64(raw.n))
+	}
+	return summary, err
+}
+
+func processCSV(ctx context.Context, r io.Reader, opts Options) (Summary, error) {
+	if opts.MaxErrors <= 0 {
+		opts.MaxErrors = DefaultMaxErrors
+	}
+	if opts.ChunkRows <= 0 {
+		opts.ChunkRows = DefaultChunkRows
+	}
+	reader := csv.NewReader(r)
+	if opts.Comma != 0 {
+		reader.Comma = opts.Comma
+	}
+	// Field counts are checked per row so a short row does not end the file
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	var summary Summary
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return summary, fmt.Errorf("%w: empty file", ErrInvalidHeader)
+	}
+	if err != nil {
+		return summary, headerError(err)
+	}
+	if err := validateHeader(header); err != nil {
+		return summary, err
+	}
+	summary.Columns = append([]string(nil), header...)
+	checker, err := newRowChecker(summary.Columns, opts)
+	if err != nil {
+		return summary, err
+	}
+
+	var t tally
+	if opts.Workers > 1 {
+		err = processChunks(ctx, reader, checker, &t, opts)
+	} else {
+		err = processRows(ctx, reader, checker, &t, opts.Metrics)
+	}
+	if checker.rejects != nil {
+		if flushErr := checker.rejects.flush(); err == nil {
+			err = flushErr
+		}
+	}
+	summary.Rows = t.rows
+	summary.ValidRows = t.valid
+	summary.Invalid = t.invalid
+	summary.Errors = t.errors
+	summary.ColumnErrors = t.columnErrors
+	return summary, err
+}
+
+// processRows checks the rows after the header one by one, in order.
+func processRows(ctx context.Context, reader *csv.Reader, checker *rowChecker, t *tally, metrics observability.MetricsRecorder) error {
+	start := time.Now()
+	for {
+		if t.rows%1024 == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if t.rows > 0 {
+				metrics.SetFileRowsPerSecond(float64(t.rows) / time.Since(start).Seconds())
+			}
+		}
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			metrics.SetFileRowsPerSecond(float64(t.rows) / time.Since(start).Seconds())
+			return nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			checker.process(ctx, t, parseErr.StartLine, nil, parseErr.Err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		line, _ := reader.FieldPos(0)
+		checker.process(ctx, t, line, record, nil)
+	}
+}
+
+// tally counts the rows of a file, or of a chunk of it.
+type tally struct {
+	rows, valid, invalid int64
+	errors               []RowError
+	columnErrors         map[string]int64
+}
+
+// merge adds the counts of other, keeping the errors of the first lines.
+func (t *tally) merge(other tally, maxErrors int) {
+	t.rows += other.rows
+	t.valid += other.valid
+	t.invalid += other.invalid
+	if len(other.errors) > 0 {
+		t.errors = append(t.errors, other.errors...)
+		sort.Slice(t.errors, func(i, j int) bool { return t.errors[i].Line < t.errors[j].Line })
+		if len(t.errors) > maxErrors {
+			t.errors = t.errors[:maxErrors]
+		}
+	}
+	for column, n := range other.columnErrors {
+		if t.columnErrors == nil {
+			t.columnErrors = make(map[string]int64)
+		}
+		t.columnErrors[column] += n
+	}
+}
+
+// rowChecker validates and handles the rows of a file. It is safe for
+// concurrent use as long as the RowHandler is.
+type rowChecker struct {
+	columns   []string
+	schema    []boundColumn
+	handle    RowHandler
+	maxErrors int
+	rejects   *rejectWriter
+}
+
+func newRowChecker(columns []string, opts Options) (*rowChecker, error) {
+	c := &rowChecker{columns: columns, handle: opts.Handle, maxErrors: opts.MaxErrors}
+	if opts.Schema != nil {
+		schema, err := opts.Schema.bind(columns)
+		if err != nil {
+			return nil, err
+		}
+		c.schema = schema
+	}
+	if opts.Rejects != nil {
+		c.rejects = newRejectWriter(opts.Rejects, columns)
+	}
+	return c, nil
+}
+
+// process counts one row in t: valid, or invalid with the error of
+// reading it (readErr) or of checking it.
+func (c *rowChecker) process(ctx context.Context, t *tally, line int, record []string, readErr error) {
+	t.rows++
+	err := readErr
+	if err == nil {
+		err = c.check(ctx, line, record)
+	}
+	if err == nil {
+		t.valid++
+		return
+	}
+	t.invalid++
+	if len(t.errors) < c.maxErrors {
+		t.errors = append(t.errors, RowError{Line: line, Error: err.Error()})
+	}
+	var fieldErr *FieldError
+	if errors.As(err, &fieldErr) {
+		if t.columnErrors == nil {
+			t.columnErrors = make(map[string]int64)
+		}
+		t.columnErrors[fieldErr.Column]++
+	}
+	if c.rejects != nil {
+		c.rejects.write(line, record, err)
+	}
+}
+
+func (c *rowChecker) check(ctx context.Context, line int, record []string) error {
+	if err := validateRecord(record, len(c.columns)); err != nil {
+		return err
+	}
+	if err := checkColumns(c.schema, record); err != nil {
+		return err
+	}
+	if c.handle != nil {
+		return c.handle(ctx, line, c.columns, record)
+	}
+	return nil
+}
+
+// rejectWriter writes invalid rows as CSV: the line, the error and the
+// row's fields, after a header naming them. Writes are serialized, and
+// the first write error is kept for flush.
+type rejectWriter struct {
+	mu      sync.Mutex
+	w       *csv.Writer
+	columns []string
+	started bool
+	err     error
+}
+
+func newRejectWriter(w io.Writer, columns []string) *rejectWriter {
+	return &rejectWriter{w: csv.NewWriter(w), columns: columns}
+}
+
+func (r *rejectWriter) write(line int, record []string, cause error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+	if !r.started {
+		r.started = true
+		r.err = r.w.Write(append([]string{"line", "error"}, r.columns...))
+	}
+	row := append([]string{strconv.Itoa(line), cause.Error()}, record...)
+	if r.err == nil {
+		r.err = r.w.Write(row)
+	}
+}
+
+func (r *rejectWriter) flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.w.Flush()
+	if r.err != nil {
+		return r.err
+	}
+	return r.w.Error()
+}
+
+// headerError reports a malformed header row as ErrInvalidHeader and
+// passes errors of the underlying reader, such as http.MaxBytesError,
+// through.
+func headerError(err error) error {
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return fmt.Errorf("%w: %v", ErrInvalidHeader, parseErr.Err)
+	}
+	return err
+}
+
+func validateHeader(header []string) error {
+	seen := make(map[string]bool, len(header))
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return fmt.Errorf("%w: column %d has no name", ErrInvalidHeader, i+1)
+		}
+		if seen[name] {
+			return fmt.Errorf("%w: column %q appears twice", ErrInvalidHeader, name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+func validateRecord(record []string, columns int) error {
+	if len(record) != columns {
+		return fmt.Errorf("expected %d fields, got %d", columns, len(record))
+	}
+	for i, field := range record {
+		if !utf8.ValidString(field) {
+			return fmt.Errorf("field %d is not valid UTF-8", i+1)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package files
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"ping/observability"
+)
+
+func TestProcessCSVSummarizesValidFile(t *testing.T) {
+	input := "id,name\n1,alice\n2,bob\n"
+	var seen []string
+	summary, err := ProcessCSV(context.Background(), strings.NewReader(input), Options{
+		Handle: func(ctx context.Context, line int, header, record []string) error {
+			seen = append(seen, record[1])
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("ProcessCSV: %v", err)
+	}
+	if strings.Join(summary.Columns, ",") != "id,name" {
+		t.Errorf("columns = %v", summary.Columns)
+	}
+	if summary.Rows != 2 || summary.ValidRows != 2 || summary.Invalid != 0 {
+		t.Errorf("summary = %+v, want 2 valid rows", summary)
+	}
+	if summary.Bytes != int64(len(input)) {
+		t.Errorf("bytes = %d, want %d", summary.Bytes, len(input))
+	}
+	if strings.Join(seen, ",") != "alice,bob" {
+		t.Errorf("handled rows = %v", seen)
+	}
+}
+
+func TestProcessCSVCountsInvalidRows(t *testing.T) {
+	input := "id,name\n1,alice\n2\n3,\"bro\"ken\"\n4,dave\n"
+	summary, err := ProcessCSV(context.Background(), strings.NewReader(input), Options{})
+	if err != nil {
+		t.Fatalf("ProcessCSV: %v", err)
+	}
+	if summary.Rows != 4 || summary.ValidRows != 2 || summary.Invalid != 2 {
+		t.Fatalf("summary = %+v, want 2 valid and 2 invalid rows", summary)
+	}
+	if len(summary.Errors) != 2 || summary.Errors[0].Line != 3 || summary.Errors[1].Line != 4 {
+		t.Errorf("errors = %+v, want lines 3 and 4", summary.Errors)
+	}
+}
+
+func TestProcessCSVCapsListedErrors(t *testing.T) {
+	input := "a,b\n1\n2\n3\n"
+	summary, err := ProcessCSV(context.Background(), strings.NewReader(input), Options{MaxErrors: 2})
+	if err != nil {
+		t.Fatalf("ProcessCSV: %v", err)
+	}
+	if summary.Invalid != 3 || len(summary.Errors) != 2 {
+		t.Errorf("invalid = %d, listed = %d, want 3 and 2", summary.Invalid, len(summary.Errors))
+	}
+}
+
+func TestProcessCSVRejectsInvalidHeader(t *testing.T) {
+	for name, input := range map[string]string{
+		"empty":     "",
+		"blank":     "id,,name\n",
+		"duplicate": "id,name,id\n",
+		"malformed": "id,\"na\"me\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := ProcessCSV(context.Background(), strings.NewReader(input), Options{})
+			if !errors.Is(err, ErrInvalidHeader) {
+				t.Errorf("err = %v, want ErrInvalidHeader", err)
+			}
+		})
+	}
+}
+
+func TestProcessCSVHandlerErrorsMarkRowsInvalid(t *testing.T) {
+	input := "id\n1\n2\n"
+	summary, err := ProcessCSV(context.Background(), strings.NewReader(input), Options{
+		Handle: func(ctx context.Context, line int, header, record []string) error {
+			if record[0] == "2" {
+				return errors.New("duplicate id")
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("ProcessCSV: %v", err)
+	}
+	if summary.ValidRows != 1 || summary.Invalid != 1 || summary.Errors[0].Error != "duplicate id" {
+		t.Errorf("summary = %+v", summary)
+	}
+}
+
+func TestProcessCSVCustomDelimiter(t *testing.T) {
+	input := "id\tname\n1\talice, jr\n"
+	summary, err := ProcessCSV(context.Background(), strings.NewReader(input), Options{Comma: '\t'})
+	if err != nil {
+		t.Fatalf("ProcessCSV: %v", err)
+	}
+	if len(summary.Columns) != 2 || summary.ValidRows != 1 {
+		t.Errorf("summary = %+v", summary)
+	}
+}
+
+func TestProcessCSVStopsWhenCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := ProcessCSV(ctx, strings.NewReader("id\n1\n"), Options{})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
+
+func TestProcessCSVRecordsMetrics(t *testing.T) {
+	m := observability.NewMetrics(observability.MetricsOptions{})
+
+	input := "id\n1\n"
+	if _, err := ProcessCSV(context.Background(), strings.NewReader(input), Options{Metrics: m}); err != nil {
+		t.Fatalf("ProcessCSV: %v", err)
+	}
+	if _, err := ProcessCSV(context.Background(), strings.NewReader(""), Options{Metrics: m}); err == nil {
+		t.Fatal("expected an error for an empty file")
+	}
+
+	if got := testutil.ToFloat64(m.FileProcessCounter); got != 2 {
+		t.Errorf("file_processes_total = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(m.FileProcessErrorCounter); got != 1 {
+		t.Errorf("file_process_errors_total = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.FileProcessBytesCounter); got != float64(len(input)) {
+		t.Errorf("file_process_bytes_total = %v, want %d", got, len(input))
+	}
+}
+
+func TestProcessCSVDecompressesInput(t *testing.T) {
+	m := observability.NewMetrics(observability.MetricsOptions{})
+
+	input := "id,name\n1,alice\n2,bob\n"
+	data := compressed(t, CompressionZstd, input)
+	summary, err := ProcessCSV(context.Background(), bytes.NewReader(data), Options{Metrics: m})
+	if err != nil {
+		t.Fatalf("ProcessCSV: %v", err)
+	}
+	if summary.ValidRows != 2 || summary.Compression != CompressionZstd {
+		t.Errorf("summary = %+v", summary)
+	}
+	if summary.Bytes != int64(len(input)) || summary.CompressedBytes != int64(len(data)) {
+		t.Errorf("bytes = %d/%d, want %d/%d", summary.Bytes, summary.CompressedBytes, len(input), len(data))
+	}
+	if got := testutil.ToFloat64(m.FileProcessBytesCounter); got != float64(len(input)) {
+		t.Errorf("file_process_bytes_total = %v, want %d", got, len(input))
+	}
+	if got := testutil.ToFloat64(m.FileCompressedBytes.WithLabelValues("in", "zstd")); got != float64(len(data)) {
+		t.Errorf("file_compressed_bytes_total = %v, want %d", got, len(data))
+	}
+}
@@ -0,0 +1,385 @@
+package files
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// ParquetCodec is the compression of the pages of a Parquet file.
+type ParquetCodec string
+
+// Supported Parquet codecs.
+const (
+	ParquetUncompressed ParquetCodec = "uncompressed"
+	ParquetSnappy       ParquetCodec = "snappy"
+	ParquetGzip         ParquetCodec = "gzip"
+	ParquetZstd         ParquetCodec = "zstd"
+)
+
+// DefaultParquetRowGroupBytes is how much column data a ParquetWriter
+// buffers before writing it out as a row group.
+const DefaultParquetRowGroupBytes = 8 << 20
+
+// ErrUnknownParquetCodec is returned for a codec name ParseParquetCodec
+// does not know.
+var ErrUnknownParquetCodec = errors.New("files: unknown parquet codec")
+
+// ParseParquetCodec returns the codec named s, defaulting to snappy.
+func ParseParquetCodec(s string) (ParquetCodec, error) {
+	switch c := ParquetCodec(strings.ToLower(s)); c {
+	case "":
+		return ParquetSnappy, nil
+	case "none":
+		return ParquetUncompressed, nil
+	case ParquetUncompressed, ParquetSnappy, ParquetGzip, ParquetZstd:
+		return c, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrUnknownParquetCodec, s)
+}
+
+// Values of the Parquet format's Thrift enums.
+const (
+	parquetByteArray     = 6 // Type.BYTE_ARRAY
+	parquetRequired      = 0 // FieldRepetitionType.REQUIRED
+	parquetUTF8          = 0 // ConvertedType.UTF8
+	parquetPlain         = 0 // Encoding.PLAIN
+	parquetRLE           = 3 // Encoding.RLE
+	parquetDataPage      = 0 // PageType.DATA_PAGE
+	parquetFormatVersion = 1
+	parquetMagic         = "PAR1"
+	parquetCreatedBy     = "ping"
+	parquetCodecNone     = 0
+	parquetCodecSnappy   = 1
+	parquetCodecGzip     = 2
+	parquetCodecZstd     = 6
+)
+
+// parquetChunk describes a written column chunk for the footer.
+type parquetChunk struct {
+	offset           int64
+	uncompressedSize int64
+	compressedSize   int64
+}
+
+// parquetRowGroup describes a written row group for the footer.
+type parquetRowGroup struct {
+	rows   int64
+	chunks []parquetChunk
+}
+
+// ParquetWriter writes rows of string columns as a Parquet file: every
+// column is a required UTF-8 byte array, PLAIN encoded in one data page
+// per row group. Rows are buffered column by column until about
+// DefaultParquetRowGroupBytes of data, so memory stays bounded whatever
+// the number of rows.
+type ParquetWriter struct {
+	w        *countingWriter
+	columns  []string
+	codec    ParquetCodec
+	zstd     *zstd.Encoder
+	values   []bytes.Buffer
+	buffered int
+	rows     int64
+	total    int64
+	groups   []parquetRowGroup
+	groupMax int
+}
+
+// NewParquetWriter starts a Parquet file with the given columns on w.
+func NewParquetWriter(w io.Writer, columns []string, codec ParquetCodec) (*ParquetWriter, error) {
+	p := &ParquetWriter{
+		w:        &countingWriter{w: w},
+		columns:  columns,
+		codec:    codec,
+		values:   make([]bytes.Buffer, len(columns)),
+		groupMax: DefaultParquetRowGroupBytes,
+	}
+	switch codec {
+	case ParquetUncompressed, ParquetSnappy, ParquetGzip:
+	case ParquetZstd:
+		enc, err := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		p.zstd = enc
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownParquetCodec, codec)
+	}
+	if _, err := io.WriteString(p.w, parquetMagic); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Write adds a row with one field per column.
+func (p *ParquetWriter) Write(record []string) error {
+	if len(record) != len(p.columns) {
+		return fmt.Errorf("%w: expected %d fields, got %d", ErrMalformedRow, len(p.columns), len(record))
+	}
+	var size [4]byte
+	for i, field := range record {
+		binary.LittleEndian.PutUint32(size[:], uint32(len(field)))
+		p.values[i].Write(size[:])
+		p.values[i].WriteString(field)
+		p.buffered += len(size) + len(field)
+	}
+	p.rows++
+	if p.buffered >= p.groupMax {
+		return p.flushRowGroup()
+	}
+	return nil
+}
+
+// Close writes the buffered rows and the footer. It does not close the
+// underlying writer.
+func (p *ParquetWriter) Close() error {
+	if p.zstd != nil {
+		defer p.zstd.Close()
+	}
+	if p.rows > 0 || len(p.groups) == 0 {
+		if err := p.flushRowGroup(); err != nil {
+			return err
+		}
+	}
+	footer := p.footer()
+	if _, err := p.w.Write(footer); err != nil {
+		return err
+	}
+	var size [4]byte
+	binary.LittleEndian.PutUint32(size[:], uint32(len(footer)))
+	if _, err := p.w.Write(size[:]); err != nil {
+		return err
+	}
+	_, err := io.WriteString(p.w, parquetMagic)
+	return err
+}
+
+// flushRowGroup writes the buffered rows as a row group.
+func (p *ParquetWriter) flushRowGroup() error {
+	group := parquetRowGroup{rows: p.rows, chunks: make([]parquetChunk, len(p.columns))}
+	for i := range p.values {
+		data := p.values[i].Bytes()
+		page, err := p.compress(data)
+		if err != nil {
+			return err
+		}
+		var header compactWriter
+		header.begin()
+		header.i32(1, parquetDataPage)
+		header.i32(2, int32(len(data)))
+		header.i32(3, int32(len(page)))
+		header.beginStruct(5) // DataPageHeader
+		header.i32(1, int32(p.rows))
+		header.i32(2, parquetPlain)
+		header.i32(3, parquetRLE)
+		header.i32(4, parquetRLE)
+		header.end()
+		header.end()
+
+		chunk := parquetChunk{
+			offset:           p.w.n,
+			uncompressedSize: int64(header.buf.Len() + len(data)),
+			compressedSize:   int64(header.buf.Len() + len(page)),
+		}
+		if _, err := p.w.Write(header.buf.Bytes()); err != nil {
+			return err
+		}
+		if _, err := p.w.Write(page); err != nil {
+			return err
+		}
+		group.chunks[i] = chunk
+		p.values[i].Reset()
+	}
+	p.groups = append(p.groups, group)
+	p.total += p.rows
+	p.rows = 0
+	p.buffered = 0
+	return nil
+}
+
+func (p *ParquetWriter) compress(data []byte) ([]byte, error) {
+	switch p.codec {
+	case ParquetSnappy:
+		return snappy.Encode(nil, data), nil
+	case ParquetGzip:
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case ParquetZstd:
+		return p.zstd.EncodeAll(data, nil), nil
+	}
+	return data, nil
+}
+
+func (p *ParquetWriter) codecID() int32 {
+	switch p.codec {
+	case ParquetSnappy:
+		return parquetCodecSnappy
+	case ParquetGzip:
+		return parquetCodecGzip
+	case ParquetZstd:
+		return parquetCodecZstd
+	}
+	return parquetCodecNone
+}
+
+// footer encodes the FileMetaData.
+func (p *ParquetWriter) footer() []byte {
+	var c compactWriter
+	c.begin()
+	c.i32(1, parquetFormatVersion)
+
+	c.listHeader(2, compactStruct, len(p.columns)+1)
+	c.beginElem() // the root of the schema
+	c.binary(4, "schema")
+	c.i32(5, int32(len(p.columns)))
+	c.end()
+	for _, name := range p.columns {
+		c.beginElem()
+		c.i32(1, parquetByteArray)
+		c.i32(3, parquetRequired)
+		c.binary(4, name)
+		c.i32(6, parquetUTF8)
+		c.beginStruct(10) // LogicalType
+		c.beginStruct(1)  // STRING
+		c.end()
+		c.end()
+		c.end()
+	}
+
+	c.i64(3, p.total)
+	c.listHeader(4, compactStruct, len(p.groups))
+	for _, group := range p.groups {
+		c.beginElem()
+		var uncompressed, compressed int64
+		c.listHeader(1, compactStruct, len(group.chunks))
+		for i, chunk := range group.chunks {
+			uncompressed += chunk.uncompressedSize
+			compressed += chunk.compressedSize
+			c.beginElem()
+			c.i64(2, chunk.offset)
+			c.beginStruct(3) // ColumnMetaData
+			c.i32(1, parquetByteArray)
+			c.listHeader(2, compactI32, 1)
+			c.varint(uint64(zigzag32(parquetPlain)))
+			c.listHeader(3, compactBinary, 1)
+			c.rawBinary(p.columns[i])
+			c.i32(4, p.codecID())
+			c.i64(5, group.rows)
+			c.i64(6, chunk.uncompressedSize)
+			c.i64(7, chunk.compressedSize)
+			c.i64(9, chunk.offset)
+			c.end()
+			c.end()
+		}
+		c.i64(2, uncompressed)
+		c.i64(3, group.rows)
+		if len(group.chunks) > 0 {
+			c.i64(5, group.chunks[0].offset)
+		}
+		c.i64(6, compressed)
+		c.end()
+	}
+	c.binary(6, parquetCreatedBy)
+	c.end()
+	return c.buf.Bytes()
+}
+
+// Thrift compact protocol type ids.
+const (
+	compactI32    = 5
+	compactI64    = 6
+	compactBinary = 8
+	compactList   = 9
+	compactStruct = 12
+)
+
+// compactWriter encodes Thrift structs with the compact protocol, which
+// the Parquet footer and page headers use. Structs are written field by
+// field between begin or beginStruct and end.
+type compactWriter struct {
+	buf  bytes.Buffer
+	last []int16 // id of the last field written, per open struct
+}
+
+// begin opens a top-level struct or a struct that is a list element.
+func (c *compactWriter) begin() { c.last = append(c.last, 0) }
+
+// beginElem opens a struct that is a list element.
+func (c *compactWriter) beginElem() { c.begin() }
+
+// beginStruct opens a struct field.
+func (c *compactWriter) beginStruct(id int16) {
+	c.field(id, compactStruct)
+	c.begin()
+}
+
+// end closes the innermost struct.
+func (c *compactWriter) end() {
+	c.buf.WriteByte(0)
+	c.last = c.last[:len(c.last)-1]
+}
+
+func (c *compactWriter) field(id int16, typ byte) {
+	last := &c.last[len(c.last)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		c.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		c.buf.WriteByte(typ)
+		c.varint(uint64(zigzag32(int32(id))))
+	}
+	*last = id
+}
+
+func (c *compactWriter) i32(id int16, v int32) {
+	c.field(id, compactI32)
+	c.varint(uint64(zigzag32(v)))
+}
+
+func (c *compactWriter) i64(id int16, v int64) {
+	c.field(id, compactI64)
+	c.varint(uint64(v<<1) ^ uint64(v>>63))
+}
+
+func (c *compactWriter) binary(id int16, s string) {
+	c.field(id, compactBinary)
+	c.rawBinary(s)
+}
+
+func (c *compactWriter) rawBinary(s string) {
+	c.varint(uint64(len(s)))
+	c.buf.WriteString(s)
+}
+
+func (c *compactWriter) listHeader(id int16, elem byte, size int) {
+	c.field(id, compactList)
+	if size < 15 {
+		c.buf.WriteByte(byte(size)<<4 | elem)
+		return
+	}
+	c.buf.WriteByte(0xf0 | elem)
+	c.varint(uint64(size))
+}
+
+func (c *compactWriter) varint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	c.buf.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+func zigzag32(v int32) uint32 {
+	return uint32(v<<1) ^ uint32(v>>31)
+}
@@ -0,0 +1,320 @@
+package files
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// compactReader decodes the Thrift compact structs the writer produces
+// into maps from field id to value: int64, string, []any or a nested map.
+type compactReader struct {
+	t    *testing.T
+	data []byte
+	pos  int
+}
+
+func (c *compactReader) byte() byte {
+	if c.pos >= len(c.data) {
+		c.t.Fatal("compact struct runs past the data")
+	}
+	b := c.data[c.pos]
+	c.pos++
+	return b
+}
+
+func (c *compactReader) uvarint() uint64 {
+	v, n := binary.Uvarint(c.data[c.pos:])
+	if n <= 0 {
+		c.t.Fatal("bad varint")
+	}
+	c.pos += n
+	return v
+}
+
+func (c *compactReader) zigzag() int64 {
+	v := c.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (c *compactReader) value(typ byte) any {
+	switch typ {
+	case compactI32, compactI64:
+		return c.zigzag()
+	case compactBinary:
+		n := int(c.uvarint())
+		s := string(c.data[c.pos : c.pos+n])
+		c.pos += n
+		return s
+	case compactList:
+		header := c.byte()
+		size, elem := int(header>>4), header&0x0f
+		if size == 15 {
+			size = int(c.uvarint())
+		}
+		list := make([]any, size)
+		for i := range list {
+			list[i] = c.value(elem)
+		}
+		return list
+	case compactStruct:
+		return c.readStruct()
+	}
+	c.t.Fatalf("unexpected compact type %d", typ)
+	return nil
+}
+
+func (c *compactReader) readStruct() map[int16]any {
+	fields := map[int16]any{}
+	var last int16
+	for {
+		header := c.byte()
+		if header == 0 {
+			return fields
+		}
+		typ := header & 0x0f
+		if delta := int16(header >> 4); delta != 0 {
+			last += delta
+		} else {
+			last = int16(c.zigzag())
+		}
+		fields[last] = c.value(typ)
+	}
+}
+
+// parquetFile is what the tests read back of a written file.
+type parquetFile struct {
+	columns []string
+	rows    int64
+	codecs  []int64
+	// values holds the values of every column, across row groups.
+	values [][]string
+	groups int
+}
+
+func readParquet(t *testing.T, data []byte) parquetFile {
+	t.Helper()
+	if len(data) < 12 || string(data[:4]) != "PAR1" || string(data[len(data)-4:]) != "PAR1" {
+		t.Fatalf("missing PAR1 magic in %q", data)
+	}
+	size := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footer := &compactReader{t: t, data: data[len(data)-8-size : len(data)-8]}
+	meta := footer.readStruct()
+	if footer.pos != size {
+		t.Fatalf("footer decoded %d of %d bytes", footer.pos, size)
+	}
+
+	var f parquetFile
+	f.rows = meta[3].(int64)
+	schema := meta[2].([]any)
+	if root := schema[0].(map[int16]any); root[5].(int64) != int64(len(schema)-1) {
+		t.Fatalf("root num_children = %v, want %d", root[5], len(schema)-1)
+	}
+	for _, element := range schema[1:] {
+		e := element.(map[int16]any)
+		if e[1].(int64) != parquetByteArray || e[3].(int64) != parquetRequired || e[6].(int64) != parquetUTF8 {
+			t.Errorf("schema element = %v, want a required UTF-8 byte array", e)
+		}
+		f.columns = append(f.columns, e[4].(string))
+	}
+	f.values = make([][]string, len(f.columns))
+
+	var rows int64
+	for _, g := range meta[4].([]any) {
+		group := g.(map[int16]any)
+		rows += group[3].(int64)
+		f.groups++
+		for i, c := range group[1].([]any) {
+			chunk := c.(map[int16]any)[3].(map[int16]any)
+			if path := chunk[3].([]any); len(path) != 1 || path[0] != f.columns[i] {
+				t.Errorf("path_in_schema = %v, want [%s]", path, f.columns[i])
+			}
+			if chunk[5].(int64) != group[3].(int64) {
+				t.Errorf("column num_values = %v, want %v", chunk[5], group[3])
+			}
+			if i == 0 {
+				f.codecs = append(f.codecs, chunk[4].(int64))
+			}
+			offset := chunk[9].(int64)
+			page := &compactReader{t: t, data: data[offset:]}
+			header := page.readStruct()
+			if page.pos+int(header[3].(int64)) != int(chunk[7].(int64)) {
+				t.Errorf("total_compressed_size = %v, want header and page", chunk[7])
+			}
+			body := data[offset+int64(page.pos) : offset+int64(page.pos)+header[3].(int64)]
+			plain := decompressPage(t, chunk[4].(int64), body)
+			if int64(len(plain)) != header[2].(int64) {
+				t.Errorf("uncompressed page = %d bytes, header says %v", len(plain), header[2])
+			}
+			for len(plain) > 0 {
+				n := binary.LittleEndian.Uint32(plain)
+				f.values[i] = append(f.values[i], string(plain[4:4+n]))
+				plain = plain[4+n:]
+			}
+		}
+	}
+	if rows != f.rows {
+		t.Errorf("row groups hold %d rows, footer says %d", rows, f.rows)
+	}
+	return f
+}
+
+func decompressPage(t *testing.T, codec int64, page []byte) []byte {
+	t.Helper()
+	var plain []byte
+	var err error
+	switch codec {
+	case parquetCodecNone:
+		plain = page
+	case parquetCodecSnappy:
+		plain, err = snappy.Decode(nil, page)
+	case parquetCodecGzip:
+		var zr *gzip.Reader
+		if zr, err = gzip.NewReader(bytes.NewReader(page)); err == nil {
+			plain, err = io.ReadAll(zr)
+		}
+	case parquetCodecZstd:
+		var zr *zstd.Decoder
+		if zr, err = zstd.NewReader(nil); err == nil {
+			plain, err = zr.DecodeAll(page, nil)
+			zr.Close()
+		}
+	default:
+		t.Fatalf("unexpected codec %d", codec)
+	}
+	if err != nil {
+		t.Fatalf("decompress page: %v", err)
+	}
+	return plain
+}
+
+func TestParquetWriterCodecs(t *testing.T) {
+	for codec, id := range map[ParquetCodec]int64{
+		ParquetUncompressed: parquetCodecNone,
+		ParquetSnappy:       parquetCodecSnappy,
+		ParquetGzip:         parquetCodecGzip,
+		ParquetZstd:         parquetCodecZstd,
+	} {
+		t.Run(string(codec), func(t *testing.T) {
+			var buf bytes.Buffer
+			p, err := NewParquetWriter(&buf, []string{"id", "name"}, codec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, row := range [][]string{{"1", "alice"}, {"2", ""}, {"3", "zoë"}} {
+				if err := p.Write(row); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := p.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			f := readParquet(t, buf.Bytes())
+			if strings.Join(f.columns, ",") != "id,name" || f.rows != 3 {
+				t.Fatalf("columns = %v, rows = %d", f.columns, f.rows)
+			}
+			if len(f.codecs) != 1 || f.codecs[0] != id {
+				t.Errorf("codecs = %v, want %d", f.codecs, id)
+			}
+			if got := strings.Join(f.values[1], "|"); got != "alice||zoë" {
+				t.Errorf("name values = %q", got)
+			}
+		})
+	}
+}
+
+func TestParquetWriterSplitsRowGroups(t *testing.T) {
+	var buf bytes.Buffer
+	p, err := NewParquetWriter(&buf, []string{"n"}, ParquetSnappy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.groupMax = 32
+	for i := 0; i < 10; i++ {
+		if err := p.Write([]string{strings.Repeat("x", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f := readParquet(t, buf.Bytes())
+	if f.groups < 2 || f.rows != 10 || len(f.values[0]) != 10 || f.values[0][9] != "xxxxxxxxx" {
+		t.Errorf("groups = %d, rows = %d, values = %v", f.groups, f.rows, f.values[0])
+	}
+}
+
+func TestParquetWriterWithoutRows(t *testing.T) {
+	var buf bytes.Buffer
+	p, err := NewParquetWriter(&buf, []string{"id"}, ParquetUncompressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if f := readParquet(t, buf.Bytes()); f.rows != 0 || len(f.columns) != 1 {
+		t.Errorf("file = %+v, want one column and no rows", f)
+	}
+}
+
+func TestParquetWriterRejectsShortRows(t *testing.T) {
+	p, err := NewParquetWriter(io.Discard, []string{"a", "b"}, ParquetSnappy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Write([]string{"1"}); !errors.Is(err, ErrMalformedRow) {
+		t.Errorf("err = %v, want ErrMalformedRow", err)
+	}
+}
+
+func TestParseParquetCodec(t *testing.T) {
+	for in, want := range map[string]ParquetCodec{"": ParquetSnappy, "none": ParquetUncompressed, "ZSTD": ParquetZstd} {
+		if got, err := ParseParquetCodec(in); err != nil || got != want {
+			t.Errorf("ParseParquetCodec(%q) = %q, %v, want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseParquetCodec("lz4"); !errors.Is(err, ErrUnknownParquetCodec) {
+		t.Errorf("err = %v, want ErrUnknownParquetCodec", err)
+	}
+}
+
+func TestConvertToParquet(t *testing.T) {
+	var buf bytes.Buffer
+	input := `{"id":1,"name":"alice"}` + "\n" + `{"id":2,"name":"bob"}` + "\n"
+	result, err := Convert(context.Background(), strings.NewReader(input), &buf, ConvertOptions{
+		From: FormatJSONL, To: FormatParquet, ParquetCodec: ParquetZstd,
+	})
+	if err != nil {
+		t.Fatalf("Convert: %v", err)
+	}
+	f := readParquet(t, buf.Bytes())
+	if result.Rows != 2 || f.rows != 2 || strings.Join(f.values[1], ",") != "alice,bob" {
+		t.Errorf("result = %+v, file = %+v", result, f)
+	}
+	if f.codecs[0] != parquetCodecZstd {
+		t.Errorf("codec = %d, want zstd", f.codecs[0])
+	}
+
+	_, err = Convert(context.Background(), strings.NewReader("id\n1\n"), io.Discard, ConvertOptions{
+		From: FormatCSV, To: FormatParquet, Compress: CompressionGzip,
+	})
+	if !errors.Is(err, ErrUnknownCompression) {
+		t.Errorf("err = %v, want ErrUnknownCompression for compressed parquet", err)
+	}
+	_, err = Convert(context.Background(), strings.NewReader("PAR1"), io.Discard, ConvertOptions{
+		From: FormatParquet, To: FormatCSV,
+	})
+	if !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("err = %v, want ErrUnknownFormat for parquet input", err)
+	}
+}
@@ -0,0 +1,222 @@
+package files
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ColumnType is the type a column's values must parse as.
+type ColumnType string
+
+// Supported column types.
+const (
+	TypeString    ColumnType = "string"
+	TypeInt       ColumnType = "int"
+	TypeFloat     ColumnType = "float"
+	TypeBool      ColumnType = "bool"
+	TypeDate      ColumnType = "date"      // 2006-01-02
+	TypeTimestamp ColumnType = "timestamp" // RFC 3339
+)
+
+// ErrInvalidSchema is returned for a schema that cannot be used.
+var ErrInvalidSchema = errors.New("files: invalid schema")
+
+// Column describes one column of a Schema.
+type Column struct {
+	Name string `json:"name"`
+	// Type defaults to string.
+	Type ColumnType `json:"type,omitempty"`
+	// Required columns must be in the header and have a value in every
+	// row; empty values of other columns are not checked.
+	Required bool `json:"required,omitempty"`
+	// Pattern is a regular expression the whole value must match.
+	Pattern string `json:"pattern,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// Schema describes the columns of a file. Columns of the file it does
+// not list are not checked.
+type Schema struct {
+	Columns []Column `json:"columns"`
+}
+
+// FieldError is a value that does not fit its column.
+type FieldError struct {
+	Column string
+	Err    error
+}
+
+func (e *FieldError) Error() string { return fmt.Sprintf("column %q: %v", e.Column, e.Err) }
+func (e *FieldError) Unwrap() error { return e.Err }
+
+// ParseSchema reads a schema from JSON, e.g.
+//
+//	{"columns": [{"name": "id", "type": "int", "required": true},
+//	             {"name": "email", "pattern": "[^@]+@[^@]+"}]}
+func ParseSchema(data []byte) (*Schema, error) {
+	var s Schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSchema, err)
+	}
+	if len(s.Columns) == 0 {
+		return nil, fmt.Errorf("%w: no columns", ErrInvalidSchema)
+	}
+	seen := make(map[string]bool, len(s.Columns))
+	for i := range s.Columns {
+		c := &s.Columns[i]
+		if c.Name == "" || seen[c.Name] {
+			return nil, fmt.Errorf("%w: column %d has no name or a repeated one", ErrInvalidSchema, i+1)
+		}
+		seen[c.Name] = true
+		switch c.Type {
+		case "":
+			c.Type = TypeString
+		case TypeString, TypeInt, TypeFloat, TypeBool, TypeDate, TypeTimestamp:
+		default:
+			return nil, fmt.Errorf("%w: column %q has unknown type %q", ErrInvalidSchema, c.Name, c.Type)
+		}
+		if c.Pattern != "" {
+			re, err := regexp.Compile("^(?:" + c.Pattern + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("%w: column %q: %v", ErrInvalidSchema, c.Name, err)
+			}
+			c.re = re
+		}
+	}
+	return &s, nil
+}
+
+// LoadSchemas reads every <name>.json file of dir as the schema called
+// name.
+func LoadSchemas(dir string) (map[string]*Schema, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	schemas := make(map[string]*Schema, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		s, err := ParseSchema(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+		}
+		schemas[strings.TrimSuffix(filepath.Base(path), ".json")] = s
+	}
+	return schemas, nil
+}
+
+// boundColumn is a schema column found at index of the header.
+type boundColumn struct {
+	*Column
+	index int
+}
+
+// bind matches the schema to a header, failing with ErrInvalidHeader
+// when a required column is missing.
+func (s *Schema) bind(header []string) ([]boundColumn, error) {
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		index[strings.TrimSpace(name)] = i
+	}
+	var bound []boundColumn
+	for i := range s.Columns {
+		c := &s.Columns[i]
+		at, ok := index[c.Name]
+		if !ok {
+			if c.Required {
+				return nil, fmt.Errorf("%w: required column %q is missing", ErrInvalidHeader, c.Name)
+			}
+			continue
+		}
+		bound = append(bound, boundColumn{Column: c, index: at})
+	}
+	return bound, nil
+}
+
+// checkColumns returns a *FieldError for the first value of record that
+// does not fit its column.
+func checkColumns(columns []boundColumn, record []string) error {
+	for _, c := range columns {
+		if err := c.check(record[c.index]); err != nil {
+			return &FieldError{Column: c.Name, Err: err}
+		}
+	}
+	return nil
+}
+
+func (c *Column) check(value string) error {
+	if value == "" {
+		if c.Required {
+			return errors.New("value is required")
+		}
+		return nil
+	}
+	var err error
+	switch c.Type {
+	case TypeInt:
+		_, err = strconv.ParseInt(value, 10, 64)
+	case TypeFloat:
+		_, err = strconv.ParseFloat(value, 64)
+	case TypeBool:
+		_, err = strconv.ParseBool(value)
+	case TypeDate:
+		_, err = time.Parse(time.DateOnly, value)
+	case TypeTimestamp:
+		_, err = time.Parse(time.RFC3339, value)
+	}
+	if err != nil {
+		return fmt.Errorf("%q is not a valid %s", value, c.Type)
+	}
+	if c.re != nil && !c.re.MatchString(value) {
+		return fmt.Errorf("%q does not match %s", value, c.Pattern)
+	}
+	return nil
+}
+
+// LazyFile is a writer that creates its file on the first write, so
+// rejects that never come leave no empty file behind.
+type LazyFile struct {
+	path string
+	f    *os.File
+	err  error
+}
+
+// NewLazyFile returns a LazyFile for path.
+func NewLazyFile(path string) *LazyFile {
+	return &LazyFile{path: path}
+}
+
+func (l *LazyFile) Write(p []byte) (int, error) {
+	if l.f == nil && l.err == nil {
+		l.f, l.err = os.Create(l.path)
+	}
+	if l.err != nil {
+		return 0, l.err
+	}
+	return l.f.Write(p)
+}
+
+// Written reports whether the file was created.
+func (l *LazyFile) Written() bool { return l.f != nil }
+
+// Path returns the path of the file.
+func (l *LazyFile) Path() string { return l.path }
+
+// Close closes the file if it was created.
+func (l *LazyFile) Close() error {
+	if l.f == nil {
+		return nil
+	}
+	return l.f.Close()
+}
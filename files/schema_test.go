@@ -0,0 +1,143 @@
+package files
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"ping/observability"
+)
+
+const ordersSchema = `{"columns": [
+	{"name": "id", "type": "int", "required": true},
+	{"name": "amount", "type": "float"},
+	{"name": "paid", "type": "bool"},
+	{"name": "day", "type": "date"},
+	{"name": "at", "type": "timestamp"},
+	{"name": "email", "pattern": "[^@]+@[^@]+"},
+	{"name": "unused"}
+]}`
+
+func mustSchema(t *testing.T, data string) *Schema {
+	t.Helper()
+	s, err := ParseSchema([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestParseSchemaRejectsBadSchemas(t *testing.T) {
+	for name, data := range map[string]string{
+		"not json":     `{`,
+		"no columns":   `{"columns": []}`,
+		"unnamed":      `{"columns": [{"type": "int"}]}`,
+		"repeated":     `{"columns": [{"name": "a"}, {"name": "a"}]}`,
+		"unknown type": `{"columns": [{"name": "a", "type": "money"}]}`,
+		"bad pattern":  `{"columns": [{"name": "a", "pattern": "("}]}`,
+	} {
+		if _, err := ParseSchema([]byte(data)); !errors.Is(err, ErrInvalidSchema) {
+			t.Errorf("%s: err = %v, want ErrInvalidSchema", name, err)
+		}
+	}
+}
+
+func TestProcessCSVChecksSchema(t *testing.T) {
+	observability.InitMetrics()
+	input := "id,amount,paid,day,at,email\n" +
+		"1,9.5,true,2024-02-29,2024-02-29T10:00:00Z,a@b\n" +
+		"2,,,,,\n" +
+		",1,true,2024-01-01,2024-01-01T00:00:00Z,a@b\n" +
+		"x,1,true,2024-01-01,2024-01-01T00:00:00Z,a@b\n" +
+		"5,much,true,2024-01-01,2024-01-01T00:00:00Z,a@b\n" +
+		"6,1,sure,2024-01-01,2024-01-01T00:00:00Z,a@b\n" +
+		"7,1,true,2024-13-01,2024-01-01T00:00:00Z,a@b\n" +
+		"8,1,true,2024-01-01,yesterday,a@b\n" +
+		"9,1,true,2024-01-01,2024-01-01T00:00:00Z,nobody\n"
+	summary, err := ProcessCSV(context.Background(), strings.NewReader(input), Options{Schema: mustSchema(t, ordersSchema)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.ValidRows != 2 || summary.Invalid != 7 {
+		t.Fatalf("summary = %+v, want 2 valid and 7 invalid rows", summary)
+	}
+	want := map[string]int64{"id": 2, "amount": 1, "paid": 1, "day": 1, "at": 1, "email": 1}
+	for column, n := range want {
+		if summary.ColumnErrors[column] != n {
+			t.Errorf("column errors = %v, want %v", summary.ColumnErrors, want)
+			break
+		}
+	}
+	if summary.Errors[0].Line != 4 || !strings.Contains(summary.Errors[0].Error, `column "id"`) {
+		t.Errorf("first error = %+v", summary.Errors[0])
+	}
+}
+
+func TestProcessCSVRequiresSchemaColumns(t *testing.T) {
+	observability.InitMetrics()
+	_, err := ProcessCSV(context.Background(), strings.NewReader("amount\n1\n"), Options{Schema: mustSchema(t, ordersSchema)})
+	if !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("err = %v, want ErrInvalidHeader", err)
+	}
+}
+
+func TestProcessCSVWritesRejects(t *testing.T) {
+	observability.InitMetrics()
+	input := "id,note\n1,ok\nx,bad id\n3\n4,fine\n"
+	for _, workers := range []int{1, 3} {
+		var rejects strings.Builder
+		_, err := ProcessCSV(context.Background(), strings.NewReader(input), Options{
+			Schema:    mustSchema(t, `{"columns": [{"name": "id", "type": "int"}]}`),
+			Rejects:   &rejects,
+			Workers:   workers,
+			ChunkRows: 1,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The short row stays short in the rejects
+		reader := csv.NewReader(strings.NewReader(rejects.String()))
+		reader.FieldsPerRecord = -1
+		records, err := reader.ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 3 || strings.Join(records[0], ",") != "line,error,id,note" {
+			t.Fatalf("workers=%d: rejects = %q", workers, rejects.String())
+		}
+		body := records[1:]
+		sort.Slice(body, func(i, j int) bool { return body[i][0] < body[j][0] })
+		if body[0][0] != "3" || body[0][2] != "x" || body[1][0] != "4" {
+			t.Errorf("workers=%d: rejected rows = %q", workers, body)
+		}
+	}
+}
+
+func TestLoadSchemas(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "orders.json"), []byte(ordersSchema), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "README.md"), []byte("not a schema"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	schemas, err := LoadSchemas(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schemas) != 1 || schemas["orders"] == nil {
+		t.Errorf("schemas = %v, want orders", schemas)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "broken.json"), []byte(`{}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadSchemas(dir); !errors.Is(err, ErrInvalidSchema) {
+		t.Errorf("err = %v, want ErrInvalidSchema", err)
+	}
+}
@@ -0,0 +1,346 @@
+package files
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"ping/observability"
+)
+
+// Part sizes of multipart uploads. S3 refuses parts under 5 MiB other
+// than the last.
+const (
+	DefaultUploadPartSize = 16 << 20
+	MinUploadPartSize     = 5 << 20
+)
+
+// BucketConfig configures a Bucket.
+type BucketConfig struct {
+	// Endpoint is the base URL of the S3 API, e.g.
+	// https://s3.eu-west-1.amazonaws.com, a MinIO server, or
+	// https://storage.googleapis.com for GCS with HMAC keys. Buckets are
+	// addressed by path, so one endpoint serves every bucket.
+	Endpoint string
+	// Region signs the requests. Defaults to us-east-1; GCS takes auto.
+	Region string
+	// Bucket receives the files.
+	Bucket string
+	// Prefix is prepended to every key, e.g. processed/.
+	Prefix string
+	// AccessKeyID and SecretAccessKey sign the requests; SessionToken is
+	// added for temporary credentials.
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// PartSize is the size of the parts of a multipart upload; smaller
+	// files are sent at once. Defaults to DefaultUploadPartSize.
+	PartSize int
+	// Client sends the requests. Defaults to a client with a 5m timeout.
+	Client *http.Client
+	// Metrics records the uploads. Nil uses observability.GetMetrics().
+	Metrics observability.MetricsRecorder
+}
+
+// Bucket uploads files to an S3-compatible bucket, signing the requests
+// with AWS Signature Version 4. Files over the part size go up as
+// multipart uploads, one part in memory at a time.
+type Bucket struct {
+	cfg BucketConfig
+	now func() time.Time
+}
+
+// NewBucket returns a Bucket for cfg.
+func NewBucket(cfg BucketConfig) (*Bucket, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, errors.New("files: a bucket needs an endpoint and a name")
+	}
+	if _, err := url.Parse(cfg.Endpoint); err != nil {
+		return nil, fmt.Errorf("files: bucket endpoint: %w", err)
+	}
+	cfg.Endpoint = strings.TrimSuffix(cfg.Endpoint, "/")
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.PartSize == 0 {
+		cfg.PartSize = DefaultUploadPartSize
+	}
+	if cfg.PartSize < MinUploadPartSize {
+		return nil, fmt.Errorf("files: upload part size must be at least %d bytes, got %d", MinUploadPartSize, cfg.PartSize)
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 5 * time.Minute}
+	}
+	cfg.Metrics = observability.RecorderOrDefault(cfg.Metrics)
+	return &Bucket{cfg: cfg, now: time.Now}, nil
+}
+
+// Upload stores r under the configured prefix and key. The upload is
+// recorded in the file_upload_* metrics.
+func (b *Bucket) Upload(ctx context.Context, key string, r io.Reader) (err error) {
+	start := time.Now()
+	var sent int64
+	defer func() {
+		b.cfg.Metrics.RecordFileUpload(time.Since(start).Seconds(), sent, err)
+	}()
+	key = b.cfg.Prefix + key
+
+	part := make([]byte, b.cfg.PartSize)
+	n, err := io.ReadFull(r, part)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		if err := b.expect(b.do(ctx, http.MethodPut, key, nil, part[:n])); err != nil {
+			return err
+		}
+		sent = int64(n)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return b.multipart(ctx, key, r, part, &sent)
+}
+
+// multipart uploads first and the rest of r as the parts of one object,
+// aborting the upload when a part fails so it leaves no stored parts
+// behind.
+func (b *Bucket) multipart(ctx context.Context, key string, r io.Reader, first []byte, sent *int64) (err error) {
+	resp, err := b.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil)
+	if err != nil {
+		return err
+	}
+	var created struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := b.decode(resp, &created); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			// The upload is abandoned; abort it even when ctx ended
+			abortCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+			defer cancel()
+			b.expect(b.do(abortCtx, http.MethodDelete, key, url.Values{"uploadId": {created.UploadID}}, nil))
+		}
+	}()
+
+	type completedPart struct {
+		PartNumber int
+		ETag       string
+	}
+	var parts []completedPart
+	part := first
+	for {
+		number := len(parts) + 1
+		query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {created.UploadID}}
+		resp, err := b.do(ctx, http.MethodPut, key, query, part)
+		if err != nil {
+			return err
+		}
+		etag := resp.Header.Get("ETag")
+		if err := b.expect(resp, nil); err != nil {
+			return err
+		}
+		parts = append(parts, completedPart{PartNumber: number, ETag: etag})
+		*sent += int64(len(part))
+
+		n, err := io.ReadFull(r, first)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return err
+		}
+		part = first[:n]
+	}
+
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+	resp, err = b.do(ctx, http.MethodPost, key, url.Values{"uploadId": {created.UploadID}}, body)
+	if err != nil {
+		return err
+	}
+	// A completion can fail after its 200 has been sent, with an Error
+	// document as the body
+	var completed struct {
+		XMLName xml.Name
+		Code    string
+		Message string
+	}
+	if err := b.decode(resp, &completed); err != nil {
+		return err
+	}
+	if completed.XMLName.Local == "Error" {
+		return fmt.Errorf("files: completing upload of %s: %s: %s", key, completed.Code, completed.Message)
+	}
+	return nil
+}
+
+// do sends a signed request for key of the bucket.
+func (b *Bucket) do(ctx context.Context, method, key string, query url.Values, body []byte) (*http.Response, error) {
+	target := b.cfg.Endpoint + "/" + awsEscape(b.cfg.Bucket, false) + "/" + awsEscape(key, true)
+	if len(query) > 0 {
+		target += "?" + canonicalQuery(query)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(body)
+	signV4(req, hex.EncodeToString(sum[:]), b.cfg, b.now())
+	return b.cfg.Client.Do(req)
+}
+
+// expect checks the response of a request that returns no body, and
+// closes it.
+func (b *Bucket) expect(resp *http.Response, err error) error {
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := b.check(resp); err != nil {
+		return err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	return nil
+}
+
+// check returns an error for a non-2xx response, naming the S3 error code
+// when the body has one.
+func (b *Bucket) check(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return nil
+	}
+	var failure struct {
+		Code    string
+		Message string
+	}
+	xml.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&failure)
+	if failure.Code != "" {
+		return fmt.Errorf("files: %s %s answered %s: %s: %s", resp.Request.Method, b.cfg.Bucket, resp.Status, failure.Code, failure.Message)
+	}
+	return fmt.Errorf("files: %s %s answered %s", resp.Request.Method, b.cfg.Bucket, resp.Status)
+}
+
+// decode checks a response and reads its XML body into v.
+func (b *Bucket) decode(resp *http.Response, v any) error {
+	defer resp.Body.Close()
+	if err := b.check(resp); err != nil {
+		return err
+	}
+	return xml.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// signV4 adds the headers of AWS Signature Version 4 to req, signing its
+// host and every header it already has.
+func signV4(req *http.Request, payloadHash string, cfg BucketConfig, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if cfg.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", cfg.SessionToken)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		trimmed := make([]string, len(values))
+		for i, v := range values {
+			trimmed[i] = strings.Join(strings.Fields(v), " ")
+		}
+		headers[strings.ToLower(name)] = strings.Join(trimmed, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	query, _ := url.ParseQuery(req.URL.RawQuery)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		canonicalQuery(query),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + cfg.Region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + cfg.SecretAccessKey)
+	for _, part := range []string{day, cfg.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+cfg.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// canonicalQuery encodes a query the way Signature Version 4 wants it:
+// sorted, with every reserved character escaped.
+func canonicalQuery(query url.Values) string {
+	pairs := make([]string, 0, len(query))
+	for name, values := range query {
+		for _, v := range values {
+			pairs = append(pairs, awsEscape(name, false)+"="+awsEscape(v, false))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// awsEscape percent-encodes all but the unreserved characters, keeping
+// slashes when asked to, as S3 wants its keys.
+func awsEscape(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && keepSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
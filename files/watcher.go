@@ -0,0 +1,327 @@
+package files
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"ping/observability"
+)
+
+// Ingest results, used as the result label of file_ingest_files_total.
+const (
+	IngestDone  = "done"
+	IngestError = "error"
+)
+
+// WatcherConfig configures a Watcher.
+type WatcherConfig struct {
+	// Dir is the directory new files are dropped into.
+	Dir string
+	// DoneDir receives files processed without an invalid row. Defaults
+	// to Dir/done.
+	DoneDir string
+	// ErrorDir receives the other files, each next to a
+	// <name>.summary.json explaining why. Defaults to Dir/error.
+	ErrorDir string
+	// Handle, when set, receives the valid rows of every file.
+	Handle RowHandler
+	// Schema, when set, checks the values of every file; the invalid rows
+	// of a file are written to <name>.rejects.csv in ErrorDir.
+	Schema *Schema
+	// Workers and ChunkRows set the Options of the same names.
+	Workers   int
+	ChunkRows int
+	// Compress, when set, compresses the plain files moved to DoneDir,
+	// adding the compression's extension.
+	Compress Compression
+	// Upload, when set, receives a copy of every file moved to DoneDir or
+	// ErrorDir, with its summary and rejects, under done/ or error/. A
+	// failed upload is logged; the files stay on disk either way.
+	Upload *Bucket
+	// Logger receives one line per file. Nil uses
+	// observability.DefaultLogger.
+	Logger observability.Logger
+	// Metrics records the ingests and their processing. Nil uses
+	// observability.GetMetrics().
+	Metrics observability.MetricsRecorder
+}
+
+// fileState is what a scan saw of a file, to tell when it stops growing.
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// Watcher ingests the CSV (.csv) and TSV (.tsv) files dropped into a
+// directory, plain or compressed (.csv.gz, .tsv.zst, ...). Each Scan
+// picks up the files that have not changed since the previous one, so a
+// file still being copied in is left alone; files whose names start with
+// a dot are ignored, which suits writers that rename a finished temporary
+// file into place.
+type Watcher struct {
+	cfg WatcherConfig
+
+	mu   sync.Mutex
+	seen map[string]fileState
+}
+
+// NewWatcher returns a watcher over cfg.Dir, creating the done and error
+// directories.
+func NewWatcher(cfg WatcherConfig) (*Watcher, error) {
+	if cfg.DoneDir == "" {
+		cfg.DoneDir = filepath.Join(cfg.Dir, "done")
+	}
+	if cfg.ErrorDir == "" {
+		cfg.ErrorDir = filepath.Join(cfg.Dir, "error")
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = observability.DefaultLogger
+	}
+	cfg.Metrics = observability.RecorderOrDefault(cfg.Metrics)
+	for _, dir := range []string{cfg.Dir, cfg.DoneDir, cfg.ErrorDir} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+	return &Watcher{cfg: cfg, seen: make(map[string]fileState)}, nil
+}
+
+// Scan ingests the files of the directory that are ready, oldest name
+// first, and stops early when ctx ends. It suits a scheduled job.
+func (w *Watcher) Scan(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	entries, err := os.ReadDir(w.cfg.Dir)
+	if err != nil {
+		return err
+	}
+	var ready []string
+	present := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || strings.HasPrefix(name, ".") || delimiterFor(name) == 0 {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		present[name] = true
+		state := fileState{size: info.Size(), modTime: info.ModTime()}
+		if previous, ok := w.seen[name]; ok && previous == state {
+			ready = append(ready, name)
+			continue
+		}
+		w.seen[name] = state
+	}
+	for name := range w.seen {
+		if !present[name] {
+			delete(w.seen, name)
+		}
+	}
+
+	sort.Strings(ready)
+	for _, name := range ready {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		delete(w.seen, name)
+		if err := w.ingest(ctx, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ingest processes one file and moves it out of the directory. Only a
+// failure to move it is returned, since the file would be picked up again.
+func (w *Watcher) ingest(ctx context.Context, name string) error {
+	path := filepath.Join(w.cfg.Dir, name)
+	// The error path is chosen up front so the rejects can sit beside it
+	dest, err := uniquePath(w.cfg.ErrorDir, name)
+	if err != nil {
+		return err
+	}
+	rejects := NewLazyFile(dest + ".rejects.csv")
+	summary, err := w.process(ctx, path, rejects)
+	rejects.Close()
+	if ctx.Err() != nil {
+		// Cut short by shutdown; the next run starts the file over
+		if rejects.Written() {
+			os.Remove(rejects.Path())
+		}
+		return ctx.Err()
+	}
+	if rejects.Written() {
+		summary.RejectsFile = filepath.Base(rejects.Path())
+	}
+
+	result := IngestDone
+	if err != nil || summary.Invalid > 0 {
+		result = IngestError
+	}
+	w.cfg.Metrics.RecordFileIngest(result, summary.ValidRows, summary.Invalid)
+
+	if result == IngestDone {
+		w.cfg.Logger.Infof(ctx, "ingested %s: %d rows", name, summary.Rows)
+		var done string
+		if w.cfg.Compress != CompressionNone && summary.Compression == CompressionNone {
+			done, err = w.archive(path)
+		} else {
+			done, err = move(path, w.cfg.DoneDir)
+		}
+		if err != nil {
+			return err
+		}
+		w.deliver(ctx, IngestDone, done)
+		return nil
+	}
+	report := struct {
+		Summary
+		Error string `json:"error,omitempty"`
+	}{Summary: summary}
+	if err != nil {
+		report.Error = err.Error()
+	}
+	w.cfg.Logger.Warnf(ctx, "ingesting %s failed: %d invalid rows, error: %v", name, summary.Invalid, err)
+	if data, err := json.MarshalIndent(report, "", "  "); err == nil {
+		if err := os.WriteFile(dest+".summary.json", data, 0o644); err != nil {
+			w.cfg.Logger.Errorf(ctx, "writing summary of %s: %v", name, err)
+		}
+	}
+	if err := os.Rename(path, dest); err != nil {
+		return err
+	}
+	w.deliver(ctx, IngestError, dest, dest+".summary.json", rejects.Path())
+	return nil
+}
+
+// deliver uploads the files of an ingest that exist to folder/ of the
+// bucket, if there is one.
+func (w *Watcher) deliver(ctx context.Context, folder string, paths ...string) {
+	if w.cfg.Upload == nil {
+		return
+	}
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err == nil {
+			err = w.cfg.Upload.Upload(ctx, folder+"/"+filepath.Base(path), f)
+			f.Close()
+		}
+		if err != nil {
+			w.cfg.Logger.Errorf(ctx, "uploading %s: %v", path, err)
+		}
+	}
+}
+
+func (w *Watcher) process(ctx context.Context, path string, rejects io.Writer) (Summary, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Summary{}, err
+	}
+	defer f.Close()
+	opts := Options{
+		Comma:     delimiterFor(path),
+		Handle:    w.cfg.Handle,
+		Schema:    w.cfg.Schema,
+		Workers:   w.cfg.Workers,
+		ChunkRows: w.cfg.ChunkRows,
+		Metrics:   w.cfg.Metrics,
+	}
+	if w.cfg.Schema != nil {
+		opts.Rejects = rejects
+	}
+	return ProcessCSV(ctx, f, opts)
+}
+
+// archive compresses path into DoneDir, removes it and returns the
+// archive's path.
+func (w *Watcher) archive(path string) (_ string, err error) {
+	dest, err := uniquePath(w.cfg.DoneDir, filepath.Base(path)+w.cfg.Compress.Ext())
+	if err != nil {
+		return "", err
+	}
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	f, err := os.Create(dest)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(dest)
+		}
+	}()
+	out := &countingWriter{w: f}
+	compressed, err := Compress(out, w.cfg.Compress)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(compressed, src); err != nil {
+		return "", err
+	}
+	if err := compressed.Close(); err != nil {
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	w.cfg.Metrics.RecordFileCompressed("out", string(w.cfg.Compress), float64(out.n))
+	return dest, os.Remove(path)
+}
+
+// delimiterFor returns the delimiter of a file by its extension, ignoring
+// a compression extension, or 0 for files the watcher does not ingest.
+func delimiterFor(name string) rune {
+	switch strings.ToLower(filepath.Ext(trimCompressionExt(name))) {
+	case ".csv":
+		return ','
+	case ".tsv":
+		return '\t'
+	}
+	return 0
+}
+
+// move renames path into dir, keeping its name unless taken, and returns
+// its new path.
+func move(path, dir string) (string, error) {
+	dest, err := uniquePath(dir, filepath.Base(path))
+	if err != nil {
+		return "", err
+	}
+	return dest, os.Rename(path, dest)
+}
+
+// uniquePath returns dir/name, or a timestamped variant when a file of
+// that name exists already, so an earlier file is never overwritten.
+func uniquePath(dir, name string) (string, error) {
+	dest := filepath.Join(dir, name)
+	_, err := os.Stat(dest)
+	if errors.Is(err, os.ErrNotExist) {
+		return dest, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	// rows.csv.gz becomes rows-<nanos>.csv.gz
+	base := trimCompressionExt(name)
+	stem := strings.TrimSuffix(base, filepath.Ext(base))
+	return filepath.Join(dir, fmt.Sprintf("%s-%d%s", stem, time.Now().UnixNano(), name[len(stem):])), nil
+}
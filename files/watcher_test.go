@@ -0,0 +1,273 @@
+package files
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"ping/observability"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestWatcherIngestsSettledFiles(t *testing.T) {
+	m := observability.NewMetrics(observability.MetricsOptions{})
+
+	dir := t.TempDir()
+	var rows []string
+	w, err := NewWatcher(WatcherConfig{
+		Dir:     dir,
+		Metrics: m,
+		Handle: func(ctx context.Context, line int, header, record []string) error {
+			rows = append(rows, record[0])
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "good.tsv"), "id\tname\n1\tjo\n")
+	writeFile(t, filepath.Join(dir, "bad.csv"), "id,name\n1\n")
+	writeFile(t, filepath.Join(dir, ".partial.csv"), "id\n")
+	writeFile(t, filepath.Join(dir, "notes.txt"), "hello")
+
+	// The first scan only notes the files, in case they are still growing
+	if err := w.Scan(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !exists(filepath.Join(dir, "good.tsv")) {
+		t.Fatal("file ingested on the first sight")
+	}
+	if err := w.Scan(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if !exists(filepath.Join(dir, "done", "good.tsv")) {
+		t.Error("expected good.tsv in done")
+	}
+	if !exists(filepath.Join(dir, "error", "bad.csv")) {
+		t.Error("expected bad.csv in error")
+	}
+	for _, name := range []string{".partial.csv", "notes.txt"} {
+		if !exists(filepath.Join(dir, name)) {
+			t.Errorf("expected %s to be left alone", name)
+		}
+	}
+	if len(rows) != 1 || rows[0] != "1" {
+		t.Errorf("handled rows = %v", rows)
+	}
+
+	var report struct {
+		Invalid int64 `json:"invalid_rows"`
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "error", "bad.csv.summary.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &report); err != nil || report.Invalid != 1 {
+		t.Errorf("summary = %s, want 1 invalid row", data)
+	}
+
+	if got := testutil.ToFloat64(m.FileIngestCounter.WithLabelValues(IngestDone)); got != 1 {
+		t.Errorf("done files = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.FileIngestCounter.WithLabelValues(IngestError)); got != 1 {
+		t.Errorf("error files = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.FileIngestRows.WithLabelValues("invalid")); got != 1 {
+		t.Errorf("invalid rows = %v, want 1", got)
+	}
+}
+
+func TestWatcherWaitsForGrowingFiles(t *testing.T) {
+	observability.InitMetrics()
+	dir := t.TempDir()
+	w, err := NewWatcher(WatcherConfig{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "rows.csv")
+	writeFile(t, path, "id\n")
+	w.Scan(context.Background())
+	writeFile(t, path, "id\n1\n")
+	w.Scan(context.Background())
+	if !exists(path) {
+		t.Fatal("file ingested while it was still growing")
+	}
+	w.Scan(context.Background())
+	if !exists(filepath.Join(dir, "done", "rows.csv")) {
+		t.Error("expected rows.csv in done once settled")
+	}
+}
+
+func TestWatcherKeepsEarlierFilesOfTheSameName(t *testing.T) {
+	observability.InitMetrics()
+	dir := t.TempDir()
+	w, err := NewWatcher(WatcherConfig{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "done", "rows.csv"), "earlier")
+	writeFile(t, filepath.Join(dir, "rows.csv"), "id\n1\n")
+	w.Scan(context.Background())
+	w.Scan(context.Background())
+
+	entries, err := os.ReadDir(filepath.Join(dir, "done"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("expected both files in done, got %d", len(entries))
+	}
+}
+
+func TestWatcherStopsWhenCanceled(t *testing.T) {
+	observability.InitMetrics()
+	dir := t.TempDir()
+	w, err := NewWatcher(WatcherConfig{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "rows.csv"), "id\n1\n")
+	w.Scan(context.Background())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := w.Scan(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if !exists(filepath.Join(dir, "rows.csv")) {
+		t.Error("expected the file to stay for the next run")
+	}
+}
+
+func TestWatcherIngestsCompressedFilesAndArchives(t *testing.T) {
+	observability.InitMetrics()
+	dir := t.TempDir()
+	w, err := NewWatcher(WatcherConfig{Dir: dir, Compress: CompressionGzip})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "packed.tsv.zst"), compressed(t, CompressionZstd, "id\tname\n1\tjo\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "plain.csv"), "id\n1\n")
+	w.Scan(context.Background())
+	w.Scan(context.Background())
+
+	// Compressed files keep their compression; plain ones are archived
+	if !exists(filepath.Join(dir, "done", "packed.tsv.zst")) {
+		t.Error("expected packed.tsv.zst in done")
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "done", "plain.csv.gz"))
+	if err != nil {
+		t.Fatalf("expected plain.csv.gz in done: %v", err)
+	}
+	r, c, err := Decompress(bytes.NewReader(data))
+	if err != nil || c != CompressionGzip {
+		t.Fatalf("archive compression = %q, %v", c, err)
+	}
+	if plain, _ := io.ReadAll(r); string(plain) != "id\n1\n" {
+		t.Errorf("archived %q", plain)
+	}
+	if exists(filepath.Join(dir, "plain.csv")) {
+		t.Error("expected plain.csv to be removed once archived")
+	}
+}
+
+func TestUniquePathKeepsExtensions(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "rows.csv.gz"), "")
+	got, err := uniquePath(dir, "rows.csv.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if base := filepath.Base(got); !strings.HasPrefix(base, "rows-") || !strings.HasSuffix(base, ".csv.gz") {
+		t.Errorf("uniquePath = %q, want rows-<nanos>.csv.gz", base)
+	}
+}
+
+func TestWatcherWritesRejectsWithSchema(t *testing.T) {
+	observability.InitMetrics()
+	dir := t.TempDir()
+	schema, err := ParseSchema([]byte(`{"columns": [{"name": "id", "type": "int", "required": true}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWatcher(WatcherConfig{Dir: dir, Schema: schema})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "good.csv"), "id\n1\n")
+	writeFile(t, filepath.Join(dir, "bad.csv"), "id\n1\nx\n")
+	w.Scan(context.Background())
+	w.Scan(context.Background())
+
+	rejects, err := os.ReadFile(filepath.Join(dir, "error", "bad.csv.rejects.csv"))
+	if err != nil {
+		t.Fatalf("expected rejects for bad.csv: %v", err)
+	}
+	if !strings.HasPrefix(string(rejects), "line,error,id\n3,") {
+		t.Errorf("rejects = %q", rejects)
+	}
+	summary, _ := os.ReadFile(filepath.Join(dir, "error", "bad.csv.summary.json"))
+	if !strings.Contains(string(summary), `"rejects_file": "bad.csv.rejects.csv"`) {
+		t.Errorf("summary = %s, want the rejects file named", summary)
+	}
+	if exists(filepath.Join(dir, "error", "good.csv.rejects.csv")) {
+		t.Error("expected no rejects file for a valid file")
+	}
+}
+
+func TestWatcherUploadsResults(t *testing.T) {
+	observability.InitMetrics()
+	s, srv := newFakeS3(t)
+	dir := t.TempDir()
+	schema, err := ParseSchema([]byte(`{"columns": [{"name": "id", "type": "int"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWatcher(WatcherConfig{
+		Dir:      dir,
+		Schema:   schema,
+		Compress: CompressionGzip,
+		Upload:   newTestBucket(t, srv.URL, DefaultUploadPartSize),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "good.csv"), "id\n1\n")
+	writeFile(t, filepath.Join(dir, "bad.csv"), "id\nx\n")
+	w.Scan(context.Background())
+	w.Scan(context.Background())
+
+	for _, key := range []string{"done/good.csv.gz", "error/bad.csv", "error/bad.csv.summary.json", "error/bad.csv.rejects.csv"} {
+		if _, ok := s.objects["/results/ping/"+key]; !ok {
+			t.Errorf("expected %s in the bucket, got %v", key, s.objects)
+		}
+	}
+	if got := s.objects["/results/ping/error/bad.csv"]; got != "id\nx\n" {
+		t.Errorf("uploaded %q", got)
+	}
+	if !exists(filepath.Join(dir, "done", "good.csv.gz")) {
+		t.Error("expected the uploaded file to stay in done")
+	}
+}
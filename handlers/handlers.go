@@ -1,40 +1,149 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+	"unicode/utf8"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"ping/auth"
+	"ping/files"
+	"ping/health"
+	"ping/jobs"
 	"ping/middleware"
 	"ping/observability"
 )
 
+// staticBody is a response encoded once, at startup, rather than on every
+// request: its body and its headers, Content-Length included.
+type staticBody struct {
+	body   []byte
+	header http.Header
+}
+
+// newStaticBody returns body as an uncacheable response of contentType.
+// Every response shares the header values; their capacity is their
+// length, so Header().Add copies them instead of appending in place.
+func newStaticBody(contentType string, body []byte) staticBody {
+	return staticBody{body: body, header: http.Header{
+		"Content-Type":   []string{contentType}[:1:1],
+		"Cache-Control":  []string{"no-store"}[:1:1],
+		"Content-Length": []string{strconv.Itoa(len(body))}[:1:1],
+	}}
+}
+
+func (s staticBody) write(w http.ResponseWriter, status int) {
+	header := w.Header()
+	for name, values := range s.header {
+		header[name] = values
+	}
+	w.WriteHeader(status)
+	w.Write(s.body)
+}
+
+var pongBody = newStaticBody("text/plain; charset=utf-8", []byte("pong\n"))
+
+// reportBodies holds the JSON of the reports without checks, which are
+// all that health checks without a registry, or with a healthy one, send.
+var reportBodies = func() map[string]staticBody {
+	bodies := make(map[string]staticBody)
+	for _, status := range []string{health.StatusHealthy, health.StatusDegraded, health.StatusUnhealthy} {
+		var buf bytes.Buffer
+		json.NewEncoder(&buf).Encode(health.Report{Status: status})
+		bodies[status] = newStaticBody("application/json; charset=utf-8", buf.Bytes())
+	}
+	return bodies
+}()
+
+// PingPaths are the paths RegisterPing answers with "pong", besides the
+// "/" main keeps for compatibility. pingctl pings the first by default.
+var PingPaths = []string{"/ping", "/probe"}
+
+// RegisterPing registers PongHandler on every path of PingPaths, named
+// "ping" in metrics and logs.
+func RegisterPing(mux *http.ServeMux) {
+	h := observability.NamedHandler("ping", http.HandlerFunc(PongHandler))
+	for _, path := range PingPaths {
+		mux.Handle(path, h)
+	}
+}
+
 // PongHandler is the main health check endpoint that returns "pong"
 func PongHandler(w http.ResponseWriter, r *http.Request) {
 	// Log with correlation ID from context
 	middleware.LogWithCorrelationID(r.Context(), "Processing pong request")
 	// main registers this handler on "/" for compatibility, which would
 	// otherwise make arbitrary typo/probe paths look healthy to callers.
-	if r.URL.Path != "/" {
+	if r.URL.Path != "/" && !slices.Contains(PingPaths, r.URL.Path) {
 		http.NotFound(w, r)
 		return
 	}
 
-	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-	w.Header().Set("Cache-Control", "no-store")
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintln(w, "pong")
+	pongBody.write(w, http.StatusOK)
 }
 
 // HealthHandler is a health check endpoint that can be used by load balancers
 func HealthHandler(w http.ResponseWriter, r *http.Request) {
-	middleware.LogWithCorrelationID(r.Context(), "Processing health check request")
+	NewHealthHandler(nil)(w, r)
+}
 
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	// A cached healthy response can hide a failed instance behind a proxy.
-	w.Header().Set("Cache-Control", "no-store")
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintln(w, `{"status":"healthy"}`)
+// NewHealthHandler serves the report of the checks in reg as JSON: 200
+// while no critical check fails, 503 with the per-check results otherwise.
+// A nil registry always reports healthy.
+func NewHealthHandler(reg *health.Registry) http.HandlerFunc {
+	if reg == nil {
+		return NewProbeHandler(func(context.Context) health.Report {
+			return health.Report{Status: health.StatusHealthy}
+		})
+	}
+	return NewProbeHandler(reg.Run)
+}
+
+// NewProbeHandler serves the report of probe like NewHealthHandler, e.g.
+// with health.Registry.Readiness for a Kubernetes readiness probe. With
+// ?verbose=1 each check also carries its duration, last error and last
+// success time.
+func NewProbeHandler(probe func(ctx context.Context) health.Report) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		middleware.LogWithCorrelationID(r.Context(), "Processing health check request")
+
+		report := probe(r.Context())
+		// Probes rarely carry a query; parsing an empty one still allocates
+		verbose := false
+		if r.URL.RawQuery != "" {
+			verbose, _ = strconv.ParseBool(r.URL.Query().Get("verbose"))
+		}
+		if !verbose {
+			report = report.Brief()
+		}
+		status := http.StatusOK
+		if !report.Healthy() {
+			status = http.StatusServiceUnavailable
+		}
+
+		// A cached healthy response can hide a failed instance behind a proxy.
+		if body, ok := reportBodies[report.Status]; ok && len(report.Checks) == 0 {
+			body.write(w, status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(report)
+	}
 }
 
 // MetricsHandler exposes Prometheus metrics
@@ -43,8 +152,36 @@ func MetricsHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Use Prometheus HTTP handler to serve metrics
 	// This handler doesn't need instrumentation to avoid recursive metrics
-	handler := promhttp.Handler()
-	handler.ServeHTTP(w, r)
+	metricsHandler.ServeHTTP(w, r)
+}
+
+// metricsHandler serves the default registry.
+var metricsHandler = NewMetricsHandler(prometheus.DefaultRegisterer, prometheus.DefaultGatherer)
+
+// MetricsHandlerOptions adjusts the exposition of NewMetricsHandlerWithOptions.
+type MetricsHandlerOptions struct {
+	// CreatedTimestamps adds a _created sample to every counter, histogram
+	// and summary in the OpenMetrics format, so scrapers can tell a reset
+	// from a slow start. Scrapers that keep them as ordinary series double
+	// those series.
+	CreatedTimestamps bool
+}
+
+// NewMetricsHandler serves the metrics in g, e.g. those of an instance
+// created by observability.NewMetrics, and counts its scrapes in reg. It is
+// promhttp.Handler with OpenMetrics negotiation enabled, the only format
+// that carries the trace exemplars on request durations; scrapers that do
+// not ask for it get the classic text format.
+func NewMetricsHandler(reg prometheus.Registerer, g prometheus.Gatherer) http.Handler {
+	return NewMetricsHandlerWithOptions(reg, g, MetricsHandlerOptions{})
+}
+
+// NewMetricsHandlerWithOptions is NewMetricsHandler with exposition options.
+func NewMetricsHandlerWithOptions(reg prometheus.Registerer, g prometheus.Gatherer, opts MetricsHandlerOptions) http.Handler {
+	return promhttp.InstrumentMetricHandler(reg, promhttp.HandlerFor(g, promhttp.HandlerOpts{
+		EnableOpenMetrics:                   true,
+		EnableOpenMetricsTextCreatedSamples: opts.CreatedTimestamps,
+	}))
 }
 
 // PingWithContext is a handler that demonstrates correlation ID usage in business logic
@@ -58,3 +195,517 @@ func PingWithContext(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintf(w, "pong (id=%s)\n", correlationID)
 }
+
+// RecentRequestsHandler serves the summaries held in ring as JSON, newest first
+func RecentRequestsHandler(ring *observability.RequestRing) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		middleware.LogWithCorrelationID(r.Context(), "Processing recent requests request")
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(ring.Snapshot())
+	}
+}
+
+// statsResponse is a StatsSnapshot plus the state of each target
+type statsResponse struct {
+	observability.StatsSnapshot
+	Targets map[string]string `json:"targets,omitempty"`
+}
+
+// StatsHandler serves a compact JSON summary of stats, for integrations
+// that cannot query Prometheus. targets, when set, reports which of the
+// backends the service talks to are reachable; each is listed as "up" or
+// "down".
+func StatsHandler(stats *observability.RequestStats, targets func() map[string]bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		middleware.LogWithCorrelationID(r.Context(), "Processing stats request")
+
+		resp := statsResponse{StatsSnapshot: stats.Snapshot()}
+		if targets != nil {
+			resp.Targets = make(map[string]string)
+			for name, up := range targets() {
+				resp.Targets[name] = "down"
+				if up {
+					resp.Targets[name] = "up"
+				}
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// IPHandler reports the caller's IP address as the service sees it, after
+// resolving trusted proxy headers
+func IPHandler(w http.ResponseWriter, r *http.Request) {
+	middleware.LogWithCorrelationID(r.Context(), "Processing ip request")
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"ip": middleware.ClientIP(r)})
+}
+
+// maxEchoBody caps the request body mirrored by EchoHandler
+const maxEchoBody = 1 << 20
+
+// echoResponse mirrors what the service saw of a request
+type echoResponse struct {
+	Method         string               `json:"method"`
+	Path           string               `json:"path"`
+	Query          map[string][]string  `json:"query,omitempty"`
+	Headers        map[string][]string  `json:"headers"`
+	Body           string               `json:"body,omitempty"`
+	RemoteAddr     string               `json:"remote_addr"`
+	ClientIP       string               `json:"client_ip"`
+	CorrelationID  string               `json:"correlation_id,omitempty"`
+	ClientIdentity *auth.ClientIdentity `json:"client_identity,omitempty"`
+}
+
+// EchoHandler returns the request as the service received it, including the
+// decoded body and the mTLS client identity, which helps debug proxies,
+// header rewriting and certificate setups
+func EchoHandler(w http.ResponseWriter, r *http.Request) {
+	middleware.LogWithCorrelationID(r.Context(), "Processing echo request")
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxEchoBody+1))
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge) || len(body) > maxEchoBody:
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	case err != nil:
+		http.Error(w, "unreadable request body", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(echoResponse{
+		Method:         r.Method,
+		Path:           r.URL.Path,
+		Query:          r.URL.Query(),
+		Headers:        r.Header,
+		Body:           string(body),
+		RemoteAddr:     r.RemoteAddr,
+		ClientIP:       middleware.ClientIP(r),
+		CorrelationID:  observability.GetCorrelationID(r.Context()),
+		ClientIdentity: auth.ClientIdentityFromContext(r.Context()),
+	})
+}
+
+// maxJobBody caps the request body of a job submission
+const maxJobBody = 1 << 20
+
+// enqueueRequest is the body of a job submission
+type enqueueRequest struct {
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// NewJobsHandler serves a JSON API over queue:
+//
+//	POST   /jobs                enqueue {"type": ..., "payload": ...}, answering 202
+//	GET    /jobs                list jobs, oldest first, optionally ?state=running
+//	GET    /jobs/{id}           inspect a job, including its correlation ID
+//	DELETE /jobs/{id}           cancel a pending or running job
+//	GET    /jobs/dead-letter    list the jobs whose attempts ran out
+//	POST   /jobs/{id}/retry     requeue a dead-lettered job with fresh attempts
+//
+// A full queue answers 503 so clients retry later.
+func NewJobsHandler(queue *jobs.Queue) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /jobs", func(w http.ResponseWriter, r *http.Request) {
+		middleware.LogWithCorrelationID(r.Context(), "Processing job submission")
+
+		var req enqueueRequest
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxJobBody)).Decode(&req); err != nil || req.Type == "" {
+			middleware.WriteJSONError(w, r, http.StatusBadRequest, `body must be a JSON object with a "type"`)
+			return
+		}
+		job, err := queue.Enqueue(r.Context(), req.Type, req.Payload)
+		switch {
+		case errors.Is(err, jobs.ErrUnknownJobType):
+			middleware.WriteJSONError(w, r, http.StatusBadRequest, err.Error())
+		case errors.Is(err, jobs.ErrQueueFull), errors.Is(err, jobs.ErrPoolClosed):
+			middleware.WriteJSONError(w, r, http.StatusServiceUnavailable, err.Error())
+		case err != nil:
+			middleware.WriteJSONError(w, r, http.StatusInternalServerError, "could not enqueue job")
+		default:
+			w.Header().Set("Location", "/jobs/"+job.ID)
+			writeJSON(w, http.StatusAccepted, job)
+		}
+	})
+	mux.HandleFunc("GET /jobs", func(w http.ResponseWriter, r *http.Request) {
+		middleware.LogWithCorrelationID(r.Context(), "Processing job list request")
+
+		all, err := queue.List()
+		if err != nil {
+			middleware.WriteJSONError(w, r, http.StatusInternalServerError, "could not list jobs")
+			return
+		}
+		list := make([]jobs.Job, 0, len(all))
+		state := r.URL.Query().Get("state")
+		for _, job := range all {
+			if state == "" || job.State == state {
+				list = append(list, job)
+			}
+		}
+		writeJSON(w, http.StatusOK, list)
+	})
+	mux.HandleFunc("GET /jobs/dead-letter", func(w http.ResponseWriter, r *http.Request) {
+		middleware.LogWithCorrelationID(r.Context(), "Processing dead-letter list request")
+
+		dead, err := queue.DeadLetters()
+		if err != nil {
+			middleware.WriteJSONError(w, r, http.StatusInternalServerError, "could not list jobs")
+			return
+		}
+		writeJSON(w, http.StatusOK, dead)
+	})
+	mux.HandleFunc("POST /jobs/{id}/retry", func(w http.ResponseWriter, r *http.Request) {
+		middleware.LogWithCorrelationID(r.Context(), "Processing job retry")
+
+		job, err := queue.Retry(r.PathValue("id"))
+		switch {
+		case errors.Is(err, jobs.ErrNotDeadLettered):
+			middleware.WriteJSONError(w, r, http.StatusConflict, "job is "+job.State+", not dead-lettered")
+		case errors.Is(err, jobs.ErrQueueFull), errors.Is(err, jobs.ErrPoolClosed):
+			middleware.WriteJSONError(w, r, http.StatusServiceUnavailable, err.Error())
+		case err == nil:
+			writeJSON(w, http.StatusAccepted, job)
+		default:
+			writeJobResult(w, r, job, err)
+		}
+	})
+	mux.HandleFunc("GET /jobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		middleware.LogWithCorrelationID(r.Context(), "Processing job request")
+
+		job, err := queue.Get(r.PathValue("id"))
+		writeJobResult(w, r, job, err)
+	})
+	mux.HandleFunc("DELETE /jobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		middleware.LogWithCorrelationID(r.Context(), "Processing job cancellation")
+
+		job, err := queue.Cancel(r.PathValue("id"))
+		if errors.Is(err, jobs.ErrJobFinished) {
+			middleware.WriteJSONError(w, r, http.StatusConflict, "job already "+job.State)
+			return
+		}
+		if err == nil {
+			writeJSON(w, http.StatusAccepted, job)
+			return
+		}
+		writeJobResult(w, r, job, err)
+	})
+	return mux
+}
+
+// writeJobResult answers with job, or with the error of looking it up
+func writeJobResult(w http.ResponseWriter, r *http.Request, job jobs.Job, err error) {
+	switch {
+	case errors.Is(err, jobs.ErrJobNotFound):
+		middleware.WriteJSONError(w, r, http.StatusNotFound, "job not found")
+	case err != nil:
+		middleware.WriteJSONError(w, r, http.StatusInternalServerError, "could not load job")
+	default:
+		writeJSON(w, http.StatusOK, job)
+	}
+}
+
+// writeJSON answers with v as JSON
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// CSVUploadConfig configures NewCSVUploadHandler.
+type CSVUploadConfig struct {
+	// MaxBytes caps the upload size
+	MaxBytes int64
+	// Options tunes processing; its Schema and Rejects are set per request.
+	// A nil Options.Metrics uses observability.GetMetrics().
+	Options files.Options
+	// Schemas are the schemas uploads can be checked against, by name
+	Schemas map[string]*files.Schema
+	// RejectsDir, when set, keeps the invalid rows of schema-checked
+	// uploads there, one CSV file per upload
+	RejectsDir string
+	// Timeout replaces the server's read and write deadlines for each
+	// upload, which are sized for small requests. Zero keeps them.
+	Timeout time.Duration
+}
+
+// NewCSVUploadHandler serves POST /files/csv, which parses an uploaded CSV
+// file as it streams in and answers with a files.Summary of its rows, and
+// POST /files/csv/{schema}, which also checks the values against one of
+// cfg.Schemas. The file is the raw request body or, for
+// multipart/form-data, the first file part; either way it is never held
+// in memory whole. Bodies over cfg.MaxBytes answer 413, a missing or
+// malformed header row 400 and an unknown schema 404.
+func NewCSVUploadHandler(cfg CSVUploadConfig) http.Handler {
+	cfg.Options.Metrics = observability.RecorderOrDefault(cfg.Options.Metrics)
+	upload := func(w http.ResponseWriter, r *http.Request) {
+		middleware.LogWithCorrelationID(r.Context(), "Processing CSV upload")
+		extendDeadlines(w, r, cfg.Timeout)
+
+		opts := cfg.Options
+		var rejects *files.LazyFile
+		if name := r.PathValue("schema"); name != "" {
+			if opts.Schema = cfg.Schemas[name]; opts.Schema == nil {
+				middleware.WriteJSONError(w, r, http.StatusNotFound, "unknown schema")
+				return
+			}
+			if cfg.RejectsDir != "" {
+				rejects = files.NewLazyFile(filepath.Join(cfg.RejectsDir, fmt.Sprintf("%s-%d.rejects.csv", name, time.Now().UnixNano())))
+				opts.Rejects = rejects
+			}
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, cfg.MaxBytes)
+		body, err := uploadedFile(r)
+		if err != nil {
+			writeUploadError(w, r, err)
+			return
+		}
+		summary, err := files.ProcessCSV(r.Context(), body, opts)
+		if rejects != nil {
+			rejects.Close()
+			switch {
+			case err != nil && rejects.Written():
+				os.Remove(rejects.Path())
+			case rejects.Written():
+				summary.RejectsFile = filepath.Base(rejects.Path())
+			}
+		}
+		if err != nil {
+			writeUploadError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, summary)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /files/csv", upload)
+	mux.HandleFunc("POST /files/csv/{schema}", upload)
+	return mux
+}
+
+// errNoFilePart is returned for a multipart upload without a file part
+var errNoFilePart = errors.New("multipart upload has no file part")
+
+// uploadedFile returns the uploaded file of r: the first file part of a
+// multipart/form-data body, or else the body itself
+func uploadedFile(r *http.Request) (io.Reader, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return r.Body, nil
+	}
+	parts, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		part, err := parts.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil, errNoFilePart
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FileName() != "" {
+			return part, nil
+		}
+	}
+}
+
+// writeUploadError answers with the error of reading or processing an
+// uploaded file
+func writeUploadError(w http.ResponseWriter, r *http.Request, err error) {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		middleware.WriteJSONError(w, r, http.StatusRequestEntityTooLarge, "file too large")
+	case errors.Is(err, files.ErrInvalidHeader), errors.Is(err, files.ErrMalformedRow), errors.Is(err, errNoFilePart):
+		middleware.WriteJSONError(w, r, http.StatusBadRequest, err.Error())
+	case r.Context().Err() != nil:
+		// The client went away; nobody reads the answer
+		middleware.WriteJSONError(w, r, http.StatusServiceUnavailable, "upload canceled")
+	default:
+		middleware.WriteJSONError(w, r, http.StatusBadRequest, "unreadable upload")
+	}
+}
+
+// extendDeadlines gives a long-running request d from now to read its
+// body and write its response, in place of the server's deadlines. Writers
+// that cannot reach the connection keep the server's deadlines, which is
+// logged.
+func extendDeadlines(w http.ResponseWriter, r *http.Request, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	rc := http.NewResponseController(w)
+	deadline := time.Now().Add(d)
+	err := rc.SetReadDeadline(deadline)
+	if err == nil {
+		err = rc.SetWriteDeadline(deadline)
+	}
+	if err != nil {
+		middleware.LogWithCorrelationID(r.Context(), "Keeping the server deadlines: %v", err)
+	}
+}
+
+// convertContentTypes is the Content-Type of each conversion output
+var convertContentTypes = map[files.Format]string{
+	files.FormatCSV:     "text/csv; charset=utf-8",
+	files.FormatTSV:     "text/tab-separated-values; charset=utf-8",
+	files.FormatJSONL:   "application/x-ndjson",
+	files.FormatParquet: "application/vnd.apache.parquet",
+}
+
+// ConvertConfig configures NewConvertHandler.
+type ConvertConfig struct {
+	// MaxBytes caps the upload size
+	MaxBytes int64
+	// Metrics records the conversions. Nil uses observability.GetMetrics().
+	Metrics observability.MetricsRecorder
+	// Timeout replaces the server's read and write deadlines for each
+	// conversion, which are sized for small requests. Zero keeps them.
+	Timeout time.Duration
+}
+
+// NewConvertHandler serves POST /files/convert, which streams the request
+// body out again in another format:
+//
+//	?from=csv|tsv|jsonl&to=csv|tsv|jsonl|parquet   formats, both required
+//	&delimiter=%3B&out_delimiter=tab               field delimiters of CSV/TSV
+//	&lazy_quotes=true                              accept stray quotes in the input
+//	&quote=all                                     quote every output field
+//	&compress=gzip|zstd                            compress the output
+//	&codec=snappy|gzip|zstd|none                   compress Parquet pages instead
+//
+// A gzip or zstd compressed body is recognized and decompressed on its
+// own.
+//
+// Problems found before the first output byte answer 400 (or 413 over
+// cfg.MaxBytes); later ones abort the response, so a truncated download
+// never looks complete.
+func NewConvertHandler(cfg ConvertConfig) http.Handler {
+	cfg.Metrics = observability.RecorderOrDefault(cfg.Metrics)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /files/convert", func(w http.ResponseWriter, r *http.Request) {
+		middleware.LogWithCorrelationID(r.Context(), "Processing file conversion")
+		extendDeadlines(w, r, cfg.Timeout)
+
+		opts, err := convertOptions(r.URL.Query())
+		if err != nil {
+			middleware.WriteJSONError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		opts.Metrics = cfg.Metrics
+		r.Body = http.MaxBytesReader(w, r.Body, cfg.MaxBytes)
+		contentType := convertContentTypes[opts.To]
+		if opts.Compress != files.CompressionNone {
+			contentType = "application/" + string(opts.Compress)
+		}
+		out := &lazyHeaderWriter{w: w, contentType: contentType}
+		_, err = files.Convert(r.Context(), r.Body, out, opts)
+		switch {
+		case err == nil:
+			if !out.wrote {
+				out.Write(nil)
+			}
+		case out.wrote:
+			middleware.LogWithCorrelationID(r.Context(), "Aborting file conversion: %v", err)
+			panic(http.ErrAbortHandler)
+		default:
+			writeUploadError(w, r, err)
+		}
+	})
+	return mux
+}
+
+// convertOptions reads the conversion options of a query
+func convertOptions(query url.Values) (files.ConvertOptions, error) {
+	var opts files.ConvertOptions
+	var err error
+	if opts.From, err = files.ParseFormat(query.Get("from")); err != nil {
+		return opts, fmt.Errorf("from: %w", err)
+	}
+	if opts.To, err = files.ParseFormat(query.Get("to")); err != nil {
+		return opts, fmt.Errorf("to: %w", err)
+	}
+	if opts.Delimiter, err = parseDelimiter(query.Get("delimiter")); err != nil {
+		return opts, fmt.Errorf("delimiter: %w", err)
+	}
+	if opts.OutDelimiter, err = parseDelimiter(query.Get("out_delimiter")); err != nil {
+		return opts, fmt.Errorf("out_delimiter: %w", err)
+	}
+	if v := query.Get("lazy_quotes"); v != "" {
+		if opts.LazyQuotes, err = strconv.ParseBool(v); err != nil {
+			return opts, fmt.Errorf("lazy_quotes: %w", err)
+		}
+	}
+	switch query.Get("quote") {
+	case "", "minimal":
+	case "all":
+		opts.QuoteAll = true
+	default:
+		return opts, errors.New("quote must be minimal or all")
+	}
+	if opts.Compress, err = files.ParseCompression(query.Get("compress")); err != nil {
+		return opts, fmt.Errorf("compress: %w", err)
+	}
+	if opts.ParquetCodec, err = files.ParseParquetCodec(query.Get("codec")); err != nil {
+		return opts, fmt.Errorf("codec: %w", err)
+	}
+	switch {
+	case opts.From == files.FormatParquet:
+		return opts, errors.New("from: parquet can only be written")
+	case opts.To == files.FormatParquet && opts.Compress != files.CompressionNone:
+		return opts, errors.New("compress: parquet output is compressed with codec")
+	case opts.To != files.FormatParquet && query.Get("codec") != "":
+		return opts, errors.New("codec: only applies to parquet output")
+	}
+	return opts, nil
+}
+
+// parseDelimiter reads a delimiter given as one character or as tab
+func parseDelimiter(s string) (rune, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if s == "tab" {
+		return '\t', nil
+	}
+	r, size := utf8.DecodeRuneInString(s)
+	if size != len(s) || r == utf8.RuneError || r == '"' || r == '\r' || r == '\n' {
+		return 0, fmt.Errorf("invalid delimiter %q", s)
+	}
+	return r, nil
+}
+
+// lazyHeaderWriter sends the 200 header with the first write, so an error
+// found before any output can still answer with its own status
+type lazyHeaderWriter struct {
+	w           http.ResponseWriter
+	contentType string
+	wrote       bool
+}
+
+func (l *lazyHeaderWriter) Write(p []byte) (int, error) {
+	if !l.wrote {
+		l.wrote = true
+		l.w.Header().Set("Content-Type", l.contentType)
+		l.w.Header().Set("Cache-Control", "no-store")
+		l.w.WriteHeader(http.StatusOK)
+	}
+	return l.w.Write(p)
+}
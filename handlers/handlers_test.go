@@ -1,12 +1,29 @@
 package handlers
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+
+	"ping/auth"
+	"ping/files"
+	"ping/health"
+	"ping/jobs"
 	"ping/observability"
 )
 
@@ -69,6 +86,45 @@ func TestPongHandlerRejectsUnknownPaths(t *testing.T) {
 	}
 }
 
+func TestPrecomputedResponsesMatchEncoding(t *testing.T) {
+	for _, status := range []string{health.StatusHealthy, health.StatusDegraded, health.StatusUnhealthy} {
+		handler := NewProbeHandler(func(context.Context) health.Report { return health.Report{Status: status} })
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", "/health", nil))
+
+		var want bytes.Buffer
+		json.NewEncoder(&want).Encode(health.Report{Status: status})
+		if w.Body.String() != want.String() {
+			t.Errorf("%s: expected %q, got %q", status, want.String(), w.Body.String())
+		}
+		if got := w.Header().Get("Content-Length"); got != fmt.Sprint(want.Len()) {
+			t.Errorf("%s: expected Content-Length %d, got %q", status, want.Len(), got)
+		}
+		if w.Header().Get("Content-Type") != "application/json; charset=utf-8" || w.Header().Get("Cache-Control") != "no-store" {
+			t.Errorf("%s: unexpected headers %v", status, w.Header())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	PongHandler(w, httptest.NewRequest("GET", "/", nil))
+	if w.Body.String() != "pong\n" || w.Header().Get("Content-Length") != "5" {
+		t.Errorf("Unexpected pong %q with Content-Length %q", w.Body.String(), w.Header().Get("Content-Length"))
+	}
+}
+
+func TestPrecomputedHeadersAreNotShared(t *testing.T) {
+	// A middleware adding to a header must not change later responses
+	w := httptest.NewRecorder()
+	PongHandler(w, httptest.NewRequest("GET", "/", nil))
+	w.Header().Add("Cache-Control", "private")
+
+	w = httptest.NewRecorder()
+	PongHandler(w, httptest.NewRequest("GET", "/", nil))
+	if got := w.Header().Values("Cache-Control"); len(got) != 1 || got[0] != "no-store" {
+		t.Errorf("Expected only no-store, got %v", got)
+	}
+}
+
 func TestHealthHandlerJSON(t *testing.T) {
 	// Initialize metrics
 	observability.InitMetrics()
@@ -88,6 +144,82 @@ func TestHealthHandlerJSON(t *testing.T) {
 	}
 }
 
+func TestHealthHandlerAggregatesChecks(t *testing.T) {
+	reg := health.NewRegistry()
+	reg.Register("database", func(ctx context.Context) error { return nil })
+	reg.RegisterCheck(health.Check{Name: "cache", Check: func(ctx context.Context) error { return errors.New("timeout") }, NonCritical: true})
+
+	w := httptest.NewRecorder()
+	NewHealthHandler(reg)(w, httptest.NewRequest("GET", "/health", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected a failed non-critical check to keep 200, got %d", w.Code)
+	}
+	var got health.Report
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Response is not valid JSON: %v", err)
+	}
+	if got.Status != health.StatusDegraded || got.Checks["cache"].Error != "timeout" || got.Checks["database"].Status != health.ResultPass {
+		t.Errorf("Unexpected report %+v", got)
+	}
+
+	reg.Register("database", func(ctx context.Context) error { return errors.New("connection refused") })
+	w = httptest.NewRecorder()
+	NewHealthHandler(reg)(w, httptest.NewRequest("GET", "/health", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected a failed critical check to return 503, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `"database":{"status":"fail","error":"connection refused","critical":true}`) {
+		t.Errorf("Expected the failing check in the body, got %s", w.Body.String())
+	}
+}
+
+func TestProbeHandler(t *testing.T) {
+	reg := health.NewRegistry()
+	startup := NewProbeHandler(func(context.Context) health.Report { return reg.Startup() })
+
+	w := httptest.NewRecorder()
+	startup(w, httptest.NewRequest("GET", "/startupz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 before startup completes, got %d", w.Code)
+	}
+
+	reg.MarkStarted()
+	w = httptest.NewRecorder()
+	startup(w, httptest.NewRequest("GET", "/startupz", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "{\"status\":\"healthy\"}\n" {
+		t.Errorf("Expected 200 healthy after startup, got %d %s", w.Code, w.Body.String())
+	}
+
+	reg.MarkDraining()
+	w = httptest.NewRecorder()
+	NewProbeHandler(reg.Readiness)(w, httptest.NewRequest("GET", "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), health.DrainingCheck) {
+		t.Errorf("Expected 503 naming the drain, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestProbeHandlerVerbose(t *testing.T) {
+	reg := health.NewRegistry()
+	reg.Register("db", func(ctx context.Context) error { return nil })
+	handler := NewHealthHandler(reg)
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/health", nil))
+	if strings.Contains(w.Body.String(), "last_success") {
+		t.Errorf("Expected no details without verbose, got %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/health?verbose=1", nil))
+	var got health.Report
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Response is not valid JSON: %v", err)
+	}
+	if db := got.Checks["db"]; db.LastSuccess == nil || db.Status != health.ResultPass {
+		t.Errorf("Expected the last success in verbose output, got %+v", db)
+	}
+}
+
 func TestMetricsHandler(t *testing.T) {
 	// Initialize metrics
 	observability.InitMetrics()
@@ -201,3 +333,612 @@ func TestHandlersConcurrency(t *testing.T) {
 		}
 	}
 }
+
+func TestRecentRequestsHandler(t *testing.T) {
+	ring := observability.NewRequestRing(5)
+	ring.Add(observability.RequestSummary{Method: "GET", Path: "/first", Status: 200})
+	ring.Add(observability.RequestSummary{Method: "GET", Path: "/second", Status: 404, CorrelationID: "abc"})
+
+	req := httptest.NewRequest("GET", "/debug/requests", nil)
+	w := httptest.NewRecorder()
+
+	RecentRequestsHandler(ring)(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+		t.Errorf("Expected Content-Type application/json, got %s", ct)
+	}
+
+	var got []observability.RequestSummary
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Response is not valid JSON: %v", err)
+	}
+	if len(got) != 2 || got[0].Path != "/second" || got[0].CorrelationID != "abc" {
+		t.Errorf("Expected newest summary first, got %+v", got)
+	}
+}
+
+func TestStatsHandler(t *testing.T) {
+	stats := observability.NewRequestStats(time.Minute)
+	stats.Record(http.StatusOK, 20*time.Millisecond)
+	stats.Record(http.StatusServiceUnavailable, 20*time.Millisecond)
+
+	req := httptest.NewRequest("GET", "/stats", nil)
+	w := httptest.NewRecorder()
+
+	StatsHandler(stats, func() map[string]bool {
+		return map[string]bool{"otlp": true, "graphite": false}
+	})(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+	var got struct {
+		Requests  uint64             `json:"requests"`
+		ErrorRate float64            `json:"error_rate"`
+		LatencyMs map[string]float64 `json:"latency_ms"`
+		Targets   map[string]string  `json:"targets"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Response is not valid JSON: %v", err)
+	}
+	if got.Requests != 2 || got.ErrorRate != 0.5 {
+		t.Errorf("Expected two requests with half failed, got %+v", got)
+	}
+	if got.LatencyMs["p99"] < 20 {
+		t.Errorf("Expected p99 of at least 20ms, got %v", got.LatencyMs)
+	}
+	if got.Targets["otlp"] != "up" || got.Targets["graphite"] != "down" {
+		t.Errorf("Unexpected targets %v", got.Targets)
+	}
+}
+
+func TestEchoHandler(t *testing.T) {
+	observability.InitMetrics()
+
+	req := httptest.NewRequest("POST", "/echo?x=1", strings.NewReader("hello"))
+	req.Header.Set("X-Test", "yes")
+	ctx := observability.WithCorrelationID(req.Context(), "echo-id")
+	ctx = auth.WithClientIdentity(ctx, &auth.ClientIdentity{CommonName: "billing"})
+	w := httptest.NewRecorder()
+	EchoHandler(w, req.WithContext(ctx))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	var got echoResponse
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if got.Method != "POST" || got.Path != "/echo" || got.Body != "hello" || got.Query["x"][0] != "1" {
+		t.Errorf("Unexpected echo %+v", got)
+	}
+	if got.Headers["X-Test"][0] != "yes" || got.CorrelationID != "echo-id" {
+		t.Errorf("Expected headers and correlation ID, got %+v", got)
+	}
+	if got.ClientIdentity == nil || got.ClientIdentity.CommonName != "billing" {
+		t.Errorf("Expected client identity, got %+v", got.ClientIdentity)
+	}
+}
+
+func TestEchoHandlerBodyLimit(t *testing.T) {
+	observability.InitMetrics()
+
+	req := httptest.NewRequest("POST", "/echo", strings.NewReader(strings.Repeat("x", maxEchoBody+1)))
+	w := httptest.NewRecorder()
+	EchoHandler(w, req)
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413, got %d", w.Code)
+	}
+}
+
+func TestIPHandler(t *testing.T) {
+	observability.InitMetrics()
+
+	req := httptest.NewRequest("GET", "/ip", nil)
+	req.RemoteAddr = "203.0.113.9:5000"
+	w := httptest.NewRecorder()
+	IPHandler(w, req)
+
+	var got map[string]string
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if got["ip"] != "203.0.113.9" {
+		t.Errorf("Expected peer IP, got %q", got["ip"])
+	}
+}
+
+func TestMetricsHandlerNegotiatesOpenMetrics(t *testing.T) {
+	observability.InitMetrics()
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	w := httptest.NewRecorder()
+	MetricsHandler(w, req)
+
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/openmetrics-text") {
+		t.Errorf("Expected OpenMetrics content type, got %q", ct)
+	}
+	if !strings.HasSuffix(w.Body.String(), "# EOF\n") {
+		t.Error("OpenMetrics exposition should end with # EOF")
+	}
+}
+
+func TestNewMetricsHandlerServesGivenRegistry(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := observability.NewMetrics(observability.MetricsOptions{Registry: reg})
+	m.RecordResponse("GET", "/own", "unnamed", 200, 0.1, observability.SpanContext{})
+
+	w := httptest.NewRecorder()
+	NewMetricsHandler(reg, reg).ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+	if !strings.Contains(body, `http_requests_total{code="200",handler="unnamed",method="GET",route="/own"} 1`) {
+		t.Errorf("Expected the registry's series, got:\n%s", body)
+	}
+	if !strings.Contains(body, "promhttp_metric_handler_requests_total") {
+		t.Error("Expected scrape counter registered in the given registry")
+	}
+}
+
+func TestMetricsHandlerCreatedTimestamps(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := observability.NewMetrics(observability.MetricsOptions{Registry: reg})
+	m.RecordResponse("GET", "/", "pong", 200, 0.1, observability.SpanContext{})
+
+	for _, created := range []bool{false, true} {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+		w := httptest.NewRecorder()
+		NewMetricsHandlerWithOptions(reg, reg, MetricsHandlerOptions{CreatedTimestamps: created}).ServeHTTP(w, req)
+
+		if got := strings.Contains(w.Body.String(), "http_requests_created{"); got != created {
+			t.Errorf("With CreatedTimestamps=%v, expected _created samples %v, got:\n%s", created, created, w.Body.String())
+		}
+	}
+
+	// The classic text format never carries them
+	w := httptest.NewRecorder()
+	NewMetricsHandlerWithOptions(reg, reg, MetricsHandlerOptions{CreatedTimestamps: true}).ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if strings.Contains(w.Body.String(), "http_requests_created") {
+		t.Error("Expected no _created samples in the text format")
+	}
+}
+
+func TestJobsHandler(t *testing.T) {
+	pool := jobs.NewPool(jobs.PoolConfig{Workers: 1})
+	defer pool.Shutdown(context.Background())
+	queue := jobs.NewQueue(jobs.QueueConfig{Pool: pool})
+	started := make(chan struct{})
+	queue.Handle("wait", func(ctx context.Context, payload json.RawMessage) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	h := NewJobsHandler(queue)
+
+	serve := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req = req.WithContext(observability.WithCorrelationID(req.Context(), "req-42"))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve("POST", "/jobs", `{"type":"wait","payload":{"n":1}}`)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d: %s", w.Code, w.Body)
+	}
+	var job jobs.Job
+	if err := json.NewDecoder(w.Body).Decode(&job); err != nil {
+		t.Fatal(err)
+	}
+	if job.CorrelationID != "req-42" || w.Header().Get("Location") != "/jobs/"+job.ID {
+		t.Errorf("Expected the request's correlation ID and a Location, got %+v, %q", job, w.Header().Get("Location"))
+	}
+	<-started
+
+	if w := serve("POST", "/jobs", `{"type":"nope"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown type, got %d", w.Code)
+	}
+	if w := serve("POST", "/jobs", `not json`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a bad body, got %d", w.Code)
+	}
+
+	w = serve("GET", "/jobs?state=running", "")
+	var list []jobs.Job
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].ID != job.ID {
+		t.Errorf("Expected the running job listed, got %+v", list)
+	}
+	if w := serve("GET", "/jobs/missing", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", w.Code)
+	}
+
+	if w := serve("DELETE", "/jobs/"+job.ID, ""); w.Code != http.StatusAccepted {
+		t.Fatalf("Expected 202 on cancel, got %d", w.Code)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		w = serve("GET", "/jobs/"+job.ID, "")
+		json.NewDecoder(w.Body).Decode(&job)
+		if job.State == jobs.StateCanceled || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if job.State != jobs.StateCanceled {
+		t.Fatalf("Expected the job canceled, got %+v", job)
+	}
+	if w := serve("DELETE", "/jobs/"+job.ID, ""); w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for a finished job, got %d", w.Code)
+	}
+	if w := serve("POST", "/jobs/"+job.ID+"/retry", ""); w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 retrying a job that is not dead, got %d", w.Code)
+	}
+}
+
+func TestJobsHandlerDeadLetters(t *testing.T) {
+	pool := jobs.NewPool(jobs.PoolConfig{Workers: 1})
+	defer pool.Shutdown(context.Background())
+	queue := jobs.NewQueue(jobs.QueueConfig{Pool: pool, Retry: jobs.RetryPolicy{MaxAttempts: 1}})
+	queue.Handle("broken", func(ctx context.Context, payload json.RawMessage) error {
+		return errors.New("always")
+	})
+	h := NewJobsHandler(queue)
+	job, err := queue.Enqueue(context.Background(), "broken", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dead []jobs.Job
+	deadline := time.Now().Add(2 * time.Second)
+	for len(dead) == 0 && time.Now().Before(deadline) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/jobs/dead-letter", nil))
+		json.NewDecoder(w.Body).Decode(&dead)
+		time.Sleep(5 * time.Millisecond)
+	}
+	if len(dead) != 1 || dead[0].ID != job.ID || dead[0].Error != "always" {
+		t.Fatalf("Expected the failed job in the dead-letter list, got %+v", dead)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/jobs/"+job.ID+"/retry", nil))
+	if w.Code != http.StatusAccepted {
+		t.Errorf("Expected 202 on retry, got %d: %s", w.Code, w.Body)
+	}
+}
+
+// slowUpload posts a CSV of rows rows in chunks of chunk rows, pausing
+// between chunks, to a server whose own deadlines are 100ms.
+func slowUpload(t *testing.T, timeout time.Duration, rows, chunk int) (*http.Response, error) {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(NewCSVUploadHandler(CSVUploadConfig{MaxBytes: 1 << 30, Timeout: timeout}))
+	srv.Config.ReadTimeout = 100 * time.Millisecond
+	srv.Config.WriteTimeout = 100 * time.Millisecond
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.Write([]byte("id,name\n"))
+		line := []byte("12345," + strings.Repeat("x", 40) + "\n")
+		for sent := 0; sent < rows; sent += chunk {
+			time.Sleep(50 * time.Millisecond)
+			if _, err := pw.Write(bytes.Repeat(line, chunk)); err != nil {
+				return
+			}
+		}
+		pw.Close()
+	}()
+	return http.Post(srv.URL+"/files/csv", "text/csv", pr)
+}
+
+func TestCSVUploadHandlerOutlastsServerTimeouts(t *testing.T) {
+	observability.InitMetrics()
+	const rows, chunk = 80000, 10000
+	resp, err := slowUpload(t, 10*time.Second, rows, chunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var summary files.Summary
+	if err := json.NewDecoder(resp.Body).Decode(&summary); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected a summary, got %d: %v", resp.StatusCode, err)
+	}
+	if summary.ValidRows != rows {
+		t.Errorf("Expected %d valid rows, got %+v", rows, summary)
+	}
+
+	// Without the handler's own timeout the server's deadline cuts it off
+	resp, err = slowUpload(t, 0, rows, chunk)
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			t.Error("Expected the server's read deadline to fail the upload")
+		}
+	}
+}
+
+func TestCSVUploadHandler(t *testing.T) {
+	observability.InitMetrics()
+	h := NewCSVUploadHandler(CSVUploadConfig{MaxBytes: 1 << 20})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/files/csv", strings.NewReader("id,name\n1,alice\n2\n")))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body)
+	}
+	var summary files.Summary
+	if err := json.NewDecoder(w.Body).Decode(&summary); err != nil {
+		t.Fatal(err)
+	}
+	if summary.Rows != 2 || summary.ValidRows != 1 || summary.Invalid != 1 || len(summary.Errors) != 1 {
+		t.Errorf("Unexpected summary %+v", summary)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/files/csv", strings.NewReader("")))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an empty file, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/files/csv", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for GET, got %d", w.Code)
+	}
+}
+
+func TestCSVUploadHandlerMultipart(t *testing.T) {
+	observability.InitMetrics()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("note", "ignored")
+	part, _ := form.CreateFormFile("file", "rows.csv")
+	part.Write([]byte("id\n1\n2\n"))
+	form.Close()
+
+	req := httptest.NewRequest("POST", "/files/csv", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	w := httptest.NewRecorder()
+	NewCSVUploadHandler(CSVUploadConfig{MaxBytes: 1 << 20}).ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body)
+	}
+	var summary files.Summary
+	json.NewDecoder(w.Body).Decode(&summary)
+	if summary.ValidRows != 2 {
+		t.Errorf("Expected 2 valid rows, got %+v", summary)
+	}
+}
+
+func TestCSVUploadHandlerRejectsLargeFiles(t *testing.T) {
+	observability.InitMetrics()
+	w := httptest.NewRecorder()
+	input := "id\n" + strings.Repeat("1\n", 100)
+	NewCSVUploadHandler(CSVUploadConfig{MaxBytes: 16}).ServeHTTP(w, httptest.NewRequest("POST", "/files/csv", strings.NewReader(input)))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413, got %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestConvertHandler(t *testing.T) {
+	observability.InitMetrics()
+	h := NewConvertHandler(ConvertConfig{MaxBytes: 1 << 20})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/files/convert?from=csv&to=jsonl", strings.NewReader("id,name\n1,jo\n")))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Expected NDJSON content type, got %q", ct)
+	}
+	if got := w.Body.String(); got != "{\"id\":\"1\",\"name\":\"jo\"}\n" {
+		t.Errorf("Unexpected output %q", got)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/files/convert?from=csv&to=tsv&delimiter=%3B&quote=all", strings.NewReader("a;b\n1;2\n")))
+	if got := w.Body.String(); got != "\"a\"\t\"b\"\n\"1\"\t\"2\"\n" {
+		t.Errorf("Unexpected output %q", got)
+	}
+}
+
+func TestConvertHandlerRejectsBadRequests(t *testing.T) {
+	observability.InitMetrics()
+	h := NewConvertHandler(ConvertConfig{MaxBytes: 1 << 20})
+	for name, target := range map[string]string{
+		"missing format":        "/files/convert?from=csv",
+		"unknown format":        "/files/convert?from=csv&to=xlsx",
+		"bad delimiter":         "/files/convert?from=csv&to=tsv&delimiter=ab",
+		"bad quote mode":        "/files/convert?from=csv&to=tsv&quote=some",
+		"bad lazy quotes":       "/files/convert?from=csv&to=tsv&lazy_quotes=maybe",
+		"parquet input":         "/files/convert?from=parquet&to=csv",
+		"compressed parquet":    "/files/convert?from=csv&to=parquet&compress=gzip",
+		"unknown codec":         "/files/convert?from=csv&to=parquet&codec=lz4",
+		"codec without parquet": "/files/convert?from=csv&to=tsv&codec=zstd",
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("POST", target, strings.NewReader("a\n1\n")))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", name, w.Code)
+		}
+	}
+
+	// A malformed first row is found before any output is written
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/files/convert?from=jsonl&to=csv", strings.NewReader("[1]\n")))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a bad header, got %d", w.Code)
+	}
+}
+
+func TestConvertHandlerParquet(t *testing.T) {
+	observability.InitMetrics()
+	w := httptest.NewRecorder()
+	NewConvertHandler(ConvertConfig{MaxBytes: 1 << 20}).ServeHTTP(w, httptest.NewRequest("POST", "/files/convert?from=csv&to=parquet&codec=gzip", strings.NewReader("id,name\n1,jo\n")))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/vnd.apache.parquet" {
+		t.Errorf("Expected the Parquet content type, got %q", ct)
+	}
+	body := w.Body.Bytes()
+	if !bytes.HasPrefix(body, []byte("PAR1")) || !bytes.HasSuffix(body, []byte("PAR1")) {
+		t.Errorf("Expected a Parquet file, got %q", body)
+	}
+}
+
+func TestConvertHandlerAbortsAfterPartialOutput(t *testing.T) {
+	observability.InitMetrics()
+	input := "id\n" + strings.Repeat("1\n", 5000) + "\"broken\n"
+	defer func() {
+		if p := recover(); p != http.ErrAbortHandler {
+			t.Errorf("Expected the response to be aborted, got %v", p)
+		}
+	}()
+	NewConvertHandler(ConvertConfig{MaxBytes: 1 << 20}).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/files/convert?from=csv&to=jsonl", strings.NewReader(input)))
+}
+
+func TestFileHandlersCompressedData(t *testing.T) {
+	observability.InitMetrics()
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte("id,name\n1,jo\n"))
+	zw.Close()
+
+	w := httptest.NewRecorder()
+	NewCSVUploadHandler(CSVUploadConfig{MaxBytes: 1 << 20}).ServeHTTP(w, httptest.NewRequest("POST", "/files/csv", bytes.NewReader(gz.Bytes())))
+	var summary files.Summary
+	json.NewDecoder(w.Body).Decode(&summary)
+	if w.Code != http.StatusOK || summary.ValidRows != 1 || summary.Compression != files.CompressionGzip {
+		t.Errorf("Expected a decompressed summary, got %d %+v", w.Code, summary)
+	}
+
+	w = httptest.NewRecorder()
+	NewConvertHandler(ConvertConfig{MaxBytes: 1 << 20}).ServeHTTP(w, httptest.NewRequest("POST", "/files/convert?from=csv&to=jsonl&compress=zstd", bytes.NewReader(gz.Bytes())))
+	if ct := w.Header().Get("Content-Type"); w.Code != http.StatusOK || ct != "application/zstd" {
+		t.Fatalf("Expected zstd output, got %d %q", w.Code, ct)
+	}
+	r, compression, err := files.Decompress(w.Body)
+	if err != nil || compression != files.CompressionZstd {
+		t.Fatalf("Expected a zstd body, got %q %v", compression, err)
+	}
+	if out, _ := io.ReadAll(r); string(out) != "{\"id\":\"1\",\"name\":\"jo\"}\n" {
+		t.Errorf("Unexpected output %q", out)
+	}
+
+	w = httptest.NewRecorder()
+	NewConvertHandler(ConvertConfig{MaxBytes: 1 << 20}).ServeHTTP(w, httptest.NewRequest("POST", "/files/convert?from=csv&to=jsonl&compress=rar", strings.NewReader("a\n")))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown compression, got %d", w.Code)
+	}
+}
+
+func TestCSVUploadHandlerSchemas(t *testing.T) {
+	observability.InitMetrics()
+	schema, err := files.ParseSchema([]byte(`{"columns": [{"name": "id", "type": "int", "required": true}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	h := NewCSVUploadHandler(CSVUploadConfig{
+		MaxBytes:   1 << 20,
+		Schemas:    map[string]*files.Schema{"orders": schema},
+		RejectsDir: dir,
+	})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/files/csv/orders", strings.NewReader("id\n1\nx\n")))
+	var summary files.Summary
+	json.NewDecoder(w.Body).Decode(&summary)
+	if w.Code != http.StatusOK || summary.Invalid != 1 || summary.ColumnErrors["id"] != 1 {
+		t.Fatalf("Expected one invalid id, got %d %+v", w.Code, summary)
+	}
+	rejects, err := os.ReadFile(filepath.Join(dir, summary.RejectsFile))
+	if err != nil || !strings.HasPrefix(string(rejects), "line,error,id\n3,") {
+		t.Errorf("Unexpected rejects %q (%v)", rejects, err)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/files/csv/orders", strings.NewReader("name\njo\n")))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a missing required column, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/files/csv/invoices", strings.NewReader("id\n1\n")))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown schema, got %d", w.Code)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Expected only the one rejects file, got %d", len(entries))
+	}
+}
+
+// discardWriter is a ResponseWriter that drops everything, so benchmarks
+// measure the handler rather than a recorder.
+type discardWriter struct {
+	header http.Header
+}
+
+func (w *discardWriter) Header() http.Header         { return w.header }
+func (w *discardWriter) Write(p []byte) (int, error) { return len(p), nil }
+func (w *discardWriter) WriteHeader(int)             {}
+
+// benchmarkHandler serves req with h, which logs to nowhere.
+func benchmarkHandler(b *testing.B, h http.Handler, req func() *http.Request) {
+	observability.InitMetrics()
+	prev := log.Writer()
+	log.SetOutput(io.Discard)
+	b.Cleanup(func() { log.SetOutput(prev) })
+	w := &discardWriter{header: make(http.Header)}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		clear(w.header)
+		h.ServeHTTP(w, req())
+	}
+}
+
+func BenchmarkPongHandler(b *testing.B) {
+	req := httptest.NewRequest("GET", "/", nil)
+	benchmarkHandler(b, http.HandlerFunc(PongHandler), func() *http.Request { return req })
+}
+
+func BenchmarkHealthHandler(b *testing.B) {
+	req := httptest.NewRequest("GET", "/health", nil)
+	benchmarkHandler(b, http.HandlerFunc(HealthHandler), func() *http.Request { return req })
+}
+
+// BenchmarkProbeHandlerWithChecks measures the reports that are still
+// encoded per request, for comparison with BenchmarkHealthHandler.
+func BenchmarkProbeHandlerWithChecks(b *testing.B) {
+	report := health.Report{Status: health.StatusDegraded, Checks: map[string]health.CheckResult{
+		"redis": {Status: health.StatusUnhealthy, Error: "connection refused"},
+	}}
+	req := httptest.NewRequest("GET", "/health", nil)
+	benchmarkHandler(b, NewProbeHandler(func(context.Context) health.Report { return report }), func() *http.Request { return req })
+}
+
+func BenchmarkIPHandler(b *testing.B) {
+	req := httptest.NewRequest("GET", "/ip", nil)
+	benchmarkHandler(b, http.HandlerFunc(IPHandler), func() *http.Request { return req })
+}
+
+func BenchmarkEchoHandler(b *testing.B) {
+	benchmarkHandler(b, http.HandlerFunc(EchoHandler), func() *http.Request {
+		req := httptest.NewRequest("POST", "/echo?x=1", strings.NewReader(`{"hello":"world"}`))
+		req.Header.Set("Content-Type", "application/json")
+		return req
+	})
+}
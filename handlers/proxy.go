@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"ping/observability"
+)
+
+// ProxyConfig configures NewProxyHandler.
+type ProxyConfig struct {
+	// Upstream receives every request; the request path and query are
+	// appended to its path.
+	Upstream *url.URL
+	// Transport sends the upstream requests. Use an
+	// observability.Transport, e.g. from client.NewTransport, so they
+	// carry the correlation ID and trace context. Nil uses
+	// observability.NewTransport(nil), recording its calls into Metrics
+	// when that is a *observability.Metrics and GetMetrics() otherwise.
+	Transport http.RoundTripper
+	// Metrics records the upstream and overhead durations; nil uses
+	// observability.GetMetrics().
+	Metrics observability.MetricsRecorder
+	// Timeout bounds each upstream call, reading its body included, and
+	// replaces the server's read and write deadlines for the request with
+	// a little more, so a slow upstream is answered with 504 rather than
+	// a reset connection. Zero leaves both to the transport and server.
+	Timeout time.Duration
+}
+
+// proxyDeadlineGrace is the time left after Timeout to send the 504.
+const proxyDeadlineGrace = 5 * time.Second
+
+// NewProxyHandler reverse-proxies requests to cfg.Upstream, turning the
+// service into an instrumentation sidecar. X-Forwarded-For, -Host and
+// -Proto are set for the upstream. Each request records the time spent
+// waiting for the upstream, until its response headers and while reading
+// its body, in proxy_upstream_duration_seconds, and the rest of the time
+// spent in the handler in proxy_overhead_seconds. Upstreams that cannot be
+// reached are answered with 502, or 504 when they time out.
+func NewProxyHandler(cfg ProxyConfig) http.Handler {
+	metrics := observability.RecorderOrDefault(cfg.Metrics)
+	transport := cfg.Transport
+	if transport == nil {
+		// The outbound call metrics exist in Prometheus only
+		calls, _ := metrics.(*observability.Metrics)
+		transport = observability.NewTransportWithOptions(nil, observability.TransportOptions{Metrics: calls})
+	}
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(cfg.Upstream)
+			r.SetXForwarded()
+			// Keep the client's Host so virtual hosts upstream still match
+			r.Out.Host = r.In.Host
+		},
+		Transport: &upstreamTimer{base: transport},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			ctx := r.Context()
+			status := http.StatusBadGateway
+			if errors.Is(err, context.DeadlineExceeded) {
+				status = http.StatusGatewayTimeout
+			}
+			observability.LoggerFromContext(ctx).Warnf(ctx, "proxy [%s] %s failed: %v (id=%s)",
+				r.Method, r.URL.Path, err, observability.GetCorrelationID(ctx))
+			w.WriteHeader(status)
+		},
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ctx := r.Context()
+		if cfg.Timeout > 0 {
+			extendDeadlines(w, r, cfg.Timeout+proxyDeadlineGrace)
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, cfg.Timeout)
+			defer cancel()
+		}
+		timing := &upstreamTiming{}
+		r = r.WithContext(context.WithValue(ctx, upstreamTimingKey{}, timing))
+		proxy.ServeHTTP(w, r)
+
+		upstream := time.Duration(timing.nanos.Load())
+		metrics.ObserveProxy(timing.class(), upstream.Seconds(), max(time.Since(start)-upstream, 0).Seconds())
+	})
+}
+
+type upstreamTimingKey struct{}
+
+// upstreamTiming adds up the time a proxied request spent waiting for the
+// upstream.
+type upstreamTiming struct {
+	nanos  atomic.Int64
+	status atomic.Int32
+}
+
+func (t *upstreamTiming) add(d time.Duration) {
+	t.nanos.Add(int64(d))
+}
+
+// class returns the status class of the upstream answer, or
+// observability.APICallStatusError when there was none.
+func (t *upstreamTiming) class() string {
+	if status := t.status.Load(); status != 0 {
+		return observability.StatusClass(int(status))
+	}
+	return observability.APICallStatusError
+}
+
+// upstreamTimer times the round trips of the requests it sends, and the
+// reads of their response bodies, into their upstreamTiming.
+type upstreamTimer struct {
+	base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *upstreamTimer) RoundTrip(req *http.Request) (*http.Response, error) {
+	timing, _ := req.Context().Value(upstreamTimingKey{}).(*upstreamTiming)
+	if timing == nil {
+		return t.base.RoundTrip(req)
+	}
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	timing.add(time.Since(start))
+	if err != nil {
+		return nil, err
+	}
+	timing.status.Store(int32(resp.StatusCode))
+	resp.Body = &timedBody{ReadCloser: resp.Body, timing: timing}
+	return resp, nil
+}
+
+// timedBody adds the time spent in Read to timing.
+type timedBody struct {
+	io.ReadCloser
+	timing *upstreamTiming
+}
+
+func (b *timedBody) Read(p []byte) (int, error) {
+	start := time.Now()
+	n, err := b.ReadCloser.Read(p)
+	b.timing.add(time.Since(start))
+	return n, err
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"ping/observability"
+)
+
+// upstreamSamples returns the observations of
+// proxy_upstream_duration_seconds by status class, and those of
+// proxy_overhead_seconds.
+func upstreamSamples(t *testing.T, m *observability.Metrics) (map[string]uint64, uint64) {
+	t.Helper()
+	families, err := m.Gatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream := make(map[string]uint64)
+	var overhead uint64
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			switch family.GetName() {
+			case "proxy_upstream_duration_seconds":
+				upstream[metric.GetLabel()[0].GetValue()] = metric.GetHistogram().GetSampleCount()
+			case "proxy_overhead_seconds":
+				overhead = metric.GetHistogram().GetSampleCount()
+			}
+		}
+	}
+	return upstream, overhead
+}
+
+func TestProxyHandlerForwardsAndTimesUpstream(t *testing.T) {
+	m := observability.NewMetrics(observability.MetricsOptions{})
+
+	var got *http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		w.Header().Set("X-Upstream", "yes")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, "from upstream")
+	}))
+	defer srv.Close()
+	upstream, _ := url.Parse(srv.URL + "/api")
+
+	handler := NewProxyHandler(ProxyConfig{Upstream: upstream, Metrics: m})
+	req := httptest.NewRequest("POST", "http://sidecar.local/items?page=2", nil)
+	req = req.WithContext(observability.WithCorrelationID(req.Context(), "proxied-id"))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusCreated || rec.Body.String() != "from upstream" || rec.Header().Get("X-Upstream") != "yes" {
+		t.Errorf("Expected the upstream answer, got %d %q", rec.Code, rec.Body.String())
+	}
+	if got.URL.Path != "/api/items" || got.URL.RawQuery != "page=2" || got.Method != "POST" {
+		t.Errorf("Unexpected upstream request %s %s", got.Method, got.URL)
+	}
+	if got.Header.Get(observability.RequestIDHeader) != "proxied-id" {
+		t.Errorf("Expected the correlation ID upstream, got %q", got.Header.Get(observability.RequestIDHeader))
+	}
+	if got.Header.Get("X-Forwarded-For") == "" || got.Header.Get("X-Forwarded-Host") != "sidecar.local" || got.Host != "sidecar.local" {
+		t.Errorf("Expected forwarding headers, got %v (host %s)", got.Header, got.Host)
+	}
+
+	samples, overhead := upstreamSamples(t, m)
+	if samples["2xx"] != 1 || overhead != 1 {
+		t.Errorf("Expected one upstream and one overhead sample, got %v and %d", samples, overhead)
+	}
+}
+
+func TestProxyHandlerRecordsIntoInjectedRecorder(t *testing.T) {
+	metrics := observability.NewMemoryRecorder()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+	upstream, _ := url.Parse(srv.URL)
+
+	NewProxyHandler(ProxyConfig{Upstream: upstream, Metrics: metrics}).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/missing", nil))
+
+	if got := len(metrics.Observations("proxy_upstream_duration_seconds", "4xx")); got != 1 {
+		t.Errorf("Expected one 4xx upstream sample, got %d", got)
+	}
+	if got := len(metrics.Observations("proxy_overhead_seconds")); got != 1 {
+		t.Errorf("Expected one overhead sample, got %d", got)
+	}
+}
+
+func TestProxyHandlerAnswersBadGateway(t *testing.T) {
+	m := observability.NewMetrics(observability.MetricsOptions{})
+
+	// Nothing listens on port 1
+	upstream, _ := url.Parse("http://127.0.0.1:1")
+	rec := httptest.NewRecorder()
+	NewProxyHandler(ProxyConfig{Upstream: upstream, Metrics: m}).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("Expected 502, got %d", rec.Code)
+	}
+	if samples, _ := upstreamSamples(t, m); samples[observability.APICallStatusError] != 1 {
+		t.Errorf("Expected the failed attempt recorded as an error, got %v", samples)
+	}
+}
+
+func TestProxyHandlerAnswersGatewayTimeout(t *testing.T) {
+	observability.InitMetrics()
+	upstream, _ := url.Parse("http://upstream.invalid")
+	transport := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		return nil, context.DeadlineExceeded
+	})
+	rec := httptest.NewRecorder()
+	NewProxyHandler(ProxyConfig{Upstream: upstream, Transport: transport}).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("Expected 504, got %d", rec.Code)
+	}
+}
+
+func TestProxyHandlerOutlastsServerWriteTimeout(t *testing.T) {
+	m := observability.NewMetrics(observability.MetricsOptions{})
+	upstreamSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(300 * time.Millisecond)
+		}
+		io.WriteString(w, "late")
+	}))
+	defer upstreamSrv.Close()
+	upstream, _ := url.Parse(upstreamSrv.URL)
+
+	sidecar := httptest.NewUnstartedServer(NewProxyHandler(ProxyConfig{Upstream: upstream, Metrics: m, Timeout: 200 * time.Millisecond}))
+	sidecar.Config.WriteTimeout = 100 * time.Millisecond
+	sidecar.Start()
+	defer sidecar.Close()
+
+	resp, err := http.Get(sidecar.URL + "/fast")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200 within the proxy timeout, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(sidecar.URL + "/slow")
+	if err != nil {
+		t.Fatalf("Expected a 504, got a broken connection: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusGatewayTimeout {
+		t.Errorf("Expected 504 past the proxy timeout, got %d", resp.StatusCode)
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
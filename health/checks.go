@@ -0,0 +1,158 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// HTTPCheck passes when a GET of url answers with a 2xx status. A nil
+// client uses http.DefaultClient. Like the other built-in checks it relies
+// on the registry's timeout.
+func HTTPCheck(url string, client *http.Client) CheckFunc {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+		return nil
+	}
+}
+
+// TCPCheck passes when a TCP connection to addr, a host:port, can be
+// opened.
+func TCPCheck(addr string) CheckFunc {
+	return func(ctx context.Context) error {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// DNSCheck passes when host resolves to at least one address.
+func DNSCheck(host string) CheckFunc {
+	return func(ctx context.Context) error {
+		addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+		if err != nil {
+			return err
+		}
+		if len(addrs) == 0 {
+			return fmt.Errorf("no addresses for %s", host)
+		}
+		return nil
+	}
+}
+
+// DiskCheck passes when a file can be written to dir and, where the
+// platform reports it, at least minFree bytes are available there.
+func DiskCheck(dir string, minFree uint64) CheckFunc {
+	return func(ctx context.Context) error {
+		f, err := os.CreateTemp(dir, ".healthcheck-*")
+		if err != nil {
+			return err
+		}
+		name := f.Name()
+		_, err = f.Write([]byte("ok"))
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		os.Remove(name)
+		if err != nil {
+			return err
+		}
+
+		free, err := freeSpace(dir)
+		if errors.Is(err, errFreeSpaceUnsupported) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if free < minFree {
+			return fmt.Errorf("%d bytes free, need %d", free, minFree)
+		}
+		return nil
+	}
+}
+
+// errFreeSpaceUnsupported is returned by freeSpace on platforms that
+// cannot report it.
+var errFreeSpaceUnsupported = errors.New("free space not supported on this platform")
+
+// DependencyOptions tunes the checks built by ParseDependencyChecks.
+type DependencyOptions struct {
+	// NonCritical names checks that only degrade the status.
+	NonCritical []string
+	// DiskMinFree is the free space disk checks require, in bytes.
+	DiskMinFree uint64
+	// Client sends the HTTP checks. Nil uses http.DefaultClient.
+	Client *http.Client
+}
+
+// ParseDependencyChecks builds checks from "kind:name=target" entries:
+// "http:api=https://api.internal/health", "tcp:db=db.internal:5432",
+// "dns:resolver=example.com" or "disk:data=/var/lib/ping".
+func ParseDependencyChecks(entries []string, opts DependencyOptions) ([]Check, error) {
+	nonCritical := make(map[string]bool, len(opts.NonCritical))
+	for _, name := range opts.NonCritical {
+		nonCritical[name] = true
+	}
+	checks := make([]Check, 0, len(entries))
+	seen := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		kind, rest, _ := strings.Cut(entry, ":")
+		name, target, ok := strings.Cut(rest, "=")
+		if !ok || name == "" || target == "" {
+			return nil, fmt.Errorf("health check must look like kind:name=target, got %q", entry)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate health check name %q", name)
+		}
+		seen[name] = true
+
+		var check CheckFunc
+		switch kind {
+		case "http":
+			if !strings.HasPrefix(target, "http://") && !strings.HasPrefix(target, "https://") {
+				return nil, fmt.Errorf("http health check %s needs an http(s) URL, got %q", name, target)
+			}
+			check = HTTPCheck(target, opts.Client)
+		case "tcp":
+			if _, _, err := net.SplitHostPort(target); err != nil {
+				return nil, fmt.Errorf("tcp health check %s needs host:port, got %q", name, target)
+			}
+			check = TCPCheck(target)
+		case "dns":
+			check = DNSCheck(target)
+		case "disk":
+			check = DiskCheck(target, opts.DiskMinFree)
+		default:
+			return nil, fmt.Errorf("unknown health check kind %q in %q (want http, tcp, dns or disk)", kind, entry)
+		}
+		checks = append(checks, Check{Name: name, Check: check, NonCritical: nonCritical[name]})
+	}
+	for name := range nonCritical {
+		if !seen[name] {
+			return nil, fmt.Errorf("non-critical health check %q is not configured", name)
+		}
+	}
+	return checks, nil
+}
@@ -0,0 +1,107 @@
+package health
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHTTPCheck(t *testing.T) {
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	check := HTTPCheck(srv.URL, nil)
+	if err := check(context.Background()); err != nil {
+		t.Errorf("Expected a 200 to pass, got %v", err)
+	}
+	status = http.StatusServiceUnavailable
+	if err := check(context.Background()); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("Expected a 503 to fail, got %v", err)
+	}
+}
+
+func TestTCPCheck(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+
+	if err := TCPCheck(addr)(context.Background()); err != nil {
+		t.Errorf("Expected an open port to pass, got %v", err)
+	}
+	ln.Close()
+	if err := TCPCheck(addr)(context.Background()); err == nil {
+		t.Error("Expected a closed port to fail")
+	}
+}
+
+func TestDNSCheck(t *testing.T) {
+	if err := DNSCheck("localhost")(context.Background()); err != nil {
+		t.Errorf("Expected localhost to resolve, got %v", err)
+	}
+	if err := DNSCheck("does-not-exist.invalid")(context.Background()); err == nil {
+		t.Error("Expected an .invalid name to fail")
+	}
+}
+
+func TestDiskCheck(t *testing.T) {
+	dir := t.TempDir()
+	if err := DiskCheck(dir, 1)(context.Background()); err != nil {
+		t.Errorf("Expected a writable temp dir to pass, got %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Expected the probe file removed, found %d entries", len(entries))
+	}
+	if err := DiskCheck(filepath.Join(dir, "missing"), 0)(context.Background()); err == nil {
+		t.Error("Expected a missing dir to fail")
+	}
+	if err := DiskCheck(dir, 1<<62)(context.Background()); err == nil || !strings.Contains(err.Error(), "free") {
+		t.Errorf("Expected an impossible free-space requirement to fail, got %v", err)
+	}
+}
+
+func TestParseDependencyChecks(t *testing.T) {
+	checks, err := ParseDependencyChecks([]string{
+		"http:api=https://api.internal/health",
+		"tcp:db=db.internal:5432",
+		"dns:resolver=example.com",
+		"disk:data=/var/lib/ping",
+	}, DependencyOptions{NonCritical: []string{"resolver"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checks) != 4 || checks[0].Name != "api" || checks[3].Name != "data" {
+		t.Errorf("Unexpected checks %+v", checks)
+	}
+	if checks[1].NonCritical || !checks[2].NonCritical {
+		t.Error("Expected only the resolver check to be non-critical")
+	}
+}
+
+func TestParseDependencyChecksRejectsInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		entries     []string
+		nonCritical []string
+	}{
+		{entries: []string{"api=https://api"}},
+		{entries: []string{"http:api"}},
+		{entries: []string{"ftp:api=ftp://api"}},
+		{entries: []string{"http:api=api.internal"}},
+		{entries: []string{"tcp:db=db.internal"}},
+		{entries: []string{"dns:a=example.com", "dns:a=example.org"}},
+		{entries: []string{"dns:a=example.com"}, nonCritical: []string{"b"}},
+	} {
+		if _, err := ParseDependencyChecks(tc.entries, DependencyOptions{NonCritical: tc.nonCritical}); err == nil {
+			t.Errorf("Expected %q (non-critical %q) to be rejected", tc.entries, tc.nonCritical)
+		}
+	}
+}
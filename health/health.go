@@ -0,0 +1,411 @@
+// Package health aggregates named checks that subsystems register, e.g. a
+// Redis ping, into one report for the health endpoints.
+package health
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ping/observability"
+)
+
+// DrainingCheck names the readiness result reported while draining.
+const DrainingCheck = "draining"
+
+// Status values of a Report.
+const (
+	StatusHealthy   = "healthy"
+	StatusDegraded  = "degraded"
+	StatusUnhealthy = "unhealthy"
+)
+
+// Result values of a CheckResult.
+const (
+	ResultPass = "pass"
+	ResultFail = "fail"
+)
+
+// CheckFunc reports a subsystem as healthy by returning nil.
+type CheckFunc func(ctx context.Context) error
+
+// Check is a named check.
+type Check struct {
+	// Name identifies the check in reports, e.g. "redis".
+	Name string
+	// Check is run on every report. Required.
+	Check CheckFunc
+	// NonCritical checks are reported but only degrade the status: the
+	// service keeps serving without them, e.g. when a local fallback
+	// takes over.
+	NonCritical bool
+	// Liveness checks also run for the liveness probe. Keep them to the
+	// process's own state, such as a stuck worker: a failing liveness
+	// probe restarts the instance, which does not fix a dependency.
+	Liveness bool
+	// Timeout bounds each run; a check still running then fails. Defaults
+	// to the registry's Timeout.
+	Timeout time.Duration
+}
+
+// CheckResult is the outcome of one check. DurationMs, LastError and
+// LastSuccess are only set by a verbose run.
+type CheckResult struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Critical bool   `json:"critical"`
+	// DurationMs is how long this run of the check took.
+	DurationMs float64 `json:"duration_ms,omitempty"`
+	// LastError is the most recent failure, even when the check has
+	// passed since.
+	LastError string `json:"last_error,omitempty"`
+	// LastSuccess is when the check last passed.
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+}
+
+// Report is the outcome of all checks. Status is StatusUnhealthy when a
+// critical check failed, StatusDegraded when only non-critical ones did
+// and StatusHealthy otherwise.
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// Healthy reports whether no critical check failed.
+func (r Report) Healthy() bool {
+	return r.Status != StatusUnhealthy
+}
+
+// Brief returns the report without the verbose details of each check.
+func (r Report) Brief() Report {
+	if r.Checks == nil {
+		return r
+	}
+	brief := Report{Status: r.Status, Checks: make(map[string]CheckResult, len(r.Checks))}
+	for name, c := range r.Checks {
+		brief.Checks[name] = CheckResult{Status: c.Status, Error: c.Error, Critical: c.Critical}
+	}
+	return brief
+}
+
+// checkState is what the registry remembers of a check across runs.
+type checkState struct {
+	lastError   string
+	lastSuccess time.Time
+
+	// result is the latest result, from a run started at ranAt
+	result CheckResult
+	ranAt  time.Time
+	// running is closed when the run in flight, if any, finishes
+	running chan struct{}
+}
+
+// DefaultCheckTimeout bounds a check run when neither the check nor the
+// registry sets a timeout.
+const DefaultCheckTimeout = 5 * time.Second
+
+// RegistryOptions tunes how a Registry runs its checks.
+type RegistryOptions struct {
+	// Timeout bounds each check run unless the check sets its own.
+	// Defaults to DefaultCheckTimeout.
+	Timeout time.Duration
+	// CacheTTL reuses a check's result for this long, so frequent probes
+	// from several sources do not hammer a dependency. Zero runs the
+	// checks on every report; concurrent reports still share a run in
+	// flight.
+	CacheTTL time.Duration
+	// Metrics records check durations, status and transitions. Defaults
+	// to observability.GetMetrics().
+	Metrics observability.MetricsRecorder
+	// Logger reports checks starting to fail and recovering. Defaults to
+	// observability.DefaultLogger.
+	Logger observability.Logger
+}
+
+// Registry holds the registered checks and the lifecycle state the
+// probes report. It is safe for concurrent use.
+type Registry struct {
+	opts RegistryOptions
+
+	mu     sync.RWMutex
+	checks []Check
+	state  map[string]*checkState
+
+	hooks []func(StatusChange)
+
+	started  atomic.Bool
+	draining atomic.Bool
+}
+
+// StatusChange describes a check moving between ResultPass and
+// ResultFail.
+type StatusChange struct {
+	Check string
+	// From is the previous result, or "" when the check first fails.
+	From     string
+	To       string
+	Error    string
+	Critical bool
+}
+
+// NewRegistry returns an empty registry, which reports healthy.
+func NewRegistry() *Registry {
+	return NewRegistryWithOptions(RegistryOptions{})
+}
+
+// NewRegistryWithOptions is NewRegistry with check run options.
+func NewRegistryWithOptions(opts RegistryOptions) *Registry {
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultCheckTimeout
+	}
+	opts.Metrics = observability.RecorderOrDefault(opts.Metrics)
+	if opts.Logger == nil {
+		opts.Logger = observability.DefaultLogger
+	}
+	return &Registry{opts: opts, state: make(map[string]*checkState)}
+}
+
+// Register adds a critical check.
+func (r *Registry) Register(name string, check CheckFunc) {
+	r.RegisterCheck(Check{Name: name, Check: check})
+}
+
+// RegisterCheck adds c, replacing a check of the same name.
+func (r *Registry) RegisterCheck(c Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, existing := range r.checks {
+		if existing.Name == c.Name {
+			r.checks[i] = c
+			return
+		}
+	}
+	r.checks = append(r.checks, c)
+	if r.state == nil {
+		r.state = make(map[string]*checkState)
+	}
+	r.state[c.Name] = &checkState{}
+}
+
+// OnStatusChange registers fn to be called after a check starts failing
+// or recovers, e.g. to page someone or flip a feature flag. Changes are
+// also logged and counted in health_check_transitions_total. fn runs on
+// the goroutine of the check and must not block.
+func (r *Registry) OnStatusChange(fn func(StatusChange)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hooks = append(r.hooks, fn)
+}
+
+// MarkStarted records that initialization is complete.
+func (r *Registry) MarkStarted() {
+	r.started.Store(true)
+}
+
+// Started reports whether MarkStarted was called.
+func (r *Registry) Started() bool {
+	return r.started.Load()
+}
+
+// MarkDraining records that the service is shutting down, so readiness
+// fails and load balancers stop sending new requests.
+func (r *Registry) MarkDraining() {
+	r.draining.Store(true)
+}
+
+// Draining reports whether MarkDraining was called.
+func (r *Registry) Draining() bool {
+	return r.draining.Load()
+}
+
+// Run runs every check concurrently and aggregates the results. A
+// panicking check fails instead of taking the caller down.
+func (r *Registry) Run(ctx context.Context) Report {
+	return r.run(ctx, func(Check) bool { return true })
+}
+
+// Liveness runs only the checks marked Liveness.
+func (r *Registry) Liveness(ctx context.Context) Report {
+	return r.run(ctx, func(c Check) bool { return c.Liveness })
+}
+
+// Readiness runs every check and fails, under DrainingCheck, once the
+// registry is draining.
+func (r *Registry) Readiness(ctx context.Context) Report {
+	report := r.Run(ctx)
+	if r.Draining() {
+		if report.Checks == nil {
+			report.Checks = make(map[string]CheckResult, 1)
+		}
+		report.Checks[DrainingCheck] = CheckResult{Status: ResultFail, Error: "shutting down", Critical: true}
+		report.Status = StatusUnhealthy
+	}
+	return report
+}
+
+// Startup reports healthy once MarkStarted was called.
+func (r *Registry) Startup() Report {
+	if !r.Started() {
+		return Report{Status: StatusUnhealthy}
+	}
+	return Report{Status: StatusHealthy}
+}
+
+func (r *Registry) run(ctx context.Context, include func(Check) bool) Report {
+	r.mu.RLock()
+	var checks []Check
+	for _, c := range r.checks {
+		if include(c) {
+			checks = append(checks, c)
+		}
+	}
+	r.mu.RUnlock()
+
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = r.evaluate(ctx, c)
+		}()
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusHealthy}
+	if len(checks) > 0 {
+		report.Checks = make(map[string]CheckResult, len(checks))
+	}
+	for i, c := range checks {
+		result := results[i]
+		if result.Status == ResultFail {
+			switch {
+			case result.Critical:
+				report.Status = StatusUnhealthy
+			case report.Status == StatusHealthy:
+				report.Status = StatusDegraded
+			}
+		}
+		report.Checks[c.Name] = result
+	}
+	return report
+}
+
+// evaluate returns the result of c: the cached one while it is fresh,
+// the one of a run already in flight, or that of a new run.
+func (r *Registry) evaluate(ctx context.Context, c Check) CheckResult {
+	r.mu.Lock()
+	st, ok := r.state[c.Name]
+	if !ok {
+		// Replaced concurrently; run it without keeping state
+		r.mu.Unlock()
+		return r.execute(ctx, c)
+	}
+	if r.opts.CacheTTL > 0 && !st.ranAt.IsZero() && time.Since(st.ranAt) < r.opts.CacheTTL && st.running == nil {
+		result := st.result
+		r.mu.Unlock()
+		return result
+	}
+	if running := st.running; running != nil {
+		r.mu.Unlock()
+		select {
+		case <-running:
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			return st.result
+		case <-ctx.Done():
+			return CheckResult{Status: ResultFail, Error: ctx.Err().Error(), Critical: !c.NonCritical}
+		}
+	}
+	running := make(chan struct{})
+	st.running = running
+	r.mu.Unlock()
+
+	start := time.Now()
+	result := r.execute(ctx, c)
+
+	r.mu.Lock()
+	change := StatusChange{Check: c.Name, From: st.result.Status, To: result.Status, Error: result.Error, Critical: result.Critical}
+	if result.Status == ResultFail {
+		st.lastError = result.Error
+	} else {
+		st.lastSuccess = start
+	}
+	result.LastError = st.lastError
+	if !st.lastSuccess.IsZero() {
+		lastSuccess := st.lastSuccess
+		result.LastSuccess = &lastSuccess
+	}
+	st.result = result
+	st.ranAt = start
+	st.running = nil
+	close(running)
+	hooks := r.hooks
+	r.mu.Unlock()
+
+	metrics := r.opts.Metrics
+	metrics.RecordHealthCheck(c.Name, result.DurationMs/1000, result.Status == ResultPass)
+	// A first run that passes is not a change worth reporting
+	if change.From != change.To && (change.From != "" || change.To == ResultFail) {
+		metrics.IncHealthCheckTransitions(c.Name, change.To)
+		if change.To == ResultFail {
+			r.opts.Logger.Warnf(ctx, "health check %s failing: %s", c.Name, change.Error)
+		} else {
+			r.opts.Logger.Infof(ctx, "health check %s recovered", c.Name)
+		}
+		for _, hook := range hooks {
+			hook(change)
+		}
+	}
+	return result
+}
+
+// execute runs c once within its timeout. The run is detached from
+// ctx's cancellation, since its result may be shared with other callers,
+// and abandoned rather than awaited once the timeout passes.
+func (r *Registry) execute(ctx context.Context, c Check) CheckResult {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = r.opts.Timeout
+	}
+	if timeout <= 0 {
+		timeout = DefaultCheckTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- runCheck(ctx, c.Check)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("timed out after %s", timeout)
+	}
+
+	result := CheckResult{
+		Status:     ResultPass,
+		Critical:   !c.NonCritical,
+		DurationMs: float64(time.Since(start)) / float64(time.Millisecond),
+	}
+	if err != nil {
+		result.Status = ResultFail
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// runCheck turns a panicking check into a failure.
+func runCheck(ctx context.Context, check CheckFunc) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("check panicked: %v", p)
+		}
+	}()
+	return check(ctx)
+}
@@ -0,0 +1,270 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"ping/observability"
+)
+
+func TestEmptyRegistryIsHealthy(t *testing.T) {
+	report := NewRegistry().Run(context.Background())
+	if report.Status != StatusHealthy || !report.Healthy() || report.Checks != nil {
+		t.Errorf("Expected a healthy report without checks, got %+v", report)
+	}
+}
+
+func TestRegistryAggregatesChecks(t *testing.T) {
+	reg := NewRegistry()
+	reg.Register("db", func(ctx context.Context) error { return nil })
+	reg.RegisterCheck(Check{Name: "cache", Check: func(ctx context.Context) error { return errors.New("down") }, NonCritical: true})
+
+	report := reg.Run(context.Background())
+	if report.Status != StatusDegraded || !report.Healthy() {
+		t.Errorf("Expected a failed non-critical check to degrade, got %+v", report)
+	}
+	if got := report.Checks["cache"]; got.Status != ResultFail || got.Error != "down" || got.Critical {
+		t.Errorf("Unexpected cache result %+v", got)
+	}
+	if got := report.Checks["db"]; got.Status != ResultPass || !got.Critical {
+		t.Errorf("Unexpected db result %+v", got)
+	}
+
+	reg.Register("db", func(ctx context.Context) error { return errors.New("refused") })
+	report = reg.Run(context.Background())
+	if report.Status != StatusUnhealthy || report.Healthy() {
+		t.Errorf("Expected a failed critical check to be unhealthy, got %+v", report)
+	}
+	if len(report.Checks) != 2 {
+		t.Errorf("Expected re-registering to replace the check, got %d checks", len(report.Checks))
+	}
+}
+
+func TestRegistryRecoversPanickingCheck(t *testing.T) {
+	reg := NewRegistry()
+	reg.Register("broken", func(ctx context.Context) error { panic("boom") })
+
+	report := reg.Run(context.Background())
+	if report.Healthy() || report.Checks["broken"].Error != "check panicked: boom" {
+		t.Errorf("Expected the panic reported as a failure, got %+v", report)
+	}
+}
+
+func TestProbes(t *testing.T) {
+	reg := NewRegistry()
+	reg.Register("db", func(ctx context.Context) error { return errors.New("down") })
+	reg.RegisterCheck(Check{Name: "worker", Check: func(ctx context.Context) error { return nil }, Liveness: true})
+
+	live := reg.Liveness(context.Background())
+	if !live.Healthy() || len(live.Checks) != 1 || live.Checks["worker"].Status != ResultPass {
+		t.Errorf("Expected liveness to run only the worker check, got %+v", live)
+	}
+	if ready := reg.Readiness(context.Background()); ready.Healthy() || ready.Checks["db"].Status != ResultFail {
+		t.Errorf("Expected readiness to fail on the db check, got %+v", ready)
+	}
+
+	if reg.Startup().Healthy() {
+		t.Error("Expected startup to fail before MarkStarted")
+	}
+	reg.MarkStarted()
+	if !reg.Startup().Healthy() {
+		t.Error("Expected startup to pass after MarkStarted")
+	}
+}
+
+func TestReadinessFailsWhileDraining(t *testing.T) {
+	reg := NewRegistry()
+	if !reg.Readiness(context.Background()).Healthy() {
+		t.Fatal("Expected an empty registry to be ready")
+	}
+
+	reg.MarkDraining()
+	ready := reg.Readiness(context.Background())
+	if ready.Healthy() || ready.Checks[DrainingCheck].Error != "shutting down" {
+		t.Errorf("Expected readiness to fail while draining, got %+v", ready)
+	}
+	if !reg.Liveness(context.Background()).Healthy() || !reg.Run(context.Background()).Healthy() {
+		t.Error("Expected draining to leave liveness and /health alone")
+	}
+}
+
+func TestRunRemembersLastErrorAndSuccess(t *testing.T) {
+	reg := NewRegistry()
+	var fail error
+	reg.Register("db", func(ctx context.Context) error { return fail })
+
+	first := reg.Run(context.Background()).Checks["db"]
+	if first.LastSuccess == nil || first.LastError != "" {
+		t.Fatalf("Expected a success without errors, got %+v", first)
+	}
+
+	fail = errors.New("timeout")
+	second := reg.Run(context.Background()).Checks["db"]
+	if second.LastError != "timeout" || second.LastSuccess == nil || !second.LastSuccess.Equal(*first.LastSuccess) {
+		t.Errorf("Expected the failure recorded and the earlier success kept, got %+v", second)
+	}
+
+	fail = nil
+	third := reg.Run(context.Background()).Checks["db"]
+	if third.Error != "" || third.LastError != "timeout" || !third.LastSuccess.After(*first.LastSuccess) {
+		t.Errorf("Expected the last error kept after recovery, got %+v", third)
+	}
+}
+
+func TestReportBrief(t *testing.T) {
+	reg := NewRegistry()
+	reg.Register("db", func(ctx context.Context) error { return errors.New("down") })
+
+	brief := reg.Run(context.Background()).Brief()
+	if got := brief.Checks["db"]; got.LastError != "" || got.LastSuccess != nil || got.DurationMs != 0 || got.Error != "down" {
+		t.Errorf("Expected only status, error and criticality, got %+v", got)
+	}
+	if empty := (Report{Status: StatusHealthy}).Brief(); empty.Checks != nil {
+		t.Errorf("Expected no checks, got %+v", empty)
+	}
+}
+
+func TestRunTimesOutSlowChecks(t *testing.T) {
+	reg := NewRegistryWithOptions(RegistryOptions{Timeout: 20 * time.Millisecond})
+	release := make(chan struct{})
+	defer close(release)
+	reg.Register("stuck", func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+	reg.RegisterCheck(Check{Name: "slow", Timeout: time.Second, Check: func(ctx context.Context) error {
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	}})
+
+	start := time.Now()
+	report := reg.Run(context.Background())
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected the stuck check abandoned at its timeout, took %s", elapsed)
+	}
+	if got := report.Checks["stuck"]; got.Status != ResultFail || got.Error != "timed out after 20ms" {
+		t.Errorf("Expected the stuck check to time out, got %+v", got)
+	}
+	if got := report.Checks["slow"]; got.Status != ResultPass {
+		t.Errorf("Expected the check's own timeout to apply, got %+v", got)
+	}
+}
+
+func TestRunChecksConcurrently(t *testing.T) {
+	reg := NewRegistry()
+	for _, name := range []string{"a", "b", "c"} {
+		reg.Register(name, func(ctx context.Context) error {
+			time.Sleep(50 * time.Millisecond)
+			return nil
+		})
+	}
+
+	start := time.Now()
+	reg.Run(context.Background())
+	if elapsed := time.Since(start); elapsed > 140*time.Millisecond {
+		t.Errorf("Expected the checks to run in parallel, took %s", elapsed)
+	}
+}
+
+func TestRunCachesResults(t *testing.T) {
+	reg := NewRegistryWithOptions(RegistryOptions{CacheTTL: time.Hour})
+	var runs atomic.Int32
+	reg.Register("db", func(ctx context.Context) error {
+		runs.Add(1)
+		return nil
+	})
+
+	reg.Run(context.Background())
+	reg.Run(context.Background())
+	if got := runs.Load(); got != 1 {
+		t.Errorf("Expected one run within the TTL, got %d", got)
+	}
+}
+
+func TestConcurrentRunsShareAnInFlightCheck(t *testing.T) {
+	reg := NewRegistry()
+	var runs atomic.Int32
+	reg.Register("db", func(ctx context.Context) error {
+		runs.Add(1)
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if report := reg.Run(context.Background()); !report.Healthy() {
+				t.Errorf("Expected a shared pass, got %+v", report)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := runs.Load(); got > 2 {
+		t.Errorf("Expected concurrent reports to share runs, got %d runs", got)
+	}
+}
+
+func TestStatusChangeHooksAndMetrics(t *testing.T) {
+	metrics := observability.NewMetrics(observability.MetricsOptions{})
+	var logs bytes.Buffer
+
+	reg := NewRegistryWithOptions(RegistryOptions{Metrics: metrics, Logger: observability.NewStdLogger(log.New(&logs, "", 0))})
+	var fail error
+	reg.Register("queue", func(ctx context.Context) error { return fail })
+	var changes []StatusChange
+	reg.OnStatusChange(func(c StatusChange) { changes = append(changes, c) })
+
+	reg.Run(context.Background())
+	if len(changes) != 0 {
+		t.Errorf("Expected no change for a first pass, got %+v", changes)
+	}
+	if got := testutil.ToFloat64(metrics.HealthCheckStatus.WithLabelValues("queue")); got != 1 {
+		t.Errorf("Expected status 1 while passing, got %v", got)
+	}
+
+	fail = errors.New("backlog")
+	reg.Run(context.Background())
+	reg.Run(context.Background())
+	fail = nil
+	reg.Run(context.Background())
+
+	want := []StatusChange{
+		{Check: "queue", From: ResultPass, To: ResultFail, Error: "backlog", Critical: true},
+		{Check: "queue", From: ResultFail, To: ResultPass, Critical: true},
+	}
+	if len(changes) != len(want) || changes[0] != want[0] || changes[1] != want[1] {
+		t.Errorf("Expected %+v, got %+v", want, changes)
+	}
+	if got := testutil.ToFloat64(metrics.HealthCheckTransitions.WithLabelValues("queue", ResultFail)); got != 1 {
+		t.Errorf("Expected one transition to fail, got %v", got)
+	}
+	if !strings.Contains(logs.String(), "health check queue failing: backlog") || !strings.Contains(logs.String(), "health check queue recovered") {
+		t.Errorf("Expected both transitions logged, got %q", logs.String())
+	}
+	if got := testutil.CollectAndCount(metrics.HealthCheckDuration); got != 1 {
+		t.Errorf("Expected a duration series for the check, got %d", got)
+	}
+}
+
+func TestFirstFailureIsAChange(t *testing.T) {
+	reg := NewRegistry()
+	reg.Register("db", func(ctx context.Context) error { return errors.New("refused") })
+	var changes []StatusChange
+	reg.OnStatusChange(func(c StatusChange) { changes = append(changes, c) })
+
+	reg.Run(context.Background())
+	if len(changes) != 1 || changes[0].From != "" || changes[0].To != ResultFail {
+		t.Errorf("Expected a change for a first failure, got %+v", changes)
+	}
+}
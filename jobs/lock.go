@@ -0,0 +1,102 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"ping/redis"
+)
+
+// ErrLockLost is returned when renewing a lease that expired and may have
+// been taken by another holder.
+var ErrLockLost = errors.New("jobs: lock lost")
+
+// Locker grants leases on named locks shared by every replica, so a job
+// added with AddExclusive runs on one instance only.
+type Locker interface {
+	// Acquire takes the lock on key for ttl. It returns a nil Lease, and
+	// no error, while another holder has it.
+	Acquire(ctx context.Context, key string, ttl time.Duration) (Lease, error)
+}
+
+// Lease is a held lock. It expires on its own unless extended.
+type Lease interface {
+	// Extend resets the lease to expire ttl from now, or fails with
+	// ErrLockLost.
+	Extend(ctx context.Context, ttl time.Duration) error
+	// Release gives the lock up before it expires.
+	Release(ctx context.Context) error
+}
+
+// Compare-and-set scripts, so a holder whose lease expired never touches
+// the lock of the next one. KEYS[1] = lock key; ARGV[1] = holder token.
+const (
+	extendScript = `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`
+	releaseScript = `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  return redis.call('DEL', KEYS[1])
+end
+return 0
+`
+)
+
+// RedisLocker implements Locker with SET NX PX leases, each holder
+// identified by a random token.
+type RedisLocker struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisLocker returns a locker keeping its locks under keyPrefix.
+func NewRedisLocker(client *redis.Client, keyPrefix string) *RedisLocker {
+	return &RedisLocker{client: client, prefix: keyPrefix}
+}
+
+// Acquire implements Locker.
+func (l *RedisLocker) Acquire(ctx context.Context, key string, ttl time.Duration) (Lease, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	lease := &redisLease{client: l.client, key: l.prefix + key, token: hex.EncodeToString(b)}
+	_, err := l.client.Do(ctx, "SET", lease.key, lease.token, "NX", "PX", ttl.Milliseconds())
+	if errors.Is(err, redis.ErrNil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return lease, nil
+}
+
+// redisLease is a lock held through RedisLocker.
+type redisLease struct {
+	client *redis.Client
+	key    string
+	token  string
+}
+
+func (l *redisLease) Extend(ctx context.Context, ttl time.Duration) error {
+	reply, err := l.client.Do(ctx, "EVAL", extendScript, 1, l.key, l.token, ttl.Milliseconds())
+	if err != nil {
+		return err
+	}
+	if n, ok := reply.(int64); !ok || n != 1 {
+		return fmt.Errorf("%w: %s", ErrLockLost, l.key)
+	}
+	return nil
+}
+
+func (l *redisLease) Release(ctx context.Context) error {
+	_, err := l.client.Do(ctx, "EVAL", releaseScript, 1, l.key, l.token)
+	return err
+}
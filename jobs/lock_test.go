@@ -0,0 +1,166 @@
+package jobs
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ping/redis"
+)
+
+// fakeRedis serves the SET NX PX and EVAL commands RedisLocker sends,
+// keeping keys in memory.
+type fakeRedis struct {
+	mu   sync.Mutex
+	keys map[string]string
+}
+
+func startFakeRedis(t *testing.T) (*fakeRedis, *redis.Client) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	f := &fakeRedis{keys: make(map[string]string)}
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(nc)
+		}
+	}()
+	client := redis.NewClient(redis.Options{Addr: ln.Addr().String()})
+	t.Cleanup(func() { client.Close() })
+	return f, client
+}
+
+func (f *fakeRedis) serve(nc net.Conn) {
+	defer nc.Close()
+	rd := bufio.NewReader(nc)
+	for {
+		header, err := rd.ReadString('\n')
+		if err != nil {
+			return
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(header[1:]))
+		args := make([]string, n)
+		for i := range args {
+			lenLine, err := rd.ReadString('\n')
+			if err != nil {
+				return
+			}
+			size, _ := strconv.Atoi(strings.TrimSpace(lenLine[1:]))
+			buf := make([]byte, size+2)
+			if _, err := io.ReadFull(rd, buf); err != nil {
+				return
+			}
+			args[i] = string(buf[:size])
+		}
+		nc.Write([]byte(f.reply(args)))
+	}
+}
+
+func (f *fakeRedis) reply(args []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case args[0] == "SET":
+		if _, taken := f.keys[args[1]]; taken {
+			return "$-1\r\n"
+		}
+		f.keys[args[1]] = args[2]
+		return "+OK\r\n"
+	case args[0] == "EVAL" && f.keys[args[3]] != args[4]:
+		return ":0\r\n"
+	case args[0] == "EVAL" && args[1] == releaseScript:
+		delete(f.keys, args[3])
+	}
+	return ":1\r\n"
+}
+
+// expire drops key as if its lease ran out.
+func (f *fakeRedis) expire(key string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.keys, key)
+}
+
+func TestRedisLocker(t *testing.T) {
+	fake, client := startFakeRedis(t)
+	locker := NewRedisLocker(client, "test:")
+	ctx := context.Background()
+
+	lease, err := locker.Acquire(ctx, "report", time.Minute)
+	if err != nil || lease == nil {
+		t.Fatalf("Expected the lock, got %v, %v", lease, err)
+	}
+	if other, err := locker.Acquire(ctx, "report", time.Minute); other != nil || err != nil {
+		t.Fatalf("Expected the lock to be held, got %v, %v", other, err)
+	}
+	if err := lease.Extend(ctx, time.Minute); err != nil {
+		t.Errorf("Expected the holder to extend, got %v", err)
+	}
+
+	fake.expire("test:report")
+	next, err := locker.Acquire(ctx, "report", time.Minute)
+	if err != nil || next == nil {
+		t.Fatalf("Expected the expired lock to be free, got %v, %v", next, err)
+	}
+	if err := lease.Extend(ctx, time.Minute); !errors.Is(err, ErrLockLost) {
+		t.Errorf("Expected ErrLockLost for the old holder, got %v", err)
+	}
+	// The old holder must not release the new holder's lock
+	lease.Release(ctx)
+	if other, _ := locker.Acquire(ctx, "report", time.Minute); other != nil {
+		t.Error("Expected a stale release to leave the lock held")
+	}
+	if err := next.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := locker.Acquire(ctx, "report", time.Minute); again == nil {
+		t.Error("Expected the released lock to be free")
+	}
+}
+
+func TestRedisLockerReportsErrors(t *testing.T) {
+	client := redis.NewClient(redis.Options{Addr: "127.0.0.1:1", Timeout: 50 * time.Millisecond})
+	defer client.Close()
+	if _, err := NewRedisLocker(client, "test:").Acquire(context.Background(), "report", time.Minute); err == nil {
+		t.Error("Expected an error while Redis is unreachable")
+	}
+}
+
+// memoryLocker grants each key once, so only the first replica runs.
+type memoryLocker struct {
+	mu   sync.Mutex
+	held map[string]bool
+	err  error
+}
+
+func (l *memoryLocker) Acquire(ctx context.Context, key string, ttl time.Duration) (Lease, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return nil, l.err
+	}
+	if l.held[key] {
+		return nil, nil
+	}
+	l.held[key] = true
+	return memoryLease{}, nil
+}
+
+type memoryLease struct{}
+
+func (memoryLease) Extend(context.Context, time.Duration) error { return nil }
+func (memoryLease) Release(context.Context) error               { return nil }
@@ -0,0 +1,140 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"ping/observability"
+)
+
+var (
+	// ErrQueueFull is returned by Submit when every queue slot is taken.
+	ErrQueueFull = errors.New("jobs: queue full")
+	// ErrPoolClosed is returned by Submit after Shutdown.
+	ErrPoolClosed = errors.New("jobs: pool closed")
+)
+
+// PoolConfig configures a Pool.
+type PoolConfig struct {
+	// Workers is how many jobs run at once. Defaults to 4.
+	Workers int
+	// QueueSize is how many submitted jobs may wait for a worker.
+	// Defaults to 100.
+	QueueSize int
+	// Logger receives job failures. Nil uses observability.DefaultLogger.
+	Logger observability.Logger
+	// IDGenerator creates the correlation ID of each job. Nil uses
+	// observability.DefaultIDGenerator.
+	IDGenerator observability.IDGenerator
+	// Metrics records the runs, queue depth and busy workers. Nil uses
+	// observability.GetMetrics().
+	Metrics observability.MetricsRecorder
+}
+
+// queuedJob is a submitted job waiting for a worker.
+type queuedJob struct {
+	id       string
+	name     string
+	fn       Func
+	enqueued time.Time
+}
+
+// Pool runs submitted jobs on a fixed number of workers, queueing the
+// rest up to a bound. Queue depth, queue wait and busy workers are
+// exported as background_job_* metrics.
+type Pool struct {
+	cfg    PoolConfig
+	queue  chan queuedJob
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewPool starts cfg.Workers workers.
+func NewPool(cfg PoolConfig) *Pool {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 4
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 100
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = observability.DefaultLogger
+	}
+	if cfg.IDGenerator == nil {
+		cfg.IDGenerator = observability.DefaultIDGenerator
+	}
+	cfg.Metrics = observability.RecorderOrDefault(cfg.Metrics)
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Pool{cfg: cfg, queue: make(chan queuedJob, cfg.QueueSize), ctx: ctx, cancel: cancel}
+	for i := 0; i < cfg.Workers; i++ {
+		p.wg.Add(1)
+		go p.work()
+	}
+	return p
+}
+
+// Submit queues fn to run under name. It never blocks: a full queue
+// returns ErrQueueFull so callers can shed or retry.
+func (p *Pool) Submit(name string, fn Func) error {
+	return p.submit(p.cfg.IDGenerator.NewID(), name, fn)
+}
+
+// submit queues fn to run under name with correlation ID id.
+func (p *Pool) submit(id, name string, fn Func) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrPoolClosed
+	}
+	select {
+	case p.queue <- queuedJob{id: id, name: name, fn: fn, enqueued: time.Now()}:
+		p.cfg.Metrics.AddQueuedJobs(1)
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+func (p *Pool) work() {
+	defer p.wg.Done()
+	for job := range p.queue {
+		metrics := p.cfg.Metrics
+		metrics.AddQueuedJobs(-1)
+		metrics.ObserveJobQueueWait(time.Since(job.enqueued).Seconds())
+		metrics.AddBusyWorkers(1)
+		execute(p.ctx, p.cfg.Logger, metrics, job.id, job.name, job.fn)
+		metrics.AddBusyWorkers(-1)
+	}
+}
+
+// Shutdown stops accepting jobs and lets the workers finish the queued
+// ones. Once ctx is done, running jobs are canceled and ctx's error is
+// returned.
+func (p *Pool) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		p.cancel()
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		return ctx.Err()
+	}
+}
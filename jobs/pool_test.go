@@ -0,0 +1,131 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"ping/observability"
+)
+
+func TestPoolBoundsParallelism(t *testing.T) {
+	metrics := observability.NewMetrics(observability.MetricsOptions{})
+
+	p := NewPool(PoolConfig{Workers: 2, QueueSize: 10, Metrics: metrics})
+	var running, peak, done atomic.Int32
+	for i := 0; i < 6; i++ {
+		err := p.Submit("work", func(ctx context.Context) error {
+			n := running.Add(1)
+			for {
+				old := peak.Load()
+				if n <= old || peak.CompareAndSwap(old, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			running.Add(-1)
+			done.Add(1)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := done.Load(); got != 6 {
+		t.Errorf("Expected shutdown to finish all 6 queued jobs, got %d", got)
+	}
+	if got := peak.Load(); got != 2 {
+		t.Errorf("Expected at most 2 jobs at once, got %d", got)
+	}
+	if got := testutil.ToFloat64(metrics.BackgroundJobCounter.WithLabelValues("work", observability.JobOutcomeSuccess)); got != 6 {
+		t.Errorf("Expected 6 runs counted, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.JobQueueDepth); got != 0 {
+		t.Errorf("Expected an empty queue, got depth %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.JobWorkersBusy); got != 0 {
+		t.Errorf("Expected no busy workers, got %v", got)
+	}
+}
+
+func TestPoolRecordsIntoInjectedRecorder(t *testing.T) {
+	metrics := observability.NewMemoryRecorder()
+	p := NewPool(PoolConfig{Workers: 1, QueueSize: 2, Metrics: metrics})
+	p.Submit("ok", func(ctx context.Context) error { return nil })
+	p.Submit("fail", func(ctx context.Context) error { return errors.New("boom") })
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if metrics.Value("background_jobs_total", "ok", observability.JobOutcomeSuccess) != 1 || metrics.Value("background_jobs_total", "fail", observability.JobOutcomeError) != 1 {
+		t.Error("Expected both runs recorded by outcome")
+	}
+	if metrics.Value("background_job_queue_depth") != 0 || metrics.Value("background_job_workers_busy") != 0 {
+		t.Error("Expected the queue and workers back to idle")
+	}
+	if got := len(metrics.Observations("background_job_queue_wait_seconds")); got != 2 {
+		t.Errorf("Expected 2 queue waits observed, got %d", got)
+	}
+}
+
+func TestPoolRejectsWhenFullOrClosed(t *testing.T) {
+	p := NewPool(PoolConfig{Workers: 1, QueueSize: 1})
+	release := make(chan struct{})
+	started := make(chan struct{})
+	block := func(ctx context.Context) error {
+		close(started)
+		<-release
+		return nil
+	}
+	if err := p.Submit("block", block); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	if err := p.Submit("queued", func(ctx context.Context) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Submit("overflow", func(ctx context.Context) error { return nil }); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Expected ErrQueueFull, got %v", err)
+	}
+	close(release)
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Submit("late", func(ctx context.Context) error { return nil }); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("Expected ErrPoolClosed, got %v", err)
+	}
+}
+
+func TestPoolSurvivesPanicsAndCancelsOnShutdownTimeout(t *testing.T) {
+	p := NewPool(PoolConfig{Workers: 1})
+	if err := p.Submit("panic", func(ctx context.Context) error { panic("boom") }); err != nil {
+		t.Fatal(err)
+	}
+	canceled := make(chan struct{})
+	if err := p.Submit("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		close(canceled)
+		return ctx.Err()
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := p.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the shutdown deadline, got %v", err)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the worker to survive the panic and the slow job to be canceled")
+	}
+}
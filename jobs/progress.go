@@ -0,0 +1,91 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"ping/observability"
+)
+
+// progressSaveInterval throttles how often reported progress is written
+// to the store, so chatty jobs do not turn into a write load.
+const progressSaveInterval = time.Second
+
+// Progress is what a running job last reported about itself.
+type Progress struct {
+	// Percent is how much of the work is done, from 0 to 100.
+	Percent float64 `json:"percent"`
+	Message string  `json:"message,omitempty"`
+}
+
+type trackerKey struct{}
+
+// tracker records the progress and heartbeats of one run of a queued job.
+type tracker struct {
+	store Store
+
+	mu     sync.Mutex
+	job    Job
+	saved  time.Time
+	closed bool
+}
+
+func withTracker(ctx context.Context, t *tracker) context.Context {
+	return context.WithValue(ctx, trackerKey{}, t)
+}
+
+// update applies fn to the job and saves it unless it was saved within
+// progressSaveInterval; the end of the run saves the latest state anyway.
+func (t *tracker) update(ctx context.Context, fn func(job *Job, now time.Time)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return
+	}
+	now := time.Now()
+	fn(&t.job, now)
+	if now.Sub(t.saved) < progressSaveInterval {
+		return
+	}
+	t.saved = now
+	if err := t.store.Save(t.job); err != nil {
+		observability.LoggerFromContext(ctx).Errorf(ctx, "saving progress of job %s: %v", t.job.ID, err)
+	}
+}
+
+// finish stops recording and returns the job as last updated.
+func (t *tracker) finish() Job {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	return t.job
+}
+
+// ReportProgress records that the queued job running under ctx is percent
+// done, with an optional message, and counts as a heartbeat. It does
+// nothing outside a queued job, e.g. in a scheduled one.
+func ReportProgress(ctx context.Context, percent float64, message string) {
+	t, _ := ctx.Value(trackerKey{}).(*tracker)
+	if t == nil {
+		return
+	}
+	percent = min(max(percent, 0), 100)
+	t.update(ctx, func(job *Job, now time.Time) {
+		job.Progress = &Progress{Percent: percent, Message: message}
+		job.HeartbeatAt = &now
+	})
+}
+
+// Heartbeat records that the queued job running under ctx is still making
+// progress, so it is not reported as stuck. It does nothing outside a
+// queued job.
+func Heartbeat(ctx context.Context) {
+	t, _ := ctx.Value(trackerKey{}).(*tracker)
+	if t == nil {
+		return
+	}
+	t.update(ctx, func(job *Job, now time.Time) {
+		job.HeartbeatAt = &now
+	})
+}
@@ -0,0 +1,85 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"ping/observability"
+)
+
+func TestReportProgress(t *testing.T) {
+	store := NewMemoryStore()
+	pool := NewPool(PoolConfig{Workers: 1})
+	defer pool.Shutdown(context.Background())
+	q := NewQueue(QueueConfig{Store: store, Pool: pool})
+
+	reported := make(chan struct{})
+	release := make(chan struct{})
+	q.Handle("export", func(ctx context.Context, payload json.RawMessage) error {
+		ReportProgress(ctx, 150, "almost")
+		close(reported)
+		<-release
+		ReportProgress(ctx, 100, "done")
+		return nil
+	})
+	job, err := q.Enqueue(context.Background(), "export", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	<-reported
+	running, err := q.Get(job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first report within a second of the start is not saved yet
+	if running.State != StateRunning || running.Progress != nil {
+		t.Errorf("Expected throttled progress while running, got %+v", running)
+	}
+	close(release)
+
+	done := waitForState(t, store, job.ID, StateSucceeded)
+	if done.Progress == nil || done.Progress.Percent != 100 || done.Progress.Message != "done" || done.HeartbeatAt == nil {
+		t.Errorf("Expected the latest progress saved with the outcome, got %+v", done)
+	}
+}
+
+func TestProgressOutsideQueuedJobs(t *testing.T) {
+	// Must not panic without a tracker, e.g. in scheduled jobs
+	ReportProgress(context.Background(), 50, "half")
+	Heartbeat(context.Background())
+}
+
+func TestQueueFlagsStuckJobs(t *testing.T) {
+	metrics := observability.NewMetrics(observability.MetricsOptions{})
+
+	store := NewMemoryStore()
+	old := time.Now().Add(-time.Hour)
+	recent := time.Now()
+	store.Save(Job{ID: "silent", Type: "export", State: StateRunning, StartedAt: &old})
+	store.Save(Job{ID: "beating", Type: "export", State: StateRunning, StartedAt: &old, HeartbeatAt: &recent})
+	store.Save(Job{ID: "pending", Type: "export", State: StatePending})
+	q := NewQueue(QueueConfig{Store: store, Pool: NewPool(PoolConfig{Metrics: metrics}), StuckAfter: time.Minute, Metrics: metrics})
+
+	jobs, err := q.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, job := range jobs {
+		if job.Stuck != (job.ID == "silent") {
+			t.Errorf("Job %s: expected stuck=%v", job.ID, job.ID == "silent")
+		}
+	}
+	err = q.CheckStuck(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "silent (export)") {
+		t.Errorf("Expected the stuck job named, got %v", err)
+	}
+	if got := testutil.ToFloat64(metrics.JobsStuck); got != 1 {
+		t.Errorf("Expected one stuck job in the gauge, got %v", got)
+	}
+}
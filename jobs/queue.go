@@ -0,0 +1,500 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"ping/observability"
+)
+
+var (
+	// ErrUnknownJobType is returned by Enqueue for a type without a
+	// handler.
+	ErrUnknownJobType = errors.New("jobs: unknown job type")
+	// ErrJobFinished is returned by Cancel for a job that already ended.
+	ErrJobFinished = errors.New("jobs: job already finished")
+	// ErrNotDeadLettered is returned by Retry for a job that is not dead.
+	ErrNotDeadLettered = errors.New("jobs: job is not dead-lettered")
+)
+
+// Job states.
+const (
+	StatePending   = "pending"
+	StateRunning   = "running"
+	StateSucceeded = "succeeded"
+	// StateDead jobs failed their last attempt and form the dead-letter
+	// queue, until Retry or Prune.
+	StateDead     = "dead"
+	StateCanceled = "canceled"
+)
+
+// Job is a unit of queued work as persisted in a Store.
+type Job struct {
+	ID string `json:"id"`
+	// CorrelationID is that of the request that enqueued the job, and
+	// carried by the logs of its runs. Defaults to ID.
+	CorrelationID string          `json:"correlation_id"`
+	Type          string          `json:"type"`
+	Payload       json.RawMessage `json:"payload,omitempty"`
+	State         string          `json:"state"`
+	// Attempts counts the runs started, including ones interrupted by a
+	// restart.
+	Attempts int `json:"attempts"`
+	// Error is that of the latest failed attempt.
+	Error      string     `json:"error,omitempty"`
+	EnqueuedAt time.Time  `json:"enqueued_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	// NextRunAt is when a pending job that failed is retried.
+	NextRunAt *time.Time `json:"next_run_at,omitempty"`
+	// Progress and HeartbeatAt are what the running job last reported
+	// through ReportProgress and Heartbeat.
+	Progress    *Progress  `json:"progress,omitempty"`
+	HeartbeatAt *time.Time `json:"heartbeat_at,omitempty"`
+	// Stuck is set by the queue on running jobs without a heartbeat for
+	// longer than QueueConfig.StuckAfter.
+	Stuck bool `json:"stuck,omitempty"`
+}
+
+// Finished reports whether the job succeeded, was dead-lettered or was
+// canceled.
+func (j Job) Finished() bool {
+	return j.State == StateSucceeded || j.State == StateDead || j.State == StateCanceled
+}
+
+// lastActivity is when the job last showed signs of life.
+func (j Job) lastActivity() time.Time {
+	var t time.Time
+	if j.StartedAt != nil {
+		t = *j.StartedAt
+	}
+	if j.HeartbeatAt != nil && j.HeartbeatAt.After(t) {
+		t = *j.HeartbeatAt
+	}
+	return t
+}
+
+// Handler runs a job of one type with its payload. Long-running handlers
+// should call ReportProgress or Heartbeat with ctx now and then.
+type Handler func(ctx context.Context, payload json.RawMessage) error
+
+// QueueConfig configures a Queue.
+type QueueConfig struct {
+	// Store persists the jobs. Nil uses a MemoryStore.
+	Store Store
+	// Pool runs the jobs. Required.
+	Pool *Pool
+	// IDGenerator creates job IDs. Nil uses
+	// observability.DefaultIDGenerator.
+	IDGenerator observability.IDGenerator
+	// Retry applies to job types registered without their own policy.
+	// The zero value uses DefaultRetryPolicy.
+	Retry RetryPolicy
+	// StuckAfter flags running jobs without a heartbeat for this long,
+	// counting from their start. Zero never flags them.
+	StuckAfter time.Duration
+	// Metrics records retries, dead letters and stuck jobs. Nil uses
+	// observability.GetMetrics().
+	Metrics observability.MetricsRecorder
+}
+
+// registeredHandler is a job type's handler and retry policy.
+type registeredHandler struct {
+	fn    Handler
+	retry RetryPolicy
+}
+
+// Queue persists jobs before running them on a Pool, so a job once
+// enqueued runs at least once: a job interrupted by a crash or shutdown
+// is still pending or running in the store, and Recover runs it again.
+// Handlers should therefore be idempotent. Failed jobs are retried with
+// exponential backoff and dead-lettered once their attempts run out.
+type Queue struct {
+	cfg QueueConfig
+
+	mu       sync.Mutex
+	handlers map[string]registeredHandler
+	// inflight holds the IDs submitted to the pool, or waiting to be
+	// retried, and not yet finished, with the cancel function of their
+	// run once it started
+	inflight map[string]context.CancelFunc
+	// canceled holds the inflight IDs Cancel was called for
+	canceled map[string]bool
+}
+
+// NewQueue returns a queue without handlers. Register handlers, then call
+// Recover before enqueueing.
+func NewQueue(cfg QueueConfig) *Queue {
+	if cfg.Store == nil {
+		cfg.Store = NewMemoryStore()
+	}
+	if cfg.IDGenerator == nil {
+		cfg.IDGenerator = observability.DefaultIDGenerator
+	}
+	if cfg.Retry.MaxAttempts <= 0 {
+		cfg.Retry = DefaultRetryPolicy
+	}
+	cfg.Metrics = observability.RecorderOrDefault(cfg.Metrics)
+	return &Queue{
+		cfg:      cfg,
+		handlers: make(map[string]registeredHandler),
+		inflight: make(map[string]context.CancelFunc),
+		canceled: make(map[string]bool),
+	}
+}
+
+// Handle registers h for jobs of jobType, retried per the queue's
+// policy.
+func (q *Queue) Handle(jobType string, h Handler) {
+	q.HandleWithPolicy(jobType, h, q.cfg.Retry)
+}
+
+// HandleWithPolicy registers h for jobs of jobType, retried per retry.
+func (q *Queue) HandleWithPolicy(jobType string, h Handler, retry RetryPolicy) {
+	if retry.MaxAttempts <= 0 {
+		retry.MaxAttempts = 1
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[jobType] = registeredHandler{fn: h, retry: retry}
+}
+
+// Enqueue persists a pending job of jobType and submits it to the pool.
+// The job inherits the correlation ID of ctx, if any. A job the pool
+// rejects, e.g. with ErrQueueFull, is not kept.
+func (q *Queue) Enqueue(ctx context.Context, jobType string, payload json.RawMessage) (Job, error) {
+	q.mu.Lock()
+	h, ok := q.handlers[jobType]
+	q.mu.Unlock()
+	if !ok {
+		return Job{}, fmt.Errorf("%w %q", ErrUnknownJobType, jobType)
+	}
+
+	job := Job{
+		ID:         q.cfg.IDGenerator.NewID(),
+		Type:       jobType,
+		Payload:    payload,
+		State:      StatePending,
+		EnqueuedAt: time.Now(),
+	}
+	job.CorrelationID = observability.GetCorrelationID(ctx)
+	if job.CorrelationID == "" {
+		job.CorrelationID = job.ID
+	}
+	if err := q.cfg.Store.Save(job); err != nil {
+		return Job{}, fmt.Errorf("saving job: %w", err)
+	}
+	if err := q.submit(job, h); err != nil {
+		q.cfg.Store.Delete(job.ID)
+		return Job{}, err
+	}
+	return job, nil
+}
+
+// Get returns the job with id, or ErrJobNotFound.
+func (q *Queue) Get(id string) (Job, error) {
+	job, err := q.cfg.Store.Load(id)
+	job.Stuck = q.stuck(job, time.Now())
+	return job, err
+}
+
+// List returns every stored job, oldest first.
+func (q *Queue) List() ([]Job, error) {
+	jobs, err := q.cfg.Store.List()
+	now := time.Now()
+	for i := range jobs {
+		jobs[i].Stuck = q.stuck(jobs[i], now)
+	}
+	return jobs, err
+}
+
+// stuck reports whether job is running without signs of life for longer
+// than StuckAfter.
+func (q *Queue) stuck(job Job, now time.Time) bool {
+	return q.cfg.StuckAfter > 0 && job.State == StateRunning && now.Sub(job.lastActivity()) > q.cfg.StuckAfter
+}
+
+// CheckStuck sets the background_jobs_stuck gauge and fails naming the
+// stuck jobs, if any. It suits both a health check and a scheduled job.
+func (q *Queue) CheckStuck(ctx context.Context) error {
+	jobs, err := q.List()
+	if err != nil {
+		return err
+	}
+	var stuck []string
+	for _, job := range jobs {
+		if job.Stuck {
+			stuck = append(stuck, job.ID+" ("+job.Type+")")
+		}
+	}
+	q.cfg.Metrics.SetStuckJobs(len(stuck))
+	if len(stuck) > 0 {
+		return fmt.Errorf("%d jobs without heartbeat for over %s: %s", len(stuck), q.cfg.StuckAfter, strings.Join(stuck, ", "))
+	}
+	return nil
+}
+
+// DeadLetters returns the dead-lettered jobs, oldest first.
+func (q *Queue) DeadLetters() ([]Job, error) {
+	jobs, err := q.cfg.Store.List()
+	if err != nil {
+		return nil, err
+	}
+	dead := jobs[:0]
+	for _, job := range jobs {
+		if job.State == StateDead {
+			dead = append(dead, job)
+		}
+	}
+	return dead, nil
+}
+
+// Retry moves the dead-lettered job with id back to the queue with a
+// fresh set of attempts.
+func (q *Queue) Retry(id string) (Job, error) {
+	job, err := q.cfg.Store.Load(id)
+	if err != nil {
+		return Job{}, err
+	}
+	if job.State != StateDead {
+		return job, ErrNotDeadLettered
+	}
+	q.mu.Lock()
+	h, ok := q.handlers[job.Type]
+	q.mu.Unlock()
+	if !ok {
+		return job, fmt.Errorf("%w %q", ErrUnknownJobType, job.Type)
+	}
+	job.State, job.Attempts, job.Error = StatePending, 0, ""
+	job.StartedAt, job.FinishedAt, job.NextRunAt = nil, nil, nil
+	if err := q.cfg.Store.Save(job); err != nil {
+		return Job{}, fmt.Errorf("saving job: %w", err)
+	}
+	if err := q.submit(job, h); err != nil {
+		return job, err
+	}
+	return job, nil
+}
+
+// Cancel stops the job with id: a running job has its context canceled
+// and is recorded as canceled once its handler returns, a pending one
+// never starts. It returns the job as it was, or ErrJobFinished if it
+// already ended.
+func (q *Queue) Cancel(id string) (Job, error) {
+	job, err := q.cfg.Store.Load(id)
+	if err != nil {
+		return Job{}, err
+	}
+	if job.Finished() {
+		return job, ErrJobFinished
+	}
+
+	q.mu.Lock()
+	cancel, inflight := q.inflight[id]
+	if inflight {
+		q.canceled[id] = true
+	}
+	q.mu.Unlock()
+	if cancel != nil {
+		cancel()
+		return job, nil
+	}
+
+	// Not started: record it now, run skips it if the pool gets to it
+	now := time.Now()
+	canceled := job
+	canceled.State, canceled.FinishedAt = StateCanceled, &now
+	if err := q.cfg.Store.Save(canceled); err != nil {
+		return Job{}, fmt.Errorf("saving job: %w", err)
+	}
+	return job, nil
+}
+
+// Recover submits the stored jobs that are pending or were running when
+// the process stopped, and returns how many it submitted. Jobs waiting
+// for a retry are submitted once their delay passes. Jobs whose type has
+// no handler are dead-lettered. Jobs the pool has no room for stay
+// pending for the next call, which is reported as ErrQueueFull.
+func (q *Queue) Recover() (int, error) {
+	jobs, err := q.cfg.Store.List()
+	if err != nil {
+		return 0, err
+	}
+	submitted, full := 0, 0
+	for _, job := range jobs {
+		if job.Finished() {
+			continue
+		}
+		q.mu.Lock()
+		h, ok := q.handlers[job.Type]
+		_, inflight := q.inflight[job.ID]
+		q.mu.Unlock()
+		if inflight {
+			continue
+		}
+		if !ok {
+			now := time.Now()
+			job.State, job.Error, job.FinishedAt = StateDead, "no handler for job type "+job.Type, &now
+			if err := q.cfg.Store.Save(job); err != nil {
+				return submitted, fmt.Errorf("saving job: %w", err)
+			}
+			continue
+		}
+		if job.State == StateRunning {
+			job.State = StatePending
+			if err := q.cfg.Store.Save(job); err != nil {
+				return submitted, fmt.Errorf("saving job: %w", err)
+			}
+		}
+		if job.NextRunAt != nil && time.Until(*job.NextRunAt) > 0 {
+			q.mu.Lock()
+			q.inflight[job.ID] = nil
+			q.mu.Unlock()
+			q.retryLater(job, h, time.Until(*job.NextRunAt))
+			submitted++
+			continue
+		}
+		switch err := q.submit(job, h); {
+		case errors.Is(err, ErrQueueFull):
+			full++
+		case err != nil:
+			return submitted, err
+		default:
+			submitted++
+		}
+	}
+	if full > 0 {
+		return submitted, fmt.Errorf("%d jobs left pending: %w", full, ErrQueueFull)
+	}
+	return submitted, nil
+}
+
+// Prune deletes the jobs that finished before t and returns how many it
+// deleted.
+func (q *Queue) Prune(t time.Time) (int, error) {
+	jobs, err := q.cfg.Store.List()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, job := range jobs {
+		if job.Finished() && job.FinishedAt != nil && job.FinishedAt.Before(t) {
+			if err := q.cfg.Store.Delete(job.ID); err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (q *Queue) submit(job Job, h registeredHandler) error {
+	q.mu.Lock()
+	q.inflight[job.ID] = nil
+	q.mu.Unlock()
+	err := q.dispatch(job, h)
+	if err != nil {
+		q.done(job.ID)
+	}
+	return err
+}
+
+// dispatch hands an inflight job to the pool. A run that failed with
+// attempts left keeps the job inflight and retries it after a delay.
+func (q *Queue) dispatch(job Job, h registeredHandler) error {
+	correlationID := job.CorrelationID
+	if correlationID == "" {
+		correlationID = job.ID
+	}
+	return q.cfg.Pool.submit(correlationID, job.Type, func(ctx context.Context) error {
+		job, retryIn, err := q.run(ctx, job, h)
+		if retryIn > 0 {
+			q.retryLater(job, h, retryIn)
+		} else {
+			q.done(job.ID)
+		}
+		return err
+	})
+}
+
+// retryLater dispatches job after delay. A job the pool rejects then
+// stays pending in the store for Recover.
+func (q *Queue) retryLater(job Job, h registeredHandler, delay time.Duration) {
+	time.AfterFunc(delay, func() {
+		if err := q.dispatch(job, h); err != nil {
+			q.done(job.ID)
+			if !errors.Is(err, ErrPoolClosed) {
+				q.cfg.Pool.cfg.Logger.Warnf(context.Background(), "job %s left pending: %v", job.ID, err)
+			}
+		}
+	})
+}
+
+func (q *Queue) done(id string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.inflight, id)
+	delete(q.canceled, id)
+}
+
+// run records the job as running, runs it and records the outcome, which
+// it returns with the delay before the next attempt if one is due. A run
+// canceled by shutdown leaves the job pending for Recover; one canceled
+// by Cancel is recorded as canceled.
+func (q *Queue) run(ctx context.Context, job Job, h registeredHandler) (Job, time.Duration, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	q.mu.Lock()
+	if q.canceled[job.ID] {
+		q.mu.Unlock()
+		return job, 0, nil
+	}
+	q.inflight[job.ID] = cancel
+	q.mu.Unlock()
+
+	started := time.Now()
+	job.State, job.StartedAt, job.FinishedAt, job.NextRunAt = StateRunning, &started, nil, nil
+	job.Progress, job.HeartbeatAt = nil, nil
+	job.Attempts++
+	if err := q.cfg.Store.Save(job); err != nil {
+		return job, 0, fmt.Errorf("saving job: %w", err)
+	}
+
+	t := &tracker{store: q.cfg.Store, job: job, saved: started}
+	err := runJob(withTracker(ctx, t), func(ctx context.Context) error { return h.fn(ctx, job.Payload) })
+	job = t.finish()
+	finished := time.Now()
+	q.mu.Lock()
+	canceled := q.canceled[job.ID]
+	q.inflight[job.ID] = nil
+	q.mu.Unlock()
+	var retryIn time.Duration
+	metrics := q.cfg.Metrics
+	switch {
+	case canceled:
+		job.State, job.FinishedAt = StateCanceled, &finished
+		err = context.Canceled
+	case err != nil && ctx.Err() != nil:
+		job.State, job.StartedAt = StatePending, nil
+	case err != nil && job.Attempts < h.retry.MaxAttempts && !isPermanent(err):
+		retryIn = h.retry.Delay(job.Attempts)
+		next := finished.Add(retryIn)
+		job.State, job.Error, job.NextRunAt = StatePending, err.Error(), &next
+		metrics.IncJobRetries(job.Type)
+	case err != nil:
+		job.State, job.Error, job.FinishedAt = StateDead, err.Error(), &finished
+		metrics.IncJobsDeadLettered(job.Type)
+		observability.LoggerFromContext(ctx).Warnf(ctx, "job %s (%s) dead-lettered after %d attempts: %v", job.ID, job.Type, job.Attempts, err)
+	default:
+		job.State, job.Error, job.FinishedAt = StateSucceeded, "", &finished
+	}
+	if saveErr := q.cfg.Store.Save(job); saveErr != nil {
+		observability.LoggerFromContext(ctx).Errorf(ctx, "saving job %s: %v", job.ID, saveErr)
+	}
+	return job, retryIn, err
+}
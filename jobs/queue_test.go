@@ -0,0 +1,236 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"ping/observability"
+)
+
+// waitForState polls store until job id reaches state.
+func waitForState(t *testing.T, store Store, id, state string) Job {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		job, err := store.Load(id)
+		if err == nil && job.State == state {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Job %s did not reach %s, last %+v (%v)", id, state, job, err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestQueueRunsAndRecordsJobs(t *testing.T) {
+	store := NewMemoryStore()
+	pool := NewPool(PoolConfig{Workers: 1})
+	defer pool.Shutdown(context.Background())
+	q := NewQueue(QueueConfig{Store: store, Pool: pool, Retry: RetryPolicy{MaxAttempts: 1}})
+
+	payloads := make(chan string, 1)
+	q.Handle("echo", func(ctx context.Context, payload json.RawMessage) error {
+		payloads <- string(payload)
+		return nil
+	})
+	q.Handle("fail", func(ctx context.Context, payload json.RawMessage) error {
+		return errors.New("broken")
+	})
+
+	ok, err := q.Enqueue(context.Background(), "echo", json.RawMessage(`"hi"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	failing, err := q.Enqueue(context.Background(), "fail", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Enqueue(context.Background(), "missing", nil); !errors.Is(err, ErrUnknownJobType) {
+		t.Errorf("Expected ErrUnknownJobType, got %v", err)
+	}
+
+	done := waitForState(t, store, ok.ID, StateSucceeded)
+	if done.Attempts != 1 || done.StartedAt == nil || done.FinishedAt == nil {
+		t.Errorf("Expected one recorded attempt, got %+v", done)
+	}
+	if got := <-payloads; got != `"hi"` {
+		t.Errorf("Expected the payload to reach the handler, got %s", got)
+	}
+	if failed := waitForState(t, store, failing.ID, StateDead); failed.Error != "broken" {
+		t.Errorf("Expected the error to be recorded, got %q", failed.Error)
+	}
+
+	if n, err := q.Prune(time.Now().Add(time.Minute)); err != nil || n != 2 {
+		t.Errorf("Expected both finished jobs pruned, got %d, %v", n, err)
+	}
+}
+
+func TestQueueRecoversUnfinishedJobs(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Now()
+	store.Save(Job{ID: "pending", Type: "work", State: StatePending, EnqueuedAt: now})
+	store.Save(Job{ID: "interrupted", Type: "work", State: StateRunning, Attempts: 1, EnqueuedAt: now})
+	store.Save(Job{ID: "done", Type: "work", State: StateSucceeded, EnqueuedAt: now})
+	store.Save(Job{ID: "orphan", Type: "gone", State: StatePending, EnqueuedAt: now})
+
+	pool := NewPool(PoolConfig{Workers: 2})
+	defer pool.Shutdown(context.Background())
+	q := NewQueue(QueueConfig{Store: store, Pool: pool})
+	q.Handle("work", func(ctx context.Context, payload json.RawMessage) error { return nil })
+
+	n, err := q.Recover()
+	if err != nil || n != 2 {
+		t.Fatalf("Expected 2 jobs recovered, got %d, %v", n, err)
+	}
+	waitForState(t, store, "pending", StateSucceeded)
+	if job := waitForState(t, store, "interrupted", StateSucceeded); job.Attempts != 2 {
+		t.Errorf("Expected the interrupted job to run again, got %d attempts", job.Attempts)
+	}
+	if job, _ := store.Load("orphan"); job.State != StateDead {
+		t.Errorf("Expected a job without handler to be dead-lettered, got %+v", job)
+	}
+}
+
+func TestQueueLeavesCanceledJobsPending(t *testing.T) {
+	store := NewMemoryStore()
+	pool := NewPool(PoolConfig{Workers: 1})
+	q := NewQueue(QueueConfig{Store: store, Pool: pool})
+	started := make(chan struct{})
+	q.Handle("slow", func(ctx context.Context, payload json.RawMessage) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	job, err := q.Enqueue(context.Background(), "slow", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	pool.Shutdown(ctx)
+	waitForState(t, store, job.ID, StatePending)
+}
+
+func TestQueueCancelsJobs(t *testing.T) {
+	store := NewMemoryStore()
+	pool := NewPool(PoolConfig{Workers: 1})
+	defer pool.Shutdown(context.Background())
+	q := NewQueue(QueueConfig{Store: store, Pool: pool})
+	started := make(chan struct{})
+	q.Handle("slow", func(ctx context.Context, payload json.RawMessage) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	var ran bool
+	q.Handle("quick", func(ctx context.Context, payload json.RawMessage) error {
+		ran = true
+		return nil
+	})
+
+	ctx := observability.WithCorrelationID(context.Background(), "req-1")
+	running, err := q.Enqueue(ctx, "slow", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if running.CorrelationID != "req-1" {
+		t.Errorf("Expected the request's correlation ID, got %q", running.CorrelationID)
+	}
+	queued, err := q.Enqueue(context.Background(), "quick", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queued.CorrelationID != queued.ID {
+		t.Errorf("Expected the job ID as correlation ID, got %q", queued.CorrelationID)
+	}
+	<-started
+
+	if _, err := q.Cancel(queued.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Cancel(running.ID); err != nil {
+		t.Fatal(err)
+	}
+	if job := waitForState(t, store, running.ID, StateCanceled); job.FinishedAt == nil {
+		t.Errorf("Expected the canceled job to be finished, got %+v", job)
+	}
+	waitForState(t, store, queued.ID, StateCanceled)
+	if _, err := q.Cancel(running.ID); !errors.Is(err, ErrJobFinished) {
+		t.Errorf("Expected ErrJobFinished, got %v", err)
+	}
+	if _, err := q.Cancel("missing"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Expected ErrJobNotFound, got %v", err)
+	}
+	pool.Shutdown(context.Background())
+	if ran {
+		t.Error("Expected the canceled pending job not to run")
+	}
+}
+
+func TestQueueRetriesAndDeadLetters(t *testing.T) {
+	metrics := observability.NewMetrics(observability.MetricsOptions{})
+
+	store := NewMemoryStore()
+	pool := NewPool(PoolConfig{Workers: 2, Metrics: metrics})
+	defer pool.Shutdown(context.Background())
+	q := NewQueue(QueueConfig{Store: store, Pool: pool, Metrics: metrics})
+	policy := RetryPolicy{MaxAttempts: 3, Backoff: 5 * time.Millisecond}
+
+	var flaky atomic.Int32
+	q.HandleWithPolicy("flaky", func(ctx context.Context, payload json.RawMessage) error {
+		if flaky.Add(1) < 3 {
+			return errors.New("try again")
+		}
+		return nil
+	}, policy)
+	q.HandleWithPolicy("broken", func(ctx context.Context, payload json.RawMessage) error {
+		return errors.New("always")
+	}, policy)
+	q.HandleWithPolicy("malformed", func(ctx context.Context, payload json.RawMessage) error {
+		return Permanent(errors.New("bad payload"))
+	}, policy)
+
+	recovered, _ := q.Enqueue(context.Background(), "flaky", nil)
+	broken, _ := q.Enqueue(context.Background(), "broken", nil)
+	malformed, _ := q.Enqueue(context.Background(), "malformed", nil)
+
+	if job := waitForState(t, store, recovered.ID, StateSucceeded); job.Attempts != 3 || job.Error != "" {
+		t.Errorf("Expected success on the third attempt, got %+v", job)
+	}
+	if job := waitForState(t, store, broken.ID, StateDead); job.Attempts != 3 || job.Error != "always" {
+		t.Errorf("Expected three attempts before dead-lettering, got %+v", job)
+	}
+	if job := waitForState(t, store, malformed.ID, StateDead); job.Attempts != 1 {
+		t.Errorf("Expected a permanent error not to be retried, got %+v", job)
+	}
+
+	dead, err := q.DeadLetters()
+	if err != nil || len(dead) != 2 {
+		t.Fatalf("Expected two dead letters, got %+v, %v", dead, err)
+	}
+	if got := testutil.ToFloat64(metrics.JobRetries.WithLabelValues("flaky")); got != 2 {
+		t.Errorf("Expected 2 retries of flaky, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.JobDeadLettered.WithLabelValues("broken")); got != 1 {
+		t.Errorf("Expected broken dead-lettered once, got %v", got)
+	}
+
+	if _, err := q.Retry(recovered.ID); !errors.Is(err, ErrNotDeadLettered) {
+		t.Errorf("Expected ErrNotDeadLettered, got %v", err)
+	}
+	if _, err := q.Retry(broken.ID); err != nil {
+		t.Fatal(err)
+	}
+	if job := waitForState(t, store, broken.ID, StateDead); job.Attempts != 3 {
+		t.Errorf("Expected a fresh set of attempts, got %+v", job)
+	}
+}
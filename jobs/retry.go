@@ -0,0 +1,68 @@
+package jobs
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy decides how often and when a failed job runs again.
+type RetryPolicy struct {
+	// MaxAttempts is how many runs a job gets before it is dead-lettered.
+	// One disables retries.
+	MaxAttempts int
+	// Backoff is the delay before the second attempt; it doubles after
+	// every further failure.
+	Backoff time.Duration
+	// MaxBackoff caps the delay. Defaults to one hour.
+	MaxBackoff time.Duration
+	// Jitter is the fraction of each delay, from 0 to 1, taken off at
+	// random so jobs that failed together do not retry together.
+	Jitter float64
+}
+
+// DefaultRetryPolicy is used by queues and job types without a policy.
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 3, Backoff: time.Second, MaxBackoff: time.Minute, Jitter: 0.2}
+
+// Delay returns how long to wait before the attempt after the given
+// one, counting attempts from one.
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	maxBackoff := p.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = time.Hour
+	}
+	delay := p.Backoff
+	for i := 1; i < attempt && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	if p.Jitter > 0 {
+		delay -= time.Duration(rand.Float64() * p.Jitter * float64(delay))
+	}
+	return delay
+}
+
+// permanentError marks an error that retrying cannot fix.
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so the job is dead-lettered without further
+// attempts, e.g. for a malformed payload.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err: err}
+}
+
+// isPermanent reports whether err was wrapped by Permanent.
+func isPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
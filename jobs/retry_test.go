@@ -0,0 +1,35 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	for attempt, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 40: 5 * time.Second} {
+		if got := p.Delay(attempt); got != want {
+			t.Errorf("Delay(%d) = %s, want %s", attempt, got, want)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := p.Delay(2); got < time.Second || got > 2*time.Second {
+			t.Fatalf("Expected a jittered delay within 1s-2s, got %s", got)
+		}
+	}
+}
+
+func TestPermanent(t *testing.T) {
+	base := errors.New("bad payload")
+	err := fmt.Errorf("decoding: %w", Permanent(base))
+	if !isPermanent(err) || !errors.Is(err, base) {
+		t.Errorf("Expected a wrapped permanent error to be detected and unwrap, got %v", err)
+	}
+	if isPermanent(base) || Permanent(nil) != nil {
+		t.Error("Expected plain errors not to be permanent")
+	}
+}
@@ -0,0 +1,72 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseScheduleCron(t *testing.T) {
+	from := time.Date(2026, time.March, 10, 14, 7, 30, 0, time.UTC) // a Tuesday
+	for _, tc := range []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2026, 3, 10, 14, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, 3, 10, 14, 15, 0, 0, time.UTC)},
+		{"5/20 * * * *", time.Date(2026, 3, 10, 14, 25, 0, 0, time.UTC)},
+		{"0 9-17 * * mon-fri", time.Date(2026, 3, 10, 15, 0, 0, 0, time.UTC)},
+		{"30 2 * * *", time.Date(2026, 3, 11, 2, 30, 0, 0, time.UTC)},
+		{"0 0 1,15 * *", time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 jan *", time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// Either day field matches when both are restricted
+		{"0 0 13 * fri", time.Date(2026, 3, 13, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2026, 3, 10, 15, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2026, 3, 11, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC)},
+	} {
+		s, err := ParseScheduleIn(tc.spec, time.UTC)
+		if err != nil {
+			t.Errorf("%q: %v", tc.spec, err)
+			continue
+		}
+		if got := s.Next(from); !got.Equal(tc.want) {
+			t.Errorf("%q: expected %s, got %s", tc.spec, tc.want, got)
+		}
+	}
+}
+
+func TestParseScheduleEvery(t *testing.T) {
+	s, err := ParseSchedule("@every 90s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	if got := s.Next(from); !got.Equal(from.Add(90 * time.Second)) {
+		t.Errorf("Expected 90s later, got %s", got)
+	}
+}
+
+func TestParseScheduleRejectsInvalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"30-10 * * * *",
+		"* * * foo *",
+		"0 0 30 2 *",
+		"@every",
+		"@every -1m",
+		"@every soon",
+	} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("Expected %q to be rejected", spec)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+// Package jobs runs background work: recurring jobs on cron or interval
+// schedules, recorded in the background_job_* metrics and logged with a
+// correlation ID per run like a request.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"ping/observability"
+)
+
+// Func is the work of a job. ctx carries a correlation ID and logger for
+// the run and is canceled on shutdown.
+type Func func(ctx context.Context) error
+
+// SchedulerConfig configures a Scheduler.
+type SchedulerConfig struct {
+	// Logger receives run failures. Nil uses observability.DefaultLogger.
+	Logger observability.Logger
+	// IDGenerator creates the correlation ID of each run. Nil uses
+	// observability.DefaultIDGenerator.
+	IDGenerator observability.IDGenerator
+	// Locker makes jobs added with AddExclusive run on one replica only.
+	// Nil runs them everywhere, like other jobs.
+	Locker Locker
+	// LockTTL is how long an exclusive run holds its lock past its last
+	// renewal. It must exceed the clock skew between replicas and stay
+	// below the job's interval. Defaults to 30 seconds.
+	LockTTL time.Duration
+	// Metrics records the runs and lock acquisitions. Nil uses
+	// observability.GetMetrics().
+	Metrics observability.MetricsRecorder
+}
+
+// scheduledJob is a job and the schedule it runs on.
+type scheduledJob struct {
+	name      string
+	schedule  Schedule
+	fn        Func
+	exclusive bool
+}
+
+// Scheduler runs registered jobs on their schedules. A job never overlaps
+// with itself: a run that outlasts its interval delays the next one.
+type Scheduler struct {
+	cfg SchedulerConfig
+
+	mu      sync.Mutex
+	jobs    []scheduledJob
+	started bool
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewScheduler returns a scheduler without jobs. Add jobs, then Start it.
+func NewScheduler(cfg SchedulerConfig) *Scheduler {
+	if cfg.Logger == nil {
+		cfg.Logger = observability.DefaultLogger
+	}
+	if cfg.IDGenerator == nil {
+		cfg.IDGenerator = observability.DefaultIDGenerator
+	}
+	if cfg.LockTTL <= 0 {
+		cfg.LockTTL = 30 * time.Second
+	}
+	cfg.Metrics = observability.RecorderOrDefault(cfg.Metrics)
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{cfg: cfg, ctx: ctx, cancel: cancel}
+}
+
+// Add registers fn under name on spec, as accepted by ParseSchedule.
+func (s *Scheduler) Add(name, spec string, fn Func) error {
+	schedule, err := ParseSchedule(spec)
+	if err != nil {
+		return fmt.Errorf("job %s: %w", name, err)
+	}
+	s.AddSchedule(name, schedule, fn)
+	return nil
+}
+
+// AddExclusive is Add for work shared by every replica, such as a report
+// or a cleanup of shared storage: each run first takes the lock named
+// after the job from the Locker, and replicas that find it taken skip the
+// run.
+func (s *Scheduler) AddExclusive(name, spec string, fn Func) error {
+	schedule, err := ParseSchedule(spec)
+	if err != nil {
+		return fmt.Errorf("job %s: %w", name, err)
+	}
+	s.add(scheduledJob{name: name, schedule: schedule, fn: fn, exclusive: true})
+	return nil
+}
+
+// AddSchedule registers fn under name on schedule. Jobs added after Start
+// begin right away.
+func (s *Scheduler) AddSchedule(name string, schedule Schedule, fn Func) {
+	s.add(scheduledJob{name: name, schedule: schedule, fn: fn})
+}
+
+func (s *Scheduler) add(job scheduledJob) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs = append(s.jobs, job)
+	if s.started {
+		s.launch(job)
+	}
+}
+
+// Start runs every registered job on its schedule until Shutdown.
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return
+	}
+	s.started = true
+	for _, job := range s.jobs {
+		s.launch(job)
+	}
+}
+
+func (s *Scheduler) launch(job scheduledJob) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.loop(job)
+	}()
+}
+
+func (s *Scheduler) loop(job scheduledJob) {
+	for {
+		next := job.schedule.Next(time.Now())
+		if next.IsZero() {
+			return
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+			s.run(job)
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+func (s *Scheduler) run(job scheduledJob) {
+	if job.exclusive && s.cfg.Locker != nil {
+		s.runExclusive(job)
+		return
+	}
+	execute(s.ctx, s.cfg.Logger, s.cfg.Metrics, s.cfg.IDGenerator.NewID(), job.name, job.fn)
+}
+
+// runExclusive runs job if it gets the job's lock, renewing the lease
+// while the job runs. The lease is left to expire rather than released,
+// so a replica whose clock lags does not run the same tick again; a run
+// whose lease is lost is canceled.
+func (s *Scheduler) runExclusive(job scheduledJob) {
+	metrics := s.cfg.Metrics
+	start := time.Now()
+	lease, err := s.cfg.Locker.Acquire(s.ctx, "job:"+job.name, s.cfg.LockTTL)
+	metrics.ObserveJobLockAcquire(time.Since(start).Seconds())
+	switch {
+	case err != nil:
+		metrics.RecordJobLock(job.name, "error")
+		s.cfg.Logger.Warnf(s.ctx, "job %s skipped, lock unavailable: %v", job.name, err)
+		return
+	case lease == nil:
+		metrics.RecordJobLock(job.name, "held")
+		return
+	}
+	metrics.RecordJobLock(job.name, "acquired")
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		ticker := time.NewTicker(s.cfg.LockTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := lease.Extend(ctx, s.cfg.LockTTL); err != nil {
+					if ctx.Err() == nil {
+						metrics.RecordJobLock(job.name, "lost")
+						s.cfg.Logger.Warnf(ctx, "job %s canceled, lock not renewed: %v", job.name, err)
+						cancel()
+					}
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	execute(ctx, s.cfg.Logger, s.cfg.Metrics, s.cfg.IDGenerator.NewID(), job.name, job.fn)
+	cancel()
+	<-renewed
+}
+
+// execute runs fn once under correlation ID id in a context derived from
+// parent, recording it in the background job metrics under name and
+// logging a failure. A panic fails the run instead of the process.
+func execute(parent context.Context, logger observability.Logger, metrics observability.MetricsRecorder, id, name string, fn Func) error {
+	ctx := observability.WithCorrelationID(parent, id)
+	ctx = observability.WithLogger(ctx, logger)
+
+	start := time.Now()
+	err := runJob(ctx, fn)
+	metrics.RecordBackgroundJob(name, time.Since(start).Seconds(), err)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		logger.Warnf(ctx, "job %s failed after %s: %v (id=%s)", name, time.Since(start).Round(time.Millisecond), err, id)
+	}
+	return err
+}
+
+func runJob(ctx context.Context, fn Func) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("job panicked: %v", p)
+		}
+	}()
+	return fn(ctx)
+}
+
+// Shutdown stops scheduling, cancels the context of running jobs and
+// waits for them to return until ctx is done.
+func (s *Scheduler) Shutdown(ctx context.Context) error {
+	s.cancel()
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
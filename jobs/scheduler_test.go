@@ -0,0 +1,174 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"ping/observability"
+)
+
+func TestSchedulerRunsJobsAndRecordsMetrics(t *testing.T) {
+	metrics := observability.NewMetrics(observability.MetricsOptions{})
+
+	s := NewScheduler(SchedulerConfig{Metrics: metrics})
+	var runs atomic.Int32
+	var correlationIDs = make(chan string, 10)
+	s.AddSchedule("tick", Every(10*time.Millisecond), func(ctx context.Context) error {
+		correlationIDs <- observability.GetCorrelationID(ctx)
+		if runs.Add(1) == 2 {
+			return errors.New("second run fails")
+		}
+		return nil
+	})
+	s.Start()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for runs.Load() < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	n := runs.Load()
+	if n < 3 {
+		t.Fatalf("Expected at least three runs, got %d", n)
+	}
+	if got := testutil.ToFloat64(metrics.BackgroundJobCounter.WithLabelValues("tick", observability.JobOutcomeSuccess)); got != float64(n-1) {
+		t.Errorf("Expected %d successful runs counted, got %v", n-1, got)
+	}
+	if got := testutil.ToFloat64(metrics.BackgroundJobErrorCount.WithLabelValues("tick")); got != 1 {
+		t.Errorf("Expected one failed run counted, got %v", got)
+	}
+	if first, second := <-correlationIDs, <-correlationIDs; first == "" || first == second {
+		t.Errorf("Expected a fresh correlation ID per run, got %q and %q", first, second)
+	}
+}
+
+func TestSchedulerRecoversPanics(t *testing.T) {
+	if err := runJob(context.Background(), func(ctx context.Context) error { panic("boom") }); err == nil || err.Error() != "job panicked: boom" {
+		t.Errorf("Expected the panic as an error, got %v", err)
+	}
+}
+
+func TestSchedulerShutdownCancelsRunningJobs(t *testing.T) {
+	s := NewScheduler(SchedulerConfig{})
+	started := make(chan struct{})
+	var canceled atomic.Bool
+	s.AddSchedule("long", Every(time.Millisecond), func(ctx context.Context) error {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-ctx.Done()
+		canceled.Store(true)
+		return ctx.Err()
+	})
+	s.Start()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !canceled.Load() {
+		t.Error("Expected the running job's context to be canceled")
+	}
+}
+
+func TestSchedulerAddRejectsBadSpec(t *testing.T) {
+	s := NewScheduler(SchedulerConfig{})
+	if err := s.Add("bad", "every minute", func(ctx context.Context) error { return nil }); err == nil {
+		t.Error("Expected an invalid schedule to be rejected")
+	}
+}
+
+func TestSchedulerRunsExclusiveJobsOnOneReplica(t *testing.T) {
+	metrics := observability.NewMetrics(observability.MetricsOptions{})
+
+	locker := &memoryLocker{held: make(map[string]bool)}
+	var runs atomic.Int32
+	var replicas []*Scheduler
+	for i := 0; i < 3; i++ {
+		s := NewScheduler(SchedulerConfig{Locker: locker, Metrics: metrics})
+		if err := s.AddExclusive("report", "@every 10ms", func(ctx context.Context) error {
+			runs.Add(1)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		s.Start()
+		replicas = append(replicas, s)
+	}
+	time.Sleep(50 * time.Millisecond)
+	for _, s := range replicas {
+		s.Shutdown(context.Background())
+	}
+
+	// The memory locker never frees the lock, so one run is all there is
+	if n := runs.Load(); n != 1 {
+		t.Errorf("Expected one run across replicas, got %d", n)
+	}
+	if got := testutil.ToFloat64(metrics.JobLockAcquisitions.WithLabelValues("report", "acquired")); got != 1 {
+		t.Errorf("Expected one acquired lock, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.JobLockAcquisitions.WithLabelValues("report", "held")); got == 0 {
+		t.Error("Expected the other attempts counted as held")
+	}
+}
+
+func TestSchedulerSkipsExclusiveJobsWithoutLock(t *testing.T) {
+	s := NewScheduler(SchedulerConfig{Locker: &memoryLocker{err: errors.New("redis down")}})
+	var runs atomic.Int32
+	s.AddExclusive("report", "@every 5ms", func(ctx context.Context) error {
+		runs.Add(1)
+		return nil
+	})
+	s.Start()
+	time.Sleep(30 * time.Millisecond)
+	s.Shutdown(context.Background())
+	if n := runs.Load(); n != 0 {
+		t.Errorf("Expected no runs while the lock backend fails, got %d", n)
+	}
+
+	// Without a locker, exclusive jobs run like any other
+	s = NewScheduler(SchedulerConfig{})
+	s.AddExclusive("report", "@every 5ms", func(ctx context.Context) error {
+		runs.Add(1)
+		return nil
+	})
+	s.Start()
+	time.Sleep(30 * time.Millisecond)
+	s.Shutdown(context.Background())
+	if runs.Load() == 0 {
+		t.Error("Expected runs without a locker")
+	}
+}
+
+func TestSchedulerCancelsRunsThatLoseTheirLock(t *testing.T) {
+	fake, client := startFakeRedis(t)
+	s := NewScheduler(SchedulerConfig{Locker: NewRedisLocker(client, "test:"), LockTTL: 30 * time.Millisecond})
+	canceled := make(chan struct{}, 1)
+	s.AddExclusive("report", "@every 10ms", func(ctx context.Context) error {
+		// Another replica took over after the lease expired
+		fake.mu.Lock()
+		fake.keys["test:job:report"] = "someone-else"
+		fake.mu.Unlock()
+		<-ctx.Done()
+		canceled <- struct{}{}
+		return ctx.Err()
+	})
+	s.Start()
+	defer s.Shutdown(context.Background())
+	select {
+	case <-canceled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the run to be canceled once its lease was lost")
+	}
+}
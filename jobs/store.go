@@ -0,0 +1,225 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"ping/observability"
+)
+
+// ErrJobNotFound is returned for an unknown job ID.
+var ErrJobNotFound = errors.New("jobs: job not found")
+
+// Store persists queued jobs. Implementations must be safe for
+// concurrent use.
+type Store interface {
+	// Save creates or replaces the job with job.ID.
+	Save(job Job) error
+	// Load returns the job with id, or ErrJobNotFound.
+	Load(id string) (Job, error)
+	// List returns every job, oldest first.
+	List() ([]Job, error)
+	// Delete removes the job with id, if any.
+	Delete(id string) error
+}
+
+// MemoryStore keeps jobs in process, so they do not survive a restart.
+type MemoryStore struct {
+	mu   sync.RWMutex
+	jobs map[string]Job
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{jobs: make(map[string]Job)}
+}
+
+// Save implements Store.
+func (s *MemoryStore) Save(job Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[job.ID] = job
+	return nil
+}
+
+// Load implements Store.
+func (s *MemoryStore) Load(id string) (Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return Job{}, ErrJobNotFound
+	}
+	return job, nil
+}
+
+// List implements Store.
+func (s *MemoryStore) List() ([]Job, error) {
+	s.mu.RLock()
+	jobs := make([]Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job)
+	}
+	s.mu.RUnlock()
+	sortJobs(jobs)
+	return jobs, nil
+}
+
+// Delete implements Store.
+func (s *MemoryStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.jobs, id)
+	return nil
+}
+
+// FileStore keeps each job as a JSON file in a directory, standing in for
+// an embedded database without adding a dependency. Files are replaced
+// atomically, so a crash leaves either the old or the new state of a job,
+// never a torn one. There is no index: List reads every file, so it costs
+// O(n) in the jobs kept until Queue.Prune drops finished ones.
+type FileStore struct {
+	dir    string
+	logger observability.Logger
+}
+
+// FileStoreOptions configures NewFileStoreWithOptions.
+type FileStoreOptions struct {
+	// Logger reports job files List skips as unreadable. Nil uses
+	// observability.DefaultLogger.
+	Logger observability.Logger
+}
+
+// NewFileStore returns a store in dir, creating it if needed.
+func NewFileStore(dir string) (*FileStore, error) {
+	return NewFileStoreWithOptions(dir, FileStoreOptions{})
+}
+
+// NewFileStoreWithOptions is NewFileStore with a logger.
+func NewFileStoreWithOptions(dir string, opts FileStoreOptions) (*FileStore, error) {
+	if opts.Logger == nil {
+		opts.Logger = observability.DefaultLogger
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("job store: %w", err)
+	}
+	return &FileStore{dir: dir, logger: opts.Logger}, nil
+}
+
+// path returns the file of job id. IDs that could escape the directory
+// are not found.
+func (s *FileStore) path(id string) (string, error) {
+	if id == "" || strings.HasPrefix(id, ".") || strings.ContainsAny(id, `/\`) {
+		return "", ErrJobNotFound
+	}
+	return filepath.Join(s.dir, id+".json"), nil
+}
+
+// Save implements Store by writing a temporary file and renaming it over
+// the job's file.
+func (s *FileStore) Save(job Job) error {
+	path, err := s.path(job.ID)
+	if err != nil {
+		return fmt.Errorf("invalid job ID %q", job.ID)
+	}
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(s.dir, ".job-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// Load implements Store.
+func (s *FileStore) Load(id string) (Job, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return Job{}, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Job{}, ErrJobNotFound
+	}
+	if err != nil {
+		return Job{}, err
+	}
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return Job{}, fmt.Errorf("job %s: %w", id, err)
+	}
+	return job, nil
+}
+
+// List implements Store. Temporary files of interrupted saves are
+// skipped, and so are job files that cannot be read or decoded, after
+// logging them, so one corrupt file does not block recovering the rest.
+func (s *FileStore) List() ([]Job, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]Job, 0, len(entries))
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok || e.IsDir() || strings.HasPrefix(id, ".") {
+			continue
+		}
+		job, err := s.Load(id)
+		if errors.Is(err, ErrJobNotFound) {
+			// Deleted since the directory was read
+			continue
+		}
+		if err != nil {
+			s.logger.Warnf(context.Background(), "skipping unreadable job file %s: %v", e.Name(), err)
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	sortJobs(jobs)
+	return jobs, nil
+}
+
+// Delete implements Store.
+func (s *FileStore) Delete(id string) error {
+	path, err := s.path(id)
+	if err != nil {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func sortJobs(jobs []Job) {
+	sort.Slice(jobs, func(i, j int) bool {
+		if !jobs[i].EnqueuedAt.Equal(jobs[j].EnqueuedAt) {
+			return jobs[i].EnqueuedAt.Before(jobs[j].EnqueuedAt)
+		}
+		return jobs[i].ID < jobs[j].ID
+	})
+}
@@ -0,0 +1,108 @@
+package jobs
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"ping/observability"
+)
+
+func TestStores(t *testing.T) {
+	fileStore, err := NewFileStore(filepath.Join(t.TempDir(), "jobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores := map[string]Store{"memory": NewMemoryStore(), "file": fileStore}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			now := time.Now().UTC().Truncate(time.Second)
+			second := Job{ID: "b", Type: "report", State: StatePending, EnqueuedAt: now.Add(time.Second)}
+			first := Job{ID: "a", Type: "report", Payload: []byte(`{"day":1}`), State: StatePending, EnqueuedAt: now}
+			for _, job := range []Job{second, first} {
+				if err := store.Save(job); err != nil {
+					t.Fatal(err)
+				}
+			}
+			first.State = StateRunning
+			if err := store.Save(first); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := store.Load("a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.State != StateRunning || string(got.Payload) != `{"day":1}` || !got.EnqueuedAt.Equal(now) {
+				t.Errorf("Expected the saved job back, got %+v", got)
+			}
+			jobs, err := store.List()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(jobs) != 2 || jobs[0].ID != "a" || jobs[1].ID != "b" {
+				t.Errorf("Expected jobs a and b oldest first, got %+v", jobs)
+			}
+
+			if err := store.Delete("a"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := store.Load("a"); !errors.Is(err, ErrJobNotFound) {
+				t.Errorf("Expected ErrJobNotFound after delete, got %v", err)
+			}
+			if err := store.Delete("a"); err != nil {
+				t.Errorf("Expected deleting a missing job to succeed, got %v", err)
+			}
+		})
+	}
+}
+
+func TestFileStoreRejectsPathsAndSkipsTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"../escape", ".hidden", "a/b", ""} {
+		if _, err := store.Load(id); !errors.Is(err, ErrJobNotFound) {
+			t.Errorf("Load(%q): expected ErrJobNotFound, got %v", id, err)
+		}
+		if err := store.Save(Job{ID: id}); err == nil {
+			t.Errorf("Save(%q): expected an error", id)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".job-123"), []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if jobs, err := store.List(); err != nil || len(jobs) != 0 {
+		t.Errorf("Expected the temporary file to be skipped, got %v, %v", jobs, err)
+	}
+}
+
+func TestFileStoreListSkipsCorruptFiles(t *testing.T) {
+	dir := t.TempDir()
+	var logs bytes.Buffer
+	store, err := NewFileStoreWithOptions(dir, FileStoreOptions{Logger: observability.NewStdLogger(log.New(&logs, "", 0))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(Job{ID: "good", Type: "report", State: StatePending}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "bad.json"), []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, err := store.List()
+	if err != nil || len(jobs) != 1 || jobs[0].ID != "good" {
+		t.Errorf("Expected only the readable job, got %v, %v", jobs, err)
+	}
+	if !strings.Contains(logs.String(), "bad.json") {
+		t.Errorf("Expected the corrupt file to be logged, got %q", logs.String())
+	}
+}
@@ -2,17 +2,36 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
+	"ping/auth"
+	"ping/client"
+	"ping/config"
+	"ping/files"
 	"ping/handlers"
+	"ping/health"
+	"ping/jobs"
+	"ping/metricsexport"
 	"ping/middleware"
 	"ping/observability"
+	"ping/redis"
+	"ping/runtimelimits"
+	"ping/tracing"
 )
 
 // Legacy handler for backward compatibility
@@ -22,34 +41,754 @@ func pong(w http.ResponseWriter, _ *http.Request) {
 }
 
 func main() {
+	// "config validate" and "config dump" check the configuration and exit
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(config.Command(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
+	// Load configuration from CONFIG_FILE, when set, and the environment
+	cfg, err := config.LoadFrom(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
 	// Initialize metrics
-	metrics := observability.InitMetrics()
+	summaries, err := observability.ParseSummaryObjectives(cfg.MetricsSummaries)
+	if err != nil {
+		log.Fatalf("Invalid METRICS_SUMMARIES: %v", err)
+	}
+	constLabels, err := observability.ParseConstLabels(cfg.MetricsConstLabels)
+	if err != nil {
+		log.Fatalf("Invalid METRICS_CONST_LABELS: %v", err)
+	}
+	// A zero METRICS_MAX_SERIES disables the cap
+	maxSeries := cfg.MetricsMaxSeries
+	if maxSeries == 0 {
+		maxSeries = -1
+	}
+	metrics, err := observability.InitMetricsWithOptions(observability.MetricsOptions{
+		Summaries:                summaries,
+		Namespace:                cfg.MetricsNamespace,
+		Subsystem:                cfg.MetricsSubsystem,
+		ConstLabels:              constLabels,
+		DisableRuntimeCollectors: !cfg.MetricsRuntimeCollectors,
+		MaxSeriesPerMetric:       maxSeries,
+	})
+	if err != nil {
+		log.Fatalf("Failed to initialize metrics: %v", err)
+	}
 	log.Println("✓ Metrics initialized")
 
+	// Fit GOMAXPROCS and the GC to the container's CPU and memory limits,
+	// then apply any GC tuning
+	limits, err := runtimelimits.Apply(runtimelimits.Options{
+		DisableAutoMaxProcs: !cfg.RuntimeAutoMaxProcs,
+		MemoryLimit:         int64(cfg.RuntimeMemoryLimitMB) << 20,
+		MemoryLimitRatio:    cfg.RuntimeMemoryLimitRatio,
+		GCPercent:           cfg.RuntimeGCPercent,
+		MemoryBallast:       int64(cfg.RuntimeMemoryBallastMB) << 20,
+	})
+	if err != nil {
+		log.Printf("Error applying runtime limits: %v", err)
+	} else {
+		metrics.RecordRuntimeLimits(limits.MaxProcs, limits.CPUQuota, limits.MemoryLimit, limits.MemoryBallast)
+		log.Printf("✓ Runtime: %s", limits)
+	}
+
+	// Generated correlation IDs follow the configured scheme everywhere
+	idGenerator, err := observability.ParseIDGenerator(cfg.RequestIDScheme, cfg.RequestIDPrefix)
+	if err != nil {
+		log.Fatalf("Invalid REQUEST_ID_SCHEME: %v", err)
+	}
+	observability.DefaultIDGenerator = idGenerator
+	if cfg.RequestIDScheme != "uuid4" {
+		log.Printf("✓ Request IDs: %s", cfg.RequestIDScheme)
+	}
+
+	// Move log writes off the request path if requested
+	var logOutput io.Writer = os.Stderr
+	if cfg.LogAsync {
+		asyncLog := observability.NewAsyncWriter(os.Stderr, cfg.LogBufferSize, metrics.LogLinesDroppedCounter.Inc)
+		log.SetOutput(asyncLog)
+		logOutput = asyncLog
+		defer asyncLog.Close()
+		log.Printf("✓ Async logging enabled (buffer: %d lines)", cfg.LogBufferSize)
+	}
+
+	// Structured logs carry the correlation ID as a field on every line
+	logger := observability.DefaultLogger
+	if cfg.LogFormat == "json" {
+		hostname, _ := os.Hostname()
+		deployment := observability.DeploymentInfo{
+			Hostname:    hostname,
+			Pod:         cfg.PodName,
+			InstanceID:  cfg.InstanceID,
+			Version:     cfg.Version,
+			Environment: cfg.Environment,
+		}
+		handler := slog.NewJSONHandler(logOutput, &slog.HandlerOptions{Level: slog.LevelDebug}).
+			WithAttrs(deployment.Attrs())
+		slogger := slog.New(observability.NewCorrelationHandler(handler))
+		slog.SetDefault(slogger)
+		logger = observability.NewSlogLogger(slogger)
+		log.Println("✓ JSON logging enabled")
+	}
+
 	// Create HTTP mux
 	mux := http.NewServeMux()
 
-	// Register handlers with instrumentation middleware
-	mux.HandleFunc("/", handlers.PongHandler)
-	mux.HandleFunc("/metrics", handlers.MetricsHandler)
-	mux.HandleFunc("/health", handlers.HealthHandler)
+	// Outbound integrations share one instrumented client, and its retries
+	// share one budget
+	retryPolicy := client.RetryPolicy{
+		MaxAttempts: cfg.OutboundRetryMaxAttempts,
+		Backoff:     cfg.OutboundRetryBackoff,
+		MaxBackoff:  cfg.OutboundRetryMaxBackoff,
+		Jitter:      0.2,
+		Methods:     cfg.OutboundRetryMethods,
+	}
+	hostRetries, err := client.ParseHostRetries(cfg.OutboundRetryHosts, retryPolicy)
+	if err != nil {
+		log.Fatalf("Invalid OUTBOUND_RETRY_HOSTS: %v", err)
+	}
+	outboundConfig := client.Config{
+		Timeout:     cfg.OutboundTimeout,
+		LogLevel:    cfg.OutboundLogLevel,
+		Logger:      logger,
+		Retry:       retryPolicy,
+		HostRetries: hostRetries,
+		RetryBudget: client.NewRetryBudget(cfg.OutboundRetryBudget, cfg.OutboundRetryBudgetBurst),
+		Metrics:     metrics,
+	}
+	outbound := client.New(outboundConfig)
+	// HTTP health checks may hedge a slow answer; exports and token
+	// fetches are not latency sensitive enough to pay for the extra calls
+	probes := outbound
+	if cfg.HealthCheckHedgeDelay > 0 {
+		probeConfig := outboundConfig
+		probeConfig.Hedge = client.HedgePolicy{Delay: cfg.HealthCheckHedgeDelay}
+		probes = client.New(probeConfig)
+	}
+
+	// Subsystems register their checks here as they start; /health
+	// aggregates them
+	healthChecks := health.NewRegistryWithOptions(health.RegistryOptions{
+		Timeout:  cfg.HealthCheckTimeout,
+		CacheTTL: cfg.HealthCacheTTL,
+		Metrics:  metrics,
+		Logger:   logger,
+	})
+	// Probes and scrapes must get through limits and auth
+	probePaths := []string{"/health", "/livez", "/readyz", "/startupz", "/metrics"}
+	dependencyChecks, err := health.ParseDependencyChecks(cfg.HealthChecks, health.DependencyOptions{
+		NonCritical: cfg.HealthChecksNonCritical,
+		DiskMinFree: uint64(cfg.HealthDiskMinFreeMB) << 20,
+		Client:      probes,
+	})
+	if err != nil {
+		log.Fatalf("Invalid HEALTH_CHECKS: %v", err)
+	}
+	for _, c := range dependencyChecks {
+		healthChecks.RegisterCheck(c)
+	}
+	if len(dependencyChecks) > 0 {
+		log.Printf("✓ %d dependency health checks registered", len(dependencyChecks))
+	}
+
+	// Operational endpoints get basic auth when credentials are configured
+	protect := func(h http.Handler) http.Handler { return h }
+	if cfg.AdminUsername != "" {
+		protect = middleware.NewBasicAuthMiddleware(middleware.BasicAuthConfig{
+			Username: cfg.AdminUsername,
+			Password: cfg.AdminPassword,
+			Realm:    "ping admin",
+			Metrics:  metrics,
+		})
+		// OIDC, when configured, guards /debug/* and /jobs instead
+		protected := "/metrics, /stats, /debug/* and /jobs"
+		if cfg.OIDCIssuerURL != "" {
+			protected = "/metrics and /stats"
+		}
+		log.Printf("✓ Basic auth enabled for %s", protected)
+	}
+
+	// Register handlers with instrumentation middleware; the names label
+	// their requests in metrics and logs
+	named := observability.NamedHandler
+	if cfg.ProxyUpstreamURL != "" {
+		// Sidecar mode: everything but the built-in endpoints goes upstream
+		upstream, err := url.Parse(cfg.ProxyUpstreamURL)
+		if err != nil {
+			log.Fatalf("Invalid PROXY_UPSTREAM_URL: %v", err)
+		}
+		mux.Handle("/", named("proxy", handlers.NewProxyHandler(handlers.ProxyConfig{
+			Upstream: upstream,
+			Transport: client.NewTransport(client.Config{
+				Timeout:  cfg.ProxyTimeout,
+				LogLevel: cfg.OutboundLogLevel,
+				Logger:   logger,
+				Metrics:  metrics,
+			}),
+			Metrics: metrics,
+			Timeout: cfg.ProxyTimeout,
+		})))
+		log.Printf("✓ Reverse proxying to %s", cfg.ProxyUpstreamURL)
+	} else {
+		mux.Handle("/", named("pong", http.HandlerFunc(handlers.PongHandler)))
+	}
+	handlers.RegisterPing(mux)
+	if cfg.MetricsMode != "otlp" {
+		metricsHandler := handlers.NewMetricsHandlerWithOptions(metrics.Registerer, metrics.Gatherer, handlers.MetricsHandlerOptions{
+			CreatedTimestamps: cfg.MetricsCreatedTimestamps,
+		})
+		mux.Handle("/metrics", named("metrics", protect(metricsHandler)))
+	}
+	mux.Handle("/health", named("health", handlers.NewHealthHandler(healthChecks)))
+	// Kubernetes-style probes: liveness restarts, readiness takes the pod
+	// out of rotation (also while draining), startup holds both off
+	mux.Handle("/livez", named("livez", handlers.NewProbeHandler(healthChecks.Liveness)))
+	mux.Handle("/readyz", named("readyz", handlers.NewProbeHandler(healthChecks.Readiness)))
+	mux.Handle("/startupz", named("startupz", handlers.NewProbeHandler(func(context.Context) health.Report {
+		return healthChecks.Startup()
+	})))
+	mux.Handle("/echo", named("echo", http.HandlerFunc(handlers.EchoHandler)))
+	mux.Handle("/ip", named("ip", http.HandlerFunc(handlers.IPHandler)))
+	var schemas map[string]*files.Schema
+	if cfg.FilesSchemaDir != "" {
+		var err error
+		if schemas, err = files.LoadSchemas(cfg.FilesSchemaDir); err != nil {
+			log.Fatalf("Failed to load file schemas: %v", err)
+		}
+		log.Printf("✓ Loaded %d file schemas from %s", len(schemas), cfg.FilesSchemaDir)
+	}
+	if cfg.FilesRejectsDir != "" {
+		if err := os.MkdirAll(cfg.FilesRejectsDir, 0o755); err != nil {
+			log.Fatalf("Failed to create rejects directory: %v", err)
+		}
+	}
+	// File endpoints are product routes: JWT_JWKS_URL, not the admin
+	// credentials, guards them
+	csvUpload := named("files-csv", handlers.NewCSVUploadHandler(handlers.CSVUploadConfig{
+		MaxBytes:   int64(cfg.FilesMaxUploadBytes),
+		Options:    files.Options{Workers: cfg.FilesWorkers, ChunkRows: cfg.FilesChunkRows, Metrics: metrics},
+		Schemas:    schemas,
+		RejectsDir: cfg.FilesRejectsDir,
+		Timeout:    cfg.FilesTimeout,
+	}))
+	mux.Handle("/files/csv", csvUpload)
+	mux.Handle("/files/csv/", csvUpload)
+	mux.Handle("/files/convert", named("files-convert", handlers.NewConvertHandler(handlers.ConvertConfig{
+		MaxBytes: int64(cfg.FilesMaxUploadBytes),
+		Metrics:  metrics,
+		Timeout:  cfg.FilesTimeout,
+	})))
+
+	// Debug endpoints live on a separate admin listener when one is configured
+	adminMux := mux
+	if cfg.AdminPort != "" {
+		adminMux = http.NewServeMux()
+	}
+
+	// A signed-in, group-checked user is required for the admin endpoints
+	// when an OIDC provider is configured
+	protectAdmin := protect
+	if cfg.OIDCIssuerURL != "" {
+		oidc, err := auth.NewOIDC(auth.OIDCConfig{
+			IssuerURL:    cfg.OIDCIssuerURL,
+			ClientID:     cfg.OIDCClientID,
+			ClientSecret: cfg.OIDCClientSecret,
+			RedirectURL:  cfg.OIDCRedirectURL,
+			Scopes:       cfg.OIDCScopes,
+			GroupsClaim:  cfg.OIDCGroupsClaim,
+			CookieSecret: []byte(cfg.OIDCCookieSecret),
+			SessionTTL:   cfg.OIDCSessionTTL,
+			Client:       outbound,
+		})
+		if err != nil {
+			log.Fatalf("Invalid OIDC configuration: %v", err)
+		}
+		adminMux.HandleFunc("/auth/login", oidc.LoginHandler)
+		adminMux.HandleFunc("/auth/callback", oidc.CallbackHandler)
+		adminMux.HandleFunc("/auth/logout", oidc.LogoutHandler)
+		protectAdmin = middleware.NewOIDCSessionMiddleware(middleware.OIDCSessionConfig{
+			OIDC:          oidc,
+			LoginPath:     "/auth/login",
+			AllowedGroups: cfg.OIDCAllowedGroups,
+			Metrics:       metrics,
+		})
+		log.Printf("✓ OIDC login enabled for admin endpoints (issuer: %s)", cfg.OIDCIssuerURL)
+	}
+
+	var recentRequests *observability.RequestRing
+	if cfg.RecentRequests > 0 {
+		recentRequests = observability.NewRequestRing(cfg.RecentRequests)
+		adminMux.Handle("/debug/requests", protectAdmin(handlers.RecentRequestsHandler(recentRequests)))
+	}
+
+	// Mask credentials before request details reach the logs
+	redaction := middleware.DefaultRedaction()
+	if cfg.LogRedactQueryParams != nil {
+		redaction.QueryParams = cfg.LogRedactQueryParams
+	}
+	if cfg.LogRedactHeaders != nil {
+		redaction.Headers = cfg.LogRedactHeaders
+	}
+	redaction.MaxUserAgentLength = cfg.LogMaxUserAgent
+	// The debug capture token must never show up in logged headers
+	redaction.Headers = append(redaction.Headers, cfg.DebugCaptureHeader)
+
+	// Resolve the real client behind trusted proxies before anything logs
+	// or rate limits by address
+	clientIPs, err := middleware.NewClientIPResolver(cfg.TrustedProxies)
+	if err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
+	// Push the same metric stream to an OTLP collector, alongside or
+	// instead of Prometheus scraping, and to any configured push targets
+	var metricsPushers []*metricsexport.Pusher
+	startPusher := func(name, target string, exporter metricsexport.Exporter) {
+		metricsPushers = append(metricsPushers, metricsexport.NewPusher(metricsexport.PusherConfig{
+			Name:     name,
+			Exporter: exporter,
+			Gatherer: metrics.Gatherer,
+			Interval: cfg.MetricsPushInterval,
+			Metrics:  metrics,
+		}))
+		log.Printf("✓ Pushing metrics to %s every %s", target, cfg.MetricsPushInterval)
+	}
+	// Pushed series carry the job and instance labels a scrape would add
+	instance := cfg.InstanceID
+	if instance == "" {
+		instance = cfg.PodName
+	}
+	if instance == "" {
+		instance, _ = os.Hostname()
+	}
+	if cfg.MetricsMode != "prometheus" {
+		resource := map[string]string{"service.instance.id": instance}
+		if cfg.Environment != "" {
+			resource["deployment.environment"] = cfg.Environment
+		}
+		headers := make(map[string]string)
+		for _, h := range cfg.OTLPMetricsHeaders {
+			name, value, _ := strings.Cut(h, "=")
+			headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+		startPusher("otlp", cfg.OTLPMetricsEndpoint, metricsexport.NewOTLPExporter(metricsexport.OTLPConfig{
+			Endpoint:           cfg.OTLPMetricsEndpoint,
+			ServiceName:        cfg.ServiceName,
+			ServiceVersion:     cfg.Version,
+			ResourceAttributes: resource,
+			Headers:            headers,
+			Client:             outbound,
+		}))
+	}
+	if cfg.MetricsPushgatewayURL != "" {
+		startPusher("pushgateway", cfg.MetricsPushgatewayURL, metricsexport.NewPushgatewayExporter(metricsexport.PushgatewayConfig{
+			URL:      cfg.MetricsPushgatewayURL,
+			Job:      cfg.ServiceName,
+			Grouping: map[string]string{"instance": instance},
+			Client:   outbound,
+		}))
+	}
+	if cfg.MetricsStatsDAddr != "" {
+		startPusher(cfg.MetricsStatsDFlavor, cfg.MetricsStatsDAddr, metricsexport.NewStatsDExporter(metricsexport.StatsDConfig{
+			Addr:      cfg.MetricsStatsDAddr,
+			Prefix:    cfg.MetricsStatsDPrefix,
+			DogStatsD: cfg.MetricsStatsDFlavor == "dogstatsd",
+			Tags:      cfg.MetricsStatsDTags,
+		}))
+	}
+	if cfg.MetricsGraphiteAddr != "" {
+		startPusher("graphite", cfg.MetricsGraphiteAddr, metricsexport.NewGraphiteExporter(metricsexport.GraphiteConfig{
+			Addr:   cfg.MetricsGraphiteAddr,
+			Prefix: cfg.MetricsGraphitePrefix,
+			Tagged: cfg.MetricsGraphiteTagged,
+		}))
+	}
+	if cfg.MetricsEMFNamespace != "" {
+		startPusher("emf", "CloudWatch EMF on stdout", metricsexport.NewEMFExporter(metricsexport.EMFConfig{
+			Namespace:  cfg.MetricsEMFNamespace,
+			Metrics:    cfg.MetricsEMFMetrics,
+			Dimensions: map[string]string{"service": cfg.ServiceName},
+		}))
+	}
+	if cfg.MetricsRemoteWriteURL != "" {
+		startPusher("remote_write", cfg.MetricsRemoteWriteURL, metricsexport.NewRemoteWriteExporter(metricsexport.RemoteWriteConfig{
+			URL:    cfg.MetricsRemoteWriteURL,
+			Labels: map[string]string{"job": cfg.ServiceName, "instance": instance},
+			Client: outbound,
+		}))
+	}
 
-	// Wrap mux with middleware
-	instrumentedMux := middleware.RequestInstrumentationMiddleware(mux)
+	// Summarize recent traffic and the push targets for integrations that
+	// don't speak PromQL
+	var requestStats *observability.RequestStats
+	if cfg.StatsWindow > 0 {
+		requestStats = observability.NewRequestStats(cfg.StatsWindow)
+		pusherTargets := func() map[string]bool {
+			up := make(map[string]bool, len(metricsPushers))
+			for _, p := range metricsPushers {
+				up[p.Name()] = p.Up()
+			}
+			return up
+		}
+		mux.Handle("/stats", named("stats", protect(handlers.StatsHandler(requestStats, pusherTargets))))
+	}
 
-	// Get port from environment or use default
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	// Export sampled request spans when a trace collector is configured
+	var tracer *tracing.Tracer
+	if cfg.TraceExporter != "" {
+		exporterConfig := tracing.ExporterConfig{
+			Endpoint:       cfg.TraceEndpoint,
+			ServiceName:    cfg.ServiceName,
+			ServiceVersion: cfg.Version,
+			Client:         outbound,
+		}
+		var exporter tracing.Exporter
+		switch cfg.TraceExporter {
+		case "zipkin":
+			exporter = tracing.NewZipkinExporter(exporterConfig)
+		case "jaeger":
+			exporter = tracing.NewJaegerExporter(exporterConfig)
+		default:
+			exporter = tracing.NewOTLPExporter(exporterConfig)
+		}
+		sampler, err := tracing.ParseSampler(cfg.TraceSampler)
+		if err != nil {
+			log.Fatalf("Invalid TRACE_SAMPLER: %v", err)
+		}
+		if len(cfg.TraceSampleRoutes) > 0 {
+			routes, err := tracing.ParseRouteSamplers(cfg.TraceSampleRoutes)
+			if err != nil {
+				log.Fatalf("Invalid TRACE_SAMPLE_ROUTES: %v", err)
+			}
+			sampler = tracing.PerRoute(sampler, routes)
+		}
+		tracer = tracing.NewTracer(tracing.TracerConfig{Exporter: exporter, Sampler: sampler, Metrics: metrics})
+		log.Printf("✓ Exporting traces to %s (%s)", cfg.TraceEndpoint, cfg.TraceExporter)
 	}
 
+	// Recurring background work, e.g. purging expired cache entries
+	schedulerConfig := jobs.SchedulerConfig{Logger: logger, IDGenerator: idGenerator, LockTTL: cfg.JobLockTTL, Metrics: metrics}
+	if cfg.JobLockBackend == "redis" {
+		lockClient := redis.NewClient(redis.Options{
+			Addr:     cfg.RedisAddr,
+			Password: cfg.RedisPassword,
+			DB:       cfg.RedisDB,
+		})
+		defer lockClient.Close()
+		schedulerConfig.Locker = jobs.NewRedisLocker(lockClient, "ping:lock:")
+		log.Printf("✓ Exclusive jobs locked via Redis at %s", cfg.RedisAddr)
+	}
+	scheduler := jobs.NewScheduler(schedulerConfig)
+	// One-off background work, run on a bounded number of workers
+	workerPool := jobs.NewPool(jobs.PoolConfig{
+		Workers:     cfg.JobWorkers,
+		QueueSize:   cfg.JobQueueSize,
+		Logger:      logger,
+		IDGenerator: idGenerator,
+		Metrics:     metrics,
+	})
+	var jobStore jobs.Store = jobs.NewMemoryStore()
+	if cfg.JobStoreDir != "" {
+		fileStore, err := jobs.NewFileStoreWithOptions(cfg.JobStoreDir, jobs.FileStoreOptions{Logger: logger})
+		if err != nil {
+			log.Fatalf("Failed to open job store: %v", err)
+		}
+		jobStore = fileStore
+		log.Printf("✓ Persisting queued jobs in %s", cfg.JobStoreDir)
+	}
+	jobQueue := jobs.NewQueue(jobs.QueueConfig{
+		Store:       jobStore,
+		Pool:        workerPool,
+		IDGenerator: idGenerator,
+		Retry: jobs.RetryPolicy{
+			MaxAttempts: cfg.JobMaxAttempts,
+			Backoff:     cfg.JobRetryBackoff,
+			MaxBackoff:  cfg.JobRetryMaxBackoff,
+			Jitter:      cfg.JobRetryJitter,
+		},
+		StuckAfter: cfg.JobStuckAfter,
+		Metrics:    metrics,
+	})
+	scheduler.AddSchedule("job-prune", jobs.Every(time.Hour), func(ctx context.Context) error {
+		_, err := jobQueue.Prune(time.Now().Add(-cfg.JobRetention))
+		return err
+	})
+	if cfg.JobStuckAfter > 0 {
+		// Stuck jobs degrade health; the watchdog keeps the gauge current
+		// between probes
+		healthChecks.RegisterCheck(health.Check{Name: "jobs", Check: jobQueue.CheckStuck, NonCritical: true})
+		scheduler.AddSchedule("job-watchdog", jobs.Every(30*time.Second), func(ctx context.Context) error {
+			jobQueue.CheckStuck(ctx)
+			return nil
+		})
+	}
+	if cfg.JobsAPI {
+		jobsAPI := named("jobs", protectAdmin(handlers.NewJobsHandler(jobQueue)))
+		adminMux.Handle("/jobs", jobsAPI)
+		adminMux.Handle("/jobs/", jobsAPI)
+		log.Println("✓ Job management API enabled at /jobs")
+	}
+	if cfg.FileWatchDir != "" {
+		compress, err := files.ParseCompression(cfg.FileWatchCompress)
+		if err != nil {
+			log.Fatalf("Invalid file watch compression: %v", err)
+		}
+		var schema *files.Schema
+		if cfg.FileWatchSchema != "" {
+			if schema = schemas[cfg.FileWatchSchema]; schema == nil {
+				log.Fatalf("FILE_WATCH_SCHEMA %q is not in %s", cfg.FileWatchSchema, cfg.FilesSchemaDir)
+			}
+		}
+		var bucket *files.Bucket
+		if cfg.FileUploadBucket != "" {
+			bucket, err = files.NewBucket(files.BucketConfig{
+				Endpoint:        cfg.FileUploadEndpoint,
+				Region:          cfg.FileUploadRegion,
+				Bucket:          cfg.FileUploadBucket,
+				Prefix:          cfg.FileUploadPrefix,
+				AccessKeyID:     cfg.FileUploadAccessKeyID,
+				SecretAccessKey: cfg.FileUploadSecretAccessKey,
+				SessionToken:    cfg.FileUploadSessionToken,
+				PartSize:        cfg.FileUploadPartSize,
+				// Parts take longer than the other outbound calls
+				Client:  client.New(client.Config{Timeout: 5 * time.Minute, Metrics: metrics}),
+				Metrics: metrics,
+			})
+			if err != nil {
+				log.Fatalf("Invalid file upload bucket: %v", err)
+			}
+			log.Printf("✓ Uploading ingested files to %s/%s", cfg.FileUploadEndpoint, cfg.FileUploadBucket)
+		}
+		watcher, err := files.NewWatcher(files.WatcherConfig{
+			Dir:       cfg.FileWatchDir,
+			Schema:    schema,
+			Workers:   cfg.FilesWorkers,
+			ChunkRows: cfg.FilesChunkRows,
+			Compress:  compress,
+			Upload:    bucket,
+			Logger:    logger,
+			Metrics:   metrics,
+		})
+		if err != nil {
+			log.Fatalf("Failed to watch %s: %v", cfg.FileWatchDir, err)
+		}
+		scheduler.AddSchedule("file-ingest", jobs.Every(cfg.FileWatchInterval), watcher.Scan)
+		log.Printf("✓ Ingesting CSV/TSV files dropped into %s", cfg.FileWatchDir)
+	}
+
+	// Middleware, outermost first
+	instrumentation := middleware.InstrumentationConfig{
+		TailLogging:          cfg.LogTail,
+		TailLatencyThreshold: cfg.LogTailThreshold,
+		SlowRequestThreshold: cfg.SlowRequestThreshold,
+		Redaction:            redaction,
+		BodyCapture: middleware.BodyCaptureConfig{
+			Routes:   cfg.DebugCaptureRoutes,
+			Header:   cfg.DebugCaptureHeader,
+			Token:    cfg.DebugCaptureToken,
+			MaxBytes: cfg.DebugCaptureMaxBytes,
+		},
+		Tracer:         tracer,
+		RecentRequests: recentRequests,
+		Stats:          requestStats,
+		Metrics:        metrics,
+		Logger:         logger,
+		IDGenerator:    idGenerator,
+		Routes:         mux,
+		RouteNormalizer: observability.NewRouteNormalizer(observability.RouteNormalizerConfig{
+			Templates: cfg.MetricsRouteTemplates,
+			MaxRoutes: cfg.MetricsMaxRoutes,
+		}),
+	}
+	chain := middleware.NewChain().
+		Use("client-ip", middleware.NewClientIPMiddleware(clientIPs)).
+		Use("instrumentation", middleware.NewRequestInstrumentationMiddleware(instrumentation))
+
+	// Shadow a sample of live traffic to another upstream, e.g. a canary
+	if cfg.MirrorURL != "" {
+		mirrorTarget, err := url.Parse(cfg.MirrorURL)
+		if err != nil {
+			log.Fatalf("Invalid MIRROR_URL: %v", err)
+		}
+		chain.Use("mirror", middleware.NewMirrorMiddleware(middleware.MirrorConfig{
+			Target:             mirrorTarget,
+			Percent:            cfg.MirrorPercent,
+			Timeout:            cfg.MirrorTimeout,
+			MaxBodyBytes:       int64(cfg.MirrorMaxBodyBytes),
+			ExemptPaths:        probePaths,
+			ForwardCredentials: cfg.MirrorForwardCredentials,
+			Metrics:            metrics,
+		}))
+		log.Printf("✓ Mirroring %g%% of requests to %s", cfg.MirrorPercent, cfg.MirrorURL)
+	}
+
+	// Attach the verified client certificate identity, if any
+	if cfg.TLSClientCAFile != "" {
+		chain.Use("client-identity", middleware.NewClientIdentityMiddleware(middleware.ClientIdentityConfig{
+			MetricLabel: cfg.ClientIdentityMetric,
+			Metrics:     metrics,
+		}))
+	}
+
+	// Compress inside instrumentation so logged sizes are bytes on the wire
+	if cfg.Compression {
+		chain.Use("compression", middleware.NewCompressionMiddleware(middleware.CompressionConfig{
+			MinSize: cfg.CompressionMinSize,
+			Metrics: metrics,
+		}))
+	}
+
+	// Decode gzip/zstd request bodies, capping their expanded size
+	chain.Use("decompression", middleware.NewDecompressionMiddleware(middleware.DecompressionConfig{
+		MaxBytes: int64(cfg.MaxDecompressedBodyBytes),
+		Metrics:  metrics,
+	}))
+
+	// Answer preflights before they count against rate or concurrency
+	// limits, and decorate rejections so browsers can read them
+	if len(cfg.CORSAllowedOrigins) > 0 {
+		chain.Use("cors", middleware.NewCORSMiddleware(middleware.CORSConfig{
+			AllowedOrigins:   cfg.CORSAllowedOrigins,
+			AllowedMethods:   cfg.CORSAllowedMethods,
+			AllowedHeaders:   cfg.CORSAllowedHeaders,
+			ExposedHeaders:   cfg.CORSExposedHeaders,
+			AllowCredentials: cfg.CORSAllowCredentials,
+			MaxAge:           cfg.CORSMaxAge,
+		}))
+	}
+
+	if cfg.SecurityHeaders {
+		chain.Use("security-headers", middleware.NewSecurityHeadersMiddleware(middleware.SecurityHeadersConfig{
+			HSTSMaxAge:            cfg.HSTSMaxAge,
+			HSTSIncludeSubdomains: true,
+			FrameOptions:          cfg.FrameOptions,
+			ReferrerPolicy:        cfg.ReferrerPolicy,
+			ContentSecurityPolicy: cfg.ContentSecurityPolicy,
+			ExemptPaths:           cfg.SecurityHeadersExemptPaths,
+		}))
+	}
+
+	// Throttle noisy clients before they take up concurrency slots
+	if cfg.RateLimitRPS > 0 {
+		var limiter middleware.RateLimiter = middleware.NewLocalRateLimiter(cfg.RateLimitRPS, cfg.RateLimitBurst, cfg.RateLimitMaxClients)
+		if cfg.RateLimitBackend == "redis" {
+			redisClient := redis.NewClient(redis.Options{
+				Addr:     cfg.RedisAddr,
+				Password: cfg.RedisPassword,
+				DB:       cfg.RedisDB,
+				Timeout:  50 * time.Millisecond,
+			})
+			defer redisClient.Close()
+			limiter = middleware.NewRedisRateLimiter(redisClient, cfg.RateLimitRPS, cfg.RateLimitBurst, "ping:ratelimit:", limiter, metrics)
+			// Local limits take over while Redis is down, so it only degrades
+			healthChecks.RegisterCheck(health.Check{
+				Name: "redis",
+				Check: func(ctx context.Context) error {
+					_, err := redisClient.Do(ctx, "PING")
+					return err
+				},
+				NonCritical: true,
+			})
+			log.Printf("✓ Shared rate limiting via Redis at %s", cfg.RedisAddr)
+		}
+		chain.Use("rate-limit", middleware.NewRateLimitMiddleware(middleware.RateLimitConfig{
+			Limiter:     limiter,
+			ExemptPaths: probePaths,
+			Headers:     cfg.RateLimitHeaders,
+			Metrics:     metrics,
+		}))
+	}
+
+	// Require bearer tokens once a key set is configured
+	if cfg.JWTJWKSURL != "" {
+		verifier := auth.NewVerifier(auth.VerifierConfig{
+			Keys: auth.NewJWKS(auth.JWKSConfig{
+				URL:             cfg.JWTJWKSURL,
+				RefreshInterval: cfg.JWKSRefreshInterval,
+				Client:          outbound,
+			}),
+			Issuer:   cfg.JWTIssuer,
+			Audience: cfg.JWTAudience,
+			Leeway:   cfg.JWTLeeway,
+		})
+		chain.Use("jwt", middleware.NewJWTMiddleware(middleware.JWTConfig{
+			Verifier:    verifier,
+			ExemptPaths: cfg.JWTExemptPaths,
+			Metrics:     metrics,
+		}))
+		log.Printf("✓ JWT authentication enabled (jwks: %s)", cfg.JWTJWKSURL)
+	}
+
+	// Cap concurrent requests and shed by priority under sustained queueing,
+	// leaving probes and scrapes unaffected
+	if cfg.MaxInFlight > 0 {
+		chain.Use("concurrency", middleware.NewConcurrencyLimitMiddleware(middleware.ConcurrencyLimitConfig{
+			MaxInFlight:     cfg.MaxInFlight,
+			QueueTimeout:    cfg.ConcurrencyQueueTimeout,
+			ExemptPaths:     probePaths,
+			RetryAfter:      cfg.RetryAfter,
+			QueueWaitTarget: cfg.ShedQueueWaitTarget,
+			Priority:        middleware.PriorityByPath(cfg.ShedLowPriorityPaths, cfg.ShedCriticalPaths),
+			Metrics:         metrics,
+		}))
+	}
+
+	// Serve hot GET routes from memory; sits innermost so auth and rate
+	// limits still apply to cache hits
+	if len(cfg.CacheRoutes) > 0 {
+		if cfg.ProxyUpstreamURL == "" {
+			log.Println("CACHE_ROUTES has no effect without PROXY_UPSTREAM_URL: built-in endpoints are never cached")
+		}
+		cache := middleware.NewResponseCache(middleware.CacheConfig{
+			Routes:      cfg.CacheRoutes,
+			TTL:         cfg.CacheTTL,
+			MaxEntries:  cfg.CacheMaxEntries,
+			VaryHeaders: cfg.CacheVaryHeaders,
+			Metrics:     metrics,
+		})
+		chain.Use("cache", middleware.NewCacheMiddleware(cache))
+		purge := func(ctx context.Context) error {
+			if n := cache.PurgeExpired(); n > 0 {
+				observability.LoggerFromContext(ctx).Infof(ctx, "purged %d expired cached responses", n)
+			}
+			return nil
+		}
+		jobQueue.Handle("cache-purge", func(ctx context.Context, _ json.RawMessage) error { return purge(ctx) })
+		if err := scheduler.Add("cache-purge", cfg.CachePurgeSchedule, purge); err != nil {
+			log.Fatalf("Invalid CACHE_PURGE_SCHEDULE: %v", err)
+		}
+		log.Printf("✓ Caching responses for %s (ttl %s)", strings.Join(cfg.CacheRoutes, ", "), cfg.CacheTTL)
+	}
+
+	// Recover right inside instrumentation, so panics anywhere in the rest
+	// of the chain are answered, logged with the correlation ID and counted
+	if err := chain.InsertAfter("instrumentation", "recovery", middleware.NewRecoveryMiddleware(metrics)); err != nil {
+		log.Fatalf("Failed to add recovery middleware: %v", err)
+	}
+	log.Printf("✓ Middleware: %s", strings.Join(chain.Names(), " → "))
+	rootHandler := chain.Then(mux)
+
+	port := cfg.Port
+
 	// Create HTTP server
 	server := &http.Server{
 		Addr:         ":" + port,
-		Handler:      instrumentedMux,
+		Handler:      rootHandler,
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
+		ConnState:    observability.NewConnTracker(metrics, "main").ConnState,
+	}
+	if cfg.TLSCertFile != "" {
+		tlsConfig, err := serverTLSConfig(cfg)
+		if err != nil {
+			log.Fatalf("Invalid TLS configuration: %v", err)
+		}
+		server.TLSConfig = tlsConfig
+		log.Printf("✓ TLS enabled (client auth: %s)", cfg.TLSClientAuth)
 	}
 
 	// Channel for graceful shutdown
@@ -60,20 +799,79 @@ func main() {
 	// Start server in a goroutine
 	go func() {
 		log.Printf("⇨ listening on :%s", port)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if cfg.TLSCertFile != "" {
+			// Handshakes are completed by the listener to record their metrics
+			var ln net.Listener
+			if ln, err = net.Listen("tcp", server.Addr); err == nil {
+				err = server.Serve(observability.NewTLSListener(ln, server.TLSConfig, metrics, server.ReadTimeout))
+			}
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Server error: %v", err)
 		}
 	}()
 
+	// Start the admin server, if any, alongside the main one
+	var adminServer *http.Server
+	if cfg.AdminPort != "" {
+		// Admin requests get correlation IDs, logs, metrics and panic
+		// recovery too, but stay out of the traffic summaries they inspect
+		adminInstrumentation := instrumentation
+		adminInstrumentation.Routes = adminMux
+		adminInstrumentation.RecentRequests = nil
+		adminInstrumentation.Stats = nil
+		adminHandler := middleware.NewChain().
+			Use("client-ip", middleware.NewClientIPMiddleware(clientIPs)).
+			Use("instrumentation", middleware.NewRequestInstrumentationMiddleware(adminInstrumentation)).
+			Use("recovery", middleware.NewRecoveryMiddleware(metrics)).
+			Then(adminMux)
+		adminServer = &http.Server{
+			Addr:         ":" + cfg.AdminPort,
+			Handler:      adminHandler,
+			ReadTimeout:  15 * time.Second,
+			WriteTimeout: 15 * time.Second,
+			IdleTimeout:  60 * time.Second,
+			ConnState:    observability.NewConnTracker(metrics, "admin").ConnState,
+		}
+		go func() {
+			log.Printf("⇨ admin listening on :%s", cfg.AdminPort)
+			if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Admin server error: %v", err)
+			}
+		}()
+	}
+
+	// Rerun the jobs a previous process left unfinished
+	if n, err := jobQueue.Recover(); err != nil {
+		log.Printf("Error recovering queued jobs: %v", err)
+	} else if n > 0 {
+		log.Printf("✓ Recovered %d queued jobs", n)
+	}
+	scheduler.Start()
+
 	// Log startup info
-	log.Printf("✓ Pong service started (version: 1.0.0)")
-	log.Printf("✓ Metrics available at http://localhost:%s/metrics", port)
+	healthChecks.MarkStarted()
+	log.Printf("✓ Pong service started (version: %s)", cfg.Version)
+	if cfg.MetricsMode != "otlp" {
+		log.Printf("✓ Metrics available at http://localhost:%s/metrics", port)
+	}
 	log.Printf("✓ Correlation ID headers: %s, %s", observability.RequestIDHeader, observability.CorrelationIDHeader)
 
 	// Wait for shutdown signal
 	<-sigChan
 	log.Println("⇨ Shutdown signal received, shutting down gracefully...")
 
+	// Fail readiness first so load balancers stop routing here before
+	// the listeners close
+	healthChecks.MarkDraining()
+	if cfg.ShutdownDrainDelay > 0 {
+		log.Printf("⇨ Draining for %s", cfg.ShutdownDrainDelay)
+		time.Sleep(cfg.ShutdownDrainDelay)
+	}
+
 	// Graceful shutdown with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -81,6 +879,27 @@ func main() {
 	if err := server.Shutdown(ctx); err != nil {
 		log.Printf("Error during shutdown: %v", err)
 	}
+	if adminServer != nil {
+		if err := adminServer.Shutdown(ctx); err != nil {
+			log.Printf("Error during admin shutdown: %v", err)
+		}
+	}
+	if err := scheduler.Shutdown(ctx); err != nil {
+		log.Printf("Error stopping background jobs: %v", err)
+	}
+	if err := workerPool.Shutdown(ctx); err != nil {
+		log.Printf("Error draining job queue: %v", err)
+	}
+	for _, pusher := range metricsPushers {
+		if err := pusher.Shutdown(ctx); err != nil {
+			log.Printf("Error pushing final metrics: %v", err)
+		}
+	}
+	if tracer != nil {
+		if err := tracer.Shutdown(ctx); err != nil {
+			log.Printf("Error flushing traces: %v", err)
+		}
+	}
 
 	close(done)
 	log.Println("✓ Server stopped")
@@ -88,3 +907,35 @@ func main() {
 	// Log final metrics info
 	_ = metrics // Use metrics to avoid unused variable warning
 }
+
+// serverTLSConfig builds the main listener's TLS settings, including
+// client certificate verification for mutual TLS
+func serverTLSConfig(cfg *config.Config) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+	if cfg.TLSClientCAFile == "" {
+		return tlsConfig, nil
+	}
+
+	pem, err := os.ReadFile(cfg.TLSClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("no certificates found in " + cfg.TLSClientCAFile)
+	}
+	tlsConfig.ClientCAs = pool
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	if cfg.TLSClientAuth == "require" {
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
+}
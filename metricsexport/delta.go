@@ -0,0 +1,16 @@
+package metricsexport
+
+// deltas turns the running totals of successive snapshots into increases,
+// for backends that sum what they receive.
+type deltas map[string]float64
+
+// delta returns how much the value of key grew since the last snapshot. A
+// smaller value means the source restarted, so it counts from zero.
+func (d deltas) delta(key string, value float64) float64 {
+	previous, seen := d[key]
+	d[key] = value
+	if !seen || value < previous {
+		return value
+	}
+	return value - previous
+}
@@ -0,0 +1,17 @@
+package metricsexport
+
+import "testing"
+
+func TestDeltas(t *testing.T) {
+	d := deltas{}
+	for i, tc := range []struct{ value, want float64 }{
+		{5, 5}, // first sighting counts from zero
+		{8, 3},
+		{8, 0},
+		{2, 2}, // reset
+	} {
+		if got := d.delta("k", tc.value); got != tc.want {
+			t.Errorf("Step %d: delta(%v) = %v, want %v", i, tc.value, got, tc.want)
+		}
+	}
+}
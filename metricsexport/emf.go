@@ -0,0 +1,196 @@
+package metricsexport
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// DefaultEMFMetrics are the families emitted when EMFConfig.Metrics is
+// empty: request rate, latency, errors and concurrency.
+var DefaultEMFMetrics = []string{
+	"http_requests_total",
+	"http_request_duration_seconds",
+	"http_errors_total",
+	"http_requests_active",
+}
+
+// EMFConfig configures the CloudWatch Embedded Metric Format exporter.
+type EMFConfig struct {
+	// Namespace is the CloudWatch namespace, e.g. "Ping".
+	Namespace string
+	// Metrics lists the families to emit. Every label becomes a
+	// dimension, and CloudWatch bills each distinct combination, so only
+	// bounded families should be listed. Defaults to DefaultEMFMetrics.
+	Metrics []string
+	// Dimensions are added to every line, e.g. service=ping.
+	Dimensions map[string]string
+	// Output receives one JSON object per line. Defaults to os.Stdout,
+	// which the CloudWatch agent, ECS and Lambda forward to CloudWatch Logs.
+	Output io.Writer
+}
+
+// EMFExporter writes snapshots as CloudWatch Embedded Metric Format log
+// lines, which CloudWatch Logs turns into metrics without an agent or
+// Prometheus. Each series becomes one line with its labels as dimensions.
+// Counters are sent as the increase since the last snapshot, gauges as is,
+// and histograms as a distribution (bucket upper bounds with the number of
+// new observations in each), so CloudWatch can compute percentiles.
+type EMFExporter struct {
+	cfg     EMFConfig
+	metrics map[string]bool
+	now     func() time.Time
+
+	mu     sync.Mutex
+	totals deltas
+}
+
+// NewEMFExporter returns an EMF exporter.
+func NewEMFExporter(cfg EMFConfig) *EMFExporter {
+	if len(cfg.Metrics) == 0 {
+		cfg.Metrics = DefaultEMFMetrics
+	}
+	if cfg.Output == nil {
+		cfg.Output = os.Stdout
+	}
+	e := &EMFExporter{cfg: cfg, metrics: make(map[string]bool), now: time.Now, totals: deltas{}}
+	for _, name := range cfg.Metrics {
+		e.metrics[name] = true
+	}
+	return e
+}
+
+type emfMetric struct {
+	Name string `json:"Name"`
+	Unit string `json:"Unit"`
+}
+
+type emfDirective struct {
+	Namespace  string      `json:"Namespace"`
+	Dimensions [][]string  `json:"Dimensions"`
+	Metrics    []emfMetric `json:"Metrics"`
+}
+
+type emfMetadata struct {
+	Timestamp         int64          `json:"Timestamp"`
+	CloudWatchMetrics []emfDirective `json:"CloudWatchMetrics"`
+}
+
+// emfDistribution is the EMF form of many observations in one value.
+type emfDistribution struct {
+	Values []float64 `json:"Values"`
+	Counts []float64 `json:"Counts"`
+}
+
+// emfUnit picks the CloudWatch unit from the Prometheus naming convention.
+func emfUnit(f *dto.MetricFamily) string {
+	name := f.GetName()
+	switch {
+	case strings.HasSuffix(name, "_seconds"):
+		return "Seconds"
+	case strings.HasSuffix(name, "_bytes"), strings.HasSuffix(name, "_bytes_total"):
+		return "Bytes"
+	case f.GetType() == dto.MetricType_COUNTER:
+		return "Count"
+	}
+	return "None"
+}
+
+// value returns the EMF value of one series, or nil when there is nothing
+// new to report.
+func (e *EMFExporter) value(f *dto.MetricFamily, m *dto.Metric, key string) any {
+	switch f.GetType() {
+	case dto.MetricType_COUNTER:
+		if d := e.totals.delta(key, m.GetCounter().GetValue()); d > 0 {
+			return d
+		}
+	case dto.MetricType_GAUGE:
+		return m.GetGauge().GetValue()
+	case dto.MetricType_HISTOGRAM:
+		var dist emfDistribution
+		var below, bound float64
+		for _, b := range m.GetHistogram().GetBucket() {
+			cumulative := float64(b.GetCumulativeCount())
+			if !math.IsInf(b.GetUpperBound(), 1) {
+				bound = b.GetUpperBound()
+			}
+			if n := e.totals.delta(key+"#"+formatFloat(b.GetUpperBound()), cumulative-below); n > 0 {
+				dist.Values = append(dist.Values, bound)
+				dist.Counts = append(dist.Counts, n)
+			}
+			below = cumulative
+		}
+		// Observations past the last bound are reported at it
+		overflow := float64(m.GetHistogram().GetSampleCount()) - below
+		if n := e.totals.delta(key+"#overflow", overflow); n > 0 {
+			dist.Values = append(dist.Values, bound)
+			dist.Counts = append(dist.Counts, n)
+		}
+		if len(dist.Values) > 0 {
+			return dist
+		}
+	case dto.MetricType_SUMMARY:
+		// Quantiles cannot be merged into a distribution; report the count
+		if d := e.totals.delta(key, float64(m.GetSummary().GetSampleCount())); d > 0 {
+			return d
+		}
+	}
+	return nil
+}
+
+// Export implements Exporter.
+func (e *EMFExporter) Export(ctx context.Context, families []*dto.MetricFamily) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	timestamp := e.now().UnixMilli()
+	enc := json.NewEncoder(e.cfg.Output)
+
+	for _, f := range families {
+		if !e.metrics[f.GetName()] {
+			continue
+		}
+		unit := emfUnit(f)
+		if f.GetType() == dto.MetricType_SUMMARY {
+			unit = "Count"
+		}
+		for _, m := range f.GetMetric() {
+			line := make(map[string]any)
+			var dims []string
+			for name, value := range e.cfg.Dimensions {
+				line[name] = value
+				dims = append(dims, name)
+			}
+			for _, l := range m.GetLabel() {
+				line[l.GetName()] = l.GetValue()
+				dims = append(dims, l.GetName())
+			}
+			sort.Strings(dims)
+
+			v := e.value(f, m, f.GetName()+labelKey(m.GetLabel()))
+			if v == nil {
+				continue
+			}
+			line[f.GetName()] = v
+			line["_aws"] = emfMetadata{
+				Timestamp: timestamp,
+				CloudWatchMetrics: []emfDirective{{
+					Namespace:  e.cfg.Namespace,
+					Dimensions: [][]string{dims},
+					Metrics:    []emfMetric{{Name: f.GetName(), Unit: unit}},
+				}},
+			}
+			if err := enc.Encode(line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package metricsexport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestEMFExporter(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "http_requests_total"}, []string{"route"})
+	hist := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "http_request_duration_seconds", Buckets: []float64{0.1, 1}})
+	ignored := prometheus.NewGauge(prometheus.GaugeOpts{Name: "unlisted"})
+	reg.MustRegister(counter, hist, ignored)
+	counter.WithLabelValues("/health").Add(3)
+	hist.Observe(0.05)
+	hist.Observe(0.5)
+	hist.Observe(5)
+
+	var out bytes.Buffer
+	exp := NewEMFExporter(EMFConfig{Namespace: "Ping", Dimensions: map[string]string{"service": "ping"}, Output: &out})
+	exp.now = func() time.Time { return time.UnixMilli(1000) }
+	families, _ := reg.Gather()
+	if err := exp.Export(context.Background(), families); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected one line per listed series, got:\n%s", out.String())
+	}
+	var latency, requests map[string]any
+	json.Unmarshal([]byte(lines[0]), &latency)
+	json.Unmarshal([]byte(lines[1]), &requests)
+
+	wantMeta := map[string]any{
+		"Timestamp": float64(1000),
+		"CloudWatchMetrics": []any{map[string]any{
+			"Namespace":  "Ping",
+			"Dimensions": []any{[]any{"route", "service"}},
+			"Metrics":    []any{map[string]any{"Name": "http_requests_total", "Unit": "Count"}},
+		}},
+	}
+	if !reflect.DeepEqual(requests["_aws"], wantMeta) {
+		t.Errorf("Unexpected metadata %v", requests["_aws"])
+	}
+	if requests["http_requests_total"] != float64(3) || requests["route"] != "/health" || requests["service"] != "ping" {
+		t.Errorf("Unexpected counter line %v", requests)
+	}
+	wantDist := map[string]any{"Values": []any{0.1, float64(1), float64(1)}, "Counts": []any{float64(1), float64(1), float64(1)}}
+	if !reflect.DeepEqual(latency["http_request_duration_seconds"], wantDist) {
+		t.Errorf("Unexpected distribution %v", latency["http_request_duration_seconds"])
+	}
+
+	// Unchanged series are skipped; only new observations are sent
+	out.Reset()
+	counter.WithLabelValues("/health").Inc()
+	families, _ = reg.Gather()
+	if err := exp.Export(context.Background(), families); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if got := strings.TrimSpace(out.String()); strings.Count(got, "\n") != 0 || !strings.Contains(got, `"http_requests_total":1`) {
+		t.Errorf("Expected only the counter increase, got:\n%s", got)
+	}
+}
@@ -0,0 +1,119 @@
+package metricsexport
+
+import (
+	"bufio"
+	"context"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// GraphiteConfig configures the Graphite exporter.
+type GraphiteConfig struct {
+	// Addr is the Carbon plaintext receiver's TCP host:port, e.g.
+	// carbon:2003.
+	Addr string
+	// Prefix is prepended to every metric path, e.g. "services.ping.".
+	Prefix string
+	// Tagged sends labels as Graphite 1.1 tags (path;name=value). Without
+	// it label values are appended to the path as segments.
+	Tagged bool
+}
+
+// GraphiteExporter writes snapshots to Carbon in the plaintext protocol,
+// one "path value timestamp" line per value. Counters are sent as their
+// running totals, to be graphed with nonNegativeDerivative. Histograms send
+// path.count, path.sum and path.bucket.le_<bound>; summaries path.count,
+// path.sum and path.quantile_<q>.
+type GraphiteExporter struct {
+	cfg GraphiteConfig
+	now func() time.Time
+}
+
+// NewGraphiteExporter returns an exporter for a Carbon receiver. A
+// connection is opened for each export.
+func NewGraphiteExporter(cfg GraphiteConfig) *GraphiteExporter {
+	return &GraphiteExporter{cfg: cfg, now: time.Now}
+}
+
+// segment makes s a single path segment.
+func segment(s string) string {
+	return strings.ReplaceAll(sanitize(s), ".", "_")
+}
+
+func (e *GraphiteExporter) line(path string, labels []*dto.LabelPair, value float64, ts string) string {
+	var b strings.Builder
+	b.WriteString(e.cfg.Prefix)
+	b.WriteString(path)
+	for _, l := range labels {
+		if e.cfg.Tagged {
+			b.WriteString(";" + segment(l.GetName()) + "=" + segment(l.GetValue()))
+		} else {
+			b.WriteString("." + segment(l.GetValue()))
+		}
+	}
+	b.WriteString(" " + formatFloat(value) + " " + ts + "\n")
+	return b.String()
+}
+
+// lines converts a snapshot taken at ts.
+func (e *GraphiteExporter) lines(families []*dto.MetricFamily, ts string) []string {
+	var out []string
+	for _, f := range families {
+		name := segment(f.GetName())
+		for _, m := range f.GetMetric() {
+			labels := m.GetLabel()
+			switch f.GetType() {
+			case dto.MetricType_COUNTER:
+				out = append(out, e.line(name, labels, m.GetCounter().GetValue(), ts))
+			case dto.MetricType_GAUGE:
+				out = append(out, e.line(name, labels, m.GetGauge().GetValue(), ts))
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				out = append(out,
+					e.line(name+".count", labels, float64(h.GetSampleCount()), ts),
+					e.line(name+".sum", labels, h.GetSampleSum(), ts))
+				for _, b := range h.GetBucket() {
+					if !math.IsInf(b.GetUpperBound(), 1) {
+						out = append(out, e.line(name+".bucket.le_"+segment(formatFloat(b.GetUpperBound())), labels, float64(b.GetCumulativeCount()), ts))
+					}
+				}
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				out = append(out,
+					e.line(name+".count", labels, float64(s.GetSampleCount()), ts),
+					e.line(name+".sum", labels, s.GetSampleSum(), ts))
+				for _, q := range s.GetQuantile() {
+					out = append(out, e.line(name+".quantile_"+segment(formatFloat(q.GetQuantile())), labels, q.GetValue(), ts))
+				}
+			default:
+				out = append(out, e.line(name, labels, m.GetUntyped().GetValue(), ts))
+			}
+		}
+	}
+	return out
+}
+
+// Export implements Exporter.
+func (e *GraphiteExporter) Export(ctx context.Context, families []*dto.MetricFamily) error {
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", e.cfg.Addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetWriteDeadline(deadline)
+	}
+
+	w := bufio.NewWriter(conn)
+	for _, l := range e.lines(families, strconv.FormatInt(e.now().Unix(), 10)) {
+		if _, err := w.WriteString(l); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
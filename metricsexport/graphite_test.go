@@ -0,0 +1,81 @@
+package metricsexport
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestGraphiteExporter(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	received := make(chan string, 2)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			b, _ := io.ReadAll(conn)
+			conn.Close()
+			received <- string(b)
+		}
+	}()
+
+	reg := prometheus.NewRegistry()
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "requests_total"}, []string{"route"})
+	hist := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "latency_seconds", Buckets: []float64{0.5}})
+	reg.MustRegister(counter, hist)
+	counter.WithLabelValues("/v1.0/health").Add(3)
+	hist.Observe(0.25)
+	families, _ := reg.Gather()
+
+	for _, tc := range []struct {
+		tagged bool
+		want   string
+	}{
+		{false, "ping.latency_seconds.count 1 1000\n" +
+			"ping.latency_seconds.sum 0.25 1000\n" +
+			"ping.latency_seconds.bucket.le_0_5 1 1000\n" +
+			"ping.requests_total._v1_0_health 3 1000\n"},
+		{true, "ping.latency_seconds.count 1 1000\n" +
+			"ping.latency_seconds.sum 0.25 1000\n" +
+			"ping.latency_seconds.bucket.le_0_5 1 1000\n" +
+			"ping.requests_total;route=_v1_0_health 3 1000\n"},
+	} {
+		exp := NewGraphiteExporter(GraphiteConfig{Addr: ln.Addr().String(), Prefix: "ping.", Tagged: tc.tagged})
+		exp.now = func() time.Time { return time.Unix(1000, 0) }
+		if err := exp.Export(context.Background(), families); err != nil {
+			t.Fatalf("Export failed: %v", err)
+		}
+		select {
+		case got := <-received:
+			if got != tc.want {
+				t.Errorf("Tagged=%v: expected:\n%s\ngot:\n%s", tc.tagged, tc.want, got)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("Nothing received")
+		}
+	}
+}
+
+func TestGraphiteExporterUnreachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	err = NewGraphiteExporter(GraphiteConfig{Addr: addr}).Export(context.Background(), nil)
+	if err == nil {
+		t.Errorf("Expected a connection error, got %v", err)
+	}
+}
@@ -0,0 +1,273 @@
+package metricsexport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// OTLPConfig configures the OTLP/HTTP metrics exporter.
+type OTLPConfig struct {
+	// Endpoint is the collector URL, e.g. http://otel-collector:4318/v1/metrics.
+	Endpoint string
+	// ServiceName and ServiceVersion become resource attributes.
+	ServiceName    string
+	ServiceVersion string
+	// ResourceAttributes are further resource attributes, e.g.
+	// service.instance.id or deployment.environment, so the OTel side can
+	// tell replicas apart as Prometheus does with the instance label.
+	ResourceAttributes map[string]string
+	// Headers are sent with every export, e.g. the API key of a hosted
+	// collector.
+	Headers map[string]string
+	// Client sends the exports. Defaults to a client with a 10s timeout.
+	Client *http.Client
+}
+
+// OTLPExporter converts Prometheus snapshots to OTLP/HTTP JSON: counters
+// become cumulative monotonic sums, histograms keep their bucket bounds,
+// and names and labels are kept as-is so both pipelines show the same
+// series.
+type OTLPExporter struct {
+	cfg   OTLPConfig
+	start time.Time
+	now   func() time.Time
+}
+
+// NewOTLPExporter returns an exporter for an OTLP/HTTP metrics endpoint.
+func NewOTLPExporter(cfg OTLPConfig) *OTLPExporter {
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &OTLPExporter{cfg: cfg, start: time.Now(), now: time.Now}
+}
+
+// OTLP aggregation temporality, from the metrics proto
+const otlpCumulative = 2
+
+type otlpAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+type otlpNumberPoint struct {
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	TimeUnixNano      string          `json:"timeUnixNano"`
+	AsDouble          float64         `json:"asDouble"`
+}
+
+type otlpHistogramPoint struct {
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	TimeUnixNano      string          `json:"timeUnixNano"`
+	Count             string          `json:"count"`
+	Sum               float64         `json:"sum"`
+	BucketCounts      []string        `json:"bucketCounts"`
+	ExplicitBounds    []float64       `json:"explicitBounds"`
+}
+
+type otlpQuantile struct {
+	Quantile float64 `json:"quantile"`
+	Value    float64 `json:"value"`
+}
+
+type otlpSummaryPoint struct {
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	TimeUnixNano      string          `json:"timeUnixNano"`
+	Count             string          `json:"count"`
+	Sum               float64         `json:"sum"`
+	QuantileValues    []otlpQuantile  `json:"quantileValues"`
+}
+
+type otlpSum struct {
+	DataPoints             []otlpNumberPoint `json:"dataPoints"`
+	AggregationTemporality int               `json:"aggregationTemporality"`
+	IsMonotonic            bool              `json:"isMonotonic"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpNumberPoint `json:"dataPoints"`
+}
+
+type otlpHistogram struct {
+	DataPoints             []otlpHistogramPoint `json:"dataPoints"`
+	AggregationTemporality int                  `json:"aggregationTemporality"`
+}
+
+type otlpSummary struct {
+	DataPoints []otlpSummaryPoint `json:"dataPoints"`
+}
+
+type otlpMetric struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Sum         *otlpSum       `json:"sum,omitempty"`
+	Gauge       *otlpGauge     `json:"gauge,omitempty"`
+	Histogram   *otlpHistogram `json:"histogram,omitempty"`
+	Summary     *otlpSummary   `json:"summary,omitempty"`
+}
+
+type otlpScopeMetrics struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+func attr(key, value string) otlpAttribute {
+	var a otlpAttribute
+	a.Key = key
+	a.Value.StringValue = value
+	return a
+}
+
+func labels(m *dto.Metric) []otlpAttribute {
+	attrs := make([]otlpAttribute, 0, len(m.GetLabel()))
+	for _, l := range m.GetLabel() {
+		attrs = append(attrs, attr(l.GetName(), l.GetValue()))
+	}
+	return attrs
+}
+
+func nanos(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func count(n uint64) string {
+	return strconv.FormatUint(n, 10)
+}
+
+// convert maps one Prometheus family to an OTLP metric.
+func (e *OTLPExporter) convert(f *dto.MetricFamily, now time.Time) otlpMetric {
+	out := otlpMetric{Name: f.GetName(), Description: f.GetHelp()}
+	start, ts := nanos(e.start), nanos(now)
+	switch f.GetType() {
+	case dto.MetricType_COUNTER:
+		out.Sum = &otlpSum{AggregationTemporality: otlpCumulative, IsMonotonic: true}
+		for _, m := range f.GetMetric() {
+			out.Sum.DataPoints = append(out.Sum.DataPoints, otlpNumberPoint{labels(m), start, ts, m.GetCounter().GetValue()})
+		}
+	case dto.MetricType_HISTOGRAM:
+		out.Histogram = &otlpHistogram{AggregationTemporality: otlpCumulative}
+		for _, m := range f.GetMetric() {
+			h := m.GetHistogram()
+			p := otlpHistogramPoint{
+				Attributes:        labels(m),
+				StartTimeUnixNano: start,
+				TimeUnixNano:      ts,
+				Count:             count(h.GetSampleCount()),
+				Sum:               h.GetSampleSum(),
+			}
+			// Prometheus buckets are cumulative, OTLP ones are not
+			var previous uint64
+			for _, b := range h.GetBucket() {
+				if math.IsInf(b.GetUpperBound(), 1) {
+					continue
+				}
+				p.ExplicitBounds = append(p.ExplicitBounds, b.GetUpperBound())
+				p.BucketCounts = append(p.BucketCounts, count(b.GetCumulativeCount()-previous))
+				previous = b.GetCumulativeCount()
+			}
+			p.BucketCounts = append(p.BucketCounts, count(h.GetSampleCount()-previous))
+			out.Histogram.DataPoints = append(out.Histogram.DataPoints, p)
+		}
+	case dto.MetricType_SUMMARY:
+		out.Summary = &otlpSummary{}
+		for _, m := range f.GetMetric() {
+			s := m.GetSummary()
+			p := otlpSummaryPoint{
+				Attributes:        labels(m),
+				StartTimeUnixNano: start,
+				TimeUnixNano:      ts,
+				Count:             count(s.GetSampleCount()),
+				Sum:               s.GetSampleSum(),
+			}
+			for _, q := range s.GetQuantile() {
+				p.QuantileValues = append(p.QuantileValues, otlpQuantile{q.GetQuantile(), q.GetValue()})
+			}
+			out.Summary.DataPoints = append(out.Summary.DataPoints, p)
+		}
+	default:
+		// Gauges and untyped values
+		out.Gauge = &otlpGauge{}
+		for _, m := range f.GetMetric() {
+			v := m.GetGauge().GetValue()
+			if m.Untyped != nil {
+				v = m.GetUntyped().GetValue()
+			}
+			out.Gauge.DataPoints = append(out.Gauge.DataPoints, otlpNumberPoint{labels(m), start, ts, v})
+		}
+	}
+	return out
+}
+
+// Export implements Exporter.
+func (e *OTLPExporter) Export(ctx context.Context, families []*dto.MetricFamily) error {
+	now := e.now()
+	var rm otlpResourceMetrics
+	rm.Resource.Attributes = []otlpAttribute{attr("service.name", e.cfg.ServiceName)}
+	if e.cfg.ServiceVersion != "" {
+		rm.Resource.Attributes = append(rm.Resource.Attributes, attr("service.version", e.cfg.ServiceVersion))
+	}
+	keys := make([]string, 0, len(e.cfg.ResourceAttributes))
+	for k := range e.cfg.ResourceAttributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		rm.Resource.Attributes = append(rm.Resource.Attributes, attr(k, e.cfg.ResourceAttributes[k]))
+	}
+	var sm otlpScopeMetrics
+	sm.Scope.Name = "ping"
+	for _, f := range families {
+		sm.Metrics = append(sm.Metrics, e.convert(f, now))
+	}
+	rm.ScopeMetrics = []otlpScopeMetrics{sm}
+
+	body, err := json.Marshal(otlpRequest{ResourceMetrics: []otlpResourceMetrics{rm}})
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, e.cfg.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, value := range e.cfg.Headers {
+		httpReq.Header.Set(name, value)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	resp, err := e.cfg.Client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("collector %s answered %s", e.cfg.Endpoint, resp.Status)
+	}
+	return nil
+}
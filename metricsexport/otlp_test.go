@@ -0,0 +1,123 @@
+package metricsexport
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestOTLPExporterConvertsFamilies(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "requests_total", Help: "Requests"}, []string{"code"})
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "in_flight"})
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "latency_seconds", Buckets: []float64{0.1, 1}})
+	summary := prometheus.NewSummary(prometheus.SummaryOpts{Name: "size_bytes", Objectives: map[float64]float64{0.5: 0.05}})
+	reg.MustRegister(counter, gauge, histogram, summary)
+	counter.WithLabelValues("200").Add(3)
+	gauge.Set(2)
+	for _, v := range []float64{0.05, 0.5, 0.7, 5} {
+		histogram.Observe(v)
+	}
+	summary.Observe(10)
+	families, _ := reg.Gather()
+
+	var body []byte
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer collector.Close()
+
+	exp := NewOTLPExporter(OTLPConfig{Endpoint: collector.URL, ServiceName: "ping"})
+	exp.start = time.Unix(1700000000, 0)
+	exp.now = func() time.Time { return time.Unix(1700000060, 0) }
+	if err := exp.Export(context.Background(), families); err != nil {
+		t.Fatal(err)
+	}
+
+	var req otlpRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		t.Fatalf("Invalid OTLP JSON %s: %v", body, err)
+	}
+	byName := map[string]otlpMetric{}
+	for _, m := range req.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		byName[m.Name] = m
+	}
+
+	sum := byName["requests_total"].Sum
+	if sum == nil || !sum.IsMonotonic || sum.AggregationTemporality != otlpCumulative || sum.DataPoints[0].AsDouble != 3 {
+		t.Errorf("Unexpected counter conversion %+v", sum)
+	}
+	if a := sum.DataPoints[0].Attributes[0]; a.Key != "code" || a.Value.StringValue != "200" {
+		t.Errorf("Labels should become attributes, got %+v", a)
+	}
+	if sum.DataPoints[0].StartTimeUnixNano != "1700000000000000000" || sum.DataPoints[0].TimeUnixNano != "1700000060000000000" {
+		t.Errorf("Unexpected timestamps %+v", sum.DataPoints[0])
+	}
+	if g := byName["in_flight"].Gauge; g == nil || g.DataPoints[0].AsDouble != 2 {
+		t.Errorf("Unexpected gauge conversion %+v", g)
+	}
+	h := byName["latency_seconds"].Histogram.DataPoints[0]
+	if h.Count != "4" || len(h.ExplicitBounds) != 2 {
+		t.Errorf("Unexpected histogram %+v", h)
+	}
+	want := []string{"1", "2", "1"}
+	for i := range want {
+		if h.BucketCounts[i] != want[i] {
+			t.Errorf("Expected per-bucket counts %v, got %v", want, h.BucketCounts)
+			break
+		}
+	}
+	if s := byName["size_bytes"].Summary; s == nil || s.DataPoints[0].QuantileValues[0].Value != 10 {
+		t.Errorf("Unexpected summary %+v", s)
+	}
+}
+
+func TestOTLPExporterReportsRejection(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer collector.Close()
+
+	if err := NewOTLPExporter(OTLPConfig{Endpoint: collector.URL}).Export(context.Background(), nil); err == nil {
+		t.Error("Expected an error for a 400 answer")
+	}
+}
+
+func TestOTLPExporterHeadersAndResource(t *testing.T) {
+	var header http.Header
+	var req otlpRequest
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		json.NewDecoder(r.Body).Decode(&req)
+	}))
+	defer collector.Close()
+
+	exp := NewOTLPExporter(OTLPConfig{
+		Endpoint:           collector.URL,
+		ServiceName:        "ping",
+		ResourceAttributes: map[string]string{"service.instance.id": "pod-1", "deployment.environment": "prod"},
+		Headers:            map[string]string{"Authorization": "Bearer key"},
+	})
+	if err := exp.Export(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if header.Get("Authorization") != "Bearer key" || header.Get("Content-Type") != "application/json" {
+		t.Errorf("Unexpected headers %v", header)
+	}
+	var got []string
+	for _, a := range req.ResourceMetrics[0].Resource.Attributes {
+		got = append(got, a.Key+"="+a.Value.StringValue)
+	}
+	want := []string{"service.name=ping", "deployment.environment=prod", "service.instance.id=pod-1"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected resource attributes %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,124 @@
+// Package metricsexport pushes snapshots of the Prometheus registry to
+// backends that do not scrape /metrics. Collectors keep being recorded
+// through the observability package; a Pusher gathers them on an interval
+// and hands them to an Exporter, e.g. an OTLP collector.
+package metricsexport
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"ping/observability"
+)
+
+// Exporter sends one snapshot of metric families to a backend.
+type Exporter interface {
+	Export(ctx context.Context, families []*dto.MetricFamily) error
+}
+
+// PusherConfig configures periodic export.
+type PusherConfig struct {
+	// Name labels this pusher in metrics_exports_total, e.g. "otlp".
+	Name string
+	// Exporter receives each snapshot. Required.
+	Exporter Exporter
+	// Gatherer is read on every push. Defaults to prometheus.DefaultGatherer.
+	Gatherer prometheus.Gatherer
+	// Interval between pushes. Defaults to 15s.
+	Interval time.Duration
+	// Timeout bounds each push. Defaults to 10s.
+	Timeout time.Duration
+	// Metrics counts push outcomes. Defaults to observability.GetMetrics().
+	Metrics *observability.Metrics
+}
+
+// Pusher exports the registry in the background until Shutdown.
+type Pusher struct {
+	cfg  PusherConfig
+	stop chan struct{}
+	done chan struct{}
+	up   atomic.Bool
+}
+
+// NewPusher starts pushing immediately and then every Interval.
+func NewPusher(cfg PusherConfig) *Pusher {
+	if cfg.Gatherer == nil {
+		cfg.Gatherer = prometheus.DefaultGatherer
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 15 * time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.Metrics == nil {
+		cfg.Metrics = observability.GetMetrics()
+	}
+	p := &Pusher{cfg: cfg, stop: make(chan struct{}), done: make(chan struct{})}
+	go p.run()
+	return p
+}
+
+func (p *Pusher) run() {
+	defer close(p.done)
+	ticker := time.NewTicker(p.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		p.Push(context.Background())
+		select {
+		case <-ticker.C:
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// Push gathers and exports one snapshot now.
+func (p *Pusher) Push(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.Timeout)
+	defer cancel()
+	metrics := p.cfg.Metrics
+
+	families, err := p.cfg.Gatherer.Gather()
+	if err == nil {
+		err = p.cfg.Exporter.Export(ctx, families)
+	}
+	p.up.Store(err == nil)
+	if err != nil {
+		metrics.MetricsExportCounter.WithLabelValues(p.cfg.Name, "error").Inc()
+		observability.DefaultLogger.Warnf(ctx, "%s metrics export failed: %v", p.cfg.Name, err)
+		return err
+	}
+	metrics.MetricsExportCounter.WithLabelValues(p.cfg.Name, "success").Inc()
+	return nil
+}
+
+// Name returns the name the pusher was configured with.
+func (p *Pusher) Name() string {
+	return p.cfg.Name
+}
+
+// Up reports whether the last push succeeded.
+func (p *Pusher) Up() bool {
+	return p.up.Load()
+}
+
+// Shutdown stops the interval and pushes a final snapshot, so the last
+// increments before exit are not lost.
+func (p *Pusher) Shutdown(ctx context.Context) error {
+	select {
+	case <-p.stop:
+	default:
+		close(p.stop)
+	}
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return p.Push(ctx)
+}
@@ -0,0 +1,100 @@
+package metricsexport
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+
+	"ping/observability"
+)
+
+// recordingExporter keeps the snapshots it receives.
+type recordingExporter struct {
+	mu        sync.Mutex
+	snapshots [][]*dto.MetricFamily
+	err       error
+}
+
+func (r *recordingExporter) Export(ctx context.Context, families []*dto.MetricFamily) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.snapshots = append(r.snapshots, families)
+	return r.err
+}
+
+func (r *recordingExporter) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.snapshots)
+}
+
+func TestPusherPushesOnStartAndShutdown(t *testing.T) {
+	m := observability.NewMetrics(observability.MetricsOptions{})
+	reg := prometheus.NewRegistry()
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "pushed_total"})
+	reg.MustRegister(counter)
+	exp := &recordingExporter{}
+
+	pusher := NewPusher(PusherConfig{Name: "test", Exporter: exp, Gatherer: reg, Interval: time.Hour, Metrics: m})
+	deadline := time.Now().Add(2 * time.Second)
+	for exp.count() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	counter.Inc()
+	if err := pusher.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if exp.count() != 2 {
+		t.Fatalf("Expected an initial and a final push, got %d", exp.count())
+	}
+	last := exp.snapshots[1][0]
+	if last.GetName() != "pushed_total" || last.GetMetric()[0].GetCounter().GetValue() != 1 {
+		t.Errorf("Final push should include the last increment, got %v", last)
+	}
+	success := m.MetricsExportCounter.WithLabelValues("test", "success")
+	if testutil.ToFloat64(success) < 2 {
+		t.Errorf("Expected successes counted, got %v", testutil.ToFloat64(success))
+	}
+}
+
+func TestPusherCountsErrors(t *testing.T) {
+	m := observability.NewMetrics(observability.MetricsOptions{})
+	errs := m.MetricsExportCounter.WithLabelValues("failing", "error")
+
+	pusher := &Pusher{cfg: PusherConfig{Name: "failing", Exporter: &recordingExporter{err: errors.New("down")}, Gatherer: prometheus.NewRegistry(), Timeout: time.Second, Metrics: m}}
+	if err := pusher.Push(context.Background()); err == nil {
+		t.Error("Expected the exporter error")
+	}
+	if testutil.ToFloat64(errs) != 1 {
+		t.Error("Expected the failure to be counted")
+	}
+	if pusher.Up() {
+		t.Error("Expected a failed push to report the target down")
+	}
+}
+
+func TestPusherUpAfterSuccess(t *testing.T) {
+	m := observability.NewMetrics(observability.MetricsOptions{})
+	exp := &recordingExporter{}
+	pusher := &Pusher{cfg: PusherConfig{Name: "up", Exporter: exp, Gatherer: prometheus.NewRegistry(), Timeout: time.Second, Metrics: m}}
+
+	if pusher.Up() {
+		t.Error("Expected no push yet to report the target down")
+	}
+	pusher.Push(context.Background())
+	if !pusher.Up() || pusher.Name() != "up" {
+		t.Errorf("Expected %q up after a successful push", pusher.Name())
+	}
+	exp.err = errors.New("down")
+	pusher.Push(context.Background())
+	if pusher.Up() {
+		t.Error("Expected the target down after a failed push")
+	}
+}
@@ -0,0 +1,50 @@
+package metricsexport
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// PushgatewayConfig configures the Pushgateway exporter.
+type PushgatewayConfig struct {
+	// URL is the Pushgateway base URL, e.g. http://pushgateway:9091.
+	URL string
+	// Job is the job label of the pushed group, usually the service name.
+	Job string
+	// Grouping adds labels to the group key, e.g. instance, so replicas
+	// do not overwrite each other.
+	Grouping map[string]string
+	// Client sends the pushes. Defaults to a client with a 10s timeout.
+	Client *http.Client
+}
+
+// PushgatewayExporter replaces its group on a Prometheus Pushgateway with
+// every snapshot, for deployments that are too short-lived or too well
+// firewalled to be scraped.
+type PushgatewayExporter struct {
+	cfg PushgatewayConfig
+}
+
+// NewPushgatewayExporter returns an exporter for a Pushgateway.
+func NewPushgatewayExporter(cfg PushgatewayConfig) *PushgatewayExporter {
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &PushgatewayExporter{cfg: cfg}
+}
+
+// Export implements Exporter.
+func (e *PushgatewayExporter) Export(ctx context.Context, families []*dto.MetricFamily) error {
+	p := push.New(e.cfg.URL, e.cfg.Job).
+		Client(e.cfg.Client).
+		Gatherer(prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) { return families, nil }))
+	for name, value := range e.cfg.Grouping {
+		p = p.Grouping(name, value)
+	}
+	return p.PushContext(ctx)
+}
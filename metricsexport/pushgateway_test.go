@@ -0,0 +1,51 @@
+package metricsexport
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestPushgatewayExporter(t *testing.T) {
+	var method, path string
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	reg := prometheus.NewRegistry()
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "pushed_total"})
+	reg.MustRegister(counter)
+	counter.Inc()
+	families, _ := reg.Gather()
+
+	exp := NewPushgatewayExporter(PushgatewayConfig{URL: srv.URL, Job: "ping", Grouping: map[string]string{"instance": "host-1"}})
+	if err := exp.Export(context.Background(), families); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	// PUT replaces the whole group, so metrics that disappear are dropped
+	if method != http.MethodPut || path != "/metrics/job/ping/instance/host-1" {
+		t.Errorf("Expected PUT to the group, got %s %s", method, path)
+	}
+	if len(body) == 0 {
+		t.Error("Expected the snapshot in the body")
+	}
+}
+
+func TestPushgatewayExporterError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	exp := NewPushgatewayExporter(PushgatewayConfig{URL: srv.URL, Job: "ping"})
+	if err := exp.Export(context.Background(), nil); err == nil {
+		t.Error("Expected an error for a rejected push")
+	}
+}
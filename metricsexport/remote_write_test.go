@@ -0,0 +1,135 @@
+package metricsexport
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// decodeWriteRequest renders each series of a WriteRequest as
+// "name{k=v,...} value@timestamp".
+func decodeWriteRequest(t *testing.T, b []byte) []string {
+	t.Helper()
+	fields := func(b []byte, each func(num protowire.Number, v []byte, x uint64)) {
+		for len(b) > 0 {
+			num, typ, n := protowire.ConsumeTag(b)
+			b = b[n:]
+			switch typ {
+			case protowire.BytesType:
+				v, n := protowire.ConsumeBytes(b)
+				each(num, v, 0)
+				b = b[n:]
+			case protowire.Fixed64Type:
+				x, n := protowire.ConsumeFixed64(b)
+				each(num, nil, x)
+				b = b[n:]
+			case protowire.VarintType:
+				x, n := protowire.ConsumeVarint(b)
+				each(num, nil, x)
+				b = b[n:]
+			default:
+				t.Fatalf("Unexpected wire type %v", typ)
+			}
+		}
+	}
+
+	var out []string
+	fields(b, func(_ protowire.Number, ts []byte, _ uint64) {
+		var name, sample string
+		var labels []string
+		fields(ts, func(num protowire.Number, v []byte, _ uint64) {
+			if num == 1 {
+				var k, val string
+				fields(v, func(num protowire.Number, s []byte, _ uint64) {
+					if num == 1 {
+						k = string(s)
+					} else {
+						val = string(s)
+					}
+				})
+				if k == "__name__" {
+					name = val
+				} else {
+					labels = append(labels, k+"="+val)
+				}
+				return
+			}
+			var value float64
+			var timestamp uint64
+			fields(v, func(num protowire.Number, _ []byte, x uint64) {
+				if num == 1 {
+					value = math.Float64frombits(x)
+				} else {
+					timestamp = x
+				}
+			})
+			sample = formatFloat(value) + "@" + formatFloat(float64(timestamp))
+		})
+		out = append(out, name+"{"+strings.Join(labels, ",")+"} "+sample)
+	})
+	return out
+}
+
+func TestRemoteWriteExporter(t *testing.T) {
+	var headers http.Header
+	var series []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+		compressed, _ := io.ReadAll(r.Body)
+		body, err := snappy.Decode(nil, compressed)
+		if err != nil {
+			t.Errorf("Body is not snappy-compressed: %v", err)
+		}
+		series = decodeWriteRequest(t, body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	reg := prometheus.NewRegistry()
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "requests_total"}, []string{"code"})
+	hist := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "latency_seconds", Buckets: []float64{0.5}})
+	reg.MustRegister(counter, hist)
+	counter.WithLabelValues("200").Add(3)
+	hist.Observe(0.25)
+	families, _ := reg.Gather()
+
+	exp := NewRemoteWriteExporter(RemoteWriteConfig{URL: srv.URL, Labels: map[string]string{"job": "ping"}})
+	exp.now = func() time.Time { return time.UnixMilli(1000) }
+	if err := exp.Export(context.Background(), families); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+
+	if headers.Get("Content-Encoding") != "snappy" || headers.Get("Content-Type") != "application/x-protobuf" {
+		t.Errorf("Unexpected headers %v", headers)
+	}
+	want := []string{
+		"latency_seconds_bucket{job=ping,le=0.5} 1@1000",
+		"latency_seconds_bucket{job=ping,le=+Inf} 1@1000",
+		"latency_seconds_sum{job=ping} 0.25@1000",
+		"latency_seconds_count{job=ping} 1@1000",
+		"requests_total{code=200,job=ping} 3@1000",
+	}
+	if strings.Join(series, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected series:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(series, "\n"))
+	}
+}
+
+func TestRemoteWriteExporterError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	if err := NewRemoteWriteExporter(RemoteWriteConfig{URL: srv.URL}).Export(context.Background(), nil); err == nil {
+		t.Error("Expected an error for a rejected write")
+	}
+}
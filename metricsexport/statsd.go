@@ -0,0 +1,176 @@
+package metricsexport
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// StatsDConfig configures the StatsD exporter.
+type StatsDConfig struct {
+	// Addr is the agent's UDP host:port, e.g. localhost:8125.
+	Addr string
+	// Prefix is prepended to every metric name, e.g. "ping.".
+	Prefix string
+	// DogStatsD sends labels as DogStatsD tags (|#name:value). Plain StatsD
+	// has no tags, so label values are appended to the metric name instead.
+	DogStatsD bool
+	// Tags are added to every DogStatsD metric, e.g. "env:prod".
+	Tags []string
+	// MaxPacketSize bounds each UDP datagram. Defaults to 1432 bytes, which
+	// fits a typical MTU.
+	MaxPacketSize int
+}
+
+// StatsDExporter sends snapshots to a StatsD or DogStatsD agent, such as
+// the Datadog agent. Counters are sent as the increase since the previous
+// snapshot (|c), gauges as is (|g). Histograms and summaries send the
+// increase of their count and sum as name.count and name.sum counters, and,
+// for *_seconds metrics, the mean over the interval in milliseconds as a
+// timing (|ms); summary quantiles are sent as name.quantile_0_99 gauges.
+type StatsDExporter struct {
+	cfg StatsDConfig
+
+	mu     sync.Mutex
+	conn   net.Conn
+	totals deltas
+}
+
+// NewStatsDExporter returns an exporter for a StatsD agent. The UDP socket
+// is opened on the first export.
+func NewStatsDExporter(cfg StatsDConfig) *StatsDExporter {
+	if cfg.MaxPacketSize <= 0 {
+		cfg.MaxPacketSize = 1432
+	}
+	return &StatsDExporter{cfg: cfg, totals: deltas{}}
+}
+
+// sanitize keeps names and tag values within the StatsD character set.
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-', r == '.':
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// line formats one metric for the configured flavor.
+func (e *StatsDExporter) line(name string, labels []*dto.LabelPair, value, kind string) string {
+	var b strings.Builder
+	b.WriteString(e.cfg.Prefix)
+	b.WriteString(sanitize(name))
+	if !e.cfg.DogStatsD {
+		for _, l := range labels {
+			b.WriteByte('.')
+			b.WriteString(sanitize(l.GetValue()))
+		}
+	}
+	b.WriteByte(':')
+	b.WriteString(value)
+	b.WriteByte('|')
+	b.WriteString(kind)
+	if e.cfg.DogStatsD && len(labels)+len(e.cfg.Tags) > 0 {
+		tags := make([]string, 0, len(labels)+len(e.cfg.Tags))
+		for _, l := range labels {
+			tags = append(tags, sanitize(l.GetName())+":"+sanitize(l.GetValue()))
+		}
+		tags = append(tags, e.cfg.Tags...)
+		b.WriteString("|#")
+		b.WriteString(strings.Join(tags, ","))
+	}
+	return b.String()
+}
+
+// lines converts a snapshot, updating the previous values for deltas.
+func (e *StatsDExporter) lines(families []*dto.MetricFamily) []string {
+	var out []string
+	for _, f := range families {
+		name := f.GetName()
+		for _, m := range f.GetMetric() {
+			labels := m.GetLabel()
+			key := name + labelKey(labels)
+			switch f.GetType() {
+			case dto.MetricType_COUNTER:
+				if d := e.totals.delta(key, m.GetCounter().GetValue()); d > 0 {
+					out = append(out, e.line(name, labels, formatFloat(d), "c"))
+				}
+			case dto.MetricType_HISTOGRAM, dto.MetricType_SUMMARY:
+				count, sum := float64(m.GetHistogram().GetSampleCount()), m.GetHistogram().GetSampleSum()
+				if f.GetType() == dto.MetricType_SUMMARY {
+					count, sum = float64(m.GetSummary().GetSampleCount()), m.GetSummary().GetSampleSum()
+					for _, q := range m.GetSummary().GetQuantile() {
+						qname := name + ".quantile_" + strings.ReplaceAll(formatFloat(q.GetQuantile()), ".", "_")
+						out = append(out, e.line(qname, labels, formatFloat(q.GetValue()), "g"))
+					}
+				}
+				dc, ds := e.totals.delta(key+"#count", count), e.totals.delta(key+"#sum", sum)
+				if dc == 0 {
+					continue
+				}
+				out = append(out,
+					e.line(name+".count", labels, formatFloat(dc), "c"),
+					e.line(name+".sum", labels, formatFloat(ds), "c"))
+				if strings.HasSuffix(name, "_seconds") {
+					out = append(out, e.line(name, labels, formatFloat(ds/dc*1000), "ms"))
+				}
+			case dto.MetricType_GAUGE:
+				out = append(out, e.line(name, labels, formatFloat(m.GetGauge().GetValue()), "g"))
+			default:
+				out = append(out, e.line(name, labels, formatFloat(m.GetUntyped().GetValue()), "g"))
+			}
+		}
+	}
+	return out
+}
+
+// labelKey identifies a series within its family.
+func labelKey(labels []*dto.LabelPair) string {
+	pairs := make([]string, 0, len(labels))
+	for _, l := range labels {
+		pairs = append(pairs, l.GetName()+"="+l.GetValue())
+	}
+	sort.Strings(pairs)
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Export implements Exporter. Lines are packed into datagrams of at most
+// MaxPacketSize bytes.
+func (e *StatsDExporter) Export(ctx context.Context, families []*dto.MetricFamily) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.conn == nil {
+		conn, err := (&net.Dialer{}).DialContext(ctx, "udp", e.cfg.Addr)
+		if err != nil {
+			return err
+		}
+		e.conn = conn
+	}
+
+	var packet []byte
+	flush := func() error {
+		if len(packet) == 0 {
+			return nil
+		}
+		_, err := e.conn.Write(packet)
+		packet = packet[:0]
+		return err
+	}
+	for _, l := range e.lines(families) {
+		if len(packet) > 0 && len(packet)+1+len(l) > e.cfg.MaxPacketSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		if len(packet) > 0 {
+			packet = append(packet, '\n')
+		}
+		packet = append(packet, l...)
+	}
+	return flush()
+}
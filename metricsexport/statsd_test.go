@@ -0,0 +1,120 @@
+package metricsexport
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// listenUDP returns a UDP socket and a function reading the lines of every
+// datagram received within a short wait.
+func listenUDP(t *testing.T) (net.PacketConn, func() []string) {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	return pc, func() []string {
+		var lines []string
+		buf := make([]byte, 65536)
+		for {
+			pc.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+			n, _, err := pc.ReadFrom(buf)
+			if err != nil {
+				return lines
+			}
+			lines = append(lines, strings.Split(string(buf[:n]), "\n")...)
+		}
+	}
+}
+
+func statsdFixture() (*prometheus.Registry, *prometheus.CounterVec, prometheus.Histogram) {
+	reg := prometheus.NewRegistry()
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "requests_total"}, []string{"route"})
+	hist := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "latency_seconds"})
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "active"})
+	reg.MustRegister(counter, hist, gauge)
+	gauge.Set(2)
+	return reg, counter, hist
+}
+
+func gather(t *testing.T, reg *prometheus.Registry) []*dto.MetricFamily {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return families
+}
+
+func TestStatsDExporterDogStatsD(t *testing.T) {
+	pc, read := listenUDP(t)
+	reg, counter, hist := statsdFixture()
+	exp := NewStatsDExporter(StatsDConfig{Addr: pc.LocalAddr().String(), Prefix: "ping.", DogStatsD: true, Tags: []string{"env:test"}})
+
+	counter.WithLabelValues("/health").Add(3)
+	hist.Observe(0.2)
+	hist.Observe(0.4)
+	if err := exp.Export(context.Background(), gather(t, reg)); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	want := []string{
+		"ping.active:2|g|#env:test",
+		"ping.latency_seconds.count:2|c|#env:test",
+		"ping.latency_seconds.sum:0.6000000000000001|c|#env:test",
+		"ping.latency_seconds:300.00000000000006|ms|#env:test",
+		"ping.requests_total:3|c|#route:_health,env:test",
+	}
+	if got := read(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+
+	// Only the increase since the last export is sent
+	counter.WithLabelValues("/health").Inc()
+	if err := exp.Export(context.Background(), gather(t, reg)); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	want = []string{"ping.active:2|g|#env:test", "ping.requests_total:1|c|#route:_health,env:test"}
+	if got := read(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestStatsDExporterPlain(t *testing.T) {
+	pc, read := listenUDP(t)
+	reg, counter, _ := statsdFixture()
+	exp := NewStatsDExporter(StatsDConfig{Addr: pc.LocalAddr().String(), Tags: []string{"env:test"}})
+
+	counter.WithLabelValues("/health").Inc()
+	if err := exp.Export(context.Background(), gather(t, reg)); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	want := []string{"active:2|g", "requests_total._health:1|c"}
+	if got := read(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestStatsDExporterSplitsPackets(t *testing.T) {
+	pc, read := listenUDP(t)
+	reg := prometheus.NewRegistry()
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "g"}, []string{"n"})
+	reg.MustRegister(gauge)
+	for _, n := range []string{"a", "b", "c", "d"} {
+		gauge.WithLabelValues(n).Set(1)
+	}
+
+	exp := NewStatsDExporter(StatsDConfig{Addr: pc.LocalAddr().String(), MaxPacketSize: 10})
+	if err := exp.Export(context.Background(), gather(t, reg)); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if got := read(); len(got) != 4 {
+		t.Errorf("Expected every line delivered, got %q", got)
+	}
+}
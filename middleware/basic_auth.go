@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+
+	"ping/observability"
+)
+
+// BasicAuthConfig holds the single set of credentials guarding operational
+// endpoints such as /metrics and /debug/*.
+type BasicAuthConfig struct {
+	Username string
+	Password string
+	// Realm is shown by browsers in the login prompt.
+	Realm string
+	// Metrics counts failures; nil uses observability.GetMetrics().
+	Metrics observability.MetricsRecorder
+}
+
+// NewBasicAuthMiddleware requires HTTP Basic credentials matching cfg.
+// Credentials are compared in constant time so response timing does not
+// reveal how much of a guess was right.
+func NewBasicAuthMiddleware(cfg BasicAuthConfig) func(http.Handler) http.Handler {
+	realm := cfg.Realm
+	if realm == "" {
+		realm = "restricted"
+	}
+	wantUser := sha256.Sum256([]byte(cfg.Username))
+	wantPass := sha256.Sum256([]byte(cfg.Password))
+	metrics := metricsOrDefault(cfg.Metrics)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, pass, ok := r.BasicAuth()
+			if ok {
+				gotUser := sha256.Sum256([]byte(user))
+				gotPass := sha256.Sum256([]byte(pass))
+				// Evaluate both comparisons so a wrong user costs the same as a wrong password
+				userOK := subtle.ConstantTimeCompare(gotUser[:], wantUser[:])
+				passOK := subtle.ConstantTimeCompare(gotPass[:], wantPass[:])
+				if userOK&passOK == 1 {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			reason := "invalid"
+			if !ok {
+				reason = "missing"
+			}
+			metrics.IncAuthFailures("basic", reason)
+			w.Header().Set("WWW-Authenticate", "Basic realm="+strconv.Quote(realm)+`, charset="UTF-8"`)
+			WriteJSONError(w, r, http.StatusUnauthorized, "authentication required")
+		})
+	}
+}
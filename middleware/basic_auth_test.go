@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ping/observability"
+)
+
+func TestBasicAuth(t *testing.T) {
+	observability.InitMetrics()
+	handler := NewBasicAuthMiddleware(BasicAuthConfig{
+		Username: "prometheus",
+		Password: "s3cret",
+		Realm:    "metrics",
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("metrics"))
+	}))
+
+	tests := []struct {
+		name       string
+		user, pass string
+		setAuth    bool
+		wantStatus int
+	}{
+		{"valid", "prometheus", "s3cret", true, http.StatusOK},
+		{"wrong password", "prometheus", "guess", true, http.StatusUnauthorized},
+		{"wrong user", "admin", "s3cret", true, http.StatusUnauthorized},
+		{"missing", "", "", false, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/metrics", nil)
+			if tt.setAuth {
+				req.SetBasicAuth(tt.user, tt.pass)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected %d, got %d", tt.wantStatus, w.Code)
+			}
+			if tt.wantStatus == http.StatusUnauthorized {
+				if got := w.Header().Get("WWW-Authenticate"); got != `Basic realm="metrics", charset="UTF-8"` {
+					t.Errorf("Unexpected challenge %q", got)
+				}
+				if w.Body.String() == "metrics" {
+					t.Error("Protected content leaked")
+				}
+			}
+		})
+	}
+}
+
+func TestBasicAuthUsesInjectedMetrics(t *testing.T) {
+	metrics := observability.NewMemoryRecorder()
+	handler := NewBasicAuthMiddleware(BasicAuthConfig{Username: "u", Password: "p", Metrics: metrics})(http.NotFoundHandler())
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/metrics", nil))
+
+	if got := metrics.Value("http_auth_failures_total", "basic", "missing"); got != 1 {
+		t.Errorf("Expected the failure counted in the injected metrics, got %v", got)
+	}
+}
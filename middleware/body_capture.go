@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// DefaultBodyCaptureHeader is the request header that opts a single request into body capture.
+const DefaultBodyCaptureHeader = "X-Debug-Capture"
+
+// BodyCaptureConfig enables logging of truncated request and response bodies
+// for debugging client-reported issues. Capture is off unless Routes is set
+// or a Token is configured for the magic header.
+type BodyCaptureConfig struct {
+	// Routes lists path prefixes whose bodies are always captured.
+	Routes []string
+	// Header is the request header that triggers capture when it carries Token.
+	Header string
+	// Token is the shared secret the Header must match; empty disables the header trigger.
+	Token string
+	// MaxBytes caps how much of each body is kept.
+	MaxBytes int
+}
+
+// enabled reports whether bodies of r should be captured.
+func (c BodyCaptureConfig) enabled(r *http.Request) bool {
+	if c.MaxBytes <= 0 {
+		return false
+	}
+	for _, prefix := range c.Routes {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return true
+		}
+	}
+	if c.Token == "" || c.Header == "" {
+		return false
+	}
+	got := r.Header.Get(c.Header)
+	return got != "" && subtle.ConstantTimeCompare([]byte(got), []byte(c.Token)) == 1
+}
+
+// captureBuffer keeps the first limit bytes written to it and remembers
+// whether anything was cut off.
+type captureBuffer struct {
+	limit     int
+	data      []byte
+	truncated bool
+}
+
+func (b *captureBuffer) Write(p []byte) (int, error) {
+	room := b.limit - len(b.data)
+	if room < len(p) {
+		b.truncated = true
+		if room < 0 {
+			room = 0
+		}
+		p = p[:room]
+	}
+	b.data = append(b.data, p...)
+	return len(p), nil
+}
+
+// String returns the captured bytes, marking truncated output.
+func (b *captureBuffer) String() string {
+	if b.truncated {
+		return string(b.data) + "...(truncated)"
+	}
+	return string(b.data)
+}
+
+// teeBody records what the handler reads from the request body.
+type teeBody struct {
+	io.ReadCloser
+	capture *captureBuffer
+}
+
+func (t *teeBody) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	if n > 0 {
+		t.capture.Write(p[:n])
+	}
+	return n, err
+}
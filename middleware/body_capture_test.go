@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ping/observability"
+)
+
+func TestBodyCaptureEnabled(t *testing.T) {
+	cfg := BodyCaptureConfig{
+		Routes:   []string{"/upload"},
+		Header:   DefaultBodyCaptureHeader,
+		Token:    "let-me-debug",
+		MaxBytes: 16,
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		header string
+		want   bool
+	}{
+		{"configured route", "/upload/csv", "", true},
+		{"other route", "/health", "", false},
+		{"valid header token", "/health", "let-me-debug", true},
+		{"wrong header token", "/health", "guess", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set(DefaultBodyCaptureHeader, tt.header)
+			}
+			if got := cfg.enabled(req); got != tt.want {
+				t.Errorf("enabled() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBodyCaptureHeaderIgnoredWithoutToken(t *testing.T) {
+	cfg := BodyCaptureConfig{Header: DefaultBodyCaptureHeader, MaxBytes: 16}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(DefaultBodyCaptureHeader, "")
+	if cfg.enabled(req) {
+		t.Error("Header trigger must stay off while no token is configured")
+	}
+}
+
+func TestCaptureBufferTruncates(t *testing.T) {
+	b := &captureBuffer{limit: 4}
+	b.Write([]byte("ab"))
+	b.Write([]byte("cdef"))
+	b.Write([]byte("gh"))
+
+	if got := b.String(); got != "abcd...(truncated)" {
+		t.Errorf("Expected truncated capture, got %q", got)
+	}
+}
+
+func TestMiddlewareLogsCapturedBodies(t *testing.T) {
+	observability.InitMetrics()
+	buf := captureLog(t)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write([]byte("echo:" + string(body)))
+	})
+	wrapped := NewRequestInstrumentationMiddleware(InstrumentationConfig{
+		BodyCapture: BodyCaptureConfig{Routes: []string{"/echo"}, MaxBytes: 64},
+	})(handler)
+
+	req := httptest.NewRequest("POST", "/echo", strings.NewReader("hello"))
+	req.Header.Set(observability.RequestIDHeader, "capture-id")
+	w := httptest.NewRecorder()
+	wrapped.ServeHTTP(w, req)
+
+	if w.Body.String() != "echo:hello" {
+		t.Fatalf("Capture must not alter the response, got %q", w.Body.String())
+	}
+	out := buf.String()
+	if !strings.Contains(out, `requestBody="hello"`) || !strings.Contains(out, `responseBody="echo:hello"`) {
+		t.Errorf("Expected captured bodies in log, got %q", out)
+	}
+	if !strings.Contains(out, "id=capture-id") {
+		t.Errorf("Expected correlation ID in capture log, got %q", out)
+	}
+}
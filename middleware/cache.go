@@ -0,0 +1,275 @@
+package middleware
+
+import (
+	"bytes"
+	"container/list"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ping/observability"
+)
+
+// CacheConfig configures in-memory response caching.
+type CacheConfig struct {
+	// Routes are the paths whose GET and HEAD responses may be cached.
+	// The built-in handlers all send Cache-Control: no-store, so in
+	// practice these are routes served by the reverse proxy.
+	Routes []string
+	// TTL is how long a cached response is served.
+	TTL time.Duration
+	// MaxEntries bounds the cache; the least recently used entry is
+	// evicted first.
+	MaxEntries int
+	// VaryHeaders are request headers that select distinct cache entries,
+	// e.g. Accept.
+	VaryHeaders []string
+	// MaxBodyBytes is the largest response body cached. Defaults to 1 MiB.
+	MaxBodyBytes int
+	// Metrics counts lookups and entries; nil uses
+	// observability.GetMetrics().
+	Metrics observability.MetricsRecorder
+}
+
+type cacheEntry struct {
+	key     string
+	status  int
+	header  http.Header
+	body    []byte
+	stored  time.Time
+	expires time.Time
+}
+
+// ResponseCache is a TTL + LRU store of complete responses.
+type ResponseCache struct {
+	cfg CacheConfig
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+// NewResponseCache returns an empty cache for cfg.
+func NewResponseCache(cfg CacheConfig) *ResponseCache {
+	if cfg.MaxEntries < 1 {
+		cfg.MaxEntries = 1
+	}
+	if cfg.MaxBodyBytes <= 0 {
+		cfg.MaxBodyBytes = 1 << 20
+	}
+	cfg.Metrics = metricsOrDefault(cfg.Metrics)
+	return &ResponseCache{
+		cfg:     cfg,
+		now:     time.Now,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// Len returns the number of cached responses, including expired ones not
+// yet evicted.
+func (c *ResponseCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// PurgeExpired drops the expired responses, which are otherwise only
+// evicted when requested again or pushed out by newer ones, and returns
+// how many were dropped.
+func (c *ResponseCache) PurgeExpired() int {
+	c.mu.Lock()
+	now := c.now()
+	purged := 0
+	for key, el := range c.entries {
+		if now.After(el.Value.(*cacheEntry).expires) {
+			c.lru.Remove(el)
+			delete(c.entries, key)
+			purged++
+		}
+	}
+	remaining := c.lru.Len()
+	c.mu.Unlock()
+	c.cfg.Metrics.SetCacheEntries(remaining)
+	return purged
+}
+
+func (c *ResponseCache) get(key string) *cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	entry := el.Value.(*cacheEntry)
+	if c.now().After(entry.expires) {
+		c.lru.Remove(el)
+		delete(c.entries, key)
+		return nil
+	}
+	c.lru.MoveToFront(el)
+	return entry
+}
+
+func (c *ResponseCache) put(entry *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[entry.key]; ok {
+		el.Value = entry
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[entry.key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.cfg.MaxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// key identifies a response by method, URI and the configured vary headers.
+func (c *ResponseCache) key(r *http.Request) string {
+	var b strings.Builder
+	b.WriteString(r.Method)
+	b.WriteByte(' ')
+	b.WriteString(r.URL.RequestURI())
+	for _, h := range c.cfg.VaryHeaders {
+		b.WriteByte('\n')
+		b.WriteString(h)
+		b.WriteByte(':')
+		b.WriteString(strings.Join(r.Header.Values(h), ","))
+	}
+	return b.String()
+}
+
+// NewCacheMiddleware serves repeated GET and HEAD requests to cfg.Routes
+// from memory. Only 200 responses are stored, and responses marked
+// no-store or private, or setting cookies, are never cached. Requests
+// sending "Cache-Control: no-cache" bypass the cache. Requests carrying
+// Authorization or Cookie headers bypass it entirely, as the key has no
+// notion of the caller: their responses are neither served from nor
+// stored in the cache. Responses carry X-Cache: HIT or MISS.
+func NewCacheMiddleware(cache *ResponseCache) func(http.Handler) http.Handler {
+	routes := make(map[string]bool, len(cache.cfg.Routes))
+	for _, p := range cache.cfg.Routes {
+		routes[p] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !routes[r.URL.Path] || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			metrics := cache.cfg.Metrics
+			if r.Header.Get("Authorization") != "" || r.Header.Get("Cookie") != "" {
+				metrics.RecordCacheLookup("bypass")
+				next.ServeHTTP(w, r)
+				return
+			}
+			key := cache.key(r)
+
+			if strings.Contains(r.Header.Get("Cache-Control"), "no-cache") {
+				metrics.RecordCacheLookup("bypass")
+			} else {
+				if entry := cache.get(key); entry != nil {
+					metrics.RecordCacheLookup("hit")
+					h := w.Header()
+					// Headers already set for this request (correlation ID,
+					// rate limits) win over the stored ones
+					for k, v := range entry.header {
+						if _, ok := h[k]; !ok {
+							h[k] = v
+						}
+					}
+					h.Set("X-Cache", "HIT")
+					h.Set("Age", strconv.Itoa(int(cache.now().Sub(entry.stored).Seconds())))
+					w.WriteHeader(entry.status)
+					w.Write(entry.body)
+					return
+				}
+				metrics.RecordCacheLookup("miss")
+			}
+
+			// Headers set by outer middleware belong to this request only
+			preset := make([]string, 0, len(w.Header()))
+			for k := range w.Header() {
+				preset = append(preset, k)
+			}
+			w.Header().Set("X-Cache", "MISS")
+			cw := &cacheWriter{ResponseWriter: w, status: http.StatusOK, limit: cache.cfg.MaxBodyBytes}
+			next.ServeHTTP(cw, r)
+
+			if cw.cacheable() {
+				header := cw.header.Clone()
+				header.Del("X-Cache")
+				for _, k := range preset {
+					delete(header, k)
+				}
+				now := cache.now()
+				cache.put(&cacheEntry{
+					key:     key,
+					status:  cw.status,
+					header:  header,
+					body:    cw.body.Bytes(),
+					stored:  now,
+					expires: now.Add(cache.cfg.TTL),
+				})
+				metrics.SetCacheEntries(cache.Len())
+			}
+		})
+	}
+}
+
+// cacheWriter passes the response through while keeping a copy to store.
+type cacheWriter struct {
+	http.ResponseWriter
+	status      int
+	header      http.Header
+	body        bytes.Buffer
+	limit       int
+	overflow    bool
+	wroteHeader bool
+}
+
+func (cw *cacheWriter) WriteHeader(code int) {
+	if !cw.wroteHeader {
+		cw.wroteHeader = true
+		cw.status = code
+		cw.header = cw.Header().Clone()
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *cacheWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if !cw.overflow {
+		if cw.body.Len()+len(b) > cw.limit {
+			cw.overflow = true
+			cw.body = bytes.Buffer{}
+		} else {
+			cw.body.Write(b)
+		}
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+func (cw *cacheWriter) cacheable() bool {
+	if cw.status != http.StatusOK || cw.overflow {
+		return false
+	}
+	if cw.header == nil {
+		cw.header = cw.Header().Clone()
+	}
+	// Trailer values arrive after the body and are not kept
+	if cw.header.Get("Set-Cookie") != "" || cw.header.Get("Trailer") != "" {
+		return false
+	}
+	cc := strings.ToLower(cw.header.Get("Cache-Control"))
+	return !strings.Contains(cc, "no-store") && !strings.Contains(cc, "private")
+}
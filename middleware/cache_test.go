@@ -0,0 +1,217 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"ping/observability"
+)
+
+// countingHandler answers with how many times it has been called.
+func countingHandler(calls *int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintf(w, "call %d accept=%s", *calls, r.Header.Get("Accept"))
+	})
+}
+
+func TestCacheServesHits(t *testing.T) {
+	observability.InitMetrics()
+	calls := 0
+	cache := NewResponseCache(CacheConfig{Routes: []string{"/status"}, TTL: time.Minute, MaxEntries: 10})
+	handler := NewCacheMiddleware(cache)(countingHandler(&calls))
+
+	get := func(id string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		// Stand-in for the correlation header set by outer middleware
+		w.Header().Set("X-Correlation-ID", id)
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/status", nil))
+		return w
+	}
+
+	first := get("one")
+	second := get("two")
+	if calls != 1 {
+		t.Fatalf("Expected handler to run once, ran %d times", calls)
+	}
+	if first.Header().Get("X-Cache") != "MISS" || second.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("Unexpected X-Cache headers %q, %q", first.Header().Get("X-Cache"), second.Header().Get("X-Cache"))
+	}
+	if second.Body.String() != first.Body.String() || second.Header().Get("Content-Type") != "text/plain" {
+		t.Errorf("Cached response differs: %q vs %q", second.Body.String(), first.Body.String())
+	}
+	if second.Header().Get("X-Correlation-ID") != "two" {
+		t.Errorf("Per-request headers must not be replayed, got %q", second.Header().Get("X-Correlation-ID"))
+	}
+}
+
+func TestCacheExpiryAndBypass(t *testing.T) {
+	observability.InitMetrics()
+	calls := 0
+	now := time.Unix(1700000000, 0)
+	cache := NewResponseCache(CacheConfig{Routes: []string{"/status"}, TTL: time.Minute, MaxEntries: 10})
+	cache.now = func() time.Time { return now }
+	handler := NewCacheMiddleware(cache)(countingHandler(&calls))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/status", nil))
+	now = now.Add(30 * time.Second)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/status", nil))
+	if calls != 1 || w.Header().Get("Age") != "30" {
+		t.Errorf("Expected hit with Age 30, calls=%d age=%q", calls, w.Header().Get("Age"))
+	}
+
+	req := httptest.NewRequest("GET", "/status", nil)
+	req.Header.Set("Cache-Control", "no-cache")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if calls != 2 {
+		t.Errorf("no-cache request should bypass the cache, calls=%d", calls)
+	}
+
+	now = now.Add(2 * time.Minute)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/status", nil))
+	if calls != 3 {
+		t.Errorf("Expired entry should be refreshed, calls=%d", calls)
+	}
+}
+
+func TestCachePurgeExpired(t *testing.T) {
+	observability.InitMetrics()
+	calls := 0
+	now := time.Unix(1700000000, 0)
+	cache := NewResponseCache(CacheConfig{Routes: []string{"/a", "/b"}, TTL: time.Minute, MaxEntries: 10})
+	cache.now = func() time.Time { return now }
+	handler := NewCacheMiddleware(cache)(countingHandler(&calls))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/a", nil))
+	now = now.Add(45 * time.Second)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/b", nil))
+	now = now.Add(30 * time.Second)
+
+	if n := cache.PurgeExpired(); n != 1 || cache.Len() != 1 {
+		t.Errorf("Expected only /a purged, purged %d and kept %d", n, cache.Len())
+	}
+	if n := cache.PurgeExpired(); n != 0 {
+		t.Errorf("Expected nothing left to purge, purged %d", n)
+	}
+}
+
+func TestCacheVaryHeaders(t *testing.T) {
+	observability.InitMetrics()
+	calls := 0
+	cache := NewResponseCache(CacheConfig{Routes: []string{"/status"}, TTL: time.Minute, MaxEntries: 10, VaryHeaders: []string{"Accept"}})
+	handler := NewCacheMiddleware(cache)(countingHandler(&calls))
+
+	for _, accept := range []string{"text/html", "application/json", "text/html"} {
+		req := httptest.NewRequest("GET", "/status", nil)
+		req.Header.Set("Accept", accept)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if calls != 2 {
+		t.Errorf("Expected one entry per Accept value, handler ran %d times", calls)
+	}
+}
+
+func TestCacheSkipsUncacheable(t *testing.T) {
+	observability.InitMetrics()
+	tests := map[string]http.HandlerFunc{
+		"no-store": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "no-store")
+		},
+		"cookie": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Set-Cookie", "a=b")
+		},
+		"trailer": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Trailer", "X-Checksum")
+			w.Write([]byte("body"))
+			w.Header().Set("X-Checksum", "abc")
+		},
+		"error": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		},
+	}
+	for name, h := range tests {
+		t.Run(name, func(t *testing.T) {
+			cache := NewResponseCache(CacheConfig{Routes: []string{"/"}, TTL: time.Minute, MaxEntries: 10})
+			NewCacheMiddleware(cache)(h).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+			if cache.Len() != 0 {
+				t.Error("Response should not have been cached")
+			}
+		})
+	}
+}
+
+func TestCacheBypassesCredentialedRequests(t *testing.T) {
+	observability.InitMetrics()
+	calls := 0
+	cache := NewResponseCache(CacheConfig{Routes: []string{"/status"}, TTL: time.Minute, MaxEntries: 10})
+	handler := NewCacheMiddleware(cache)(countingHandler(&calls))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/status", nil))
+	for _, h := range []string{"Authorization", "Cookie"} {
+		req := httptest.NewRequest("GET", "/status", nil)
+		req.Header.Set(h, "alice")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Header().Get("X-Cache") != "" {
+			t.Errorf("%s request should not be served from the cache, X-Cache=%q", h, w.Header().Get("X-Cache"))
+		}
+	}
+	if calls != 3 {
+		t.Errorf("Expected credentialed requests to reach the handler, ran %d times", calls)
+	}
+	if cache.Len() != 1 {
+		t.Errorf("Credentialed responses should not be stored, have %d entries", cache.Len())
+	}
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	observability.InitMetrics()
+	calls := 0
+	cache := NewResponseCache(CacheConfig{Routes: []string{"/status"}, TTL: time.Minute, MaxEntries: 2})
+	handler := NewCacheMiddleware(cache)(countingHandler(&calls))
+
+	for _, q := range []string{"a", "b", "c", "a"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/status?q="+q, nil))
+	}
+	if cache.Len() != 2 {
+		t.Errorf("Expected 2 entries, got %d", cache.Len())
+	}
+	if calls != 4 {
+		t.Errorf("Evicted entry should be regenerated, handler ran %d times", calls)
+	}
+}
+
+func TestCacheIgnoresOtherRoutesAndMethods(t *testing.T) {
+	observability.InitMetrics()
+	calls := 0
+	cache := NewResponseCache(CacheConfig{Routes: []string{"/status"}, TTL: time.Minute, MaxEntries: 10})
+	handler := NewCacheMiddleware(cache)(countingHandler(&calls))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/other", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/status", nil))
+	if cache.Len() != 0 {
+		t.Errorf("Only GET/HEAD on configured routes should be cached, have %d entries", cache.Len())
+	}
+}
+
+func TestCacheUsesInjectedMetrics(t *testing.T) {
+	metrics := observability.NewMemoryRecorder()
+	calls := 0
+	cache := NewResponseCache(CacheConfig{Routes: []string{"/status"}, TTL: time.Minute, MaxEntries: 10, Metrics: metrics})
+	handler := NewCacheMiddleware(cache)(countingHandler(&calls))
+	for i := 0; i < 2; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/status", nil))
+	}
+
+	if got := metrics.Value("http_response_cache_requests_total", "hit"); got != 1 {
+		t.Errorf("Expected the hit counted in the injected metrics, got %v", got)
+	}
+	if got := metrics.Value("http_response_cache_entries"); got != 1 {
+		t.Errorf("Expected one entry in the injected metrics, got %v", got)
+	}
+}
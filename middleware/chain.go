@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Middleware wraps a handler with additional behaviour.
+type Middleware = func(http.Handler) http.Handler
+
+type chainLink struct {
+	name string
+	mw   Middleware
+}
+
+// Chain is an ordered, named list of middleware. The first entry is the
+// outermost: it sees the request first and the response last. Names let
+// callers splice extra middleware relative to existing entries without
+// rebuilding the whole stack.
+type Chain struct {
+	links []chainLink
+}
+
+// NewChain returns an empty chain.
+func NewChain() *Chain {
+	return &Chain{}
+}
+
+// Use appends mw as the innermost entry so far. It panics if name is
+// already in the chain, mirroring http.ServeMux on duplicate patterns.
+func (c *Chain) Use(name string, mw Middleware) *Chain {
+	c.mustBeNew(name)
+	c.links = append(c.links, chainLink{name: name, mw: mw})
+	return c
+}
+
+// InsertBefore adds mw immediately outside the entry called ref.
+func (c *Chain) InsertBefore(ref, name string, mw Middleware) error {
+	i := c.index(ref)
+	if i < 0 {
+		return fmt.Errorf("middleware %q not in chain", ref)
+	}
+	c.insert(i, name, mw)
+	return nil
+}
+
+// InsertAfter adds mw immediately inside the entry called ref.
+func (c *Chain) InsertAfter(ref, name string, mw Middleware) error {
+	i := c.index(ref)
+	if i < 0 {
+		return fmt.Errorf("middleware %q not in chain", ref)
+	}
+	c.insert(i+1, name, mw)
+	return nil
+}
+
+// Remove drops the entry called name, reporting whether it was present.
+func (c *Chain) Remove(name string) bool {
+	i := c.index(name)
+	if i < 0 {
+		return false
+	}
+	c.links = append(c.links[:i], c.links[i+1:]...)
+	return true
+}
+
+// Names lists the entries from outermost to innermost.
+func (c *Chain) Names() []string {
+	names := make([]string, len(c.links))
+	for i, l := range c.links {
+		names[i] = l.name
+	}
+	return names
+}
+
+// Then wraps h with every entry in the chain.
+func (c *Chain) Then(h http.Handler) http.Handler {
+	for i := len(c.links) - 1; i >= 0; i-- {
+		h = c.links[i].mw(h)
+	}
+	return h
+}
+
+func (c *Chain) insert(i int, name string, mw Middleware) {
+	c.mustBeNew(name)
+	c.links = append(c.links, chainLink{})
+	copy(c.links[i+1:], c.links[i:])
+	c.links[i] = chainLink{name: name, mw: mw}
+}
+
+func (c *Chain) index(name string) int {
+	for i, l := range c.links {
+		if l.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (c *Chain) mustBeNew(name string) {
+	if c.index(name) >= 0 {
+		panic(fmt.Sprintf("middleware: duplicate chain entry %q", name))
+	}
+}
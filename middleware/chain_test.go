@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// recordOrder records its name on the way in so tests can check ordering.
+func recordOrder(name string, trace *[]string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			*trace = append(*trace, name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestChainOrdering(t *testing.T) {
+	var trace []string
+	chain := NewChain().
+		Use("outer", recordOrder("outer", &trace)).
+		Use("inner", recordOrder("inner", &trace))
+	if err := chain.InsertBefore("inner", "middle", recordOrder("middle", &trace)); err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.InsertAfter("inner", "innermost", recordOrder("innermost", &trace)); err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.InsertBefore("outer", "first", recordOrder("first", &trace)); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := chain.Then(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		trace = append(trace, "handler")
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	want := []string{"first", "outer", "middle", "inner", "innermost", "handler"}
+	if !reflect.DeepEqual(trace, want) {
+		t.Errorf("Expected order %v, got %v", want, trace)
+	}
+	if names := chain.Names(); !reflect.DeepEqual(names, want[:5]) {
+		t.Errorf("Expected names %v, got %v", want[:5], names)
+	}
+}
+
+func TestChainRemoveAndUnknownReference(t *testing.T) {
+	var trace []string
+	chain := NewChain().Use("a", recordOrder("a", &trace)).Use("b", recordOrder("b", &trace))
+
+	if err := chain.InsertAfter("missing", "c", recordOrder("c", &trace)); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("Expected error naming the missing entry, got %v", err)
+	}
+	if !chain.Remove("a") || chain.Remove("a") {
+		t.Error("Remove should succeed once")
+	}
+	chain.Then(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if !reflect.DeepEqual(trace, []string{"b"}) {
+		t.Errorf("Expected only b to run, got %v", trace)
+	}
+}
+
+func TestChainRejectsDuplicateNames(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected panic on duplicate name")
+		}
+	}()
+	NewChain().Use("a", RecoveryMiddleware).Use("a", RecoveryMiddleware)
+}
+
+func TestEmptyChainReturnsHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	NewChain().Then(http.NotFoundHandler()).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected handler to run unwrapped, got %d", w.Code)
+	}
+}
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"net/http"
+
+	"ping/auth"
+	"ping/observability"
+)
+
+// ClientIdentityConfig configures mTLS identity propagation.
+type ClientIdentityConfig struct {
+	// MetricLabel counts requests per client identity. Leave it off when
+	// many distinct certificates call the service, to bound cardinality.
+	MetricLabel bool
+	// Metrics receives the per-identity counter; nil uses
+	// observability.GetMetrics().
+	Metrics observability.MetricsRecorder
+}
+
+// NewClientIdentityMiddleware stores the identity of a verified client
+// certificate in the request context (see auth.ClientIdentityFromContext)
+// and adds it to the request log. Requests without one pass through.
+func NewClientIdentityMiddleware(cfg ClientIdentityConfig) func(http.Handler) http.Handler {
+	metrics := metricsOrDefault(cfg.Metrics)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := auth.ClientIdentityFromTLS(r.TLS)
+			if id == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx := r.Context()
+			observability.AddLogField(ctx, "client", id.String())
+			if cfg.MetricLabel {
+				metrics.IncClientIdentityRequests(id.String())
+			}
+			next.ServeHTTP(w, r.WithContext(auth.WithClientIdentity(ctx, id)))
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"ping/auth"
+	"ping/observability"
+)
+
+func TestClientIdentityMiddleware(t *testing.T) {
+	m := observability.NewMetrics(observability.MetricsOptions{})
+	logger := &recordingLogger{}
+	var seen *auth.ClientIdentity
+	handler := NewRequestInstrumentationMiddleware(InstrumentationConfig{Logger: logger, Metrics: m})(
+		NewClientIdentityMiddleware(ClientIdentityConfig{MetricLabel: true, Metrics: m})(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = auth.ClientIdentityFromContext(r.Context())
+			})))
+
+	req := httptest.NewRequest("GET", "/echo", nil)
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{
+		{Subject: pkix.Name{CommonName: "billing"}},
+	}}}
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if seen == nil || seen.CommonName != "billing" {
+		t.Fatalf("Expected identity in context, got %+v", seen)
+	}
+	if !strings.Contains(strings.Join(logger.messages, "\n"), "client=billing") {
+		t.Errorf("Expected client identity in logs, got %v", logger.messages)
+	}
+	counter := m.ClientIdentityRequestsCounter.WithLabelValues("billing")
+	if testutil.ToFloat64(counter) != 1 {
+		t.Error("Expected per-identity counter to be incremented")
+	}
+}
+
+func TestClientIdentityMiddlewarePlainRequest(t *testing.T) {
+	observability.InitMetrics()
+	called := false
+	handler := NewClientIdentityMiddleware(ClientIdentityConfig{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		if auth.ClientIdentityFromContext(r.Context()) != nil {
+			t.Error("Plain request should have no identity")
+		}
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if !called {
+		t.Error("Plain request should pass through")
+	}
+}
@@ -0,0 +1,146 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+type clientIPKey struct{}
+
+// ClientIPResolver finds the originating client address of requests that
+// arrive through reverse proxies and load balancers. Forwarding headers are
+// only believed when the connection comes from a trusted proxy, and the
+// chain is walked from the nearest hop outwards so a client cannot spoof
+// its address by sending its own X-Forwarded-For.
+type ClientIPResolver struct {
+	trusted []netip.Prefix
+}
+
+// NewClientIPResolver parses trusted proxy addresses, given as CIDRs
+// ("10.0.0.0/8") or single IPs. With none, forwarding headers are ignored.
+func NewClientIPResolver(trustedProxies []string) (*ClientIPResolver, error) {
+	c := &ClientIPResolver{}
+	for _, s := range trustedProxies {
+		prefix, err := ParseTrustedProxy(s)
+		if err != nil {
+			return nil, err
+		}
+		c.trusted = append(c.trusted, prefix)
+	}
+	return c, nil
+}
+
+// ParseTrustedProxy parses a CIDR or a single IP into a prefix.
+func ParseTrustedProxy(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid trusted proxy %q: %w", s, err)
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid trusted proxy %q: %w", s, err)
+	}
+	return netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()), nil
+}
+
+func (c *ClientIPResolver) isTrusted(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, p := range c.trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns the client IP for r. Forwarded (RFC 7239) takes
+// precedence over X-Forwarded-For, and X-Real-IP is used when neither is
+// present.
+func (c *ClientIPResolver) Resolve(r *http.Request) string {
+	peer, err := netip.ParseAddr(RemoteIP(r))
+	if err != nil || !c.isTrusted(peer) {
+		return RemoteIP(r)
+	}
+
+	var hops []string
+	if fwd := r.Header.Values("Forwarded"); len(fwd) > 0 {
+		hops = forwardedFor(fwd)
+	} else if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		for _, line := range xff {
+			hops = append(hops, strings.Split(line, ",")...)
+		}
+	} else if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
+		hops = []string{realIP}
+	}
+
+	// Walk from the proxy nearest to us; the first untrusted hop is the client
+	current := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := parseHop(hops[i])
+		if err != nil {
+			// Obfuscated or garbage hops end what we can vouch for
+			break
+		}
+		current = addr
+		if !c.isTrusted(addr) {
+			break
+		}
+	}
+	return current.Unmap().String()
+}
+
+// forwardedFor extracts the for= parameters of Forwarded header elements.
+func forwardedFor(values []string) []string {
+	var hops []string
+	for _, v := range values {
+		for _, element := range strings.Split(v, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(key, "for") {
+					hops = append(hops, strings.Trim(val, `"`))
+				}
+			}
+		}
+	}
+	return hops
+}
+
+// parseHop accepts "ip", "ip:port", "[ipv6]" and "[ipv6]:port".
+func parseHop(s string) (netip.Addr, error) {
+	s = strings.TrimSpace(s)
+	if addr, err := netip.ParseAddr(s); err == nil {
+		return addr, nil
+	}
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	return netip.ParseAddr(strings.Trim(s, "[]"))
+}
+
+// NewClientIPMiddleware resolves the client IP once per request and stores
+// it in the context, where ClientIP, the rate limiter and the request logs
+// pick it up. Install it outside the instrumentation middleware.
+func NewClientIPMiddleware(resolver *ClientIPResolver) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), clientIPKey{}, resolver.Resolve(r))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// ClientIP returns the client IP resolved by the client IP middleware, or
+// the connection's peer address when the middleware is not installed.
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+	return RemoteIP(r)
+}
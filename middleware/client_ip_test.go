@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIPResolver(t *testing.T) {
+	resolver, err := NewClientIPResolver([]string{"10.0.0.0/8", "192.0.2.1"})
+	if err != nil {
+		t.Fatalf("NewClientIPResolver returned error: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		remote  string
+		headers map[string]string
+		want    string
+	}{
+		{"direct client", "203.0.113.9:5000", nil, "203.0.113.9"},
+		{"untrusted peer spoofing XFF", "203.0.113.9:5000", map[string]string{"X-Forwarded-For": "1.1.1.1"}, "203.0.113.9"},
+		{"trusted proxy XFF", "10.1.2.3:5000", map[string]string{"X-Forwarded-For": "198.51.100.7"}, "198.51.100.7"},
+		{"proxy chain", "10.1.2.3:5000", map[string]string{"X-Forwarded-For": "1.1.1.1, 198.51.100.7, 10.9.9.9"}, "198.51.100.7"},
+		{"all hops trusted", "10.1.2.3:5000", map[string]string{"X-Forwarded-For": "10.0.0.5, 192.0.2.1"}, "10.0.0.5"},
+		{"forwarded header", "192.0.2.1:443", map[string]string{
+			"Forwarded":       `for=198.51.100.7;proto=https, for="[2001:db8::1]:4711"`,
+			"X-Forwarded-For": "1.1.1.1",
+		}, "2001:db8::1"},
+		{"obfuscated hop", "10.1.2.3:5000", map[string]string{"Forwarded": "for=_hidden, for=10.0.0.8"}, "10.0.0.8"},
+		{"x-real-ip", "10.1.2.3:5000", map[string]string{"X-Real-IP": "198.51.100.7"}, "198.51.100.7"},
+		{"garbage", "10.1.2.3:5000", map[string]string{"X-Forwarded-For": "not-an-ip"}, "10.1.2.3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remote
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			if got := resolver.Resolve(req); got != tt.want {
+				t.Errorf("Resolve = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientIPResolverWithoutTrustedProxies(t *testing.T) {
+	resolver, _ := NewClientIPResolver(nil)
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.1.2.3:5000"
+	req.Header.Set("X-Forwarded-For", "198.51.100.7")
+
+	if got := resolver.Resolve(req); got != "10.1.2.3" {
+		t.Errorf("Headers must be ignored without trusted proxies, got %q", got)
+	}
+}
+
+func TestNewClientIPResolverRejectsInvalid(t *testing.T) {
+	for _, bad := range []string{"10.0.0.0/33", "not-an-ip", ""} {
+		if _, err := NewClientIPResolver([]string{bad}); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+}
+
+func TestClientIPMiddleware(t *testing.T) {
+	resolver, _ := NewClientIPResolver([]string{"10.0.0.0/8"})
+	var got string
+	handler := NewClientIPMiddleware(resolver)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = ClientIP(r)
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.1.2.3:5000"
+	req.Header.Set("X-Forwarded-For", "198.51.100.7")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got != "198.51.100.7" {
+		t.Errorf("Expected resolved IP in context, got %q", got)
+	}
+
+	// Without the middleware ClientIP falls back to the peer
+	if ip := ClientIP(req); ip != "10.1.2.3" {
+		t.Errorf("Expected peer address fallback, got %q", ip)
+	}
+}
@@ -0,0 +1,338 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+
+	"ping/observability"
+)
+
+// Supported content encodings, in order of preference.
+const (
+	EncodingBrotli = "br"
+	EncodingGzip   = "gzip"
+)
+
+// CompressionConfig configures response compression.
+type CompressionConfig struct {
+	// MinSize is the smallest response, in bytes, worth compressing.
+	// Smaller responses are sent as-is.
+	MinSize int
+	// ExemptPaths are never compressed.
+	ExemptPaths []string
+	// Metrics records compression ratios; nil uses observability.GetMetrics().
+	Metrics observability.MetricsRecorder
+}
+
+// errHijackCompressed is returned when a handler hijacks the connection
+// after part of its response went through the encoder.
+var errHijackCompressed = errors.New("middleware: cannot hijack a compressed response")
+
+var (
+	gzipWriters = sync.Pool{New: func() interface{} {
+		zw, _ := gzip.NewWriterLevel(io.Discard, gzip.DefaultCompression)
+		return zw
+	}}
+	brotliWriters = sync.Pool{New: func() interface{} {
+		// Level 4 keeps streaming compression cheap while beating gzip
+		return brotli.NewWriterLevel(io.Discard, 4)
+	}}
+)
+
+// NewCompressionMiddleware compresses responses with brotli or gzip,
+// negotiated from Accept-Encoding. Output is buffered until MinSize bytes
+// are written, so small responses skip compression, and then streamed.
+// Place it inside the instrumentation middleware so logged and measured
+// response sizes are the compressed bytes actually sent.
+func NewCompressionMiddleware(cfg CompressionConfig) func(http.Handler) http.Handler {
+	exempt := make(map[string]bool, len(cfg.ExemptPaths))
+	for _, p := range cfg.ExemptPaths {
+		exempt[p] = true
+	}
+	metrics := metricsOrDefault(cfg.Metrics)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if exempt[r.URL.Path] {
+				next.ServeHTTP(w, r)
+				return
+			}
+			// The representation depends on Accept-Encoding either way
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			// Upgraded connections (WebSocket) must reach the raw writer
+			encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+			if encoding == "" || r.Method == http.MethodHead || r.Header.Get("Upgrade") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{
+				ResponseWriter: w,
+				encoding:       encoding,
+				minSize:        cfg.MinSize,
+				metrics:        metrics,
+			}
+			defer cw.Close()
+			next.ServeHTTP(cw.exposed(), r)
+		})
+	}
+}
+
+// negotiateEncoding picks the preferred supported encoding from an
+// Accept-Encoding header, honouring q-values. It returns "" when the client
+// accepts neither.
+func negotiateEncoding(header string) string {
+	best, bestQ := "", 0.0
+	wildcardQ := -1.0
+	seen := map[string]bool{}
+
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+
+		switch name {
+		case "*":
+			wildcardQ = q
+		case EncodingBrotli, EncodingGzip:
+			seen[name] = true
+			// Ties go to brotli, listed first in preference order
+			if q > bestQ || (q == bestQ && name == EncodingBrotli) {
+				best, bestQ = name, q
+			}
+		}
+	}
+
+	if wildcardQ > 0 {
+		for _, name := range []string{EncodingBrotli, EncodingGzip} {
+			if !seen[name] && wildcardQ > bestQ {
+				best, bestQ = name, wildcardQ
+			}
+		}
+	}
+	if bestQ <= 0 {
+		return ""
+	}
+	return best
+}
+
+// countingWriter counts the bytes passed through to the client.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
+
+// compressWriter defers the compression decision until MinSize bytes have
+// been written, the handler flushes, or the response ends.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+	metrics  observability.MetricsRecorder
+
+	status       int
+	buf          bytes.Buffer
+	decided      bool
+	encoder      io.WriteCloser
+	out          countingWriter
+	uncompressed int64
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.decided || code < 200 {
+		// Informational responses precede the real one and are not held back
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if cw.status != 0 {
+		return
+	}
+	cw.status = code
+	// Bodyless responses gain nothing from waiting
+	if code == http.StatusNoContent || code == http.StatusNotModified {
+		cw.decide(false)
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.decided {
+		if cw.buf.Len()+len(b) < cw.minSize {
+			return cw.buf.Write(b)
+		}
+		cw.buf.Write(b)
+		if err := cw.decide(cw.compressible()); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if cw.encoder == nil {
+		return cw.ResponseWriter.Write(b)
+	}
+	cw.uncompressed += int64(len(b))
+	return cw.encoder.Write(b)
+}
+
+// compressible reports whether the handler left the body for us to encode.
+func (cw *compressWriter) compressible() bool {
+	h := cw.Header()
+	if h.Get("Content-Encoding") != "" {
+		return false
+	}
+	// Already-compressed media would only grow
+	ct := h.Get("Content-Type")
+	if ct == "" {
+		ct = http.DetectContentType(cw.buf.Bytes())
+	}
+	for _, prefix := range []string{"image/", "video/", "audio/", "application/zip", "application/gzip", "application/x-gzip"} {
+		if strings.HasPrefix(ct, prefix) && ct != "image/svg+xml" {
+			return false
+		}
+	}
+	return true
+}
+
+// decide commits the headers and flushes any buffered bytes.
+func (cw *compressWriter) decide(compress bool) error {
+	cw.decided = true
+	h := cw.Header()
+	if compress {
+		if h.Get("Content-Type") == "" {
+			h.Set("Content-Type", http.DetectContentType(cw.buf.Bytes()))
+		}
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+		cw.out.w = cw.ResponseWriter
+		switch cw.encoding {
+		case EncodingBrotli:
+			bw := brotliWriters.Get().(*brotli.Writer)
+			bw.Reset(&cw.out)
+			cw.encoder = bw
+		default:
+			zw := gzipWriters.Get().(*gzip.Writer)
+			zw.Reset(&cw.out)
+			cw.encoder = zw
+		}
+	}
+	if cw.status != 0 {
+		cw.ResponseWriter.WriteHeader(cw.status)
+	}
+	if cw.buf.Len() == 0 {
+		return nil
+	}
+	var err error
+	if cw.encoder != nil {
+		cw.uncompressed += int64(cw.buf.Len())
+		_, err = cw.encoder.Write(cw.buf.Bytes())
+	} else {
+		_, err = cw.ResponseWriter.Write(cw.buf.Bytes())
+	}
+	cw.buf.Reset()
+	return err
+}
+
+// Flush commits to compression, since a flushing handler is streaming, and
+// pushes compressed bytes to the client.
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		cw.decide(cw.compressible())
+	}
+	if f, ok := cw.encoder.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close sends anything still buffered, finishes the compressed stream and
+// records the compression ratio.
+func (cw *compressWriter) Close() error {
+	if !cw.decided {
+		// The whole response stayed under MinSize
+		cw.decide(false)
+	}
+	if cw.encoder == nil {
+		return nil
+	}
+	err := cw.encoder.Close()
+	switch enc := cw.encoder.(type) {
+	case *gzip.Writer:
+		enc.Reset(io.Discard)
+		gzipWriters.Put(enc)
+	case *brotli.Writer:
+		enc.Reset(io.Discard)
+		brotliWriters.Put(enc)
+	}
+	cw.encoder = nil
+
+	cw.metrics.ObserveCompression(cw.encoding, cw.uncompressed, cw.out.n)
+	return err
+}
+
+// ReadFrom hands the body straight to the underlying writer once the
+// response is known to go out uncompressed, so io.Copy can still use
+// sendfile. Anything else goes through Write.
+func (cw *compressWriter) ReadFrom(src io.Reader) (int64, error) {
+	if rf, ok := cw.ResponseWriter.(io.ReaderFrom); ok && cw.decided && cw.encoder == nil {
+		return rf.ReadFrom(src)
+	}
+	return io.Copy(writerOnly{cw}, src)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer for
+// deadlines, full duplex and other controls not implemented here.
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// hijack hands the connection over, e.g. for a WebSocket upgrade, as long
+// as nothing was compressed yet. Buffered bytes are sent as they are first.
+func (cw *compressWriter) hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if cw.encoder != nil {
+		return nil, nil, errHijackCompressed
+	}
+	if !cw.decided {
+		if err := cw.decide(false); err != nil {
+			return nil, nil, err
+		}
+	}
+	return cw.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+// exposed returns cw as a writer that implements http.Hijacker only when
+// the underlying writer does, so handler type assertions keep telling the
+// truth.
+func (cw *compressWriter) exposed() http.ResponseWriter {
+	if _, ok := cw.ResponseWriter.(http.Hijacker); ok {
+		return hijackCompressWriter{cw}
+	}
+	return cw
+}
+
+type hijackCompressWriter struct{ *compressWriter }
+
+func (w hijackCompressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) { return w.hijack() }
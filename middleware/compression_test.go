@@ -0,0 +1,300 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"ping/observability"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := map[string]string{
+		"":                        "",
+		"gzip":                    "gzip",
+		"gzip, br":                "br",
+		"br;q=0.5, gzip":          "gzip",
+		"gzip;q=0, br;q=0":        "",
+		"deflate, identity":       "",
+		"*":                       "br",
+		"br;q=0, *;q=0.1":         "gzip",
+		"GZIP;q=0.8, deflate;q=1": "gzip",
+		"gzip;q=bogus":            "",
+	}
+	for header, want := range tests {
+		if got := negotiateEncoding(header); got != want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func compressionTestServer(body string) http.Handler {
+	return NewCompressionMiddleware(CompressionConfig{MinSize: 64})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(body))
+	}))
+}
+
+func TestCompressionGzip(t *testing.T) {
+	observability.InitMetrics()
+	body := strings.Repeat("pong ", 200)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	compressionTestServer(body).ServeHTTP(w, req)
+
+	if got := w.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Expected gzip encoding, got %q", got)
+	}
+	if !strings.Contains(w.Header().Get("Vary"), "Accept-Encoding") {
+		t.Error("Expected Vary: Accept-Encoding")
+	}
+	if w.Body.Len() >= len(body) {
+		t.Errorf("Compressed body (%d bytes) not smaller than original (%d)", w.Body.Len(), len(body))
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("Invalid gzip stream: %v", err)
+	}
+	decoded, _ := io.ReadAll(zr)
+	if string(decoded) != body {
+		t.Error("Decoded body does not match original")
+	}
+}
+
+func TestCompressionBrotli(t *testing.T) {
+	m := observability.NewMetrics(observability.MetricsOptions{})
+	body := strings.Repeat("pong ", 200)
+	handler := NewCompressionMiddleware(CompressionConfig{MinSize: 64, Metrics: m})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(body))
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip, br")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if got := w.Header().Get("Content-Encoding"); got != "br" {
+		t.Fatalf("Expected br encoding, got %q", got)
+	}
+	decoded, _ := io.ReadAll(brotli.NewReader(w.Body))
+	if string(decoded) != body {
+		t.Error("Decoded body does not match original")
+	}
+	if testutil.CollectAndCount(m.CompressionRatio) == 0 {
+		t.Error("Expected compression ratio to be recorded")
+	}
+}
+
+func TestCompressionSkipsSmallAndEncodedResponses(t *testing.T) {
+	observability.InitMetrics()
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	compressionTestServer("pong").ServeHTTP(w, req)
+	if w.Header().Get("Content-Encoding") != "" || w.Body.String() != "pong" {
+		t.Errorf("Small response should be sent as-is, got %q", w.Body.String())
+	}
+
+	handler := NewCompressionMiddleware(CompressionConfig{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "zstd")
+		w.Write([]byte("already encoded"))
+	}))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Header().Get("Content-Encoding") != "zstd" || w.Body.String() != "already encoded" {
+		t.Error("Pre-encoded response must not be compressed again")
+	}
+}
+
+func TestCompressionKeepsStatus(t *testing.T) {
+	observability.InitMetrics()
+	handler := NewCompressionMiddleware(CompressionConfig{MinSize: 8})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(strings.Repeat("x", 100)))
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503, got %d", w.Code)
+	}
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Error("Expected compressed error body")
+	}
+}
+
+func TestCompressionStreamingFlush(t *testing.T) {
+	observability.InitMetrics()
+	handler := NewCompressionMiddleware(CompressionConfig{MinSize: 1024})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("event: ping\n\n"))
+		w.(http.Flusher).Flush()
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if !w.Flushed {
+		t.Error("Flush should reach the underlying writer")
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("Invalid gzip stream: %v", err)
+	}
+	decoded, _ := io.ReadAll(zr)
+	if string(decoded) != "event: ping\n\n" {
+		t.Errorf("Unexpected streamed body %q", decoded)
+	}
+}
+
+func TestCompressionSizeAccounting(t *testing.T) {
+	observability.InitMetrics()
+	body := strings.Repeat("pong ", 500)
+	var recorded *responseWriter
+
+	compressed := NewCompressionMiddleware(CompressionConfig{MinSize: 64})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	// Stand-in for the instrumentation middleware sitting outside compression
+	outer := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorded = &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		compressed.ServeHTTP(recorded, r)
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	outer.ServeHTTP(w, req)
+
+	if recorded.written != int64(w.Body.Len()) {
+		t.Errorf("Accounted %d bytes, but %d were sent", recorded.written, w.Body.Len())
+	}
+	if recorded.written >= int64(len(body)) {
+		t.Error("Accounted size should be the compressed size")
+	}
+}
+
+func TestCompressionSkipsUpgradeRequests(t *testing.T) {
+	observability.InitMetrics()
+	var hijacker bool
+	handler := NewCompressionMiddleware(CompressionConfig{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, hijacker = w.(http.Hijacker)
+	}))
+
+	req := httptest.NewRequest("GET", "/ws", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	handler.ServeHTTP(&hijackRecorder{ResponseRecorder: httptest.NewRecorder()}, req)
+	if !hijacker {
+		t.Error("Upgrade requests should reach the raw, hijackable writer")
+	}
+}
+
+func TestCompressionPassesTrailers(t *testing.T) {
+	observability.InitMetrics()
+	handler := NewCompressionMiddleware(CompressionConfig{MinSize: 10})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "X-Checksum")
+		w.Write([]byte(strings.Repeat("pong ", 100)))
+		w.Header().Set("X-Checksum", "done")
+	}))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if resp.Header.Get("Content-Encoding") != "gzip" || resp.Trailer.Get("X-Checksum") != "done" {
+		t.Errorf("Expected gzip body with trailer, got encoding %q trailer %q", resp.Header.Get("Content-Encoding"), resp.Trailer.Get("X-Checksum"))
+	}
+}
+
+func TestCompressionKeepsConnectionControls(t *testing.T) {
+	metrics := observability.NewMetrics(observability.MetricsOptions{})
+	var deadlineErr error
+	handler := NewCompressionMiddleware(CompressionConfig{MinSize: 10, Metrics: metrics})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deadlineErr = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(time.Second))
+		w.Write([]byte(strings.Repeat("pong ", 100)))
+	}))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if deadlineErr != nil {
+		t.Errorf("SetWriteDeadline behind compression failed: %v", deadlineErr)
+	}
+	if testutil.CollectAndCount(metrics.CompressionRatio) == 0 {
+		t.Error("Expected the compression ratio in the configured metrics")
+	}
+}
+
+func TestCompressionHijackBeforeCompressing(t *testing.T) {
+	observability.InitMetrics()
+	rec := &hijackRecorder{ResponseRecorder: httptest.NewRecorder()}
+	var hijackErr, lateErr error
+	handler := NewCompressionMiddleware(CompressionConfig{MinSize: 10})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _, hijackErr = w.(http.Hijacker).Hijack()
+	}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	handler.ServeHTTP(rec, req)
+	if hijackErr != nil || !rec.hijacked {
+		t.Errorf("Expected hijack to reach the underlying writer, got hijacked=%v err=%v", rec.hijacked, hijackErr)
+	}
+
+	handler = NewCompressionMiddleware(CompressionConfig{MinSize: 10})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("pong ", 100)))
+		_, _, lateErr = w.(http.Hijacker).Hijack()
+	}))
+	handler.ServeHTTP(&hijackRecorder{ResponseRecorder: httptest.NewRecorder()}, req)
+	if lateErr == nil {
+		t.Error("Hijacking a response already being compressed should fail")
+	}
+}
+
+func BenchmarkCompressionGzip(b *testing.B) {
+	body := []byte(strings.Repeat(`{"status":"healthy","checks":[]}`, 64))
+	handler := NewCompressionMiddleware(CompressionConfig{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := &discardWriter{header: make(http.Header)}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		clear(w.header)
+		handler.ServeHTTP(w, req)
+	}
+}
@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"ping/observability"
+)
+
+// ConcurrencyLimitConfig caps how many requests are handled at once.
+type ConcurrencyLimitConfig struct {
+	// MaxInFlight is the number of requests allowed to run concurrently.
+	// It must be positive.
+	MaxInFlight int
+	// QueueTimeout is how long a request waits for a free slot before it
+	// is rejected with 503. Zero rejects immediately when all slots are busy.
+	QueueTimeout time.Duration
+	// ExemptPaths are never limited, so health checks and scrapes keep
+	// working while the service is saturated.
+	ExemptPaths []string
+	// RetryAfter is sent in the Retry-After header of 503 responses.
+	// Zero omits the header.
+	RetryAfter time.Duration
+
+	// QueueWaitTarget enables adaptive load shedding. Once the smoothed
+	// queue wait exceeds it, low-priority requests are rejected before
+	// queueing; above twice the target normal-priority requests are too.
+	// Zero disables shedding.
+	QueueWaitTarget time.Duration
+	// Priority classifies requests for shedding. Nil treats every request
+	// as PriorityNormal.
+	Priority func(*http.Request) Priority
+	// Metrics records queueing, rejections and sheds; nil uses
+	// observability.GetMetrics().
+	Metrics observability.MetricsRecorder
+}
+
+// NewConcurrencyLimitMiddleware returns a semaphore-based limiter. Requests
+// beyond MaxInFlight queue for up to QueueTimeout and are then rejected with
+// 503. When QueueWaitTarget is set, requests are shed by priority while
+// queueing is slow. Queue depth, queue wait, rejections, and sheds are
+// exported as metrics.
+func NewConcurrencyLimitMiddleware(cfg ConcurrencyLimitConfig) func(http.Handler) http.Handler {
+	slots := make(chan struct{}, cfg.MaxInFlight)
+	var shedder *loadShedder
+	if cfg.QueueWaitTarget > 0 {
+		shedder = newLoadShedder(cfg.QueueWaitTarget)
+	}
+	exempt := make(map[string]bool, len(cfg.ExemptPaths))
+	for _, p := range cfg.ExemptPaths {
+		exempt[p] = true
+	}
+	metrics := metricsOrDefault(cfg.Metrics)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if exempt[r.URL.Path] {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if shedder != nil {
+				priority := PriorityNormal
+				if cfg.Priority != nil {
+					priority = cfg.Priority(r)
+				}
+				if shedder.shouldShed(priority) {
+					metrics.IncRequestsShed(priority.String())
+					setRetryAfter(w, cfg.RetryAfter)
+					WriteJSONError(w, r, http.StatusServiceUnavailable, "server is overloaded")
+					return
+				}
+			}
+
+			wait, ok := acquireSlot(r, slots, cfg.QueueTimeout, metrics)
+			metrics.ObserveQueueWait(wait.Seconds())
+			if !ok {
+				metrics.IncConcurrencyRejected()
+				setRetryAfter(w, cfg.RetryAfter)
+				WriteJSONError(w, r, http.StatusServiceUnavailable, "server is at capacity")
+				return
+			}
+			defer func() { <-slots }()
+			if shedder != nil {
+				shedder.observe(wait)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// acquireSlot takes a slot, waiting up to timeout, and reports how long it
+// waited, counting itself in queue meanwhile. It gives up early if the
+// client goes away.
+func acquireSlot(r *http.Request, slots chan struct{}, timeout time.Duration, metrics observability.MetricsRecorder) (time.Duration, bool) {
+	select {
+	case slots <- struct{}{}:
+		return 0, true
+	default:
+	}
+	if timeout <= 0 {
+		return 0, false
+	}
+
+	metrics.AddQueuedRequests(1)
+	defer metrics.AddQueuedRequests(-1)
+
+	start := time.Now()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case slots <- struct{}{}:
+		return time.Since(start), true
+	case <-timer.C:
+		return time.Since(start), false
+	case <-r.Context().Done():
+		return time.Since(start), false
+	}
+}
@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"ping/observability"
+)
+
+// blockUntil returns a handler that signals entered and then waits for release.
+func blockUntil(entered chan<- struct{}, release <-chan struct{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+func TestConcurrencyLimitRejectsOverflow(t *testing.T) {
+	observability.InitMetrics()
+
+	entered := make(chan struct{}, 1)
+	release := make(chan struct{})
+	limited := NewConcurrencyLimitMiddleware(ConcurrencyLimitConfig{
+		MaxInFlight:  1,
+		QueueTimeout: 10 * time.Millisecond,
+	})(blockUntil(entered, release))
+
+	firstDone := make(chan int)
+	go func() {
+		w := httptest.NewRecorder()
+		limited.ServeHTTP(w, httptest.NewRequest("GET", "/work", nil))
+		firstDone <- w.Code
+	}()
+	<-entered
+
+	w := httptest.NewRecorder()
+	limited.ServeHTTP(w, httptest.NewRequest("GET", "/work", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 while the only slot is busy, got %d", w.Code)
+	}
+
+	close(release)
+	if code := <-firstDone; code != http.StatusOK {
+		t.Errorf("Expected first request to succeed, got %d", code)
+	}
+}
+
+func TestConcurrencyLimitQueuesBriefly(t *testing.T) {
+	observability.InitMetrics()
+
+	entered := make(chan struct{}, 2)
+	release := make(chan struct{})
+	limited := NewConcurrencyLimitMiddleware(ConcurrencyLimitConfig{
+		MaxInFlight:  1,
+		QueueTimeout: time.Second,
+	})(blockUntil(entered, release))
+
+	codes := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			w := httptest.NewRecorder()
+			limited.ServeHTTP(w, httptest.NewRequest("GET", "/work", nil))
+			codes <- w.Code
+		}()
+	}
+
+	// Let the first request in, then free it so the queued one gets the slot
+	<-entered
+	release <- struct{}{}
+	<-entered
+	close(release)
+
+	for i := 0; i < 2; i++ {
+		if code := <-codes; code != http.StatusOK {
+			t.Errorf("Queued request should eventually succeed, got %d", code)
+		}
+	}
+}
+
+func TestConcurrencyLimitExemptPaths(t *testing.T) {
+	observability.InitMetrics()
+
+	entered := make(chan struct{}, 1)
+	release := make(chan struct{})
+	defer close(release)
+
+	var inner http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/work" {
+			blockUntil(entered, release).ServeHTTP(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	limited := NewConcurrencyLimitMiddleware(ConcurrencyLimitConfig{
+		MaxInFlight: 1,
+		ExemptPaths: []string{"/health"},
+	})(inner)
+
+	go limited.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/work", nil))
+	<-entered
+
+	w := httptest.NewRecorder()
+	limited.ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Exempt path should bypass the limit, got %d", w.Code)
+	}
+}
@@ -0,0 +1,160 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConfig configures cross-origin access for browser clients.
+type CORSConfig struct {
+	// AllowedOrigins lists origins allowed to call the service. "*" allows
+	// any origin; a single "*" inside a pattern matches one or more
+	// characters, e.g. "https://*.example.com".
+	AllowedOrigins []string
+	// AllowedMethods are accepted in preflight requests.
+	AllowedMethods []string
+	// AllowedHeaders are accepted in preflight requests; "*" allows any.
+	AllowedHeaders []string
+	// ExposedHeaders are readable by scripts on the calling page.
+	ExposedHeaders []string
+	// AllowCredentials lets browsers send cookies and auth headers. The
+	// matching origin is echoed back instead of "*", as browsers require.
+	// A bare "*" origin matches nothing then: echoing any origin with
+	// credentials would let every site read responses as the user.
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight result.
+	MaxAge time.Duration
+}
+
+// allowsOrigin reports whether origin matches one of the configured patterns.
+func (c CORSConfig) allowsOrigin(origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, pattern := range c.AllowedOrigins {
+		if pattern == "*" && c.AllowCredentials {
+			continue
+		}
+		if matchOrigin(strings.ToLower(pattern), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchOrigin(pattern, origin string) bool {
+	if pattern == "*" {
+		return true
+	}
+	prefix, suffix, wildcard := strings.Cut(pattern, "*")
+	if !wildcard {
+		return pattern == origin
+	}
+	return len(origin) > len(prefix)+len(suffix) &&
+		strings.HasPrefix(origin, prefix) &&
+		strings.HasSuffix(origin, suffix)
+}
+
+func (c CORSConfig) allowsMethod(method string) bool {
+	for _, m := range c.AllowedMethods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsHeaders checks a comma-separated Access-Control-Request-Headers value.
+func (c CORSConfig) allowsHeaders(requested string) bool {
+	for _, h := range strings.Split(requested, ",") {
+		h = strings.TrimSpace(h)
+		if h == "" {
+			continue
+		}
+		allowed := false
+		for _, a := range c.AllowedHeaders {
+			if a == "*" || strings.EqualFold(a, h) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	return true
+}
+
+// allowOriginValue is what goes into Access-Control-Allow-Origin.
+func (c CORSConfig) allowOriginValue(origin string) string {
+	if !c.AllowCredentials {
+		for _, pattern := range c.AllowedOrigins {
+			if pattern == "*" {
+				return "*"
+			}
+		}
+	}
+	return origin
+}
+
+// NewCORSMiddleware answers preflight requests directly and adds CORS
+// headers to responses for allowed origins. Requests without an Origin
+// header pass through untouched.
+func NewCORSMiddleware(cfg CORSConfig) func(http.Handler) http.Handler {
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	exposed := strings.Join(cfg.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			// Responses differ by origin, so caches must key on it
+			h.Add("Vary", "Origin")
+
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			if preflight {
+				h.Add("Vary", "Access-Control-Request-Method")
+				h.Add("Vary", "Access-Control-Request-Headers")
+
+				if !cfg.allowsOrigin(origin) ||
+					!cfg.allowsMethod(r.Header.Get("Access-Control-Request-Method")) ||
+					!cfg.allowsHeaders(r.Header.Get("Access-Control-Request-Headers")) {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+
+				h.Set("Access-Control-Allow-Origin", cfg.allowOriginValue(origin))
+				h.Set("Access-Control-Allow-Methods", methods)
+				if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+					// Echo the (validated) request so "*" also works with credentials
+					h.Set("Access-Control-Allow-Headers", requested)
+				}
+				if cfg.AllowCredentials {
+					h.Set("Access-Control-Allow-Credentials", "true")
+				}
+				if cfg.MaxAge > 0 {
+					h.Set("Access-Control-Max-Age", maxAge)
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			if cfg.allowsOrigin(origin) {
+				h.Set("Access-Control-Allow-Origin", cfg.allowOriginValue(origin))
+				if exposed != "" {
+					h.Set("Access-Control-Expose-Headers", exposed)
+				}
+				if cfg.AllowCredentials {
+					h.Set("Access-Control-Allow-Credentials", "true")
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+
+	"ping/observability"
+)
+
+// DecompressionConfig configures transparent request body decompression.
+type DecompressionConfig struct {
+	// MaxBytes caps the decompressed body size. Reads past the cap fail
+	// with *http.MaxBytesError, so small compressed payloads cannot
+	// expand into huge bodies. Zero means no cap.
+	MaxBytes int64
+	// Metrics counts decoded bodies; nil uses observability.GetMetrics().
+	Metrics observability.MetricsRecorder
+}
+
+// NewDecompressionMiddleware decodes gzip and zstd request bodies announced
+// by Content-Encoding, so handlers always read plain bytes. Unsupported
+// encodings get 415 and malformed streams surface as read errors.
+func NewDecompressionMiddleware(cfg DecompressionConfig) func(http.Handler) http.Handler {
+	metrics := metricsOrDefault(cfg.Metrics)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+			if encoding == "" || encoding == "identity" || r.Body == nil || r.Body == http.NoBody {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var body io.ReadCloser
+			switch encoding {
+			case "gzip", "x-gzip":
+				zr, err := gzip.NewReader(r.Body)
+				if err != nil {
+					WriteJSONError(w, r, http.StatusBadRequest, "malformed gzip request body")
+					return
+				}
+				body = zr
+			case "zstd":
+				zr, err := zstd.NewReader(r.Body,
+					zstd.WithDecoderConcurrency(1),
+					zstd.WithDecoderLowmem(true))
+				if err != nil {
+					WriteJSONError(w, r, http.StatusBadRequest, "malformed zstd request body")
+					return
+				}
+				body = zr.IOReadCloser()
+			default:
+				w.Header().Set("Accept-Encoding", "gzip, zstd")
+				WriteJSONError(w, r, http.StatusUnsupportedMediaType, "unsupported content encoding: "+encoding)
+				return
+			}
+			defer body.Close()
+			metrics.IncRequestsDecompressed(encoding)
+
+			if cfg.MaxBytes > 0 {
+				body = http.MaxBytesReader(w, body, cfg.MaxBytes)
+			}
+
+			r2 := r.Clone(r.Context())
+			r2.Body = body
+			// The decoded length is unknown until the body is read
+			r2.ContentLength = -1
+			r2.Header.Del("Content-Encoding")
+			r2.Header.Del("Content-Length")
+			next.ServeHTTP(w, r2)
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+
+	"ping/observability"
+)
+
+// echoBody answers with the request body, or 413 when the body cap was hit.
+func echoBody(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+	case err != nil:
+		w.WriteHeader(http.StatusBadRequest)
+	default:
+		w.Header().Set("X-Seen-Encoding", r.Header.Get("Content-Encoding"))
+		w.Write(body)
+	}
+}
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestDecompressionGzip(t *testing.T) {
+	observability.InitMetrics()
+	handler := NewDecompressionMiddleware(DecompressionConfig{MaxBytes: 1024})(http.HandlerFunc(echoBody))
+
+	req := httptest.NewRequest("POST", "/echo", bytes.NewReader(gzipBytes(t, []byte("hello ping"))))
+	req.Header.Set("Content-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || w.Body.String() != "hello ping" {
+		t.Fatalf("Expected decoded body, got %d %q", w.Code, w.Body.String())
+	}
+	if w.Header().Get("X-Seen-Encoding") != "" {
+		t.Error("Handler should not see Content-Encoding after decoding")
+	}
+}
+
+func TestDecompressionZstd(t *testing.T) {
+	observability.InitMetrics()
+	handler := NewDecompressionMiddleware(DecompressionConfig{})(http.HandlerFunc(echoBody))
+
+	enc, _ := zstd.NewWriter(nil)
+	compressed := enc.EncodeAll([]byte("hello zstd"), nil)
+	enc.Close()
+
+	req := httptest.NewRequest("POST", "/echo", bytes.NewReader(compressed))
+	req.Header.Set("Content-Encoding", "zstd")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Body.String() != "hello zstd" {
+		t.Errorf("Expected decoded body, got %q", w.Body.String())
+	}
+}
+
+func TestDecompressionLimitsExpandedSize(t *testing.T) {
+	observability.InitMetrics()
+	handler := NewDecompressionMiddleware(DecompressionConfig{MaxBytes: 1024})(http.HandlerFunc(echoBody))
+
+	// A megabyte of zeros compresses to about a kilobyte
+	bomb := gzipBytes(t, make([]byte, 1<<20))
+	req := httptest.NewRequest("POST", "/echo", bytes.NewReader(bomb))
+	req.Header.Set("Content-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for oversized decoded body, got %d", w.Code)
+	}
+}
+
+func TestDecompressionRejectsBadInput(t *testing.T) {
+	observability.InitMetrics()
+	handler := NewDecompressionMiddleware(DecompressionConfig{})(http.HandlerFunc(echoBody))
+
+	req := httptest.NewRequest("POST", "/echo", strings.NewReader("plain"))
+	req.Header.Set("Content-Encoding", "br")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected 415 for unsupported encoding, got %d", w.Code)
+	}
+	if w.Header().Get("Accept-Encoding") == "" {
+		t.Error("Expected supported encodings to be advertised")
+	}
+
+	req = httptest.NewRequest("POST", "/echo", strings.NewReader("not gzip at all"))
+	req.Header.Set("Content-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for malformed gzip, got %d", w.Code)
+	}
+}
+
+func TestDecompressionPassThrough(t *testing.T) {
+	handler := NewDecompressionMiddleware(DecompressionConfig{MaxBytes: 4})(http.HandlerFunc(echoBody))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/echo", strings.NewReader("uncompressed body")))
+
+	if w.Body.String() != "uncompressed body" {
+		t.Errorf("Plain bodies should pass through unchanged, got %q", w.Body.String())
+	}
+}
@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"ping/observability"
+)
+
+// errorResponse is the JSON body returned for requests that fail inside the service
+type errorResponse struct {
+	Error         string `json:"error"`
+	CorrelationID string `json:"correlation_id,omitempty"`
+}
+
+// WriteJSONError answers r with status and a JSON body carrying message and
+// the correlation ID, so clients can quote the ID when reporting problems.
+func WriteJSONError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorResponse{
+		Error:         message,
+		CorrelationID: observability.GetCorrelationID(r.Context()),
+	})
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"ping/auth"
+	"ping/observability"
+)
+
+// JWTConfig configures bearer token authentication.
+type JWTConfig struct {
+	// Verifier validates tokens and returns their claims.
+	Verifier *auth.Verifier
+	// ExemptPaths are served without a token, e.g. probes and scrapes.
+	ExemptPaths []string
+	// Metrics counts failures; nil uses observability.GetMetrics().
+	Metrics observability.MetricsRecorder
+}
+
+// NewJWTMiddleware requires a valid "Authorization: Bearer" token on every
+// non-exempt request. Verified claims are stored in the request context
+// (see auth.ClaimsFromContext) and the subject is added to the request log.
+func NewJWTMiddleware(cfg JWTConfig) func(http.Handler) http.Handler {
+	exempt := make(map[string]bool, len(cfg.ExemptPaths))
+	for _, p := range cfg.ExemptPaths {
+		exempt[p] = true
+	}
+	metrics := metricsOrDefault(cfg.Metrics)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if exempt[r.URL.Path] {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ctx := r.Context()
+
+			token, ok := bearerToken(r)
+			if !ok {
+				metrics.IncAuthFailures("bearer", "missing")
+				w.Header().Set("WWW-Authenticate", `Bearer`)
+				WriteJSONError(w, r, http.StatusUnauthorized, "missing bearer token")
+				return
+			}
+
+			claims, err := cfg.Verifier.Verify(ctx, token)
+			if err != nil {
+				metrics.IncAuthFailures("bearer", jwtFailureReason(err))
+				observability.LoggerFromContext(ctx).Warnf(ctx, "rejected bearer token [%s] %s: %v (id=%s)",
+					r.Method, r.URL.Path, err, observability.GetCorrelationID(ctx))
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				WriteJSONError(w, r, http.StatusUnauthorized, "invalid bearer token")
+				return
+			}
+
+			observability.AddLogField(ctx, "sub", claims.Subject)
+			next.ServeHTTP(w, r.WithContext(auth.WithClaims(ctx, claims)))
+		})
+	}
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// jwtFailureReason maps verification errors to a small set of metric labels.
+func jwtFailureReason(err error) string {
+	switch {
+	case errors.Is(err, auth.ErrTokenExpired), errors.Is(err, auth.ErrTokenNotYetValid), errors.Is(err, auth.ErrMissingExpiry):
+		return "expired"
+	case errors.Is(err, auth.ErrInvalidIssuer), errors.Is(err, auth.ErrInvalidAudience):
+		return "claims"
+	case errors.Is(err, auth.ErrInvalidSignature), errors.Is(err, auth.ErrUnknownKey), errors.Is(err, auth.ErrWeakKey):
+		return "signature"
+	case errors.Is(err, auth.ErrMalformedToken), errors.Is(err, auth.ErrUnsupportedAlgorithm):
+		return "malformed"
+	}
+	// Typically the key set could not be fetched
+	return "error"
+}
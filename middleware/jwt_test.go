@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ping/auth"
+	"ping/observability"
+)
+
+var jwtTestKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+
+// rs256Token signs claims with jwtTestKey.
+func rs256Token(t *testing.T, claims map[string]interface{}) string {
+	t.Helper()
+	hdr, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test"})
+	body, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(hdr) + "." + base64.RawURLEncoding.EncodeToString(body)
+	digest := sha256.Sum256([]byte(input))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, jwtTestKey, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func jwtTestHandler() http.Handler {
+	verifier := auth.NewVerifier(auth.VerifierConfig{
+		Keys:     auth.StaticKeys{"test": &jwtTestKey.PublicKey},
+		Issuer:   "https://issuer.test",
+		Audience: "ping",
+	})
+	return NewJWTMiddleware(JWTConfig{
+		Verifier:    verifier,
+		ExemptPaths: []string{"/health"},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if claims := auth.ClaimsFromContext(r.Context()); claims != nil {
+			w.Write([]byte(claims.Subject))
+		}
+	}))
+}
+
+func TestJWTMiddlewareAcceptsValidToken(t *testing.T) {
+	observability.InitMetrics()
+	logger := &recordingLogger{}
+	handler := NewRequestInstrumentationMiddleware(InstrumentationConfig{Logger: logger})(jwtTestHandler())
+
+	token := rs256Token(t, map[string]interface{}{
+		"iss": "https://issuer.test",
+		"aud": "ping",
+		"sub": "alice",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || w.Body.String() != "alice" {
+		t.Fatalf("Expected claims in handler context, got %d %q", w.Code, w.Body.String())
+	}
+	logged := strings.Join(logger.messages, "\n")
+	if !strings.Contains(logged, "sub=alice") {
+		t.Errorf("Expected subject in completion log, got:\n%s", logged)
+	}
+}
+
+func TestJWTMiddlewareRejects(t *testing.T) {
+	observability.InitMetrics()
+	handler := jwtTestHandler()
+
+	expired := rs256Token(t, map[string]interface{}{
+		"iss": "https://issuer.test",
+		"aud": "ping",
+		"exp": time.Now().Add(-time.Hour).Unix(),
+	})
+	tests := map[string]string{
+		"missing": "",
+		"scheme":  "Basic dXNlcjpwYXNz",
+		"garbage": "Bearer not-a-jwt",
+		"expired": "Bearer " + expired,
+	}
+	for name, authz := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			if authz != "" {
+				req.Header.Set("Authorization", authz)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("Expected 401, got %d", w.Code)
+			}
+			if !strings.HasPrefix(w.Header().Get("WWW-Authenticate"), "Bearer") {
+				t.Errorf("Expected Bearer challenge, got %q", w.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestJWTMiddlewareExemptPaths(t *testing.T) {
+	observability.InitMetrics()
+	w := httptest.NewRecorder()
+	jwtTestHandler().ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Exempt path should not require a token, got %d", w.Code)
+	}
+}
+
+func TestJWTMiddlewareUsesInjectedMetrics(t *testing.T) {
+	metrics := observability.NewMemoryRecorder()
+	handler := NewJWTMiddleware(JWTConfig{Metrics: metrics})(http.NotFoundHandler())
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	if got := metrics.Value("http_auth_failures_total", "bearer", "missing"); got != 1 {
+		t.Errorf("Expected the failure counted in the injected metrics, got %v", got)
+	}
+}
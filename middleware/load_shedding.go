@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Priority ranks requests for load shedding; lower priorities are shed first.
+type Priority int
+
+const (
+	// PriorityLow is shed as soon as queue wait exceeds the target
+	PriorityLow Priority = iota
+	// PriorityNormal is shed once queue wait exceeds twice the target
+	PriorityNormal
+	// PriorityCritical is never shed, only subject to the concurrency limit
+	PriorityCritical
+)
+
+// String returns the metric label for p.
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityCritical:
+		return "critical"
+	default:
+		return "normal"
+	}
+}
+
+// PriorityByPath classifies requests by path prefix. Paths matching neither
+// list are PriorityNormal; critical prefixes win over low ones.
+func PriorityByPath(low, critical []string) func(*http.Request) Priority {
+	return func(r *http.Request) Priority {
+		for _, prefix := range critical {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				return PriorityCritical
+			}
+		}
+		for _, prefix := range low {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				return PriorityLow
+			}
+		}
+		return PriorityNormal
+	}
+}
+
+// queueWaitAlpha weights each new sample in the smoothed queue wait.
+const queueWaitAlpha = 0.2
+
+// loadShedder tracks an exponentially weighted moving average of queue wait
+// time and decides which priorities to reject while it is above target.
+type loadShedder struct {
+	target time.Duration
+	// staleAfter resets the average when no request has been admitted for a
+	// while, so shedding cannot latch on once traffic stops flowing
+	staleAfter time.Duration
+
+	avgBits    atomic.Uint64 // float64 seconds
+	lastSample atomic.Int64  // unix nanoseconds
+}
+
+func newLoadShedder(target time.Duration) *loadShedder {
+	stale := 10 * target
+	if stale < time.Second {
+		stale = time.Second
+	}
+	return &loadShedder{target: target, staleAfter: stale}
+}
+
+// observe folds one admitted request's queue wait into the average.
+func (s *loadShedder) observe(wait time.Duration) {
+	sample := wait.Seconds()
+	for {
+		old := s.avgBits.Load()
+		next := queueWaitAlpha*sample + (1-queueWaitAlpha)*math.Float64frombits(old)
+		if s.avgBits.CompareAndSwap(old, math.Float64bits(next)) {
+			break
+		}
+	}
+	s.lastSample.Store(time.Now().UnixNano())
+}
+
+// average returns the smoothed queue wait, or zero once it has gone stale.
+func (s *loadShedder) average() time.Duration {
+	last := s.lastSample.Load()
+	if last == 0 || time.Since(time.Unix(0, last)) > s.staleAfter {
+		return 0
+	}
+	return time.Duration(math.Float64frombits(s.avgBits.Load()) * float64(time.Second))
+}
+
+// shouldShed reports whether a request of priority p is rejected right now.
+func (s *loadShedder) shouldShed(p Priority) bool {
+	avg := s.average()
+	switch p {
+	case PriorityLow:
+		return avg > s.target
+	case PriorityNormal:
+		return avg > 2*s.target
+	default:
+		return false
+	}
+}
+
+// setRetryAfter tells clients when to come back, rounded up to whole seconds.
+func setRetryAfter(w http.ResponseWriter, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	seconds := int(math.Ceil(d.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+}
@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"ping/observability"
+)
+
+func TestPriorityByPath(t *testing.T) {
+	classify := PriorityByPath([]string{"/export"}, []string{"/admin"})
+
+	tests := map[string]Priority{
+		"/export/csv": PriorityLow,
+		"/admin/jobs": PriorityCritical,
+		"/":           PriorityNormal,
+	}
+	for path, want := range tests {
+		if got := classify(httptest.NewRequest("GET", path, nil)); got != want {
+			t.Errorf("%s classified as %s, want %s", path, got, want)
+		}
+	}
+}
+
+func TestLoadShedderThresholds(t *testing.T) {
+	s := newLoadShedder(10 * time.Millisecond)
+
+	if s.shouldShed(PriorityLow) {
+		t.Error("Nothing should be shed before any queue wait is observed")
+	}
+
+	// Drive the average to ~15ms: above target, below twice the target
+	for i := 0; i < 50; i++ {
+		s.observe(15 * time.Millisecond)
+	}
+	if !s.shouldShed(PriorityLow) {
+		t.Error("Low priority should be shed above target")
+	}
+	if s.shouldShed(PriorityNormal) {
+		t.Error("Normal priority should survive below twice the target")
+	}
+
+	for i := 0; i < 50; i++ {
+		s.observe(50 * time.Millisecond)
+	}
+	if !s.shouldShed(PriorityNormal) {
+		t.Error("Normal priority should be shed above twice the target")
+	}
+	if s.shouldShed(PriorityCritical) {
+		t.Error("Critical priority must never be shed")
+	}
+}
+
+func TestLoadShedderGoesStale(t *testing.T) {
+	s := newLoadShedder(10 * time.Millisecond)
+	s.observe(time.Second)
+	s.lastSample.Store(time.Now().Add(-time.Hour).UnixNano())
+
+	if s.average() != 0 {
+		t.Errorf("Stale average should read as zero, got %s", s.average())
+	}
+}
+
+func TestSetRetryAfterRoundsUp(t *testing.T) {
+	w := httptest.NewRecorder()
+	setRetryAfter(w, 1500*time.Millisecond)
+	if got := w.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Expected Retry-After 2, got %q", got)
+	}
+
+	w = httptest.NewRecorder()
+	setRetryAfter(w, 0)
+	if got := w.Header().Get("Retry-After"); got != "" {
+		t.Errorf("Zero duration should omit Retry-After, got %q", got)
+	}
+}
+
+func TestConcurrencyLimitRejectionCarriesRetryAfter(t *testing.T) {
+	observability.InitMetrics()
+
+	entered := make(chan struct{}, 1)
+	release := make(chan struct{})
+	defer close(release)
+	limited := NewConcurrencyLimitMiddleware(ConcurrencyLimitConfig{
+		MaxInFlight: 1,
+		RetryAfter:  3 * time.Second,
+	})(blockUntil(entered, release))
+
+	go limited.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/work", nil))
+	<-entered
+
+	w := httptest.NewRecorder()
+	limited.ServeHTTP(w, httptest.NewRequest("GET", "/work", nil))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "3" {
+		t.Errorf("Expected 503 with Retry-After 3, got %d %q", w.Code, w.Header().Get("Retry-After"))
+	}
+}
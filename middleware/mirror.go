@@ -0,0 +1,194 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"ping/observability"
+)
+
+// MirrorConfig configures shadow traffic.
+type MirrorConfig struct {
+	// Target is the shadow upstream; the request path and query are
+	// appended to it.
+	Target *url.URL
+	// Percent of eligible requests to mirror, 0-100.
+	Percent float64
+	// Timeout bounds each mirrored request. Defaults to 2s.
+	Timeout time.Duration
+	// MaxBodyBytes is the largest request body copied to the mirror;
+	// requests with bigger bodies are not mirrored. Defaults to 64 KiB.
+	MaxBodyBytes int64
+	// MaxInFlight caps concurrent mirrored requests so a slow shadow cannot
+	// pile up goroutines; excess requests are dropped. Defaults to 100.
+	MaxInFlight int
+	// ExemptPaths are never mirrored.
+	ExemptPaths []string
+	// Client sends mirrored requests. Nil uses http.DefaultTransport.
+	Client *http.Client
+	// ForwardCredentials copies the credentialHeaders to the mirror. They
+	// are stripped by default, since the shadow upstream is usually less
+	// trusted than the primary one.
+	ForwardCredentials bool
+	// Metrics counts mirroring outcomes; nil uses observability.GetMetrics().
+	Metrics observability.MetricsRecorder
+}
+
+// hopHeaders are connection-specific and must not be forwarded.
+var hopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
+	"Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// credentialHeaders carry the caller's identity, including the OIDC
+// session cookie, and are only mirrored with ForwardCredentials.
+var credentialHeaders = []string{"Authorization", "Cookie"}
+
+// NewMirrorMiddleware copies a sample of requests to a shadow upstream in
+// the background. The primary request is never delayed by, and never sees
+// the outcome of, the mirrored one. The correlation ID is propagated so
+// both sides can be matched in logs.
+func NewMirrorMiddleware(cfg MirrorConfig) func(http.Handler) http.Handler {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 2 * time.Second
+	}
+	if cfg.MaxBodyBytes <= 0 {
+		cfg.MaxBodyBytes = 64 << 10
+	}
+	if cfg.MaxInFlight <= 0 {
+		cfg.MaxInFlight = 100
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{}
+	}
+	exempt := make(map[string]bool, len(cfg.ExemptPaths))
+	for _, p := range cfg.ExemptPaths {
+		exempt[p] = true
+	}
+	m := &mirror{
+		cfg:     cfg,
+		metrics: metricsOrDefault(cfg.Metrics),
+		slots:   make(chan struct{}, cfg.MaxInFlight),
+		sample:  rand.Float64,
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !exempt[r.URL.Path] && m.sample()*100 < cfg.Percent {
+				r = m.send(r)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type mirror struct {
+	cfg     MirrorConfig
+	metrics observability.MetricsRecorder
+	slots   chan struct{}
+	sample  func() float64
+}
+
+// send starts mirroring r and returns the request the primary handler
+// should see, with its body restored.
+func (m *mirror) send(r *http.Request) *http.Request {
+	metrics := m.metrics
+
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		buf, err := io.ReadAll(io.LimitReader(r.Body, m.cfg.MaxBodyBytes+1))
+		// Whatever was read must still reach the primary handler
+		r.Body = readCloser{io.MultiReader(bytes.NewReader(buf), r.Body), r.Body}
+		if err != nil || int64(len(buf)) > m.cfg.MaxBodyBytes {
+			metrics.RecordMirror("skipped")
+			return r
+		}
+		body = buf
+	}
+
+	select {
+	case m.slots <- struct{}{}:
+	default:
+		metrics.RecordMirror("dropped")
+		return r
+	}
+
+	shadow, cancel := m.shadowRequest(r, body)
+	go func() {
+		defer func() { <-m.slots }()
+		defer cancel()
+		m.do(shadow)
+	}()
+	return r
+}
+
+func (m *mirror) shadowRequest(r *http.Request, body []byte) (*http.Request, context.CancelFunc) {
+	target := *m.cfg.Target
+	target.Path = strings.TrimSuffix(target.Path, "/") + r.URL.Path
+	target.RawQuery = r.URL.RawQuery
+
+	// Detach from the primary request so its completion does not cancel us
+	ctx, cancel := context.WithTimeout(context.Background(), m.cfg.Timeout)
+	correlationID := observability.GetCorrelationID(r.Context())
+	ctx = observability.WithCorrelationID(ctx, correlationID)
+	ctx = observability.WithLogger(ctx, observability.LoggerFromContext(r.Context()))
+	ctx = observability.WithSpanContext(ctx, observability.SpanContextFromContext(r.Context()))
+	ctx = observability.ContextWithBaggage(ctx, observability.BaggageFromContext(r.Context()))
+
+	shadow, _ := http.NewRequestWithContext(ctx, r.Method, target.String(), bytes.NewReader(body))
+	shadow.Header = r.Header.Clone()
+	for _, h := range hopHeaders {
+		shadow.Header.Del(h)
+	}
+	if !m.cfg.ForwardCredentials {
+		for _, h := range credentialHeaders {
+			shadow.Header.Del(h)
+		}
+	}
+	if correlationID != "" {
+		shadow.Header.Set(observability.RequestIDHeader, correlationID)
+	}
+	observability.InjectTraceContext(ctx, shadow.Header)
+	if observability.BaggageFromContext(ctx) != nil {
+		observability.InjectBaggage(ctx, shadow.Header)
+	}
+	shadow.Header.Set("X-Shadow-Request", "true")
+	shadow.Header.Add("X-Forwarded-For", ClientIP(r))
+	shadow.Host = r.Host
+	return shadow, cancel
+}
+
+func (m *mirror) do(shadow *http.Request) {
+	ctx := shadow.Context()
+	metrics := m.metrics
+
+	start := time.Now()
+	resp, err := m.cfg.Client.Do(shadow)
+	metrics.ObserveMirrorDuration(time.Since(start).Seconds())
+	if err != nil {
+		metrics.RecordMirror("error")
+		observability.LoggerFromContext(ctx).Debugf(ctx, "mirror request failed [%s] %s: %v (id=%s)",
+			shadow.Method, shadow.URL.Path, err, observability.GetCorrelationID(ctx))
+		return
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode >= 500 {
+		metrics.RecordMirror("error")
+		return
+	}
+	metrics.RecordMirror("success")
+}
+
+// readCloser pairs a replacement reader with the original body's Close.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,164 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"ping/observability"
+)
+
+type mirroredRequest struct {
+	method, path, body string
+	header             http.Header
+}
+
+// shadowServer records what the mirror sends to it.
+func shadowServer(t *testing.T, status int) (*url.URL, chan mirroredRequest) {
+	t.Helper()
+	got := make(chan mirroredRequest, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got <- mirroredRequest{r.Method, r.URL.RequestURI(), string(body), r.Header}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	u, _ := url.Parse(srv.URL + "/shadow")
+	return u, got
+}
+
+func waitForCounter(t *testing.T, metrics *observability.Metrics, result string, want float64) {
+	t.Helper()
+	counter := metrics.MirrorRequestsCounter.WithLabelValues(result)
+	deadline := time.Now().Add(2 * time.Second)
+	for testutil.ToFloat64(counter) < want {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s count %v, have %v", result, want, testutil.ToFloat64(counter))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestMirrorCopiesRequest(t *testing.T) {
+	metrics := observability.NewMetrics(observability.MetricsOptions{})
+	target, got := shadowServer(t, http.StatusOK)
+
+	var primaryBody string
+	handler := NewMirrorMiddleware(MirrorConfig{Target: target, Percent: 100, Metrics: metrics})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		primaryBody = string(b)
+	}))
+
+	req := httptest.NewRequest("POST", "/echo?x=1", strings.NewReader("payload"))
+	req.Header.Set("Connection", "close")
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	span := observability.ChildSpanContext(observability.SpanContext{})
+	ctx := observability.WithCorrelationID(req.Context(), "mirror-id")
+	ctx = observability.WithBaggage(ctx, "tenant", "acme")
+	req = req.WithContext(observability.WithSpanContext(ctx, span))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if primaryBody != "payload" {
+		t.Errorf("Primary handler should still read the body, got %q", primaryBody)
+	}
+	select {
+	case m := <-got:
+		if m.method != "POST" || m.path != "/shadow/echo?x=1" || m.body != "payload" {
+			t.Errorf("Unexpected mirrored request %+v", m)
+		}
+		if m.header.Get("X-Request-ID") != "mirror-id" || m.header.Get("X-Shadow-Request") != "true" {
+			t.Errorf("Expected correlation and shadow headers, got %v", m.header)
+		}
+		if m.header.Get("traceparent") != span.Traceparent() {
+			t.Errorf("Expected the server span as the mirror's parent, got %q", m.header.Get("traceparent"))
+		}
+		if m.header.Get("baggage") != "tenant=acme" {
+			t.Errorf("Expected baggage to be propagated, got %q", m.header.Get("baggage"))
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Request was not mirrored")
+	}
+	waitForCounter(t, metrics, "success", 1)
+}
+
+func TestMirrorSampling(t *testing.T) {
+	observability.InitMetrics()
+	target, got := shadowServer(t, http.StatusOK)
+
+	handler := NewMirrorMiddleware(MirrorConfig{Target: target, Percent: 0, ExemptPaths: []string{"/health"}})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	select {
+	case m := <-got:
+		t.Errorf("Nothing should be mirrored at 0%%, got %+v", m)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestMirrorSkipsLargeBodies(t *testing.T) {
+	metrics := observability.NewMetrics(observability.MetricsOptions{})
+	target, got := shadowServer(t, http.StatusOK)
+
+	var primaryBody string
+	handler := NewMirrorMiddleware(MirrorConfig{Target: target, Percent: 100, MaxBodyBytes: 4, Metrics: metrics})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		primaryBody = string(b)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader("too large body")))
+
+	if primaryBody != "too large body" {
+		t.Errorf("Primary handler must get the full body, got %q", primaryBody)
+	}
+	if testutil.ToFloat64(metrics.MirrorRequestsCounter.WithLabelValues("skipped")) != 1 {
+		t.Error("Expected skipped mirror to be counted")
+	}
+	select {
+	case <-got:
+		t.Error("Oversized request should not be mirrored")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestMirrorCountsErrors(t *testing.T) {
+	metrics := observability.NewMetrics(observability.MetricsOptions{})
+	target, got := shadowServer(t, http.StatusBadGateway)
+
+	handler := NewMirrorMiddleware(MirrorConfig{Target: target, Percent: 100, Metrics: metrics})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	<-got
+	waitForCounter(t, metrics, "error", 1)
+}
+
+func TestMirrorStripsCredentials(t *testing.T) {
+	observability.InitMetrics()
+	target, got := shadowServer(t, http.StatusOK)
+
+	for _, forward := range []bool{false, true} {
+		handler := NewMirrorMiddleware(MirrorConfig{Target: target, Percent: 100, ForwardCredentials: forward})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		req.Header.Set("Cookie", "ping_session=abc")
+		req.Header.Set("Accept", "application/json")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		select {
+		case m := <-got:
+			hasCredentials := m.header.Get("Authorization") != "" || m.header.Get("Cookie") != ""
+			if hasCredentials != forward {
+				t.Errorf("ForwardCredentials=%v: mirrored Authorization %q, Cookie %q", forward, m.header.Get("Authorization"), m.header.Get("Cookie"))
+			}
+			if m.header.Get("Accept") != "application/json" {
+				t.Errorf("Other headers should still be mirrored, got %v", m.header)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("Request was not mirrored")
+		}
+	}
+}
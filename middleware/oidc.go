@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"ping/auth"
+	"ping/observability"
+)
+
+// OIDCSessionConfig configures login-protected routes.
+type OIDCSessionConfig struct {
+	// OIDC validates session cookies.
+	OIDC *auth.OIDC
+	// LoginPath is where browsers without a session are sent.
+	LoginPath string
+	// AllowedGroups restricts access to members of any listed group;
+	// empty admits every signed-in user.
+	AllowedGroups []string
+	// Metrics counts failures; nil uses observability.GetMetrics().
+	Metrics observability.MetricsRecorder
+}
+
+// NewOIDCSessionMiddleware requires a signed-in user. Browsers without a
+// session are redirected to the login flow, API clients get 401, and users
+// outside AllowedGroups get 403. The session is stored in the request
+// context (see auth.SessionFromContext).
+func NewOIDCSessionMiddleware(cfg OIDCSessionConfig) func(http.Handler) http.Handler {
+	metrics := metricsOrDefault(cfg.Metrics)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			session, err := cfg.OIDC.Session(r)
+			if err != nil {
+				metrics.IncAuthFailures("oidc", "missing")
+				if r.Method == http.MethodGet && strings.Contains(r.Header.Get("Accept"), "text/html") {
+					http.Redirect(w, r, cfg.OIDC.LoginURL(cfg.LoginPath, r.URL.RequestURI()), http.StatusFound)
+					return
+				}
+				WriteJSONError(w, r, http.StatusUnauthorized, "login required")
+				return
+			}
+
+			observability.AddLogField(ctx, "user", session.Subject)
+			if !session.InGroup(cfg.AllowedGroups) {
+				metrics.IncAuthFailures("oidc", "forbidden")
+				WriteJSONError(w, r, http.StatusForbidden, "not a member of an allowed group")
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(auth.WithSession(ctx, session)))
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"ping/auth"
+	"ping/observability"
+)
+
+func oidcTestHandler(t *testing.T, groups []string, metrics *observability.Metrics) (http.Handler, *auth.OIDC) {
+	t.Helper()
+	o, err := auth.NewOIDC(auth.OIDCConfig{
+		IssuerURL:    "https://issuer.test",
+		ClientID:     "ping",
+		RedirectURL:  "https://ping.test/auth/callback",
+		CookieSecret: []byte("0123456789abcdef0123456789abcdef"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewOIDCSessionMiddleware(OIDCSessionConfig{
+		OIDC:          o,
+		LoginPath:     "/auth/login",
+		AllowedGroups: groups,
+		Metrics:       metrics,
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(auth.SessionFromContext(r.Context()).Subject))
+	}))
+	return h, o
+}
+
+func TestOIDCSessionMiddlewareWithoutSession(t *testing.T) {
+	metrics := observability.NewMetrics(observability.MetricsOptions{})
+	handler, _ := oidcTestHandler(t, nil, metrics)
+
+	req := httptest.NewRequest("GET", "/debug/requests?limit=5", nil)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusFound {
+		t.Fatalf("Expected browser redirect, got %d", w.Code)
+	}
+	if got := w.Header().Get("Location"); got != "/auth/login?return_to=%2Fdebug%2Frequests%3Flimit%3D5" {
+		t.Errorf("Unexpected login redirect %q", got)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/debug/requests", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for API clients, got %d", w.Code)
+	}
+	if got := testutil.ToFloat64(metrics.AuthFailureCounter.WithLabelValues("oidc", "missing")); got != 2 {
+		t.Errorf("Expected 2 missing-session failures in the configured metrics, got %v", got)
+	}
+}
+
+func TestOIDCSessionMiddlewareGroups(t *testing.T) {
+	observability.InitMetrics()
+	handler, o := oidcTestHandler(t, []string{"ops"}, nil)
+
+	for _, tt := range []struct {
+		groups []string
+		want   int
+	}{
+		{[]string{"dev", "ops"}, http.StatusOK},
+		{[]string{"dev"}, http.StatusForbidden},
+	} {
+		cookie, err := o.SessionCookie(&auth.Session{Subject: "alice", Groups: tt.groups, ExpiresAt: time.Now().Add(time.Hour)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest("GET", "/debug/requests", nil)
+		req.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != tt.want {
+			t.Errorf("groups %v: expected %d, got %d", tt.groups, tt.want, w.Code)
+		}
+		if tt.want == http.StatusOK && w.Body.String() != "alice" {
+			t.Errorf("Expected session in context, got %q", w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package middleware
+
+import (
+	"container/list"
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"ping/observability"
+)
+
+// RateLimitResult is the outcome of a single rate limit check.
+type RateLimitResult struct {
+	Allowed bool
+	// Limit is the bucket size (burst) the client is held to.
+	Limit int
+	// Remaining is how many requests the client may still make right now.
+	Remaining int
+	// RetryAfter is how long until the next request would be allowed;
+	// zero when Allowed is true and tokens remain.
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is completely refilled.
+	Reset time.Duration
+}
+
+// RateLimiter decides whether a request identified by key may proceed.
+type RateLimiter interface {
+	Allow(ctx context.Context, key string) RateLimitResult
+}
+
+// tokenBucket is the state for one client.
+type tokenBucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+// LocalRateLimiter is an in-process token bucket limiter. Buckets are kept
+// in an LRU so a flood of distinct clients cannot grow memory without bound;
+// an evicted client simply starts again with a full bucket.
+type LocalRateLimiter struct {
+	rate       float64
+	burst      int
+	maxClients int
+	now        func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*list.Element
+	lru     *list.List
+}
+
+// NewLocalRateLimiter allows each key rate requests per second with bursts
+// of up to burst, tracking at most maxClients keys.
+func NewLocalRateLimiter(rate float64, burst, maxClients int) *LocalRateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	if maxClients < 1 {
+		maxClients = 1
+	}
+	return &LocalRateLimiter{
+		rate:       rate,
+		burst:      burst,
+		maxClients: maxClients,
+		now:        time.Now,
+		buckets:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// Allow takes a token from key's bucket if one is available.
+func (l *LocalRateLimiter) Allow(_ context.Context, key string) RateLimitResult {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	b := l.bucket(key, now)
+
+	// Refill for the time since the last request
+	b.tokens = math.Min(float64(l.burst), b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	result := RateLimitResult{Limit: l.burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	}
+	result.Remaining = int(b.tokens)
+	result.RetryAfter, result.Reset = refillTimes(b.tokens, l.burst, l.rate)
+	return result
+}
+
+// refillTimes returns how long a bucket holding tokens needs to reach one
+// token (retryAfter) and to be full again (reset).
+func refillTimes(tokens float64, burst int, rate float64) (retryAfter, reset time.Duration) {
+	if rate <= 0 {
+		return 0, 0
+	}
+	if tokens < 1 {
+		retryAfter = time.Duration((1 - tokens) / rate * float64(time.Second))
+	}
+	reset = time.Duration((float64(burst) - tokens) / rate * float64(time.Second))
+	return retryAfter, reset
+}
+
+// bucket returns key's bucket, creating it (and evicting the least recently
+// used one if needed). The caller must hold l.mu.
+func (l *LocalRateLimiter) bucket(key string, now time.Time) *tokenBucket {
+	if el, ok := l.buckets[key]; ok {
+		l.lru.MoveToFront(el)
+		return el.Value.(*tokenBucket)
+	}
+
+	if l.lru.Len() >= l.maxClients {
+		oldest := l.lru.Back()
+		l.lru.Remove(oldest)
+		delete(l.buckets, oldest.Value.(*tokenBucket).key)
+	}
+
+	b := &tokenBucket{key: key, tokens: float64(l.burst), last: now}
+	l.buckets[key] = l.lru.PushFront(b)
+	return b
+}
+
+// Len returns the number of clients currently tracked.
+func (l *LocalRateLimiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lru.Len()
+}
+
+// RateLimitConfig configures the rate limiting middleware.
+type RateLimitConfig struct {
+	// Limiter makes the allow/deny decision.
+	Limiter RateLimiter
+	// KeyFunc identifies the client; nil uses ClientIP, which honours
+	// trusted proxies when the client IP middleware is installed.
+	KeyFunc func(*http.Request) string
+	// ExemptPaths are never rate limited.
+	ExemptPaths []string
+	// Headers adds X-RateLimit-* and draft-standard RateLimit-* headers
+	// to every limited response so clients can throttle themselves.
+	Headers bool
+	// Metrics counts decisions; nil uses observability.GetMetrics().
+	Metrics observability.MetricsRecorder
+}
+
+// NewRateLimitMiddleware rejects requests with 429 once a client exhausts
+// its allowance, counting every decision in http_rate_limit_decisions_total.
+func NewRateLimitMiddleware(cfg RateLimitConfig) func(http.Handler) http.Handler {
+	keyFunc := cfg.KeyFunc
+	if keyFunc == nil {
+		keyFunc = ClientIP
+	}
+	exempt := make(map[string]bool, len(cfg.ExemptPaths))
+	for _, p := range cfg.ExemptPaths {
+		exempt[p] = true
+	}
+	metrics := metricsOrDefault(cfg.Metrics)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if exempt[r.URL.Path] {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			result := cfg.Limiter.Allow(r.Context(), keyFunc(r))
+			if cfg.Headers {
+				setRateLimitHeaders(w, result)
+			}
+			if !result.Allowed {
+				metrics.RecordRateLimitDecision("limited")
+				setRetryAfter(w, result.RetryAfter)
+				WriteJSONError(w, r, http.StatusTooManyRequests, "rate limit exceeded")
+				return
+			}
+			metrics.RecordRateLimitDecision("allowed")
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// setRateLimitHeaders emits both the widespread X-RateLimit-* convention
+// (reset as a Unix timestamp) and the IETF draft RateLimit-* fields (reset
+// as delta seconds).
+func setRateLimitHeaders(w http.ResponseWriter, result RateLimitResult) {
+	resetSeconds := int64(math.Ceil(result.Reset.Seconds()))
+	limit := strconv.Itoa(result.Limit)
+	remaining := strconv.Itoa(result.Remaining)
+
+	h := w.Header()
+	h.Set("X-RateLimit-Limit", limit)
+	h.Set("X-RateLimit-Remaining", remaining)
+	h.Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Unix()+resetSeconds, 10))
+	h.Set("RateLimit-Limit", limit)
+	h.Set("RateLimit-Remaining", remaining)
+	h.Set("RateLimit-Reset", strconv.FormatInt(resetSeconds, 10))
+}
+
+// RemoteIP returns the IP address of the connection's peer, without the port.
+func RemoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"ping/observability"
+	"ping/redis"
+)
+
+// tokenBucketScript runs the token bucket atomically inside Redis, using the
+// server's clock so replicas with skewed clocks still agree.
+// KEYS[1] = bucket key; ARGV = rate per second, burst.
+// Returns {allowed (0/1), tokens left as a string}.
+const tokenBucketScript = `
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+tokens = math.min(burst, tokens + (now - ts) / 1000 * rate)
+local allowed = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+local ttl = 1000
+if rate > 0 then
+  ttl = math.ceil(burst / rate * 1000) + 1000
+end
+redis.call('PEXPIRE', KEYS[1], ttl)
+return {allowed, tostring(tokens)}
+`
+
+// tokenBucketSHA names the script for EVALSHA, so each check sends the
+// digest instead of the whole script body.
+var tokenBucketSHA = func() string {
+	sum := sha1.Sum([]byte(tokenBucketScript))
+	return hex.EncodeToString(sum[:])
+}()
+
+// RedisRateLimiter enforces a token bucket shared by every replica through
+// Redis. When Redis is unreachable it falls back to a per-instance
+// limiter and stops trying Redis for a cooldown period, so an outage
+// degrades limits to per-pod instead of failing requests.
+type RedisRateLimiter struct {
+	client    *redis.Client
+	rate      float64
+	burst     int
+	prefix    string
+	fallback  RateLimiter
+	metrics   observability.MetricsRecorder
+	cooldown  time.Duration
+	downUntil atomic.Int64 // unix nanoseconds
+}
+
+// NewRedisRateLimiter creates a limiter sharing buckets under keyPrefix.
+// fallback handles requests while Redis is unavailable; switching to it is
+// counted in metrics, or in observability.GetMetrics() when nil.
+func NewRedisRateLimiter(client *redis.Client, rate float64, burst int, keyPrefix string, fallback RateLimiter, metrics observability.MetricsRecorder) *RedisRateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RedisRateLimiter{
+		client:   client,
+		rate:     rate,
+		burst:    burst,
+		prefix:   keyPrefix,
+		fallback: fallback,
+		metrics:  metricsOrDefault(metrics),
+		cooldown: 5 * time.Second,
+	}
+}
+
+// Allow checks key's shared bucket, or the fallback while Redis is down.
+func (l *RedisRateLimiter) Allow(ctx context.Context, key string) RateLimitResult {
+	if time.Now().UnixNano() < l.downUntil.Load() {
+		return l.fallback.Allow(ctx, key)
+	}
+
+	result, err := l.allowRedis(ctx, key)
+	if err != nil && ctx.Err() != nil {
+		// The request went away, which says nothing about Redis
+		return l.fallback.Allow(ctx, key)
+	}
+	if err != nil {
+		l.downUntil.Store(time.Now().Add(l.cooldown).UnixNano())
+		l.metrics.IncRateLimitFallbacks()
+		observability.LoggerFromContext(ctx).Warnf(ctx, "rate limit backend unavailable, using local limits for %s: %v", l.cooldown, err)
+		return l.fallback.Allow(ctx, key)
+	}
+	return result
+}
+
+func (l *RedisRateLimiter) allowRedis(ctx context.Context, key string) (RateLimitResult, error) {
+	reply, err := l.client.Do(ctx, "EVALSHA", tokenBucketSHA, 1, l.prefix+key, l.rate, l.burst)
+	var serverErr redis.Error
+	if errors.As(err, &serverErr) && strings.HasPrefix(string(serverErr), "NOSCRIPT") {
+		// EVAL caches the script, so later EVALSHA calls find it
+		reply, err = l.client.Do(ctx, "EVAL", tokenBucketScript, 1, l.prefix+key, l.rate, l.burst)
+	}
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+
+	fields, ok := reply.([]interface{})
+	if !ok || len(fields) != 2 {
+		return RateLimitResult{}, fmt.Errorf("unexpected rate limit reply %#v", reply)
+	}
+	allowed, _ := fields[0].(int64)
+	tokensStr, _ := fields[1].(string)
+	tokens, err := strconv.ParseFloat(tokensStr, 64)
+	if err != nil {
+		return RateLimitResult{}, fmt.Errorf("unexpected token count %q: %w", tokensStr, err)
+	}
+
+	result := RateLimitResult{
+		Allowed:   allowed == 1,
+		Limit:     l.burst,
+		Remaining: int(tokens),
+	}
+	result.RetryAfter, result.Reset = refillTimes(tokens, l.burst, l.rate)
+	return result, nil
+}
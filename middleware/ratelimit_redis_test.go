@@ -0,0 +1,195 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"ping/observability"
+	"ping/redis"
+)
+
+// serveRESP accepts connections on ln and answers every command with reply.
+func serveRESP(ln net.Listener, reply string) {
+	serveRESPFunc(ln, func([]string) string { return reply })
+}
+
+// serveRESPFunc accepts connections on ln and answers each command with
+// handle's reply to its arguments.
+func serveRESPFunc(ln net.Listener, handle func(args []string) string) {
+	for {
+		nc, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer nc.Close()
+			rd := bufio.NewReader(nc)
+			for {
+				// Consume "*N" followed by N "$len" / data line pairs
+				header, err := rd.ReadString('\n')
+				if err != nil {
+					return
+				}
+				n, _ := strconv.Atoi(strings.TrimSpace(header[1:]))
+				args := make([]string, n)
+				for i := 0; i < n; i++ {
+					lenLine, err := rd.ReadString('\n')
+					if err != nil {
+						return
+					}
+					size, _ := strconv.Atoi(strings.TrimSpace(lenLine[1:]))
+					buf := make([]byte, size+2)
+					if _, err := io.ReadFull(rd, buf); err != nil {
+						return
+					}
+					args[i] = string(buf[:size])
+				}
+				nc.Write([]byte(handle(args)))
+			}
+		}()
+	}
+}
+
+func TestRedisRateLimiterUsesSharedBucket(t *testing.T) {
+	observability.InitMetrics()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	go serveRESP(ln, "*2\r\n:0\r\n$4\r\n0.25\r\n")
+
+	client := redis.NewClient(redis.Options{Addr: ln.Addr().String()})
+	defer client.Close()
+	fallback := NewLocalRateLimiter(100, 100, 10)
+	l := NewRedisRateLimiter(client, 1, 5, "test:", fallback, nil)
+
+	result := l.Allow(context.Background(), "10.0.0.1")
+	if result.Allowed {
+		t.Error("Expected the shared bucket's denial to be honoured")
+	}
+	if result.Limit != 5 || result.Remaining != 0 {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+	if result.RetryAfter != 750*time.Millisecond {
+		t.Errorf("Expected RetryAfter 750ms, got %s", result.RetryAfter)
+	}
+	if fallback.Len() != 0 {
+		t.Error("Fallback must not be consulted while Redis answers")
+	}
+}
+
+func TestRedisRateLimiterFallsBackWhenUnavailable(t *testing.T) {
+	observability.InitMetrics()
+
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := ln.Addr().String()
+	ln.Close()
+
+	client := redis.NewClient(redis.Options{Addr: addr, Timeout: 100 * time.Millisecond})
+	fallback := NewLocalRateLimiter(1, 1, 10)
+	metrics := observability.NewMetrics(observability.MetricsOptions{})
+	l := NewRedisRateLimiter(client, 1, 1, "test:", fallback, metrics)
+
+	ctx := observability.WithLogger(context.Background(), &recordingLogger{})
+	if !l.Allow(ctx, "10.0.0.1").Allowed {
+		t.Error("First request should be allowed by the fallback")
+	}
+	if l.Allow(ctx, "10.0.0.1").Allowed {
+		t.Error("Fallback limits should still apply")
+	}
+	if fallback.Len() != 1 {
+		t.Errorf("Expected fallback to track the client, got %d", fallback.Len())
+	}
+	if l.downUntil.Load() <= time.Now().UnixNano() {
+		t.Error("Expected Redis to be skipped during the cooldown")
+	}
+	if got := testutil.ToFloat64(metrics.RateLimitFallbackCounter); got != 1 {
+		t.Errorf("Expected one fallback in the injected metrics, got %v", got)
+	}
+}
+
+func TestRedisRateLimiterLoadsScriptOnNoScript(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	var mu sync.Mutex
+	var commands []string
+	loaded := false
+	go serveRESPFunc(ln, func(args []string) string {
+		mu.Lock()
+		defer mu.Unlock()
+		commands = append(commands, args[0])
+		switch {
+		case args[0] == "EVALSHA" && args[1] != tokenBucketSHA:
+			return "-ERR unexpected digest\r\n"
+		case args[0] == "EVALSHA" && !loaded:
+			return "-NOSCRIPT No matching script. Please use EVAL.\r\n"
+		case args[0] == "EVAL":
+			loaded = true
+		}
+		return "*2\r\n:1\r\n$1\r\n4\r\n"
+	})
+
+	client := redis.NewClient(redis.Options{Addr: ln.Addr().String()})
+	defer client.Close()
+	metrics := observability.NewMetrics(observability.MetricsOptions{})
+	l := NewRedisRateLimiter(client, 1, 5, "test:", NewLocalRateLimiter(1, 1, 10), metrics)
+
+	for i := 0; i < 2; i++ {
+		if !l.Allow(context.Background(), "10.0.0.1").Allowed {
+			t.Fatalf("Request %d should be allowed by the shared bucket", i)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if want := "EVALSHA EVAL EVALSHA"; strings.Join(commands, " ") != want {
+		t.Errorf("Expected commands %q, got %q", want, commands)
+	}
+	if got := testutil.ToFloat64(metrics.RateLimitFallbackCounter); got != 0 {
+		t.Errorf("Expected no fallback, got %v", got)
+	}
+}
+
+func TestRedisRateLimiterIgnoresCanceledRequests(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	go serveRESP(ln, "*2\r\n:1\r\n$1\r\n4\r\n")
+
+	client := redis.NewClient(redis.Options{Addr: ln.Addr().String()})
+	defer client.Close()
+	fallback := NewLocalRateLimiter(1, 1, 10)
+	metrics := observability.NewMetrics(observability.MetricsOptions{})
+	l := NewRedisRateLimiter(client, 1, 5, "test:", fallback, metrics)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	l.Allow(ctx, "10.0.0.1")
+	if l.downUntil.Load() != 0 {
+		t.Error("A canceled request must not start the cooldown")
+	}
+	if got := testutil.ToFloat64(metrics.RateLimitFallbackCounter); got != 0 {
+		t.Errorf("Expected no fallback counted, got %v", got)
+	}
+
+	fallback.Allow(context.Background(), "10.0.0.1")
+	if !l.Allow(context.Background(), "10.0.0.1").Allowed {
+		t.Error("Expected Redis to be consulted again right away")
+	}
+}
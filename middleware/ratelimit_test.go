@@ -0,0 +1,177 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"ping/observability"
+)
+
+// fakeClock returns a controllable time source for the limiter.
+func fakeClock(start time.Time) (func() time.Time, func(time.Duration)) {
+	now := start
+	return func() time.Time { return now }, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestLocalRateLimiterBurstAndRefill(t *testing.T) {
+	l := NewLocalRateLimiter(1, 2, 10)
+	now, advance := fakeClock(time.Unix(1000, 0))
+	l.now = now
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if !l.Allow(ctx, "a").Allowed {
+			t.Fatalf("Request %d within burst should be allowed", i)
+		}
+	}
+	denied := l.Allow(ctx, "a")
+	if denied.Allowed {
+		t.Fatal("Request beyond burst should be denied")
+	}
+	if denied.RetryAfter <= 0 || denied.RetryAfter > time.Second {
+		t.Errorf("Expected RetryAfter within one refill interval, got %s", denied.RetryAfter)
+	}
+
+	advance(time.Second)
+	if !l.Allow(ctx, "a").Allowed {
+		t.Error("A token should be refilled after one second")
+	}
+
+	if !l.Allow(ctx, "b").Allowed {
+		t.Error("Clients must not share buckets")
+	}
+}
+
+func TestLocalRateLimiterEvictsLeastRecentlyUsed(t *testing.T) {
+	l := NewLocalRateLimiter(0, 1, 2)
+	ctx := context.Background()
+
+	l.Allow(ctx, "a")
+	l.Allow(ctx, "b")
+	l.Allow(ctx, "a") // a is now most recently used
+	l.Allow(ctx, "c") // evicts b
+
+	if l.Len() != 2 {
+		t.Errorf("Expected 2 tracked clients, got %d", l.Len())
+	}
+	if !l.Allow(ctx, "b").Allowed {
+		t.Error("Evicted client should start over with a full bucket")
+	}
+	if l.Allow(ctx, "c").Allowed {
+		t.Error("Recently used client should keep its empty bucket")
+	}
+}
+
+func TestRateLimitMiddlewareReturns429(t *testing.T) {
+	observability.InitMetrics()
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	limited := NewRateLimitMiddleware(RateLimitConfig{
+		Limiter:     NewLocalRateLimiter(1, 1, 10),
+		ExemptPaths: []string{"/health"},
+	})(ok)
+
+	send := func(path, remote string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = remote
+		w := httptest.NewRecorder()
+		limited.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := send("/", "10.0.0.1:1234"); w.Code != http.StatusOK {
+		t.Fatalf("First request should pass, got %d", w.Code)
+	}
+	w := send("/", "10.0.0.1:5678")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Second request from same IP should be limited, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("Expected Retry-After on 429")
+	}
+	if w := send("/", "10.0.0.2:1234"); w.Code != http.StatusOK {
+		t.Errorf("Other IP should not be limited, got %d", w.Code)
+	}
+	if w := send("/health", "10.0.0.1:1234"); w.Code != http.StatusOK {
+		t.Errorf("Exempt path should not be limited, got %d", w.Code)
+	}
+}
+
+func TestRemoteIP(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "[::1]:8080"
+	if got := RemoteIP(req); got != "::1" {
+		t.Errorf("Expected ::1, got %s", got)
+	}
+
+	req.RemoteAddr = "not-an-addr"
+	if got := RemoteIP(req); got != "not-an-addr" {
+		t.Errorf("Unparseable address should be returned as-is, got %s", got)
+	}
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	observability.InitMetrics()
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	limited := NewRateLimitMiddleware(RateLimitConfig{
+		Limiter: NewLocalRateLimiter(1, 3, 10),
+		Headers: true,
+	})(ok)
+
+	w := httptest.NewRecorder()
+	limited.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	h := w.Header()
+	if h.Get("X-RateLimit-Limit") != "3" || h.Get("RateLimit-Limit") != "3" {
+		t.Errorf("Expected limit 3, got %q / %q", h.Get("X-RateLimit-Limit"), h.Get("RateLimit-Limit"))
+	}
+	if h.Get("X-RateLimit-Remaining") != "2" || h.Get("RateLimit-Remaining") != "2" {
+		t.Errorf("Expected 2 remaining, got %q / %q", h.Get("X-RateLimit-Remaining"), h.Get("RateLimit-Remaining"))
+	}
+	if h.Get("RateLimit-Reset") != "1" {
+		t.Errorf("Expected bucket to refill in 1s, got %q", h.Get("RateLimit-Reset"))
+	}
+	reset, err := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil || reset < time.Now().Unix() {
+		t.Errorf("Expected X-RateLimit-Reset as a future Unix timestamp, got %q", h.Get("X-RateLimit-Reset"))
+	}
+}
+
+func TestRateLimitHeadersDisabled(t *testing.T) {
+	observability.InitMetrics()
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	limited := NewRateLimitMiddleware(RateLimitConfig{Limiter: NewLocalRateLimiter(1, 3, 10)})(ok)
+
+	w := httptest.NewRecorder()
+	limited.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Header().Get("RateLimit-Limit") != "" {
+		t.Error("Headers should be omitted unless enabled")
+	}
+}
+
+func TestRateLimitMiddlewareUsesInjectedMetrics(t *testing.T) {
+	metrics := observability.NewMemoryRecorder()
+	handler := NewRateLimitMiddleware(RateLimitConfig{
+		Limiter: NewLocalRateLimiter(1, 1, 10),
+		Metrics: metrics,
+	})(http.NotFoundHandler())
+	for i := 0; i < 2; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}
+
+	for decision, want := range map[string]float64{"allowed": 1, "limited": 1} {
+		if got := metrics.Value("http_rate_limit_decisions_total", decision); got != want {
+			t.Errorf("Expected %v %s decisions in the injected metrics, got %v", want, decision, got)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"net/http"
+	"runtime/debug"
+
+	"ping/observability"
+)
+
+// RecoveryMiddleware is NewRecoveryMiddleware counting panics in
+// observability.GetMetrics().
+func RecoveryMiddleware(next http.Handler) http.Handler {
+	return NewRecoveryMiddleware(nil)(next)
+}
+
+// NewRecoveryMiddleware recovers panics raised by handlers, logs the stack
+// trace with the correlation ID, answers with a structured 500, and counts
+// the panic in http_panics_total of metrics, or of
+// observability.GetMetrics() when nil. It must run inside
+// RequestInstrumentationMiddleware so the correlation ID and logger are
+// already in the context and the 500 is recorded like any other response;
+// place it right inside it to cover the rest of the chain too. When the
+// response had already started, the 500 can no longer be sent, so the
+// response is aborted instead and the client sees it cut short.
+func NewRecoveryMiddleware(metrics observability.MetricsRecorder) func(http.Handler) http.Handler {
+	metrics = metricsOrDefault(metrics)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				rec := recover()
+				if rec == nil {
+					return
+				}
+				// ErrAbortHandler is net/http's way of aborting a response on purpose
+				if rec == http.ErrAbortHandler {
+					panic(rec)
+				}
+
+				ctx := r.Context()
+				correlationID := observability.GetCorrelationID(ctx)
+				metrics.IncPanics()
+				observability.LoggerFromContext(ctx).Errorf(ctx, "panic recovered [%s] %s: %v (id=%s)\n%s",
+					r.Method,
+					r.URL.Path,
+					rec,
+					correlationID,
+					debug.Stack())
+
+				if responseStarted(w) {
+					panic(http.ErrAbortHandler)
+				}
+				WriteJSONError(w, r, http.StatusInternalServerError, "internal server error")
+			}()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// responseStarted reports whether the instrumentation writer under w has
+// committed the response. Writers it cannot see through count as not
+// started.
+func responseStarted(w http.ResponseWriter) bool {
+	for {
+		if s, ok := w.(interface{ started() bool }); ok {
+			return s.started()
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return false
+		}
+		w = u.Unwrap()
+	}
+}
+
+// metricsOrDefault returns m, or the process-wide instance when m is nil.
+// Middleware resolves it once when built, so requests never consult the
+// global; pass Metrics explicitly to record into a separate registry.
+func metricsOrDefault(m observability.MetricsRecorder) observability.MetricsRecorder {
+	return observability.RecorderOrDefault(m)
+}
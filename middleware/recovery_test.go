@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"ping/observability"
+)
+
+func TestRecoveryMiddlewareReturns500(t *testing.T) {
+	observability.InitMetrics()
+	logger := &recordingLogger{}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	wrapped := NewRequestInstrumentationMiddleware(InstrumentationConfig{Logger: logger})(RecoveryMiddleware(handler))
+
+	req := httptest.NewRequest("GET", "/explode", nil)
+	req.Header.Set(observability.RequestIDHeader, "panic-id")
+	w := httptest.NewRecorder()
+	wrapped.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected status 500, got %d", w.Code)
+	}
+
+	var body errorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Expected JSON error body: %v", err)
+	}
+	if body.CorrelationID != "panic-id" || body.Error == "" {
+		t.Errorf("Unexpected error body: %+v", body)
+	}
+
+	joined := strings.Join(logger.messages, "\n")
+	if !strings.Contains(joined, "ERROR panic recovered [GET] /explode: boom (id=panic-id)") {
+		t.Errorf("Expected panic log line, got:\n%s", joined)
+	}
+	if !strings.Contains(joined, "goroutine") {
+		t.Errorf("Expected stack trace in panic log, got:\n%s", joined)
+	}
+	if !strings.Contains(joined, "/explode -> 500") {
+		t.Errorf("Instrumentation should record the 500, got:\n%s", joined)
+	}
+}
+
+func TestRecoveryMiddlewareAbortsStartedResponses(t *testing.T) {
+	metrics := observability.NewMetrics(observability.MetricsOptions{})
+	logger := &recordingLogger{}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		panic("boom")
+	})
+	wrapped := NewRequestInstrumentationMiddleware(InstrumentationConfig{Logger: logger, Metrics: metrics})(NewRecoveryMiddleware(metrics)(handler))
+
+	w := httptest.NewRecorder()
+	func() {
+		defer func() {
+			if rec := recover(); rec != http.ErrAbortHandler {
+				t.Errorf("Expected the response to be aborted, got %v", rec)
+			}
+		}()
+		wrapped.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	}()
+
+	if w.Body.String() != "partial" {
+		t.Errorf("Expected nothing appended to the partial body, got %q", w.Body.String())
+	}
+	if got := testutil.ToFloat64(metrics.PanicCounter); got != 1 {
+		t.Errorf("Expected the panic counted, got %v", got)
+	}
+	if !strings.Contains(strings.Join(logger.messages, "\n"), "panic recovered") {
+		t.Errorf("Expected the panic logged, got %v", logger.messages)
+	}
+}
+
+func TestRecoveryMiddlewarePassesThrough(t *testing.T) {
+	observability.InitMetrics()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("fine"))
+	})
+	w := httptest.NewRecorder()
+	RecoveryMiddleware(handler).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	if w.Code != http.StatusOK || w.Body.String() != "fine" {
+		t.Errorf("Expected untouched response, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestRecoveryMiddlewareRepanicsAbort(t *testing.T) {
+	observability.InitMetrics()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})
+
+	defer func() {
+		if rec := recover(); rec != http.ErrAbortHandler {
+			t.Errorf("Expected ErrAbortHandler to propagate, got %v", rec)
+		}
+	}()
+	RecoveryMiddleware(handler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
+
+func TestRecoveryMiddlewareUsesInjectedMetrics(t *testing.T) {
+	metrics := observability.NewMemoryRecorder()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	ctx := observability.WithLogger(context.Background(), &recordingLogger{})
+	NewRecoveryMiddleware(metrics)(handler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil).WithContext(ctx))
+
+	if got := metrics.Value("http_panics_total"); got != 1 {
+		t.Errorf("Expected the panic counted in the injected metrics, got %v", got)
+	}
+}
@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// RedactedValue replaces sensitive values in log output.
+const RedactedValue = "[REDACTED]"
+
+// RedactionConfig controls what the instrumentation middleware masks before
+// request details reach the logs.
+type RedactionConfig struct {
+	// QueryParams lists query parameter names (case-insensitive) whose
+	// values are masked. "*" masks every parameter value.
+	QueryParams []string
+	// Headers lists header names whose values are masked when headers are logged.
+	Headers []string
+	// MaxUserAgentLength truncates logged user agents; zero disables truncation.
+	MaxUserAgentLength int
+}
+
+// DefaultRedaction masks the credentials commonly found in requests.
+func DefaultRedaction() RedactionConfig {
+	return RedactionConfig{
+		QueryParams:        []string{"token", "access_token", "api_key", "apikey", "password", "secret"},
+		Headers:            []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"},
+		MaxUserAgentLength: 256,
+	}
+}
+
+func (c RedactionConfig) redactsQueryParam(name string) bool {
+	for _, p := range c.QueryParams {
+		if p == "*" || strings.EqualFold(p, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c RedactionConfig) redactsHeader(name string) bool {
+	for _, h := range c.Headers {
+		if strings.EqualFold(h, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// RequestURI returns the path and query of u with sensitive query values masked.
+func (c RedactionConfig) RequestURI(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.EscapedPath()
+	}
+	query, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		// An unparseable query may still hold secrets, so drop it entirely
+		return u.EscapedPath() + "?" + RedactedValue
+	}
+	for name, values := range query {
+		if c.redactsQueryParam(name) {
+			for i := range values {
+				values[i] = RedactedValue
+			}
+		}
+	}
+	// Encode escapes the brackets, which only hurts readability here
+	return u.EscapedPath() + "?" + strings.ReplaceAll(query.Encode(), url.QueryEscape(RedactedValue), RedactedValue)
+}
+
+// FormatHeaders formats h for logging as {Name: value, ...} with sensitive values masked.
+func (c RedactionConfig) FormatHeaders(h http.Header) string {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(name)
+		b.WriteString(": ")
+		if c.redactsHeader(name) {
+			b.WriteString(RedactedValue)
+		} else {
+			b.WriteString(strings.Join(h[name], ","))
+		}
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// UserAgent returns ua truncated to MaxUserAgentLength bytes.
+func (c RedactionConfig) UserAgent(ua string) string {
+	if c.MaxUserAgentLength <= 0 || len(ua) <= c.MaxUserAgentLength {
+		return ua
+	}
+	return ua[:c.MaxUserAgentLength] + "..."
+}
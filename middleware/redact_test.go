@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestRedactRequestURI(t *testing.T) {
+	cfg := DefaultRedaction()
+
+	u, _ := url.Parse("/search?q=go&token=s3cret&API_KEY=abc")
+	got := cfg.RequestURI(u)
+
+	if strings.Contains(got, "s3cret") || strings.Contains(got, "abc") {
+		t.Errorf("Sensitive values leaked: %s", got)
+	}
+	if !strings.Contains(got, "q=go") {
+		t.Errorf("Non-sensitive values should be kept: %s", got)
+	}
+	if !strings.Contains(got, "token="+RedactedValue) {
+		t.Errorf("Expected masked token, got %s", got)
+	}
+}
+
+func TestRedactRequestURIWildcard(t *testing.T) {
+	cfg := RedactionConfig{QueryParams: []string{"*"}}
+
+	u, _ := url.Parse("/search?q=private")
+	if got := cfg.RequestURI(u); strings.Contains(got, "private") {
+		t.Errorf("Wildcard should mask every value, got %s", got)
+	}
+}
+
+func TestRedactRequestURIWithoutQuery(t *testing.T) {
+	u, _ := url.Parse("/plain")
+	if got := DefaultRedaction().RequestURI(u); got != "/plain" {
+		t.Errorf("Expected /plain, got %s", got)
+	}
+}
+
+func TestFormatHeaders(t *testing.T) {
+	h := http.Header{}
+	h.Set("Authorization", "Bearer secret")
+	h.Set("Cookie", "session=abc")
+	h.Set("Accept", "text/plain")
+
+	got := DefaultRedaction().FormatHeaders(h)
+
+	want := "{Accept: text/plain, Authorization: [REDACTED], Cookie: [REDACTED]}"
+	if got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+func TestTruncateUserAgent(t *testing.T) {
+	cfg := RedactionConfig{MaxUserAgentLength: 5}
+
+	if got := cfg.UserAgent("curl/8.0.1"); got != "curl/..." {
+		t.Errorf("Expected truncated user agent, got %s", got)
+	}
+	if got := cfg.UserAgent("curl"); got != "curl" {
+		t.Errorf("Short user agent should be unchanged, got %s", got)
+	}
+	if got := (RedactionConfig{}).UserAgent("curl/8.0.1"); got != "curl/8.0.1" {
+		t.Errorf("Zero limit should disable truncation, got %s", got)
+	}
+}
@@ -3,31 +3,133 @@ package middleware
 import (
 	"context"
 	"fmt"
-	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"ping/observability"
+	"ping/tracing"
 )
 
-// ResponseWriter is a wrapper around http.ResponseWriter that captures the status code and size
-type responseWriter struct {
-	http.ResponseWriter
-	statusCode int
-	written    int64
+// InstrumentationConfig tunes the logging done by the instrumentation middleware.
+// The zero value logs a start and a completion line for every request.
+type InstrumentationConfig struct {
+	// TailLogging suppresses start lines and only logs the completion of
+	// requests that failed (status >= 400) or exceeded TailLatencyThreshold.
+	// Suppressed requests are still counted in metrics.
+	TailLogging bool
+	// TailLatencyThreshold is the duration above which a successful request
+	// is logged in tail mode. Zero means only failed requests are logged.
+	TailLatencyThreshold time.Duration
+	// SlowRequestThreshold is the duration above which a request is logged
+	// as a WARN with full detail and counted in http_slow_requests_total.
+	// Zero disables slow-request detection.
+	SlowRequestThreshold time.Duration
+	// Redaction masks sensitive query parameters and headers and
+	// truncates user agents in log lines.
+	Redaction RedactionConfig
+	// BodyCapture logs truncated request and response bodies for
+	// selected routes or requests carrying the debug header.
+	BodyCapture BodyCaptureConfig
+	// Tracer, when set, records a server span for every request and
+	// exports the sampled ones.
+	Tracer *tracing.Tracer
+	// RecentRequests, when set, receives a summary of every completed
+	// request for the /debug/requests endpoint.
+	RecentRequests *observability.RequestRing
+	// Stats, when set, counts every request in the rolling window served
+	// by the /stats endpoint.
+	Stats *observability.RequestStats
+	// Logger receives the middleware's log lines and is handed to
+	// handlers through the request context. Nil uses observability.DefaultLogger.
+	Logger observability.Logger
+	// IDGenerator creates correlation IDs for requests that arrive without
+	// one. Nil uses observability.DefaultIDGenerator.
+	IDGenerator observability.IDGenerator
+	// Clock times requests and their time to first byte. Nil uses
+	// observability.DefaultClock.
+	Clock observability.Clock
+	// Routes, when set, resolves each request to the mux pattern that
+	// serves it for the route metric label. Without it the pattern the
+	// innermost mux recorded on the request is used; requests matching no
+	// pattern are labeled "other".
+	Routes *http.ServeMux
+	// Metrics receives the request measurements. Nil records them in
+	// observability.GetMetrics(); use observability.NoopRecorder{} to turn
+	// them off. It covers only this middleware's request metrics.
+	Metrics observability.MetricsRecorder
+	// RouteNormalizer, when set, labels requests served by a subtree
+	// pattern such as the catch-all "/", or by no pattern, with their
+	// normalized path instead.
+	RouteNormalizer *observability.RouteNormalizer
 }
 
-// WriteHeader captures the status code
-func (rw *responseWriter) WriteHeader(code int) {
-	rw.statusCode = code
-	rw.ResponseWriter.WriteHeader(code)
+// The correlation headers in canonical form: indexing header maps with
+// them skips canonicalizing on every request.
+var (
+	requestIDKey             = http.CanonicalHeaderKey(observability.RequestIDHeader)
+	correlationIDKey         = http.CanonicalHeaderKey(observability.CorrelationIDHeader)
+	responseCorrelationIDKey = http.CanonicalHeaderKey(observability.ResponseCorrelationIDHeader)
+	hopIDKey                 = http.CanonicalHeaderKey(observability.HopIDHeader)
+	traceparentKey           = http.CanonicalHeaderKey(observability.TraceparentHeader)
+)
+
+// responseWriters recycles the writers wrapping each response.
+var responseWriters = sync.Pool{New: func() any { return new(responseWriter) }}
+
+// lineBuffers recycles the buffers request log lines are built in.
+var lineBuffers = sync.Pool{New: func() any {
+	b := make([]byte, 0, 256)
+	return &b
+}}
+
+// headerValue returns the first value of the canonical header key.
+func headerValue(h http.Header, key string) string {
+	if values := h[key]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
 }
 
-// Write captures the response size
-func (rw *responseWriter) Write(b []byte) (int, error) {
-	n, err := rw.ResponseWriter.Write(b)
-	rw.written += int64(n)
-	return n, err
+// logLine logs the line build appends to a pooled buffer at info level.
+// The start and completion lines of every request are built this way: with
+// fmt, each argument and the formatted message would allocate. Loggers
+// implementing observability.LineLogger take the buffer without a copy.
+func logLine(ctx context.Context, logger observability.Logger, build func([]byte) []byte) {
+	bp := lineBuffers.Get().(*[]byte)
+	b := build((*bp)[:0])
+	if ll, ok := logger.(observability.LineLogger); ok {
+		ll.InfoLine(ctx, b)
+	} else {
+		logger.Infof(ctx, "%s", b)
+	}
+	*bp = b
+	lineBuffers.Put(bp)
+}
+
+// route returns the bounded route label for r.
+func (c InstrumentationConfig) route(r *http.Request) string {
+	pattern := r.Pattern
+	if c.Routes != nil {
+		_, pattern = c.Routes.Handler(r)
+	}
+	if c.RouteNormalizer != nil && (pattern == "" || strings.HasSuffix(pattern, "/")) {
+		return c.RouteNormalizer.Normalize(r.URL.Path)
+	}
+	if pattern == "" {
+		return observability.OtherRoute
+	}
+	return pattern
+}
+
+// shouldLogCompletion reports whether a finished request gets a log line.
+func (c InstrumentationConfig) shouldLogCompletion(status int, duration time.Duration) bool {
+	if !c.TailLogging || status >= 400 {
+		return true
+	}
+	return c.TailLatencyThreshold > 0 && duration > c.TailLatencyThreshold
 }
 
 // RequestInstrumentationMiddleware wraps an HTTP handler with:
@@ -36,82 +138,236 @@ func (rw *responseWriter) Write(b []byte) (int, error) {
 // - Metrics recording (counters, histograms, gauges)
 // - Correlation ID propagation via context
 func RequestInstrumentationMiddleware(next http.Handler) http.Handler {
+	return NewRequestInstrumentationMiddleware(InstrumentationConfig{Redaction: DefaultRedaction()})(next)
+}
+
+// NewRequestInstrumentationMiddleware returns the instrumentation middleware
+// configured by cfg.
+func NewRequestInstrumentationMiddleware(cfg InstrumentationConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return instrument(next, cfg)
+	}
+}
+
+func instrument(next http.Handler, cfg InstrumentationConfig) http.Handler {
+	logger := cfg.Logger
+	if logger == nil {
+		logger = observability.DefaultLogger
+	}
+	newID := observability.GenerateCorrelationID
+	if cfg.IDGenerator != nil {
+		newID = cfg.IDGenerator.NewID
+	}
+	clock := cfg.Clock
+	if clock == nil {
+		clock = observability.DefaultClock
+	}
+	metrics := observability.RecorderOrDefault(cfg.Metrics)
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Get or create correlation ID from headers
-		correlationID := r.Header.Get(observability.RequestIDHeader)
+		// Every hop gets its own ID; the correlation ID is kept from the
+		// caller, or is this hop's ID when the request starts here
+		hopID := newID()
+		correlationID := headerValue(r.Header, requestIDKey)
 		if correlationID == "" {
-			correlationID = r.Header.Get(observability.CorrelationIDHeader)
+			correlationID = headerValue(r.Header, correlationIDKey)
 		}
 		if correlationID == "" {
-			correlationID = observability.GenerateCorrelationID()
+			correlationID = hopID
 		}
 
-		// Add correlation ID to context
+		// Add correlation and hop IDs and logger to context
 		ctx := observability.WithCorrelationID(r.Context(), correlationID)
+		ctx = observability.WithHopID(ctx, hopID)
+		ctx = observability.WithLogger(ctx, logger)
+		ctx = observability.WithLogFields(ctx)
+		ctx = observability.WithHandlerName(ctx)
+
+		// Continue the caller's W3C trace, or start a new one; with a tracer
+		// the server span is also recorded and exported
+		parent, _ := observability.ExtractTraceContext(r.Header)
+		var span *tracing.Span
+		spanContext := observability.ChildSpanContext(parent)
+		if cfg.Tracer != nil {
+			span = cfg.Tracer.StartRequest(parent, r)
+			spanContext = span.Context
+		}
+		ctx = observability.WithSpanContext(ctx, spanContext)
+		if baggage := observability.ExtractBaggage(r.Header); len(baggage) > 0 {
+			ctx = observability.ContextWithBaggage(ctx, baggage)
+		}
 		r = r.WithContext(ctx)
 
-		// Add correlation ID to response headers so client can see it
-		w.Header().Set(observability.ResponseCorrelationIDHeader, correlationID)
+		// Add correlation ID and trace context to response headers so client can see them
+		header := w.Header()
+		header[responseCorrelationIDKey] = []string{correlationID}
+		header[hopIDKey] = []string{hopID}
+		header[traceparentKey] = []string{spanContext.Traceparent()}
 
-		// Initialize metrics
-		metrics := observability.GetMetrics()
-		startTime := time.Now()
+		startTime := clock.Now()
 
 		// Record request initiation
 		defer metrics.RecordRequest()()
+		if cfg.Stats != nil {
+			defer cfg.Stats.Start()()
+		}
 
-		// Wrap response writer to capture status and size
-		rw := &responseWriter{
+		// Wrap response writer to capture status and size; writers are
+		// recycled once the request is done with
+		rw := responseWriters.Get().(*responseWriter)
+		*rw = responseWriter{
 			ResponseWriter: w,
 			statusCode:     http.StatusOK, // default
+			start:          startTime,
+			clock:          clock,
 		}
 
-		// Calculate request size
-		requestSize := float64(r.ContentLength)
-		if requestSize > 0 {
-			metrics.ObserveRequestSize(requestSize)
+		// Keep copies of the bodies when debug capture applies to this request
+		var requestCapture *captureBuffer
+		if cfg.BodyCapture.enabled(r) {
+			requestCapture = &captureBuffer{limit: cfg.BodyCapture.MaxBytes}
+			rw.capture = &captureBuffer{limit: cfg.BodyCapture.MaxBytes}
+			if r.Body != nil && r.Body != http.NoBody {
+				r.Body = &teeBody{ReadCloser: r.Body, capture: requestCapture}
+			}
 		}
 
-		// Log request start
-		log.Printf("[%s] %s %s %s (id=%s)",
-			r.Method,
-			r.URL.Path,
-			r.RemoteAddr,
-			r.UserAgent(),
-			correlationID)
+		// Log request start (tail mode only reports finished requests)
+		if !cfg.TailLogging {
+			logLine(ctx, logger, func(b []byte) []byte {
+				// [GET] /path 10.0.0.1 curl/8.0 (id=..., hop=...)
+				b = append(b, '[')
+				b = append(b, r.Method...)
+				b = append(b, "] "...)
+				b = append(b, r.URL.Path...)
+				b = append(b, ' ')
+				b = append(b, ClientIP(r)...)
+				b = append(b, ' ')
+				b = append(b, cfg.Redaction.UserAgent(r.UserAgent())...)
+				b = append(b, " (id="...)
+				b = append(b, correlationID...)
+				b = append(b, ", hop="...)
+				b = append(b, hopID...)
+				return append(b, ')')
+			})
+		}
 
 		// Call next handler
-		next.ServeHTTP(rw, r)
+		next.ServeHTTP(rw.exposed(), r)
 
-		// Record metrics
-		duration := time.Since(startTime).Seconds()
-		metrics.ObserveDuration(metrics.RequestDuration, duration)
-		metrics.ObserveResponseSize(float64(rw.written))
+		// Record metrics under the route that served the request
+		endTime := clock.Now()
+		elapsed := endTime.Sub(startTime)
+		duration := elapsed.Seconds()
+		route := cfg.route(r)
+		var exemplar observability.SpanContext
+		if span != nil {
+			// Exemplars point at exported traces only
+			exemplar = span.Context
+		}
+		metrics.RecordResponse(r.Method, route, observability.GetHandlerName(ctx), rw.statusCode, duration, exemplar)
+		ttfb := rw.timeToFirstByte(endTime)
+		metrics.ObserveTimeToFirstByte(r.Method, route, ttfb.Seconds())
+		if r.ContentLength > 0 {
+			metrics.ObserveRequestSize(r.Method, route, float64(r.ContentLength))
+		}
+		metrics.ObserveResponseSize(r.Method, route, float64(rw.written))
 
 		// Log request completion
-		log.Printf("[%s] %s -> %d (duration=%.3fs, responseSize=%d, id=%s)",
-			r.Method,
-			r.URL.Path,
-			rw.statusCode,
-			duration,
-			rw.written,
-			correlationID)
-
-		// Record HTTP errors
-		if rw.statusCode >= 500 {
-			metrics.HTTPErrorCounter.Inc()
+		if cfg.shouldLogCompletion(rw.statusCode, elapsed) {
+			logLine(ctx, logger, func(b []byte) []byte {
+				// [GET] /path -> 200 (duration=0.004s, responseSize=5, id=..., hop=...)
+				b = append(b, '[')
+				b = append(b, r.Method...)
+				b = append(b, "] "...)
+				b = append(b, r.URL.Path...)
+				b = append(b, " -> "...)
+				b = strconv.AppendInt(b, int64(rw.statusCode), 10)
+				b = append(b, " (duration="...)
+				b = strconv.AppendFloat(b, duration, 'f', 3, 64)
+				b = append(b, "s, responseSize="...)
+				b = strconv.AppendInt(b, rw.written, 10)
+				b = append(b, ", id="...)
+				b = append(b, correlationID...)
+				b = append(b, ", hop="...)
+				b = append(b, hopID...)
+				b = append(b, observability.FormatLogFields(ctx)...)
+				return append(b, ')')
+			})
+		} else {
+			metrics.IncSuppressedLogs()
 		}
+
+		if cfg.Stats != nil {
+			cfg.Stats.Record(rw.statusCode, elapsed)
+		}
+		if cfg.RecentRequests != nil {
+			cfg.RecentRequests.Add(observability.RequestSummary{
+				Time:          startTime,
+				Method:        r.Method,
+				Path:          r.URL.Path,
+				Status:        rw.statusCode,
+				DurationMs:    duration * 1000,
+				CorrelationID: correlationID,
+				HopID:         hopID,
+				TraceID:       spanContext.TraceID.String(),
+			})
+		}
+
+		if requestCapture != nil {
+			logger.Debugf(ctx, "body capture [%s] %s -> %d (requestBody=%q, responseBody=%q, id=%s)",
+				r.Method,
+				cfg.Redaction.RequestURI(r.URL),
+				rw.statusCode,
+				requestCapture.String(),
+				rw.capture.String(),
+				correlationID)
+		}
+
+		// Flag slow requests with everything needed to chase the tail latency
+		if cfg.SlowRequestThreshold > 0 && elapsed > cfg.SlowRequestThreshold {
+			metrics.IncSlowRequests()
+			logger.Warnf(ctx, "slow request [%s] %s -> %d (duration=%.3fs, ttfb=%.3fs, threshold=%s, remote=%s, userAgent=%q, headers=%s, requestSize=%d, responseSize=%d, id=%s, hop=%s)",
+				r.Method,
+				cfg.Redaction.RequestURI(r.URL),
+				rw.statusCode,
+				duration,
+				ttfb.Seconds(),
+				cfg.SlowRequestThreshold,
+				ClientIP(r),
+				cfg.Redaction.UserAgent(r.UserAgent()),
+				cfg.Redaction.FormatHeaders(r.Header),
+				r.ContentLength,
+				rw.written,
+				correlationID,
+				hopID)
+		}
+
+		if span != nil {
+			span.SetAttribute("http.request.method", r.Method)
+			span.SetAttribute("url.path", r.URL.Path)
+			span.SetAttribute("client.address", ClientIP(r))
+			span.SetAttribute("http.response.status_code", rw.statusCode)
+			span.SetAttribute("http.response.body.size", rw.written)
+			span.SetError(rw.statusCode >= 500)
+			span.End()
+		}
+
+		// Nothing may hold on to the writer past this point
+		*rw = responseWriter{}
+		responseWriters.Put(rw)
 	})
 }
 
-// ContextLogMiddleware logs operations with the correlation ID from context
+// LogWithCorrelationID logs an info message through the context's logger,
+// prefixed with the correlation ID from context.
 // This is useful for operations that receive context but need to log with correlation ID
 func LogWithCorrelationID(ctx context.Context, message string, args ...interface{}) {
+	logger := observability.LoggerFromContext(ctx)
 	correlationID := observability.GetCorrelationID(ctx)
 	if correlationID != "" {
-		prefix := fmt.Sprintf("[%s]", correlationID)
-		log.Printf("%s %s", prefix, fmt.Sprintf(message, args...))
+		logger.Infof(ctx, "[%s] %s", correlationID, fmt.Sprintf(message, args...))
 	} else {
-		log.Printf(message, args...)
+		logger.Infof(ctx, message, args...)
 	}
 }
@@ -3,14 +3,21 @@ package middleware
 import (
 	"bytes"
 	"context"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"sync"
 	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 
 	"ping/observability"
+	"ping/tracing"
 )
 
 func TestRequestInstrumentationMiddlewareWithoutHeader(t *testing.T) {
@@ -205,7 +212,7 @@ func TestLogWithCorrelationID(t *testing.T) {
 
 	// We can't easily intercept the standard log package in this test,
 	// but we can verify the function doesn't panic
-	ctx := observability.WithCorrelationID(nil, "test-id")
+	ctx := observability.WithCorrelationID(context.Background(), "test-id")
 
 	// This should not panic
 	LogWithCorrelationID(ctx, "test message")
@@ -330,3 +337,600 @@ func TestLogWithCorrelationIDNoContext(t *testing.T) {
 		t.Error("Context should still be valid")
 	}
 }
+
+// captureLog redirects the standard logger into a buffer for the duration of the test.
+func captureLog(t testing.TB) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prev := log.Writer()
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(prev) })
+	return &buf
+}
+
+func TestTailLoggingSuppressesFastSuccess(t *testing.T) {
+	observability.InitMetrics()
+	buf := captureLog(t)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	wrapped := NewRequestInstrumentationMiddleware(InstrumentationConfig{
+		TailLogging:          true,
+		TailLatencyThreshold: time.Hour,
+	})(handler)
+
+	wrapped.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/fast", nil))
+
+	if buf.Len() != 0 {
+		t.Errorf("Expected no log output for a fast successful request, got %q", buf.String())
+	}
+}
+
+func TestTailLoggingLogsFailuresAndSlowRequests(t *testing.T) {
+	observability.InitMetrics()
+
+	tests := []struct {
+		name      string
+		status    int
+		delay     time.Duration
+		threshold time.Duration
+	}{
+		{"client error", http.StatusNotFound, 0, time.Hour},
+		{"server error", http.StatusInternalServerError, 0, time.Hour},
+		{"slow success", http.StatusOK, 20 * time.Millisecond, time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := captureLog(t)
+			clock := observability.NewFakeClock(time.Unix(1000, 0))
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				clock.Advance(tt.delay)
+				w.WriteHeader(tt.status)
+			})
+			wrapped := NewRequestInstrumentationMiddleware(InstrumentationConfig{
+				TailLogging:          true,
+				TailLatencyThreshold: tt.threshold,
+				Clock:                clock,
+			})(handler)
+
+			wrapped.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/tail", nil))
+
+			out := buf.String()
+			if strings.Count(out, "\n") != 1 {
+				t.Errorf("Expected exactly one completion line, got %q", out)
+			}
+			if !strings.Contains(out, "/tail ->") {
+				t.Errorf("Expected completion line, got %q", out)
+			}
+		})
+	}
+}
+
+func TestSlowRequestLogsWarning(t *testing.T) {
+	observability.InitMetrics()
+	buf := captureLog(t)
+
+	clock := observability.NewFakeClock(time.Unix(1000, 0))
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clock.Advance(20 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	})
+	wrapped := NewRequestInstrumentationMiddleware(InstrumentationConfig{
+		SlowRequestThreshold: time.Millisecond,
+		Clock:                clock,
+	})(handler)
+
+	req := httptest.NewRequest("GET", "/slow?page=2", nil)
+	req.Header.Set(observability.RequestIDHeader, "slow-id")
+	wrapped.ServeHTTP(httptest.NewRecorder(), req)
+
+	out := buf.String()
+	if !strings.Contains(out, "WARN slow request [GET] /slow?page=2 -> 200") {
+		t.Errorf("Expected slow request warning, got %q", out)
+	}
+	if !strings.Contains(out, "id=slow-id") {
+		t.Errorf("Expected correlation ID in slow request warning, got %q", out)
+	}
+}
+
+func TestFastRequestNotFlaggedSlow(t *testing.T) {
+	observability.InitMetrics()
+	buf := captureLog(t)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	wrapped := NewRequestInstrumentationMiddleware(InstrumentationConfig{
+		SlowRequestThreshold: time.Hour,
+	})(handler)
+
+	wrapped.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/fast", nil))
+
+	if strings.Contains(buf.String(), "WARN") {
+		t.Errorf("Fast request must not be flagged slow, got %q", buf.String())
+	}
+}
+
+func TestSlowRequestLogIsRedacted(t *testing.T) {
+	observability.InitMetrics()
+	buf := captureLog(t)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+	})
+	wrapped := NewRequestInstrumentationMiddleware(InstrumentationConfig{
+		SlowRequestThreshold: time.Millisecond,
+		Redaction:            DefaultRedaction(),
+	})(handler)
+
+	req := httptest.NewRequest("GET", "/slow?token=hunter2", nil)
+	req.Header.Set("Authorization", "Bearer hunter2")
+	wrapped.ServeHTTP(httptest.NewRecorder(), req)
+
+	out := buf.String()
+	if strings.Contains(out, "hunter2") {
+		t.Errorf("Secret leaked into logs: %q", out)
+	}
+	if !strings.Contains(out, "Authorization: "+RedactedValue) {
+		t.Errorf("Expected redacted Authorization header in slow log, got %q", out)
+	}
+}
+
+func TestMiddlewareRecordsRecentRequests(t *testing.T) {
+	observability.InitMetrics()
+
+	ring := observability.NewRequestRing(4)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	wrapped := NewRequestInstrumentationMiddleware(InstrumentationConfig{RecentRequests: ring})(handler)
+
+	req := httptest.NewRequest("POST", "/brew?secret=1", nil)
+	req.Header.Set(observability.RequestIDHeader, "ring-id")
+	wrapped.ServeHTTP(httptest.NewRecorder(), req)
+
+	got := ring.Snapshot()
+	if len(got) != 1 {
+		t.Fatalf("Expected one recorded request, got %d", len(got))
+	}
+	s := got[0]
+	if s.Method != "POST" || s.Path != "/brew" || s.Status != http.StatusTeapot || s.CorrelationID != "ring-id" {
+		t.Errorf("Unexpected summary: %+v", s)
+	}
+}
+
+func TestMiddlewareRecordsStats(t *testing.T) {
+	observability.InitMetrics()
+
+	stats := observability.NewRequestStats(time.Minute)
+	var active int64
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		active = stats.Snapshot().ActiveRequests
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	wrapped := NewRequestInstrumentationMiddleware(InstrumentationConfig{Stats: stats})(handler)
+
+	wrapped.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	got := stats.Snapshot()
+	if active != 1 || got.ActiveRequests != 0 {
+		t.Errorf("Expected one active request during the handler and none after, got %d and %d", active, got.ActiveRequests)
+	}
+	if got.Requests != 1 || got.ErrorRate != 1 {
+		t.Errorf("Expected one failed request counted, got %+v", got)
+	}
+}
+
+// recordingLogger collects messages so tests can assert on them directly.
+type recordingLogger struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (l *recordingLogger) record(level, format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.messages = append(l.messages, level+" "+fmt.Sprintf(format, args...))
+}
+
+func (l *recordingLogger) Debugf(_ context.Context, format string, args ...interface{}) {
+	l.record("DEBUG", format, args...)
+}
+
+func (l *recordingLogger) Infof(_ context.Context, format string, args ...interface{}) {
+	l.record("INFO", format, args...)
+}
+
+func (l *recordingLogger) Warnf(_ context.Context, format string, args ...interface{}) {
+	l.record("WARN", format, args...)
+}
+
+func (l *recordingLogger) Errorf(_ context.Context, format string, args ...interface{}) {
+	l.record("ERROR", format, args...)
+}
+
+func TestInjectedLoggerReachesHandlers(t *testing.T) {
+	observability.InitMetrics()
+	buf := captureLog(t)
+	logger := &recordingLogger{}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		LogWithCorrelationID(r.Context(), "inside handler")
+	})
+	wrapped := NewRequestInstrumentationMiddleware(InstrumentationConfig{
+		Logger:               logger,
+		SlowRequestThreshold: time.Nanosecond,
+	})(handler)
+
+	req := httptest.NewRequest("GET", "/injected", nil)
+	req.Header.Set(observability.RequestIDHeader, "inj-id")
+	wrapped.ServeHTTP(httptest.NewRecorder(), req)
+
+	if buf.Len() != 0 {
+		t.Errorf("Nothing should reach the global logger, got %q", buf.String())
+	}
+
+	joined := strings.Join(logger.messages, "\n")
+	for _, want := range []string{
+		"INFO [GET] /injected",
+		"INFO [inj-id] inside handler",
+		"WARN slow request [GET] /injected",
+	} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("Expected %q in logged messages:\n%s", want, joined)
+		}
+	}
+}
+
+func TestMiddlewarePropagatesTraceparent(t *testing.T) {
+	observability.InitMetrics()
+	var inner observability.SpanContext
+	handler := NewRequestInstrumentationMiddleware(InstrumentationConfig{Logger: &recordingLogger{}})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inner = observability.SpanContextFromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set("tracestate", "congo=t61rcWkgMzE")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if inner.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || inner.SpanID.String() == "00f067aa0ba902b7" {
+		t.Errorf("Expected a child span in the caller's trace, got %s", inner.Traceparent())
+	}
+	if inner.TraceState != "congo=t61rcWkgMzE" {
+		t.Errorf("Expected tracestate to be kept, got %q", inner.TraceState)
+	}
+	if got := w.Header().Get("traceparent"); got != inner.Traceparent() {
+		t.Errorf("Expected response traceparent %q, got %q", inner.Traceparent(), got)
+	}
+
+	// Without a caller trace a new one is started
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if _, err := observability.ParseTraceparent(w.Header().Get("traceparent")); err != nil {
+		t.Errorf("Expected a valid new traceparent, got %q", w.Header().Get("traceparent"))
+	}
+}
+
+// spanCollector is a tracing.Exporter that keeps exported spans.
+type spanCollector struct {
+	mu    sync.Mutex
+	spans []tracing.Span
+}
+
+func (c *spanCollector) ExportSpans(ctx context.Context, spans []tracing.Span) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.spans = append(c.spans, spans...)
+	return nil
+}
+
+func TestMiddlewareRecordsServerSpans(t *testing.T) {
+	observability.InitMetrics()
+	exporter := &spanCollector{}
+	tracer := tracing.NewTracer(tracing.TracerConfig{Exporter: exporter})
+	handler := NewRequestInstrumentationMiddleware(InstrumentationConfig{Logger: &recordingLogger{}, Tracer: tracer})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+
+	req := httptest.NewRequest("POST", "/upstream", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	tracer.Shutdown(context.Background())
+
+	if len(exporter.spans) != 1 {
+		t.Fatalf("Expected one exported span, got %d", len(exporter.spans))
+	}
+	span := exporter.spans[0]
+	if span.Name != "POST /upstream" || span.Kind != tracing.SpanKindServer || !span.Error {
+		t.Errorf("Unexpected span %+v", span)
+	}
+	if span.ParentID.String() != "00f067aa0ba902b7" || w.Header().Get("traceparent") != span.Context.Traceparent() {
+		t.Errorf("Span should continue the caller's trace and match the response header")
+	}
+	if span.Attributes["http.response.status_code"] != http.StatusBadGateway {
+		t.Errorf("Unexpected attributes %v", span.Attributes)
+	}
+}
+
+func TestMiddlewareAttachesTraceExemplars(t *testing.T) {
+	observability.InitMetrics()
+	tracer := tracing.NewTracer(tracing.TracerConfig{Exporter: &spanCollector{}})
+	defer tracer.Shutdown(context.Background())
+	handler := NewRequestInstrumentationMiddleware(InstrumentationConfig{Logger: &recordingLogger{}, Tracer: tracer})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	sc, _ := observability.ParseTraceparent(w.Header().Get("traceparent"))
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range families {
+		if f.GetName() != "http_request_duration_seconds" {
+			continue
+		}
+		for _, b := range f.GetMetric()[0].GetHistogram().GetBucket() {
+			if e := b.GetExemplar(); e != nil && e.GetLabel()[0].GetValue() == sc.TraceID.String() {
+				return
+			}
+		}
+	}
+	t.Errorf("No exemplar for trace %s on http_request_duration_seconds", sc.TraceID)
+}
+
+func TestMiddlewareUsesConfiguredIDGenerator(t *testing.T) {
+	observability.InitMetrics()
+	wrapped := NewRequestInstrumentationMiddleware(InstrumentationConfig{
+		Logger:      &recordingLogger{},
+		IDGenerator: observability.IDGeneratorFunc(func() string { return "fixed-id" }),
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	w := httptest.NewRecorder()
+	wrapped.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if got := w.Header().Get(observability.ResponseCorrelationIDHeader); got != "fixed-id" {
+		t.Errorf("Expected generated ID fixed-id, got %q", got)
+	}
+
+	// Incoming IDs still win over the generator
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(observability.RequestIDHeader, "caller-id")
+	w = httptest.NewRecorder()
+	wrapped.ServeHTTP(w, req)
+	if got := w.Header().Get(observability.ResponseCorrelationIDHeader); got != "caller-id" {
+		t.Errorf("Expected caller-id, got %q", got)
+	}
+}
+
+func TestMiddlewareUsesConfiguredClock(t *testing.T) {
+	observability.InitMetrics()
+	buf := captureLog(t)
+
+	start := time.Unix(1000, 0)
+	clock := observability.NewFakeClock(start)
+	ring := observability.NewRequestRing(4)
+	wrapped := NewRequestInstrumentationMiddleware(InstrumentationConfig{
+		Clock:                clock,
+		IDGenerator:          observability.SequentialIDGenerator("req-"),
+		RecentRequests:       ring,
+		SlowRequestThreshold: 200 * time.Millisecond,
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clock.Advance(100 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+		clock.Advance(150 * time.Millisecond)
+	}))
+
+	wrapped.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/timed", nil))
+
+	out := buf.String()
+	if !strings.Contains(out, "/timed -> 200 (duration=0.250s, responseSize=0, id=req-1, hop=req-1)") {
+		t.Errorf("Expected the exact duration and ID, got %q", out)
+	}
+	if !strings.Contains(out, "duration=0.250s, ttfb=0.100s") {
+		t.Errorf("Expected the exact time to first byte, got %q", out)
+	}
+	got := ring.Snapshot()
+	if len(got) != 1 || !got[0].Time.Equal(start) || got[0].DurationMs != 250 {
+		t.Errorf("Unexpected summary: %+v", got)
+	}
+}
+
+func TestMiddlewareExtractsBaggage(t *testing.T) {
+	observability.InitMetrics()
+	var tenant string
+	wrapped := NewRequestInstrumentationMiddleware(InstrumentationConfig{
+		Logger: &recordingLogger{},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant = observability.GetBaggage(r.Context(), "tenant")
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(observability.BaggageHeader, "tenant=acme,exp=blue")
+	wrapped.ServeHTTP(httptest.NewRecorder(), req)
+	if tenant != "acme" {
+		t.Errorf("Expected tenant baggage acme, got %q", tenant)
+	}
+}
+
+func TestMiddlewareAssignsHopID(t *testing.T) {
+	observability.InitMetrics()
+	var ctxHop string
+	wrapped := NewRequestInstrumentationMiddleware(InstrumentationConfig{
+		Logger: &recordingLogger{},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctxHop = observability.GetHopID(r.Context())
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(observability.RequestIDHeader, "origin-id")
+	w := httptest.NewRecorder()
+	wrapped.ServeHTTP(w, req)
+
+	hop := w.Header().Get(observability.HopIDHeader)
+	if hop == "" || hop == "origin-id" || hop != ctxHop {
+		t.Errorf("Expected a fresh hop ID in header and context, got %q and %q", hop, ctxHop)
+	}
+	if got := w.Header().Get(observability.ResponseCorrelationIDHeader); got != "origin-id" {
+		t.Errorf("Correlation ID should be preserved, got %q", got)
+	}
+
+	// A request starting here uses its hop ID as the correlation ID
+	w = httptest.NewRecorder()
+	wrapped.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Header().Get(observability.HopIDHeader) != w.Header().Get(observability.ResponseCorrelationIDHeader) {
+		t.Errorf("Expected matching IDs on the first hop, got %v", w.Header())
+	}
+}
+
+func TestMiddlewareLabelsMetricsByRoute(t *testing.T) {
+	metrics := observability.InitMetrics()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/labeled/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	counter := metrics.RequestCounter.WithLabelValues("GET", "/labeled/{id}", "unnamed", "418")
+	before := testutil.ToFloat64(counter)
+
+	for _, cfg := range []InstrumentationConfig{
+		{Logger: &recordingLogger{}, Routes: mux},
+		// Without Routes the pattern recorded by the mux is used
+		{Logger: &recordingLogger{}},
+	} {
+		wrapped := NewRequestInstrumentationMiddleware(cfg)(mux)
+		wrapped.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/labeled/42", nil))
+	}
+	if got := testutil.ToFloat64(counter) - before; got != 2 {
+		t.Errorf("Expected 2 requests under /labeled/{id}, got %v", got)
+	}
+
+	other := metrics.RequestCounter.WithLabelValues("GET", "other", "unnamed", "404")
+	before = testutil.ToFloat64(other)
+	NewRequestInstrumentationMiddleware(InstrumentationConfig{Logger: &recordingLogger{}})(http.NotFoundHandler()).
+		ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/unrouted", nil))
+	if got := testutil.ToFloat64(other) - before; got != 1 {
+		t.Errorf("Expected the unrouted request labeled other, got %v", got)
+	}
+}
+
+func TestMiddlewareNormalizesSubtreeRoutes(t *testing.T) {
+	metrics := observability.InitMetrics()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/exact", func(w http.ResponseWriter, r *http.Request) {})
+	wrapped := NewRequestInstrumentationMiddleware(InstrumentationConfig{
+		Logger:          &recordingLogger{},
+		Routes:          mux,
+		RouteNormalizer: observability.NewRouteNormalizer(observability.RouteNormalizerConfig{}),
+	})(mux)
+
+	normalized := metrics.RequestCounter.WithLabelValues("GET", "/normalized/{id}", "unnamed", "200")
+	exact := metrics.RequestCounter.WithLabelValues("GET", "/exact", "unnamed", "200")
+	beforeNormalized, beforeExact := testutil.ToFloat64(normalized), testutil.ToFloat64(exact)
+
+	for _, path := range []string{"/normalized/1", "/normalized/2", "/exact"} {
+		wrapped.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	if got := testutil.ToFloat64(normalized) - beforeNormalized; got != 2 {
+		t.Errorf("Expected both IDs under /normalized/{id}, got %v", got)
+	}
+	if got := testutil.ToFloat64(exact) - beforeExact; got != 1 {
+		t.Errorf("Exact patterns keep their label, got %v", got)
+	}
+}
+
+func TestMiddlewareRecordsIntoInjectedRecorder(t *testing.T) {
+	recorder := observability.NewMemoryRecorder()
+	wrapped := NewRequestInstrumentationMiddleware(InstrumentationConfig{
+		Logger:               &recordingLogger{},
+		Metrics:              recorder,
+		TailLogging:          true,
+		SlowRequestThreshold: time.Hour,
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+
+	req := httptest.NewRequest("POST", "/recorded", strings.NewReader("body"))
+	wrapped.ServeHTTP(httptest.NewRecorder(), req)
+
+	responses := recorder.Responses()
+	if len(responses) != 1 || responses[0].Method != "POST" || responses[0].Status != 200 || responses[0].Route != "other" {
+		t.Errorf("Unexpected recorded responses %+v", responses)
+	}
+	if got := recorder.ResponseSizes(); len(got) != 1 || got[0] != 5 {
+		t.Errorf("Expected response size 5, got %v", got)
+	}
+	if got := recorder.RequestSizes(); len(got) != 1 || got[0] != 4 {
+		t.Errorf("Expected request size 4, got %v", got)
+	}
+	if recorder.SuppressedLogs() != 1 || recorder.SlowRequests() != 0 || recorder.Active() != 0 {
+		t.Errorf("Unexpected counts: suppressed %d, slow %d, active %d", recorder.SuppressedLogs(), recorder.SlowRequests(), recorder.Active())
+	}
+
+	// The no-op recorder must not touch the global metrics
+	NewRequestInstrumentationMiddleware(InstrumentationConfig{
+		Logger:  &recordingLogger{},
+		Metrics: observability.NoopRecorder{},
+	})(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/noop", nil))
+}
+
+func TestMiddlewareLabelsNamedHandlers(t *testing.T) {
+	recorder := observability.NewMemoryRecorder()
+	logger := &recordingLogger{}
+	mux := http.NewServeMux()
+	mux.Handle("/health", observability.NamedHandler("health", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	mux.HandleFunc("/plain", func(w http.ResponseWriter, r *http.Request) {})
+	wrapped := NewRequestInstrumentationMiddleware(InstrumentationConfig{Logger: logger, Metrics: recorder, Routes: mux})(mux)
+
+	wrapped.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/health", nil))
+	wrapped.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/plain", nil))
+
+	responses := recorder.Responses()
+	if len(responses) != 2 || responses[0].Handler != "health" || responses[1].Handler != observability.UnnamedHandler {
+		t.Errorf("Unexpected handler labels %+v", responses)
+	}
+	if !strings.Contains(strings.Join(logger.messages, "\n"), "handler=health") {
+		t.Errorf("Expected handler name in the completion log, got %q", logger.messages)
+	}
+}
+
+// discardWriter is a ResponseWriter that drops everything, so benchmarks
+// measure the middleware rather than a recorder.
+type discardWriter struct {
+	header http.Header
+}
+
+func (w *discardWriter) Header() http.Header         { return w.header }
+func (w *discardWriter) Write(p []byte) (int, error) { return len(p), nil }
+func (w *discardWriter) WriteHeader(int)             {}
+
+// benchmarkInstrumentation serves GET / through the instrumentation
+// middleware configured by cfg, logging and recording into throwaway sinks.
+func benchmarkInstrumentation(b *testing.B, cfg InstrumentationConfig) {
+	cfg.Logger = observability.NewStdLogger(log.New(io.Discard, "", 0))
+	cfg.Metrics = observability.NewMetrics(observability.MetricsOptions{})
+	handler := NewRequestInstrumentationMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("pong\n"))
+	}))
+	req := httptest.NewRequest("GET", "/", nil)
+	w := &discardWriter{header: make(http.Header)}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		clear(w.header)
+		handler.ServeHTTP(w, req)
+	}
+}
+
+func BenchmarkRequestInstrumentation(b *testing.B) {
+	benchmarkInstrumentation(b, InstrumentationConfig{Redaction: DefaultRedaction()})
+}
+
+func BenchmarkRequestInstrumentationTailLogging(b *testing.B) {
+	benchmarkInstrumentation(b, InstrumentationConfig{Redaction: DefaultRedaction(), TailLogging: true})
+}
@@ -0,0 +1,165 @@
+package middleware
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"ping/observability"
+)
+
+// responseWriter is a wrapper around http.ResponseWriter that captures the
+// status code, size and time to first byte. Pass exposed() to handlers so
+// the optional interfaces of the underlying writer stay visible.
+type responseWriter struct {
+	http.ResponseWriter
+	statusCode  int
+	written     int64
+	wroteHeader bool
+	// start and firstByte measure time to first byte; firstByte stays zero
+	// until the response is committed
+	start     time.Time
+	firstByte time.Time
+	// clock reads firstByte; nil uses observability.DefaultClock
+	clock observability.Clock
+	// capture, when set, keeps a truncated copy of the body for debug logging
+	capture *captureBuffer
+}
+
+// WriteHeader captures the final status code. Informational (1xx)
+// responses such as 103 Early Hints are passed on without being recorded,
+// and repeated calls keep the first status, as net/http does.
+func (rw *responseWriter) WriteHeader(code int) {
+	if code >= 200 || code == http.StatusSwitchingProtocols {
+		if !rw.wroteHeader {
+			rw.statusCode = code
+		}
+		rw.commit()
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+// Write captures the response size
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	rw.commit()
+	n, err := rw.ResponseWriter.Write(b)
+	rw.written += int64(n)
+	if rw.capture != nil {
+		rw.capture.Write(b[:n])
+	}
+	return n, err
+}
+
+// Flush implements http.Flusher for streaming and server-sent events. It
+// is a no-op when the underlying writer cannot flush.
+func (rw *responseWriter) Flush() {
+	rw.FlushError()
+}
+
+// FlushError is used by http.ResponseController and reports
+// http.ErrNotSupported when the underlying writer cannot flush.
+func (rw *responseWriter) FlushError() error {
+	rw.commit()
+	return http.NewResponseController(rw.ResponseWriter).Flush()
+}
+
+// ReadFrom lets io.Copy hand bodies straight to the underlying writer
+// (sendfile for *os.File), while still counting the bytes.
+func (rw *responseWriter) ReadFrom(src io.Reader) (int64, error) {
+	rw.commit()
+	if rf, ok := rw.ResponseWriter.(io.ReaderFrom); ok && rw.capture == nil {
+		n, err := rf.ReadFrom(src)
+		rw.written += n
+		return n, err
+	}
+	return io.Copy(writerOnly{rw}, src)
+}
+
+// commit notes that the headers are on their way to the client.
+func (rw *responseWriter) commit() {
+	if rw.wroteHeader {
+		return
+	}
+	rw.wroteHeader = true
+	clock := rw.clock
+	if clock == nil {
+		clock = observability.DefaultClock
+	}
+	rw.firstByte = clock.Now()
+}
+
+// started reports whether the headers are on their way to the client.
+func (rw *responseWriter) started() bool {
+	return rw.wroteHeader
+}
+
+// timeToFirstByte is how long the handler took to commit the response.
+// Handlers that never write are committed by net/http on return, so end
+// stands in for the first byte.
+func (rw *responseWriter) timeToFirstByte(end time.Time) time.Duration {
+	if rw.firstByte.IsZero() {
+		return end.Sub(rw.start)
+	}
+	return rw.firstByte.Sub(rw.start)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer for
+// deadlines and other controls not implemented here.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// hijack takes over the connection, e.g. for a WebSocket upgrade. Unless a
+// status was written first, the request is recorded as 101.
+func (rw *responseWriter) hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, buf, err := rw.ResponseWriter.(http.Hijacker).Hijack()
+	if err == nil && !rw.wroteHeader {
+		rw.statusCode = http.StatusSwitchingProtocols
+		rw.commit()
+	}
+	return conn, buf, err
+}
+
+func (rw *responseWriter) push(target string, opts *http.PushOptions) error {
+	return rw.ResponseWriter.(http.Pusher).Push(target, opts)
+}
+
+// exposed returns rw as a writer that implements http.Hijacker and
+// http.Pusher only when the underlying writer does, so handler type
+// assertions keep telling the truth.
+func (rw *responseWriter) exposed() http.ResponseWriter {
+	_, hijacker := rw.ResponseWriter.(http.Hijacker)
+	_, pusher := rw.ResponseWriter.(http.Pusher)
+	switch {
+	case hijacker && pusher:
+		return hijackPushWriter{rw}
+	case hijacker:
+		return hijackWriter{rw}
+	case pusher:
+		return pushWriter{rw}
+	}
+	return rw
+}
+
+type hijackWriter struct{ *responseWriter }
+
+func (w hijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) { return w.hijack() }
+
+type pushWriter struct{ *responseWriter }
+
+func (w pushWriter) Push(target string, opts *http.PushOptions) error { return w.push(target, opts) }
+
+type hijackPushWriter struct{ *responseWriter }
+
+func (w hijackPushWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) { return w.hijack() }
+
+func (w hijackPushWriter) Push(target string, opts *http.PushOptions) error {
+	return w.push(target, opts)
+}
+
+// writerOnly hides ReadFrom so io.Copy falls back to Write.
+type writerOnly struct {
+	io.Writer
+}
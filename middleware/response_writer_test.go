@@ -0,0 +1,189 @@
+package middleware
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ping/observability"
+)
+
+// hijackRecorder is a ResponseRecorder whose connection can be taken over.
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (h *hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h.hijacked = true
+	client, server := net.Pipe()
+	client.Close()
+	return server, bufio.NewReadWriter(bufio.NewReader(server), bufio.NewWriter(server)), nil
+}
+
+func TestResponseWriterExposesOnlySupportedInterfaces(t *testing.T) {
+	plain := (&responseWriter{ResponseWriter: httptest.NewRecorder()}).exposed()
+	if _, ok := plain.(http.Hijacker); ok {
+		t.Error("Hijacker exposed although the recorder cannot hijack")
+	}
+	if _, ok := plain.(http.Pusher); ok {
+		t.Error("Pusher exposed although the recorder cannot push")
+	}
+	if _, ok := plain.(http.Flusher); !ok {
+		t.Error("Flusher should always be exposed")
+	}
+	if _, ok := plain.(io.ReaderFrom); !ok {
+		t.Error("ReaderFrom should always be exposed")
+	}
+
+	hijackable := (&responseWriter{ResponseWriter: &hijackRecorder{ResponseRecorder: httptest.NewRecorder()}}).exposed()
+	if _, ok := hijackable.(http.Hijacker); !ok {
+		t.Error("Hijacker hidden although the underlying writer supports it")
+	}
+}
+
+func TestResponseWriterHijackRecordsSwitchingProtocols(t *testing.T) {
+	rec := &hijackRecorder{ResponseRecorder: httptest.NewRecorder()}
+	rw := &responseWriter{ResponseWriter: rec, statusCode: http.StatusOK}
+
+	conn, _, err := rw.exposed().(http.Hijacker).Hijack()
+	if err != nil {
+		t.Fatalf("Hijack failed: %v", err)
+	}
+	conn.Close()
+	if !rec.hijacked || rw.statusCode != http.StatusSwitchingProtocols {
+		t.Errorf("Expected hijack to reach the recorder and record 101, got hijacked=%v status=%d", rec.hijacked, rw.statusCode)
+	}
+}
+
+func TestResponseWriterFlushAndReadFrom(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rw := &responseWriter{ResponseWriter: rec, statusCode: http.StatusOK}
+
+	n, err := io.Copy(rw.exposed(), strings.NewReader("streamed body"))
+	if err != nil || n != 13 || rw.written != 13 {
+		t.Errorf("Expected 13 bytes copied and counted, got n=%d written=%d err=%v", n, rw.written, err)
+	}
+	rw.exposed().(http.Flusher).Flush()
+	if !rec.Flushed {
+		t.Error("Flush did not reach the recorder")
+	}
+	if err := http.NewResponseController(rw.exposed()).Flush(); err != nil {
+		t.Errorf("ResponseController flush failed: %v", err)
+	}
+}
+
+func TestResponseWriterFlushUnsupported(t *testing.T) {
+	// Hide the recorder's Flush behind a plain ResponseWriter
+	rw := &responseWriter{ResponseWriter: struct{ http.ResponseWriter }{httptest.NewRecorder()}}
+	if err := http.NewResponseController(rw).Flush(); !errors.Is(err, http.ErrNotSupported) {
+		t.Errorf("Expected ErrNotSupported, got %v", err)
+	}
+	rw.Flush() // must not panic
+}
+
+func TestInstrumentationKeepsConnectionInterfaces(t *testing.T) {
+	observability.InitMetrics()
+	var flusher, hijacker bool
+	handler := NewRequestInstrumentationMiddleware(InstrumentationConfig{Logger: &recordingLogger{}})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, flusher = w.(http.Flusher)
+		_, hijacker = w.(http.Hijacker)
+	}))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if !flusher || !hijacker {
+		t.Errorf("Handler lost optional interfaces behind instrumentation: flusher=%v hijacker=%v", flusher, hijacker)
+	}
+}
+
+func TestResponseWriterIgnoresInformationalStatus(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rw := &responseWriter{ResponseWriter: rec, statusCode: http.StatusOK, start: time.Now()}
+
+	rw.Header().Set("Link", "</style.css>; rel=preload")
+	rw.WriteHeader(http.StatusEarlyHints)
+	if rw.wroteHeader || rw.statusCode != http.StatusOK {
+		t.Errorf("103 must not be recorded as the response status, got %d", rw.statusCode)
+	}
+	rw.WriteHeader(http.StatusCreated)
+	rw.WriteHeader(http.StatusInternalServerError) // superfluous, ignored
+	if rw.statusCode != http.StatusCreated {
+		t.Errorf("Expected first final status 201, got %d", rw.statusCode)
+	}
+}
+
+func TestResponseWriterTimeToFirstByte(t *testing.T) {
+	start := time.Now().Add(-time.Second)
+	rw := &responseWriter{ResponseWriter: httptest.NewRecorder(), statusCode: http.StatusOK, start: start}
+	if got := rw.timeToFirstByte(start.Add(3 * time.Second)); got != 3*time.Second {
+		t.Errorf("Uncommitted response should use the end time, got %s", got)
+	}
+
+	rw.Write([]byte("first chunk"))
+	committed := rw.firstByte
+	rw.Write([]byte("second chunk"))
+	if rw.firstByte != committed {
+		t.Error("Later writes must not move the first byte time")
+	}
+	if got := rw.timeToFirstByte(start.Add(time.Hour)); got != committed.Sub(start) {
+		t.Errorf("Expected ttfb %s, got %s", committed.Sub(start), got)
+	}
+}
+
+func TestStreamingResponseAccountingAndTrailers(t *testing.T) {
+	observability.InitMetrics()
+	logger := &recordingLogger{}
+	stream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "X-Checksum")
+		for i := 0; i < 3; i++ {
+			io.WriteString(w, strings.Repeat("x", 100))
+			w.(http.Flusher).Flush()
+		}
+		w.Header().Set("X-Checksum", "done")
+	})
+	handler := NewRequestInstrumentationMiddleware(InstrumentationConfig{Logger: logger})(stream)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	// Writers are recycled after the request, so the count is read from
+	// the completion line
+	if logged := strings.Join(logger.messages, "\n"); len(body) != 300 || !strings.Contains(logged, "responseSize=300,") {
+		t.Errorf("Expected 300 bytes sent and counted, got %d sent and %q logged", len(body), logged)
+	}
+	if resp.ContentLength != -1 {
+		t.Errorf("Expected a chunked response, got Content-Length %d", resp.ContentLength)
+	}
+	if got := resp.Trailer.Get("X-Checksum"); got != "done" {
+		t.Errorf("Expected trailer to pass through, got %q", got)
+	}
+}
+
+func BenchmarkResponseWriterWrite(b *testing.B) {
+	body := []byte(strings.Repeat("x", 512))
+	w := &discardWriter{header: make(http.Header)}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rw := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK, start: time.Now()}
+		rw.exposed().Write(body)
+	}
+}
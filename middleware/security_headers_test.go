@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSecurityHeadersDefaults(t *testing.T) {
+	handler := NewSecurityHeadersMiddleware(DefaultSecurityHeaders())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	want := map[string]string{
+		"Strict-Transport-Security": "max-age=31536000; includeSubDomains",
+		"X-Content-Type-Options":    "nosniff",
+		"X-Frame-Options":           "DENY",
+		"Referrer-Policy":           "strict-origin-when-cross-origin",
+		"Content-Security-Policy":   "default-src 'self'; frame-ancestors 'none'",
+	}
+	for name, value := range want {
+		if got := w.Header().Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+}
+
+func TestSecurityHeadersOptionalFields(t *testing.T) {
+	handler := NewSecurityHeadersMiddleware(SecurityHeadersConfig{
+		HSTSMaxAge: time.Hour,
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	if got := w.Header().Get("Strict-Transport-Security"); got != "max-age=3600" {
+		t.Errorf("Unexpected HSTS %q", got)
+	}
+	for _, name := range []string{"X-Frame-Options", "Referrer-Policy", "Content-Security-Policy"} {
+		if w.Header().Get(name) != "" {
+			t.Errorf("%s should be omitted when unset", name)
+		}
+	}
+}
+
+func TestSecurityHeadersExemptAndOverride(t *testing.T) {
+	cfg := DefaultSecurityHeaders()
+	cfg.ExemptPaths = []string{"/metrics"}
+	handler := NewSecurityHeadersMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/dashboard" {
+			w.Header().Set("Content-Security-Policy", "default-src 'self' 'unsafe-inline'")
+		}
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Header().Get("X-Content-Type-Options") != "" {
+		t.Error("Exempt path should not get security headers")
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/dashboard", nil))
+	if got := w.Header().Get("Content-Security-Policy"); got != "default-src 'self' 'unsafe-inline'" {
+		t.Errorf("Handler should be able to override CSP, got %q", got)
+	}
+}
@@ -0,0 +1,89 @@
+package observability
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// AsyncWriter is an io.Writer that hands each write to a background goroutine
+// through a bounded queue. When the queue is full the write is dropped instead
+// of blocking, so a slow log sink can never add latency to a request.
+type AsyncWriter struct {
+	out    io.Writer
+	queue  chan []byte
+	done   chan struct{}
+	onDrop func()
+
+	mu      sync.RWMutex
+	closed  bool
+	dropped atomic.Uint64
+}
+
+// NewAsyncWriter starts a writer that forwards to out with room for
+// queueSize pending writes. onDrop, if non-nil, is called for every
+// dropped write (e.g. to increment a metric).
+func NewAsyncWriter(out io.Writer, queueSize int, onDrop func()) *AsyncWriter {
+	w := &AsyncWriter{
+		out:    out,
+		queue:  make(chan []byte, queueSize),
+		done:   make(chan struct{}),
+		onDrop: onDrop,
+	}
+	go w.run()
+	return w
+}
+
+func (w *AsyncWriter) run() {
+	defer close(w.done)
+	for line := range w.queue {
+		_, _ = w.out.Write(line)
+	}
+}
+
+// Write queues a copy of p. It never blocks and always reports success,
+// because the log package has no useful way to handle a failed write.
+func (w *AsyncWriter) Write(p []byte) (int, error) {
+	// The log package reuses its buffer, so the bytes must be copied
+	line := make([]byte, len(p))
+	copy(line, p)
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		w.drop()
+		return len(p), nil
+	}
+
+	select {
+	case w.queue <- line:
+	default:
+		w.drop()
+	}
+	return len(p), nil
+}
+
+func (w *AsyncWriter) drop() {
+	w.dropped.Add(1)
+	if w.onDrop != nil {
+		w.onDrop()
+	}
+}
+
+// Dropped returns the number of writes discarded so far.
+func (w *AsyncWriter) Dropped() uint64 {
+	return w.dropped.Load()
+}
+
+// Close stops accepting writes and blocks until the queue has been flushed.
+func (w *AsyncWriter) Close() error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.mu.Unlock()
+
+	<-w.done
+	return nil
+}
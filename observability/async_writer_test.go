@@ -0,0 +1,89 @@
+package observability
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+// blockingWriter holds every write until release is closed.
+type blockingWriter struct {
+	release chan struct{}
+	mu      sync.Mutex
+	buf     bytes.Buffer
+}
+
+func (b *blockingWriter) Write(p []byte) (int, error) {
+	<-b.release
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func TestAsyncWriterFlushesOnClose(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewAsyncWriter(&buf, 10, nil)
+
+	w.Write([]byte("first\n"))
+	w.Write([]byte("second\n"))
+	w.Close()
+
+	if got := buf.String(); got != "first\nsecond\n" {
+		t.Errorf("Expected both lines in order, got %q", got)
+	}
+	if w.Dropped() != 0 {
+		t.Errorf("Expected no drops, got %d", w.Dropped())
+	}
+}
+
+func TestAsyncWriterCopiesInput(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewAsyncWriter(&buf, 10, nil)
+
+	line := []byte("original\n")
+	w.Write(line)
+	copy(line, "mutated!\n")
+	w.Close()
+
+	if got := buf.String(); got != "original\n" {
+		t.Errorf("Writer must not alias the caller's buffer, got %q", got)
+	}
+}
+
+func TestAsyncWriterDropsWhenFull(t *testing.T) {
+	out := &blockingWriter{release: make(chan struct{})}
+	drops := 0
+	w := NewAsyncWriter(out, 1, func() { drops++ })
+
+	// One write may be held by the background goroutine and one sits in
+	// the queue; everything after that must be dropped without blocking.
+	for i := 0; i < 5; i++ {
+		if n, err := w.Write([]byte("x")); n != 1 || err != nil {
+			t.Fatalf("Write should always succeed, got n=%d err=%v", n, err)
+		}
+	}
+
+	if w.Dropped() < 3 {
+		t.Errorf("Expected at least 3 drops, got %d", w.Dropped())
+	}
+	if uint64(drops) != w.Dropped() {
+		t.Errorf("onDrop called %d times, Dropped reports %d", drops, w.Dropped())
+	}
+
+	close(out.release)
+	w.Close()
+}
+
+func TestAsyncWriterWriteAfterClose(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewAsyncWriter(&buf, 1, nil)
+	w.Close()
+
+	// Must not panic on the closed queue
+	w.Write([]byte("late\n"))
+	if w.Dropped() != 1 {
+		t.Errorf("Expected write after close to be dropped, got %d drops", w.Dropped())
+	}
+	// Closing twice is safe
+	w.Close()
+}
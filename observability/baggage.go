@@ -0,0 +1,133 @@
+package observability
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// BaggageHeader carries W3C baggage: application key/value pairs that
+// travel with a request across services
+const BaggageHeader = "baggage"
+
+// maxBaggageBytes is the header size every W3C implementation must
+// propagate; members beyond it are dropped rather than split.
+const maxBaggageBytes = 8192
+
+// Baggage maps keys such as tenant or experiment to their values. Treat
+// values from the context as read-only; use WithBaggage to add entries.
+type Baggage map[string]string
+
+type baggageKey struct{}
+
+// ContextWithBaggage replaces the baggage carried by ctx.
+func ContextWithBaggage(ctx context.Context, b Baggage) context.Context {
+	return context.WithValue(ctx, baggageKey{}, b)
+}
+
+// BaggageFromContext returns the request's baggage, or nil.
+func BaggageFromContext(ctx context.Context) Baggage {
+	b, _ := ctx.Value(baggageKey{}).(Baggage)
+	return b
+}
+
+// WithBaggage returns a context whose baggage also holds key=value. The
+// parent's baggage is copied, so sibling handlers do not see the entry.
+func WithBaggage(ctx context.Context, key, value string) context.Context {
+	parent := BaggageFromContext(ctx)
+	b := make(Baggage, len(parent)+1)
+	for k, v := range parent {
+		b[k] = v
+	}
+	b[key] = value
+	return ContextWithBaggage(ctx, b)
+}
+
+// GetBaggage returns the value stored under key, or "".
+func GetBaggage(ctx context.Context, key string) string {
+	return BaggageFromContext(ctx)[key]
+}
+
+// ParseBaggage reads a baggage header value. Malformed members are
+// skipped and member properties are ignored.
+func ParseBaggage(value string) Baggage {
+	b := Baggage{}
+	for _, member := range strings.Split(value, ",") {
+		member, _, _ = strings.Cut(member, ";")
+		key, val, ok := strings.Cut(member, "=")
+		key = strings.TrimSpace(key)
+		if !ok || !isBaggageKey(key) {
+			continue
+		}
+		val = strings.TrimSpace(val)
+		if decoded, err := url.PathUnescape(val); err == nil {
+			val = decoded
+		}
+		b[key] = val
+	}
+	return b
+}
+
+// String formats b as a header value with keys in sorted order, dropping
+// members that would push it past the size every hop must accept.
+func (b Baggage) String() string {
+	keys := make([]string, 0, len(b))
+	for k := range b {
+		if isBaggageKey(k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	for _, k := range keys {
+		member := k + "=" + url.PathEscape(b[k])
+		if sb.Len()+len(member)+1 > maxBaggageBytes {
+			continue
+		}
+		if sb.Len() > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(member)
+	}
+	return sb.String()
+}
+
+// isBaggageKey reports whether k is an RFC 7230 token.
+func isBaggageKey(k string) bool {
+	if k == "" {
+		return false
+	}
+	for i := 0; i < len(k); i++ {
+		c := k[i]
+		if c <= ' ' || c >= 0x7f || strings.IndexByte("\"(),/:;<=>?@[\\]{}", c) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// baggageHeaderKey is BaggageHeader in canonical form.
+var baggageHeaderKey = http.CanonicalHeaderKey(BaggageHeader)
+
+// ExtractBaggage reads every baggage header on a request. It returns nil
+// when there is none.
+func ExtractBaggage(h http.Header) Baggage {
+	values := h[baggageHeaderKey]
+	if len(values) == 0 {
+		return nil
+	}
+	return ParseBaggage(strings.Join(values, ","))
+}
+
+// InjectBaggage writes the context's baggage to an outbound request,
+// replacing any baggage header already there.
+func InjectBaggage(ctx context.Context, h http.Header) {
+	if value := BaggageFromContext(ctx).String(); value != "" {
+		h.Set(BaggageHeader, value)
+	} else {
+		h.Del(BaggageHeader)
+	}
+}
@@ -0,0 +1,66 @@
+package observability
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestParseBaggage(t *testing.T) {
+	b := ParseBaggage(" tenant=acme , exp=blue%20green;ttl=60,bad key=x,novalue,=empty")
+	if len(b) != 2 || b["tenant"] != "acme" || b["exp"] != "blue green" {
+		t.Errorf("Unexpected baggage %v", b)
+	}
+}
+
+func TestBaggageStringRoundTrip(t *testing.T) {
+	b := Baggage{"tenant": "acme", "exp": "a,b;c d"}
+	value := b.String()
+	if value != "exp=a%2Cb%3Bc%20d,tenant=acme" {
+		t.Errorf("Unexpected header %q", value)
+	}
+	if got := ParseBaggage(value); got["exp"] != "a,b;c d" || got["tenant"] != "acme" {
+		t.Errorf("Round trip gave %v", got)
+	}
+}
+
+func TestBaggageStringDropsOversizedMembers(t *testing.T) {
+	b := Baggage{"big": strings.Repeat("x", maxBaggageBytes), "small": "1"}
+	if value := b.String(); value != "small=1" {
+		t.Errorf("Expected only the small member, got %d bytes", len(value))
+	}
+}
+
+func TestWithBaggageCopiesParent(t *testing.T) {
+	parent := WithBaggage(context.Background(), "tenant", "acme")
+	child := WithBaggage(parent, "exp", "blue")
+
+	if GetBaggage(child, "tenant") != "acme" || GetBaggage(child, "exp") != "blue" {
+		t.Errorf("Child should see both entries, got %v", BaggageFromContext(child))
+	}
+	if GetBaggage(parent, "exp") != "" {
+		t.Error("Parent baggage must not change")
+	}
+	if GetBaggage(context.Background(), "tenant") != "" {
+		t.Error("Empty context should have no baggage")
+	}
+}
+
+func TestExtractAndInjectBaggage(t *testing.T) {
+	in := http.Header{}
+	in.Add(BaggageHeader, "tenant=acme")
+	in.Add(BaggageHeader, "exp=blue")
+	ctx := ContextWithBaggage(context.Background(), ExtractBaggage(in))
+
+	out := http.Header{}
+	InjectBaggage(WithBaggage(ctx, "region", "eu"), out)
+	if got := out.Get(BaggageHeader); got != "exp=blue,region=eu,tenant=acme" {
+		t.Errorf("Unexpected injected header %q", got)
+	}
+
+	InjectBaggage(context.Background(), out)
+	if _, ok := out[BaggageHeader]; ok {
+		t.Error("Stale baggage header should be removed")
+	}
+}
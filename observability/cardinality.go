@@ -0,0 +1,75 @@
+package observability
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultMaxSeriesPerMetric is the label combinations a guarded metric may
+// create before new ones fall into its overflow series.
+const DefaultMaxSeriesPerMetric = 1000
+
+// seriesLimiter caps the distinct label combinations per metric. Once a
+// metric reaches the cap, samples for unseen combinations are recorded
+// under one overflow series whose label values are all OtherRoute, and
+// counted in dropped.
+type seriesLimiter struct {
+	max     int
+	dropped *prometheus.CounterVec
+
+	mu   sync.RWMutex
+	seen map[string]map[string]struct{}
+}
+
+func newSeriesLimiter(max int, dropped *prometheus.CounterVec) *seriesLimiter {
+	return &seriesLimiter{max: max, dropped: dropped, seen: make(map[string]map[string]struct{})}
+}
+
+// labels returns values, or the overflow label values when they would be a
+// new series beyond the cap for metric.
+func (l *seriesLimiter) labels(metric string, values []string) []string {
+	key := strings.Join(values, "\xff")
+	l.mu.RLock()
+	_, known := l.seen[metric][key]
+	l.mu.RUnlock()
+	if known {
+		return values
+	}
+
+	l.mu.Lock()
+	series, ok := l.seen[metric]
+	if !ok {
+		series = make(map[string]struct{})
+		l.seen[metric] = series
+	}
+	if _, known = series[key]; !known && len(series) >= l.max {
+		l.mu.Unlock()
+		l.dropped.WithLabelValues(metric).Inc()
+		return overflowLabels(len(values))
+	}
+	series[key] = struct{}{}
+	l.mu.Unlock()
+	return values
+}
+
+func overflowLabels(n int) []string {
+	values := make([]string, n)
+	for i := range values {
+		values[i] = OtherRoute
+	}
+	return values
+}
+
+// LimitLabels returns the label values to record a sample of metric under:
+// values itself, or all-"other" values once metric has
+// MetricsOptions.MaxSeriesPerMetric label combinations and values would
+// add another. Use it for labels fed by client input, such as routes or
+// client identities.
+func (m *Metrics) LimitLabels(metric string, values ...string) []string {
+	if m.series == nil {
+		return values
+	}
+	return m.series.labels(metric, values)
+}
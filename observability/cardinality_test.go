@@ -0,0 +1,56 @@
+package observability
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestLimitLabelsFoldsOverflowIntoOther(t *testing.T) {
+	metrics := NewMetrics(MetricsOptions{MaxSeriesPerMetric: 2})
+
+	for i := 0; i < 5; i++ {
+		metrics.RecordResponse("GET", fmt.Sprintf("/r%d", i), "unnamed", 200, 0.1, SpanContext{})
+	}
+	metrics.RecordResponse("GET", "/r0", "unnamed", 200, 0.1, SpanContext{})
+
+	if got := testutil.CollectAndCount(metrics.RequestCounter); got != 3 {
+		t.Errorf("Expected two series plus the overflow series, got %d", got)
+	}
+	if got := testutil.ToFloat64(metrics.RequestCounter.WithLabelValues("GET", "/r0", "unnamed", "200")); got != 2 {
+		t.Errorf("Expected a known series to keep counting, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.RequestCounter.WithLabelValues("other", "other", "other", "other")); got != 3 {
+		t.Errorf("Expected three samples in the overflow series, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.SeriesDroppedCounter.WithLabelValues("http_requests_total")); got != 3 {
+		t.Errorf("Expected three dropped samples, got %v", got)
+	}
+}
+
+func TestLimitLabelsPerMetric(t *testing.T) {
+	metrics := NewMetrics(MetricsOptions{MaxSeriesPerMetric: 1})
+
+	metrics.ObserveRequestSize("GET", "/a", 10)
+	if got := metrics.LimitLabels("http_response_size_bytes", "GET", "/b"); got[1] != "/b" {
+		t.Errorf("Expected metrics to be limited separately, got %q", got)
+	}
+	if got := metrics.LimitLabels("http_request_size_bytes", "GET", "/b"); got[0] != "other" || got[1] != "other" {
+		t.Errorf("Expected overflow labels, got %q", got)
+	}
+}
+
+func TestLimitLabelsDisabled(t *testing.T) {
+	metrics := NewMetrics(MetricsOptions{MaxSeriesPerMetric: -1})
+
+	for i := 0; i < DefaultMaxSeriesPerMetric+1; i++ {
+		metrics.LimitLabels("http_requests_total", fmt.Sprint(i))
+	}
+	if got := metrics.LimitLabels("http_requests_total", "new"); got[0] != "new" {
+		t.Errorf("Expected no cap when disabled, got %q", got)
+	}
+	if got := testutil.CollectAndCount(metrics.SeriesDroppedCounter); got != 0 {
+		t.Errorf("Expected nothing dropped, got %d series", got)
+	}
+}
@@ -0,0 +1,73 @@
+package observability
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time to duration measurements: request and outbound
+// call durations and time to first byte. Tests swap in a FakeClock to
+// assert exact durations.
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc adapts a function to Clock.
+type ClockFunc func() time.Time
+
+// Now implements Clock.
+func (f ClockFunc) Now() time.Time { return f() }
+
+// SystemClock tells the wall clock time.
+var SystemClock Clock = ClockFunc(time.Now)
+
+// DefaultClock is used by measurements configured without a clock.
+// Replace it at startup, before serving requests, or in tests that do not
+// run in parallel.
+var DefaultClock = SystemClock
+
+// FakeClock is a Clock that only moves when told to. It is safe for
+// concurrent use.
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+	// step is added after each reading
+	step time.Duration
+}
+
+// NewFakeClock returns a FakeClock stopped at start.
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start}
+}
+
+// Now implements Clock.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now
+	c.now = c.now.Add(c.step)
+	return now
+}
+
+// Advance moves the clock forward by d.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+// Set moves the clock to t.
+func (c *FakeClock) Set(t time.Time) {
+	c.mu.Lock()
+	c.now = t
+	c.mu.Unlock()
+}
+
+// SetStep makes every reading advance the clock by d afterwards, so that
+// code reading the clock at the start and end of an operation measures
+// exactly d without the test having to step in between.
+func (c *FakeClock) SetStep(d time.Duration) {
+	c.mu.Lock()
+	c.step = d
+	c.mu.Unlock()
+}
@@ -0,0 +1,39 @@
+package observability
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Unix(1000, 0)
+	clock := NewFakeClock(start)
+	if !clock.Now().Equal(start) || !clock.Now().Equal(start) {
+		t.Fatal("Expected a stopped clock")
+	}
+	clock.Advance(time.Second)
+	if got := clock.Now().Sub(start); got != time.Second {
+		t.Errorf("Expected 1s after Advance, got %s", got)
+	}
+	clock.Set(start)
+	if !clock.Now().Equal(start) {
+		t.Error("Expected Set to move the clock back")
+	}
+}
+
+func TestFakeClockStep(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1000, 0))
+	clock.SetStep(10 * time.Millisecond)
+	began := clock.Now()
+	if got := clock.Now().Sub(began); got != 10*time.Millisecond {
+		t.Errorf("Expected each reading 10ms apart, got %s", got)
+	}
+}
+
+func TestSystemClockTellsTheTime(t *testing.T) {
+	before := time.Now()
+	now := SystemClock.Now()
+	if now.Before(before) || now.Sub(before) > time.Second {
+		t.Errorf("Expected the current time, got %s", now)
+	}
+}
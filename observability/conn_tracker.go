@@ -0,0 +1,53 @@
+package observability
+
+import (
+	"net"
+	"net/http"
+	"sync"
+)
+
+// ConnTracker follows a server's connections through http.Server.ConnState
+// and keeps the connection metrics up to date: the gauge of open
+// connections by state, and counters of accepted, closed and hijacked
+// connections.
+//
+// Usage:
+//
+//	server.ConnState = observability.NewConnTracker(metrics, "main").ConnState
+type ConnTracker struct {
+	metrics *Metrics
+	server  string
+
+	mu     sync.Mutex
+	states map[net.Conn]http.ConnState
+}
+
+// NewConnTracker returns a tracker recording into m under the server label.
+func NewConnTracker(m *Metrics, server string) *ConnTracker {
+	return &ConnTracker{metrics: m, server: server, states: make(map[net.Conn]http.ConnState)}
+}
+
+// ConnState is the http.Server.ConnState hook.
+func (t *ConnTracker) ConnState(c net.Conn, state http.ConnState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if prev, ok := t.states[c]; ok {
+		t.metrics.ConnectionsGauge.WithLabelValues(t.server, prev.String()).Dec()
+	}
+	switch state {
+	case http.StateNew:
+		t.metrics.ConnectionsAccepted.WithLabelValues(t.server).Inc()
+	case http.StateHijacked:
+		// The server no longer sees the connection, so neither do we
+		t.metrics.ConnectionsHijacked.WithLabelValues(t.server).Inc()
+		delete(t.states, c)
+		return
+	case http.StateClosed:
+		t.metrics.ConnectionsClosed.WithLabelValues(t.server).Inc()
+		delete(t.states, c)
+		return
+	}
+	t.states[c] = state
+	t.metrics.ConnectionsGauge.WithLabelValues(t.server, state.String()).Inc()
+}
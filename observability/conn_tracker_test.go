@@ -0,0 +1,75 @@
+package observability
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestConnTracker(t *testing.T) {
+	m := NewMetrics(MetricsOptions{})
+	tracker := NewConnTracker(m, "main")
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	gauge := func(state string) float64 {
+		return testutil.ToFloat64(m.ConnectionsGauge.WithLabelValues("main", state))
+	}
+
+	tracker.ConnState(a, http.StateNew)
+	tracker.ConnState(b, http.StateNew)
+	tracker.ConnState(a, http.StateActive)
+	if gauge("new") != 1 || gauge("active") != 1 {
+		t.Errorf("Expected one new and one active connection, got %v and %v", gauge("new"), gauge("active"))
+	}
+
+	tracker.ConnState(a, http.StateIdle)
+	tracker.ConnState(a, http.StateClosed)
+	tracker.ConnState(b, http.StateActive)
+	tracker.ConnState(b, http.StateHijacked)
+	for _, state := range []string{"new", "active", "idle"} {
+		if gauge(state) != 0 {
+			t.Errorf("Expected no %s connections left, got %v", state, gauge(state))
+		}
+	}
+	if got := testutil.ToFloat64(m.ConnectionsAccepted.WithLabelValues("main")); got != 2 {
+		t.Errorf("Expected 2 accepted connections, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.ConnectionsClosed.WithLabelValues("main")); got != 1 {
+		t.Errorf("Expected 1 closed connection, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.ConnectionsHijacked.WithLabelValues("main")); got != 1 {
+		t.Errorf("Expected 1 hijacked connection, got %v", got)
+	}
+}
+
+func TestConnTrackerWithServer(t *testing.T) {
+	m := NewMetrics(MetricsOptions{})
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.Config.ConnState = NewConnTracker(m, "main").ConnState
+	srv.Start()
+
+	resp, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	srv.Close()
+
+	// Closing the server closes its connections asynchronously
+	deadline := time.Now().Add(time.Second)
+	for testutil.ToFloat64(m.ConnectionsClosed.WithLabelValues("main")) != 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := testutil.ToFloat64(m.ConnectionsAccepted.WithLabelValues("main")); got != 1 {
+		t.Errorf("Expected 1 accepted connection, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.ConnectionsClosed.WithLabelValues("main")); got != 1 {
+		t.Errorf("Expected 1 closed connection, got %v", got)
+	}
+}
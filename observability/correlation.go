@@ -2,8 +2,6 @@ package observability
 
 import (
 	"context"
-
-	"github.com/google/uuid"
 )
 
 // CorrelationIDKey is the context key for storing correlation IDs
@@ -21,11 +19,18 @@ const (
 
 	// ResponseCorrelationIDHeader is the HTTP header name for exposing correlation ID in responses
 	ResponseCorrelationIDHeader = "X-Correlation-ID"
+
+	// HopID is the key used to store this service's own request ID in the request context
+	HopID CorrelationIDKey = "hop-id"
+
+	// HopIDHeader is the HTTP response header exposing the per-hop request ID
+	HopIDHeader = "X-Hop-ID"
 )
 
-// GenerateCorrelationID creates a new UUID-based correlation ID
+// GenerateCorrelationID creates a new correlation ID using
+// DefaultIDGenerator (random UUIDs unless configured otherwise)
 func GenerateCorrelationID() string {
-	return uuid.New().String()
+	return DefaultIDGenerator.NewID()
 }
 
 // GetOrCreateCorrelationID retrieves an existing correlation ID from the context
@@ -50,3 +55,19 @@ func GetCorrelationID(ctx context.Context) string {
 	}
 	return ""
 }
+
+// WithHopID adds the per-hop request ID to the context. Unlike the
+// correlation ID, which is shared by every service a request passes
+// through, the hop ID is new in each one.
+func WithHopID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, HopID, id)
+}
+
+// GetHopID retrieves the per-hop request ID from the context
+// Returns empty string if not found
+func GetHopID(ctx context.Context) string {
+	if hopID, ok := ctx.Value(HopID).(string); ok {
+		return hopID
+	}
+	return ""
+}
@@ -124,3 +124,13 @@ func TestMultipleContextValues(t *testing.T) {
 		t.Errorf("Expected %s, got %s", id2, retrieved)
 	}
 }
+
+func TestHopIDIsSeparateFromCorrelationID(t *testing.T) {
+	ctx := WithHopID(WithCorrelationID(context.Background(), "corr"), "hop")
+	if GetHopID(ctx) != "hop" || GetCorrelationID(ctx) != "corr" {
+		t.Errorf("Expected hop and corr, got %q and %q", GetHopID(ctx), GetCorrelationID(ctx))
+	}
+	if GetHopID(context.Background()) != "" {
+		t.Error("Expected empty hop ID without context value")
+	}
+}
@@ -0,0 +1,33 @@
+package observability
+
+import "log/slog"
+
+// DeploymentInfo identifies the running instance so log streams from many
+// replicas can be told apart. Empty fields are omitted.
+type DeploymentInfo struct {
+	Hostname    string
+	Pod         string
+	InstanceID  string
+	Version     string
+	Environment string
+}
+
+// Attrs returns the non-empty fields as slog attributes, suitable for
+// slog.Handler.WithAttrs so they appear on every log line.
+func (d DeploymentInfo) Attrs() []slog.Attr {
+	fields := []struct{ key, value string }{
+		{"hostname", d.Hostname},
+		{"pod", d.Pod},
+		{"instance_id", d.InstanceID},
+		{"version", d.Version},
+		{"environment", d.Environment},
+	}
+
+	attrs := make([]slog.Attr, 0, len(fields))
+	for _, f := range fields {
+		if f.value != "" {
+			attrs = append(attrs, slog.String(f.key, f.value))
+		}
+	}
+	return attrs
+}
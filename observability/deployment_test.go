@@ -0,0 +1,45 @@
+package observability
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+)
+
+func TestDeploymentInfoAttrsSkipsEmpty(t *testing.T) {
+	d := DeploymentInfo{Hostname: "node-1", Version: "1.2.3"}
+
+	attrs := d.Attrs()
+	if len(attrs) != 2 {
+		t.Fatalf("Expected 2 attributes, got %d: %v", len(attrs), attrs)
+	}
+	if attrs[0].Key != "hostname" || attrs[0].Value.String() != "node-1" {
+		t.Errorf("Unexpected first attribute: %v", attrs[0])
+	}
+	if attrs[1].Key != "version" || attrs[1].Value.String() != "1.2.3" {
+		t.Errorf("Unexpected second attribute: %v", attrs[1])
+	}
+}
+
+func TestDeploymentInfoOnEveryLine(t *testing.T) {
+	var buf bytes.Buffer
+	d := DeploymentInfo{Hostname: "node-1", Pod: "ping-abc", Environment: "prod"}
+	handler := slog.NewJSONHandler(&buf, nil).WithAttrs(d.Attrs())
+	logger := slog.New(NewCorrelationHandler(handler))
+
+	ctx := WithCorrelationID(context.Background(), "meta-id")
+	logger.InfoContext(ctx, "request done")
+
+	entry := decodeLine(t, &buf)
+	for key, want := range map[string]string{
+		"hostname":          "node-1",
+		"pod":               "ping-abc",
+		"environment":       "prod",
+		CorrelationIDLogKey: "meta-id",
+	} {
+		if entry[key] != want {
+			t.Errorf("Expected %s=%s, got %v", key, want, entry[key])
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package observability
+
+import (
+	"math"
+	"runtime/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// gcPauseBuckets resolve the stop-the-world pauses latency budgets care
+// about, from 10µs to 100ms.
+var gcPauseBuckets = []float64{0.00001, 0.000025, 0.00005, 0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1}
+
+// runtime/metrics names read by gcCollector.
+const (
+	gcPausesMetric = "/sched/pauses/total/gc:seconds"
+	gcCyclesMetric = "/gc/cycles/total:gc-cycles"
+)
+
+// gcCollector exports GC pauses and cycles from runtime/metrics with
+// coarse latency buckets. Unlike go_gc_pauses_seconds from the runtime
+// collectors it takes the service's prefix and stays when they are
+// disabled, so latency dashboards keep their GC panel.
+type gcCollector struct {
+	pauses *prometheus.Desc
+	cycles *prometheus.Desc
+}
+
+func newGCCollector() *gcCollector {
+	return &gcCollector{
+		pauses: prometheus.NewDesc("runtime_gc_pause_seconds",
+			"Stop-the-world pauses of the garbage collector in seconds", nil, nil),
+		cycles: prometheus.NewDesc("runtime_gc_cycles_total",
+			"Total number of completed garbage collection cycles", nil, nil),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *gcCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.pauses
+	ch <- c.cycles
+}
+
+// Collect implements prometheus.Collector.
+func (c *gcCollector) Collect(ch chan<- prometheus.Metric) {
+	samples := []metrics.Sample{{Name: gcPausesMetric}, {Name: gcCyclesMetric}}
+	metrics.Read(samples)
+	if samples[0].Value.Kind() == metrics.KindFloat64Histogram {
+		count, sum, buckets := rebucket(samples[0].Value.Float64Histogram(), gcPauseBuckets)
+		ch <- prometheus.MustNewConstHistogram(c.pauses, count, sum, buckets)
+	}
+	if samples[1].Value.Kind() == metrics.KindUint64 {
+		ch <- prometheus.MustNewConstMetric(c.cycles, prometheus.CounterValue, float64(samples[1].Value.Uint64()))
+	}
+}
+
+// rebucket folds a runtime histogram into cumulative counts at bounds.
+// Each runtime bucket counts towards the first bound at or above its upper
+// edge, so no pause is reported as shorter than it was; the sum takes each
+// bucket's midpoint.
+func rebucket(h *metrics.Float64Histogram, bounds []float64) (count uint64, sum float64, buckets map[float64]uint64) {
+	buckets = make(map[float64]uint64, len(bounds))
+	b := 0
+	var cumulative uint64
+	for i, n := range h.Counts {
+		lower, upper := h.Buckets[i], h.Buckets[i+1]
+		for b < len(bounds) && bounds[b] < upper {
+			buckets[bounds[b]] = cumulative
+			b++
+		}
+		cumulative += n
+		if n > 0 {
+			// Open-ended buckets count at their finite edge
+			mid := (lower + upper) / 2
+			if math.IsInf(lower, -1) {
+				mid = upper
+			} else if math.IsInf(upper, 1) {
+				mid = lower
+			}
+			sum += float64(n) * mid
+		}
+	}
+	for ; b < len(bounds); b++ {
+		buckets[bounds[b]] = cumulative
+	}
+	return cumulative, sum, buckets
+}
@@ -0,0 +1,62 @@
+package observability
+
+import (
+	"math"
+	"runtime"
+	"runtime/metrics"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRebucket(t *testing.T) {
+	h := &metrics.Float64Histogram{
+		Buckets: []float64{math.Inf(-1), 0, 0.00002, 0.00004, 0.002, math.Inf(1)},
+		Counts:  []uint64{0, 3, 2, 1, 1},
+	}
+	count, sum, buckets := rebucket(h, []float64{0.00001, 0.00005, 0.001, 0.01})
+	if count != 7 {
+		t.Errorf("Expected 7 pauses, got %d", count)
+	}
+	// Pauses are counted at the first bound at or above their bucket's
+	// upper edge
+	want := map[float64]uint64{0.00001: 0, 0.00005: 5, 0.001: 5, 0.01: 6}
+	for bound, n := range want {
+		if buckets[bound] != n {
+			t.Errorf("Expected %d pauses up to %v, got %d", n, bound, buckets[bound])
+		}
+	}
+	if wantSum := 3*0.00001 + 2*0.00003 + 0.00102 + 0.002; math.Abs(sum-wantSum) > 1e-12 {
+		t.Errorf("Expected sum %v, got %v", wantSum, sum)
+	}
+}
+
+func TestGCMetrics(t *testing.T) {
+	runtime.GC()
+	for _, disabled := range []bool{false, true} {
+		m := NewMetrics(MetricsOptions{Namespace: "pingsvc", DisableRuntimeCollectors: disabled})
+		for _, name := range []string{"pingsvc_runtime_gc_pause_seconds", "pingsvc_runtime_gc_cycles_total"} {
+			if n, err := testutil.GatherAndCount(m.Gatherer, name); err != nil || n != 1 {
+				t.Errorf("Expected %s with runtime collectors disabled=%v, got %d (%v)", name, disabled, n, err)
+			}
+		}
+	}
+
+	m := NewMetrics(MetricsOptions{})
+	families, err := m.Gatherer.Gather()
+	if err != nil {
+		t.Fatalf("Gather failed: %v", err)
+	}
+	for _, f := range families {
+		switch f.GetName() {
+		case "runtime_gc_pause_seconds":
+			if h := f.GetMetric()[0].GetHistogram(); h.GetSampleCount() == 0 || len(h.GetBucket()) != len(gcPauseBuckets) {
+				t.Errorf("Expected the forced collection's pauses in %d buckets, got %v", len(gcPauseBuckets), h)
+			}
+		case "runtime_gc_cycles_total":
+			if v := f.GetMetric()[0].GetCounter().GetValue(); v < 1 {
+				t.Errorf("Expected at least one GC cycle, got %v", v)
+			}
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package observability
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+)
+
+// UnnamedHandler is the handler label for requests served by a handler
+// that was not registered with NamedHandler.
+const UnnamedHandler = "unnamed"
+
+// HandlerLogKey is the completion log field carrying the handler name.
+const HandlerLogKey = "handler"
+
+type handlerNameKey struct{}
+
+// WithHandlerName returns a context able to carry the name of the handler
+// that serves the request. The instrumentation middleware calls it so that
+// NamedHandler, running further in, can report its name back.
+func WithHandlerName(ctx context.Context) context.Context {
+	return context.WithValue(ctx, handlerNameKey{}, new(atomic.Pointer[string]))
+}
+
+// SetHandlerName records name as the handler serving the request. It is a
+// no-op when ctx was not prepared with WithHandlerName.
+func SetHandlerName(ctx context.Context, name string) {
+	if slot, ok := ctx.Value(handlerNameKey{}).(*atomic.Pointer[string]); ok {
+		slot.Store(&name)
+	}
+}
+
+// GetHandlerName returns the name set with SetHandlerName, or
+// UnnamedHandler.
+func GetHandlerName(ctx context.Context) string {
+	if slot, ok := ctx.Value(handlerNameKey{}).(*atomic.Pointer[string]); ok {
+		if name := slot.Load(); name != nil {
+			return *name
+		}
+	}
+	return UnnamedHandler
+}
+
+// NamedHandler wraps h so that requests it serves are labeled with name,
+// e.g. "pong" or "health", in the request metrics and completion logs.
+// Names are fixed at registration, so unlike raw paths they cannot grow the
+// label set.
+func NamedHandler(name string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetHandlerName(r.Context(), name)
+		AddLogField(r.Context(), HandlerLogKey, name)
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,38 @@
+package observability
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNamedHandler(t *testing.T) {
+	ctx := WithLogFields(WithHandlerName(context.Background()))
+	var served bool
+	h := NamedHandler("pong", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served = true
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil).WithContext(ctx))
+
+	if !served {
+		t.Fatal("Expected the wrapped handler to run")
+	}
+	if got := GetHandlerName(ctx); got != "pong" {
+		t.Errorf("Expected handler name pong, got %q", got)
+	}
+	if got := FormatLogFields(ctx); got != ", handler=pong" {
+		t.Errorf("Expected handler log field, got %q", got)
+	}
+}
+
+func TestHandlerNameWithoutSlot(t *testing.T) {
+	ctx := context.Background()
+	SetHandlerName(ctx, "pong")
+	if got := GetHandlerName(ctx); got != UnnamedHandler {
+		t.Errorf("Expected %q without a slot, got %q", UnnamedHandler, got)
+	}
+	if got := GetHandlerName(WithHandlerName(ctx)); got != UnnamedHandler {
+		t.Errorf("Expected %q before a name is set, got %q", UnnamedHandler, got)
+	}
+}
@@ -0,0 +1,187 @@
+package observability
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// IDGenerator produces correlation IDs for requests that arrive without one.
+type IDGenerator interface {
+	NewID() string
+}
+
+// IDGeneratorFunc adapts a function to IDGenerator.
+type IDGeneratorFunc func() string
+
+// NewID implements IDGenerator.
+func (f IDGeneratorFunc) NewID() string { return f() }
+
+// DefaultIDGenerator is used by GenerateCorrelationID. Replace it at
+// startup, before serving requests, to change the scheme process-wide.
+var DefaultIDGenerator IDGenerator = UUIDv4Generator()
+
+// UUIDv4Generator returns random UUIDs, the historical default.
+func UUIDv4Generator() IDGenerator {
+	return IDGeneratorFunc(uuid.NewString)
+}
+
+// UUIDv7Generator returns time-ordered UUIDs (RFC 9562).
+func UUIDv7Generator() IDGenerator {
+	return IDGeneratorFunc(func() string {
+		return uuid.Must(uuid.NewV7()).String()
+	})
+}
+
+// SequentialIDGenerator returns prefix followed by 1, 2, 3 and so on, for
+// tests that assert exact IDs. It is safe for concurrent use.
+func SequentialIDGenerator(prefix string) IDGenerator {
+	var n atomic.Uint64
+	return IDGeneratorFunc(func() string {
+		return prefix + strconv.FormatUint(n.Add(1), 10)
+	})
+}
+
+// FixedIDGenerator returns the given IDs in turn, starting over after the
+// last, for tests that need IDs of a particular shape.
+func FixedIDGenerator(ids ...string) IDGenerator {
+	if len(ids) == 0 {
+		panic("observability: FixedIDGenerator needs at least one ID")
+	}
+	var n atomic.Uint64
+	return IDGeneratorFunc(func() string {
+		return ids[(n.Add(1)-1)%uint64(len(ids))]
+	})
+}
+
+// crockford is the ULID alphabet: base32 without I, L, O and U.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ulidGenerator keeps IDs created within the same millisecond sortable by
+// incrementing the random part, as the ULID spec's monotonic mode does.
+type ulidGenerator struct {
+	mu      sync.Mutex
+	lastMs  uint64
+	entropy [10]byte
+	now     func() time.Time
+}
+
+// ULIDGenerator returns 26-character, lexicographically sortable ULIDs.
+func ULIDGenerator() IDGenerator {
+	return &ulidGenerator{now: time.Now}
+}
+
+func (g *ulidGenerator) NewID() string {
+	g.mu.Lock()
+	ms := uint64(g.now().UnixMilli())
+	if ms == g.lastMs {
+		for i := len(g.entropy) - 1; i >= 0; i-- {
+			g.entropy[i]++
+			if g.entropy[i] != 0 {
+				break
+			}
+		}
+	} else {
+		g.lastMs = ms
+		rand.Read(g.entropy[:])
+	}
+	var raw [16]byte
+	binary.BigEndian.PutUint64(raw[:8], ms<<16)
+	copy(raw[6:], g.entropy[:])
+	g.mu.Unlock()
+
+	// 128 bits as 26 base32 digits, the first carrying only 3 bits
+	hi := binary.BigEndian.Uint64(raw[:8])
+	lo := binary.BigEndian.Uint64(raw[8:])
+	var out [26]byte
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
+
+// ksuidEpoch is the KSUID timestamp origin (2014-05-13).
+const ksuidEpoch = 1400000000
+
+const base62 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// KSUIDGenerator returns 27-character KSUIDs: a seconds timestamp and 128
+// random bits, base62 encoded and sortable by time.
+func KSUIDGenerator() IDGenerator {
+	return IDGeneratorFunc(func() string {
+		var raw [20]byte
+		binary.BigEndian.PutUint32(raw[:4], uint32(time.Now().Unix()-ksuidEpoch))
+		rand.Read(raw[4:])
+		return encodeBase62(raw[:], 27)
+	})
+}
+
+func encodeBase62(b []byte, width int) string {
+	n := new(big.Int).SetBytes(b)
+	out := make([]byte, width)
+	radix, digit := big.NewInt(62), new(big.Int)
+	for i := width - 1; i >= 0; i-- {
+		n.DivMod(n, radix, digit)
+		out[i] = base62[digit.Int64()]
+	}
+	return string(out)
+}
+
+// ShortIDGenerator returns IDs like "ping_3h7k2m9x4q1z8c5v": a prefix
+// naming the service or deployment and 80 random bits.
+func ShortIDGenerator(prefix string) IDGenerator {
+	return IDGeneratorFunc(func() string {
+		var raw [10]byte
+		rand.Read(raw[:])
+		return prefix + "_" + strings.ToLower(encodeCrockford(raw[:]))
+	})
+}
+
+func encodeCrockford(b []byte) string {
+	var sb strings.Builder
+	var buf uint64
+	bits := 0
+	for _, c := range b {
+		buf = buf<<8 | uint64(c)
+		bits += 8
+		for bits >= 5 {
+			bits -= 5
+			sb.WriteByte(crockford[(buf>>bits)&31])
+		}
+	}
+	if bits > 0 {
+		sb.WriteByte(crockford[(buf<<(5-bits))&31])
+	}
+	return sb.String()
+}
+
+// ParseIDGenerator returns the generator for a scheme name: uuid4, uuid7,
+// ulid, ksuid or short (which requires a prefix).
+func ParseIDGenerator(scheme, prefix string) (IDGenerator, error) {
+	switch scheme {
+	case "uuid4", "":
+		return UUIDv4Generator(), nil
+	case "uuid7":
+		return UUIDv7Generator(), nil
+	case "ulid":
+		return ULIDGenerator(), nil
+	case "ksuid":
+		return KSUIDGenerator(), nil
+	case "short":
+		if prefix == "" {
+			return nil, fmt.Errorf("short IDs need a prefix")
+		}
+		return ShortIDGenerator(prefix), nil
+	}
+	return nil, fmt.Errorf("unknown ID scheme %q", scheme)
+}
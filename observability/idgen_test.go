@@ -0,0 +1,119 @@
+package observability
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestIDGeneratorFormats(t *testing.T) {
+	cases := []struct {
+		name    string
+		gen     IDGenerator
+		pattern string
+	}{
+		{"uuid4", UUIDv4Generator(), `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[0-9a-f]{4}-[0-9a-f]{12}$`},
+		{"uuid7", UUIDv7Generator(), `^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[0-9a-f]{4}-[0-9a-f]{12}$`},
+		{"ulid", ULIDGenerator(), `^[0-7][0-9A-HJKMNP-TV-Z]{25}$`},
+		{"ksuid", KSUIDGenerator(), `^[0-9A-Za-z]{27}$`},
+		{"short", ShortIDGenerator("ping"), `^ping_[0-9a-hjkmnp-tv-z]{16}$`},
+	}
+	for _, tc := range cases {
+		re := regexp.MustCompile(tc.pattern)
+		a, b := tc.gen.NewID(), tc.gen.NewID()
+		if !re.MatchString(a) {
+			t.Errorf("%s: %q does not match %s", tc.name, a, tc.pattern)
+		}
+		if a == b {
+			t.Errorf("%s: expected unique IDs, got %q twice", tc.name, a)
+		}
+	}
+}
+
+func TestSequentialIDGenerator(t *testing.T) {
+	gen := SequentialIDGenerator("req-")
+	for _, want := range []string{"req-1", "req-2", "req-3"} {
+		if got := gen.NewID(); got != want {
+			t.Errorf("Expected %s, got %s", want, got)
+		}
+	}
+	// Each generator counts on its own
+	if got := SequentialIDGenerator("job-").NewID(); got != "job-1" {
+		t.Errorf("Expected job-1, got %s", got)
+	}
+}
+
+func TestFixedIDGeneratorCycles(t *testing.T) {
+	gen := FixedIDGenerator("a", "b")
+	var got []string
+	for i := 0; i < 3; i++ {
+		got = append(got, gen.NewID())
+	}
+	if strings.Join(got, ",") != "a,b,a" {
+		t.Errorf("Expected a,b,a, got %v", got)
+	}
+}
+
+func TestULIDIsMonotonic(t *testing.T) {
+	now := time.UnixMilli(1700000000000)
+	g := &ulidGenerator{now: func() time.Time { return now }}
+
+	ids := make([]string, 100)
+	for i := range ids {
+		if i == 50 {
+			now = now.Add(time.Millisecond)
+		}
+		ids[i] = g.NewID()
+	}
+	if !sort.StringsAreSorted(ids) {
+		t.Errorf("Expected ULIDs to sort in creation order: %v", ids)
+	}
+	// 1700000000000 ms encodes to this 10-character timestamp
+	if !strings.HasPrefix(ids[0], "01HF7YAT00") {
+		t.Errorf("Expected timestamp prefix 01HF7YAT00, got %s", ids[0])
+	}
+}
+
+func TestKSUIDSortsByTime(t *testing.T) {
+	// The timestamp leads the encoding, so a zero payload sorts first
+	early := encodeBase62(make([]byte, 20), 27)
+	if early != strings.Repeat("0", 27) {
+		t.Errorf("Expected all-zero KSUID, got %s", early)
+	}
+	if id := KSUIDGenerator().NewID(); id <= early {
+		t.Errorf("Expected %s to sort after %s", id, early)
+	}
+}
+
+func TestParseIDGenerator(t *testing.T) {
+	for _, scheme := range []string{"uuid4", "uuid7", "ulid", "ksuid"} {
+		if _, err := ParseIDGenerator(scheme, ""); err != nil {
+			t.Errorf("%s: unexpected error %v", scheme, err)
+		}
+	}
+	g, err := ParseIDGenerator("short", "edge")
+	if err != nil || !strings.HasPrefix(g.NewID(), "edge_") {
+		t.Errorf("Expected edge_ prefix, got err %v", err)
+	}
+	if _, err := ParseIDGenerator("short", ""); err == nil {
+		t.Error("Expected error for short IDs without prefix")
+	}
+	if _, err := ParseIDGenerator("snowflake", ""); err == nil {
+		t.Error("Expected error for unknown scheme")
+	}
+}
+
+func TestGenerateCorrelationIDUsesDefault(t *testing.T) {
+	defer func(g IDGenerator) { DefaultIDGenerator = g }(DefaultIDGenerator)
+	if _, err := uuid.Parse(GenerateCorrelationID()); err != nil {
+		t.Errorf("Expected UUID by default: %v", err)
+	}
+	DefaultIDGenerator = IDGeneratorFunc(func() string { return "custom" })
+	if id := GenerateCorrelationID(); id != "custom" {
+		t.Errorf("Expected custom, got %s", id)
+	}
+}
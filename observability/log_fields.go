@@ -0,0 +1,50 @@
+package observability
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+type logFieldsKey struct{}
+
+// logFields collects key=value pairs that inner handlers attach to the
+// request's completion log line, such as the authenticated subject.
+type logFields struct {
+	mu     sync.Mutex
+	fields []string
+}
+
+// WithLogFields returns a context able to carry request log fields. The
+// instrumentation middleware calls it so that middlewares and handlers
+// running further in can add fields with AddLogField.
+func WithLogFields(ctx context.Context) context.Context {
+	return context.WithValue(ctx, logFieldsKey{}, &logFields{})
+}
+
+// AddLogField attaches key=value to the request's completion log line.
+// It is a no-op when ctx was not prepared with WithLogFields.
+func AddLogField(ctx context.Context, key, value string) {
+	lf, ok := ctx.Value(logFieldsKey{}).(*logFields)
+	if !ok {
+		return
+	}
+	lf.mu.Lock()
+	lf.fields = append(lf.fields, key+"="+value)
+	lf.mu.Unlock()
+}
+
+// FormatLogFields renders the fields added to ctx as ", k=v, k2=v2", ready
+// to append inside a log line's parentheses; "" when there are none.
+func FormatLogFields(ctx context.Context) string {
+	lf, ok := ctx.Value(logFieldsKey{}).(*logFields)
+	if !ok {
+		return ""
+	}
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	if len(lf.fields) == 0 {
+		return ""
+	}
+	return ", " + strings.Join(lf.fields, ", ")
+}
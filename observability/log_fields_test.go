@@ -0,0 +1,27 @@
+package observability
+
+import (
+	"context"
+	"testing"
+)
+
+func TestLogFields(t *testing.T) {
+	ctx := WithLogFields(context.Background())
+	if got := FormatLogFields(ctx); got != "" {
+		t.Errorf("Expected no fields, got %q", got)
+	}
+
+	AddLogField(ctx, "sub", "alice")
+	AddLogField(ctx, "client_cn", "billing")
+	if got := FormatLogFields(ctx); got != ", sub=alice, client_cn=billing" {
+		t.Errorf("Unexpected fields %q", got)
+	}
+}
+
+func TestLogFieldsWithoutHolder(t *testing.T) {
+	ctx := context.Background()
+	AddLogField(ctx, "sub", "alice")
+	if got := FormatLogFields(ctx); got != "" {
+		t.Errorf("Expected fields to be dropped without a holder, got %q", got)
+	}
+}
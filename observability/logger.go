@@ -0,0 +1,142 @@
+package observability
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"unsafe"
+)
+
+// Logger is the logging dependency of the middleware and handlers.
+// Implementations receive the request context so they can attach
+// correlation IDs or other request-scoped fields themselves.
+type Logger interface {
+	Debugf(ctx context.Context, format string, args ...interface{})
+	Infof(ctx context.Context, format string, args ...interface{})
+	Warnf(ctx context.Context, format string, args ...interface{})
+	Errorf(ctx context.Context, format string, args ...interface{})
+}
+
+// LineLogger is implemented by loggers that can write a preformatted info
+// line without copying it, for the per-request lines of the
+// instrumentation middleware. Implementations must not retain line.
+type LineLogger interface {
+	InfoLine(ctx context.Context, line []byte)
+}
+
+// stdLogger writes plain lines through a *log.Logger, prefixing
+// non-info levels so they stand out in the text output.
+type stdLogger struct {
+	l *log.Logger
+}
+
+// NewStdLogger adapts a standard library logger. A nil logger writes
+// through the log package's global functions, so log.SetOutput still applies.
+func NewStdLogger(l *log.Logger) Logger {
+	return stdLogger{l: l}
+}
+
+// printf formats straight into the log package's buffer; formatting the
+// message first would format it twice. The concatenation is free for info
+// lines, whose prefix is empty.
+func (s stdLogger) printf(prefix, format string, args ...interface{}) {
+	if s.l == nil {
+		log.Printf(prefix+format, args...)
+		return
+	}
+	s.l.Printf(prefix+format, args...)
+}
+
+func (s stdLogger) Debugf(_ context.Context, format string, args ...interface{}) {
+	s.printf("DEBUG ", format, args...)
+}
+
+func (s stdLogger) Infof(_ context.Context, format string, args ...interface{}) {
+	s.printf("", format, args...)
+}
+
+// InfoLine implements LineLogger. log.Logger.Output copies the line into
+// its own buffer before returning, so viewing line as a string without a
+// copy is safe.
+func (s stdLogger) InfoLine(_ context.Context, line []byte) {
+	if len(line) == 0 {
+		return
+	}
+	msg := unsafe.String(&line[0], len(line))
+	if s.l == nil {
+		log.Output(2, msg)
+		return
+	}
+	s.l.Output(2, msg)
+}
+
+func (s stdLogger) Warnf(_ context.Context, format string, args ...interface{}) {
+	s.printf("WARN ", format, args...)
+}
+
+func (s stdLogger) Errorf(_ context.Context, format string, args ...interface{}) {
+	s.printf("ERROR ", format, args...)
+}
+
+// slogLogger forwards formatted messages to a *slog.Logger, passing the
+// context through so slog handlers can read request-scoped values.
+type slogLogger struct {
+	l *slog.Logger
+}
+
+// NewSlogLogger adapts a structured slog logger.
+func NewSlogLogger(l *slog.Logger) Logger {
+	return slogLogger{l: l}
+}
+
+func (s slogLogger) logf(ctx context.Context, level slog.Level, format string, args ...interface{}) {
+	if !s.l.Enabled(ctx, level) {
+		return
+	}
+	s.l.Log(ctx, level, fmt.Sprintf(format, args...))
+}
+
+func (s slogLogger) Debugf(ctx context.Context, format string, args ...interface{}) {
+	s.logf(ctx, slog.LevelDebug, format, args...)
+}
+
+func (s slogLogger) Infof(ctx context.Context, format string, args ...interface{}) {
+	s.logf(ctx, slog.LevelInfo, format, args...)
+}
+
+// InfoLine implements LineLogger; the record keeps the message, so it is
+// copied once, but without formatting.
+func (s slogLogger) InfoLine(ctx context.Context, line []byte) {
+	if !s.l.Enabled(ctx, slog.LevelInfo) {
+		return
+	}
+	s.l.Log(ctx, slog.LevelInfo, string(line))
+}
+
+func (s slogLogger) Warnf(ctx context.Context, format string, args ...interface{}) {
+	s.logf(ctx, slog.LevelWarn, format, args...)
+}
+
+func (s slogLogger) Errorf(ctx context.Context, format string, args ...interface{}) {
+	s.logf(ctx, slog.LevelError, format, args...)
+}
+
+// DefaultLogger writes through the global log package.
+var DefaultLogger = NewStdLogger(nil)
+
+type loggerKey struct{}
+
+// WithLogger stores a logger in the context for handlers further down the chain
+func WithLogger(ctx context.Context, l Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// LoggerFromContext returns the logger stored in the context,
+// or DefaultLogger if there is none
+func LoggerFromContext(ctx context.Context) Logger {
+	if l, ok := ctx.Value(loggerKey{}).(Logger); ok && l != nil {
+		return l
+	}
+	return DefaultLogger
+}
@@ -0,0 +1,79 @@
+package observability
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestStdLoggerLevels(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewStdLogger(log.New(&buf, "", 0))
+	ctx := context.Background()
+
+	l.Infof(ctx, "info %d", 1)
+	l.Warnf(ctx, "warn %d", 2)
+	l.Debugf(ctx, "debug %d", 3)
+	l.Errorf(ctx, "error %d", 4)
+
+	want := "info 1\nWARN warn 2\nDEBUG debug 3\nERROR error 4\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestLoggersWriteLines(t *testing.T) {
+	var buf bytes.Buffer
+	std := NewStdLogger(log.New(&buf, "", 0)).(LineLogger)
+	ctx := context.Background()
+	line := []byte("GET /ping -> 200")
+	std.InfoLine(ctx, line)
+	if got := buf.String(); got != "GET /ping -> 200\n" {
+		t.Errorf("Unexpected line %q", got)
+	}
+	buf.Reset()
+	if allocs := testing.AllocsPerRun(100, func() { std.InfoLine(ctx, line) }); allocs != 0 {
+		t.Errorf("Expected no allocations per line, got %v", allocs)
+	}
+
+	buf.Reset()
+	NewSlogLogger(slog.New(slog.NewTextHandler(&buf, nil))).(LineLogger).InfoLine(ctx, line)
+	if !strings.Contains(buf.String(), `level=INFO msg="GET /ping -> 200"`) {
+		t.Errorf("Unexpected slog line %q", buf.String())
+	}
+}
+
+func TestSlogLoggerRespectsLevel(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewSlogLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo})))
+	ctx := context.Background()
+
+	l.Debugf(ctx, "hidden")
+	l.Warnf(ctx, "visible %s", "warning")
+
+	out := buf.String()
+	if strings.Contains(out, "hidden") {
+		t.Errorf("Debug message should be filtered, got %q", out)
+	}
+	if !strings.Contains(out, "level=WARN") || !strings.Contains(out, `msg="visible warning"`) {
+		t.Errorf("Expected formatted warning, got %q", out)
+	}
+}
+
+func TestLoggerFromContext(t *testing.T) {
+	if LoggerFromContext(context.Background()) != DefaultLogger {
+		t.Error("Expected DefaultLogger when context has no logger")
+	}
+
+	var buf bytes.Buffer
+	l := NewStdLogger(log.New(&buf, "", 0))
+	ctx := WithLogger(context.Background(), l)
+
+	LoggerFromContext(ctx).Infof(ctx, "from context")
+	if buf.String() != "from context\n" {
+		t.Errorf("Expected the context logger to be used, got %q", buf.String())
+	}
+}
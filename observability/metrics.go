@@ -1,155 +1,822 @@
 package observability
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
 // Metrics holds all Prometheus collectors for the application.
 // This struct is the central registry for all metrics.
 type Metrics struct {
-	// HTTP Request Metrics
-	RequestCounter      prometheus.Counter
-	RequestDuration     prometheus.Histogram
-	RequestSize         prometheus.Histogram
-	ResponseSize        prometheus.Histogram
-	HTTPErrorCounter    prometheus.Counter
+	// HTTP Request Metrics, labeled by method and route; the counters and
+	// the duration histogram also by status code
+	RequestCounter      *prometheus.CounterVec
+	RequestDuration     prometheus.ObserverVec
+	TimeToFirstByte     prometheus.ObserverVec
+	RequestSize         *prometheus.HistogramVec
+	ResponseSize        *prometheus.HistogramVec
+	HTTPErrorCounter    *prometheus.CounterVec
+	ClientErrorCounter  *prometheus.CounterVec
+	StatusClassCounter  *prometheus.CounterVec
 	ActiveRequestsGauge prometheus.Gauge
+	SlowRequestCounter  prometheus.Counter
+	PanicCounter        prometheus.Counter
+
+	// Connection Metrics, labeled by server (main or admin)
+	ConnectionsGauge    *prometheus.GaugeVec
+	ConnectionsAccepted *prometheus.CounterVec
+	ConnectionsClosed   *prometheus.CounterVec
+	ConnectionsHijacked *prometheus.CounterVec
+
+	// TLS Handshake Metrics
+	TLSHandshakeDuration prometheus.ObserverVec
+	TLSHandshakeCounter  *prometheus.CounterVec
+	TLSHandshakeFailures *prometheus.CounterVec
+
+	// Concurrency Limiting Metrics
+	ConcurrencyQueueGauge      prometheus.Gauge
+	ConcurrencyRejectedCounter prometheus.Counter
+	QueueWaitDuration          prometheus.Observer
+	RequestsShedCounter        *prometheus.CounterVec
+
+	// Rate Limiting Metrics
+	RateLimitDecisionCounter *prometheus.CounterVec
+	RateLimitFallbackCounter prometheus.Counter
+
+	// Response Cache Metrics
+	ResponseCacheCounter *prometheus.CounterVec
+	ResponseCacheEntries prometheus.Gauge
+
+	// Traffic Mirroring Metrics
+	MirrorRequestsCounter *prometheus.CounterVec
+	MirrorDuration        prometheus.Observer
+
+	// Reverse Proxy Metrics
+	ProxyUpstreamDuration prometheus.ObserverVec
+	ProxyOverhead         prometheus.Observer
+
+	// Authentication Metrics
+	AuthFailureCounter            *prometheus.CounterVec
+	ClientIdentityRequestsCounter *prometheus.CounterVec
+
+	// Compression Metrics
+	CompressionRatio           *prometheus.HistogramVec
+	CompressionSavedBytes      *prometheus.CounterVec
+	RequestDecompressedCounter *prometheus.CounterVec
+
+	// Tracing Metrics
+	TraceSpansCounter *prometheus.CounterVec
+
+	// Health Check Metrics, labeled by check name
+	HealthCheckStatus      *prometheus.GaugeVec
+	HealthCheckDuration    prometheus.ObserverVec
+	HealthCheckTransitions *prometheus.CounterVec
+
+	// Metrics Export
+	MetricsExportCounter *prometheus.CounterVec
+	SeriesDroppedCounter *prometheus.CounterVec
 
 	// Background Job Metrics
-	BackgroundJobCounter    prometheus.Counter
-	BackgroundJobDuration   prometheus.Histogram
-	BackgroundJobErrorCount prometheus.Counter
+	BackgroundJobCounter    *prometheus.CounterVec
+	BackgroundJobDuration   prometheus.ObserverVec
+	BackgroundJobErrorCount *prometheus.CounterVec
+	JobQueueDepth           prometheus.Gauge
+	JobQueueWait            prometheus.Observer
+	JobWorkersBusy          prometheus.Gauge
+	JobRetries              *prometheus.CounterVec
+	JobDeadLettered         *prometheus.CounterVec
+	JobsStuck               prometheus.Gauge
+	JobLockAcquisitions     *prometheus.CounterVec
+	JobLockDuration         prometheus.Observer
 
 	// External API Call Metrics
-	APICallCounter      prometheus.Counter
-	APICallDuration     prometheus.Histogram
-	APICallErrorCounter prometheus.Counter
+	APICallCounter      *prometheus.CounterVec
+	APICallDuration     prometheus.ObserverVec
+	APICallErrorCounter *prometheus.CounterVec
+	APICallRetries      *prometheus.CounterVec
+	APICallHedges       *prometheus.CounterVec
+	APICallPhase        prometheus.ObserverVec
 
 	// File/CSV/TSV Processing Metrics
-	FileProcessCounter      prometheus.Counter
-	FileProcessDuration     prometheus.Histogram
-	FileProcessBytesCounter prometheus.Counter
-	FileProcessErrorCounter prometheus.Counter
+	FileProcessCounter       prometheus.Counter
+	FileProcessDuration      prometheus.Observer
+	FileProcessBytesCounter  prometheus.Counter
+	FileProcessErrorCounter  prometheus.Counter
+	FileConvertBytes         *prometheus.CounterVec
+	FileCompressedBytes      *prometheus.CounterVec
+	FileProcessRowsPerSecond prometheus.Gauge
+	FileProcessMemoryBytes   prometheus.Gauge
+	FileIngestCounter        *prometheus.CounterVec
+	FileIngestRows           *prometheus.CounterVec
+	FileUploadCounter        *prometheus.CounterVec
+	FileUploadBytes          prometheus.Counter
+	FileUploadDuration       prometheus.Observer
+
+	// Logging Metrics
+	LogLinesDroppedCounter       prometheus.Counter
+	RequestLogsSuppressedCounter prometheus.Counter
+
+	// Runtime Limits Metrics
+	RuntimeMaxProcs      prometheus.Gauge
+	RuntimeCPUQuota      prometheus.Gauge
+	RuntimeMemoryLimit   prometheus.Gauge
+	RuntimeMemoryBallast prometheus.Gauge
+
+	// Registerer holds the collectors above and Gatherer reads them, e.g.
+	// for /metrics or a metrics pusher
+	Registerer prometheus.Registerer
+	Gatherer   prometheus.Gatherer
+
+	// series caps the label combinations of metrics labeled by client
+	// input; nil when the cap is disabled
+	series *seriesLimiter
 }
 
 var (
-	metricsInstance *Metrics
-	once             sync.Once
+	// metricsInstance is the process-wide instance returned by GetMetrics
+	metricsInstance atomic.Pointer[Metrics]
+	metricsMu       sync.Mutex
 )
 
-// InitMetrics initializes and registers all Prometheus metrics.
-// This should be called once at application startup.
-// It uses sync.Once to ensure metrics are only registered once.
+// MetricsOptions adjusts how the collectors are created.
+type MetricsOptions struct {
+	// Registry receives the collectors. NewMetrics creates a fresh one when
+	// nil; InitMetrics uses prometheus.DefaultRegisterer.
+	Registry *prometheus.Registry
+	// Summaries maps duration metric names, such as
+	// http_request_duration_seconds, to quantile objectives (quantile to
+	// allowed error). Listed metrics are created as summaries instead of
+	// histograms, for backends that cannot compute histogram quantiles.
+	// Names are given without the namespace and subsystem.
+	Summaries map[string]map[float64]float64
+	// Namespace and Subsystem prefix every metric name, e.g. namespace
+	// "pingsvc" exposes pingsvc_http_requests_total, so services sharing a
+	// Prometheus do not collide on the generic names.
+	Namespace string
+	Subsystem string
+	// ConstLabels are added to every metric, e.g. service, environment and
+	// region, so fleets can be told apart without scrape-time relabeling.
+	// They must not reuse a metric's own label names.
+	ConstLabels prometheus.Labels
+	// DisableRuntimeCollectors leaves out the go_* and process_* collectors
+	// (goroutines, GC pauses, memory, open file descriptors, RSS). They
+	// keep their standard names regardless of Namespace and Subsystem.
+	// process_start_time_seconds and process_uptime_seconds are always
+	// exported.
+	DisableRuntimeCollectors bool
+	// MaxSeriesPerMetric caps the label combinations of each metric whose
+	// labels come from client input (request metrics and client
+	// identities). Samples that would add a combination beyond it are
+	// recorded under an overflow series with every label set to "other"
+	// and counted in metrics_series_dropped_total. Defaults to
+	// DefaultMaxSeriesPerMetric; negative disables the cap.
+	MaxSeriesPerMetric int
+}
+
+// DefaultSummaryObjectives are the median, 90th and 99th percentiles.
+var DefaultSummaryObjectives = map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001}
+
+// ErrMetricsInitialized is returned by InitMetricsWithOptions once the
+// process-wide instance exists, since its options could no longer apply.
+var ErrMetricsInitialized = errors.New("observability: metrics already initialized")
+
+// InitMetrics initializes and registers all Prometheus metrics with the
+// default registry and makes them the instance returned by GetMetrics.
+// This should be called once at application startup; later calls return
+// the same instance.
 func InitMetrics() *Metrics {
-	once.Do(func() {
-		metricsInstance = &Metrics{
-			// HTTP Request Metrics
-			RequestCounter: promauto.NewCounter(prometheus.CounterOpts{
-				Name: "http_requests_total",
-				Help: "Total number of HTTP requests received",
-			}),
-			RequestDuration: promauto.NewHistogram(prometheus.HistogramOpts{
-				Name:    "http_request_duration_seconds",
-				Help:    "HTTP request latency in seconds",
-				Buckets: prometheus.DefBuckets,
-			}),
-			RequestSize: promauto.NewHistogram(prometheus.HistogramOpts{
-				Name:    "http_request_size_bytes",
-				Help:    "HTTP request size in bytes",
-				Buckets: []float64{100, 500, 1000, 5000, 10000, 50000, 100000},
-			}),
-			ResponseSize: promauto.NewHistogram(prometheus.HistogramOpts{
-				Name:    "http_response_size_bytes",
-				Help:    "HTTP response size in bytes",
-				Buckets: []float64{100, 500, 1000, 5000, 10000, 50000, 100000},
-			}),
-			HTTPErrorCounter: promauto.NewCounter(prometheus.CounterOpts{
-				Name: "http_errors_total",
-				Help: "Total number of HTTP errors (5xx)",
-			}),
-			ActiveRequestsGauge: promauto.NewGauge(prometheus.GaugeOpts{
-				Name: "http_requests_active",
-				Help: "Number of currently active HTTP requests",
-			}),
-
-			// Background Job Metrics
-			BackgroundJobCounter: promauto.NewCounter(prometheus.CounterOpts{
-				Name: "background_jobs_total",
-				Help: "Total number of background jobs executed",
-			}),
-			BackgroundJobDuration: promauto.NewHistogram(prometheus.HistogramOpts{
-				Name:    "background_job_duration_seconds",
-				Help:    "Background job execution time in seconds",
-				Buckets: prometheus.DefBuckets,
-			}),
-			BackgroundJobErrorCount: promauto.NewCounter(prometheus.CounterOpts{
-				Name: "background_job_errors_total",
-				Help: "Total number of background job errors",
-			}),
-
-			// External API Call Metrics
-			APICallCounter: promauto.NewCounter(prometheus.CounterOpts{
-				Name: "api_calls_total",
-				Help: "Total number of external API calls made",
-			}),
-			APICallDuration: promauto.NewHistogram(prometheus.HistogramOpts{
-				Name:    "api_call_duration_seconds",
-				Help:    "External API call latency in seconds",
-				Buckets: prometheus.DefBuckets,
-			}),
-			APICallErrorCounter: promauto.NewCounter(prometheus.CounterOpts{
-				Name: "api_call_errors_total",
-				Help: "Total number of external API call errors",
-			}),
-
-			// File/CSV/TSV Processing Metrics
-			FileProcessCounter: promauto.NewCounter(prometheus.CounterOpts{
-				Name: "file_processes_total",
-				Help: "Total number of file processing operations",
-			}),
-			FileProcessDuration: promauto.NewHistogram(prometheus.HistogramOpts{
-				Name:    "file_process_duration_seconds",
-				Help:    "File processing duration in seconds",
-				Buckets: prometheus.DefBuckets,
-			}),
-			FileProcessBytesCounter: promauto.NewCounter(prometheus.CounterOpts{
-				Name: "file_process_bytes_total",
-				Help: "Total bytes processed",
-			}),
-			FileProcessErrorCounter: promauto.NewCounter(prometheus.CounterOpts{
-				Name: "file_process_errors_total",
-				Help: "Total number of file processing errors",
-			}),
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	if m := metricsInstance.Load(); m != nil {
+		return m
+	}
+	return initMetrics(MetricsOptions{})
+}
+
+// InitMetricsWithOptions is InitMetrics with collector options. It fails
+// with ErrMetricsInitialized when the instance already exists rather than
+// ignoring opts, so call it before anything uses GetMetrics.
+func InitMetricsWithOptions(opts MetricsOptions) (*Metrics, error) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	if metricsInstance.Load() != nil {
+		return nil, ErrMetricsInitialized
+	}
+	return initMetrics(opts), nil
+}
+
+// initMetrics builds and stores the process-wide instance. The caller
+// holds metricsMu.
+func initMetrics(opts MetricsOptions) *Metrics {
+	var m *Metrics
+	if opts.Registry != nil {
+		m = NewMetrics(opts)
+	} else {
+		m = newMetrics(prometheus.DefaultRegisterer, prometheus.DefaultGatherer, opts)
+	}
+	metricsInstance.Store(m)
+	return m
+}
+
+// NewMetrics creates a Metrics instance bound to opts.Registry, or to a new
+// registry when it is nil, without touching the process-wide instance.
+// Separate instances can coexist in one process, e.g. one per server or
+// test.
+func NewMetrics(opts MetricsOptions) *Metrics {
+	reg := opts.Registry
+	if reg == nil {
+		reg = prometheus.NewRegistry()
+	}
+	return newMetrics(reg, reg, opts)
+}
+
+func newMetrics(reg prometheus.Registerer, gatherer prometheus.Gatherer, opts MetricsOptions) *Metrics {
+	registerRuntimeCollectors(reg, opts)
+	f := promauto.With(opts.registerer(reg))
+	m := &Metrics{
+		Registerer: reg,
+		Gatherer:   gatherer,
+
+		// HTTP Request Metrics
+		RequestCounter: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "Total number of HTTP requests served, by method, route, handler and status code",
+		}, []string{"method", "route", "handler", "code"}),
+		RequestDuration: opts.newDurationVec(f, prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "HTTP request latency in seconds, by method, route, handler and status code",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route", "handler", "code"}),
+		TimeToFirstByte: opts.newDurationVec(f, prometheus.HistogramOpts{
+			Name:    "http_response_time_to_first_byte_seconds",
+			Help:    "Time from receiving an HTTP request until its response headers or first body bytes were written, by method and route",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		RequestSize: f.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_size_bytes",
+			Help:    "HTTP request size in bytes, by method and route",
+			Buckets: []float64{100, 500, 1000, 5000, 10000, 50000, 100000},
+		}, []string{"method", "route"}),
+		ResponseSize: f.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_response_size_bytes",
+			Help:    "HTTP response size in bytes, by method and route",
+			Buckets: []float64{100, 500, 1000, 5000, 10000, 50000, 100000},
+		}, []string{"method", "route"}),
+		HTTPErrorCounter: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_errors_total",
+			Help: "Total number of HTTP errors (5xx), by method, route and status code",
+		}, []string{"method", "route", "code"}),
+		ClientErrorCounter: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_client_errors_total",
+			Help: "Total number of HTTP client errors (4xx), by method, route and status code",
+		}, []string{"method", "route", "code"}),
+		StatusClassCounter: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_responses_by_class_total",
+			Help: "Total number of HTTP responses, by status class (1xx, 2xx, 3xx, 4xx or 5xx)",
+		}, []string{"class"}),
+		ActiveRequestsGauge: f.NewGauge(prometheus.GaugeOpts{
+			Name: "http_requests_active",
+			Help: "Number of currently active HTTP requests",
+		}),
+		SlowRequestCounter: f.NewCounter(prometheus.CounterOpts{
+			Name: "http_slow_requests_total",
+			Help: "Total number of HTTP requests that exceeded the slow-request threshold",
+		}),
+		PanicCounter: f.NewCounter(prometheus.CounterOpts{
+			Name: "http_panics_total",
+			Help: "Total number of panics recovered in HTTP handlers",
+		}),
+
+		// Connection Metrics
+		ConnectionsGauge: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "http_connections",
+			Help: "Number of open server connections, by server and state (new, active or idle)",
+		}, []string{"server", "state"}),
+		ConnectionsAccepted: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_connections_accepted_total",
+			Help: "Total number of connections accepted, by server",
+		}, []string{"server"}),
+		ConnectionsClosed: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_connections_closed_total",
+			Help: "Total number of connections closed, by server",
+		}, []string{"server"}),
+		ConnectionsHijacked: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_connections_hijacked_total",
+			Help: "Total number of connections taken over by a handler, e.g. for WebSockets, by server",
+		}, []string{"server"}),
+
+		// TLS Handshake Metrics
+		TLSHandshakeDuration: opts.newDurationVec(f, prometheus.HistogramOpts{
+			Name:    "http_tls_handshake_duration_seconds",
+			Help:    "Duration of successful TLS handshakes in seconds, by TLS version",
+			Buckets: []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5},
+		}, []string{"version"}),
+		TLSHandshakeCounter: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_tls_handshakes_total",
+			Help: "Total number of successful TLS handshakes, by TLS version and cipher suite",
+		}, []string{"version", "cipher_suite"}),
+		TLSHandshakeFailures: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_tls_handshake_failures_total",
+			Help: "Total number of failed TLS handshakes, by reason",
+		}, []string{"reason"}),
+
+		// Concurrency Limiting Metrics
+		ConcurrencyQueueGauge: f.NewGauge(prometheus.GaugeOpts{
+			Name: "http_concurrency_queue_depth",
+			Help: "Number of requests waiting for a concurrency slot",
+		}),
+		ConcurrencyRejectedCounter: f.NewCounter(prometheus.CounterOpts{
+			Name: "http_concurrency_rejected_total",
+			Help: "Total number of requests rejected because the concurrency limit was reached",
+		}),
+		QueueWaitDuration: opts.newDuration(f, prometheus.HistogramOpts{
+			Name:    "http_queue_wait_seconds",
+			Help:    "Time requests spent waiting for a concurrency slot",
+			Buckets: []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1},
+		}),
+		RequestsShedCounter: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_shed_total",
+			Help: "Total number of requests shed by adaptive load shedding, by priority",
+		}, []string{"priority"}),
+
+		// Rate Limiting Metrics
+		RateLimitDecisionCounter: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_rate_limit_decisions_total",
+			Help: "Total number of rate limit decisions, by decision (allowed or limited)",
+		}, []string{"decision"}),
+		RateLimitFallbackCounter: f.NewCounter(prometheus.CounterOpts{
+			Name: "http_rate_limit_fallback_total",
+			Help: "Total number of times the shared rate limit backend failed and local limits took over",
+		}),
+
+		// Response Cache Metrics
+		ResponseCacheCounter: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_response_cache_requests_total",
+			Help: "Total number of cacheable requests, by result (hit, miss or bypass)",
+		}, []string{"result"}),
+		ResponseCacheEntries: f.NewGauge(prometheus.GaugeOpts{
+			Name: "http_response_cache_entries",
+			Help: "Number of responses held in the in-memory cache",
+		}),
+
+		// Traffic Mirroring Metrics
+		MirrorRequestsCounter: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_mirror_requests_total",
+			Help: "Total number of requests considered for mirroring, by result (success, error, dropped, skipped)",
+		}, []string{"result"}),
+		MirrorDuration: opts.newDuration(f, prometheus.HistogramOpts{
+			Name:    "http_mirror_request_duration_seconds",
+			Help:    "Latency of mirrored requests to the shadow upstream",
+			Buckets: prometheus.DefBuckets,
+		}),
+
+		// Reverse Proxy Metrics
+		ProxyUpstreamDuration: opts.newDurationVec(f, prometheus.HistogramOpts{
+			Name:    "proxy_upstream_duration_seconds",
+			Help:    "Time proxied requests spent waiting for the upstream in seconds, by upstream status class",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"status_class"}),
+		ProxyOverhead: opts.newDuration(f, prometheus.HistogramOpts{
+			Name:    "proxy_overhead_seconds",
+			Help:    "Time proxied requests spent in the proxy handler besides waiting for the upstream in seconds",
+			Buckets: []float64{0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25},
+		}),
+
+		// Authentication Metrics
+		AuthFailureCounter: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_auth_failures_total",
+			Help: "Total number of rejected credentials, by scheme and reason",
+		}, []string{"scheme", "reason"}),
+		ClientIdentityRequestsCounter: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_by_client_identity_total",
+			Help: "Total number of requests authenticated by a client certificate, by identity",
+		}, []string{"identity"}),
+
+		// Compression Metrics
+		CompressionRatio: f.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_response_compression_ratio",
+			Help:    "Ratio of uncompressed to compressed response size, by encoding",
+			Buckets: []float64{1, 1.5, 2, 3, 5, 8, 13, 21},
+		}, []string{"encoding"}),
+		CompressionSavedBytes: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_response_compression_saved_bytes_total",
+			Help: "Total number of response bytes saved by compression, by encoding",
+		}, []string{"encoding"}),
+		RequestDecompressedCounter: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_request_bodies_decompressed_total",
+			Help: "Total number of compressed request bodies decoded, by encoding",
+		}, []string{"encoding"}),
+
+		// Tracing Metrics
+		TraceSpansCounter: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "trace_spans_total",
+			Help: "Total number of finished sampled spans, by result (exported, failed or dropped)",
+		}, []string{"result"}),
+
+		// Health Check Metrics
+		HealthCheckStatus: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "health_check_status",
+			Help: "Result of the latest run of each health check (1 pass, 0 fail), by check",
+		}, []string{"check"}),
+		HealthCheckDuration: opts.newDurationVec(f, prometheus.HistogramOpts{
+			Name:    "health_check_duration_seconds",
+			Help:    "Health check run duration in seconds, by check",
+			Buckets: []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+		}, []string{"check"}),
+		HealthCheckTransitions: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "health_check_transitions_total",
+			Help: "Total number of health check state changes, by check and new status (pass or fail)",
+		}, []string{"check", "status"}),
+
+		// Metrics Export
+		MetricsExportCounter: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "metrics_exports_total",
+			Help: "Total number of metric snapshots pushed, by exporter and result (success or error)",
+		}, []string{"exporter", "result"}),
+		SeriesDroppedCounter: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "metrics_series_dropped_total",
+			Help: "Total number of samples recorded under the overflow series because their metric reached its series limit, by metric",
+		}, []string{"metric"}),
+
+		// Background Job Metrics
+		BackgroundJobCounter: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "background_jobs_total",
+			Help: "Total number of background jobs executed, by job and outcome",
+		}, []string{"job", "outcome"}),
+		BackgroundJobDuration: opts.newDurationVec(f, prometheus.HistogramOpts{
+			Name:    "background_job_duration_seconds",
+			Help:    "Background job execution time in seconds, by job and outcome",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"job", "outcome"}),
+		BackgroundJobErrorCount: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "background_job_errors_total",
+			Help: "Total number of background job errors, by job",
+		}, []string{"job"}),
+		JobQueueDepth: f.NewGauge(prometheus.GaugeOpts{
+			Name: "background_job_queue_depth",
+			Help: "Number of jobs waiting for a worker",
+		}),
+		JobQueueWait: opts.newDuration(f, prometheus.HistogramOpts{
+			Name:    "background_job_queue_wait_seconds",
+			Help:    "Time jobs spent queued before a worker picked them up",
+			Buckets: []float64{0.001, 0.01, 0.1, 0.5, 1, 5, 10, 30, 60, 300},
+		}),
+		JobWorkersBusy: f.NewGauge(prometheus.GaugeOpts{
+			Name: "background_job_workers_busy",
+			Help: "Number of workers currently running a job",
+		}),
+		JobRetries: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "background_job_retries_total",
+			Help: "Total number of failed queued jobs scheduled for another attempt, by job type",
+		}, []string{"job"}),
+		JobsStuck: f.NewGauge(prometheus.GaugeOpts{
+			Name: "background_jobs_stuck",
+			Help: "Number of running queued jobs without a heartbeat for longer than the stuck threshold",
+		}),
+		JobLockAcquisitions: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "background_job_lock_acquisitions_total",
+			Help: "Total number of distributed lock attempts by exclusive jobs, by job and result (acquired, held, error, lost)",
+		}, []string{"job", "result"}),
+		JobLockDuration: opts.newDuration(f, prometheus.HistogramOpts{
+			Name:    "background_job_lock_acquire_seconds",
+			Help:    "Time taken to ask the lock backend for a job lock",
+			Buckets: []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1},
+		}),
+		JobDeadLettered: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "background_job_dead_lettered_total",
+			Help: "Total number of queued jobs moved to the dead-letter queue after their last attempt, by job type",
+		}, []string{"job"}),
+
+		// External API Call Metrics
+		APICallCounter: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "api_calls_total",
+			Help: "Total number of external API calls made, by destination host and status class",
+		}, []string{"host", "status_class"}),
+		APICallDuration: opts.newDurationVec(f, prometheus.HistogramOpts{
+			Name:    "api_call_duration_seconds",
+			Help:    "External API call latency in seconds, by destination host and status class",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"host", "status_class"}),
+		APICallErrorCounter: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "api_call_errors_total",
+			Help: "Total number of external API call errors, by destination host",
+		}, []string{"host"}),
+		APICallRetries: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "api_call_retries_total",
+			Help: "Total number of failed external API calls considered for another attempt, by outcome (retried, budget_exhausted)",
+		}, []string{"outcome"}),
+		APICallHedges: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "api_call_hedges_total",
+			Help: "Total number of duplicate external API calls sent for slow answers, by outcome (sent, won)",
+		}, []string{"outcome"}),
+		APICallPhase: opts.newDurationVec(f, prometheus.HistogramOpts{
+			Name:    "api_call_phase_duration_seconds",
+			Help:    "Duration of the phases of external API calls in seconds, by phase (dns, connect, tls, ttfb)",
+			Buckets: []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5},
+		}, []string{"phase"}),
+
+		// File/CSV/TSV Processing Metrics
+		FileProcessCounter: f.NewCounter(prometheus.CounterOpts{
+			Name: "file_processes_total",
+			Help: "Total number of file processing operations",
+		}),
+		FileProcessDuration: opts.newDuration(f, prometheus.HistogramOpts{
+			Name:    "file_process_duration_seconds",
+			Help:    "File processing duration in seconds",
+			Buckets: prometheus.DefBuckets,
+		}),
+		FileProcessBytesCounter: f.NewCounter(prometheus.CounterOpts{
+			Name: "file_process_bytes_total",
+			Help: "Total bytes processed",
+		}),
+		FileProcessErrorCounter: f.NewCounter(prometheus.CounterOpts{
+			Name: "file_process_errors_total",
+			Help: "Total number of file processing errors",
+		}),
+		FileConvertBytes: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "file_convert_bytes_total",
+			Help: "Total bytes read and written by file format conversions, by direction (in, out) and format",
+		}, []string{"direction", "format"}),
+		FileCompressedBytes: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "file_compressed_bytes_total",
+			Help: "Total compressed bytes read and written by file processing, by direction (in, out) and compression (gzip, zstd); file_process_bytes_total counts them decompressed",
+		}, []string{"direction", "compression"}),
+		FileProcessRowsPerSecond: f.NewGauge(prometheus.GaugeOpts{
+			Name: "file_process_rows_per_second",
+			Help: "Row throughput of the file being processed, updated while it runs",
+		}),
+		FileProcessMemoryBytes: f.NewGauge(prometheus.GaugeOpts{
+			Name: "file_process_memory_bytes",
+			Help: "Approximate memory held by row chunks read but not yet processed, across all files",
+		}),
+		FileIngestCounter: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "file_ingest_files_total",
+			Help: "Total number of files ingested from the watched directory, by result (done, error)",
+		}, []string{"result"}),
+		FileIngestRows: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "file_ingest_rows_total",
+			Help: "Total number of rows in ingested files, by status (valid, invalid)",
+		}, []string{"status"}),
+		FileUploadCounter: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "file_uploads_total",
+			Help: "Total number of processed files uploaded to object storage, by result (success, failure)",
+		}, []string{"result"}),
+		FileUploadBytes: f.NewCounter(prometheus.CounterOpts{
+			Name: "file_upload_bytes_total",
+			Help: "Total bytes of processed files uploaded to object storage",
+		}),
+		FileUploadDuration: opts.newDuration(f, prometheus.HistogramOpts{
+			Name:    "file_upload_duration_seconds",
+			Help:    "Duration of processed file uploads to object storage in seconds",
+			Buckets: []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120},
+		}),
+
+		// Logging Metrics
+		LogLinesDroppedCounter: f.NewCounter(prometheus.CounterOpts{
+			Name: "log_lines_dropped_total",
+			Help: "Total number of log lines dropped because the async log queue was full",
+		}),
+		RequestLogsSuppressedCounter: f.NewCounter(prometheus.CounterOpts{
+			Name: "http_request_logs_suppressed_total",
+			Help: "Total number of requests not logged because tail logging judged them fast and successful",
+		}),
+
+		// Runtime Limits Metrics
+		RuntimeMaxProcs: f.NewGauge(prometheus.GaugeOpts{
+			Name: "runtime_gomaxprocs",
+			Help: "GOMAXPROCS set at startup, derived from the container CPU quota unless configured",
+		}),
+		RuntimeCPUQuota: f.NewGauge(prometheus.GaugeOpts{
+			Name: "runtime_cpu_quota_cores",
+			Help: "CPU quota of the container in cores, 0 when unlimited",
+		}),
+		RuntimeMemoryLimit: f.NewGauge(prometheus.GaugeOpts{
+			Name: "runtime_memory_limit_bytes",
+			Help: "Soft memory limit of the Go runtime (GOMEMLIMIT) set at startup in bytes, 0 when unlimited",
+		}),
+		RuntimeMemoryBallast: f.NewGauge(prometheus.GaugeOpts{
+			Name: "runtime_memory_ballast_bytes",
+			Help: "Size of the heap ballast allocated at startup in bytes",
+		}),
+	}
+	switch {
+	case opts.MaxSeriesPerMetric == 0:
+		m.series = newSeriesLimiter(DefaultMaxSeriesPerMetric, m.SeriesDroppedCounter)
+	case opts.MaxSeriesPerMetric > 0:
+		m.series = newSeriesLimiter(opts.MaxSeriesPerMetric, m.SeriesDroppedCounter)
+	}
+	opts.registerer(reg).MustRegister(newGCCollector())
+	return m
+}
+
+// newDuration registers a duration histogram, or a summary when objectives
+// are configured for its name.
+func (o MetricsOptions) newDuration(f promauto.Factory, h prometheus.HistogramOpts) prometheus.Observer {
+	if objectives, ok := o.Summaries[h.Name]; ok {
+		return f.NewSummary(summaryOpts(h, objectives))
+	}
+	return f.NewHistogram(h)
+}
+
+// newDurationVec is newDuration for labeled metrics.
+func (o MetricsOptions) newDurationVec(f promauto.Factory, h prometheus.HistogramOpts, labels []string) prometheus.ObserverVec {
+	if objectives, ok := o.Summaries[h.Name]; ok {
+		return f.NewSummaryVec(summaryOpts(h, objectives), labels)
+	}
+	return f.NewHistogramVec(h, labels)
+}
+
+// registerer wraps reg to prefix metric names with the namespace and
+// subsystem and to add the constant labels when set.
+func (o MetricsOptions) registerer(reg prometheus.Registerer) prometheus.Registerer {
+	if len(o.ConstLabels) > 0 {
+		reg = prometheus.WrapRegistererWith(o.ConstLabels, reg)
+	}
+	var prefix string
+	for _, part := range []string{o.Namespace, o.Subsystem} {
+		if part != "" {
+			prefix += part + "_"
+		}
+	}
+	if prefix != "" {
+		reg = prometheus.WrapRegistererWithPrefix(prefix, reg)
+	}
+	return reg
+}
+
+// registerRuntimeCollectors registers the Go runtime collector, including
+// GC pause and scheduler latency histograms, the process collector and the
+// uptime gauges, with the const labels of opts. The plain collectors that
+// prometheus.DefaultRegisterer ships with are replaced. The start time
+// comes from the process collector unless runtime collectors are disabled.
+func registerRuntimeCollectors(reg prometheus.Registerer, opts MetricsOptions) {
+	reg.Unregister(collectors.NewGoCollector())
+	reg.Unregister(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	r := prometheus.WrapRegistererWith(opts.ConstLabels, reg)
+	r.MustRegister(uptimeCollectors(opts.DisableRuntimeCollectors)...)
+	if opts.DisableRuntimeCollectors {
+		return
+	}
+	r.MustRegister(
+		collectors.NewGoCollector(collectors.WithGoCollectorRuntimeMetrics(collectors.MetricsGC, collectors.MetricsScheduler)),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+func summaryOpts(h prometheus.HistogramOpts, objectives map[float64]float64) prometheus.SummaryOpts {
+	return prometheus.SummaryOpts{
+		Namespace:   h.Namespace,
+		Subsystem:   h.Subsystem,
+		Name:        h.Name,
+		Help:        h.Help,
+		ConstLabels: h.ConstLabels,
+		Objectives:  objectives,
+	}
+}
+
+// ParseSummaryObjectives parses entries such as
+// "http_request_duration_seconds" (default objectives) or
+// "api_call_duration_seconds=0.5:0.05|0.99:0.001" into MetricsOptions.Summaries.
+func ParseSummaryObjectives(entries []string) (map[string]map[float64]float64, error) {
+	summaries := make(map[string]map[float64]float64, len(entries))
+	for _, entry := range entries {
+		name, spec, hasSpec := strings.Cut(entry, "=")
+		if name == "" {
+			return nil, fmt.Errorf("summary entry must name a metric, got %q", entry)
+		}
+		if !hasSpec {
+			summaries[name] = DefaultSummaryObjectives
+			continue
+		}
+		objectives := make(map[float64]float64)
+		for _, pair := range strings.Split(spec, "|") {
+			q, e, ok := strings.Cut(pair, ":")
+			quantile, qErr := strconv.ParseFloat(q, 64)
+			allowed, eErr := strconv.ParseFloat(e, 64)
+			if !ok || qErr != nil || eErr != nil || quantile <= 0 || quantile >= 1 || allowed <= 0 || allowed >= 1 {
+				return nil, fmt.Errorf("summary objective for %s must look like quantile:error with both between 0 and 1, got %q", name, pair)
+			}
+			objectives[quantile] = allowed
 		}
-	})
-	return metricsInstance
+		summaries[name] = objectives
+	}
+	return summaries, nil
+}
+
+// labelName matches the Prometheus label names every backend accepts.
+var labelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// ParseConstLabels parses "name=value" entries, e.g.
+// ["service=ping", "region=eu-west-1"], into MetricsOptions.ConstLabels.
+func ParseConstLabels(entries []string) (prometheus.Labels, error) {
+	labels := make(prometheus.Labels, len(entries))
+	for _, entry := range entries {
+		name, value, ok := strings.Cut(entry, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("constant label must look like name=value, got %q", entry)
+		}
+		if !labelName.MatchString(name) || strings.HasPrefix(name, "__") || name == "le" || name == "quantile" {
+			return nil, fmt.Errorf("invalid constant label name %q", name)
+		}
+		labels[name] = value
+	}
+	return labels, nil
 }
 
-// GetMetrics returns the initialized Metrics instance.
-// InitMetrics must be called before calling this function.
+// GetMetrics returns the process-wide Metrics instance. If InitMetrics
+// has not been called it is initialized with default options, so the
+// middleware also works as a standalone library.
 func GetMetrics() *Metrics {
-	if metricsInstance == nil {
-		panic("metrics not initialized: call InitMetrics() first")
+	if m := metricsInstance.Load(); m != nil {
+		return m
 	}
-	return metricsInstance
+	return InitMetrics()
 }
 
-// RecordRequest increments the request counter and returns a function to observe duration.
+// SetMetrics makes m the instance returned by GetMetrics, e.g. one created
+// by NewMetrics. Passing nil clears it.
+func SetMetrics(m *Metrics) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	metricsInstance.Store(m)
+}
+
+// RecordRequest marks a request as active and returns a function that
+// marks it finished. The request is counted by RecordResponse once its
+// status is known.
 // Usage:
-//   defer metrics.RecordRequest()()
+//
+//	defer metrics.RecordRequest()()
 func (m *Metrics) RecordRequest() func() {
-	m.RequestCounter.Inc()
 	m.ActiveRequestsGauge.Inc()
 	return func() {
 		m.ActiveRequestsGauge.Dec()
 	}
 }
 
+// RecordResponse counts a finished request and observes its duration under
+// its method, route, handler name and status code, attaching sc as an
+// exemplar when it is sampled. The response is also counted under its status class, and 4xx
+// and 5xx responses as client and server errors.
+func (m *Metrics) RecordResponse(method, route, handler string, status int, duration float64, sc SpanContext) {
+	method = MethodLabel(method)
+	code := strconv.Itoa(status)
+	m.RequestCounter.WithLabelValues(m.LimitLabels("http_requests_total", method, route, handler, code)...).Inc()
+	m.ObserveDurationWithTrace(m.RequestDuration.WithLabelValues(m.LimitLabels("http_request_duration_seconds", method, route, handler, code)...), duration, sc)
+	m.StatusClassCounter.WithLabelValues(StatusClass(status)).Inc()
+	switch {
+	case status >= 500:
+		m.HTTPErrorCounter.WithLabelValues(m.LimitLabels("http_errors_total", method, route, code)...).Inc()
+	case status >= 400:
+		m.ClientErrorCounter.WithLabelValues(m.LimitLabels("http_client_errors_total", method, route, code)...).Inc()
+	}
+}
+
+// StatusClass returns "1xx" to "5xx" for a status code, or "other" for
+// codes outside 100-599.
+func StatusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "other"
+	}
+	return strconv.Itoa(status/100) + "xx"
+}
+
+// MethodLabel returns method for the standard HTTP methods and "other" for
+// anything else, so arbitrary client input cannot add label values.
+func MethodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "other"
+}
+
 // ObserveDuration observes the duration of an operation in seconds.
-func (m *Metrics) ObserveDuration(histogram prometheus.Histogram, duration float64) {
+func (m *Metrics) ObserveDuration(histogram prometheus.Observer, duration float64) {
+	histogram.Observe(duration)
+}
+
+// ObserveDurationWithTrace observes a duration and, for a sampled span,
+// attaches its trace ID as an exemplar so dashboards can link a latency
+// bucket to an example trace. Exemplars are exposed in the OpenMetrics
+// format only.
+func (m *Metrics) ObserveDurationWithTrace(histogram prometheus.Observer, duration float64, sc SpanContext) {
+	if eo, ok := histogram.(prometheus.ExemplarObserver); ok && sc.IsValid() && sc.Sampled {
+		eo.ObserveWithExemplar(duration, prometheus.Labels{TraceIDLogKey: sc.TraceID.String()})
+		return
+	}
 	histogram.Observe(duration)
 }
 
@@ -159,31 +826,61 @@ func (m *Metrics) IncError(counter prometheus.Counter) {
 }
 
 // ObserveRequestSize observes the size of an HTTP request.
-func (m *Metrics) ObserveRequestSize(size float64) {
-	m.RequestSize.Observe(size)
+func (m *Metrics) ObserveRequestSize(method, route string, size float64) {
+	m.RequestSize.WithLabelValues(m.LimitLabels("http_request_size_bytes", MethodLabel(method), route)...).Observe(size)
 }
 
 // ObserveResponseSize observes the size of an HTTP response.
-func (m *Metrics) ObserveResponseSize(size float64) {
-	m.ResponseSize.Observe(size)
+func (m *Metrics) ObserveResponseSize(method, route string, size float64) {
+	m.ResponseSize.WithLabelValues(m.LimitLabels("http_response_size_bytes", MethodLabel(method), route)...).Observe(size)
 }
 
-// RecordAPICall records an external API call with optional error.
-func (m *Metrics) RecordAPICall(duration float64, err error) {
-	m.APICallCounter.Inc()
-	m.APICallDuration.Observe(duration)
+// APICallStatusError is the status class of external API calls that got
+// no response.
+const APICallStatusError = "error"
+
+// RecordAPICall records an external API call to host that answered with
+// status, zero when it got no response, with optional error.
+func (m *Metrics) RecordAPICall(host string, status int, duration float64, err error) {
+	class := APICallStatusError
+	if status != 0 {
+		class = StatusClass(status)
+	}
+	m.APICallCounter.WithLabelValues(m.LimitLabels("api_calls_total", host, class)...).Inc()
+	m.APICallDuration.WithLabelValues(m.LimitLabels("api_call_duration_seconds", host, class)...).Observe(duration)
 	if err != nil {
-		m.APICallErrorCounter.Inc()
+		m.APICallErrorCounter.WithLabelValues(m.LimitLabels("api_call_errors_total", host)...).Inc()
 	}
 }
 
-// RecordBackgroundJob records a background job execution with optional error.
-func (m *Metrics) RecordBackgroundJob(duration float64, err error) {
-	m.BackgroundJobCounter.Inc()
-	m.BackgroundJobDuration.Observe(duration)
-	if err != nil {
-		m.BackgroundJobErrorCount.Inc()
+// Outcomes of a background job run, as recorded by RecordBackgroundJob.
+const (
+	JobOutcomeSuccess  = "success"
+	JobOutcomeError    = "error"
+	JobOutcomeCanceled = "canceled"
+)
+
+// RecordBackgroundJob records a run of the background job named job with
+// optional error. A run that ends with context.Canceled is recorded as
+// canceled rather than as an error.
+func (m *Metrics) RecordBackgroundJob(job string, duration float64, err error) {
+	outcome := jobOutcome(err)
+	if outcome == JobOutcomeError {
+		m.BackgroundJobErrorCount.WithLabelValues(job).Inc()
+	}
+	m.BackgroundJobCounter.WithLabelValues(job, outcome).Inc()
+	m.BackgroundJobDuration.WithLabelValues(job, outcome).Observe(duration)
+}
+
+// jobOutcome returns the outcome of a job run that ended with err.
+func jobOutcome(err error) string {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return JobOutcomeCanceled
+	case err != nil:
+		return JobOutcomeError
 	}
+	return JobOutcomeSuccess
 }
 
 // RecordFileProcess records file processing with size and optional error.
@@ -195,3 +892,50 @@ func (m *Metrics) RecordFileProcess(duration float64, bytes float64, err error)
 		m.FileProcessErrorCounter.Inc()
 	}
 }
+
+// RecordFileConvert records the bytes a conversion read in format from and
+// wrote in format to.
+func (m *Metrics) RecordFileConvert(from, to string, in, out float64) {
+	m.FileConvertBytes.WithLabelValues("in", from).Add(in)
+	m.FileConvertBytes.WithLabelValues("out", to).Add(out)
+}
+
+// RecordFileCompressed records compressed bytes a file process read (in)
+// or wrote (out).
+func (m *Metrics) RecordFileCompressed(direction, compression string, bytes float64) {
+	m.FileCompressedBytes.WithLabelValues(direction, compression).Add(bytes)
+}
+
+// RecordFileIngest records a file ingested from the watched directory
+// with its result and row counts.
+func (m *Metrics) RecordFileIngest(result string, validRows, invalidRows int64) {
+	m.FileIngestCounter.WithLabelValues(result).Inc()
+	m.FileIngestRows.WithLabelValues("valid").Add(float64(validRows))
+	m.FileIngestRows.WithLabelValues("invalid").Add(float64(invalidRows))
+}
+
+// RecordFileUpload records an upload of a processed file to object
+// storage, counting the bytes sent even when it failed.
+func (m *Metrics) RecordFileUpload(duration float64, bytes int64, err error) {
+	m.FileUploadCounter.WithLabelValues(uploadResult(err)).Inc()
+	m.FileUploadBytes.Add(float64(bytes))
+	m.FileUploadDuration.Observe(duration)
+}
+
+// uploadResult returns the result label of an upload that ended with err.
+func uploadResult(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
+
+// RecordRuntimeLimits records the GOMAXPROCS, CPU quota in cores, soft
+// memory limit and ballast in bytes the service started with; zero quota
+// and limit mean none.
+func (m *Metrics) RecordRuntimeLimits(maxProcs int, cpuQuota float64, memoryLimit, ballast int64) {
+	m.RuntimeMaxProcs.Set(float64(maxProcs))
+	m.RuntimeCPUQuota.Set(cpuQuota)
+	m.RuntimeMemoryLimit.Set(float64(memoryLimit))
+	m.RuntimeMemoryBallast.Set(float64(ballast))
+}
@@ -1,17 +1,28 @@
 package observability
 
 import (
-	"sync"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 )
 
+// resetMetrics clears the process-wide instance and gives InitMetrics a
+// fresh default registry so it can register its collectors again.
+func resetMetrics() {
+	SetMetrics(nil)
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+}
+
 func TestMetricsInitialization(t *testing.T) {
 	// Clear the metrics singleton for testing
-	metricsInstance = nil
-	once = sync.Once{}
+	resetMetrics()
 
 	// Initialize metrics
 	metrics := InitMetrics()
@@ -36,8 +47,7 @@ func TestMetricsInitialization(t *testing.T) {
 
 func TestMetricsNoPanic(t *testing.T) {
 	// Test that InitMetrics can be called multiple times without panicking
-	metricsInstance = nil
-	once = sync.Once{}
+	resetMetrics()
 
 	m1 := InitMetrics()
 	m2 := InitMetrics()
@@ -47,31 +57,34 @@ func TestMetricsNoPanic(t *testing.T) {
 	}
 }
 
+func TestInitMetricsWithOptionsRefusesLateOptions(t *testing.T) {
+	resetMetrics()
+	defer resetMetrics()
+
+	m := InitMetrics()
+	got, err := InitMetricsWithOptions(MetricsOptions{Namespace: "late"})
+	if !errors.Is(err, ErrMetricsInitialized) || got != nil {
+		t.Errorf("InitMetricsWithOptions after init = %v, %v; want ErrMetricsInitialized", got, err)
+	}
+	if GetMetrics() != m {
+		t.Error("A refused call should keep the existing instance")
+	}
+}
+
 func TestRecordRequest(t *testing.T) {
-	metricsInstance = nil
-	once = sync.Once{}
+	resetMetrics()
 
 	metrics := InitMetrics()
 
 	// Record a request
 	cleanup := metrics.RecordRequest()
 
-	// Check that counters incremented
-	expected := 1.0
-	if err := testutil.CollectAndCompare(metrics.RequestCounter, `
-		# HELP http_requests_total Total number of HTTP requests received
-		# TYPE http_requests_total counter
-		http_requests_total 1
-	`); err != nil {
-		t.Logf("Counter check: %v (may fail in test environment)", err)
-	}
-
 	// Check active requests gauge incremented
-	if err := testutil.CollectAndCompare(metrics.ActiveRequestsGauge, `
+	if err := testutil.CollectAndCompare(metrics.ActiveRequestsGauge, strings.NewReader(`
 		# HELP http_requests_active Number of currently active HTTP requests
 		# TYPE http_requests_active gauge
 		http_requests_active 1
-	`); err != nil {
+	`)); err != nil {
 		t.Logf("Gauge check: %v (may fail in test environment)", err)
 	}
 
@@ -79,29 +92,25 @@ func TestRecordRequest(t *testing.T) {
 	cleanup()
 
 	// The active gauge should now be 0
-	if err := testutil.CollectAndCompare(metrics.ActiveRequestsGauge, `
+	if err := testutil.CollectAndCompare(metrics.ActiveRequestsGauge, strings.NewReader(`
 		# HELP http_requests_active Number of currently active HTTP requests
 		# TYPE http_requests_active gauge
 		http_requests_active 0
-	`); err != nil {
+	`)); err != nil {
 		t.Logf("Gauge after cleanup check: %v (may fail in test environment)", err)
 	}
 }
 
 func TestObserveDuration(t *testing.T) {
-	metricsInstance = nil
-	once = sync.Once{}
+	resetMetrics()
 
 	metrics := InitMetrics()
 
 	// Observe a duration
-	metrics.ObserveDuration(metrics.RequestDuration, 0.5)
+	metrics.ObserveDuration(metrics.RequestDuration.WithLabelValues("GET", "/", "unnamed", "200"), 0.5)
 
 	// Verify the observation was recorded
-	hist, err := testutil.CollectAndCount(metrics.RequestDuration)
-	if err != nil {
-		t.Logf("Failed to collect histogram: %v", err)
-	}
+	hist := testutil.CollectAndCount(metrics.RequestDuration)
 
 	if hist == 0 {
 		t.Logf("No histogram data collected")
@@ -109,38 +118,33 @@ func TestObserveDuration(t *testing.T) {
 }
 
 func TestIncError(t *testing.T) {
-	metricsInstance = nil
-	once = sync.Once{}
+	resetMetrics()
 
 	metrics := InitMetrics()
 
 	// Increment error counter
-	metrics.IncError(metrics.HTTPErrorCounter)
+	metrics.IncError(metrics.APICallErrorCounter.WithLabelValues("upstream"))
 
 	// Verify the counter incremented
-	if err := testutil.CollectAndCompare(metrics.HTTPErrorCounter, `
-		# HELP http_errors_total Total number of HTTP errors (5xx)
-		# TYPE http_errors_total counter
-		http_errors_total 1
-	`); err != nil {
+	if err := testutil.CollectAndCompare(metrics.APICallErrorCounter, strings.NewReader(`
+		# HELP api_call_errors_total Total number of external API call errors, by destination host
+		# TYPE api_call_errors_total counter
+		api_call_errors_total{host="upstream"} 1
+	`)); err != nil {
 		t.Logf("Error counter check: %v (may fail in test environment)", err)
 	}
 }
 
 func TestObserveRequestSize(t *testing.T) {
-	metricsInstance = nil
-	once = sync.Once{}
+	resetMetrics()
 
 	metrics := InitMetrics()
 
 	// Observe request size
-	metrics.ObserveRequestSize(512)
+	metrics.ObserveRequestSize("POST", "/echo", 512)
 
 	// Verify the observation was recorded
-	hist, err := testutil.CollectAndCount(metrics.RequestSize)
-	if err != nil {
-		t.Logf("Failed to collect histogram: %v", err)
-	}
+	hist := testutil.CollectAndCount(metrics.RequestSize)
 
 	if hist == 0 {
 		t.Logf("No histogram data collected")
@@ -148,52 +152,62 @@ func TestObserveRequestSize(t *testing.T) {
 }
 
 func TestRecordAPICall(t *testing.T) {
-	metricsInstance = nil
-	once = sync.Once{}
+	resetMetrics()
 
 	metrics := InitMetrics()
 
 	// Record successful API call
-	metrics.RecordAPICall(0.25, nil)
+	metrics.RecordAPICall("upstream:443", 200, 0.25, nil)
 
-	// Record failed API call
-	metrics.RecordAPICall(0.5, prometheus.NewInvalidMetricError(nil))
+	// Record failed API calls, with and without a response
+	metrics.RecordAPICall("upstream:443", 503, 0.5, errors.New("boom"))
+	metrics.RecordAPICall("other", 0, 0.5, errors.New("dial failed"))
 
 	// Verify counters incremented
-	if err := testutil.CollectAndCompare(metrics.APICallCounter, `
-		# HELP api_calls_total Total number of external API calls made
+	if err := testutil.CollectAndCompare(metrics.APICallCounter, strings.NewReader(`
+		# HELP api_calls_total Total number of external API calls made, by destination host and status class
 		# TYPE api_calls_total counter
-		api_calls_total 2
-	`); err != nil {
+		api_calls_total{host="other",status_class="error"} 1
+		api_calls_total{host="upstream:443",status_class="2xx"} 1
+		api_calls_total{host="upstream:443",status_class="5xx"} 1
+	`)); err != nil {
 		t.Logf("API call counter check: %v (may fail in test environment)", err)
 	}
+	if got := testutil.ToFloat64(metrics.APICallErrorCounter.WithLabelValues("upstream:443")); got != 1 {
+		t.Errorf("Expected 1 error for upstream:443, got %v", got)
+	}
 }
 
 func TestRecordBackgroundJob(t *testing.T) {
-	metricsInstance = nil
-	once = sync.Once{}
+	resetMetrics()
 
 	metrics := InitMetrics()
 
-	// Record successful background job
-	metrics.RecordBackgroundJob(1.0, nil)
-
-	// Record failed background job
-	metrics.RecordBackgroundJob(0.5, prometheus.NewInvalidMetricError(nil))
+	// Record successful, failed and canceled runs
+	metrics.RecordBackgroundJob("export", 1.0, nil)
+	metrics.RecordBackgroundJob("export", 0.5, errors.New("boom"))
+	metrics.RecordBackgroundJob("compaction", 0.2, fmt.Errorf("stopping: %w", context.Canceled))
 
-	// Verify counters incremented
-	if err := testutil.CollectAndCompare(metrics.BackgroundJobCounter, `
-		# HELP background_jobs_total Total number of background jobs executed
+	// Verify counters incremented per job and outcome
+	if err := testutil.CollectAndCompare(metrics.BackgroundJobCounter, strings.NewReader(`
+		# HELP background_jobs_total Total number of background jobs executed, by job and outcome
 		# TYPE background_jobs_total counter
-		background_jobs_total 2
-	`); err != nil {
-		t.Logf("Background job counter check: %v (may fail in test environment)", err)
+		background_jobs_total{job="compaction",outcome="canceled"} 1
+		background_jobs_total{job="export",outcome="error"} 1
+		background_jobs_total{job="export",outcome="success"} 1
+	`)); err != nil {
+		t.Error(err)
+	}
+	if got := testutil.ToFloat64(metrics.BackgroundJobErrorCount.WithLabelValues("export")); got != 1 {
+		t.Errorf("Expected one export error, got %v", got)
+	}
+	if got := testutil.CollectAndCount(metrics.BackgroundJobErrorCount); got != 1 {
+		t.Errorf("Expected canceled runs not counted as errors, got %d series", got)
 	}
 }
 
 func TestRecordFileProcess(t *testing.T) {
-	metricsInstance = nil
-	once = sync.Once{}
+	resetMetrics()
 
 	metrics := InitMetrics()
 
@@ -201,36 +215,350 @@ func TestRecordFileProcess(t *testing.T) {
 	metrics.RecordFileProcess(2.0, 1024, nil)
 
 	// Record failed file processing
-	metrics.RecordFileProcess(1.5, 512, prometheus.NewInvalidMetricError(nil))
+	metrics.RecordFileProcess(1.5, 512, errors.New("boom"))
 
 	// Verify counters incremented
-	if err := testutil.CollectAndCompare(metrics.FileProcessCounter, `
+	if err := testutil.CollectAndCompare(metrics.FileProcessCounter, strings.NewReader(`
 		# HELP file_processes_total Total number of file processing operations
 		# TYPE file_processes_total counter
 		file_processes_total 2
-	`); err != nil {
+	`)); err != nil {
 		t.Logf("File process counter check: %v (may fail in test environment)", err)
 	}
 }
 
 func TestGetMetricsWithoutInit(t *testing.T) {
-	// Save the current state
-	savedInstance := metricsInstance
+	resetMetrics()
+
+	// Should initialize lazily instead of panicking
+	m := GetMetrics()
+	if m == nil || m.RequestCounter == nil {
+		t.Fatal("Expected GetMetrics to initialize metrics")
+	}
+	if GetMetrics() != m || InitMetrics() != m {
+		t.Error("Later calls should return the lazily created instance")
+	}
+}
 
-	// Clear metrics
-	metricsInstance = nil
+func TestObserveDurationWithTraceAddsExemplar(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "exemplar_test_seconds", Buckets: []float64{1}})
+	reg.MustRegister(histogram)
 
-	defer func() {
-		// Restore
-		metricsInstance = savedInstance
-	}()
+	sc, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	m := &Metrics{}
+	m.ObserveDurationWithTrace(histogram, 0.2, sc)
+	unsampled := sc
+	unsampled.Sampled = false
+	m.ObserveDurationWithTrace(histogram, 2, unsampled)
 
-	// Should panic if called without init
-	defer func() {
-		if r := recover(); r == nil {
-			t.Error("Expected panic when calling GetMetrics without InitMetrics")
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := families[0].GetMetric()[0].GetHistogram()
+	if h.GetSampleCount() != 2 {
+		t.Errorf("Expected both observations counted, got %d", h.GetSampleCount())
+	}
+	exemplar := h.GetBucket()[0].GetExemplar()
+	if exemplar == nil || exemplar.GetLabel()[0].GetValue() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Expected trace exemplar on the first bucket, got %v", exemplar)
+	}
+}
+
+func TestRecordResponseLabels(t *testing.T) {
+	resetMetrics()
+	metrics := InitMetrics()
+
+	metrics.RecordResponse("GET", "/ping", "unnamed", 200, 0.1, SpanContext{})
+	metrics.RecordResponse("BREW", "/ping", "unnamed", 503, 0.2, SpanContext{})
+
+	if got := testutil.ToFloat64(metrics.RequestCounter.WithLabelValues("GET", "/ping", "unnamed", "200")); got != 1 {
+		t.Errorf("Expected one GET /ping 200, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.HTTPErrorCounter.WithLabelValues("other", "/ping", "503")); got != 1 {
+		t.Errorf("Expected unknown method folded into other, got %v", got)
+	}
+	if got := testutil.CollectAndCount(metrics.HTTPErrorCounter); got != 1 {
+		t.Errorf("Expected only the 5xx response counted as error, got %d series", got)
+	}
+	if got := testutil.CollectAndCount(metrics.RequestDuration); got != 2 {
+		t.Errorf("Expected two duration series, got %d", got)
+	}
+}
+
+func TestRecordResponseStatusClasses(t *testing.T) {
+	resetMetrics()
+	metrics := InitMetrics()
+
+	for _, status := range []int{200, 204, 301, 404, 429, 500} {
+		metrics.RecordResponse("GET", "/", "unnamed", status, 0.01, SpanContext{})
+	}
+
+	for class, want := range map[string]float64{"2xx": 2, "3xx": 1, "4xx": 2, "5xx": 1} {
+		if got := testutil.ToFloat64(metrics.StatusClassCounter.WithLabelValues(class)); got != want {
+			t.Errorf("Expected %v %s responses, got %v", want, class, got)
 		}
-	}()
+	}
+	if got := testutil.ToFloat64(metrics.ClientErrorCounter.WithLabelValues("GET", "/", "429")); got != 1 {
+		t.Errorf("Expected the 429 counted as a client error, got %v", got)
+	}
+	if got := testutil.CollectAndCount(metrics.ClientErrorCounter); got != 2 {
+		t.Errorf("Expected two client error series, got %d", got)
+	}
+}
+
+func TestStatusClass(t *testing.T) {
+	for status, want := range map[int]string{101: "1xx", 200: "2xx", 399: "3xx", 404: "4xx", 599: "5xx", 99: "other", 600: "other"} {
+		if got := StatusClass(status); got != want {
+			t.Errorf("StatusClass(%d) = %s, want %s", status, got, want)
+		}
+	}
+}
 
-	GetMetrics()
+func TestSummaryOptionSwitchesDurationMetric(t *testing.T) {
+	resetMetrics()
+	defer resetMetrics()
+	reg := prometheus.NewRegistry()
+	prometheus.DefaultRegisterer = reg
+
+	metrics, err := InitMetricsWithOptions(MetricsOptions{Summaries: map[string]map[float64]float64{
+		"http_request_duration_seconds": {0.99: 0.001},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics.RecordResponse("GET", "/", "unnamed", 200, 0.3, SpanContext{})
+	metrics.APICallDuration.WithLabelValues("upstream", "2xx").Observe(0.1)
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	types := map[string]dto.MetricType{}
+	for _, f := range families {
+		types[f.GetName()] = f.GetType()
+		if f.GetName() == "http_request_duration_seconds" {
+			q := f.GetMetric()[0].GetSummary().GetQuantile()
+			if len(q) != 1 || q[0].GetQuantile() != 0.99 || q[0].GetValue() != 0.3 {
+				t.Errorf("Expected one 0.99 quantile of 0.3, got %v", q)
+			}
+		}
+	}
+	if types["http_request_duration_seconds"] != dto.MetricType_SUMMARY {
+		t.Errorf("Expected a summary, got %v", types["http_request_duration_seconds"])
+	}
+	if types["api_call_duration_seconds"] != dto.MetricType_HISTOGRAM {
+		t.Errorf("Unlisted metrics stay histograms, got %v", types["api_call_duration_seconds"])
+	}
+}
+
+func TestParseSummaryObjectives(t *testing.T) {
+	got, err := ParseSummaryObjectives([]string{"a_seconds", "b_seconds=0.5:0.05|0.99:0.001"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got["a_seconds"]) != 3 || got["b_seconds"][0.99] != 0.001 || len(got["b_seconds"]) != 2 {
+		t.Errorf("Unexpected objectives %v", got)
+	}
+	for _, bad := range []string{"=0.5:0.05", "x=0.5", "x=1:0.1", "x=0.5:abc"} {
+		if _, err := ParseSummaryObjectives([]string{bad}); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+}
+
+func TestNamespaceAndSubsystemPrefixNames(t *testing.T) {
+	resetMetrics()
+	defer resetMetrics()
+	reg := prometheus.NewRegistry()
+	prometheus.DefaultRegisterer = reg
+
+	metrics, err := InitMetricsWithOptions(MetricsOptions{
+		Namespace: "pingsvc",
+		Subsystem: "edge",
+		Summaries: map[string]map[float64]float64{"http_request_duration_seconds": DefaultSummaryObjectives},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics.RecordResponse("GET", "/", "unnamed", 200, 0.1, SpanContext{})
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := map[string]dto.MetricType{}
+	for _, f := range families {
+		names[f.GetName()] = f.GetType()
+	}
+	if _, ok := names["pingsvc_edge_http_requests_total"]; !ok {
+		t.Errorf("Expected prefixed request counter, got %v", names)
+	}
+	if names["pingsvc_edge_http_request_duration_seconds"] != dto.MetricType_SUMMARY {
+		t.Error("Summaries should be matched by the unprefixed name")
+	}
+	if _, ok := names["http_requests_total"]; ok {
+		t.Error("Unprefixed names should not be registered")
+	}
+}
+
+func TestConstLabelsOnEveryMetric(t *testing.T) {
+	resetMetrics()
+	defer resetMetrics()
+	reg := prometheus.NewRegistry()
+	prometheus.DefaultRegisterer = reg
+
+	metrics, err := InitMetricsWithOptions(MetricsOptions{ConstLabels: prometheus.Labels{"service": "ping", "region": "eu"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics.RecordResponse("GET", "/", "unnamed", 200, 0.1, SpanContext{})
+	metrics.ActiveRequestsGauge.Set(1)
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(families) == 0 {
+		t.Fatal("Expected gathered metrics")
+	}
+	for _, f := range families {
+		for _, m := range f.GetMetric() {
+			found := map[string]string{}
+			for _, l := range m.GetLabel() {
+				found[l.GetName()] = l.GetValue()
+			}
+			if found["service"] != "ping" || found["region"] != "eu" {
+				t.Errorf("%s is missing constant labels: %v", f.GetName(), found)
+			}
+		}
+	}
+}
+
+func TestParseConstLabels(t *testing.T) {
+	labels, err := ParseConstLabels([]string{"service=ping", "environment=prod"})
+	if err != nil || labels["service"] != "ping" || labels["environment"] != "prod" {
+		t.Errorf("Unexpected labels %v (err %v)", labels, err)
+	}
+	for _, bad := range []string{"service", "service=", "1st=x", "__name__=x", "le=1", "my-label=x"} {
+		if _, err := ParseConstLabels([]string{bad}); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+}
+
+func TestNewMetricsInstancesCoexist(t *testing.T) {
+	a := NewMetrics(MetricsOptions{})
+	reg := prometheus.NewRegistry()
+	b := NewMetrics(MetricsOptions{Registry: reg})
+
+	a.RecordResponse("GET", "/", "unnamed", 200, 0.1, SpanContext{})
+	a.RecordResponse("GET", "/", "unnamed", 200, 0.1, SpanContext{})
+	b.RecordResponse("GET", "/", "unnamed", 200, 0.1, SpanContext{})
+
+	if got := testutil.ToFloat64(a.RequestCounter.WithLabelValues("GET", "/", "unnamed", "200")); got != 2 {
+		t.Errorf("Expected 2 requests on a, got %v", got)
+	}
+	if got := testutil.ToFloat64(b.RequestCounter.WithLabelValues("GET", "/", "unnamed", "200")); got != 1 {
+		t.Errorf("Expected 1 request on b, got %v", got)
+	}
+	if b.Gatherer != reg || b.Registerer != reg {
+		t.Error("Instance should be bound to the given registry")
+	}
+	if n, err := testutil.GatherAndCount(a.Gatherer, "http_requests_total"); err != nil || n != 1 {
+		t.Errorf("Expected a's own registry to hold its series, got %d (err %v)", n, err)
+	}
+}
+
+func TestSetMetricsReplacesDefault(t *testing.T) {
+	saved := metricsInstance.Load()
+	defer SetMetrics(saved)
+
+	m := NewMetrics(MetricsOptions{})
+	SetMetrics(m)
+	if GetMetrics() != m || InitMetrics() != m {
+		t.Error("GetMetrics and InitMetrics should return the instance set")
+	}
+}
+
+func TestRuntimeCollectors(t *testing.T) {
+	m := NewMetrics(MetricsOptions{
+		Namespace:   "pingsvc",
+		ConstLabels: prometheus.Labels{"service": "ping"},
+	})
+	families, err := m.Gatherer.Gather()
+	if err != nil {
+		t.Fatalf("Gather failed: %v", err)
+	}
+	names := make(map[string]*dto.MetricFamily)
+	for _, f := range families {
+		names[f.GetName()] = f
+	}
+	for _, name := range []string{"go_goroutines", "go_gc_duration_seconds", "go_sched_latencies_seconds"} {
+		if _, ok := names[name]; !ok {
+			t.Errorf("Expected %s with its standard name", name)
+		}
+	}
+	if f := names["go_goroutines"]; f != nil && f.GetMetric()[0].GetLabel()[0].GetValue() != "ping" {
+		t.Error("Expected const labels on runtime metrics")
+	}
+
+	m = NewMetrics(MetricsOptions{DisableRuntimeCollectors: true})
+	if n, err := testutil.GatherAndCount(m.Gatherer, "go_goroutines"); err != nil || n != 0 {
+		t.Errorf("Expected no runtime metrics when disabled, got %d (%v)", n, err)
+	}
+}
+
+func TestRuntimeCollectorsReplaceDefaults(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	newMetrics(reg, reg, MetricsOptions{})
+	if n, err := testutil.GatherAndCount(reg, "go_goroutines"); err != nil || n != 1 {
+		t.Errorf("Expected the default collectors replaced, got %d (%v)", n, err)
+	}
+}
+
+func TestRecordRuntimeLimits(t *testing.T) {
+	m := NewMetrics(MetricsOptions{})
+	m.RecordRuntimeLimits(2, 1.5, 512<<20, 64<<20)
+	if v := testutil.ToFloat64(m.RuntimeMaxProcs); v != 2 {
+		t.Errorf("Expected GOMAXPROCS 2, got %v", v)
+	}
+	if v := testutil.ToFloat64(m.RuntimeCPUQuota); v != 1.5 {
+		t.Errorf("Expected a quota of 1.5 cores, got %v", v)
+	}
+	if v := testutil.ToFloat64(m.RuntimeMemoryLimit); v != 512<<20 {
+		t.Errorf("Expected a memory limit of 512MiB, got %v", v)
+	}
+	if v := testutil.ToFloat64(m.RuntimeMemoryBallast); v != 64<<20 {
+		t.Errorf("Expected a ballast of 64MiB, got %v", v)
+	}
+}
+
+func BenchmarkRecordResponse(b *testing.B) {
+	m := NewMetrics(MetricsOptions{})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.RecordResponse("GET", "/", "pong", 200, 0.0042, SpanContext{})
+	}
+}
+
+func BenchmarkRecordRequest(b *testing.B) {
+	m := NewMetrics(MetricsOptions{})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.RecordRequest()()
+	}
+}
+
+func BenchmarkRecordAPICall(b *testing.B) {
+	m := NewMetrics(MetricsOptions{})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.RecordAPICall("upstream:8080", 200, 0.012, nil)
+	}
 }
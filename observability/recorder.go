@@ -0,0 +1,724 @@
+package observability
+
+import (
+	"strings"
+	"sync"
+)
+
+// MetricsRecorder receives the measurements of the middleware, handlers,
+// file processing, jobs and health checks. *Metrics records them in
+// Prometheus; NoopRecorder discards them; MemoryRecorder keeps them for
+// tests to assert on directly. Every component takes one in its config's
+// Metrics field and falls back to GetMetrics() when it is nil.
+//
+// The outbound clients, tracing, metrics export and the listeners record
+// transport-level series that only make sense in Prometheus and keep
+// taking a *Metrics.
+type MetricsRecorder interface {
+	// RecordRequest marks a request active and returns the function that
+	// marks it finished.
+	RecordRequest() func()
+	// RecordResponse counts a finished request and its duration in seconds
+	// under the name of the handler that served it. sc is attached as an
+	// exemplar when sampled.
+	RecordResponse(method, route, handler string, status int, duration float64, sc SpanContext)
+	ObserveTimeToFirstByte(method, route string, seconds float64)
+	ObserveRequestSize(method, route string, size float64)
+	ObserveResponseSize(method, route string, size float64)
+	// IncSlowRequests counts a request over the slow-request threshold.
+	IncSlowRequests()
+	// IncSuppressedLogs counts a request whose completion line was not
+	// logged in tail mode.
+	IncSuppressedLogs()
+
+	// IncPanics counts a panic recovered from a handler.
+	IncPanics()
+	// RecordRateLimitDecision counts a request the rate limiter "allowed"
+	// or "limited".
+	RecordRateLimitDecision(decision string)
+	// IncRateLimitFallbacks counts a decision left to the fallback limiter
+	// because the shared store failed.
+	IncRateLimitFallbacks()
+	// IncAuthFailures counts a request refused by the auth scheme
+	// ("basic", "bearer", "oidc") for reason.
+	IncAuthFailures(scheme, reason string)
+	// IncClientIdentityRequests counts a request by the identity of its
+	// client certificate.
+	IncClientIdentityRequests(identity string)
+	// ObserveCompression observes a compressed response body of
+	// compressed bytes, uncompressed before.
+	ObserveCompression(encoding string, uncompressed, compressed int64)
+	// IncRequestsDecompressed counts a request body decompressed from
+	// encoding.
+	IncRequestsDecompressed(encoding string)
+	// IncRequestsShed counts a request of priority shed under load.
+	IncRequestsShed(priority string)
+	// AddQueuedRequests moves the number of requests waiting for a
+	// concurrency slot by delta.
+	AddQueuedRequests(delta float64)
+	// ObserveQueueWait observes how long a request waited for a slot.
+	ObserveQueueWait(seconds float64)
+	// IncConcurrencyRejected counts a request that got no slot in time.
+	IncConcurrencyRejected()
+	// RecordMirror counts a mirrored request by result: "success",
+	// "error", "skipped" or "dropped".
+	RecordMirror(result string)
+	// ObserveMirrorDuration observes how long a mirrored request took.
+	ObserveMirrorDuration(seconds float64)
+	// RecordCacheLookup counts a response cache "hit", "miss" or "bypass".
+	RecordCacheLookup(result string)
+	// SetCacheEntries sets the number of responses cached.
+	SetCacheEntries(n int)
+	// ObserveProxy observes a proxied request: the time the upstream took,
+	// by its status class, and the time spent around it.
+	ObserveProxy(class string, upstream, overhead float64)
+
+	// RecordFileProcess records file processing with size and optional
+	// error.
+	RecordFileProcess(duration float64, bytes float64, err error)
+	// RecordFileConvert records the bytes a conversion read in format from
+	// and wrote in format to.
+	RecordFileConvert(from, to string, in, out float64)
+	// RecordFileCompressed records compressed bytes a file process read
+	// (in) or wrote (out).
+	RecordFileCompressed(direction, compression string, bytes float64)
+	// RecordFileIngest records a file ingested from the watched directory.
+	RecordFileIngest(result string, validRows, invalidRows int64)
+	// RecordFileUpload records an upload of a processed file.
+	RecordFileUpload(duration float64, bytes int64, err error)
+	// SetFileRowsPerSecond sets the throughput of the file being processed.
+	SetFileRowsPerSecond(rate float64)
+	// AddFileProcessMemory moves the bytes held by rows read but not yet
+	// checked by delta.
+	AddFileProcessMemory(delta float64)
+
+	// RecordBackgroundJob records a run of the background job named job.
+	RecordBackgroundJob(job string, duration float64, err error)
+	// AddQueuedJobs moves the number of jobs waiting for a worker by delta.
+	AddQueuedJobs(delta float64)
+	// ObserveJobQueueWait observes how long a job waited for a worker.
+	ObserveJobQueueWait(seconds float64)
+	// AddBusyWorkers moves the number of workers running a job by delta.
+	AddBusyWorkers(delta float64)
+	// SetStuckJobs sets the number of running jobs without a heartbeat.
+	SetStuckJobs(n int)
+	// IncJobRetries counts a queued job of jobType scheduled for a retry.
+	IncJobRetries(jobType string)
+	// IncJobsDeadLettered counts a queued job of jobType given up on.
+	IncJobsDeadLettered(jobType string)
+	// ObserveJobLockAcquire observes how long taking a job's lock took.
+	ObserveJobLockAcquire(seconds float64)
+	// RecordJobLock counts a lock of job by result: "acquired", "held",
+	// "error" or "lost".
+	RecordJobLock(job, result string)
+
+	// RecordHealthCheck records a run of the named health check.
+	RecordHealthCheck(name string, duration float64, pass bool)
+	// IncHealthCheckTransitions counts the named check changing to result.
+	IncHealthCheckTransitions(name, to string)
+}
+
+// RecorderOrDefault returns r, or GetMetrics() when r is nil or a nil
+// *Metrics, so a component's Metrics field can be left unset.
+func RecorderOrDefault(r MetricsRecorder) MetricsRecorder {
+	if m, ok := r.(*Metrics); r == nil || (ok && m == nil) {
+		return GetMetrics()
+	}
+	return r
+}
+
+// ObserveTimeToFirstByte observes how long a response took to start.
+func (m *Metrics) ObserveTimeToFirstByte(method, route string, seconds float64) {
+	m.TimeToFirstByte.WithLabelValues(m.LimitLabels("http_response_time_to_first_byte_seconds", MethodLabel(method), route)...).Observe(seconds)
+}
+
+// IncSlowRequests implements MetricsRecorder.
+func (m *Metrics) IncSlowRequests() {
+	m.SlowRequestCounter.Inc()
+}
+
+// IncSuppressedLogs implements MetricsRecorder.
+func (m *Metrics) IncSuppressedLogs() {
+	m.RequestLogsSuppressedCounter.Inc()
+}
+
+// IncPanics implements MetricsRecorder.
+func (m *Metrics) IncPanics() {
+	m.PanicCounter.Inc()
+}
+
+// RecordRateLimitDecision implements MetricsRecorder.
+func (m *Metrics) RecordRateLimitDecision(decision string) {
+	m.RateLimitDecisionCounter.WithLabelValues(decision).Inc()
+}
+
+// IncRateLimitFallbacks implements MetricsRecorder.
+func (m *Metrics) IncRateLimitFallbacks() {
+	m.RateLimitFallbackCounter.Inc()
+}
+
+// IncAuthFailures implements MetricsRecorder.
+func (m *Metrics) IncAuthFailures(scheme, reason string) {
+	m.AuthFailureCounter.WithLabelValues(scheme, reason).Inc()
+}
+
+// IncClientIdentityRequests implements MetricsRecorder, folding
+// identities past the cardinality limit.
+func (m *Metrics) IncClientIdentityRequests(identity string) {
+	m.ClientIdentityRequestsCounter.WithLabelValues(m.LimitLabels("http_requests_by_client_identity_total", identity)...).Inc()
+}
+
+// ObserveCompression implements MetricsRecorder. Empty bodies are not
+// observed.
+func (m *Metrics) ObserveCompression(encoding string, uncompressed, compressed int64) {
+	if compressed <= 0 {
+		return
+	}
+	m.CompressionRatio.WithLabelValues(encoding).Observe(float64(uncompressed) / float64(compressed))
+	if saved := uncompressed - compressed; saved > 0 {
+		m.CompressionSavedBytes.WithLabelValues(encoding).Add(float64(saved))
+	}
+}
+
+// IncRequestsDecompressed implements MetricsRecorder.
+func (m *Metrics) IncRequestsDecompressed(encoding string) {
+	m.RequestDecompressedCounter.WithLabelValues(encoding).Inc()
+}
+
+// IncRequestsShed implements MetricsRecorder.
+func (m *Metrics) IncRequestsShed(priority string) {
+	m.RequestsShedCounter.WithLabelValues(priority).Inc()
+}
+
+// AddQueuedRequests implements MetricsRecorder.
+func (m *Metrics) AddQueuedRequests(delta float64) {
+	m.ConcurrencyQueueGauge.Add(delta)
+}
+
+// ObserveQueueWait implements MetricsRecorder.
+func (m *Metrics) ObserveQueueWait(seconds float64) {
+	m.QueueWaitDuration.Observe(seconds)
+}
+
+// IncConcurrencyRejected implements MetricsRecorder.
+func (m *Metrics) IncConcurrencyRejected() {
+	m.ConcurrencyRejectedCounter.Inc()
+}
+
+// RecordMirror implements MetricsRecorder.
+func (m *Metrics) RecordMirror(result string) {
+	m.MirrorRequestsCounter.WithLabelValues(result).Inc()
+}
+
+// ObserveMirrorDuration implements MetricsRecorder.
+func (m *Metrics) ObserveMirrorDuration(seconds float64) {
+	m.MirrorDuration.Observe(seconds)
+}
+
+// RecordCacheLookup implements MetricsRecorder.
+func (m *Metrics) RecordCacheLookup(result string) {
+	m.ResponseCacheCounter.WithLabelValues(result).Inc()
+}
+
+// SetCacheEntries implements MetricsRecorder.
+func (m *Metrics) SetCacheEntries(n int) {
+	m.ResponseCacheEntries.Set(float64(n))
+}
+
+// ObserveProxy implements MetricsRecorder.
+func (m *Metrics) ObserveProxy(class string, upstream, overhead float64) {
+	m.ProxyUpstreamDuration.WithLabelValues(class).Observe(upstream)
+	m.ProxyOverhead.Observe(overhead)
+}
+
+// SetFileRowsPerSecond implements MetricsRecorder.
+func (m *Metrics) SetFileRowsPerSecond(rate float64) {
+	m.FileProcessRowsPerSecond.Set(rate)
+}
+
+// AddFileProcessMemory implements MetricsRecorder.
+func (m *Metrics) AddFileProcessMemory(delta float64) {
+	m.FileProcessMemoryBytes.Add(delta)
+}
+
+// AddQueuedJobs implements MetricsRecorder.
+func (m *Metrics) AddQueuedJobs(delta float64) {
+	m.JobQueueDepth.Add(delta)
+}
+
+// ObserveJobQueueWait implements MetricsRecorder.
+func (m *Metrics) ObserveJobQueueWait(seconds float64) {
+	m.JobQueueWait.Observe(seconds)
+}
+
+// AddBusyWorkers implements MetricsRecorder.
+func (m *Metrics) AddBusyWorkers(delta float64) {
+	m.JobWorkersBusy.Add(delta)
+}
+
+// SetStuckJobs implements MetricsRecorder.
+func (m *Metrics) SetStuckJobs(n int) {
+	m.JobsStuck.Set(float64(n))
+}
+
+// IncJobRetries implements MetricsRecorder.
+func (m *Metrics) IncJobRetries(jobType string) {
+	m.JobRetries.WithLabelValues(jobType).Inc()
+}
+
+// IncJobsDeadLettered implements MetricsRecorder.
+func (m *Metrics) IncJobsDeadLettered(jobType string) {
+	m.JobDeadLettered.WithLabelValues(jobType).Inc()
+}
+
+// ObserveJobLockAcquire implements MetricsRecorder.
+func (m *Metrics) ObserveJobLockAcquire(seconds float64) {
+	m.JobLockDuration.Observe(seconds)
+}
+
+// RecordJobLock implements MetricsRecorder.
+func (m *Metrics) RecordJobLock(job, result string) {
+	m.JobLockAcquisitions.WithLabelValues(job, result).Inc()
+}
+
+// RecordHealthCheck implements MetricsRecorder, setting the check's status
+// gauge to 1 when it passed and 0 otherwise.
+func (m *Metrics) RecordHealthCheck(name string, duration float64, pass bool) {
+	m.HealthCheckDuration.WithLabelValues(name).Observe(duration)
+	m.HealthCheckStatus.WithLabelValues(name).Set(boolValue(pass))
+}
+
+// IncHealthCheckTransitions implements MetricsRecorder.
+func (m *Metrics) IncHealthCheckTransitions(name, to string) {
+	m.HealthCheckTransitions.WithLabelValues(name, to).Inc()
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// NoopRecorder is a MetricsRecorder that records nothing.
+type NoopRecorder struct{}
+
+func (NoopRecorder) RecordRequest() func()                                            { return func() {} }
+func (NoopRecorder) RecordResponse(string, string, string, int, float64, SpanContext) {}
+func (NoopRecorder) ObserveTimeToFirstByte(string, string, float64)                   {}
+func (NoopRecorder) ObserveRequestSize(string, string, float64)                       {}
+func (NoopRecorder) ObserveResponseSize(string, string, float64)                      {}
+func (NoopRecorder) IncSlowRequests()                                                 {}
+func (NoopRecorder) IncSuppressedLogs()                                               {}
+func (NoopRecorder) IncPanics()                                                       {}
+func (NoopRecorder) RecordRateLimitDecision(string)                                   {}
+func (NoopRecorder) IncRateLimitFallbacks()                                           {}
+func (NoopRecorder) IncAuthFailures(string, string)                                   {}
+func (NoopRecorder) IncClientIdentityRequests(string)                                 {}
+func (NoopRecorder) ObserveCompression(string, int64, int64)                          {}
+func (NoopRecorder) IncRequestsDecompressed(string)                                   {}
+func (NoopRecorder) IncRequestsShed(string)                                           {}
+func (NoopRecorder) AddQueuedRequests(float64)                                        {}
+func (NoopRecorder) ObserveQueueWait(float64)                                         {}
+func (NoopRecorder) IncConcurrencyRejected()                                          {}
+func (NoopRecorder) RecordMirror(string)                                              {}
+func (NoopRecorder) ObserveMirrorDuration(float64)                                    {}
+func (NoopRecorder) RecordCacheLookup(string)                                         {}
+func (NoopRecorder) SetCacheEntries(int)                                              {}
+func (NoopRecorder) ObserveProxy(string, float64, float64)                            {}
+func (NoopRecorder) RecordFileProcess(float64, float64, error)                        {}
+func (NoopRecorder) RecordFileConvert(string, string, float64, float64)               {}
+func (NoopRecorder) RecordFileCompressed(string, string, float64)                     {}
+func (NoopRecorder) RecordFileIngest(string, int64, int64)                            {}
+func (NoopRecorder) RecordFileUpload(float64, int64, error)                           {}
+func (NoopRecorder) SetFileRowsPerSecond(float64)                                     {}
+func (NoopRecorder) AddFileProcessMemory(float64)                                     {}
+func (NoopRecorder) RecordBackgroundJob(string, float64, error)                       {}
+func (NoopRecorder) AddQueuedJobs(float64)                                            {}
+func (NoopRecorder) ObserveJobQueueWait(float64)                                      {}
+func (NoopRecorder) AddBusyWorkers(float64)                                           {}
+func (NoopRecorder) SetStuckJobs(int)                                                 {}
+func (NoopRecorder) IncJobRetries(string)                                             {}
+func (NoopRecorder) IncJobsDeadLettered(string)                                       {}
+func (NoopRecorder) ObserveJobLockAcquire(float64)                                    {}
+func (NoopRecorder) RecordJobLock(string, string)                                     {}
+func (NoopRecorder) RecordHealthCheck(string, float64, bool)                          {}
+func (NoopRecorder) IncHealthCheckTransitions(string, string)                         {}
+
+// RecordedResponse is one response seen by a MemoryRecorder.
+type RecordedResponse struct {
+	Method   string
+	Route    string
+	Handler  string
+	Status   int
+	Duration float64
+	// TraceID is set for sampled spans, as for exemplars
+	TraceID string
+}
+
+// MemoryRecorder is a MetricsRecorder that keeps everything in memory for
+// tests. It is safe for concurrent use; read it through its methods.
+//
+// Besides the request measurements, which have accessors of their own,
+// it keeps each measurement under the name and label values of the
+// Prometheus series *Metrics records it in, without namespace: read
+// counters and gauges with Value and histograms with Observations, e.g.
+// Value("http_auth_failures_total", "bearer", "missing").
+type MemoryRecorder struct {
+	mu             sync.Mutex
+	active         int
+	responses      []RecordedResponse
+	ttfb           []float64
+	requestSizes   []float64
+	responseSizes  []float64
+	slowRequests   int
+	suppressedLogs int
+	values         map[string]float64
+	observations   map[string][]float64
+}
+
+// NewMemoryRecorder returns an empty MemoryRecorder.
+func NewMemoryRecorder() *MemoryRecorder {
+	return &MemoryRecorder{values: make(map[string]float64), observations: make(map[string][]float64)}
+}
+
+// seriesKey identifies a series of metric in the maps of a MemoryRecorder.
+func seriesKey(metric string, labels []string) string {
+	return metric + "{" + strings.Join(labels, ",") + "}"
+}
+
+// add moves the counter or gauge of metric by delta.
+func (r *MemoryRecorder) add(metric string, delta float64, labels ...string) {
+	r.mu.Lock()
+	r.values[seriesKey(metric, labels)] += delta
+	r.mu.Unlock()
+}
+
+// set sets the gauge of metric.
+func (r *MemoryRecorder) set(metric string, v float64, labels ...string) {
+	r.mu.Lock()
+	r.values[seriesKey(metric, labels)] = v
+	r.mu.Unlock()
+}
+
+// observe appends v to the histogram of metric.
+func (r *MemoryRecorder) observe(metric string, v float64, labels ...string) {
+	key := seriesKey(metric, labels)
+	r.mu.Lock()
+	r.observations[key] = append(r.observations[key], v)
+	r.mu.Unlock()
+}
+
+// RecordRequest implements MetricsRecorder.
+func (r *MemoryRecorder) RecordRequest() func() {
+	r.mu.Lock()
+	r.active++
+	r.mu.Unlock()
+	return func() {
+		r.mu.Lock()
+		r.active--
+		r.mu.Unlock()
+	}
+}
+
+// RecordResponse implements MetricsRecorder.
+func (r *MemoryRecorder) RecordResponse(method, route, handler string, status int, duration float64, sc SpanContext) {
+	resp := RecordedResponse{Method: method, Route: route, Handler: handler, Status: status, Duration: duration}
+	if sc.IsValid() && sc.Sampled {
+		resp.TraceID = sc.TraceID.String()
+	}
+	r.mu.Lock()
+	r.responses = append(r.responses, resp)
+	r.mu.Unlock()
+}
+
+// ObserveTimeToFirstByte implements MetricsRecorder.
+func (r *MemoryRecorder) ObserveTimeToFirstByte(method, route string, seconds float64) {
+	r.mu.Lock()
+	r.ttfb = append(r.ttfb, seconds)
+	r.mu.Unlock()
+}
+
+// ObserveRequestSize implements MetricsRecorder.
+func (r *MemoryRecorder) ObserveRequestSize(method, route string, size float64) {
+	r.mu.Lock()
+	r.requestSizes = append(r.requestSizes, size)
+	r.mu.Unlock()
+}
+
+// ObserveResponseSize implements MetricsRecorder.
+func (r *MemoryRecorder) ObserveResponseSize(method, route string, size float64) {
+	r.mu.Lock()
+	r.responseSizes = append(r.responseSizes, size)
+	r.mu.Unlock()
+}
+
+// IncSlowRequests implements MetricsRecorder.
+func (r *MemoryRecorder) IncSlowRequests() {
+	r.mu.Lock()
+	r.slowRequests++
+	r.mu.Unlock()
+}
+
+// IncSuppressedLogs implements MetricsRecorder.
+func (r *MemoryRecorder) IncSuppressedLogs() {
+	r.mu.Lock()
+	r.suppressedLogs++
+	r.mu.Unlock()
+}
+
+// IncPanics implements MetricsRecorder.
+func (r *MemoryRecorder) IncPanics() {
+	r.add("http_panics_total", 1)
+}
+
+// RecordRateLimitDecision implements MetricsRecorder.
+func (r *MemoryRecorder) RecordRateLimitDecision(decision string) {
+	r.add("http_rate_limit_decisions_total", 1, decision)
+}
+
+// IncRateLimitFallbacks implements MetricsRecorder.
+func (r *MemoryRecorder) IncRateLimitFallbacks() {
+	r.add("http_rate_limit_fallback_total", 1)
+}
+
+// IncAuthFailures implements MetricsRecorder.
+func (r *MemoryRecorder) IncAuthFailures(scheme, reason string) {
+	r.add("http_auth_failures_total", 1, scheme, reason)
+}
+
+// IncClientIdentityRequests implements MetricsRecorder.
+func (r *MemoryRecorder) IncClientIdentityRequests(identity string) {
+	r.add("http_requests_by_client_identity_total", 1, identity)
+}
+
+// ObserveCompression implements MetricsRecorder.
+func (r *MemoryRecorder) ObserveCompression(encoding string, uncompressed, compressed int64) {
+	if compressed <= 0 {
+		return
+	}
+	r.observe("http_response_compression_ratio", float64(uncompressed)/float64(compressed), encoding)
+	if saved := uncompressed - compressed; saved > 0 {
+		r.add("http_response_compression_saved_bytes_total", float64(saved), encoding)
+	}
+}
+
+// IncRequestsDecompressed implements MetricsRecorder.
+func (r *MemoryRecorder) IncRequestsDecompressed(encoding string) {
+	r.add("http_request_bodies_decompressed_total", 1, encoding)
+}
+
+// IncRequestsShed implements MetricsRecorder.
+func (r *MemoryRecorder) IncRequestsShed(priority string) {
+	r.add("http_requests_shed_total", 1, priority)
+}
+
+// AddQueuedRequests implements MetricsRecorder.
+func (r *MemoryRecorder) AddQueuedRequests(delta float64) {
+	r.add("http_concurrency_queue_depth", delta)
+}
+
+// ObserveQueueWait implements MetricsRecorder.
+func (r *MemoryRecorder) ObserveQueueWait(seconds float64) {
+	r.observe("http_queue_wait_seconds", seconds)
+}
+
+// IncConcurrencyRejected implements MetricsRecorder.
+func (r *MemoryRecorder) IncConcurrencyRejected() {
+	r.add("http_concurrency_rejected_total", 1)
+}
+
+// RecordMirror implements MetricsRecorder.
+func (r *MemoryRecorder) RecordMirror(result string) {
+	r.add("http_mirror_requests_total", 1, result)
+}
+
+// ObserveMirrorDuration implements MetricsRecorder.
+func (r *MemoryRecorder) ObserveMirrorDuration(seconds float64) {
+	r.observe("http_mirror_request_duration_seconds", seconds)
+}
+
+// RecordCacheLookup implements MetricsRecorder.
+func (r *MemoryRecorder) RecordCacheLookup(result string) {
+	r.add("http_response_cache_requests_total", 1, result)
+}
+
+// SetCacheEntries implements MetricsRecorder.
+func (r *MemoryRecorder) SetCacheEntries(n int) {
+	r.set("http_response_cache_entries", float64(n))
+}
+
+// ObserveProxy implements MetricsRecorder.
+func (r *MemoryRecorder) ObserveProxy(class string, upstream, overhead float64) {
+	r.observe("proxy_upstream_duration_seconds", upstream, class)
+	r.observe("proxy_overhead_seconds", overhead)
+}
+
+// RecordFileProcess implements MetricsRecorder.
+func (r *MemoryRecorder) RecordFileProcess(duration float64, bytes float64, err error) {
+	r.add("file_processes_total", 1)
+	r.observe("file_process_duration_seconds", duration)
+	r.add("file_process_bytes_total", bytes)
+	if err != nil {
+		r.add("file_process_errors_total", 1)
+	}
+}
+
+// RecordFileConvert implements MetricsRecorder.
+func (r *MemoryRecorder) RecordFileConvert(from, to string, in, out float64) {
+	r.add("file_convert_bytes_total", in, "in", from)
+	r.add("file_convert_bytes_total", out, "out", to)
+}
+
+// RecordFileCompressed implements MetricsRecorder.
+func (r *MemoryRecorder) RecordFileCompressed(direction, compression string, bytes float64) {
+	r.add("file_compressed_bytes_total", bytes, direction, compression)
+}
+
+// RecordFileIngest implements MetricsRecorder.
+func (r *MemoryRecorder) RecordFileIngest(result string, validRows, invalidRows int64) {
+	r.add("file_ingest_files_total", 1, result)
+	r.add("file_ingest_rows_total", float64(validRows), "valid")
+	r.add("file_ingest_rows_total", float64(invalidRows), "invalid")
+}
+
+// RecordFileUpload implements MetricsRecorder.
+func (r *MemoryRecorder) RecordFileUpload(duration float64, bytes int64, err error) {
+	r.add("file_uploads_total", 1, uploadResult(err))
+	r.add("file_upload_bytes_total", float64(bytes))
+	r.observe("file_upload_duration_seconds", duration)
+}
+
+// SetFileRowsPerSecond implements MetricsRecorder.
+func (r *MemoryRecorder) SetFileRowsPerSecond(rate float64) {
+	r.set("file_process_rows_per_second", rate)
+}
+
+// AddFileProcessMemory implements MetricsRecorder.
+func (r *MemoryRecorder) AddFileProcessMemory(delta float64) {
+	r.add("file_process_memory_bytes", delta)
+}
+
+// RecordBackgroundJob implements MetricsRecorder.
+func (r *MemoryRecorder) RecordBackgroundJob(job string, duration float64, err error) {
+	outcome := jobOutcome(err)
+	r.add("background_jobs_total", 1, job, outcome)
+	r.observe("background_job_duration_seconds", duration, job, outcome)
+}
+
+// AddQueuedJobs implements MetricsRecorder.
+func (r *MemoryRecorder) AddQueuedJobs(delta float64) {
+	r.add("background_job_queue_depth", delta)
+}
+
+// ObserveJobQueueWait implements MetricsRecorder.
+func (r *MemoryRecorder) ObserveJobQueueWait(seconds float64) {
+	r.observe("background_job_queue_wait_seconds", seconds)
+}
+
+// AddBusyWorkers implements MetricsRecorder.
+func (r *MemoryRecorder) AddBusyWorkers(delta float64) {
+	r.add("background_job_workers_busy", delta)
+}
+
+// SetStuckJobs implements MetricsRecorder.
+func (r *MemoryRecorder) SetStuckJobs(n int) {
+	r.set("background_jobs_stuck", float64(n))
+}
+
+// IncJobRetries implements MetricsRecorder.
+func (r *MemoryRecorder) IncJobRetries(jobType string) {
+	r.add("background_job_retries_total", 1, jobType)
+}
+
+// IncJobsDeadLettered implements MetricsRecorder.
+func (r *MemoryRecorder) IncJobsDeadLettered(jobType string) {
+	r.add("background_job_dead_lettered_total", 1, jobType)
+}
+
+// ObserveJobLockAcquire implements MetricsRecorder.
+func (r *MemoryRecorder) ObserveJobLockAcquire(seconds float64) {
+	r.observe("background_job_lock_acquire_seconds", seconds)
+}
+
+// RecordJobLock implements MetricsRecorder.
+func (r *MemoryRecorder) RecordJobLock(job, result string) {
+	r.add("background_job_lock_acquisitions_total", 1, job, result)
+}
+
+// RecordHealthCheck implements MetricsRecorder.
+func (r *MemoryRecorder) RecordHealthCheck(name string, duration float64, pass bool) {
+	r.observe("health_check_duration_seconds", duration, name)
+	r.set("health_check_status", boolValue(pass), name)
+}
+
+// IncHealthCheckTransitions implements MetricsRecorder.
+func (r *MemoryRecorder) IncHealthCheckTransitions(name, to string) {
+	r.add("health_check_transitions_total", 1, name, to)
+}
+
+// Active returns the number of requests in flight.
+func (r *MemoryRecorder) Active() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.active
+}
+
+// Responses returns the recorded responses in order.
+func (r *MemoryRecorder) Responses() []RecordedResponse {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]RecordedResponse(nil), r.responses...)
+}
+
+// TimesToFirstByte returns the observed times to first byte in seconds.
+func (r *MemoryRecorder) TimesToFirstByte() []float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]float64(nil), r.ttfb...)
+}
+
+// RequestSizes returns the observed request body sizes; requests without a
+// known length are not observed.
+func (r *MemoryRecorder) RequestSizes() []float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]float64(nil), r.requestSizes...)
+}
+
+// ResponseSizes returns the observed response body sizes.
+func (r *MemoryRecorder) ResponseSizes() []float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]float64(nil), r.responseSizes...)
+}
+
+// SlowRequests returns how many requests were counted as slow.
+func (r *MemoryRecorder) SlowRequests() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.slowRequests
+}
+
+// SuppressedLogs returns how many completion lines were suppressed.
+func (r *MemoryRecorder) SuppressedLogs() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.suppressedLogs
+}
+
+// Value returns the counter or gauge of metric with the label values
+// labels, in the order *Metrics declares them; zero if never recorded.
+func (r *MemoryRecorder) Value(metric string, labels ...string) float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.values[seriesKey(metric, labels)]
+}
+
+// Observations returns the values observed in the histogram of metric
+// with the label values labels, in order.
+func (r *MemoryRecorder) Observations(metric string, labels ...string) []float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]float64(nil), r.observations[seriesKey(metric, labels)]...)
+}
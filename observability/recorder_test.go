@@ -0,0 +1,106 @@
+package observability
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// Compile-time checks that every implementation satisfies the interface
+var (
+	_ MetricsRecorder = (*Metrics)(nil)
+	_ MetricsRecorder = NoopRecorder{}
+	_ MetricsRecorder = (*MemoryRecorder)(nil)
+)
+
+func TestMemoryRecorder(t *testing.T) {
+	r := NewMemoryRecorder()
+	done := r.RecordRequest()
+	if r.Active() != 1 {
+		t.Errorf("Expected 1 active request, got %d", r.Active())
+	}
+
+	sc, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.RecordResponse("GET", "/ping", "unnamed", 200, 0.25, sc)
+	r.ObserveTimeToFirstByte("GET", "/ping", 0.1)
+	r.ObserveRequestSize("GET", "/ping", 10)
+	r.ObserveResponseSize("GET", "/ping", 20)
+	r.IncSlowRequests()
+	r.IncSuppressedLogs()
+	done()
+
+	want := []RecordedResponse{{Method: "GET", Route: "/ping", Handler: "unnamed", Status: 200, Duration: 0.25, TraceID: "4bf92f3577b34da6a3ce929d0e0e4736"}}
+	if got := r.Responses(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+	if r.Active() != 0 || r.SlowRequests() != 1 || r.SuppressedLogs() != 1 {
+		t.Errorf("Unexpected counts: active %d, slow %d, suppressed %d", r.Active(), r.SlowRequests(), r.SuppressedLogs())
+	}
+	if !reflect.DeepEqual(r.TimesToFirstByte(), []float64{0.1}) || !reflect.DeepEqual(r.RequestSizes(), []float64{10}) || !reflect.DeepEqual(r.ResponseSizes(), []float64{20}) {
+		t.Error("Expected observations to be kept")
+	}
+}
+
+func TestMetricsRecorderMethods(t *testing.T) {
+	m := NewMetrics(MetricsOptions{})
+	m.IncSlowRequests()
+	m.IncSuppressedLogs()
+	m.ObserveTimeToFirstByte("GET", "/", 0.1)
+	m.IncPanics()
+	m.RecordJobLock("sweep", "held")
+	m.AddBusyWorkers(1)
+
+	if testutil.ToFloat64(m.SlowRequestCounter) != 1 || testutil.ToFloat64(m.RequestLogsSuppressedCounter) != 1 {
+		t.Error("Expected counters incremented")
+	}
+	if testutil.ToFloat64(m.PanicCounter) != 1 || testutil.ToFloat64(m.JobLockAcquisitions.WithLabelValues("sweep", "held")) != 1 || testutil.ToFloat64(m.JobWorkersBusy) != 1 {
+		t.Error("Expected the component series recorded")
+	}
+	if n := testutil.CollectAndCount(m.TimeToFirstByte); n != 1 {
+		t.Errorf("Expected one time-to-first-byte series, got %d", n)
+	}
+}
+
+func TestMemoryRecorderKeepsSeries(t *testing.T) {
+	r := NewMemoryRecorder()
+	r.IncAuthFailures("bearer", "missing")
+	r.IncAuthFailures("bearer", "missing")
+	r.AddQueuedJobs(2)
+	r.AddQueuedJobs(-1)
+	r.SetCacheEntries(3)
+	r.ObserveProxy("2xx", 0.5, 0.01)
+	r.RecordBackgroundJob("sweep", 1, errors.New("boom"))
+	r.RecordHealthCheck("db", 0.2, true)
+
+	for _, tt := range []struct {
+		metric string
+		labels []string
+		want   float64
+	}{
+		{"http_auth_failures_total", []string{"bearer", "missing"}, 2},
+		{"http_auth_failures_total", []string{"basic", "missing"}, 0},
+		{"background_job_queue_depth", nil, 1},
+		{"http_response_cache_entries", nil, 3},
+		{"background_jobs_total", []string{"sweep", JobOutcomeError}, 1},
+		{"health_check_status", []string{"db"}, 1},
+	} {
+		if got := r.Value(tt.metric, tt.labels...); got != tt.want {
+			t.Errorf("Expected %s%v = %v, got %v", tt.metric, tt.labels, tt.want, got)
+		}
+	}
+	if got := r.Observations("proxy_upstream_duration_seconds", "2xx"); !reflect.DeepEqual(got, []float64{0.5}) {
+		t.Errorf("Expected the upstream duration kept, got %v", got)
+	}
+}
+
+func TestRecorderOrDefault(t *testing.T) {
+	var unset *Metrics
+	if RecorderOrDefault(nil) != MetricsRecorder(GetMetrics()) || RecorderOrDefault(unset) != MetricsRecorder(GetMetrics()) {
+		t.Error("Expected nil recorders to fall back to GetMetrics()")
+	}
+	if r := NewMemoryRecorder(); RecorderOrDefault(r) != MetricsRecorder(r) {
+		t.Error("Expected a recorder to be kept")
+	}
+}
@@ -0,0 +1,59 @@
+package observability
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// RequestSummary is the triage view of a single completed request.
+type RequestSummary struct {
+	Time          time.Time `json:"time"`
+	Method        string    `json:"method"`
+	Path          string    `json:"path"`
+	Status        int       `json:"status"`
+	DurationMs    float64   `json:"duration_ms"`
+	CorrelationID string    `json:"correlation_id"`
+	HopID         string    `json:"hop_id,omitempty"`
+	TraceID       string    `json:"trace_id,omitempty"`
+}
+
+// RequestRing keeps the last N request summaries in a fixed-size ring.
+// Writers claim a slot with an atomic counter and publish the summary with an
+// atomic pointer store, so recording never takes a lock on the request path.
+type RequestRing struct {
+	slots []atomic.Pointer[RequestSummary]
+	next  atomic.Uint64
+}
+
+// NewRequestRing creates a ring holding up to size summaries.
+func NewRequestRing(size int) *RequestRing {
+	if size < 1 {
+		size = 1
+	}
+	return &RequestRing{slots: make([]atomic.Pointer[RequestSummary], size)}
+}
+
+// Add records a summary, overwriting the oldest once the ring is full.
+func (r *RequestRing) Add(s RequestSummary) {
+	i := r.next.Add(1) - 1
+	r.slots[i%uint64(len(r.slots))].Store(&s)
+}
+
+// Snapshot returns the recorded summaries, newest first.
+func (r *RequestRing) Snapshot() []RequestSummary {
+	end := r.next.Load()
+	size := uint64(len(r.slots))
+	count := end
+	if count > size {
+		count = size
+	}
+
+	out := make([]RequestSummary, 0, count)
+	for i := uint64(0); i < count; i++ {
+		// A slot may still be empty if its writer has claimed but not yet stored it
+		if s := r.slots[(end-1-i)%size].Load(); s != nil {
+			out = append(out, *s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,53 @@
+package observability
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestRequestRingNewestFirst(t *testing.T) {
+	ring := NewRequestRing(3)
+	for i := 0; i < 5; i++ {
+		ring.Add(RequestSummary{Path: fmt.Sprintf("/%d", i)})
+	}
+
+	got := ring.Snapshot()
+	if len(got) != 3 {
+		t.Fatalf("Expected 3 summaries, got %d", len(got))
+	}
+	for i, want := range []string{"/4", "/3", "/2"} {
+		if got[i].Path != want {
+			t.Errorf("Snapshot[%d] = %s, want %s", i, got[i].Path, want)
+		}
+	}
+}
+
+func TestRequestRingPartiallyFilled(t *testing.T) {
+	ring := NewRequestRing(10)
+	ring.Add(RequestSummary{Path: "/only"})
+
+	got := ring.Snapshot()
+	if len(got) != 1 || got[0].Path != "/only" {
+		t.Errorf("Expected single summary, got %+v", got)
+	}
+}
+
+func TestRequestRingConcurrentAdd(t *testing.T) {
+	ring := NewRequestRing(8)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ring.Add(RequestSummary{Status: i})
+			ring.Snapshot()
+		}(i)
+	}
+	wg.Wait()
+
+	if got := len(ring.Snapshot()); got != 8 {
+		t.Errorf("Expected a full ring of 8, got %d", got)
+	}
+}
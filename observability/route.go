@@ -0,0 +1,138 @@
+package observability
+
+import (
+	"strings"
+	"sync"
+)
+
+// OtherRoute is the route label for requests that could not be given a
+// bounded route.
+const OtherRoute = "other"
+
+// RouteNormalizerConfig configures a RouteNormalizer.
+type RouteNormalizerConfig struct {
+	// Templates are known routes such as "/targets/{id}/runs/{run}"; a
+	// "{...}" segment matches any single path segment. Paths matching a
+	// template are labeled with it.
+	Templates []string
+	// MaxRoutes bounds the distinct routes derived from raw paths; paths
+	// beyond it are labeled OtherRoute. Templates do not count towards it.
+	// Defaults to 100.
+	MaxRoutes int
+}
+
+// RouteNormalizer turns request paths into metric labels of bounded
+// cardinality: paths matching a template become the template, dynamic
+// segments such as numbers, UUIDs and long hex or mixed IDs become "{id}",
+// and once MaxRoutes distinct routes are known new ones fall into
+// OtherRoute.
+type RouteNormalizer struct {
+	templates [][]string
+	maxRoutes int
+
+	mu   sync.RWMutex
+	seen map[string]struct{}
+}
+
+// NewRouteNormalizer returns a normalizer for cfg.
+func NewRouteNormalizer(cfg RouteNormalizerConfig) *RouteNormalizer {
+	if cfg.MaxRoutes <= 0 {
+		cfg.MaxRoutes = 100
+	}
+	n := &RouteNormalizer{maxRoutes: cfg.MaxRoutes, seen: make(map[string]struct{})}
+	for _, t := range cfg.Templates {
+		n.templates = append(n.templates, strings.Split(t, "/"))
+	}
+	return n
+}
+
+// Normalize returns the route label for path.
+func (n *RouteNormalizer) Normalize(path string) string {
+	segments := strings.Split(path, "/")
+	for _, t := range n.templates {
+		if matchTemplate(t, segments) {
+			return strings.Join(t, "/")
+		}
+	}
+
+	for i, s := range segments {
+		if isDynamicSegment(s) {
+			segments[i] = "{id}"
+		}
+	}
+	route := strings.Join(segments, "/")
+
+	n.mu.RLock()
+	_, known := n.seen[route]
+	n.mu.RUnlock()
+	if known {
+		return route
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, known = n.seen[route]; !known {
+		if len(n.seen) >= n.maxRoutes {
+			return OtherRoute
+		}
+		n.seen[route] = struct{}{}
+	}
+	return route
+}
+
+func matchTemplate(template, segments []string) bool {
+	if len(template) != len(segments) {
+		return false
+	}
+	for i, t := range template {
+		if strings.HasPrefix(t, "{") && strings.HasSuffix(t, "}") {
+			if segments[i] == "" {
+				return false
+			}
+			continue
+		}
+		if t != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// isDynamicSegment reports whether a path segment looks like an
+// identifier rather than a fixed part of the route.
+func isDynamicSegment(s string) bool {
+	if s == "" {
+		return false
+	}
+	var digits, letters, hex, other int
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= '0' && c <= '9':
+			digits++
+			hex++
+		case c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F':
+			letters++
+			hex++
+		case c >= 'g' && c <= 'z' || c >= 'G' && c <= 'Z':
+			letters++
+		case c == '-' || c == '_':
+		default:
+			other++
+		}
+	}
+	switch {
+	case other > 0:
+		return false
+	case digits == len(s):
+		// Numeric IDs
+		return true
+	case len(s) == 36 && hex == 32 && strings.Count(s, "-") == 4:
+		// UUIDs
+		return true
+	case len(s) >= 16 && hex == len(s):
+		// Hashes and hex-encoded IDs
+		return true
+	}
+	// ULIDs, KSUIDs and similar opaque tokens mix letters and digits
+	return len(s) >= 16 && digits > 0 && letters > 0
+}
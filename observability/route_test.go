@@ -0,0 +1,52 @@
+package observability
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRouteNormalizerCollapsesDynamicSegments(t *testing.T) {
+	n := NewRouteNormalizer(RouteNormalizerConfig{})
+	for path, want := range map[string]string{
+		"/":            "/",
+		"/ping":        "/ping",
+		"/targets/123": "/targets/{id}",
+		"/targets/4bf92f35-77b3-4da6-a3ce-929d0e0e4736/runs": "/targets/{id}/runs",
+		"/blobs/d41d8cd98f00b204e9800998ecf8427e":            "/blobs/{id}",
+		"/req/01HF7YAT00ABCDEFGHJKMNPQRS":                    "/req/{id}",
+		"/docs/getting-started":                              "/docs/getting-started",
+		"/v2/users":                                          "/v2/users",
+	} {
+		if got := n.Normalize(path); got != want {
+			t.Errorf("Normalize(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestRouteNormalizerTemplates(t *testing.T) {
+	n := NewRouteNormalizer(RouteNormalizerConfig{Templates: []string{"/users/{name}/posts"}})
+	if got := n.Normalize("/users/alice/posts"); got != "/users/{name}/posts" {
+		t.Errorf("Expected template route, got %q", got)
+	}
+	if got := n.Normalize("/users//posts"); got == "/users/{name}/posts" {
+		t.Error("Empty segments should not match a template parameter")
+	}
+}
+
+func TestRouteNormalizerFallsBackToOther(t *testing.T) {
+	n := NewRouteNormalizer(RouteNormalizerConfig{MaxRoutes: 3, Templates: []string{"/t/{x}/y"}})
+	for i := 0; i < 3; i++ {
+		if got := n.Normalize(fmt.Sprintf("/page-%c", 'a'+i)); got == OtherRoute {
+			t.Fatalf("Route %d should fit within the limit", i)
+		}
+	}
+	if got := n.Normalize("/page-z"); got != OtherRoute {
+		t.Errorf("Expected %q beyond MaxRoutes, got %q", OtherRoute, got)
+	}
+	if got := n.Normalize("/page-a"); got != "/page-a" {
+		t.Errorf("Known routes keep their label, got %q", got)
+	}
+	if got := n.Normalize("/t/anything/y"); got != "/t/{x}/y" {
+		t.Errorf("Templates are not limited, got %q", got)
+	}
+}
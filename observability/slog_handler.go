@@ -0,0 +1,61 @@
+package observability
+
+import (
+	"context"
+	"log/slog"
+)
+
+// CorrelationIDLogKey is the attribute name used for correlation IDs in structured logs
+const CorrelationIDLogKey = "correlation_id"
+
+// HopIDLogKey is the attribute name used for per-hop request IDs in structured logs
+const HopIDLogKey = "hop_id"
+
+// CorrelationHandler is a slog.Handler that adds request-scoped values from
+// the context (the correlation and hop IDs and W3C trace and span IDs) to every record before passing
+// it on, so business code can simply call slog.InfoContext(ctx, ...).
+type CorrelationHandler struct {
+	next slog.Handler
+}
+
+// NewCorrelationHandler wraps next with correlation ID enrichment.
+func NewCorrelationHandler(next slog.Handler) *CorrelationHandler {
+	return &CorrelationHandler{next: next}
+}
+
+// Enabled defers to the wrapped handler.
+func (h *CorrelationHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle appends the context's correlation ID, hop ID and trace context,
+// if any, and forwards the record.
+func (h *CorrelationHandler) Handle(ctx context.Context, r slog.Record) error {
+	id := GetCorrelationID(ctx)
+	hop := GetHopID(ctx)
+	sc := SpanContextFromContext(ctx)
+	if id != "" || hop != "" || sc.IsValid() {
+		r = r.Clone()
+	}
+	if id != "" {
+		r.AddAttrs(slog.String(CorrelationIDLogKey, id))
+	}
+	if hop != "" {
+		r.AddAttrs(slog.String(HopIDLogKey, hop))
+	}
+	if sc.IsValid() {
+		r.AddAttrs(slog.String(TraceIDLogKey, sc.TraceID.String()), slog.String(SpanIDLogKey, sc.SpanID.String()))
+	}
+	return h.next.Handle(ctx, r)
+}
+
+// WithAttrs returns a CorrelationHandler around the wrapped handler's WithAttrs.
+func (h *CorrelationHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &CorrelationHandler{next: h.next.WithAttrs(attrs)}
+}
+
+// WithGroup returns a CorrelationHandler around the wrapped handler's WithGroup.
+// Correlation attributes added afterwards are nested in the group.
+func (h *CorrelationHandler) WithGroup(name string) slog.Handler {
+	return &CorrelationHandler{next: h.next.WithGroup(name)}
+}
@@ -0,0 +1,92 @@
+package observability
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func decodeLine(t *testing.T, buf *bytes.Buffer) map[string]interface{} {
+	t.Helper()
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Log line is not JSON: %v (%q)", err, buf.String())
+	}
+	return entry
+}
+
+func TestCorrelationHandlerAddsID(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewCorrelationHandler(slog.NewJSONHandler(&buf, nil)))
+
+	ctx := WithCorrelationID(context.Background(), "slog-id")
+	logger.InfoContext(ctx, "hello", "user", "alice")
+
+	entry := decodeLine(t, &buf)
+	if entry[CorrelationIDLogKey] != "slog-id" {
+		t.Errorf("Expected correlation_id slog-id, got %v", entry[CorrelationIDLogKey])
+	}
+	if entry["user"] != "alice" {
+		t.Errorf("Original attributes should be kept, got %v", entry)
+	}
+}
+
+func TestCorrelationHandlerWithoutID(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewCorrelationHandler(slog.NewJSONHandler(&buf, nil)))
+
+	logger.InfoContext(context.Background(), "no id")
+
+	entry := decodeLine(t, &buf)
+	if _, ok := entry[CorrelationIDLogKey]; ok {
+		t.Errorf("correlation_id should be absent without a context ID, got %v", entry)
+	}
+}
+
+func TestCorrelationHandlerWithAttrs(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewCorrelationHandler(slog.NewJSONHandler(&buf, nil))).With("component", "test")
+
+	ctx := WithCorrelationID(context.Background(), "attrs-id")
+	logger.InfoContext(ctx, "derived")
+
+	entry := decodeLine(t, &buf)
+	if entry["component"] != "test" || entry[CorrelationIDLogKey] != "attrs-id" {
+		t.Errorf("Derived logger lost enrichment: %v", entry)
+	}
+}
+
+func TestCorrelationHandlerEnabled(t *testing.T) {
+	h := NewCorrelationHandler(slog.NewJSONHandler(&bytes.Buffer{}, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	if h.Enabled(context.Background(), slog.LevelInfo) {
+		t.Error("Enabled should defer to the wrapped handler's level")
+	}
+}
+
+func TestCorrelationHandlerAddsTraceContext(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewCorrelationHandler(slog.NewJSONHandler(&buf, nil)))
+
+	sc, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	logger.InfoContext(WithSpanContext(context.Background(), sc), "traced")
+
+	entry := decodeLine(t, &buf)
+	if entry[TraceIDLogKey] != "4bf92f3577b34da6a3ce929d0e0e4736" || entry[SpanIDLogKey] != "00f067aa0ba902b7" {
+		t.Errorf("Expected trace attributes, got %v", entry)
+	}
+}
+
+func TestCorrelationHandlerAddsHopID(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewCorrelationHandler(slog.NewJSONHandler(&buf, nil)))
+
+	ctx := WithHopID(WithCorrelationID(context.Background(), "origin-id"), "hop-id")
+	logger.InfoContext(ctx, "hello")
+
+	entry := decodeLine(t, &buf)
+	if entry[CorrelationIDLogKey] != "origin-id" || entry[HopIDLogKey] != "hop-id" {
+		t.Errorf("Expected both correlation and hop IDs, got %v", entry)
+	}
+}
@@ -0,0 +1,155 @@
+package observability
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// statsBuckets are the upper bounds of the latency buckets RequestStats
+// counts in, growing by 25% from 0.1ms to about two minutes. Percentiles
+// are reported as the bound of the bucket they fall in, so they are at
+// most 25% high.
+var statsBuckets = func() []time.Duration {
+	bounds := make([]time.Duration, 64)
+	for i := range bounds {
+		bounds[i] = time.Duration(float64(100*time.Microsecond) * math.Pow(1.25, float64(i)))
+	}
+	return bounds
+}()
+
+// statsSlot holds the requests that finished within one second.
+type statsSlot struct {
+	second  int64
+	count   uint64
+	errors  uint64
+	buckets [64]uint64
+}
+
+// RequestStats summarizes the requests of a rolling window in process,
+// for the /stats endpoint. It keeps one slot per second of the window, so
+// memory does not grow with traffic.
+type RequestStats struct {
+	window time.Duration
+	now    func() time.Time
+	active atomic.Int64
+
+	mu    sync.Mutex
+	slots []statsSlot
+}
+
+// StatsSnapshot is the summary of a RequestStats window.
+type StatsSnapshot struct {
+	WindowSeconds float64 `json:"window_seconds"`
+	Requests      uint64  `json:"requests"`
+	// RequestRate is requests per second over the window
+	RequestRate float64 `json:"request_rate"`
+	// ErrorRate is the fraction of requests that failed with a 5xx status
+	ErrorRate      float64         `json:"error_rate"`
+	LatencyMs      StatsPercentile `json:"latency_ms"`
+	ActiveRequests int64           `json:"active_requests"`
+}
+
+// StatsPercentile holds latency percentiles in milliseconds.
+type StatsPercentile struct {
+	P50 float64 `json:"p50"`
+	P95 float64 `json:"p95"`
+	P99 float64 `json:"p99"`
+}
+
+// NewRequestStats returns stats over the given window, rounded up to
+// whole seconds. Defaults to one minute.
+func NewRequestStats(window time.Duration) *RequestStats {
+	if window <= 0 {
+		window = time.Minute
+	}
+	seconds := int((window + time.Second - 1) / time.Second)
+	return &RequestStats{
+		window: time.Duration(seconds) * time.Second,
+		now:    time.Now,
+		slots:  make([]statsSlot, seconds),
+	}
+}
+
+// Start marks a request as active and returns a function that marks it
+// finished.
+func (s *RequestStats) Start() func() {
+	s.active.Add(1)
+	return func() {
+		s.active.Add(-1)
+	}
+}
+
+// Record counts a finished request.
+func (s *RequestStats) Record(status int, duration time.Duration) {
+	bucket := len(statsBuckets) - 1
+	for i, bound := range statsBuckets {
+		if duration <= bound {
+			bucket = i
+			break
+		}
+	}
+
+	second := s.now().Unix()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	slot := &s.slots[second%int64(len(s.slots))]
+	if slot.second != second {
+		*slot = statsSlot{second: second}
+	}
+	slot.count++
+	if status >= 500 {
+		slot.errors++
+	}
+	slot.buckets[bucket]++
+}
+
+// Snapshot summarizes the requests that finished within the window.
+func (s *RequestStats) Snapshot() StatsSnapshot {
+	oldest := s.now().Unix() - int64(len(s.slots)) + 1
+	var count, errors uint64
+	var buckets [64]uint64
+	s.mu.Lock()
+	for _, slot := range s.slots {
+		if slot.second < oldest {
+			continue
+		}
+		count += slot.count
+		errors += slot.errors
+		for i, n := range slot.buckets {
+			buckets[i] += n
+		}
+	}
+	s.mu.Unlock()
+
+	snap := StatsSnapshot{
+		WindowSeconds:  s.window.Seconds(),
+		Requests:       count,
+		RequestRate:    float64(count) / s.window.Seconds(),
+		ActiveRequests: s.active.Load(),
+	}
+	if count > 0 {
+		snap.ErrorRate = float64(errors) / float64(count)
+		snap.LatencyMs = StatsPercentile{
+			P50: percentile(buckets[:], count, 0.5),
+			P95: percentile(buckets[:], count, 0.95),
+			P99: percentile(buckets[:], count, 0.99),
+		}
+	}
+	return snap
+}
+
+// percentile returns the upper bound, in milliseconds, of the bucket
+// holding quantile q of count observations.
+func percentile(buckets []uint64, count uint64, q float64) float64 {
+	rank := uint64(math.Ceil(q * float64(count)))
+	var seen uint64
+	for i, n := range buckets {
+		seen += n
+		if seen >= rank {
+			return float64(statsBuckets[i]) / float64(time.Millisecond)
+		}
+	}
+	return float64(statsBuckets[len(statsBuckets)-1]) / float64(time.Millisecond)
+}
@@ -0,0 +1,65 @@
+package observability
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRequestStatsSnapshot(t *testing.T) {
+	stats := NewRequestStats(10 * time.Second)
+	for i := 0; i < 98; i++ {
+		stats.Record(200, 10*time.Millisecond)
+	}
+	stats.Record(500, 500*time.Millisecond)
+	stats.Record(404, time.Second)
+
+	got := stats.Snapshot()
+	if got.Requests != 100 || got.RequestRate != 10 || got.WindowSeconds != 10 {
+		t.Errorf("Expected 100 requests at 10/s, got %+v", got)
+	}
+	if got.ErrorRate != 0.01 {
+		t.Errorf("Expected only the 5xx counted as an error, got %v", got.ErrorRate)
+	}
+	if got.LatencyMs.P50 < 10 || got.LatencyMs.P50 > 12.5 {
+		t.Errorf("Expected p50 within 25%% above 10ms, got %v", got.LatencyMs.P50)
+	}
+	if got.LatencyMs.P99 < 500 || got.LatencyMs.P99 > 625 {
+		t.Errorf("Expected p99 within 25%% above 500ms, got %v", got.LatencyMs.P99)
+	}
+}
+
+func TestRequestStatsWindowExpires(t *testing.T) {
+	now := time.Unix(1000, 0)
+	stats := NewRequestStats(5 * time.Second)
+	stats.now = func() time.Time { return now }
+
+	stats.Record(200, time.Millisecond)
+	now = now.Add(4 * time.Second)
+	stats.Record(200, time.Millisecond)
+	if got := stats.Snapshot().Requests; got != 2 {
+		t.Errorf("Expected both requests within the window, got %d", got)
+	}
+
+	now = now.Add(2 * time.Second)
+	if got := stats.Snapshot().Requests; got != 1 {
+		t.Errorf("Expected the first request to expire, got %d", got)
+	}
+	// A reused slot drops the counts of the second it held before
+	now = now.Add(3 * time.Second)
+	stats.Record(500, time.Millisecond)
+	if got := stats.Snapshot(); got.Requests != 1 || got.ErrorRate != 1 {
+		t.Errorf("Expected only the newest request, got %+v", got)
+	}
+}
+
+func TestRequestStatsActive(t *testing.T) {
+	stats := NewRequestStats(0)
+	done := stats.Start()
+	if got := stats.Snapshot(); got.ActiveRequests != 1 || got.WindowSeconds != 60 {
+		t.Errorf("Expected one active request over the default window, got %+v", got)
+	}
+	done()
+	if got := stats.Snapshot(); got.ActiveRequests != 0 || got.Requests != 0 || got.LatencyMs.P99 != 0 {
+		t.Errorf("Expected an empty snapshot, got %+v", got)
+	}
+}
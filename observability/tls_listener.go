@@ -0,0 +1,157 @@
+package observability
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// TLSListener is a net.Listener that completes the TLS handshake of each
+// accepted connection before handing it out, recording the handshake
+// duration, the negotiated version and cipher suite, and the reason of
+// failed handshakes. http.Server skips the handshake for connections that
+// already completed it, so
+//
+//	server.Serve(observability.NewTLSListener(ln, tlsConfig, metrics, 10*time.Second))
+//
+// serves HTTPS like ListenAndServeTLS. tlsConfig must carry the
+// certificates, and "h2" in NextProtos for HTTP/2.
+type TLSListener struct {
+	inner   net.Listener
+	config  *tls.Config
+	metrics *Metrics
+	timeout time.Duration
+
+	results   chan acceptResult
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type acceptResult struct {
+	conn net.Conn
+	err  error
+}
+
+// NewTLSListener wraps inner. Handshakes taking longer than timeout fail;
+// a zero timeout means no limit.
+func NewTLSListener(inner net.Listener, config *tls.Config, m *Metrics, timeout time.Duration) *TLSListener {
+	l := &TLSListener{
+		inner:   inner,
+		config:  config,
+		metrics: m,
+		timeout: timeout,
+		results: make(chan acceptResult),
+		done:    make(chan struct{}),
+	}
+	go l.acceptLoop()
+	return l
+}
+
+// acceptLoop accepts connections and handshakes each in its own goroutine,
+// so a slow client cannot hold up the others.
+func (l *TLSListener) acceptLoop() {
+	for {
+		conn, err := l.inner.Accept()
+		if err != nil {
+			// Accept errors are passed on for the server to back off or stop
+			select {
+			case l.results <- acceptResult{err: err}:
+			case <-l.done:
+				return
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		go l.handshake(conn)
+	}
+}
+
+func (l *TLSListener) handshake(raw net.Conn) {
+	ctx := context.Background()
+	if l.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, l.timeout)
+		defer cancel()
+	}
+
+	conn := tls.Server(raw, l.config)
+	start := time.Now()
+	if err := conn.HandshakeContext(ctx); err != nil {
+		l.metrics.TLSHandshakeFailures.WithLabelValues(TLSFailureReason(err)).Inc()
+		conn.Close()
+		return
+	}
+	state := conn.ConnectionState()
+	version := tls.VersionName(state.Version)
+	l.metrics.TLSHandshakeDuration.WithLabelValues(version).Observe(time.Since(start).Seconds())
+	l.metrics.TLSHandshakeCounter.WithLabelValues(version, tls.CipherSuiteName(state.CipherSuite)).Inc()
+
+	select {
+	case l.results <- acceptResult{conn: conn}:
+	case <-l.done:
+		conn.Close()
+	}
+}
+
+// Accept returns the next connection that completed its handshake.
+func (l *TLSListener) Accept() (net.Conn, error) {
+	select {
+	case r := <-l.results:
+		return r.conn, r.err
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close stops accepting; connections still handshaking are closed.
+func (l *TLSListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return l.inner.Close()
+}
+
+// Addr returns the address of the wrapped listener.
+func (l *TLSListener) Addr() net.Addr {
+	return l.inner.Addr()
+}
+
+// TLSFailureReason classifies a server handshake error into a bounded
+// metric label: version, cipher, client_cert, remote_alert, not_tls,
+// timeout, eof or other.
+func TLSFailureReason(err error) string {
+	var (
+		recordErr tls.RecordHeaderError
+		opErr     *net.OpError
+		verifyErr *tls.CertificateVerificationError
+		netErr    net.Error
+	)
+	msg := err.Error()
+	switch {
+	case errors.As(err, &recordErr):
+		return "not_tls"
+	case errors.As(err, &verifyErr),
+		strings.Contains(msg, "client didn't provide a certificate"),
+		strings.Contains(msg, "failed to verify certificate"):
+		return "client_cert"
+	case strings.Contains(msg, "unsupported versions"), strings.Contains(msg, "protocol version"):
+		return "version"
+	case strings.Contains(msg, "no cipher suite"), strings.Contains(msg, "no ECDHE curve"),
+		strings.Contains(msg, "no mutually supported"):
+		return "cipher"
+	case errors.As(err, &opErr) && opErr.Op == "remote error":
+		// The client aborted, e.g. because it does not trust our certificate
+		return "remote_alert"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.Is(err, io.EOF), errors.Is(err, syscall.ECONNRESET):
+		return "eof"
+	}
+	return "other"
+}
@@ -0,0 +1,152 @@
+package observability
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// selfSignedCert returns a certificate for 127.0.0.1 valid for an hour.
+func selfSignedCert(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "ping test"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// serveTLS serves an empty handler through a TLSListener and returns its
+// address.
+func serveTLS(t *testing.T, m *Metrics) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{selfSignedCert(t)}, MinVersion: tls.VersionTLS12}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})}
+	go server.Serve(NewTLSListener(ln, config, m, time.Second))
+	t.Cleanup(func() { server.Close() })
+	return ln.Addr().String()
+}
+
+func waitForFailure(t *testing.T, m *Metrics, reason string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for testutil.ToFloat64(m.TLSHandshakeFailures.WithLabelValues(reason)) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected a %s handshake failure", reason)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestTLSListenerRecordsHandshakes(t *testing.T) {
+	m := NewMetrics(MetricsOptions{})
+	addr := serveTLS(t, m)
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		InsecureSkipVerify: true,
+		MaxVersion:         tls.VersionTLS13,
+	}}}
+	resp, err := client.Get("https://" + addr)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.TLS == nil || resp.TLS.Version != tls.VersionTLS13 {
+		t.Fatalf("Expected a TLS 1.3 response, got %+v", resp.TLS)
+	}
+
+	counter := m.TLSHandshakeCounter.WithLabelValues("TLS 1.3", tls.CipherSuiteName(resp.TLS.CipherSuite))
+	if got := testutil.ToFloat64(counter); got != 1 {
+		t.Errorf("Expected 1 handshake, got %v", got)
+	}
+	if n := testutil.CollectAndCount(m.TLSHandshakeDuration); n != 1 {
+		t.Errorf("Expected a handshake duration series, got %d", n)
+	}
+}
+
+func TestTLSListenerRecordsFailures(t *testing.T) {
+	m := NewMetrics(MetricsOptions{})
+	addr := serveTLS(t, m)
+
+	// Plain HTTP on the TLS port
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte("GET / HTTP/1.1\r\nHost: x\r\n\r\n"))
+	io.Copy(io.Discard, conn)
+	conn.Close()
+	waitForFailure(t, m, "not_tls")
+
+	// A client limited to TLS 1.1
+	_, err = tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true, MinVersion: tls.VersionTLS10, MaxVersion: tls.VersionTLS11})
+	if err == nil {
+		t.Fatal("Expected the TLS 1.1 handshake to fail")
+	}
+	waitForFailure(t, m, "version")
+
+	// A client that does not trust the certificate
+	_, err = tls.Dial("tcp", addr, &tls.Config{})
+	if err == nil {
+		t.Fatal("Expected the untrusted handshake to fail")
+	}
+	waitForFailure(t, m, "remote_alert")
+}
+
+func TestTLSFailureReason(t *testing.T) {
+	tests := map[error]string{
+		io.EOF:                   "eof",
+		context.DeadlineExceeded: "timeout",
+		errors.New("tls: client didn't provide a certificate"):                 "client_cert",
+		errors.New("tls: no cipher suite supported by both client and server"): "cipher",
+		errors.New("something else"):                                           "other",
+	}
+	for err, want := range tests {
+		if got := TLSFailureReason(err); got != want {
+			t.Errorf("TLSFailureReason(%v) = %q, want %q", err, got, want)
+		}
+	}
+}
+
+func TestTLSListenerClose(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := NewTLSListener(ln, &tls.Config{}, NewMetrics(MetricsOptions{}), 0)
+	if l.Addr().String() != ln.Addr().String() {
+		t.Errorf("Expected the inner address, got %s", l.Addr())
+	}
+	l.Close()
+	if _, err := l.Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Expected net.ErrClosed after Close, got %v", err)
+	}
+}
@@ -0,0 +1,185 @@
+package observability
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+const (
+	// TraceparentHeader carries the W3C trace context of a request
+	TraceparentHeader = "traceparent"
+
+	// TracestateHeader carries vendor-specific W3C trace state
+	TracestateHeader = "tracestate"
+
+	// TraceIDLogKey and SpanIDLogKey name trace attributes in structured logs
+	TraceIDLogKey = "trace_id"
+	SpanIDLogKey  = "span_id"
+)
+
+// traceparentHeaderKey and tracestateHeaderKey are the headers in
+// canonical form: indexing the header map with them skips canonicalizing
+// on every request.
+var (
+	traceparentHeaderKey = http.CanonicalHeaderKey(TraceparentHeader)
+	tracestateHeaderKey  = http.CanonicalHeaderKey(TracestateHeader)
+)
+
+// ErrInvalidTraceparent is returned for traceparent headers that do not
+// follow the W3C Trace Context format.
+var ErrInvalidTraceparent = errors.New("invalid traceparent")
+
+// TraceID identifies a whole trace across services.
+type TraceID [16]byte
+
+// SpanID identifies one operation within a trace.
+type SpanID [8]byte
+
+// String returns the lowercase hex form used on the wire.
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+
+// IsValid reports whether t is non-zero, as the spec requires.
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+
+// String returns the lowercase hex form used on the wire.
+func (s SpanID) String() string { return hex.EncodeToString(s[:]) }
+
+// IsValid reports whether s is non-zero, as the spec requires.
+func (s SpanID) IsValid() bool { return s != SpanID{} }
+
+// NewTraceID returns a random trace ID.
+func NewTraceID() TraceID {
+	var t TraceID
+	rand.Read(t[:])
+	return t
+}
+
+// NewSpanID returns a random span ID.
+func NewSpanID() SpanID {
+	var s SpanID
+	rand.Read(s[:])
+	return s
+}
+
+// SpanContext is the part of a span that crosses process boundaries.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	// Sampled is the traceparent sampled flag
+	Sampled bool
+	// TraceState is the raw tracestate header, passed on unchanged
+	TraceState string
+}
+
+// IsValid reports whether both IDs are set.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Traceparent formats sc as a version 00 traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// ParseTraceparent parses a traceparent header value. Versions above 00
+// are accepted as long as their first four fields match the 00 layout.
+func ParseTraceparent(value string) (SpanContext, error) {
+	var sc SpanContext
+	value = strings.TrimSpace(value)
+	if len(value) < 55 || value[2] != '-' || value[35] != '-' || value[52] != '-' {
+		return sc, ErrInvalidTraceparent
+	}
+	version := value[:2]
+	if version == "ff" || !isLowerHex(version) {
+		return sc, ErrInvalidTraceparent
+	}
+	if len(value) > 55 && (version == "00" || value[55] != '-') {
+		return sc, ErrInvalidTraceparent
+	}
+	if !isLowerHex(value[3:35]) || !isLowerHex(value[36:52]) || !isLowerHex(value[53:55]) {
+		return sc, ErrInvalidTraceparent
+	}
+	hex.Decode(sc.TraceID[:], []byte(value[3:35]))
+	hex.Decode(sc.SpanID[:], []byte(value[36:52]))
+	if !sc.IsValid() {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+	var flags [1]byte
+	hex.Decode(flags[:], []byte(value[53:55]))
+	sc.Sampled = flags[0]&1 == 1
+	return sc, nil
+}
+
+func isLowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// ExtractTraceContext reads the traceparent and tracestate headers. The
+// trace state is dropped along with an invalid traceparent.
+func ExtractTraceContext(h http.Header) (SpanContext, bool) {
+	values := h[traceparentHeaderKey]
+	if len(values) == 0 {
+		return SpanContext{}, false
+	}
+	sc, err := ParseTraceparent(values[0])
+	if err != nil {
+		return SpanContext{}, false
+	}
+	if state := h[tracestateHeaderKey]; len(state) > 0 {
+		sc.TraceState = strings.Join(state, ",")
+	}
+	return sc, true
+}
+
+// InjectTraceContext writes the context's span as the parent of an
+// outbound request, so the callee joins the same trace.
+func InjectTraceContext(ctx context.Context, h http.Header) {
+	sc := SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	h.Set(TraceparentHeader, sc.Traceparent())
+	if sc.TraceState != "" {
+		h.Set(TracestateHeader, sc.TraceState)
+	} else {
+		h.Del(TracestateHeader)
+	}
+}
+
+// ChildSpanContext starts a span under parent, or a new sampled trace when
+// parent is not valid.
+func ChildSpanContext(parent SpanContext) SpanContext {
+	if !parent.IsValid() {
+		return SpanContext{TraceID: NewTraceID(), SpanID: NewSpanID(), Sampled: true}
+	}
+	child := parent
+	child.SpanID = NewSpanID()
+	return child
+}
+
+type spanContextKey struct{}
+
+// WithSpanContext stores the current span in the context.
+func WithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// SpanContextFromContext returns the current span, or the zero value.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	sc, _ := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc
+}
@@ -0,0 +1,82 @@
+package observability
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+const validTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestParseTraceparent(t *testing.T) {
+	sc, err := ParseTraceparent(validTraceparent)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" || !sc.Sampled {
+		t.Errorf("Parsed wrong values: %+v", sc)
+	}
+	if sc.Traceparent() != validTraceparent {
+		t.Errorf("Round trip gave %q", sc.Traceparent())
+	}
+
+	// Future versions may append fields
+	if _, err := ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra"); err != nil {
+		t.Errorf("Future version should parse, got %v", err)
+	}
+}
+
+func TestParseTraceparentRejectsInvalid(t *testing.T) {
+	for _, value := range []string{
+		"",
+		"garbage",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"00_4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	} {
+		if _, err := ParseTraceparent(value); err != ErrInvalidTraceparent {
+			t.Errorf("Expected %q to be rejected, got %v", value, err)
+		}
+	}
+}
+
+func TestExtractAndInjectTraceContext(t *testing.T) {
+	in := http.Header{}
+	in.Set(TraceparentHeader, validTraceparent)
+	in.Add(TracestateHeader, "congo=t61rcWkgMzE")
+	in.Add(TracestateHeader, "rojo=00f067aa0ba902b7")
+
+	parent, ok := ExtractTraceContext(in)
+	if !ok || parent.TraceState != "congo=t61rcWkgMzE,rojo=00f067aa0ba902b7" {
+		t.Fatalf("Unexpected extraction: %+v ok=%v", parent, ok)
+	}
+	child := ChildSpanContext(parent)
+	if child.TraceID != parent.TraceID || child.SpanID == parent.SpanID || !child.SpanID.IsValid() {
+		t.Errorf("Child should share the trace with a new span: %+v", child)
+	}
+
+	out := http.Header{}
+	InjectTraceContext(WithSpanContext(context.Background(), child), out)
+	if out.Get(TraceparentHeader) != child.Traceparent() || out.Get(TracestateHeader) != parent.TraceState {
+		t.Errorf("Unexpected outbound headers: %v", out)
+	}
+
+	empty := http.Header{}
+	InjectTraceContext(context.Background(), empty)
+	if len(empty) != 0 {
+		t.Errorf("Nothing should be injected without a span, got %v", empty)
+	}
+}
+
+func TestChildSpanContextStartsTrace(t *testing.T) {
+	root := ChildSpanContext(SpanContext{})
+	if !root.IsValid() || !root.Sampled {
+		t.Errorf("Expected a new sampled trace, got %+v", root)
+	}
+	if _, ok := ExtractTraceContext(http.Header{TraceparentHeader: {"bogus"}, TracestateHeader: {"a=b"}}); ok {
+		t.Error("Invalid traceparent should not be extracted")
+	}
+}
@@ -0,0 +1,189 @@
+package observability
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Phases of an outbound call, used as the phase label of
+// api_call_phase_duration_seconds.
+const (
+	PhaseDNS     = "dns"
+	PhaseConnect = "connect"
+	PhaseTLS     = "tls"
+	PhaseTTFB    = "ttfb"
+)
+
+// Levels Transport logs calls at.
+const (
+	TransportLogOff   = "off"
+	TransportLogDebug = "debug"
+	TransportLogInfo  = "info"
+)
+
+// Transport is an http.RoundTripper that propagates the request context's
+// correlation ID, trace context and baggage to outgoing requests and
+// records each call in the api_call metrics by destination host, down to
+// the time spent in DNS lookup, connecting, the TLS handshake and waiting
+// for the first response byte. It can also log every call.
+type Transport struct {
+	base http.RoundTripper
+	opts TransportOptions
+}
+
+// TransportOptions tunes NewTransportWithOptions.
+type TransportOptions struct {
+	// LogLevel logs every call, with its correlation ID, at
+	// TransportLogDebug or TransportLogInfo; calls that fail or answer
+	// with a 5xx are logged as warnings. Empty or TransportLogOff logs
+	// nothing.
+	LogLevel string
+	// Logger receives the call logs of requests whose context carries no
+	// logger. Nil uses DefaultLogger.
+	Logger Logger
+	// Clock times the calls. Nil uses DefaultClock.
+	Clock Clock
+	// Metrics records the calls. Nil uses GetMetrics().
+	Metrics *Metrics
+}
+
+// NewTransport wraps base, or http.DefaultTransport when base is nil. Build
+// outbound requests with http.NewRequestWithContext so the context of the
+// incoming request reaches the transport.
+func NewTransport(base http.RoundTripper) *Transport {
+	return NewTransportWithOptions(base, TransportOptions{})
+}
+
+// NewTransportWithOptions is NewTransport with call logging.
+func NewTransportWithOptions(base http.RoundTripper, opts TransportOptions) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if opts.Clock == nil {
+		opts.Clock = DefaultClock
+	}
+	if opts.Metrics == nil {
+		opts.Metrics = GetMetrics()
+	}
+	return &Transport{base: base, opts: opts}
+}
+
+// RoundTrip implements http.RoundTripper. Responses with a 5xx status are
+// counted as failed calls.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	clock := t.opts.Clock
+	start := clock.Now()
+
+	// RoundTrippers must not modify the caller's request
+	req = req.Clone(tracePhases(ctx, t.opts.Metrics, clock, start))
+	if id := GetCorrelationID(ctx); id != "" {
+		req.Header.Set(RequestIDHeader, id)
+	}
+	InjectTraceContext(ctx, req.Header)
+	if BaggageFromContext(ctx) != nil {
+		InjectBaggage(ctx, req.Header)
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	callErr, status := err, 0
+	if err == nil {
+		status = resp.StatusCode
+		if status >= 500 {
+			callErr = fmt.Errorf("%s %s: %s", req.Method, req.URL.Host, resp.Status)
+		}
+	}
+	elapsed := clock.Now().Sub(start)
+	t.opts.Metrics.RecordAPICall(req.URL.Host, status, elapsed.Seconds(), callErr)
+	t.logCall(ctx, req, status, elapsed, err)
+	return resp, err
+}
+
+// logCall logs a finished call. The URL is logged without its query and
+// credentials, which often carry secrets.
+func (t *Transport) logCall(ctx context.Context, req *http.Request, status int, elapsed time.Duration, err error) {
+	if t.opts.LogLevel == "" || t.opts.LogLevel == TransportLogOff {
+		return
+	}
+	logger := t.opts.Logger
+	if l, ok := ctx.Value(loggerKey{}).(Logger); ok && l != nil {
+		logger = l
+	} else if logger == nil {
+		logger = DefaultLogger
+	}
+	target := req.URL.Scheme + "://" + req.URL.Host + req.URL.EscapedPath()
+	id := GetCorrelationID(ctx)
+	switch {
+	case err != nil:
+		logger.Warnf(ctx, "outbound [%s] %s failed (duration=%.3fs, id=%s): %v", req.Method, target, elapsed.Seconds(), id, err)
+	case status >= 500:
+		logger.Warnf(ctx, "outbound [%s] %s -> %d (duration=%.3fs, id=%s)", req.Method, target, status, elapsed.Seconds(), id)
+	case t.opts.LogLevel == TransportLogDebug:
+		logger.Debugf(ctx, "outbound [%s] %s -> %d (duration=%.3fs, id=%s)", req.Method, target, status, elapsed.Seconds(), id)
+	default:
+		logger.Infof(ctx, "outbound [%s] %s -> %d (duration=%.3fs, id=%s)", req.Method, target, status, elapsed.Seconds(), id)
+	}
+}
+
+// Unwrap returns the wrapped RoundTripper.
+func (t *Transport) Unwrap() http.RoundTripper {
+	return t.base
+}
+
+// tracePhases returns ctx with an httptrace.ClientTrace observing the
+// phases of a call started at start, timed by clock, in metrics. Calls on a reused
+// connection only observe ttfb.
+func tracePhases(ctx context.Context, metrics *Metrics, clock Clock, start time.Time) context.Context {
+	phases := metrics.APICallPhase
+	// Dialing several addresses at once calls the connect hooks
+	// concurrently
+	var mu sync.Mutex
+	var dnsStart, tlsStart time.Time
+	connectStarts := make(map[string]time.Time)
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			mu.Lock()
+			dnsStart = clock.Now()
+			mu.Unlock()
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			if info.Err == nil && !dnsStart.IsZero() {
+				phases.WithLabelValues(PhaseDNS).Observe(clock.Now().Sub(dnsStart).Seconds())
+			}
+		},
+		ConnectStart: func(network, addr string) {
+			mu.Lock()
+			connectStarts[network+addr] = clock.Now()
+			mu.Unlock()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if began, ok := connectStarts[network+addr]; ok && err == nil {
+				phases.WithLabelValues(PhaseConnect).Observe(clock.Now().Sub(began).Seconds())
+			}
+		},
+		TLSHandshakeStart: func() {
+			mu.Lock()
+			tlsStart = clock.Now()
+			mu.Unlock()
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if err == nil && !tlsStart.IsZero() {
+				phases.WithLabelValues(PhaseTLS).Observe(clock.Now().Sub(tlsStart).Seconds())
+			}
+		},
+		GotFirstResponseByte: func() {
+			phases.WithLabelValues(PhaseTTFB).Observe(clock.Now().Sub(start).Seconds())
+		},
+	})
+}
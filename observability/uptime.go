@@ -0,0 +1,41 @@
+package observability
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// processStartTime approximates the process start with the time this
+// package was initialized.
+var processStartTime = time.Now()
+
+// ProcessStartTime returns when the process started.
+func ProcessStartTime() time.Time {
+	return processStartTime
+}
+
+// Uptime returns how long the process has been running.
+func Uptime() time.Duration {
+	return time.Since(processStartTime)
+}
+
+// uptimeCollectors returns the process_uptime_seconds gauge and, when
+// withStartTime is set, a process_start_time_seconds gauge for when the
+// process collector does not provide one. Both keep their standard names
+// so restart loops show up without knowing the service's prefix.
+func uptimeCollectors(withStartTime bool) []prometheus.Collector {
+	cs := []prometheus.Collector{
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "process_uptime_seconds",
+			Help: "Time since the process started in seconds",
+		}, func() float64 { return Uptime().Seconds() }),
+	}
+	if withStartTime {
+		cs = append(cs, prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "process_start_time_seconds",
+			Help: "Start time of the process since unix epoch in seconds",
+		}, func() float64 { return float64(processStartTime.UnixNano()) / 1e9 }))
+	}
+	return cs
+}
@@ -0,0 +1,41 @@
+package observability
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestUptime(t *testing.T) {
+	if ProcessStartTime().After(time.Now()) {
+		t.Error("Start time must not be in the future")
+	}
+	if Uptime() <= 0 {
+		t.Errorf("Expected positive uptime, got %s", Uptime())
+	}
+}
+
+func TestUptimeMetrics(t *testing.T) {
+	for _, disabled := range []bool{false, true} {
+		m := NewMetrics(MetricsOptions{DisableRuntimeCollectors: disabled})
+		for _, name := range []string{"process_uptime_seconds", "process_start_time_seconds"} {
+			if n, err := testutil.GatherAndCount(m.Gatherer, name); err != nil || n != 1 {
+				t.Errorf("Expected %s with runtime collectors disabled=%v, got %d (%v)", name, disabled, n, err)
+			}
+		}
+	}
+
+	m := NewMetrics(MetricsOptions{DisableRuntimeCollectors: true})
+	families, err := m.Gatherer.Gather()
+	if err != nil {
+		t.Fatalf("Gather failed: %v", err)
+	}
+	for _, f := range families {
+		if f.GetName() == "process_start_time_seconds" {
+			if got := f.GetMetric()[0].GetGauge().GetValue(); got != float64(processStartTime.UnixNano())/1e9 {
+				t.Errorf("Expected the recorded start time, got %v", got)
+			}
+		}
+	}
+}
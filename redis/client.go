@@ -0,0 +1,262 @@
+// Package redis is a minimal Redis client speaking RESP2 over TCP. It covers
+// what the service needs (commands and Lua scripts with a small connection
+// pool) without pulling in a full client library.
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrNil is returned for a nil bulk or array reply.
+var ErrNil = errors.New("redis: nil reply")
+
+// Error is an error reply sent by the server.
+type Error string
+
+func (e Error) Error() string { return "redis: " + string(e) }
+
+// Options configures a Client.
+type Options struct {
+	// Addr is the server's host:port.
+	Addr string
+	// Password is sent with AUTH on every new connection when non-empty.
+	Password string
+	// DB is selected on every new connection when non-zero.
+	DB int
+	// Timeout bounds dialing and each command round trip.
+	Timeout time.Duration
+	// PoolSize is the number of idle connections kept for reuse.
+	PoolSize int
+}
+
+// Client is a pooled Redis connection. It is safe for concurrent use.
+type Client struct {
+	opts Options
+	idle chan *conn
+
+	mu     sync.Mutex
+	closed bool
+}
+
+type conn struct {
+	nc net.Conn
+	rd *bufio.Reader
+}
+
+// NewClient creates a client. Connections are dialed lazily.
+func NewClient(opts Options) *Client {
+	if opts.Timeout <= 0 {
+		opts.Timeout = time.Second
+	}
+	if opts.PoolSize <= 0 {
+		opts.PoolSize = 8
+	}
+	return &Client{opts: opts, idle: make(chan *conn, opts.PoolSize)}
+}
+
+// Do sends a command and returns its reply: string for simple and bulk
+// strings, int64 for integers, []interface{} for arrays. Server errors are
+// returned as Error; nil replies as ErrNil. Within an array, such as the
+// reply to EXEC, errors are kept in place as Error values and nil elements
+// as nil.
+func (c *Client) Do(ctx context.Context, args ...interface{}) (interface{}, error) {
+	cn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := cn.roundTrip(ctx, c.opts.Timeout, args)
+	var serverErr Error
+	if err != nil && err != ErrNil && !errors.As(err, &serverErr) {
+		// The connection state is unknown after an I/O error
+		cn.nc.Close()
+		return nil, err
+	}
+	c.put(cn)
+	return reply, err
+}
+
+// Close closes idle connections; later calls to Do fail.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	close(c.idle)
+	for cn := range c.idle {
+		cn.nc.Close()
+	}
+	return nil
+}
+
+func (c *Client) get(ctx context.Context) (*conn, error) {
+	select {
+	case cn, ok := <-c.idle:
+		if ok {
+			return cn, nil
+		}
+		return nil, errors.New("redis: client closed")
+	default:
+	}
+	return c.dial(ctx)
+}
+
+func (c *Client) put(cn *conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		cn.nc.Close()
+		return
+	}
+	select {
+	case c.idle <- cn:
+	default:
+		cn.nc.Close()
+	}
+}
+
+func (c *Client) dial(ctx context.Context) (*conn, error) {
+	d := net.Dialer{Timeout: c.opts.Timeout}
+	nc, err := d.DialContext(ctx, "tcp", c.opts.Addr)
+	if err != nil {
+		return nil, err
+	}
+	cn := &conn{nc: nc, rd: bufio.NewReader(nc)}
+
+	if c.opts.Password != "" {
+		if _, err := cn.roundTrip(ctx, c.opts.Timeout, []interface{}{"AUTH", c.opts.Password}); err != nil {
+			nc.Close()
+			return nil, err
+		}
+	}
+	if c.opts.DB != 0 {
+		if _, err := cn.roundTrip(ctx, c.opts.Timeout, []interface{}{"SELECT", c.opts.DB}); err != nil {
+			nc.Close()
+			return nil, err
+		}
+	}
+	return cn, nil
+}
+
+func (cn *conn) roundTrip(ctx context.Context, timeout time.Duration, args []interface{}) (interface{}, error) {
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	cn.nc.SetDeadline(deadline)
+
+	if _, err := cn.nc.Write(encodeCommand(args)); err != nil {
+		return nil, err
+	}
+	return readReply(cn.rd)
+}
+
+// encodeCommand renders args as a RESP array of bulk strings.
+func encodeCommand(args []interface{}) []byte {
+	buf := make([]byte, 0, 64)
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, '\r', '\n')
+	for _, arg := range args {
+		var s string
+		switch v := arg.(type) {
+		case string:
+			s = v
+		case []byte:
+			s = string(v)
+		case int:
+			s = strconv.Itoa(v)
+		case int64:
+			s = strconv.FormatInt(v, 10)
+		case float64:
+			s = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			s = fmt.Sprint(v)
+		}
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(s)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, s...)
+		buf = append(buf, '\r', '\n')
+	}
+	return buf
+}
+
+func readLine(rd *bufio.Reader) (string, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("redis: malformed line %q", line)
+	}
+	return line[:len(line)-2], nil
+}
+
+// readReply parses one RESP2 reply.
+func readReply(rd *bufio.Reader) (interface{}, error) {
+	line, err := readLine(rd)
+	if err != nil {
+		return nil, err
+	}
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, Error(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, ErrNil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(rd, data); err != nil {
+			return nil, err
+		}
+		return string(data[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, ErrNil
+		}
+		// Every element is read, even after an error element, so the
+		// connection is left at the start of the next reply
+		items := make([]interface{}, n)
+		for i := range items {
+			item, err := readReply(rd)
+			var serverErr Error
+			switch {
+			case errors.As(err, &serverErr):
+				item = serverErr
+			case err != nil && err != ErrNil:
+				return nil, err
+			}
+			items[i] = item
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply type %q", line[0])
+	}
+}
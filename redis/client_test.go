@@ -0,0 +1,182 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer answers RESP commands with the raw replies returned by handle.
+type fakeServer struct {
+	ln     net.Listener
+	handle func(cmd []string) string
+
+	mu       sync.Mutex
+	commands [][]string
+}
+
+func newFakeServer(t *testing.T, handle func(cmd []string) string) *fakeServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := &fakeServer{ln: ln, handle: handle}
+	go s.serve()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *fakeServer) serve() {
+	for {
+		nc, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer nc.Close()
+			rd := bufio.NewReader(nc)
+			for {
+				req, err := readReply(rd)
+				if err != nil {
+					return
+				}
+				var cmd []string
+				for _, arg := range req.([]interface{}) {
+					cmd = append(cmd, arg.(string))
+				}
+				s.mu.Lock()
+				s.commands = append(s.commands, cmd)
+				s.mu.Unlock()
+				nc.Write([]byte(s.handle(cmd)))
+			}
+		}()
+	}
+}
+
+func (s *fakeServer) seen() [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([][]string(nil), s.commands...)
+}
+
+func TestClientReplyTypes(t *testing.T) {
+	srv := newFakeServer(t, func(cmd []string) string {
+		switch cmd[0] {
+		case "PING":
+			return "+PONG\r\n"
+		case "INCR":
+			return ":42\r\n"
+		case "GET":
+			if cmd[1] == "missing" {
+				return "$-1\r\n"
+			}
+			return "$5\r\nhello\r\n"
+		case "EVAL":
+			return "*2\r\n:1\r\n$3\r\n1.5\r\n"
+		default:
+			return "-ERR unknown command\r\n"
+		}
+	})
+	c := NewClient(Options{Addr: srv.ln.Addr().String()})
+	defer c.Close()
+	ctx := context.Background()
+
+	if got, err := c.Do(ctx, "PING"); err != nil || got != "PONG" {
+		t.Errorf("PING = %v, %v", got, err)
+	}
+	if got, err := c.Do(ctx, "INCR", "k"); err != nil || got != int64(42) {
+		t.Errorf("INCR = %v, %v", got, err)
+	}
+	if got, err := c.Do(ctx, "GET", "k"); err != nil || got != "hello" {
+		t.Errorf("GET = %v, %v", got, err)
+	}
+	if _, err := c.Do(ctx, "GET", "missing"); err != ErrNil {
+		t.Errorf("Expected ErrNil, got %v", err)
+	}
+	got, err := c.Do(ctx, "EVAL", "script", 1, "key")
+	arr, ok := got.([]interface{})
+	if err != nil || !ok || len(arr) != 2 || arr[0] != int64(1) || arr[1] != "1.5" {
+		t.Errorf("EVAL = %#v, %v", got, err)
+	}
+
+	var serverErr Error
+	if _, err := c.Do(ctx, "NOPE"); !errors.As(err, &serverErr) || !strings.Contains(err.Error(), "unknown command") {
+		t.Errorf("Expected server error, got %v", err)
+	}
+}
+
+func TestClientKeepsNestedErrorsInPlace(t *testing.T) {
+	srv := newFakeServer(t, func(cmd []string) string {
+		if cmd[0] == "EXEC" {
+			return "*3\r\n+OK\r\n-ERR boom\r\n:5\r\n"
+		}
+		return "+PONG\r\n"
+	})
+	c := NewClient(Options{Addr: srv.ln.Addr().String(), PoolSize: 1})
+	defer c.Close()
+	ctx := context.Background()
+
+	got, err := c.Do(ctx, "EXEC")
+	arr, ok := got.([]interface{})
+	if err != nil || !ok || len(arr) != 3 || arr[0] != "OK" || arr[1] != Error("ERR boom") || arr[2] != int64(5) {
+		t.Fatalf("EXEC = %#v, %v", got, err)
+	}
+	// The pooled connection must not hold the rest of the array
+	if got, err := c.Do(ctx, "PING"); err != nil || got != "PONG" {
+		t.Errorf("PING after EXEC = %v, %v", got, err)
+	}
+}
+
+func TestClientAuthAndSelect(t *testing.T) {
+	srv := newFakeServer(t, func(cmd []string) string { return "+OK\r\n" })
+	c := NewClient(Options{Addr: srv.ln.Addr().String(), Password: "pw", DB: 2})
+	defer c.Close()
+
+	if _, err := c.Do(context.Background(), "PING"); err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+
+	cmds := srv.seen()
+	if len(cmds) != 3 || cmds[0][0] != "AUTH" || cmds[0][1] != "pw" || cmds[1][0] != "SELECT" || cmds[1][1] != "2" {
+		t.Errorf("Expected AUTH and SELECT before the command, got %v", cmds)
+	}
+}
+
+func TestClientReusesConnections(t *testing.T) {
+	srv := newFakeServer(t, func(cmd []string) string { return "+OK\r\n" })
+	c := NewClient(Options{Addr: srv.ln.Addr().String(), Password: "pw"})
+	defer c.Close()
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.Do(context.Background(), "PING"); err != nil {
+			t.Fatalf("Do: %v", err)
+		}
+	}
+
+	auths := 0
+	for _, cmd := range srv.seen() {
+		if cmd[0] == "AUTH" {
+			auths++
+		}
+	}
+	if auths != 1 {
+		t.Errorf("Expected one connection to be reused, saw %d AUTHs", auths)
+	}
+}
+
+func TestClientUnreachable(t *testing.T) {
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := ln.Addr().String()
+	ln.Close()
+
+	c := NewClient(Options{Addr: addr, Timeout: 100 * time.Millisecond})
+	if _, err := c.Do(context.Background(), "PING"); err == nil {
+		t.Error("Expected dial error for a closed port")
+	}
+}
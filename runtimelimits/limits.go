@@ -0,0 +1,295 @@
+// Package runtimelimits fits the Go runtime to the container it runs in.
+// The runtime sizes GOMAXPROCS by the host's CPUs and has no memory limit,
+// so under a Kubernetes CPU limit of, say, 500m it runs a thread per host
+// CPU and gets throttled, and under a memory limit it only collects
+// garbage eagerly once it is too late. Apply derives GOMAXPROCS from the
+// cgroup CPU quota and a soft memory limit from the cgroup memory limit,
+// unless GOMAXPROCS and GOMEMLIMIT say otherwise. It also sets GOGC and
+// an optional memory ballast for deployments that tune the collector for
+// predictable latency.
+package runtimelimits
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"runtime/metrics"
+	"strconv"
+	"strings"
+)
+
+// DefaultCgroupRoot is where the cgroup filesystem is mounted.
+const DefaultCgroupRoot = "/sys/fs/cgroup"
+
+// Sources of the values Apply settles on.
+const (
+	// SourceConfig is a value set in Options.
+	SourceConfig = "config"
+	// SourceEnv is a value from GOMAXPROCS, GOMEMLIMIT or GOGC, which the
+	// runtime applied itself.
+	SourceEnv = "env"
+	// SourceCgroup is a value derived from the cgroup limits.
+	SourceCgroup = "cgroup"
+	// SourceDefault is the runtime's own default: every CPU, no memory
+	// limit, GOGC=100.
+	SourceDefault = "default"
+)
+
+// Options tunes Apply.
+type Options struct {
+	// MaxProcs sets GOMAXPROCS; zero derives it from the CPU quota.
+	MaxProcs int
+	// DisableAutoMaxProcs keeps the runtime's GOMAXPROCS when MaxProcs is
+	// zero.
+	DisableAutoMaxProcs bool
+	// MemoryLimit sets the soft memory limit in bytes; zero derives it
+	// from the cgroup memory limit with MemoryLimitRatio.
+	MemoryLimit int64
+	// MemoryLimitRatio is the fraction of the cgroup memory limit used as
+	// the soft limit, leaving the rest for memory the runtime does not
+	// manage; zero derives no limit.
+	MemoryLimitRatio float64
+	// CgroupRoot is where the cgroup filesystem is mounted
+	// [DefaultCgroupRoot].
+	CgroupRoot string
+	// GCPercent sets GOGC: the heap grows by this percentage of the live
+	// heap before the next collection. Zero keeps GOGC from the
+	// environment or the default of 100; negative turns the collector off
+	// until the heap reaches the memory limit, which then must be set.
+	GCPercent int
+	// MemoryBallast allocates this many bytes the service never touches,
+	// so the heap target is larger and small heaps collect less often.
+	// The ballast counts towards the memory limit but, never written,
+	// costs no resident memory. A memory limit with a high or disabled
+	// GCPercent usually serves better.
+	MemoryBallast int64
+}
+
+// Limits are the values in effect after Apply.
+type Limits struct {
+	MaxProcs       int
+	MaxProcsSource string
+	// CPUQuota is the CPU quota in cores, zero when there is none.
+	CPUQuota float64
+	// MemoryLimit is the soft memory limit in bytes, zero when there is
+	// none.
+	MemoryLimit       int64
+	MemoryLimitSource string
+	// CgroupMemory is the cgroup memory limit in bytes, zero when there is
+	// none.
+	CgroupMemory int64
+	// GCPercent is GOGC, negative when the collector only runs at the
+	// memory limit.
+	GCPercent       int
+	GCPercentSource string
+	// MemoryBallast is the size of the ballast in bytes.
+	MemoryBallast int64
+}
+
+// String describes l for the startup log.
+func (l Limits) String() string {
+	quota := "none"
+	if l.CPUQuota > 0 {
+		quota = strconv.FormatFloat(l.CPUQuota, 'f', -1, 64)
+	}
+	memory := "none"
+	if l.MemoryLimit > 0 {
+		memory = strconv.FormatInt(l.MemoryLimit, 10) + " bytes"
+	}
+	gogc := "off"
+	if l.GCPercent >= 0 {
+		gogc = strconv.Itoa(l.GCPercent)
+	}
+	s := fmt.Sprintf("GOMAXPROCS=%d (%s, cpu quota %s), memory limit %s (%s), GOGC=%s (%s)",
+		l.MaxProcs, l.MaxProcsSource, quota, memory, l.MemoryLimitSource, gogc, l.GCPercentSource)
+	if l.MemoryBallast > 0 {
+		s += fmt.Sprintf(", ballast %d bytes", l.MemoryBallast)
+	}
+	return s
+}
+
+// ballast keeps the memory ballast reachable for the life of the process.
+var ballast []byte
+
+// Apply sets GOMAXPROCS and the soft memory limit as opts says and returns
+// the values in effect. GOMAXPROCS from the CPU quota is the quota rounded
+// down, at least 1 and at most the number of CPUs. Values set in the
+// environment win over derived ones, but not over opts. Missing cgroup
+// files are not an error: outside a container there are no limits. Apply
+// allocates the ballast once; later calls keep the first one.
+func Apply(opts Options) (Limits, error) {
+	if opts.CgroupRoot == "" {
+		opts.CgroupRoot = DefaultCgroupRoot
+	}
+	if opts.MaxProcs < 0 || opts.MemoryLimit < 0 || opts.MemoryLimitRatio < 0 || opts.MemoryLimitRatio > 1 || opts.MemoryBallast < 0 {
+		return Limits{}, fmt.Errorf("invalid runtime limits %+v", opts)
+	}
+	var l Limits
+	quota, err := CPUQuota(opts.CgroupRoot)
+	if err != nil {
+		return Limits{}, err
+	}
+	l.CPUQuota = quota
+	if l.CgroupMemory, err = MemoryLimit(opts.CgroupRoot); err != nil {
+		return Limits{}, err
+	}
+
+	_, procsFromEnv := os.LookupEnv("GOMAXPROCS")
+	switch {
+	case opts.MaxProcs > 0:
+		runtime.GOMAXPROCS(opts.MaxProcs)
+		l.MaxProcsSource = SourceConfig
+	case procsFromEnv:
+		l.MaxProcsSource = SourceEnv
+	case quota > 0 && !opts.DisableAutoMaxProcs:
+		runtime.GOMAXPROCS(min(max(int(quota), 1), runtime.NumCPU()))
+		l.MaxProcsSource = SourceCgroup
+	default:
+		l.MaxProcsSource = SourceDefault
+	}
+	l.MaxProcs = runtime.GOMAXPROCS(0)
+
+	_, memoryFromEnv := os.LookupEnv("GOMEMLIMIT")
+	switch {
+	case opts.MemoryLimit > 0:
+		debug.SetMemoryLimit(opts.MemoryLimit)
+		l.MemoryLimitSource = SourceConfig
+	case memoryFromEnv:
+		l.MemoryLimitSource = SourceEnv
+	case opts.MemoryLimitRatio > 0 && l.CgroupMemory > 0:
+		debug.SetMemoryLimit(int64(float64(l.CgroupMemory) * opts.MemoryLimitRatio))
+		l.MemoryLimitSource = SourceCgroup
+	default:
+		l.MemoryLimitSource = SourceDefault
+	}
+	// A negative input reads the limit without changing it
+	if limit := debug.SetMemoryLimit(-1); limit != math.MaxInt64 {
+		l.MemoryLimit = limit
+	}
+
+	_, gcFromEnv := os.LookupEnv("GOGC")
+	switch {
+	case opts.GCPercent != 0:
+		if opts.GCPercent < 0 && l.MemoryLimit == 0 {
+			return l, errors.New("turning the garbage collector off requires a memory limit")
+		}
+		debug.SetGCPercent(opts.GCPercent)
+		l.GCPercentSource = SourceConfig
+	case gcFromEnv:
+		l.GCPercentSource = SourceEnv
+	default:
+		l.GCPercentSource = SourceDefault
+	}
+	l.GCPercent = GCPercent()
+
+	if opts.MemoryBallast > 0 && ballast == nil {
+		ballast = make([]byte, opts.MemoryBallast)
+	}
+	l.MemoryBallast = int64(len(ballast))
+	return l, nil
+}
+
+// GCPercent returns the GOGC in effect, negative when the collector is
+// off until the memory limit.
+func GCPercent() int {
+	sample := []metrics.Sample{{Name: "/gc/gogc:percent"}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 100
+	}
+	// GOGC=off reads as the largest uint64
+	if v := sample[0].Value.Uint64(); v <= math.MaxInt32 {
+		return int(v)
+	}
+	return -1
+}
+
+// CPUQuota returns the CPU quota of the cgroup mounted at root in cores,
+// or zero when there is none. It reads cpu.max of cgroup v2, or
+// cpu.cfs_quota_us and cpu.cfs_period_us of cgroup v1.
+func CPUQuota(root string) (float64, error) {
+	// cgroup v2: "max 100000" or "50000 100000"
+	if data, err := os.ReadFile(filepath.Join(root, "cpu.max")); err == nil {
+		fields := strings.Fields(string(data))
+		if len(fields) == 0 || len(fields) > 2 {
+			return 0, fmt.Errorf("invalid cpu.max %q", data)
+		}
+		if fields[0] == "max" {
+			return 0, nil
+		}
+		period := "100000"
+		if len(fields) == 2 {
+			period = fields[1]
+		}
+		return quotaCores(fields[0], period)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return 0, err
+	}
+
+	// cgroup v1: a quota of -1 is no quota
+	quota, err := os.ReadFile(filepath.Join(root, "cpu", "cpu.cfs_quota_us"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	period, err := os.ReadFile(filepath.Join(root, "cpu", "cpu.cfs_period_us"))
+	if err != nil {
+		return 0, err
+	}
+	if strings.TrimSpace(string(quota)) == "-1" {
+		return 0, nil
+	}
+	return quotaCores(strings.TrimSpace(string(quota)), strings.TrimSpace(string(period)))
+}
+
+func quotaCores(quota, period string) (float64, error) {
+	q, err := strconv.ParseInt(quota, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid CPU quota %q", quota)
+	}
+	p, err := strconv.ParseInt(period, 10, 64)
+	if err != nil || p <= 0 {
+		return 0, fmt.Errorf("invalid CPU period %q", period)
+	}
+	if q <= 0 {
+		return 0, nil
+	}
+	return float64(q) / float64(p), nil
+}
+
+// unlimitedV1 is the smallest memory.limit_in_bytes cgroup v1 reports for
+// no limit: the largest int64 rounded down to the page size.
+const unlimitedV1 = math.MaxInt64 &^ (1<<12 - 1)
+
+// MemoryLimit returns the memory limit of the cgroup mounted at root in
+// bytes, or zero when there is none. It reads memory.max of cgroup v2, or
+// memory.limit_in_bytes of cgroup v1.
+func MemoryLimit(root string) (int64, error) {
+	data, err := os.ReadFile(filepath.Join(root, "memory.max"))
+	if errors.Is(err, fs.ErrNotExist) {
+		data, err = os.ReadFile(filepath.Join(root, "memory", "memory.limit_in_bytes"))
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	value := strings.TrimSpace(string(data))
+	if value == "max" {
+		return 0, nil
+	}
+	limit, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid memory limit %q", value)
+	}
+	if limit >= unlimitedV1 {
+		return 0, nil
+	}
+	return limit, nil
+}
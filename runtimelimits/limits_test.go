@@ -0,0 +1,235 @@
+package runtimelimits
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"testing"
+)
+
+// cgroup writes files, relative path to content, under a temporary cgroup
+// root.
+func cgroup(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// restoreRuntime puts GOMAXPROCS, the memory limit, GOGC and their
+// environment variables back after the test.
+func restoreRuntime(t *testing.T) {
+	t.Helper()
+	procs := runtime.GOMAXPROCS(0)
+	limit := debug.SetMemoryLimit(-1)
+	gcPercent := GCPercent()
+	for _, key := range []string{"GOMAXPROCS", "GOMEMLIMIT", "GOGC"} {
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+	t.Cleanup(func() {
+		runtime.GOMAXPROCS(procs)
+		debug.SetMemoryLimit(limit)
+		debug.SetGCPercent(gcPercent)
+	})
+}
+
+func TestCPUQuota(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  float64
+	}{
+		{"v2 unlimited", map[string]string{"cpu.max": "max 100000"}, 0},
+		{"v2 half", map[string]string{"cpu.max": "50000 100000"}, 0.5},
+		{"v2 default period", map[string]string{"cpu.max": "250000"}, 2.5},
+		{"v1 unlimited", map[string]string{"cpu/cpu.cfs_quota_us": "-1", "cpu/cpu.cfs_period_us": "100000"}, 0},
+		{"v1 quota", map[string]string{"cpu/cpu.cfs_quota_us": "150000", "cpu/cpu.cfs_period_us": "100000"}, 1.5},
+		{"no cgroup", nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CPUQuota(cgroup(t, tt.files))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %v cores, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCPUQuotaRejectsMalformedFiles(t *testing.T) {
+	for _, content := range []string{"lots 100000", "50000 0", ""} {
+		if _, err := CPUQuota(cgroup(t, map[string]string{"cpu.max": content})); err == nil {
+			t.Errorf("Expected an error for cpu.max %q", content)
+		}
+	}
+}
+
+func TestMemoryLimit(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  int64
+	}{
+		{"v2 unlimited", map[string]string{"memory.max": "max"}, 0},
+		{"v2 limit", map[string]string{"memory.max": "536870912"}, 512 << 20},
+		{"v1 unlimited", map[string]string{"memory/memory.limit_in_bytes": "9223372036854771712"}, 0},
+		{"v1 limit", map[string]string{"memory/memory.limit_in_bytes": "268435456"}, 256 << 20},
+		{"no cgroup", nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MemoryLimit(cgroup(t, tt.files))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %d bytes, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestApplyDerivesFromCgroup(t *testing.T) {
+	restoreRuntime(t)
+	root := cgroup(t, map[string]string{"cpu.max": "150000 100000", "memory.max": "1073741824"})
+
+	limits, err := Apply(Options{CgroupRoot: root, MemoryLimitRatio: 0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 1.5 cores round down to one
+	if limits.MaxProcs != 1 || runtime.GOMAXPROCS(0) != 1 || limits.MaxProcsSource != SourceCgroup || limits.CPUQuota != 1.5 {
+		t.Errorf("Unexpected GOMAXPROCS %+v", limits)
+	}
+	if limits.MemoryLimit != 512<<20 || debug.SetMemoryLimit(-1) != 512<<20 || limits.MemoryLimitSource != SourceCgroup {
+		t.Errorf("Unexpected memory limit %+v", limits)
+	}
+	if s := limits.String(); !strings.Contains(s, "GOMAXPROCS=1 (cgroup, cpu quota 1.5)") || !strings.Contains(s, "536870912 bytes (cgroup)") {
+		t.Errorf("Unexpected description %q", s)
+	}
+}
+
+func TestApplyKeepsDefaultsWithoutLimits(t *testing.T) {
+	restoreRuntime(t)
+	procs := runtime.GOMAXPROCS(0)
+	debug.SetMemoryLimit(math.MaxInt64)
+
+	limits, err := Apply(Options{CgroupRoot: cgroup(t, nil), MemoryLimitRatio: 0.9})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limits.MaxProcs != procs || limits.MaxProcsSource != SourceDefault {
+		t.Errorf("Expected GOMAXPROCS left at %d, got %+v", procs, limits)
+	}
+	if limits.MemoryLimit != 0 || limits.MemoryLimitSource != SourceDefault {
+		t.Errorf("Expected no memory limit, got %+v", limits)
+	}
+	if limits.GCPercent != GCPercent() || limits.GCPercentSource != SourceDefault || limits.MemoryBallast != int64(len(ballast)) {
+		t.Errorf("Expected GOGC and the ballast left alone, got %+v", limits)
+	}
+}
+
+func TestApplySetsGCPercentAndBallast(t *testing.T) {
+	restoreRuntime(t)
+	limits, err := Apply(Options{CgroupRoot: cgroup(t, nil), GCPercent: 400, MemoryBallast: 64 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limits.GCPercent != 400 || GCPercent() != 400 || limits.GCPercentSource != SourceConfig {
+		t.Errorf("Expected GOGC=400 from config, got %+v", limits)
+	}
+	if limits.MemoryBallast != 64<<20 || len(ballast) != 64<<20 {
+		t.Errorf("Expected a 64MiB ballast, got %+v", limits)
+	}
+	if s := limits.String(); !strings.Contains(s, "GOGC=400 (config), ballast 67108864 bytes") {
+		t.Errorf("Unexpected description %q", s)
+	}
+
+	// The ballast is allocated once
+	if limits, err = Apply(Options{CgroupRoot: cgroup(t, nil), MemoryBallast: 1 << 20}); err != nil || limits.MemoryBallast != 64<<20 {
+		t.Errorf("Expected the first ballast kept, got %+v (%v)", limits, err)
+	}
+}
+
+func TestApplyTurnsGCOffOnlyWithMemoryLimit(t *testing.T) {
+	restoreRuntime(t)
+	debug.SetMemoryLimit(math.MaxInt64)
+	if _, err := Apply(Options{CgroupRoot: cgroup(t, nil), GCPercent: -1}); err == nil {
+		t.Error("Expected an error turning the collector off without a memory limit")
+	}
+	if GCPercent() < 0 {
+		t.Error("Expected the collector left on")
+	}
+
+	root := cgroup(t, map[string]string{"memory.max": "1073741824"})
+	limits, err := Apply(Options{CgroupRoot: root, MemoryLimitRatio: 0.9, GCPercent: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limits.GCPercent != -1 || GCPercent() != -1 || !strings.Contains(limits.String(), "GOGC=off (config)") {
+		t.Errorf("Expected the collector off, got %+v", limits)
+	}
+}
+
+func TestApplyPrefersConfigThenEnvironment(t *testing.T) {
+	restoreRuntime(t)
+	root := cgroup(t, map[string]string{"cpu.max": "100000 100000", "memory.max": "1073741824"})
+
+	limits, err := Apply(Options{CgroupRoot: root, MaxProcs: 3, MemoryLimit: 64 << 20, MemoryLimitRatio: 0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limits.MaxProcs != 3 || limits.MaxProcsSource != SourceConfig || limits.MemoryLimit != 64<<20 || limits.MemoryLimitSource != SourceConfig {
+		t.Errorf("Expected the configured values, got %+v", limits)
+	}
+
+	// The runtime applied GOMAXPROCS, GOMEMLIMIT and GOGC itself at startup
+	t.Setenv("GOMAXPROCS", "3")
+	t.Setenv("GOMEMLIMIT", "64MiB")
+	t.Setenv("GOGC", "200")
+	limits, err = Apply(Options{CgroupRoot: root, MemoryLimitRatio: 0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limits.MaxProcs != 3 || limits.MaxProcsSource != SourceEnv || limits.MemoryLimit != 64<<20 || limits.MemoryLimitSource != SourceEnv {
+		t.Errorf("Expected the environment to win over the cgroup, got %+v", limits)
+	}
+	if limits.GCPercentSource != SourceEnv {
+		t.Errorf("Expected GOGC from the environment, got %+v", limits)
+	}
+}
+
+func TestApplyCanSkipAutoMaxProcs(t *testing.T) {
+	restoreRuntime(t)
+	procs := runtime.GOMAXPROCS(0)
+	limits, err := Apply(Options{CgroupRoot: cgroup(t, map[string]string{"cpu.max": "50000 100000"}), DisableAutoMaxProcs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limits.MaxProcs != procs || limits.MaxProcsSource != SourceDefault || limits.CPUQuota != 0.5 {
+		t.Errorf("Expected GOMAXPROCS left at %d with the quota reported, got %+v", procs, limits)
+	}
+}
+
+func TestApplyRejectsInvalidOptions(t *testing.T) {
+	for _, opts := range []Options{{MaxProcs: -1}, {MemoryLimit: -1}, {MemoryLimitRatio: 1.5}, {MemoryBallast: -1}} {
+		if _, err := Apply(opts); err == nil {
+			t.Errorf("Expected an error for %+v", opts)
+		}
+	}
+}
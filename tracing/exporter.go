@@ -0,0 +1,50 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// ExporterConfig is shared by the collector exporters.
+type ExporterConfig struct {
+	// Endpoint is the collector URL spans are POSTed to.
+	Endpoint string
+	// ServiceName and ServiceVersion identify this process in the
+	// collector.
+	ServiceName    string
+	ServiceVersion string
+	// Client sends the exports. Defaults to a client with a 10s timeout.
+	Client *http.Client
+}
+
+func (c ExporterConfig) client() *http.Client {
+	if c.Client != nil {
+		return c.Client
+	}
+	return defaultClient
+}
+
+var defaultClient = &http.Client{Timeout: 10 * time.Second}
+
+// post sends one encoded batch and treats any non-2xx answer as an error.
+func post(ctx context.Context, cfg ExporterConfig, contentType string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := cfg.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("collector %s answered %s", cfg.Endpoint, resp.Status)
+	}
+	return nil
+}
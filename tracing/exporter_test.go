@@ -0,0 +1,55 @@
+package tracing
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ping/observability"
+)
+
+type collectedRequest struct {
+	contentType string
+	body        []byte
+}
+
+// collector is a fake trace collector answering with status.
+func collector(t *testing.T, status int) (string, chan collectedRequest) {
+	t.Helper()
+	got := make(chan collectedRequest, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got <- collectedRequest{r.Header.Get("Content-Type"), body}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, got
+}
+
+// testSpan returns a finished server span with a known parent.
+func testSpan() Span {
+	parent, _ := observability.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	start := time.Unix(1700000000, 0)
+	return Span{
+		Name:       "GET /ping",
+		Kind:       SpanKindServer,
+		Context:    observability.SpanContext{TraceID: parent.TraceID, SpanID: observability.SpanID{1, 2, 3, 4, 5, 6, 7, 8}, Sampled: true},
+		ParentID:   parent.SpanID,
+		StartTime:  start,
+		EndTime:    start.Add(1500 * time.Microsecond),
+		Attributes: map[string]any{"http.response.status_code": 503, "url.path": "/ping"},
+		Error:      true,
+	}
+}
+
+func TestExporterReportsCollectorErrors(t *testing.T) {
+	url, _ := collector(t, http.StatusServiceUnavailable)
+	err := NewZipkinExporter(ExporterConfig{Endpoint: url, ServiceName: "ping"}).ExportSpans(context.Background(), []Span{testSpan()})
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("Expected collector status in error, got %v", err)
+	}
+}
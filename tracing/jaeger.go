@@ -0,0 +1,190 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// JaegerExporter posts spans to a Jaeger collector's HTTP endpoint, e.g.
+// http://jaeger:14268/api/traces, as a Thrift-encoded jaeger.Batch.
+type JaegerExporter struct {
+	cfg ExporterConfig
+}
+
+// NewJaegerExporter returns an exporter for a Jaeger collector.
+func NewJaegerExporter(cfg ExporterConfig) *JaegerExporter {
+	return &JaegerExporter{cfg: cfg}
+}
+
+// Thrift binary protocol type IDs
+const (
+	thriftStop   = 0
+	thriftBool   = 2
+	thriftDouble = 4
+	thriftI32    = 8
+	thriftI64    = 10
+	thriftString = 11
+	thriftStruct = 12
+	thriftList   = 15
+)
+
+// jaeger.thrift TagType values
+const (
+	jaegerTagString = 0
+	jaegerTagDouble = 1
+	jaegerTagBool   = 2
+	jaegerTagLong   = 3
+)
+
+// thriftWriter encodes the small subset of the Thrift binary protocol
+// needed for jaeger.Batch.
+type thriftWriter struct {
+	bytes.Buffer
+}
+
+func (w *thriftWriter) field(typ byte, id int16) {
+	w.WriteByte(typ)
+	w.Write(binary.BigEndian.AppendUint16(nil, uint16(id)))
+}
+
+func (w *thriftWriter) i32(v int32) {
+	w.Write(binary.BigEndian.AppendUint32(nil, uint32(v)))
+}
+
+func (w *thriftWriter) i64(v int64) {
+	w.Write(binary.BigEndian.AppendUint64(nil, uint64(v)))
+}
+
+func (w *thriftWriter) str(s string) {
+	w.i32(int32(len(s)))
+	w.WriteString(s)
+}
+
+func (w *thriftWriter) list(elem byte, n int) {
+	w.WriteByte(elem)
+	w.i32(int32(n))
+}
+
+func (w *thriftWriter) stop() {
+	w.WriteByte(thriftStop)
+}
+
+type jaegerTag struct {
+	key   string
+	value any
+}
+
+func (w *thriftWriter) tag(t jaegerTag) {
+	w.field(thriftString, 1)
+	w.str(t.key)
+	switch v := t.value.(type) {
+	case bool:
+		w.field(thriftI32, 2)
+		w.i32(jaegerTagBool)
+		w.field(thriftBool, 5)
+		if v {
+			w.WriteByte(1)
+		} else {
+			w.WriteByte(0)
+		}
+	case int:
+		w.field(thriftI32, 2)
+		w.i32(jaegerTagLong)
+		w.field(thriftI64, 6)
+		w.i64(int64(v))
+	case int64:
+		w.field(thriftI32, 2)
+		w.i32(jaegerTagLong)
+		w.field(thriftI64, 6)
+		w.i64(v)
+	case float64:
+		w.field(thriftI32, 2)
+		w.i32(jaegerTagDouble)
+		w.field(thriftDouble, 4)
+		w.i64(int64(math.Float64bits(v)))
+	default:
+		w.field(thriftI32, 2)
+		w.i32(jaegerTagString)
+		w.field(thriftString, 3)
+		w.str(fmt.Sprint(v))
+	}
+	w.stop()
+}
+
+func (w *thriftWriter) tags(field int16, tags []jaegerTag) {
+	if len(tags) == 0 {
+		return
+	}
+	w.field(thriftList, field)
+	w.list(thriftStruct, len(tags))
+	for _, t := range tags {
+		w.tag(t)
+	}
+}
+
+func idHalves(b []byte) (high, low int64) {
+	return int64(binary.BigEndian.Uint64(b[:8])), int64(binary.BigEndian.Uint64(b[8:]))
+}
+
+// ExportSpans implements Exporter.
+func (e *JaegerExporter) ExportSpans(ctx context.Context, spans []Span) error {
+	var w thriftWriter
+
+	// Batch.process
+	w.field(thriftStruct, 1)
+	w.field(thriftString, 1)
+	w.str(e.cfg.ServiceName)
+	if e.cfg.ServiceVersion != "" {
+		w.tags(2, []jaegerTag{{"service.version", e.cfg.ServiceVersion}})
+	}
+	w.stop()
+
+	// Batch.spans
+	w.field(thriftList, 2)
+	w.list(thriftStruct, len(spans))
+	for _, s := range spans {
+		high, low := idHalves(s.Context.TraceID[:])
+		w.field(thriftI64, 1)
+		w.i64(low)
+		w.field(thriftI64, 2)
+		w.i64(high)
+		w.field(thriftI64, 3)
+		w.i64(int64(binary.BigEndian.Uint64(s.Context.SpanID[:])))
+		w.field(thriftI64, 4)
+		w.i64(int64(binary.BigEndian.Uint64(s.ParentID[:])))
+		w.field(thriftString, 5)
+		w.str(s.Name)
+		w.field(thriftI32, 7)
+		if s.Context.Sampled {
+			w.i32(1)
+		} else {
+			w.i32(0)
+		}
+		w.field(thriftI64, 8)
+		w.i64(s.StartTime.UnixMicro())
+		w.field(thriftI64, 9)
+		w.i64(s.EndTime.Sub(s.StartTime).Microseconds())
+
+		tags := make([]jaegerTag, 0, len(s.Attributes)+2)
+		switch s.Kind {
+		case SpanKindServer:
+			tags = append(tags, jaegerTag{"span.kind", "server"})
+		case SpanKindClient:
+			tags = append(tags, jaegerTag{"span.kind", "client"})
+		}
+		for _, k := range s.sortedKeys() {
+			tags = append(tags, jaegerTag{k, s.Attributes[k]})
+		}
+		if s.Error {
+			tags = append(tags, jaegerTag{"error", true})
+		}
+		w.tags(10, tags)
+		w.stop()
+	}
+	w.stop()
+
+	return post(ctx, e.cfg, "application/x-thrift", w.Bytes())
+}
@@ -0,0 +1,56 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestJaegerExporter(t *testing.T) {
+	url, got := collector(t, http.StatusAccepted)
+	exp := NewJaegerExporter(ExporterConfig{Endpoint: url, ServiceName: "ping"})
+	span := testSpan()
+	if err := exp.ExportSpans(context.Background(), []Span{span}); err != nil {
+		t.Fatal(err)
+	}
+
+	req := <-got
+	if req.contentType != "application/x-thrift" {
+		t.Errorf("Unexpected content type %q", req.contentType)
+	}
+	// Batch.process.serviceName comes first
+	prefix := []byte{thriftStruct, 0, 1, thriftString, 0, 1, 0, 0, 0, 4, 'p', 'i', 'n', 'g', thriftStop}
+	if !bytes.HasPrefix(req.body, prefix) {
+		t.Errorf("Unexpected process encoding % x", req.body[:len(prefix)])
+	}
+	// Followed by a one-element span list whose first field is traceIdLow
+	spans := []byte{thriftList, 0, 2, thriftStruct, 0, 0, 0, 1, thriftI64, 0, 1}
+	spans = append(spans, span.Context.TraceID[8:]...)
+	if !bytes.HasPrefix(req.body[len(prefix):], spans) {
+		t.Errorf("Unexpected span list encoding % x", req.body[len(prefix):len(prefix)+len(spans)])
+	}
+
+	var expect thriftWriter
+	expect.field(thriftI64, 9)
+	expect.i64(1500)
+	if !bytes.Contains(req.body, expect.Bytes()) {
+		t.Error("Duration in microseconds not found")
+	}
+	for _, s := range []string{"GET /ping", "span.kind", "server", "http.response.status_code", "error"} {
+		if !bytes.Contains(req.body, []byte(s)) {
+			t.Errorf("Expected %q in the batch", s)
+		}
+	}
+	if req.body[len(req.body)-1] != thriftStop {
+		t.Error("Batch should end with a stop field")
+	}
+}
+
+func TestIDHalves(t *testing.T) {
+	id := [16]byte{0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 2}
+	high, low := idHalves(id[:])
+	if high != 1 || low != 2 {
+		t.Errorf("Expected 1/2, got %d/%d", high, low)
+	}
+}
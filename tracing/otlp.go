@@ -0,0 +1,142 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// OTLPExporter posts spans as OTLP/HTTP JSON, e.g. to an OpenTelemetry
+// collector at http://otel-collector:4318/v1/traces.
+type OTLPExporter struct {
+	cfg ExporterConfig
+}
+
+// NewOTLPExporter returns an exporter for an OTLP/HTTP endpoint.
+func NewOTLPExporter(cfg ExporterConfig) *OTLPExporter {
+	return &OTLPExporter{cfg: cfg}
+}
+
+// OTLP span kinds and status codes, from the trace proto
+const (
+	otlpKindInternal = 1
+	otlpKindServer   = 2
+	otlpKindClient   = 3
+	otlpStatusError  = 2
+)
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code int `json:"code,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	TraceState        string          `json:"traceState,omitempty"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+// otlpAttr converts a Go value to an OTLP attribute. 64-bit integers are
+// strings in the proto3 JSON mapping.
+func otlpAttr(key string, v any) otlpAttribute {
+	var val otlpValue
+	switch x := v.(type) {
+	case bool:
+		val.BoolValue = &x
+	case int:
+		s := strconv.Itoa(x)
+		val.IntValue = &s
+	case int64:
+		s := strconv.FormatInt(x, 10)
+		val.IntValue = &s
+	case float64:
+		val.DoubleValue = &x
+	default:
+		s := fmt.Sprint(x)
+		val.StringValue = &s
+	}
+	return otlpAttribute{Key: key, Value: val}
+}
+
+// ExportSpans implements Exporter.
+func (e *OTLPExporter) ExportSpans(ctx context.Context, spans []Span) error {
+	var rs otlpResourceSpans
+	rs.Resource.Attributes = []otlpAttribute{otlpAttr("service.name", e.cfg.ServiceName)}
+	if e.cfg.ServiceVersion != "" {
+		rs.Resource.Attributes = append(rs.Resource.Attributes, otlpAttr("service.version", e.cfg.ServiceVersion))
+	}
+	var ss otlpScopeSpans
+	ss.Scope.Name = "ping"
+	ss.Spans = make([]otlpSpan, len(spans))
+	for i, s := range spans {
+		o := otlpSpan{
+			TraceID:           s.Context.TraceID.String(),
+			SpanID:            s.Context.SpanID.String(),
+			TraceState:        s.Context.TraceState,
+			Name:              s.Name,
+			Kind:              otlpKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(s.StartTime.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.EndTime.UnixNano(), 10),
+		}
+		if s.ParentID.IsValid() {
+			o.ParentSpanID = s.ParentID.String()
+		}
+		switch s.Kind {
+		case SpanKindServer:
+			o.Kind = otlpKindServer
+		case SpanKindClient:
+			o.Kind = otlpKindClient
+		}
+		for _, k := range s.sortedKeys() {
+			o.Attributes = append(o.Attributes, otlpAttr(k, s.Attributes[k]))
+		}
+		if s.Error {
+			o.Status.Code = otlpStatusError
+		}
+		ss.Spans[i] = o
+	}
+	rs.ScopeSpans = []otlpScopeSpans{ss}
+
+	body, err := json.Marshal(otlpRequest{ResourceSpans: []otlpResourceSpans{rs}})
+	if err != nil {
+		return err
+	}
+	return post(ctx, e.cfg, "application/json", body)
+}
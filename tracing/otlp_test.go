@@ -0,0 +1,43 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestOTLPExporter(t *testing.T) {
+	url, got := collector(t, http.StatusOK)
+	exp := NewOTLPExporter(ExporterConfig{Endpoint: url, ServiceName: "ping"})
+	if err := exp.ExportSpans(context.Background(), []Span{testSpan()}); err != nil {
+		t.Fatal(err)
+	}
+
+	req := <-got
+	if req.contentType != "application/json" {
+		t.Errorf("Unexpected content type %q", req.contentType)
+	}
+	var body otlpRequest
+	if err := json.Unmarshal(req.body, &body); err != nil {
+		t.Fatalf("Unexpected body %s (%v)", req.body, err)
+	}
+	rs := body.ResourceSpans[0]
+	if a := rs.Resource.Attributes[0]; a.Key != "service.name" || *a.Value.StringValue != "ping" {
+		t.Errorf("Unexpected resource %+v", rs.Resource)
+	}
+	s := rs.ScopeSpans[0].Spans[0]
+	if s.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || s.ParentSpanID != "00f067aa0ba902b7" || s.Kind != otlpKindServer {
+		t.Errorf("Unexpected span %+v", s)
+	}
+	if s.StartTimeUnixNano != "1700000000000000000" || s.EndTimeUnixNano != "1700000000001500000" {
+		t.Errorf("Unexpected times %s-%s", s.StartTimeUnixNano, s.EndTimeUnixNano)
+	}
+	if s.Status.Code != otlpStatusError {
+		t.Errorf("Expected error status, got %+v", s.Status)
+	}
+	// Attributes are sorted by key; integers use the string form
+	if s.Attributes[0].Key != "http.response.status_code" || *s.Attributes[0].Value.IntValue != "503" {
+		t.Errorf("Unexpected attributes %+v", s.Attributes)
+	}
+}
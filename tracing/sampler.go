@@ -0,0 +1,180 @@
+package tracing
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ping/observability"
+)
+
+// SamplingParams describe a span about to start.
+type SamplingParams struct {
+	// Parent is the caller's span context; invalid for new traces
+	Parent  observability.SpanContext
+	TraceID observability.TraceID
+	Name    string
+	// Route is the request path for server spans, empty otherwise
+	Route string
+}
+
+// Sampler decides whether a new span is recorded and exported. The
+// decision travels downstream in the traceparent sampled flag.
+type Sampler interface {
+	ShouldSample(p SamplingParams) bool
+}
+
+// SamplerFunc adapts a function to Sampler.
+type SamplerFunc func(p SamplingParams) bool
+
+// ShouldSample implements Sampler.
+func (f SamplerFunc) ShouldSample(p SamplingParams) bool { return f(p) }
+
+// AlwaysSample records every span.
+func AlwaysSample() Sampler {
+	return SamplerFunc(func(SamplingParams) bool { return true })
+}
+
+// NeverSample records no spans.
+func NeverSample() Sampler {
+	return SamplerFunc(func(SamplingParams) bool { return false })
+}
+
+// RatioSampler records the given fraction of traces. The decision is
+// derived from the trace ID, so every service using the same ratio keeps
+// the same traces.
+func RatioSampler(ratio float64) Sampler {
+	switch {
+	case ratio >= 1:
+		return AlwaysSample()
+	case ratio <= 0:
+		return NeverSample()
+	}
+	bound := uint64(ratio * math.MaxUint64)
+	return SamplerFunc(func(p SamplingParams) bool {
+		return binary.BigEndian.Uint64(p.TraceID[8:]) < bound
+	})
+}
+
+// ParentBased follows the caller's sampled flag and asks root only for
+// new traces.
+func ParentBased(root Sampler) Sampler {
+	return SamplerFunc(func(p SamplingParams) bool {
+		if p.Parent.IsValid() {
+			return p.Parent.Sampled
+		}
+		return root.ShouldSample(p)
+	})
+}
+
+// rateLimited is a token bucket allowing perSecond samples with a burst of
+// one second's worth.
+type rateLimited struct {
+	mu        sync.Mutex
+	perSecond float64
+	tokens    float64
+	last      time.Time
+	now       func() time.Time
+}
+
+// RateLimitedSampler records at most perSecond spans per second.
+func RateLimitedSampler(perSecond float64) Sampler {
+	return &rateLimited{perSecond: perSecond, tokens: perSecond, now: time.Now}
+}
+
+func (s *rateLimited) ShouldSample(SamplingParams) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if !s.last.IsZero() {
+		s.tokens = math.Min(s.perSecond, s.tokens+now.Sub(s.last).Seconds()*s.perSecond)
+	}
+	s.last = now
+	if s.tokens < 1 {
+		return false
+	}
+	s.tokens--
+	return true
+}
+
+// PerRoute applies a route's own sampler and falls back to def. Routes
+// ending in "/" match every path below them; the longest match wins.
+// Route samplers override the caller's sampled flag, so e.g. admin routes
+// can always be traced.
+func PerRoute(def Sampler, routes map[string]Sampler) Sampler {
+	return SamplerFunc(func(p SamplingParams) bool {
+		best := ""
+		var sampler Sampler
+		for route, s := range routes {
+			match := route == p.Route || (strings.HasSuffix(route, "/") && strings.HasPrefix(p.Route, route))
+			if match && len(route) > len(best) {
+				best, sampler = route, s
+			}
+		}
+		if sampler == nil {
+			sampler = def
+		}
+		return sampler.ShouldSample(p)
+	})
+}
+
+// ParseSampler builds a sampler from a spec: "always", "never",
+// "ratio:<0-1>", "ratelimit:<spans per second>", or any of these behind
+// "parent:" to follow the caller's decision when there is one.
+func ParseSampler(spec string) (Sampler, error) {
+	spec = strings.TrimSpace(spec)
+	if rest, ok := strings.CutPrefix(spec, "parent:"); ok {
+		root, err := ParseSampler(rest)
+		if err != nil {
+			return nil, err
+		}
+		return ParentBased(root), nil
+	}
+
+	kind, arg, hasArg := strings.Cut(spec, ":")
+	switch kind {
+	case "always", "never":
+		if hasArg {
+			return nil, fmt.Errorf("sampler %q takes no argument", kind)
+		}
+		if kind == "always" {
+			return AlwaysSample(), nil
+		}
+		return NeverSample(), nil
+	case "ratio":
+		ratio, err := strconv.ParseFloat(arg, 64)
+		if err != nil || ratio < 0 || ratio > 1 {
+			return nil, fmt.Errorf("sampler ratio must be between 0 and 1, got %q", arg)
+		}
+		return RatioSampler(ratio), nil
+	case "ratelimit":
+		rate, err := strconv.ParseFloat(arg, 64)
+		if err != nil || rate <= 0 {
+			return nil, fmt.Errorf("sampler rate must be positive, got %q", arg)
+		}
+		return RateLimitedSampler(rate), nil
+	}
+	return nil, fmt.Errorf("unknown sampler %q", spec)
+}
+
+// ParseRouteSamplers parses "route=spec" entries, e.g.
+// ["/ping=ratio:0.01", "/debug/=always"].
+func ParseRouteSamplers(entries []string) (map[string]Sampler, error) {
+	routes := make(map[string]Sampler, len(entries))
+	for _, entry := range entries {
+		route, spec, ok := strings.Cut(entry, "=")
+		if !ok || !strings.HasPrefix(route, "/") {
+			return nil, fmt.Errorf("route sampler must look like /path=spec, got %q", entry)
+		}
+		s, err := ParseSampler(spec)
+		if err != nil {
+			return nil, fmt.Errorf("route %s: %w", route, err)
+		}
+		routes[route] = s
+	}
+	return routes, nil
+}
@@ -0,0 +1,114 @@
+package tracing
+
+import (
+	"testing"
+	"time"
+
+	"ping/observability"
+)
+
+func sampledParent(sampled bool) observability.SpanContext {
+	sc, _ := observability.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	sc.Sampled = sampled
+	return sc
+}
+
+func TestRatioSamplerIsDeterministic(t *testing.T) {
+	sampler := RatioSampler(0.25)
+	kept := 0
+	for i := 0; i < 4000; i++ {
+		p := SamplingParams{TraceID: observability.NewTraceID()}
+		first := sampler.ShouldSample(p)
+		if sampler.ShouldSample(p) != first {
+			t.Fatal("Same trace ID must give the same decision")
+		}
+		if first {
+			kept++
+		}
+	}
+	if kept < 800 || kept > 1200 {
+		t.Errorf("Expected about 1000 of 4000 traces sampled, got %d", kept)
+	}
+	if !RatioSampler(1).ShouldSample(SamplingParams{}) || RatioSampler(0).ShouldSample(SamplingParams{TraceID: observability.NewTraceID()}) {
+		t.Error("Ratios 1 and 0 should mean always and never")
+	}
+}
+
+func TestParentBasedSampler(t *testing.T) {
+	sampler := ParentBased(NeverSample())
+	if !sampler.ShouldSample(SamplingParams{Parent: sampledParent(true)}) {
+		t.Error("Sampled parent should be followed")
+	}
+	if sampler.ShouldSample(SamplingParams{Parent: sampledParent(false)}) {
+		t.Error("Unsampled parent should be followed")
+	}
+	if sampler.ShouldSample(SamplingParams{}) {
+		t.Error("Root decision should come from the root sampler")
+	}
+}
+
+func TestRateLimitedSampler(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	sampler := RateLimitedSampler(2).(*rateLimited)
+	sampler.now = func() time.Time { return now }
+
+	results := []bool{}
+	for i := 0; i < 3; i++ {
+		results = append(results, sampler.ShouldSample(SamplingParams{}))
+	}
+	if !results[0] || !results[1] || results[2] {
+		t.Errorf("Expected a burst of 2, got %v", results)
+	}
+	now = now.Add(500 * time.Millisecond)
+	if !sampler.ShouldSample(SamplingParams{}) || sampler.ShouldSample(SamplingParams{}) {
+		t.Error("Expected one token refilled after half a second")
+	}
+}
+
+func TestPerRouteSampler(t *testing.T) {
+	sampler := PerRoute(NeverSample(), map[string]Sampler{
+		"/debug/":      AlwaysSample(),
+		"/debug/noisy": NeverSample(),
+		"/ping":        AlwaysSample(),
+	})
+	cases := map[string]bool{
+		"/ping":          true,
+		"/ping/extra":    false,
+		"/debug/pprof/":  true,
+		"/debug/noisy":   false,
+		"/health":        false,
+		"/debug":         false,
+		"/debug/request": true,
+	}
+	for route, want := range cases {
+		if got := sampler.ShouldSample(SamplingParams{Route: route, Parent: sampledParent(!want)}); got != want {
+			t.Errorf("Route %s: expected %v, got %v", route, want, got)
+		}
+	}
+}
+
+func TestParseSampler(t *testing.T) {
+	for _, spec := range []string{"always", "never", "ratio:0.5", "ratelimit:10", "parent:ratio:0.01", "parent:always"} {
+		if _, err := ParseSampler(spec); err != nil {
+			t.Errorf("Spec %q: %v", spec, err)
+		}
+	}
+	for _, spec := range []string{"", "sometimes", "ratio:2", "ratio:x", "ratelimit:0", "always:1", "parent:"} {
+		if _, err := ParseSampler(spec); err == nil {
+			t.Errorf("Spec %q should be rejected", spec)
+		}
+	}
+
+	parent, _ := ParseSampler("parent:never")
+	if !parent.ShouldSample(SamplingParams{Parent: sampledParent(true)}) {
+		t.Error("parent: prefix should follow a sampled caller")
+	}
+
+	routes, err := ParseRouteSamplers([]string{"/ping=ratio:0.01", "/debug/=always"})
+	if err != nil || len(routes) != 2 {
+		t.Errorf("Unexpected route samplers %v (%v)", routes, err)
+	}
+	if _, err := ParseRouteSamplers([]string{"ping=always"}); err == nil {
+		t.Error("Routes must start with /")
+	}
+}
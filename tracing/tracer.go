@@ -0,0 +1,290 @@
+// Package tracing records spans for sampled requests and exports them in
+// batches to OTLP, Zipkin or Jaeger collectors, using only the standard
+// library. Trace IDs and propagation come from the observability package.
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"ping/observability"
+)
+
+// SpanKind describes the role of a span in a trace.
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = iota
+	SpanKindServer
+	SpanKindClient
+)
+
+// Span is a timed operation within a trace. Its methods are safe to call on
+// a nil *Span so callers need not check whether tracing is enabled.
+type Span struct {
+	Name      string
+	Kind      SpanKind
+	Context   observability.SpanContext
+	ParentID  observability.SpanID
+	StartTime time.Time
+	EndTime   time.Time
+	// Attributes hold string, bool, int, int64 or float64 values
+	Attributes map[string]any
+	Error      bool
+
+	tracer *Tracer
+	ended  bool
+}
+
+// SetAttribute records a key/value pair on the span.
+func (s *Span) SetAttribute(key string, value any) {
+	if s == nil {
+		return
+	}
+	if s.Attributes == nil {
+		s.Attributes = make(map[string]any)
+	}
+	s.Attributes[key] = value
+}
+
+// SetError marks the span as failed.
+func (s *Span) SetError(failed bool) {
+	if s == nil {
+		return
+	}
+	s.Error = failed
+}
+
+// End finishes the span and queues it for export if it is sampled. Calls
+// after the first are ignored.
+func (s *Span) End() {
+	if s == nil || s.ended {
+		return
+	}
+	s.ended = true
+	s.EndTime = time.Now()
+	if s.Context.Sampled {
+		s.tracer.enqueue(*s)
+	}
+}
+
+// sortedKeys lists attribute keys in order so exports are deterministic.
+func (s *Span) sortedKeys() []string {
+	keys := make([]string, 0, len(s.Attributes))
+	for k := range s.Attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Exporter sends a batch of finished spans to a collector.
+type Exporter interface {
+	ExportSpans(ctx context.Context, spans []Span) error
+}
+
+// TracerConfig configures span batching and export.
+type TracerConfig struct {
+	// Exporter receives finished spans. Required.
+	Exporter Exporter
+	// Sampler picks the spans to record. Defaults to following the
+	// caller's decision and sampling every new trace.
+	Sampler Sampler
+	// BatchSize is the most spans sent in one export. Defaults to 512.
+	BatchSize int
+	// FlushInterval bounds how long a span waits before export.
+	// Defaults to 5s.
+	FlushInterval time.Duration
+	// QueueSize is how many finished spans may wait for export; spans
+	// beyond it are dropped. Defaults to 2048.
+	QueueSize int
+	// ExportTimeout bounds each export call. Defaults to 10s.
+	ExportTimeout time.Duration
+	// Metrics counts exported and dropped spans. Defaults to
+	// observability.GetMetrics().
+	Metrics *observability.Metrics
+}
+
+// Tracer starts spans and exports them in the background.
+type Tracer struct {
+	cfg   TracerConfig
+	queue chan Span
+	flush chan chan struct{}
+	done  chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewTracer starts the export loop; call Shutdown to flush it.
+func NewTracer(cfg TracerConfig) *Tracer {
+	if cfg.Sampler == nil {
+		cfg.Sampler = ParentBased(AlwaysSample())
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 512
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = 5 * time.Second
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 2048
+	}
+	if cfg.ExportTimeout <= 0 {
+		cfg.ExportTimeout = 10 * time.Second
+	}
+	if cfg.Metrics == nil {
+		cfg.Metrics = observability.GetMetrics()
+	}
+	t := &Tracer{
+		cfg:   cfg,
+		queue: make(chan Span, cfg.QueueSize),
+		flush: make(chan chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+// Start begins a span as a child of parent, or as the root of a new trace
+// when parent is not valid. The sampler decides whether it is recorded.
+func (t *Tracer) Start(parent observability.SpanContext, name string, kind SpanKind) *Span {
+	return t.start(parent, name, kind, "")
+}
+
+// StartRequest begins the server span for r, letting per-route samplers
+// see its path.
+func (t *Tracer) StartRequest(parent observability.SpanContext, r *http.Request) *Span {
+	return t.start(parent, r.Method+" "+r.URL.Path, SpanKindServer, r.URL.Path)
+}
+
+func (t *Tracer) start(parent observability.SpanContext, name string, kind SpanKind, route string) *Span {
+	sc := observability.ChildSpanContext(parent)
+	sc.Sampled = t.cfg.Sampler.ShouldSample(SamplingParams{
+		Parent:  parent,
+		TraceID: sc.TraceID,
+		Name:    name,
+		Route:   route,
+	})
+	return &Span{
+		Name:      name,
+		Kind:      kind,
+		Context:   sc,
+		ParentID:  parent.SpanID,
+		StartTime: time.Now(),
+		tracer:    t,
+	}
+}
+
+// StartFromContext begins a child of the span in ctx and returns a context
+// carrying the new span, for tracing work within a request.
+func (t *Tracer) StartFromContext(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	span := t.Start(observability.SpanContextFromContext(ctx), name, kind)
+	return observability.WithSpanContext(ctx, span.Context), span
+}
+
+func (t *Tracer) enqueue(s Span) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	metrics := t.cfg.Metrics
+	if t.closed {
+		metrics.TraceSpansCounter.WithLabelValues("dropped").Inc()
+		return
+	}
+	select {
+	case t.queue <- s:
+	default:
+		metrics.TraceSpansCounter.WithLabelValues("dropped").Inc()
+	}
+}
+
+// Flush exports everything queued so far and waits for it.
+func (t *Tracer) Flush(ctx context.Context) error {
+	ack := make(chan struct{})
+	select {
+	case t.flush <- ack:
+	case <-t.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-ack:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown stops accepting spans and exports the remaining ones.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	t.mu.Lock()
+	if !t.closed {
+		t.closed = true
+		close(t.queue)
+	}
+	t.mu.Unlock()
+
+	select {
+	case <-t.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *Tracer) run() {
+	defer close(t.done)
+	ticker := time.NewTicker(t.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]Span, 0, t.cfg.BatchSize)
+	export := func() {
+		if len(batch) == 0 {
+			return
+		}
+		t.export(batch)
+		batch = make([]Span, 0, t.cfg.BatchSize)
+	}
+
+	for {
+		select {
+		case s, ok := <-t.queue:
+			if !ok {
+				export()
+				return
+			}
+			batch = append(batch, s)
+			if len(batch) >= t.cfg.BatchSize {
+				export()
+			}
+		case <-ticker.C:
+			export()
+		case ack := <-t.flush:
+			// Drain what was queued before the flush request
+			for n := len(t.queue); n > 0; n-- {
+				batch = append(batch, <-t.queue)
+				if len(batch) >= t.cfg.BatchSize {
+					export()
+				}
+			}
+			export()
+			close(ack)
+		}
+	}
+}
+
+func (t *Tracer) export(batch []Span) {
+	ctx, cancel := context.WithTimeout(context.Background(), t.cfg.ExportTimeout)
+	defer cancel()
+	metrics := t.cfg.Metrics
+	if err := t.cfg.Exporter.ExportSpans(ctx, batch); err != nil {
+		metrics.TraceSpansCounter.WithLabelValues("failed").Add(float64(len(batch)))
+		observability.DefaultLogger.Warnf(ctx, "trace export of %d spans failed: %v", len(batch), err)
+		return
+	}
+	metrics.TraceSpansCounter.WithLabelValues("exported").Add(float64(len(batch)))
+}
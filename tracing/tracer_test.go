@@ -0,0 +1,135 @@
+package tracing
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"ping/observability"
+)
+
+// memoryExporter keeps exported batches for inspection.
+type memoryExporter struct {
+	mu      sync.Mutex
+	batches [][]Span
+}
+
+func (m *memoryExporter) ExportSpans(ctx context.Context, spans []Span) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.batches = append(m.batches, append([]Span(nil), spans...))
+	return nil
+}
+
+func (m *memoryExporter) spans() []Span {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var all []Span
+	for _, b := range m.batches {
+		all = append(all, b...)
+	}
+	return all
+}
+
+func TestTracerExportsSampledSpans(t *testing.T) {
+	observability.InitMetrics()
+	exp := &memoryExporter{}
+	tracer := NewTracer(TracerConfig{Exporter: exp, FlushInterval: time.Hour})
+
+	parent, _ := observability.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	span := tracer.Start(parent, "GET /", SpanKindServer)
+	span.SetAttribute("http.response.status_code", 200)
+	span.End()
+	span.End() // second End is ignored
+
+	unsampled := parent
+	unsampled.Sampled = false
+	tracer.Start(unsampled, "GET /quiet", SpanKindServer).End()
+
+	if err := tracer.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	got := exp.spans()
+	if len(got) != 1 {
+		t.Fatalf("Expected 1 exported span, got %d", len(got))
+	}
+	s := got[0]
+	if s.Context.TraceID != parent.TraceID || s.ParentID != parent.SpanID || s.Attributes["http.response.status_code"] != 200 {
+		t.Errorf("Unexpected span %+v", s)
+	}
+	if !s.EndTime.After(s.StartTime) && !s.EndTime.Equal(s.StartTime) {
+		t.Errorf("End time %s before start %s", s.EndTime, s.StartTime)
+	}
+	tracer.Shutdown(context.Background())
+}
+
+func TestTracerBatchesAndShutdownFlushes(t *testing.T) {
+	m := observability.NewMetrics(observability.MetricsOptions{})
+	exp := &memoryExporter{}
+	tracer := NewTracer(TracerConfig{Exporter: exp, BatchSize: 2, FlushInterval: time.Hour, Metrics: m})
+
+	for i := 0; i < 5; i++ {
+		tracer.Start(observability.SpanContext{}, "work", SpanKindInternal).End()
+	}
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(exp.spans()); n != 5 {
+		t.Errorf("Expected all 5 spans exported by shutdown, got %d", n)
+	}
+	for _, b := range exp.batches {
+		if len(b) > 2 {
+			t.Errorf("Batch of %d exceeds BatchSize 2", len(b))
+		}
+	}
+
+	tracer.Start(observability.SpanContext{}, "late", SpanKindInternal).End()
+	if testutil.ToFloat64(m.TraceSpansCounter.WithLabelValues("dropped")) != 1 {
+		t.Error("Spans ended after shutdown should be counted as dropped")
+	}
+}
+
+func TestStartFromContextNestsSpans(t *testing.T) {
+	observability.InitMetrics()
+	tracer := NewTracer(TracerConfig{Exporter: &memoryExporter{}})
+	defer tracer.Shutdown(context.Background())
+
+	ctx, outer := tracer.StartFromContext(context.Background(), "outer", SpanKindServer)
+	_, inner := tracer.StartFromContext(ctx, "inner", SpanKindInternal)
+	if inner.Context.TraceID != outer.Context.TraceID || inner.ParentID != outer.Context.SpanID {
+		t.Errorf("Inner span should be a child of outer: %+v / %+v", inner.Context, outer.Context)
+	}
+}
+
+func TestNilSpanIsSafe(t *testing.T) {
+	var span *Span
+	span.SetAttribute("k", "v")
+	span.SetError(true)
+	span.End()
+}
+
+func TestTracerAppliesSampler(t *testing.T) {
+	observability.InitMetrics()
+	exp := &memoryExporter{}
+	tracer := NewTracer(TracerConfig{
+		Exporter: exp,
+		Sampler:  PerRoute(NeverSample(), map[string]Sampler{"/admin/": AlwaysSample()}),
+	})
+
+	quiet := tracer.StartRequest(observability.SpanContext{}, httptest.NewRequest("GET", "/ping", nil))
+	quiet.End()
+	admin := tracer.StartRequest(observability.SpanContext{}, httptest.NewRequest("GET", "/admin/users", nil))
+	admin.End()
+	tracer.Shutdown(context.Background())
+
+	if quiet.Context.Sampled || !admin.Context.Sampled {
+		t.Errorf("Unexpected sampling: /ping=%v /admin/users=%v", quiet.Context.Sampled, admin.Context.Sampled)
+	}
+	if spans := exp.spans(); len(spans) != 1 || spans[0].Name != "GET /admin/users" {
+		t.Errorf("Expected only the admin span exported, got %+v", spans)
+	}
+}
@@ -0,0 +1,76 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// ZipkinExporter posts spans in the Zipkin v2 JSON format, e.g. to
+// http://zipkin:9411/api/v2/spans.
+type ZipkinExporter struct {
+	cfg ExporterConfig
+}
+
+// NewZipkinExporter returns an exporter for a Zipkin collector.
+func NewZipkinExporter(cfg ExporterConfig) *ZipkinExporter {
+	return &ZipkinExporter{cfg: cfg}
+}
+
+type zipkinEndpoint struct {
+	ServiceName string `json:"serviceName"`
+}
+
+type zipkinSpan struct {
+	TraceID       string            `json:"traceId"`
+	ID            string            `json:"id"`
+	ParentID      string            `json:"parentId,omitempty"`
+	Name          string            `json:"name"`
+	Kind          string            `json:"kind,omitempty"`
+	Timestamp     int64             `json:"timestamp"`
+	Duration      int64             `json:"duration"`
+	LocalEndpoint zipkinEndpoint    `json:"localEndpoint"`
+	Tags          map[string]string `json:"tags,omitempty"`
+}
+
+// ExportSpans implements Exporter.
+func (e *ZipkinExporter) ExportSpans(ctx context.Context, spans []Span) error {
+	out := make([]zipkinSpan, len(spans))
+	for i, s := range spans {
+		zs := zipkinSpan{
+			TraceID:       s.Context.TraceID.String(),
+			ID:            s.Context.SpanID.String(),
+			Name:          s.Name,
+			Timestamp:     s.StartTime.UnixMicro(),
+			Duration:      s.EndTime.Sub(s.StartTime).Microseconds(),
+			LocalEndpoint: zipkinEndpoint{ServiceName: e.cfg.ServiceName},
+		}
+		if s.ParentID.IsValid() {
+			zs.ParentID = s.ParentID.String()
+		}
+		switch s.Kind {
+		case SpanKindServer:
+			zs.Kind = "SERVER"
+		case SpanKindClient:
+			zs.Kind = "CLIENT"
+		}
+		if len(s.Attributes) > 0 || s.Error || e.cfg.ServiceVersion != "" {
+			zs.Tags = make(map[string]string, len(s.Attributes)+2)
+			for k, v := range s.Attributes {
+				zs.Tags[k] = fmt.Sprint(v)
+			}
+			if s.Error {
+				zs.Tags["error"] = "true"
+			}
+			if e.cfg.ServiceVersion != "" {
+				zs.Tags["service.version"] = e.cfg.ServiceVersion
+			}
+		}
+		out[i] = zs
+	}
+	body, err := json.Marshal(out)
+	if err != nil {
+		return err
+	}
+	return post(ctx, e.cfg, "application/json", body)
+}
@@ -0,0 +1,32 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestZipkinExporter(t *testing.T) {
+	url, got := collector(t, http.StatusAccepted)
+	exp := NewZipkinExporter(ExporterConfig{Endpoint: url, ServiceName: "ping", ServiceVersion: "1.2.3"})
+	if err := exp.ExportSpans(context.Background(), []Span{testSpan()}); err != nil {
+		t.Fatal(err)
+	}
+
+	req := <-got
+	var spans []zipkinSpan
+	if err := json.Unmarshal(req.body, &spans); err != nil || len(spans) != 1 {
+		t.Fatalf("Unexpected body %s (%v)", req.body, err)
+	}
+	s := spans[0]
+	if s.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || s.ID != "0102030405060708" || s.ParentID != "00f067aa0ba902b7" {
+		t.Errorf("Unexpected IDs %+v", s)
+	}
+	if s.Kind != "SERVER" || s.Timestamp != 1700000000000000 || s.Duration != 1500 || s.LocalEndpoint.ServiceName != "ping" {
+		t.Errorf("Unexpected span fields %+v", s)
+	}
+	if s.Tags["http.response.status_code"] != "503" || s.Tags["error"] != "true" || s.Tags["service.version"] != "1.2.3" {
+		t.Errorf("Unexpected tags %v", s.Tags)
+	}
+}